@@ -0,0 +1,321 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+
+	"github.com/sanspareilsmyn/featurelens/internal/config"
+	"github.com/sanspareilsmyn/featurelens/internal/dataset"
+	"github.com/sanspareilsmyn/featurelens/internal/logging"
+	"github.com/sanspareilsmyn/featurelens/internal/pipeline"
+)
+
+// runBaseline runs the baseline subcommands and returns the process exit code:
+//
+//	featurelens baseline import -config FILE -from train.parquet [-output FILE] [-max-rows 100000]
+//	featurelens baseline capture -config FILE -duration 1h [-output FILE]
+//	featurelens baseline diff -config FILE -duration 10m [-baseline FILE] [-json]
+//
+// Without a subcommand, flags are passed to import.
+func runBaseline(args []string) int {
+	if len(args) > 0 {
+		switch args[0] {
+		case "import":
+			return runBaselineImportCommand(args[1:])
+		case "capture":
+			return runBaselineCapture(args[1:])
+		case "diff":
+			return runBaselineDiff(args[1:])
+		}
+	}
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		fmt.Fprintf(os.Stderr, "baseline: unknown subcommand %q (import, capture or diff)\n", args[0])
+		return exitError
+	}
+	return runBaselineImportCommand(args)
+}
+
+// runBaselineImportCommand runs baseline import, sampling an offline dataset.
+func runBaselineImportCommand(args []string) int {
+	fs := flag.NewFlagSet("baseline import", flag.ContinueOnError)
+	configFile := configFlag(fs)
+	from := fs.String("from", "", "Offline dataset (.csv or .parquet), e.g. the training data, to build the skew baseline snapshot from (required)")
+	output := fs.String("output", "", "File to write the baseline snapshot to (default skew.baselineFile, or stdout)")
+	maxRows := fs.Int("max-rows", 100000, "Rows sampled uniformly from the dataset into the snapshot")
+	if err := fs.Parse(args); err != nil {
+		return exitError
+	}
+	if *from == "" {
+		fmt.Fprintln(os.Stderr, "baseline: -from is required")
+		return exitError
+	}
+	if *maxRows <= 0 {
+		fmt.Fprintf(os.Stderr, "baseline: -max-rows must be positive, got %d\n", *maxRows)
+		return exitError
+	}
+
+	cfg, code := setup(*configFile)
+	if cfg == nil {
+		return code
+	}
+	defer func() {
+		_ = logger.Sync()
+	}()
+	if err := runBaselineImport(cfg, *from, *output, *maxRows); err != nil {
+		logger.Sugar().Errorw("Baseline import failed", "error", err)
+		return exitError
+	}
+	return exitClean
+}
+
+// runBaselineImport samples an offline dataset into a JSON lines snapshot that
+// skew.baselineFile can load, so skew is measured against training data from the start.
+func runBaselineImport(cfg *config.Config, from, output string, maxRows int) error {
+	r, err := dataset.Open(from)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	sample, rows, err := dataset.Sample(r, maxRows, rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64())))
+	if err != nil {
+		return err
+	}
+
+	columns := make(map[string]bool)
+	for _, msg := range sample {
+		for name := range msg {
+			columns[name] = true
+		}
+	}
+	for _, f := range cfg.Features {
+		if f.Pattern == "" && !columns[f.Name] {
+			logger.Sugar().Warnw("Configured feature not found in dataset, it will have no baseline",
+				logging.Feature(f.Name),
+			)
+		}
+	}
+
+	path := output
+	if path == "" {
+		path = cfg.Skew.BaselineFile
+	}
+	var out io.Writer = os.Stdout
+	if path != "" {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return fmt.Errorf("failed to create baseline output directory: %w", err)
+		}
+		f, err := os.Create(path)
+		if err != nil {
+			return fmt.Errorf("failed to create baseline output: %w", err)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	w := bufio.NewWriter(out)
+	enc := json.NewEncoder(w)
+	for _, msg := range sample {
+		if err := enc.Encode(msg); err != nil {
+			return fmt.Errorf("failed to write baseline snapshot: %w", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("failed to write baseline snapshot: %w", err)
+	}
+	logger.Sugar().Infow("Baseline snapshot written",
+		"dataset", from,
+		"rows_read", rows,
+		"rows_written", len(sample),
+		"columns", len(columns),
+		"output", path,
+	)
+	return nil
+}
+
+// runBaselineCapture runs baseline capture, writing the per-feature distributions of the
+// stream to a snapshot.
+func runBaselineCapture(args []string) int {
+	fs := flag.NewFlagSet("baseline capture", flag.ContinueOnError)
+	configFile := configFlag(fs)
+	duration := fs.Duration("duration", 0, "Consume the stream for this long, e.g. 1h (required)")
+	output := fs.String("output", "", "File to write the baseline snapshot to (default skew.baselineFile, or stdout)")
+	if err := fs.Parse(args); err != nil {
+		return exitError
+	}
+	if *duration <= 0 {
+		fmt.Fprintln(os.Stderr, "baseline capture: -duration must be positive")
+		return exitError
+	}
+
+	cfg, code := setup(*configFile)
+	if cfg == nil {
+		return code
+	}
+	defer func() {
+		_ = logger.Sync()
+	}()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	profiles, err := pipeline.CaptureBaseline(ctx, cfg, *duration, logger)
+	if err == nil {
+		err = writeBaselineFile(cmp.Or(*output, cfg.Skew.BaselineFile), profiles)
+	}
+	if err != nil {
+		logger.Sugar().Errorw("Baseline capture failed", "error", err)
+		return exitError
+	}
+	return exitClean
+}
+
+// writeBaselineFile writes a captured snapshot to path, or stdout when empty.
+func writeBaselineFile(path string, profiles []pipeline.BaselineProfile) error {
+	if path == "" {
+		return pipeline.WriteBaseline(os.Stdout, profiles)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create baseline output directory: %w", err)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create baseline output: %w", err)
+	}
+	defer f.Close()
+	if err := pipeline.WriteBaseline(f, profiles); err != nil {
+		return err
+	}
+	logger.Sugar().Infow("Baseline snapshot written", "features", len(profiles), "output", path)
+	return nil
+}
+
+// runBaselineDiff runs baseline diff, comparing the stream with a captured snapshot. It
+// exits with exitViolations when a feature exceeds its skew thresholds.
+func runBaselineDiff(args []string) int {
+	fs := flag.NewFlagSet("baseline diff", flag.ContinueOnError)
+	configFile := configFlag(fs)
+	duration := fs.Duration("duration", 0, "Consume the stream for this long, e.g. 10m (required)")
+	baselineFile := fs.String("baseline", "", "Snapshot written by baseline capture (default skew.baselineFile)")
+	asJSON := fs.Bool("json", false, "Print the comparisons as JSON instead of a table")
+	if err := fs.Parse(args); err != nil {
+		return exitError
+	}
+	if *duration <= 0 {
+		fmt.Fprintln(os.Stderr, "baseline diff: -duration must be positive")
+		return exitError
+	}
+
+	cfg, code := setup(*configFile)
+	if cfg == nil {
+		return code
+	}
+	defer func() {
+		_ = logger.Sync()
+	}()
+	path := cmp.Or(*baselineFile, cfg.Skew.BaselineFile)
+	if path == "" {
+		fmt.Fprintln(os.Stderr, "baseline diff: -baseline is required without skew.baselineFile")
+		return exitError
+	}
+	baseline, err := pipeline.ReadBaseline(path)
+	if err != nil {
+		logger.Sugar().Errorw("Baseline diff failed", "error", err)
+		return exitError
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	current, err := pipeline.CaptureBaseline(ctx, cfg, *duration, logger)
+	if err != nil {
+		logger.Sugar().Errorw("Baseline diff failed", "error", err)
+		return exitError
+	}
+
+	diffs := pipeline.DiffBaseline(cfg, baseline, current)
+	if *asJSON {
+		err = writeBaselineDiffJSON(os.Stdout, diffs)
+	} else {
+		err = printBaselineDiff(os.Stdout, diffs)
+	}
+	if err != nil {
+		logger.Sugar().Errorw("Baseline diff failed", "error", err)
+		return exitError
+	}
+	for _, d := range diffs {
+		if len(d.Exceeded) > 0 {
+			return exitViolations
+		}
+	}
+	return exitClean
+}
+
+// baselineDiffJSON is the JSON output of baseline diff for one feature. MeanDelta is
+// null for categorical features, ChiSquarePValue for numerical ones.
+type baselineDiffJSON struct {
+	FeatureName     string   `json:"featureName"`
+	MetricType      string   `json:"metricType"`
+	BaselineCount   int64    `json:"baselineCount"`
+	CurrentCount    int64    `json:"currentCount"`
+	PSI             float64  `json:"psi"`
+	JSDivergence    float64  `json:"jsDivergence"`
+	MeanDelta       *float64 `json:"meanDelta"`
+	ChiSquarePValue *float64 `json:"chiSquarePValue"`
+	ExceededChecks  []string `json:"exceededChecks"`
+}
+
+func writeBaselineDiffJSON(w io.Writer, diffs []pipeline.BaselineDiff) error {
+	out := make([]baselineDiffJSON, len(diffs))
+	for i, d := range diffs {
+		out[i] = baselineDiffJSON{
+			FeatureName:    d.FeatureName,
+			MetricType:     d.MetricType,
+			BaselineCount:  d.ReferenceCount,
+			CurrentCount:   d.ServingCount,
+			PSI:            d.PSI,
+			JSDivergence:   d.JSDivergence,
+			ExceededChecks: append([]string{}, d.Exceeded...),
+		}
+		if !math.IsNaN(d.MeanDelta) {
+			out[i].MeanDelta = &d.MeanDelta
+		}
+		if !math.IsNaN(d.ChiSquarePValue) {
+			out[i].ChiSquarePValue = &d.ChiSquarePValue
+		}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+func printBaselineDiff(w io.Writer, diffs []pipeline.BaselineDiff) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "FEATURE\tTYPE\tBASELINE\tCURRENT\tPSI\tJS\tMEAN DELTA\tCHI2 P\tSTATUS")
+	for _, d := range diffs {
+		meanDelta, pValue, status := "-", "-", "ok"
+		if !math.IsNaN(d.MeanDelta) {
+			meanDelta = fmt.Sprintf("%.4g", d.MeanDelta)
+		}
+		if !math.IsNaN(d.ChiSquarePValue) {
+			pValue = fmt.Sprintf("%.4g", d.ChiSquarePValue)
+		}
+		if len(d.Exceeded) > 0 {
+			status = "drift: " + strings.Join(d.Exceeded, ",")
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%.4f\t%.4f\t%s\t%s\t%s\n",
+			d.FeatureName, d.MetricType, d.ReferenceCount, d.ServingCount, d.PSI, d.JSDivergence, meanDelta, pValue, status)
+	}
+	return tw.Flush()
+}
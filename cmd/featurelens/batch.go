@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/sanspareilsmyn/featurelens/internal/config"
+	"github.com/sanspareilsmyn/featurelens/internal/pipeline"
+	"github.com/sanspareilsmyn/featurelens/internal/schema"
+)
+
+// Exit codes of every command, a stable contract for CI pipelines gating on feature
+// quality. Only commands that check something exit with exitViolations: batch runs and
+// replays, baseline diff, run --dry-run and fleet status.
+const (
+	exitClean      = 0 // Every check passed, or the command succeeded
+	exitError      = 1 // The command failed, e.g. Kafka was unreachable or the flags were invalid
+	exitViolations = 2 // The command completed and found violations, skew, uncovered features or critical alerts
+)
+
+// errInterrupted fails a one-shot run stopped by a signal before consuming its input.
+var errInterrupted = errors.New("interrupted before the input was consumed")
+
+// runBatch consumes the topic up to its end as a one-shot data quality job, e.g. scheduled
+// by Airflow; see finishRun for its output and exit code.
+func runBatch(cfg *config.Config, until time.Time, reportPath string) int {
+	sugar := logger.Sugar()
+	startedAt := time.Now()
+	pipe, err := pipeline.NewBatch(cfg, until, prometheus.DefaultRegisterer, logger)
+	if err != nil {
+		sugar.Errorw("Failed to initialize batch pipeline", "error", err)
+		return finishRun("batch", nil, startedAt, err, reportPath)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	sugar.Infow("Running batch", "topic", cfg.Kafka.Subscription(), "until", until)
+	err = pipe.Run(ctx)
+	if err != nil {
+		sugar.Errorw("Batch run failed", "error", err)
+	} else if ctx.Err() != nil {
+		err = errInterrupted
+	}
+	return finishRun("batch", pipe, startedAt, err, reportPath)
+}
+
+// finishRun prints the summary of a one-shot run, writes its JSON report to reportPath
+// if set, and returns its exit code: exitError if runErr is not nil or the report cannot
+// be written, exitViolations if any violation was raised, exitClean otherwise. pipe is
+// nil when the pipeline could not be created.
+func finishRun(mode string, pipe *pipeline.Pipeline, startedAt time.Time, runErr error, reportPath string) int {
+	report := schema.RunReport{SchemaVersion: schema.Version, Kind: schema.KindRunReport}
+	if pipe != nil {
+		report = pipe.Summary().Report()
+	}
+	report.Mode, report.StartedAt, report.FinishedAt = mode, startedAt, time.Now()
+	switch {
+	case runErr != nil:
+		report.Status, report.ExitCode, report.Error = schema.RunStatusError, exitError, runErr.Error()
+	case report.Violations > 0:
+		report.Status, report.ExitCode = schema.RunStatusViolations, exitViolations
+	default:
+		report.Status, report.ExitCode = schema.RunStatusClean, exitClean
+	}
+	if report.Features == nil {
+		report.Features, report.ViolationDetails = []schema.FeatureReport{}, []schema.Violation{}
+	}
+
+	printSummary(os.Stdout, report)
+	if reportPath != "" {
+		if err := writeReport(reportPath, report); err != nil {
+			logger.Sugar().Errorw("Failed to write run report", "path", reportPath, "error", err)
+			return exitError
+		}
+	}
+	return report.ExitCode
+}
+
+// writeReport writes report as indented JSON to path, replacing it atomically so CI
+// never reads a partial report.
+func writeReport(path string, report schema.RunReport) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// printSummary prints one line per feature, then a summary, e.g.
+//
+//	FEATURE    WINDOWS  COUNT  VIOLATIONS  SILENCED  CHECKS
+//	feature_a  12       6000   2           0         mean,null_rate
+func printSummary(w io.Writer, report schema.RunReport) {
+	if len(report.Features) > 0 {
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "FEATURE\tWINDOWS\tCOUNT\tVIOLATIONS\tSILENCED\tCHECKS")
+		for _, f := range report.Features {
+			checks := "-"
+			if len(f.Checks) > 0 {
+				checks = strings.Join(f.Checks, ",")
+			}
+			fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%s\n", f.FeatureName, f.Windows, f.Count, f.Violations, f.Silenced, checks)
+		}
+		_ = tw.Flush()
+	}
+
+	switch report.Status {
+	case schema.RunStatusError:
+		fmt.Fprintf(w, "%s: ERROR: %s\n", report.Mode, report.Error)
+	case schema.RunStatusViolations:
+		failed := 0
+		for _, f := range report.Features {
+			if f.Violations > 0 {
+				failed++
+			}
+		}
+		fmt.Fprintf(w, "%s: FAIL: %d violations in %d of %d features (%d windows)\n", report.Mode, report.Violations, failed, len(report.Features), report.Windows)
+	default:
+		fmt.Fprintf(w, "%s: OK (%d features, %d windows)\n", report.Mode, len(report.Features), report.Windows)
+	}
+}
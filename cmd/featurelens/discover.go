@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/sanspareilsmyn/featurelens/internal/config"
+	"github.com/sanspareilsmyn/featurelens/internal/discovery"
+	"github.com/sanspareilsmyn/featurelens/internal/pipeline"
+)
+
+// runDiscover runs the discover subcommand:
+//
+//	featurelens discover -config FILE -duration 10m [-output FILE] [-max-categories 50]
+func runDiscover(args []string) int {
+	fs := flag.NewFlagSet("discover", flag.ContinueOnError)
+	configFile := configFlag(fs)
+	duration := fs.Duration("duration", 0, "Sample the stream for this long, e.g. 10m (required)")
+	output := fs.String("output", "", "File to write the suggested features config to (default stdout)")
+	maxCategories := fs.Int("max-categories", 50, "String fields with more distinct values are not suggested as categorical")
+	if err := fs.Parse(args); err != nil {
+		return exitError
+	}
+	if *duration <= 0 {
+		fmt.Fprintln(os.Stderr, "discover: -duration must be positive")
+		return exitError
+	}
+
+	cfg, code := setup(*configFile)
+	if cfg == nil {
+		return code
+	}
+	defer func() {
+		_ = logger.Sync()
+	}()
+	if err := runDiscovery(cfg, *duration, *output, *maxCategories); err != nil {
+		logger.Sugar().Errorw("Schema discovery failed", "error", err)
+		return exitError
+	}
+	return exitClean
+}
+
+// runDiscovery samples the configured topic and writes a suggested `features:` block.
+func runDiscovery(cfg *config.Config, duration time.Duration, output string, maxCategories int) error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	opts := discovery.Options{MaxCategories: maxCategories, Duration: duration}
+	// Track one value past the limit so overflowing fields are recognised as free text
+	profiler := discovery.NewProfiler(opts.MaxCategories + 1)
+	if err := pipeline.Discover(ctx, cfg, duration, profiler, logger); err != nil {
+		return err
+	}
+
+	var out io.Writer = os.Stdout
+	if output != "" {
+		f, err := os.Create(output)
+		if err != nil {
+			return fmt.Errorf("failed to create discovery output: %w", err)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	suggestions := discovery.Suggest(profiler, opts)
+	if err := discovery.WriteConfig(out, profiler, suggestions, opts); err != nil {
+		return fmt.Errorf("failed to write discovery output: %w", err)
+	}
+	logger.Sugar().Infow("Suggested features config written",
+		"fields", len(suggestions),
+		"output", output,
+	)
+	return nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sanspareilsmyn/featurelens/internal/config"
+	"github.com/sanspareilsmyn/featurelens/internal/pipeline"
+)
+
+// runDryRun samples the configured topic, prints how the configured features are covered
+// and returns exitViolations if any does not match its configuration, e.g. as a CI gate on
+// config changes.
+func runDryRun(cfg *config.Config, messages int64, timeout time.Duration) int {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	report, err := pipeline.DryRun(ctx, cfg, messages, timeout, logger)
+	if err != nil {
+		logger.Sugar().Errorw("Dry run failed", "error", err)
+		return exitError
+	}
+	printCoverage(os.Stdout, report)
+	if report.Messages == 0 {
+		return exitError // Nothing to check, e.g. an idle topic
+	}
+	if !report.OK() {
+		return exitViolations
+	}
+	return exitClean
+}
+
+// printCoverage prints one line per feature and group pattern, then a summary, e.g.
+//
+//	FEATURE    TYPE       PRESENT  NULL  MISMATCH  STATUS
+//	feature_a  numerical  100.0%   2.0%  0         ok
+func printCoverage(w io.Writer, report pipeline.DryRunReport) {
+	if report.Messages == 0 {
+		fmt.Fprintln(w, "dry run: FAIL: no message sampled")
+		return
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "FEATURE\tTYPE\tPRESENT\tNULL\tMISMATCH\tSTATUS")
+	failed := len(report.Unmatched)
+	for _, c := range report.Features {
+		status := "ok"
+		if problem := c.Problem(); problem != "" {
+			status = "FAIL: " + problem
+			failed++
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%s\n", c.FeatureName, c.MetricType, share(c.Present, c.Messages), share(c.Null, c.Present), c.TypeMismatch, status)
+	}
+	for _, pattern := range report.Unmatched {
+		fmt.Fprintf(tw, "%s\t-\t-\t-\t-\tFAIL: no sampled field matches the group pattern\n", pattern)
+	}
+	_ = tw.Flush()
+
+	if failed > 0 {
+		fmt.Fprintf(w, "dry run: FAIL: %d of %d features or patterns do not match %d sampled messages\n", failed, len(report.Features)+len(report.Unmatched), report.Messages)
+		return
+	}
+	fmt.Fprintf(w, "dry run: OK (%d features, %d messages)\n", len(report.Features), report.Messages)
+}
+
+// share formats n out of total as a percentage, "-" without a total.
+func share(n, total int64) string {
+	if total == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%%", 100*float64(n)/float64(total))
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/sanspareilsmyn/featurelens/internal/feast"
+)
+
+// runFeast runs the feast subcommands and returns the process exit code:
+//
+//	featurelens feast import -registry registry.json [-project NAME] [-views a,b] [-output FILE] [-full-feature-names]
+//
+// import is the only subcommand so far and may be left out, so
+// `featurelens feast -registry registry.json` imports as well.
+func runFeast(args []string) int {
+	if len(args) > 0 && args[0] == "import" {
+		return runFeastImport(args[1:])
+	}
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		fmt.Fprintf(os.Stderr, "feast: unknown subcommand %q (import)\n", args[0])
+		return exitError
+	}
+	return runFeastImport(args)
+}
+
+// runFeastImport runs feast import, writing a features config generated from a Feast
+// registry dump. It does not load a FeatureLens configuration: the output is meant to be
+// included from one.
+func runFeastImport(args []string) int {
+	fs := flag.NewFlagSet("feast import", flag.ContinueOnError)
+	registry := fs.String("registry", "", "Feast registry dump in JSON, from `feast registry-dump` (required)")
+	project := fs.String("project", "", "Only import feature views of this Feast project")
+	views := fs.String("views", "", "Comma-separated feature views to import (default all)")
+	output := fs.String("output", "", "File to write the features config to (default stdout)")
+	fullNames := fs.Bool("full-feature-names", false, "Name features <view>__<feature>, as Feast does with full_feature_names=True")
+	if err := fs.Parse(args); err != nil {
+		return exitError
+	}
+	if *registry == "" {
+		fmt.Fprintln(os.Stderr, "feast: -registry is required")
+		return exitError
+	}
+
+	opts := feast.Options{Project: *project, FullFeatureNames: *fullNames}
+	if *views != "" {
+		for _, v := range strings.Split(*views, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				opts.FeatureViews = append(opts.FeatureViews, v)
+			}
+		}
+	}
+	if err := runFeastDefinitions(*registry, *output, opts); err != nil {
+		fmt.Fprintf(os.Stderr, "feast: %v\n", err)
+		return exitError
+	}
+	return exitClean
+}
+
+// runFeastDefinitions reads the registry and writes the generated features config.
+func runFeastDefinitions(registry, output string, opts feast.Options) error {
+	reg, err := feast.Load(registry)
+	if err != nil {
+		return err
+	}
+	defs, err := feast.Definitions(reg, opts)
+	if err != nil {
+		return err
+	}
+
+	var out io.Writer = os.Stdout
+	if output != "" {
+		f, err := os.Create(output)
+		if err != nil {
+			return fmt.Errorf("failed to create feast output: %w", err)
+		}
+		defer f.Close()
+		out = f
+	}
+	if err := feast.WriteConfig(out, defs, registry); err != nil {
+		return fmt.Errorf("failed to write feast output: %w", err)
+	}
+
+	var skipped int
+	for _, d := range defs {
+		if d.Skipped != "" {
+			skipped++
+		}
+	}
+	fmt.Fprintf(os.Stderr, "feast: %d features imported, %d skipped\n", len(defs)-skipped, skipped)
+	return nil
+}
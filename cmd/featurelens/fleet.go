@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sanspareilsmyn/featurelens/internal/admin"
+	"github.com/sanspareilsmyn/featurelens/internal/pipeline"
+)
+
+// maxStatusBytes bounds the size of an instance's status response.
+const maxStatusBytes = 4 << 20
+
+// fleetInstance is the outcome of querying one instance's status.
+type fleetInstance struct {
+	Endpoint string                `json:"endpoint"`
+	Status   *admin.InstanceStatus `json:"status,omitempty"`
+	Error    string                `json:"error,omitempty"`
+}
+
+// runFleet runs the fleet subcommands and returns the process exit code:
+//
+//	featurelens fleet status -endpoints http://a:8081,http://b:8081
+func runFleet(args []string) int {
+	if len(args) == 0 || args[0] != "status" {
+		fmt.Fprintln(os.Stderr, "usage: featurelens fleet status -endpoints URL[,URL...] [-timeout 5s] [-token-file FILE] [-json]")
+		return exitError
+	}
+
+	fs := flag.NewFlagSet("fleet status", flag.ContinueOnError)
+	endpoints := fs.String("endpoints", "", "Comma-separated admin API base URLs (or host:port) of the instances to query")
+	timeout := fs.Duration("timeout", 5*time.Second, "Per-instance request timeout")
+	tokenFile := fs.String("token-file", "", "File holding a bearer token sent to every instance")
+	asJSON := fs.Bool("json", false, "Print the raw statuses as JSON instead of tables")
+	if err := fs.Parse(args[1:]); err != nil {
+		return exitError
+	}
+	if *endpoints == "" {
+		fmt.Fprintln(os.Stderr, "fleet status: -endpoints is required")
+		return exitError
+	}
+
+	var token string
+	if *tokenFile != "" {
+		raw, err := os.ReadFile(*tokenFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "fleet status: failed to read token file: %v\n", err)
+			return exitError
+		}
+		token = strings.TrimSpace(string(raw))
+	}
+
+	var urls []string
+	for _, e := range strings.Split(*endpoints, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			urls = append(urls, e)
+		}
+	}
+	instances := queryFleet(context.Background(), urls, token, *timeout)
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(instances); err != nil {
+			fmt.Fprintf(os.Stderr, "fleet status: %v\n", err)
+			return exitError
+		}
+	} else {
+		printFleet(os.Stdout, instances)
+	}
+
+	// An unreachable instance is an error, an unsilenced critical alert a violation
+	code := exitClean
+	for _, inst := range instances {
+		if inst.Status == nil {
+			return exitError
+		}
+		for _, alert := range inst.Status.Alerts {
+			if alert.Severity == pipeline.SeverityCritical && !alert.Silenced {
+				code = exitViolations
+			}
+		}
+	}
+	return code
+}
+
+// queryFleet fetches every instance's status concurrently, preserving endpoint order.
+func queryFleet(ctx context.Context, endpoints []string, token string, timeout time.Duration) []fleetInstance {
+	client := &http.Client{Timeout: timeout}
+	instances := make([]fleetInstance, len(endpoints))
+	var wg sync.WaitGroup
+	for i, endpoint := range endpoints {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			instances[i].Endpoint = endpoint
+			status, err := fetchStatus(ctx, client, endpoint, token)
+			if err != nil {
+				instances[i].Error = err.Error()
+				return
+			}
+			instances[i].Status = status
+		}()
+	}
+	wg.Wait()
+	return instances
+}
+
+// fetchStatus queries one instance's admin status endpoint.
+func fetchStatus(ctx context.Context, client *http.Client, endpoint, token string) (*admin.InstanceStatus, error) {
+	base := strings.TrimSuffix(endpoint, "/")
+	if !strings.Contains(base, "://") {
+		base = "http://" + base
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, base+admin.Prefix+"status", nil)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxStatusBytes))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(body, &apiErr) == nil && apiErr.Error != "" {
+			return nil, fmt.Errorf("%s: %s", resp.Status, apiErr.Error)
+		}
+		return nil, errors.New(resp.Status)
+	}
+	var status admin.InstanceStatus
+	if err := json.Unmarshal(body, &status); err != nil {
+		return nil, fmt.Errorf("invalid status response: %w", err)
+	}
+	return &status, nil
+}
+
+// printFleet writes an overview of every instance followed by the alerts firing
+// across the fleet.
+func printFleet(out io.Writer, instances []fleetInstance) {
+	now := time.Now()
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ENDPOINT\tTOPIC\tSTATE\tUPTIME\tFEATURES\tCRITICAL\tWARNING\tINFO\tSILENCED")
+	var firing int
+	var unreachable []fleetInstance
+	for _, inst := range instances {
+		if inst.Status == nil {
+			fmt.Fprintf(w, "%s\t-\tunreachable\t-\t-\t-\t-\t-\t-\n", inst.Endpoint)
+			unreachable = append(unreachable, inst)
+			continue
+		}
+		counts := make(map[string]int)
+		var silenced int
+		for _, alert := range inst.Status.Alerts {
+			if alert.Silenced {
+				silenced++
+				continue
+			}
+			counts[alert.Severity]++
+		}
+		state := "ok"
+		if active := len(inst.Status.Alerts) - silenced; active > 0 {
+			state = "alerting"
+			firing += active
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%d\t%d\t%d\t%d\n",
+			inst.Endpoint, inst.Status.Topic, state,
+			now.Sub(inst.Status.StartedAt).Truncate(time.Second),
+			inst.Status.Features,
+			counts[pipeline.SeverityCritical], counts[pipeline.SeverityWarning], counts[pipeline.SeverityInfo],
+			silenced,
+		)
+	}
+	_ = w.Flush()
+
+	for _, inst := range unreachable {
+		fmt.Fprintf(out, "%s: %s\n", inst.Endpoint, inst.Error)
+	}
+	if firing == 0 {
+		fmt.Fprintln(out, "\nNo alerts firing.")
+		return
+	}
+	fmt.Fprintln(out, "\nFiring alerts:")
+	w = tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ENDPOINT\tTOPIC\tFEATURE\tCHECK\tSEVERITY\tACTUAL\tTHRESHOLD\tFIRING FOR\tACKED BY")
+	for _, inst := range instances {
+		if inst.Status == nil {
+			continue
+		}
+		for _, alert := range inst.Status.Alerts {
+			if alert.Silenced {
+				continue
+			}
+			ackedBy := "-"
+			if alert.Acknowledgement != nil {
+				ackedBy = alert.Acknowledgement.By
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s%s\t%s\t%g\t%g\t%s\t%s\n",
+				inst.Endpoint, inst.Status.Topic, alert.FeatureName,
+				alert.CheckType, alert.Comparison, alert.Severity,
+				alert.Actual, alert.Threshold,
+				now.Sub(alert.Since).Truncate(time.Second),
+				ackedBy,
+			)
+		}
+	}
+	_ = w.Flush()
+}
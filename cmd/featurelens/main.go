@@ -1,66 +1,297 @@
 package main
 
 import (
+	"cmp"
 	"context"
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
+	"text/tabwriter"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 
+	"github.com/sanspareilsmyn/featurelens/internal/admin"
+	"github.com/sanspareilsmyn/featurelens/internal/api"
 	"github.com/sanspareilsmyn/featurelens/internal/config"
+	"github.com/sanspareilsmyn/featurelens/internal/leader"
 	"github.com/sanspareilsmyn/featurelens/internal/logging"
+	"github.com/sanspareilsmyn/featurelens/internal/middleware"
 	"github.com/sanspareilsmyn/featurelens/internal/pipeline"
+	"github.com/sanspareilsmyn/featurelens/internal/schema"
+	"github.com/sanspareilsmyn/featurelens/internal/telemetry"
+	"github.com/sanspareilsmyn/featurelens/internal/version"
+	"github.com/sanspareilsmyn/featurelens/internal/webui"
 )
 
+// defaultConfigFile is the configuration loaded when -config is not given.
+const defaultConfigFile = "configs/config.dev.yaml"
+
 var (
-	configFile = flag.String("config", "configs/config.dev.yaml", "Path to the configuration file")
-	logger     *zap.Logger
+	logger    *zap.Logger
+	logLevels *logging.Levels // Change the verbosity of logger at runtime
 )
 
+// command is a featurelens subcommand. run receives the arguments after the command
+// name and returns the process exit code.
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) int
+}
+
+var commands = []command{
+	{"run", "Monitor the configured topic (the default when no command is given)", runMonitor},
+	{"validate", "Check a configuration file and exit", runValidate},
+	{"replay", "Run the pipeline over the messages of a file, then exit", runReplay},
+	{"discover", "Sample the topic and print a suggested features config", runDiscover},
+	{"tune", "Learn the stream for a period and write suggested thresholds to a config patch file", runTune},
+	{"baseline", "Build skew baseline snapshots (import, capture) and diff the stream against one", runBaseline},
+	{"feast", "Generate a features config from a Feast feature store registry", runFeast},
+	{"rules", "Translate a JSON Schema or Great Expectations suite into a features config", runRules},
+	{"fleet", "Query the status of other FeatureLens instances", runFleet},
+	{"promrules", "Render the configured thresholds as Prometheus alerting rules", runPromRules},
+	{"version", "Print the build metadata of the binary", runVersion},
+}
+
 func main() {
-	// Initialize Configuration
-	flag.Parse()
+	args := os.Args[1:]
+	// Without a command, flags are passed to run, as before subcommands existed
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		os.Exit(runMonitor(args))
+	}
+	switch args[0] {
+	case "help", "-h", "--help":
+		usage(os.Stdout)
+		os.Exit(0)
+	}
+	for _, cmd := range commands {
+		if cmd.name == args[0] {
+			os.Exit(cmd.run(args[1:]))
+		}
+	}
+	fmt.Fprintf(os.Stderr, "featurelens: unknown command %q\n\n", args[0])
+	usage(os.Stderr)
+	os.Exit(exitError)
+}
 
-	cfg, err := config.Load(*configFile)
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: featurelens <command> [flags]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, cmd := range commands {
+		fmt.Fprintf(tw, "  %s\t%s\n", cmd.name, cmd.summary)
+	}
+	_ = tw.Flush()
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Run 'featurelens <command> -h' for the flags of a command.")
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "Exit codes: %d success, %d error (including invalid flags), %d violations found by a\n", exitClean, exitError, exitViolations)
+	fmt.Fprintln(w, "batch run, replay, baseline diff, dry run or fleet status.")
+}
+
+// configFlag registers the -config flag shared by every command that loads a configuration.
+func configFlag(fs *flag.FlagSet) *string {
+	return fs.String("config", defaultConfigFile, "Comma-separated configuration files or directories; later ones override earlier ones")
+}
+
+// setup loads the configuration and initializes the global logger. On failure it
+// reports the error and returns a nil configuration and the exit code.
+func setup(configFile string) (*config.Config, int) {
+	cfg, err := config.Load(configFile)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "FATAL: Failed to load configuration from %s: %v\n", *configFile, err)
-		os.Exit(1)
+		fmt.Fprintf(os.Stderr, "FATAL: Failed to load configuration from %s: %v\n", configFile, err)
+		return nil, exitError
 	}
 
-	// Initialize Logger
-	var logErr error
-	logger, logErr = logging.NewLogger(cfg.Log)
-	if logErr != nil {
-		fmt.Fprintf(os.Stderr, "FATAL: Failed to initialize logger: %v\n", logErr)
-		os.Exit(1)
+	logCfg := cfg.Log
+	logCfg.Pipeline = cmp.Or(logCfg.Pipeline, cfg.Kafka.GroupID)
+	logger, logLevels, err = logging.NewLogger(logCfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "FATAL: Failed to initialize logger: %v\n", err)
+		return nil, exitError
 	}
-	defer func() {
-		_ = logger.Sync() // Flush buffered logs on exit
-	}()
 
 	sugar := logger.Sugar()
 	sugar.Infow("Logger initialized",
 		"level", cfg.Log.Level,
 		"format", cfg.Log.Format,
 	)
-	sugar.Infow("Configuration loaded successfully", "path", *configFile)
+	sugar.Infow("Configuration loaded successfully", "path", configFile, "version", version.Get().String())
+	for _, deprecation := range cfg.Deprecations {
+		sugar.Warnw("Deprecated configuration setting", "setting", deprecation)
+	}
+	if len(cfg.DisabledFeatures) > 0 {
+		sugar.Infow("Features disabled by configuration", "features", cfg.DisabledFeatures)
+	}
+	return cfg, 0
+}
+
+// runReplay runs the replay subcommand:
+//
+//	featurelens replay -config FILE -file messages.jsonl [-report report.json]
+//
+// Like batch runs, it exits with exitClean, exitViolations or exitError; see finishRun.
+func runReplay(args []string) int {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	configFile := configFlag(fs)
+	file := fs.String("file", "", "File of messages to replay, one per line in the configured payload format (required)")
+	reportPath := reportFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return exitError
+	}
+	if *file == "" {
+		fmt.Fprintln(os.Stderr, "replay: -file is required")
+		return exitError
+	}
+
+	cfg, code := setup(*configFile)
+	if cfg == nil {
+		return code
+	}
+	defer func() {
+		_ = logger.Sync()
+	}()
+	sugar := logger.Sugar()
+
+	startedAt := time.Now()
+	pipe, err := pipeline.NewReplay(cfg, *file, prometheus.DefaultRegisterer, logger)
+	if err != nil {
+		sugar.Errorw("Failed to initialize replay pipeline", "error", err)
+		return finishRun("replay", nil, startedAt, err, *reportPath)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	sugar.Infow("Replaying messages", "file", *file)
+	err = pipe.Run(ctx)
+	switch {
+	case err != nil:
+		sugar.Errorw("Replay failed", "error", err)
+	case ctx.Err() != nil:
+		err = errInterrupted
+	default:
+		sugar.Info("Replay finished.")
+	}
+	return finishRun("replay", pipe, startedAt, err, *reportPath)
+}
+
+// reportFlag registers the -report flag of one-shot runs.
+func reportFlag(fs *flag.FlagSet) *string {
+	return fs.String("report", "", "File to write the JSON run report to, e.g. for CI (schema v1/run_report.schema.json)")
+}
+
+// runMonitor runs the run subcommand, monitoring the configured topic until interrupted:
+//
+//	featurelens run -config FILE [-dry-run [-dry-run-messages 1000] [-dry-run-timeout 1m]]
+//	featurelens run -config FILE -batch [-until 2024-05-01T08:00:00Z] [-report report.json]
+//
+// Batch runs exit with exitClean, exitViolations or exitError; see finishRun. Invalid
+// flags exit with exitError whether or not -batch is set, never with exitViolations.
+func runMonitor(args []string) int {
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	configFile := configFlag(fs)
+	dryRun := fs.Bool("dry-run", false, "Check the configured features against a sample of the topic, print a coverage report and exit")
+	dryRunMessages := fs.Int64("dry-run-messages", 1000, "Messages sampled by -dry-run")
+	dryRunTimeout := fs.Duration("dry-run-timeout", time.Minute, "Longest -dry-run waits for its sample")
+	batch := fs.Bool("batch", false, "Consume the topic up to its high watermark, print a summary and exit 2 on violations")
+	untilFlag := fs.String("until", "", "With -batch, stop at the first messages at or after this RFC 3339 time instead of the high watermark")
+	reportPath := reportFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return exitError
+	}
+	if *dryRun && (*dryRunMessages <= 0 || *dryRunTimeout <= 0) {
+		fmt.Fprintln(os.Stderr, "run: -dry-run-messages and -dry-run-timeout must be positive")
+		return exitError
+	}
+	if *dryRun && *batch {
+		fmt.Fprintln(os.Stderr, "run: -dry-run and -batch are mutually exclusive")
+		return exitError
+	}
+	if (*untilFlag != "" || *reportPath != "") && !*batch {
+		fmt.Fprintln(os.Stderr, "run: -until and -report require -batch")
+		return exitError
+	}
+	var until time.Time
+	if *untilFlag != "" {
+		var err error
+		if until, err = time.Parse(time.RFC3339, *untilFlag); err != nil {
+			fmt.Fprintf(os.Stderr, "run: -until must be an RFC 3339 time: %v\n", err)
+			return exitError
+		}
+	}
+
+	cfg, code := setup(*configFile)
+	if cfg == nil {
+		return code
+	}
+	defer func() {
+		_ = logger.Sync() // Flush buffered logs on exit
+	}()
+	if *dryRun {
+		return runDryRun(cfg, *dryRunMessages, *dryRunTimeout)
+	}
+	if *batch {
+		return runBatch(cfg, until, *reportPath)
+	}
+	sugar := logger.Sugar()
+
+	// Initialize OpenTelemetry (no-op unless enabled)
+	shutdownTelemetry, err := telemetry.Setup(context.Background(), cfg.Telemetry, logger.Named("telemetry"))
+	if err != nil {
+		sugar.Fatalw("Failed to initialize telemetry", "error", err)
+	}
+
+	// Build HTTP middleware chains (authentication, allowlists) per surface
+	metricsChain, err := middleware.Build(cfg.HTTP.Metrics.Middleware, logger.Named("http.metrics"))
+	if err != nil {
+		sugar.Fatalw("Failed to build metrics middleware", "error", err)
+	}
+	adminChain, err := middleware.Build(cfg.HTTP.Admin.Middleware, logger.Named("http.admin"))
+	if err != nil {
+		sugar.Fatalw("Failed to build admin middleware", "error", err)
+	}
+	uiChain, err := middleware.Build(cfg.HTTP.UI.Middleware, logger.Named("http.ui"))
+	if err != nil {
+		sugar.Fatalw("Failed to build web UI middleware", "error", err)
+	}
+	apiChain, err := middleware.Build(cfg.HTTP.API.Middleware, logger.Named("http.api"))
+	if err != nil {
+		sugar.Fatalw("Failed to build API middleware", "error", err)
+	}
+
+	serverTLS, err := middleware.ServerTLS(cfg.HTTP.TLS.CertFile, cfg.HTTP.TLS.KeyFile, cfg.HTTP.TLS.ClientCAFile)
+	if err != nil {
+		sugar.Fatalw("Failed to load HTTP TLS configuration", "error", err)
+	}
 
 	// Start Prometheus Metrics Server
 	metricsAddr := ":8081"
-	metricsSrv := &http.Server{Addr: metricsAddr}
+	metricsSrv := &http.Server{Addr: metricsAddr, TLSConfig: serverTLS}
 
 	go func() {
-		sugar.Infow("Starting Prometheus metrics server", "address", metricsAddr)
-		http.Handle("/metrics", promhttp.Handler())
-		if err := metricsSrv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		sugar.Infow("Starting Prometheus metrics server", "address", metricsAddr, "tls", serverTLS != nil)
+		// OpenMetrics, when scrapers ask for it, carries the exemplars of violation counters
+		metricsHandler := promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer,
+			promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{EnableOpenMetrics: true}))
+		http.Handle("/metrics", middleware.Chain(metricsHandler, metricsChain...))
+		http.Handle("/schemas/", middleware.Chain(schema.Handler("/schemas/"), metricsChain...))
+		serve := metricsSrv.ListenAndServe
+		if serverTLS != nil {
+			serve = func() error { return metricsSrv.ListenAndServeTLS("", "") } // Certificates from TLSConfig
+		}
+		if err := serve(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 			sugar.Errorw("Metrics server failed unexpectedly", "error", err)
 		}
 		sugar.Info("Metrics server stopped.")
@@ -68,12 +299,21 @@ func main() {
 
 	// Initialize Pipeline
 	sugar.Info("Initializing pipeline...")
-	pipe, err := pipeline.New(cfg, logger)
+	pipe, err := pipeline.New(cfg, prometheus.DefaultRegisterer, logger)
 	if err != nil {
 		sugar.Fatalw("Failed to initialize pipeline", "error", err)
 	}
 	sugar.Info("Monitoring pipeline initialized")
 
+	// Admin API shares the metrics server; routes are registered once the pipeline exists
+	http.Handle(admin.Prefix, middleware.Chain(admin.NewAPI(pipe.Controls(), pipe, pipe.RecentWindows(), logLevels, cfg.Kafka, logger.Named("admin")).Handler(), adminChain...))
+	http.Handle(api.Prefix, middleware.Chain(api.NewAPI(pipe.RecentWindows(), logger.Named("api")).Handler(), apiChain...))
+	if results := pipe.Results(); results != nil {
+		ui := webui.NewUI(results, cfg.Pipeline.WindowSize, logger.Named("webui"))
+		http.Handle(webui.Prefix, middleware.Chain(ui.Handler(), uiChain...))
+		sugar.Infow("Web UI enabled", "path", webui.Prefix)
+	}
+
 	// Handle Graceful Shutdown
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -87,9 +327,21 @@ func main() {
 		cancel()
 	}()
 
-	// Run Pipeline
-	sugar.Info("Starting monitoring pipeline...")
-	runErr := pipe.Run(ctx)
+	// Run Pipeline, once elected when replicas compete for leadership
+	var runErr error
+	if cfg.LeaderElection.Enabled {
+		elector, err := leader.NewElector(cfg.LeaderElection, prometheus.DefaultRegisterer, logger.Named("leader"))
+		if err != nil {
+			sugar.Fatalw("Failed to initialize leader election", "error", err)
+		}
+		runErr = elector.Run(ctx, func(ctx context.Context) error {
+			sugar.Info("Starting monitoring pipeline...")
+			return pipe.Run(ctx)
+		})
+	} else {
+		sugar.Info("Starting monitoring pipeline...")
+		runErr = pipe.Run(ctx)
+	}
 
 	// Graceful Shutdown of Metrics Server
 	sugar.Info("Attempting to shut down metrics server gracefully...")
@@ -101,6 +353,11 @@ func main() {
 		sugar.Info("Metrics server shutdown complete.")
 	}
 
+	// Flush pending spans and metrics
+	if err := shutdownTelemetry(shutdownCtx); err != nil {
+		sugar.Warnw("Telemetry shutdown error", "error", err)
+	}
+
 	// Evaluate Pipeline Result
 	finalLogLevel := zapcore.InfoLevel
 	shutdownReason := "gracefully"
@@ -112,6 +369,10 @@ func main() {
 	case errors.Is(runErr, context.Canceled):
 		sugar.Info("Pipeline execution cancelled (expected on shutdown).")
 		shutdownReason = "gracefully via signal"
+	case errors.Is(runErr, pipeline.ErrSecretsRotated): // Exits non-zero for the orchestrator to restart it
+		shutdownReason = "to restart with rotated secrets"
+		finalLogLevel = zapcore.WarnLevel
+		finalErrorField = zap.Error(runErr)
 	default: // Unexpected error
 		shutdownReason = "due to pipeline error"
 		finalLogLevel = zapcore.ErrorLevel
@@ -131,7 +392,7 @@ func main() {
 
 	// Exit with appropriate code if there was an unexpected error from the pipeline
 	if runErr != nil && !errors.Is(runErr, context.Canceled) {
-		os.Exit(1)
+		return exitError
 	}
-	os.Exit(0)
+	return exitClean
 }
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/sanspareilsmyn/featurelens/internal/config"
+	"github.com/sanspareilsmyn/featurelens/internal/promrules"
+)
+
+// runPromRules runs the promrules subcommand, writing the thresholds of the config as
+// Prometheus alerting rules:
+//
+//	featurelens promrules [-config FILE] [-output FILE] [-group featurelens] [-alertname FeatureLensViolation]
+func runPromRules(args []string) int {
+	fs := flag.NewFlagSet("promrules", flag.ContinueOnError)
+	configFile := configFlag(fs)
+	output := fs.String("output", "", "File to write the rules to (default stdout)")
+	group := fs.String("group", "featurelens", "Name of the rule group")
+	alertName := fs.String("alertname", promrules.DefaultAlertName, "alertname of the rules")
+	if err := fs.Parse(args); err != nil {
+		return exitError
+	}
+
+	cfg, err := config.Load(*configFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "promrules: failed to load configuration from %s: %v\n", *configFile, err)
+		return exitError
+	}
+
+	var out io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "promrules: failed to create rules output: %v\n", err)
+			return exitError
+		}
+		defer f.Close()
+		out = f
+	}
+	if err := promrules.Write(out, cfg, promrules.Options{Group: *group, AlertName: *alertName}); err != nil {
+		fmt.Fprintf(os.Stderr, "promrules: failed to write rules: %v\n", err)
+		return exitError
+	}
+	return exitClean
+}
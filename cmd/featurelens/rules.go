@@ -0,0 +1,69 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/sanspareilsmyn/featurelens/internal/rules"
+)
+
+// runRules runs the rules subcommands and returns the process exit code:
+//
+//	featurelens rules import -from suite.json [-format auto|jsonschema|expectations] [-output FILE]
+func runRules(args []string) int {
+	if len(args) == 0 || args[0] != "import" {
+		fmt.Fprintln(os.Stderr, "rules: expected a subcommand (import)")
+		return exitError
+	}
+
+	fs := flag.NewFlagSet("rules import", flag.ContinueOnError)
+	from := fs.String("from", "", "JSON Schema or Great Expectations suite (JSON) to translate (required)")
+	format := fs.String("format", rules.FormatAuto, "Format of -from: auto, jsonschema or expectations")
+	output := fs.String("output", "", "File to write the features config to (default stdout)")
+	if err := fs.Parse(args[1:]); err != nil {
+		return exitError
+	}
+	if *from == "" {
+		fmt.Fprintln(os.Stderr, "rules: -from is required")
+		return exitError
+	}
+
+	if err := runRulesImport(*from, *format, *output); err != nil {
+		fmt.Fprintf(os.Stderr, "rules: %v\n", err)
+		return exitError
+	}
+	return exitClean
+}
+
+// runRulesImport translates a rules file and writes the generated features config.
+func runRulesImport(from, format, output string) error {
+	defs, err := rules.Load(from, format)
+	if err != nil {
+		return err
+	}
+
+	var out io.Writer = os.Stdout
+	if output != "" {
+		f, err := os.Create(output)
+		if err != nil {
+			return fmt.Errorf("failed to create rules output: %w", err)
+		}
+		defer f.Close()
+		out = f
+	}
+	if err := rules.WriteConfig(out, defs, from); err != nil {
+		return fmt.Errorf("failed to write rules output: %w", err)
+	}
+
+	var skipped, notes int
+	for _, d := range defs {
+		if d.Skipped != "" {
+			skipped++
+		}
+		notes += len(d.Notes)
+	}
+	fmt.Fprintf(os.Stderr, "rules: %d features translated, %d skipped, %d rules not translated exactly\n", len(defs)-skipped, skipped, notes)
+	return nil
+}
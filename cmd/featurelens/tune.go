@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/sanspareilsmyn/featurelens/internal/config"
+	"github.com/sanspareilsmyn/featurelens/internal/discovery"
+	"github.com/sanspareilsmyn/featurelens/internal/pipeline"
+)
+
+// runTune runs the tune subcommand:
+//
+//	featurelens tune -config FILE -learn 24h [-output FILE] [-quantile 0.99] [-margin 0.1] [-min-windows 10]
+func runTune(args []string) int {
+	fs := flag.NewFlagSet("tune", flag.ContinueOnError)
+	configFile := configFlag(fs)
+	learn := fs.Duration("learn", 0, "Observe the stream for this long, e.g. 24h (required)")
+	output := fs.String("output", "thresholds.patch.yaml", "File to write the suggested thresholds to, as a config overlay")
+	quantile := fs.Float64("quantile", 0.99, "Upper quantile of each window statistic the bounds are fitted to")
+	margin := fs.Float64("margin", 0.1, "Fraction of the quantiles' range the bounds are widened by")
+	minWindows := fs.Int("min-windows", 10, "Windows a feature must be observed in to be tuned")
+	if err := fs.Parse(args); err != nil {
+		return exitError
+	}
+	switch {
+	case *learn <= 0:
+		fmt.Fprintln(os.Stderr, "tune: -learn must be positive")
+		return exitError
+	case *quantile <= 0.5 || *quantile > 1:
+		fmt.Fprintf(os.Stderr, "tune: -quantile must be in (0.5, 1], got %g\n", *quantile)
+		return exitError
+	case *margin < 0:
+		fmt.Fprintf(os.Stderr, "tune: -margin must not be negative, got %g\n", *margin)
+		return exitError
+	case *minWindows <= 0:
+		fmt.Fprintf(os.Stderr, "tune: -min-windows must be positive, got %d\n", *minWindows)
+		return exitError
+	}
+
+	cfg, code := setup(*configFile)
+	if cfg == nil {
+		return code
+	}
+	defer func() {
+		_ = logger.Sync()
+	}()
+	opts := discovery.TuneOptions{Quantile: *quantile, Margin: *margin, MinWindows: *minWindows, Period: *learn}
+	if err := runTuning(cfg, opts, *output); err != nil {
+		logger.Sugar().Errorw("Threshold tuning failed", "error", err)
+		return exitError
+	}
+	return exitClean
+}
+
+// runTuning learns the configured features' windows and writes the thresholds fitted to
+// them to output. Pattern groups and features of feature groups have no entry of their
+// own to patch and are left out.
+func runTuning(cfg *config.Config, opts discovery.TuneOptions, output string) error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	startedAt := time.Now()
+	learner, err := pipeline.LearnThresholds(ctx, cfg, opts.Period, logger)
+	if err != nil {
+		return err
+	}
+	if learned := time.Since(startedAt).Truncate(time.Second); learned < opts.Period {
+		logger.Sugar().Warnw("Learning interrupted, fitting the windows observed so far", "learned", learned)
+		opts.Period = learned
+	}
+
+	// The patch is merged by name, so entries of tenants sharing a name cannot be told apart
+	names := make(map[string]int)
+	for _, f := range cfg.Features {
+		names[strings.TrimPrefix(f.Name, f.Tenant+".")]++
+	}
+	var tuned []discovery.Tuned
+	configured := make(map[string]config.FeatureConfig)
+	for _, f := range cfg.Features {
+		if f.Pattern != "" || f.Group != "" {
+			continue
+		}
+		name := strings.TrimPrefix(f.Name, f.Tenant+".")
+		t := discovery.Tune(name, f.Tenant, learner.Samples(f.Name), opts)
+		if names[name] > 1 {
+			t.Skipped = "name shared by several tenants' features"
+		}
+		tuned = append(tuned, t)
+		configured[name] = f
+	}
+	current := func(t discovery.Tuned, key string) *float64 {
+		return configured[t.Name].Thresholds.Bound(key)
+	}
+
+	var buf bytes.Buffer
+	if err := discovery.WritePatch(&buf, tuned, opts, current); err != nil {
+		return fmt.Errorf("failed to write tuned thresholds: %w", err)
+	}
+	tmp := output + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("failed to write tuned thresholds: %w", err)
+	}
+	if err := os.Rename(tmp, output); err != nil {
+		return fmt.Errorf("failed to write tuned thresholds: %w", err)
+	}
+	skipped := 0
+	for _, t := range tuned {
+		if t.Skipped != "" {
+			skipped++
+		}
+	}
+	logger.Sugar().Infow("Suggested thresholds written",
+		"features", len(tuned)-skipped,
+		"skipped", skipped,
+		"output", output,
+	)
+	return nil
+}
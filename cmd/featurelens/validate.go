@@ -0,0 +1,153 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"go.uber.org/zap"
+
+	"github.com/sanspareilsmyn/featurelens/internal/config"
+	"github.com/sanspareilsmyn/featurelens/internal/sink"
+)
+
+// runValidate runs the validate subcommand, printing every problem found in the
+// configuration and exiting non-zero if any is an error:
+//
+//	featurelens validate -config FILE [-probe] [-probe-timeout 10s]
+func runValidate(args []string) int {
+	fs := flag.NewFlagSet("validate", flag.ContinueOnError)
+	configFile := configFlag(fs)
+	probe := fs.Bool("probe", false, "Also check that the Kafka brokers, topics and sink destinations are reachable")
+	probeTimeout := fs.Duration("probe-timeout", 10*time.Second, "Timeout of each reachability check")
+	if err := fs.Parse(args); err != nil {
+		return exitError
+	}
+
+	cfg, diagnostics := config.Diagnose(*configFile)
+	errs, warnings := printDiagnostics(os.Stdout, *configFile, diagnostics)
+	if cfg != nil && *probe {
+		errs += probeConfig(os.Stdout, cfg, *probeTimeout)
+	}
+
+	if errs > 0 {
+		fmt.Printf("%s: %d error(s), %d warning(s)\n", *configFile, errs, warnings)
+		return exitError
+	}
+	fmt.Printf("%s: OK (%d features, %d sinks, %d warning(s))\n", *configFile, len(cfg.Features), len(cfg.Sinks.Outputs), warnings)
+	return exitClean
+}
+
+// printDiagnostics prints one line per diagnostic, e.g.
+//
+//	config.yaml:42: error: features.price.thresholds.meanMin: incoherent feature thresholds: ...
+func printDiagnostics(w io.Writer, file string, diagnostics []config.Diagnostic) (errs, warnings int) {
+	for _, d := range diagnostics {
+		location := cmp.Or(d.File, file)
+		if d.Line > 0 {
+			location = fmt.Sprintf("%s:%d", location, d.Line)
+		}
+		if d.Key != "" {
+			fmt.Fprintf(w, "%s: %s: %s: %s\n", location, d.Severity, d.Key, d.Message)
+		} else {
+			fmt.Fprintf(w, "%s: %s: %s\n", location, d.Severity, d.Message)
+		}
+		if d.Severity == config.SeverityError {
+			errs++
+		} else {
+			warnings++
+		}
+	}
+	return errs, warnings
+}
+
+// probeConfig checks the configured Kafka topics and sinks are reachable, printing one
+// line per check, and returns the number of failed checks.
+func probeConfig(w io.Writer, cfg *config.Config, timeout time.Duration) int {
+	failed := 0
+	report := func(target string, err error) {
+		if err != nil {
+			failed++
+			fmt.Fprintf(w, "probe: %s: error: %v\n", target, err)
+			return
+		}
+		fmt.Fprintf(w, "probe: %s: OK\n", target)
+	}
+
+	var topics []string
+	if cfg.Kafka.TopicPattern != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		report(fmt.Sprintf("kafka topic pattern %q", cfg.Kafka.TopicPattern), probeTopicPattern(ctx, cfg.Kafka.Brokers, cfg.Kafka.TopicPattern))
+		cancel()
+	} else {
+		topics = append(topics, cfg.Kafka.Topic)
+	}
+	if cfg.Skew.Enabled && cfg.Skew.ReferenceTopic != "" {
+		topics = append(topics, cfg.Skew.ReferenceTopic)
+	}
+	for _, topic := range topics {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		report(fmt.Sprintf("kafka topic %q", topic), probeTopic(ctx, cfg.Kafka.Brokers, topic))
+		cancel()
+	}
+
+	for i, out := range cfg.Sinks.Outputs {
+		name := out.Name
+		if name == "" {
+			name = out.Type
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		// Sinks log their configuration when built; only the probe outcome matters here
+		report(fmt.Sprintf("sink %q (%s)", name, out.Type), sink.Probe(ctx, cfg.Sinks.Outputs[i:i+1], zap.NewNop())[0])
+		cancel()
+	}
+	return failed
+}
+
+// probeTopic connects to the first reachable broker and checks the topic exists.
+func probeTopic(ctx context.Context, brokers []string, topic string) error {
+	_, err := readPartitions(ctx, brokers, topic)
+	return err
+}
+
+// probeTopicPattern connects to the first reachable broker and checks a topic matches
+// the pattern.
+func probeTopicPattern(ctx context.Context, brokers []string, pattern string) error {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return err
+	}
+	partitions, err := readPartitions(ctx, brokers) // Every topic
+	if err != nil {
+		return err
+	}
+	for _, p := range partitions {
+		if re.MatchString(p.Topic) {
+			return nil
+		}
+	}
+	return fmt.Errorf("no topic matches %q", pattern)
+}
+
+// readPartitions reads the partitions of the topics, or of every topic when none are
+// given, from the first reachable broker.
+func readPartitions(ctx context.Context, brokers []string, topics ...string) ([]kafka.Partition, error) {
+	var errs []error
+	for _, broker := range brokers {
+		conn, err := kafka.DialContext(ctx, "tcp", broker)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		defer conn.Close()
+		return conn.ReadPartitions(topics...)
+	}
+	return nil, errors.Join(errs...)
+}
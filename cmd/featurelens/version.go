@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/sanspareilsmyn/featurelens/internal/version"
+)
+
+// runVersion runs the version subcommand, printing the build metadata of the binary:
+//
+//	featurelens version [-json]
+func runVersion(args []string) int {
+	fs := flag.NewFlagSet("version", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "Print the build metadata as JSON")
+	if err := fs.Parse(args); err != nil {
+		return exitError
+	}
+
+	info := version.Get()
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(info); err != nil {
+			fmt.Fprintf(os.Stderr, "version: %v\n", err)
+			return exitError
+		}
+		return exitClean
+	}
+	fmt.Printf("featurelens %s\n", info.Version)
+	if info.Commit != "" {
+		dirty := ""
+		if info.Modified {
+			dirty = " (modified)"
+		}
+		fmt.Printf("  commit:   %s%s\n", info.Commit, dirty)
+	}
+	if info.Date != "" {
+		fmt.Printf("  built:    %s\n", info.Date)
+	}
+	fmt.Printf("  go:       %s\n", info.GoVersion)
+	fmt.Printf("  platform: %s\n", info.Platform)
+	fmt.Printf("  cgo:      %t\n", info.CGO)
+	return exitClean
+}
@@ -1,13 +1,16 @@
 package main
 
 import (
+	"bufio"
 	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"log"
 	"math/rand"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
@@ -15,24 +18,75 @@ import (
 )
 
 const (
-	kafkaBroker = "localhost:9092"
-	topic       = "feature-stream"
+	defaultBroker = "localhost:9092"
+	defaultTopic  = "feature-stream"
 )
 
 // Example Feature Message Structure (matches what FeatureLens expects)
 type FeatureMessage struct {
-	Timestamp   time.Time `json:"timestamp"`
-	UserID      string    `json:"user_id"`
-	FeatureA    *float64  `json:"feature_a"`
-	FeatureB    *float64  `json:"feature_b"`
-	FeatureC    *string   `json:"feature_c"`
-	ProcessTime int       `json:"process_time_ms"`
+	Timestamp   time.Time  `json:"timestamp"`
+	UserID      string     `json:"user_id"`
+	FeatureA    *float64   `json:"feature_a"`
+	FeatureB    *float64   `json:"feature_b"`
+	FeatureC    *string    `json:"feature_c"`
+	ProcessTime int        `json:"process_time_ms"`
+	Embedding   []*float64 `json:"embedding"`
 }
 
+// generator returns the message produced elapsed after the start, at time now.
+type generator func(rng *rand.Rand, elapsed time.Duration, now time.Time) interface{}
+
+// Produces sample messages to Kafka, or to a file for `featurelens replay`. Without
+// -scenario, one sample message per second is produced until interrupted:
+//
+//	producer [-brokers localhost:9092] [-topic feature-stream] [-scenario FILE] [-rate N] [-duration 20m] [-output FILE]
 func main() {
+	brokers := flag.String("brokers", defaultBroker, "Comma-separated Kafka brokers")
+	topicName := flag.String("topic", defaultTopic, "Topic to produce to")
+	scenarioFile := flag.String("scenario", "", "YAML scenario of fields, rate and drift injections")
+	rate := flag.Float64("rate", 0, "Messages per second, overriding the scenario's")
+	duration := flag.Duration("duration", 0, "Stop after this long, overriding the scenario's; 0 to run until interrupted")
+	output := flag.String("output", "", "Write messages as JSON lines to this file instead of Kafka, with simulated timestamps and no pacing (requires a duration)")
+	flag.Parse()
+
+	generate := generator(func(rng *rand.Rand, _ time.Duration, now time.Time) interface{} {
+		return generateSampleMessage(rng, now)
+	})
+	scenario := &Scenario{Rate: 1}
+	if *scenarioFile != "" {
+		var err error
+		if scenario, err = loadScenario(*scenarioFile); err != nil {
+			log.Fatalf("Error loading scenario: %v", err)
+		}
+		generate = func(rng *rand.Rand, elapsed time.Duration, now time.Time) interface{} {
+			return scenario.message(rng, elapsed, now)
+		}
+	}
+	if *rate > 0 {
+		scenario.Rate = *rate
+	}
+	if *duration > 0 {
+		scenario.Duration = *duration
+	}
+
+	// Handle graceful shutdown
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	if *output != "" {
+		if scenario.Duration <= 0 {
+			log.Fatal("-output needs a duration, from the scenario or -duration")
+		}
+		if err := writeFile(*output, scenario, generate, rng); err != nil {
+			log.Fatalf("Error writing messages: %v", err)
+		}
+		return
+	}
+
 	writer := &kafka.Writer{
-		Addr:     kafka.TCP(kafkaBroker),
-		Topic:    topic,
+		Addr:     kafka.TCP(strings.Split(*brokers, ",")...),
+		Topic:    *topicName,
 		Balancer: &kafka.LeastBytes{},
 	}
 	defer func() {
@@ -40,56 +94,89 @@ func main() {
 			log.Fatalf("Error closing kafka writer: %v", err)
 		}
 	}()
-	log.Printf("Starting sample producer for topic: %s on broker: %s", topic, kafkaBroker)
-
-	// Handle graceful shutdown
-	ctx, cancel := context.WithCancel(context.Background())
-	signals := make(chan os.Signal, 1)
-	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
-
-	go func() {
-		<-signals
-		log.Println("Shutdown signal received, stopping producer...")
-		cancel()
-	}()
+	log.Printf("Starting producer for topic %s on brokers %s at %v messages/s", *topicName, *brokers, scenario.Rate)
+	produce(ctx, writer, scenario, generate, rng)
+}
 
-	// Produce messages periodically
-	ticker := time.NewTicker(1 * time.Second) // Produce message every second
+// produce writes messages to Kafka at the scenario's rate until its duration has passed
+// or ctx is done.
+func produce(ctx context.Context, writer *kafka.Writer, scenario *Scenario, generate generator, rng *rand.Rand) {
+	if scenario.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, scenario.Duration)
+		defer cancel()
+	}
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / scenario.Rate))
 	defer ticker.Stop()
+	progress := time.NewTicker(10 * time.Second)
+	defer progress.Stop()
 
-	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
-
+	start := time.Now()
+	active := scenario.activeDrifts(0)
+	var produced, failed int64
 	for {
 		select {
-		case <-ticker.C:
-			msg := generateSampleMessage(rng)
-			msgBytes, err := json.Marshal(msg)
+		case now := <-ticker.C:
+			elapsed := now.Sub(start)
+			if current := scenario.activeDrifts(elapsed); current != active {
+				log.Printf("Drifts active at %s: %s", elapsed.Truncate(time.Second), current)
+				active = current
+			}
+			msgBytes, err := json.Marshal(generate(rng, elapsed, now))
 			if err != nil {
 				log.Printf("Error marshalling message: %v", err)
 				continue
 			}
-
-			err = writer.WriteMessages(ctx, kafka.Message{Value: msgBytes})
-			if err != nil {
+			if err := writer.WriteMessages(ctx, kafka.Message{Value: msgBytes}); err != nil {
 				if ctx.Err() != nil { // Check if context was cancelled (shutdown)
 					log.Println("Context cancelled, exiting message loop.")
 					return
 				}
+				failed++
 				log.Printf("Error writing message: %v", err)
-			} else {
-				log.Printf("Produced message: %s", string(msgBytes))
+				continue
 			}
+			produced++
+
+		case <-progress.C:
+			log.Printf("Produced %d messages (%d failed)", produced, failed)
 
 		case <-ctx.Done():
-			log.Println("Producer loop stopped.")
+			log.Printf("Producer loop stopped after %d messages.", produced)
 			return
 		}
 	}
 }
 
+// writeFile writes the messages of the scenario's duration as JSON lines, timestamped
+// as if produced at its rate from now on.
+func writeFile(path string, scenario *Scenario, generate generator, rng *rand.Rand) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+
+	start := time.Now()
+	interval := time.Duration(float64(time.Second) / scenario.Rate)
+	n := int64(0)
+	for elapsed := time.Duration(0); elapsed < scenario.Duration; elapsed += interval {
+		if err := enc.Encode(generate(rng, elapsed, start.Add(elapsed))); err != nil {
+			return err
+		}
+		n++
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	log.Printf("Wrote %d messages covering %s to %s", n, scenario.Duration, path)
+	return nil
+}
+
 // Generates a sample message with some randomness and potential nulls/outliers
-func generateSampleMessage(rng *rand.Rand) FeatureMessage {
-	now := time.Now()
+func generateSampleMessage(rng *rand.Rand, now time.Time) FeatureMessage {
 	userID := fmt.Sprintf("user_%d", rng.Intn(1000))
 
 	var featureA *float64
@@ -120,6 +207,20 @@ func generateSampleMessage(rng *rand.Rand) FeatureMessage {
 
 	processTime := 10 + rng.Intn(40) // 10-49 ms
 
+	// 8-dimensional vector around a fixed direction; ~1% are truncated and ~1% carry a
+	// null element, the way NaN is encoded in JSON
+	embedding := make([]*float64, 8)
+	for i := range embedding {
+		val := float64(i%3) + rng.NormFloat64()*0.3
+		embedding[i] = &val
+	}
+	switch r := rng.Float64(); {
+	case r < 0.01:
+		embedding = embedding[:7]
+	case r < 0.02:
+		embedding[rng.Intn(len(embedding))] = nil
+	}
+
 	return FeatureMessage{
 		Timestamp:   now,
 		UserID:      userID,
@@ -127,5 +228,6 @@ func generateSampleMessage(rng *rand.Rand) FeatureMessage {
 		FeatureB:    featureB,
 		FeatureC:    featureC,
 		ProcessTime: processTime,
+		Embedding:   embedding,
 	}
 }
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Field generator types.
+const (
+	fieldNormal      = "normal"      // Gaussian around mean with stddev
+	fieldUniform     = "uniform"     // Uniform in [min, max)
+	fieldCategorical = "categorical" // One of values, by weights when given
+	fieldConstant    = "constant"    // Always value
+	fieldID          = "id"          // prefix followed by one of cardinality numbers
+	fieldTimestamp   = "timestamp"   // The message's time, RFC 3339
+)
+
+var errInvalidScenario = errors.New("invalid scenario")
+
+// Scenario describes the messages to produce: their rate, fields and the drifts injected
+// into the fields at set times.
+type Scenario struct {
+	Rate     float64       `yaml:"rate"`     // Messages per second
+	Duration time.Duration `yaml:"duration"` // 0 to produce until interrupted
+	Fields   []Field       `yaml:"fields"`
+	Drifts   []Drift       `yaml:"drifts"`
+}
+
+// Field generates the values of one message field.
+type Field struct {
+	Name        string        `yaml:"name"`
+	Type        string        `yaml:"type"`
+	NullRate    float64       `yaml:"nullRate"`    // Share of messages with an explicit null
+	MissingRate float64       `yaml:"missingRate"` // Share of messages without the field
+	Mean        float64       `yaml:"mean"`
+	StdDev      float64       `yaml:"stddev"`
+	Min         float64       `yaml:"min"`
+	Max         float64       `yaml:"max"`
+	Values      []interface{} `yaml:"values"`
+	Weights     []float64     `yaml:"weights"`
+	Value       interface{}   `yaml:"value"`
+	Prefix      string        `yaml:"prefix"`
+	Cardinality int           `yaml:"cardinality"`
+}
+
+// Drift overrides a field's settings from At after the start, for For or until the end
+// when For is 0. Settings left unset keep the field's.
+type Drift struct {
+	Field       string        `yaml:"field"`
+	At          time.Duration `yaml:"at"`
+	For         time.Duration `yaml:"for"`
+	NullRate    *float64      `yaml:"nullRate"`
+	MissingRate *float64      `yaml:"missingRate"`
+	Mean        *float64      `yaml:"mean"`
+	MeanShift   *float64      `yaml:"meanShift"` // Added to the mean
+	StdDev      *float64      `yaml:"stddev"`
+	Min         *float64      `yaml:"min"`
+	Max         *float64      `yaml:"max"`
+	Values      []interface{} `yaml:"values"`
+	Weights     []float64     `yaml:"weights"`
+	Value       interface{}   `yaml:"value"`
+}
+
+// loadScenario reads a YAML scenario file.
+func loadScenario(path string) (*Scenario, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var s Scenario
+	if err := yaml.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", errInvalidScenario, path, err)
+	}
+	return &s, s.validate()
+}
+
+func (s *Scenario) validate() error {
+	if s.Rate <= 0 {
+		return fmt.Errorf("%w: rate must be positive, got %v", errInvalidScenario, s.Rate)
+	}
+	if len(s.Fields) == 0 {
+		return fmt.Errorf("%w: no fields", errInvalidScenario)
+	}
+	fields := make(map[string]Field, len(s.Fields))
+	for _, f := range s.Fields {
+		if f.Name == "" {
+			return fmt.Errorf("%w: field without a name", errInvalidScenario)
+		}
+		fields[f.Name] = f
+		switch f.Type {
+		case fieldNormal, fieldUniform, fieldConstant, fieldTimestamp:
+		case fieldCategorical:
+			if len(f.Values) == 0 || (len(f.Weights) > 0 && len(f.Weights) != len(f.Values)) {
+				return fmt.Errorf("%w: field %q needs values, and one weight per value when weighted", errInvalidScenario, f.Name)
+			}
+		case fieldID:
+			if f.Cardinality <= 0 {
+				return fmt.Errorf("%w: field %q needs a positive cardinality", errInvalidScenario, f.Name)
+			}
+		default:
+			return fmt.Errorf("%w: field %q type %q", errInvalidScenario, f.Name, f.Type)
+		}
+	}
+	for _, d := range s.Drifts {
+		f, ok := fields[d.Field]
+		if !ok {
+			return fmt.Errorf("%w: drift at %s of unknown field %q", errInvalidScenario, d.At, d.Field)
+		}
+		values := f.Values
+		if d.Values != nil {
+			values = d.Values
+		}
+		if len(d.Weights) > 0 && len(d.Weights) != len(values) {
+			return fmt.Errorf("%w: drift of %q at %s needs one weight per value", errInvalidScenario, d.Field, d.At)
+		}
+		if d.At < 0 || d.For < 0 {
+			return fmt.Errorf("%w: drift of %q at %s for %s cannot be negative", errInvalidScenario, d.Field, d.At, d.For)
+		}
+	}
+	return nil
+}
+
+// message generates the message produced elapsed after the start, at time now.
+func (s *Scenario) message(rng *rand.Rand, elapsed time.Duration, now time.Time) map[string]interface{} {
+	msg := make(map[string]interface{}, len(s.Fields))
+	for _, f := range s.Fields {
+		f = s.drifted(f, elapsed)
+		r := rng.Float64()
+		switch {
+		case r < f.MissingRate:
+			continue
+		case r < f.MissingRate+f.NullRate:
+			msg[f.Name] = nil
+			continue
+		}
+		msg[f.Name] = f.generate(rng, now)
+	}
+	return msg
+}
+
+// drifted returns the field with the drifts active elapsed after the start applied, in order.
+func (s *Scenario) drifted(f Field, elapsed time.Duration) Field {
+	for _, d := range s.Drifts {
+		if d.Field != f.Name || elapsed < d.At || (d.For > 0 && elapsed >= d.At+d.For) {
+			continue
+		}
+		set(&f.NullRate, d.NullRate)
+		set(&f.MissingRate, d.MissingRate)
+		set(&f.Mean, d.Mean)
+		if d.MeanShift != nil {
+			f.Mean += *d.MeanShift
+		}
+		set(&f.StdDev, d.StdDev)
+		set(&f.Min, d.Min)
+		set(&f.Max, d.Max)
+		if d.Values != nil {
+			f.Values, f.Weights = d.Values, d.Weights
+		} else if d.Weights != nil {
+			f.Weights = d.Weights
+		}
+		if d.Value != nil {
+			f.Value = d.Value
+		}
+	}
+	return f
+}
+
+// activeDrifts describes the drifts active elapsed after the start, e.g.
+// "feature_a@5m0s, feature_c@10m0s", or "none".
+func (s *Scenario) activeDrifts(elapsed time.Duration) string {
+	var active []string
+	for _, d := range s.Drifts {
+		if elapsed >= d.At && (d.For == 0 || elapsed < d.At+d.For) {
+			active = append(active, fmt.Sprintf("%s@%s", d.Field, d.At))
+		}
+	}
+	if len(active) == 0 {
+		return "none"
+	}
+	return strings.Join(active, ", ")
+}
+
+func set(dst *float64, v *float64) {
+	if v != nil {
+		*dst = *v
+	}
+}
+
+// generate returns a non-null value of the field.
+func (f Field) generate(rng *rand.Rand, now time.Time) interface{} {
+	switch f.Type {
+	case fieldNormal:
+		return f.Mean + rng.NormFloat64()*f.StdDev
+	case fieldUniform:
+		return f.Min + rng.Float64()*(f.Max-f.Min)
+	case fieldCategorical:
+		return f.Values[weightedIndex(rng, f.Weights, len(f.Values))]
+	case fieldID:
+		return fmt.Sprintf("%s%d", f.Prefix, rng.Intn(f.Cardinality))
+	case fieldTimestamp:
+		return now.UTC().Format(time.RFC3339Nano)
+	default:
+		return f.Value
+	}
+}
+
+// weightedIndex picks an index below n by weights, uniformly without them.
+func weightedIndex(rng *rand.Rand, weights []float64, n int) int {
+	if len(weights) != n {
+		return rng.Intn(n)
+	}
+	total := 0.0
+	for _, w := range weights {
+		total += w
+	}
+	r := rng.Float64() * total
+	for i, w := range weights {
+		if r < w {
+			return i
+		}
+		r -= w
+	}
+	return n - 1
+}
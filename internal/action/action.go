@@ -0,0 +1,102 @@
+// Package action runs remediation in response to violations, e.g. flipping a feature flag
+// off through a webhook, publishing a retraining request or executing a local script.
+// Action types are pluggable: built-in types are registered here and deployments
+// register their own with Register.
+package action
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"go.uber.org/zap"
+
+	"github.com/sanspareilsmyn/featurelens/internal/config"
+	"github.com/sanspareilsmyn/featurelens/internal/params"
+	"github.com/sanspareilsmyn/featurelens/internal/schema"
+)
+
+// Action remediates a violation. Run is never called concurrently for one action.
+type Action interface {
+	Run(ctx context.Context, v schema.Violation) error
+	Close() error
+}
+
+// Factory builds an action from its configuration parameters.
+type Factory func(params params.Params, logger *zap.Logger) (Action, error)
+
+// Built-in action types.
+const (
+	TypeWebhook = "webhook"
+	TypeKafka   = "kafka"
+	TypeExec    = "exec"
+)
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Factory{
+		TypeWebhook: newWebhook,
+		TypeKafka:   newKafka,
+		TypeExec:    newExec,
+	}
+)
+
+// Register makes an action type available to configuration. It is typically called from
+// an init function; registering an existing name replaces it.
+func Register(name string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[name] = factory
+}
+
+// Types returns the registered action type names.
+func Types() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Trigger is a configured action with the violations it runs for.
+type Trigger struct {
+	Name   string
+	Action Action
+	Config config.ActionConfig
+}
+
+// Build instantiates the configured actions. On error, actions already built are closed.
+func Build(cfgs []config.ActionConfig, logger *zap.Logger) ([]Trigger, error) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	triggers := make([]Trigger, 0, len(cfgs))
+	for _, cfg := range cfgs {
+		name := cfg.Name
+		if name == "" {
+			name = cfg.Type
+		}
+		factory, ok := registry[cfg.Type]
+		if !ok {
+			closeAll(triggers)
+			return nil, fmt.Errorf("%w: %q", ErrUnknownType, cfg.Type)
+		}
+		a, err := factory(params.Params(cfg.Params), logger.Named(name))
+		if err != nil {
+			closeAll(triggers)
+			return nil, fmt.Errorf("%w: action %q (%s): %w", ErrInvalidParams, name, cfg.Type, err)
+		}
+		triggers = append(triggers, Trigger{Name: name, Action: a, Config: cfg})
+	}
+	return triggers, nil
+}
+
+func closeAll(triggers []Trigger) {
+	for _, t := range triggers {
+		_ = t.Action.Close()
+	}
+}
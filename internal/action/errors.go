@@ -0,0 +1,9 @@
+package action
+
+import "errors"
+
+var (
+	ErrUnknownType   = errors.New("unknown action type")
+	ErrInvalidParams = errors.New("invalid action parameters")
+	ErrRunFailed     = errors.New("action failed")
+)
@@ -0,0 +1,108 @@
+package action
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/sanspareilsmyn/featurelens/internal/params"
+	"github.com/sanspareilsmyn/featurelens/internal/schema"
+)
+
+// execOutputLimit caps the output of a failed command quoted in its error.
+const execOutputLimit = 512
+
+// execAction runs a local command for each violation, e.g. a script rolling a model back.
+// The violation is passed as FEATURELENS_* environment variables and as JSON on stdin;
+// the command fails the run by exiting with a non-zero status.
+type execAction struct {
+	command []string
+	dir     string
+	env     []string
+	logger  *zap.Logger
+}
+
+// newExec creates an exec action.
+//
+// Params: command (required; the program and its arguments, not run through a shell),
+// dir (working directory; default the current one), env (extra environment variables).
+//
+// The command inherits the environment along with FEATURELENS_FEATURE,
+// FEATURELENS_MODEL_VERSION, FEATURELENS_TENANT, FEATURELENS_CHECK,
+// FEATURELENS_COMPARISON, FEATURELENS_ACTUAL, FEATURELENS_THRESHOLD,
+// FEATURELENS_SEVERITY, FEATURELENS_WINDOW_START, FEATURELENS_WINDOW_END,
+// FEATURELENS_EVENT_ID and FEATURELENS_VIOLATION (the violation as JSON).
+func newExec(params params.Params, logger *zap.Logger) (Action, error) {
+	command, err := params.Strings("command")
+	if err != nil {
+		return nil, err
+	}
+	if len(command) == 0 || command[0] == "" {
+		return nil, fmt.Errorf("%w: command cannot be empty", ErrInvalidParams)
+	}
+	if _, err := exec.LookPath(command[0]); err != nil {
+		return nil, fmt.Errorf("%w: command: %w", ErrInvalidParams, err)
+	}
+	dir, err := params.String("dir", "")
+	if err != nil {
+		return nil, err
+	}
+	vars, err := params.StringMap("env")
+	if err != nil {
+		return nil, err
+	}
+	env := make([]string, 0, len(vars))
+	for name, value := range vars {
+		env = append(env, name+"="+value)
+	}
+
+	logger.Info("Exec action configured", zap.Strings("command", command), zap.String("dir", dir))
+	return &execAction{command: command, dir: dir, env: env, logger: logger}, nil
+}
+
+func (a *execAction) Run(ctx context.Context, v schema.Violation) error {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrRunFailed, err)
+	}
+	cmd := exec.CommandContext(ctx, a.command[0], a.command[1:]...)
+	cmd.Dir = a.dir
+	cmd.Env = append(append(os.Environ(), a.env...),
+		"FEATURELENS_FEATURE="+v.FeatureName,
+		"FEATURELENS_MODEL_VERSION="+v.ModelVersion,
+		"FEATURELENS_TENANT="+v.Tenant,
+		"FEATURELENS_CHECK="+v.CheckType,
+		"FEATURELENS_COMPARISON="+v.Comparison,
+		"FEATURELENS_ACTUAL="+strconv.FormatFloat(v.Actual, 'g', -1, 64),
+		"FEATURELENS_THRESHOLD="+strconv.FormatFloat(v.Threshold, 'g', -1, 64),
+		"FEATURELENS_SEVERITY="+v.Severity,
+		"FEATURELENS_WINDOW_START="+v.WindowStart.Format(time.RFC3339),
+		"FEATURELENS_WINDOW_END="+v.WindowEnd.Format(time.RFC3339),
+		"FEATURELENS_EVENT_ID="+v.EventID,
+		"FEATURELENS_VIOLATION="+string(payload),
+	)
+	cmd.Stdin = bytes.NewReader(payload)
+	var output bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &output, &output
+
+	if err := cmd.Run(); err != nil {
+		out := bytes.TrimSpace(output.Bytes())
+		if len(out) > execOutputLimit {
+			out = out[len(out)-execOutputLimit:]
+		}
+		return fmt.Errorf("%w: %w: %s", ErrRunFailed, err, out)
+	}
+	a.logger.Debug("Exec action output", zap.ByteString("output", bytes.TrimSpace(output.Bytes())))
+	return nil
+}
+
+func (a *execAction) Close() error {
+	return nil
+}
@@ -0,0 +1,113 @@
+package action
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/segmentio/kafka-go"
+	"go.uber.org/zap"
+
+	"github.com/sanspareilsmyn/featurelens/internal/params"
+	"github.com/sanspareilsmyn/featurelens/internal/schema"
+)
+
+// retrainingKind is the kind header of the requests kafkaAction publishes.
+const retrainingKind = "retraining_request"
+
+// kafkaAction publishes a request for each violation to a Kafka topic, e.g. one a
+// retraining scheduler consumes. Requests are keyed by feature name and carry the
+// violation as JSON, with the kind, the violation's event ID and its schema version as
+// headers.
+type kafkaAction struct {
+	writer *kafka.Writer
+	kind   string
+}
+
+// retrainingRequest is the message published by kafkaAction.
+type retrainingRequest struct {
+	Kind      string           `json:"kind"`
+	Reason    string           `json:"reason"` // e.g. "feature_a: mean 15.2 > 13"
+	Violation schema.Violation `json:"violation"`
+}
+
+// newKafka creates a Kafka action.
+//
+// Params: brokers (required), topic (required), kind (message kind, default
+// retraining_request), requiredAcks (none, one or all; default all).
+func newKafka(params params.Params, logger *zap.Logger) (Action, error) {
+	brokers, err := params.Strings("brokers")
+	if err != nil {
+		return nil, err
+	}
+	if len(brokers) == 0 {
+		return nil, fmt.Errorf("%w: brokers cannot be empty", ErrInvalidParams)
+	}
+	topic, err := params.String("topic", "")
+	if err != nil {
+		return nil, err
+	}
+	if topic == "" {
+		return nil, fmt.Errorf("%w: topic cannot be empty", ErrInvalidParams)
+	}
+	kind, err := params.String("kind", retrainingKind)
+	if err != nil {
+		return nil, err
+	}
+	var acks kafka.RequiredAcks
+	if name, err := params.String("requiredAcks", "all"); err != nil {
+		return nil, err
+	} else if err := acks.UnmarshalText([]byte(name)); err != nil {
+		return nil, fmt.Errorf("%w: requiredAcks: %w", ErrInvalidParams, err)
+	}
+
+	logger.Info("Kafka action configured",
+		zap.Strings("brokers", brokers),
+		zap.String("topic", topic),
+		zap.String("kind", kind),
+	)
+	return &kafkaAction{
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(brokers...),
+			Topic:        topic,
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: acks,
+			ErrorLogger: kafka.LoggerFunc(func(msg string, args ...interface{}) {
+				logger.Error(fmt.Sprintf(msg, args...))
+			}),
+		},
+		kind: kind,
+	}, nil
+}
+
+func (a *kafkaAction) Run(ctx context.Context, v schema.Violation) error {
+	value, err := json.Marshal(retrainingRequest{Kind: a.kind, Reason: summary(v), Violation: v})
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrRunFailed, err)
+	}
+	err = a.writer.WriteMessages(ctx, kafka.Message{
+		Key:   []byte(v.FeatureName),
+		Value: value,
+		Headers: []kafka.Header{
+			{Key: "kind", Value: []byte(a.kind)},
+			{Key: "eventId", Value: []byte(v.EventID)},
+			{Key: "schemaVersion", Value: []byte(schema.Version)},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrRunFailed, err)
+	}
+	return nil
+}
+
+func (a *kafkaAction) Close() error {
+	return a.writer.Close()
+}
+
+// summary is a one-line description of a violation, e.g. "feature_a: mean 15.2 > 13".
+func summary(v schema.Violation) string {
+	if v.Comparison == "expr" {
+		return fmt.Sprintf("%s: %s held (%s)", v.FeatureName, v.CheckType, v.Expression)
+	}
+	return fmt.Sprintf("%s: %s %.4g %s %.4g", v.FeatureName, v.CheckType, v.Actual, v.Comparison, v.Threshold)
+}
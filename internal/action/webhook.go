@@ -0,0 +1,144 @@
+package action
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"text/template"
+
+	"go.uber.org/zap"
+
+	"github.com/sanspareilsmyn/featurelens/internal/params"
+	"github.com/sanspareilsmyn/featurelens/internal/schema"
+)
+
+// userAgent identifies FeatureLens to the services actions call.
+const userAgent = "featurelens"
+
+// webhookAction calls an HTTP endpoint for each violation, e.g. the API of a feature flag
+// service to turn off the flag serving a drifting feature.
+type webhookAction struct {
+	method string
+	url    *template.Template
+	body   *template.Template // nil sends the violation as JSON
+	header http.Header
+	client *http.Client
+}
+
+// newWebhook creates a webhook action.
+//
+// Params: url (required; a text/template executed with the violation, e.g.
+// "https://flags.example.com/api/flags/{{.FeatureName}}"), method (default POST), body
+// (text/template executed with the violation; default the violation as JSON), headers
+// (name to value), tokenFile (file holding a bearer token for the Authorization header)
+// or token (the token itself, e.g. from a {secret: ref} config reference).
+func newWebhook(params params.Params, logger *zap.Logger) (Action, error) {
+	rawURL, err := params.String("url", "")
+	if err != nil {
+		return nil, err
+	}
+	if rawURL == "" {
+		return nil, fmt.Errorf("%w: url cannot be empty", ErrInvalidParams)
+	}
+	url, err := template.New("url").Option("missingkey=error").Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("%w: url: %w", ErrInvalidParams, err)
+	}
+	method, err := params.String("method", http.MethodPost)
+	if err != nil {
+		return nil, err
+	}
+	var body *template.Template
+	if text, err := params.String("body", ""); err != nil {
+		return nil, err
+	} else if text != "" {
+		if body, err = template.New("body").Option("missingkey=error").Parse(text); err != nil {
+			return nil, fmt.Errorf("%w: body: %w", ErrInvalidParams, err)
+		}
+	}
+	headers, err := params.StringMap("headers")
+	if err != nil {
+		return nil, err
+	}
+	header := make(http.Header, len(headers)+1)
+	for name, value := range headers {
+		header.Set(name, value)
+	}
+	if token, err := params.String("token", ""); err != nil {
+		return nil, err
+	} else if token != "" {
+		header.Set("Authorization", "Bearer "+token)
+	} else if path, err := params.String("tokenFile", ""); err != nil {
+		return nil, err
+	} else if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("%w: tokenFile: %w", ErrInvalidParams, err)
+		}
+		token := strings.TrimSpace(string(data))
+		if token == "" {
+			return nil, fmt.Errorf("%w: tokenFile %q is empty", ErrInvalidParams, path)
+		}
+		header.Set("Authorization", "Bearer "+token)
+	}
+
+	logger.Info("Webhook action configured", zap.String("method", method), zap.Bool("custom_body", body != nil))
+	return &webhookAction{
+		method: strings.ToUpper(method),
+		url:    url,
+		body:   body,
+		header: header,
+		client: &http.Client{},
+	}, nil
+}
+
+func (a *webhookAction) Run(ctx context.Context, v schema.Violation) error {
+	var url strings.Builder
+	if err := a.url.Execute(&url, v); err != nil {
+		return fmt.Errorf("%w: url: %w", ErrRunFailed, err)
+	}
+	var body bytes.Buffer
+	contentType := "text/plain; charset=utf-8"
+	if a.body == nil {
+		if err := json.NewEncoder(&body).Encode(v); err != nil {
+			return fmt.Errorf("%w: %w", ErrRunFailed, err)
+		}
+		contentType = "application/json"
+	} else if err := a.body.Execute(&body, v); err != nil {
+		return fmt.Errorf("%w: body: %w", ErrRunFailed, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, a.method, url.String(), &body)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrRunFailed, err)
+	}
+	for name, values := range a.header {
+		req.Header[name] = values
+	}
+	if req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrRunFailed, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("%w: status %d: %s", ErrRunFailed, resp.StatusCode, bytes.TrimSpace(msg))
+}
+
+func (a *webhookAction) Close() error {
+	a.client.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,508 @@
+// Package admin serves the HTTP API used to operate FeatureLens at runtime.
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/sanspareilsmyn/featurelens/internal/config"
+	"github.com/sanspareilsmyn/featurelens/internal/logging"
+	"github.com/sanspareilsmyn/featurelens/internal/middleware"
+	"github.com/sanspareilsmyn/featurelens/internal/pipeline"
+)
+
+// Prefix is the path under which the admin API is mounted.
+const Prefix = "/admin/v1/"
+
+// maxRequestBytes bounds the size of request bodies.
+const maxRequestBytes = 1 << 20
+
+// Consumer seeks, pauses and resumes the consumer of the monitored topics, e.g. a
+// *pipeline.Pipeline.
+type Consumer interface {
+	Seek(ctx context.Context, target config.SeekTarget) (pipeline.Offsets, error)
+	Pause() error
+	Resume() error
+	Paused() bool
+}
+
+// API exposes bulk operations over features selected by their tags.
+type API struct {
+	controls *pipeline.Controls
+	consumer Consumer
+	windows  *pipeline.RecentWindows
+	levels   *logging.Levels
+	kafka    config.KafkaConfig
+	logger   *zap.Logger
+}
+
+// NewAPI creates the admin API over the pipeline's runtime controls, consumer group,
+// recent windows and log levels. The Kafka configuration
+// identifies the instance in its status.
+func NewAPI(controls *pipeline.Controls, consumer Consumer, windows *pipeline.RecentWindows, levels *logging.Levels, kafka config.KafkaConfig, logger *zap.Logger) *API {
+	return &API{controls: controls, consumer: consumer, windows: windows, levels: levels, kafka: kafka, logger: logger}
+}
+
+// LogLevels is the response of the log level endpoints: the level of every logger, and
+// those of the components overriding it.
+type LogLevels struct {
+	Level      string            `json:"level"`
+	Components map[string]string `json:"components"` // By logger name, e.g. "alerter"
+}
+
+// FeatureInfo is the response of the feature endpoint: how a feature is monitored and
+// who owns it.
+type FeatureInfo struct {
+	Name        string            `json:"name"`
+	Tenant      string            `json:"tenant,omitempty"`
+	MetricType  string            `json:"metricType"`
+	Mode        string            `json:"mode,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"`
+	Owner       string            `json:"owner,omitempty"`
+	Team        string            `json:"team,omitempty"`
+	RunbookURL  string            `json:"runbookUrl,omitempty"`
+	Description string            `json:"description,omitempty"`
+}
+
+// FeatureSamples is the response of the samples endpoint: example values of a feature's
+// latest window, empty unless pipeline.valueSamples is enabled.
+type FeatureSamples struct {
+	Feature     string    `json:"feature"`
+	WindowStart time.Time `json:"windowStart"`
+	WindowEnd   time.Time `json:"windowEnd"`
+	Samples     []string  `json:"samples"`
+}
+
+// SeekResult is the response of the seek endpoint: the offsets consumption resumes from.
+type SeekResult struct {
+	Topic   string           `json:"topic"`
+	GroupID string           `json:"groupID"`
+	To      string           `json:"to"`
+	Offsets pipeline.Offsets `json:"offsets"` // By topic and partition
+}
+
+// InstanceStatus is the response of the status endpoint: which topic the instance
+// consumes, whether consumption is paused and its current health.
+type InstanceStatus struct {
+	Topic   string `json:"topic"`
+	GroupID string `json:"groupID"`
+	Paused  bool   `json:"paused"`
+	pipeline.Status
+}
+
+// Handler returns the routes of the admin API:
+//
+//	GET    /admin/v1/status
+//	GET    /admin/v1/features?selector=team=pricing,tier=experimental
+//	GET    /admin/v1/features/{name}
+//	GET    /admin/v1/features/{name}/samples
+//	GET    /admin/v1/silences
+//	POST   /admin/v1/silences            {"selector": {...}, "features": [...], "checks": [...], "startsAt": "...", "duration": "2h", "reason": "..."}
+//	DELETE /admin/v1/silences/{id}
+//	GET    /admin/v1/severity-overrides
+//	POST   /admin/v1/severity-overrides  {"selector": {...}, "severity": "info", "duration": "24h"}
+//	DELETE /admin/v1/severity-overrides/{id}
+//	GET    /admin/v1/acknowledgements
+//	POST   /admin/v1/acknowledgements    {"feature": "...", "check": "null_rate", "comparison": ">", "by": "...", "comment": "...", "duration": "1h"}
+//	DELETE /admin/v1/acknowledgements/{id}
+//	POST   /admin/v1/seek                {"to": "earliest" | "latest" | "2024-05-01T08:00:00Z"}
+//	POST   /admin/v1/pause
+//	POST   /admin/v1/resume
+//	GET    /admin/v1/log-levels
+//	POST   /admin/v1/log-levels          {"level": "debug", "component": "alerter"}
+//	DELETE /admin/v1/log-levels/{component}
+//
+// Routes changing state (silences, severity overrides, acknowledgements, seeks, pauses
+// and log levels) require the operator role from the surface's authenticating middleware; callers it
+// grants read-only may only read.
+func (a *API) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+Prefix+"status", a.status)
+	mux.HandleFunc("GET "+Prefix+"features", a.listFeatures)
+	mux.HandleFunc("GET "+Prefix+"features/{name}", a.feature)
+	mux.HandleFunc("GET "+Prefix+"features/{name}/samples", a.featureSamples)
+	mux.HandleFunc("GET "+Prefix+"silences", a.listSilences)
+	mux.HandleFunc("POST "+Prefix+"silences", a.operator(a.createSilence))
+	mux.HandleFunc("DELETE "+Prefix+"silences/{id}", a.operator(a.deleteSilence))
+	mux.HandleFunc("GET "+Prefix+"severity-overrides", a.listSeverityOverrides)
+	mux.HandleFunc("POST "+Prefix+"severity-overrides", a.operator(a.createSeverityOverride))
+	mux.HandleFunc("DELETE "+Prefix+"severity-overrides/{id}", a.operator(a.deleteSeverityOverride))
+	mux.HandleFunc("GET "+Prefix+"acknowledgements", a.listAcknowledgements)
+	mux.HandleFunc("POST "+Prefix+"acknowledgements", a.operator(a.createAcknowledgement))
+	mux.HandleFunc("DELETE "+Prefix+"acknowledgements/{id}", a.operator(a.deleteAcknowledgement))
+	mux.HandleFunc("POST "+Prefix+"seek", a.operator(a.seek))
+	mux.HandleFunc("POST "+Prefix+"pause", a.operator(a.pause))
+	mux.HandleFunc("POST "+Prefix+"resume", a.operator(a.resume))
+	mux.HandleFunc("GET "+Prefix+"log-levels", a.listLogLevels)
+	mux.HandleFunc("POST "+Prefix+"log-levels", a.operator(a.setLogLevel))
+	mux.HandleFunc("DELETE "+Prefix+"log-levels/{component}", a.operator(a.resetLogLevel))
+	return mux
+}
+
+// operator rejects callers authenticated with the read-only role. Requests no
+// middleware authenticated pass, for deployments securing the admin API otherwise, e.g.
+// with an IP allowlist alone.
+func (a *API) operator(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if p, ok := middleware.PrincipalFromContext(r.Context()); ok && !p.Role.Allows(middleware.RoleOperator) {
+			a.logger.Warn("Rejected admin request of a read-only caller",
+				zap.String("method", r.Method),
+				zap.String("path", r.URL.Path),
+				zap.String("principal", p.Name),
+			)
+			a.writeError(w, http.StatusForbidden, fmt.Errorf("%w: %s %s", ErrOperatorRequired, r.Method, r.URL.Path))
+			return
+		}
+		h(w, r)
+	}
+}
+
+type bulkRequest struct {
+	Selector pipeline.Selector `json:"selector"`
+	Features []string          `json:"features"` // Silences only
+	Checks   []string          `json:"checks"`   // Silences only
+	StartsAt time.Time         `json:"startsAt"` // Silences only; RFC 3339, defaults to now
+	Duration string            `json:"duration"`
+	Reason   string            `json:"reason"`
+	Severity string            `json:"severity"`
+}
+
+// duration parses the optional request duration, returning zero when absent.
+func (r bulkRequest) duration() (time.Duration, error) {
+	if r.Duration == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(r.Duration)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", pipeline.ErrInvalidDuration, err)
+	}
+	return d, nil
+}
+
+func (a *API) status(w http.ResponseWriter, _ *http.Request) {
+	a.writeJSON(w, http.StatusOK, InstanceStatus{
+		Topic:   a.kafka.Subscription(),
+		GroupID: a.kafka.GroupID,
+		Paused:  a.consumer.Paused(),
+		Status:  a.controls.Status(),
+	})
+}
+
+func (a *API) listFeatures(w http.ResponseWriter, r *http.Request) {
+	selector, err := parseSelector(r.URL.Query().Get("selector"))
+	if err != nil {
+		a.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	a.writeJSON(w, http.StatusOK, map[string]interface{}{
+		"features": nonNil(a.controls.MatchingFeatures(selector)),
+	})
+}
+
+func (a *API) feature(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	f, ok := a.controls.Feature(name)
+	if !ok {
+		a.writeError(w, http.StatusNotFound, fmt.Errorf("%w: %q", ErrUnknownFeature, name))
+		return
+	}
+	a.writeJSON(w, http.StatusOK, FeatureInfo{
+		Name:        f.Name,
+		Tenant:      f.Tenant,
+		MetricType:  f.MetricType,
+		Mode:        f.Mode,
+		Tags:        f.Tags,
+		Owner:       f.Owner,
+		Team:        f.Team,
+		RunbookURL:  f.RunbookURL,
+		Description: f.Description,
+	})
+}
+
+func (a *API) featureSamples(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	records, ok := a.windows.History(name, 1)
+	if !ok || len(records) == 0 {
+		a.writeError(w, http.StatusNotFound, fmt.Errorf("%w: %q", ErrUnknownFeature, name))
+		return
+	}
+	result := records[0].Result
+	a.writeJSON(w, http.StatusOK, FeatureSamples{
+		Feature:     name,
+		WindowStart: result.WindowStart,
+		WindowEnd:   result.WindowEnd,
+		Samples:     nonNil(result.Samples),
+	})
+}
+
+func (a *API) listSilences(w http.ResponseWriter, _ *http.Request) {
+	a.writeJSON(w, http.StatusOK, map[string]interface{}{"silences": a.controls.Silences()})
+}
+
+func (a *API) createSilence(w http.ResponseWriter, r *http.Request) {
+	req, ok := a.decode(w, r)
+	if !ok {
+		return
+	}
+	d, err := req.duration()
+	if err != nil {
+		a.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	matcher := pipeline.SilenceMatcher{Selector: req.Selector, Features: req.Features, Checks: req.Checks}
+	silence, err := a.controls.AddSilence(matcher, req.StartsAt, d, req.Reason)
+	if err != nil {
+		a.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	a.writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"silence":         silence,
+		"matchedFeatures": nonNil(a.controls.SilencedFeatures(matcher)),
+	})
+}
+
+func (a *API) deleteSilence(w http.ResponseWriter, r *http.Request) {
+	if !a.controls.RemoveSilence(r.PathValue("id")) {
+		http.NotFound(w, r)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *API) listSeverityOverrides(w http.ResponseWriter, _ *http.Request) {
+	a.writeJSON(w, http.StatusOK, map[string]interface{}{"severityOverrides": a.controls.SeverityOverrides()})
+}
+
+func (a *API) createSeverityOverride(w http.ResponseWriter, r *http.Request) {
+	req, ok := a.decode(w, r)
+	if !ok {
+		return
+	}
+	d, err := req.duration()
+	if err != nil {
+		a.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	override, err := a.controls.SetSeverity(req.Selector, req.Severity, d)
+	if err != nil {
+		a.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	a.writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"severityOverride": override,
+		"matchedFeatures":  nonNil(a.controls.MatchingFeatures(req.Selector)),
+	})
+}
+
+func (a *API) deleteSeverityOverride(w http.ResponseWriter, r *http.Request) {
+	if !a.controls.RemoveSeverityOverride(r.PathValue("id")) {
+		http.NotFound(w, r)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *API) listAcknowledgements(w http.ResponseWriter, _ *http.Request) {
+	a.writeJSON(w, http.StatusOK, map[string]interface{}{"acknowledgements": a.controls.Acknowledgements()})
+}
+
+// createAcknowledgement acknowledges firing alerts on behalf of the JWT subject of the
+// request, if authenticated, or else of "by".
+func (a *API) createAcknowledgement(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Feature    string `json:"feature"`
+		Check      string `json:"check"`      // Empty for every firing check of the feature
+		Comparison string `json:"comparison"` // Empty for any
+		By         string `json:"by"`
+		Comment    string `json:"comment"`
+		Duration   string `json:"duration"` // Snoozes the alerts; empty until they resolve
+	}
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		a.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	d, err := bulkRequest{Duration: req.Duration}.duration()
+	if err != nil {
+		a.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	by := req.By
+	if p, ok := middleware.PrincipalFromContext(r.Context()); ok && p.Name != "" {
+		by = p.Name // The JWT subject or client certificate common name
+	}
+	acks, err := a.controls.Acknowledge(req.Feature, req.Check, req.Comparison, by, req.Comment, d)
+	switch {
+	case errors.Is(err, pipeline.ErrAlertNotFiring):
+		a.writeError(w, http.StatusNotFound, err)
+		return
+	case err != nil:
+		a.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	a.writeJSON(w, http.StatusCreated, map[string]interface{}{"acknowledgements": acks})
+}
+
+func (a *API) deleteAcknowledgement(w http.ResponseWriter, r *http.Request) {
+	if !a.controls.RemoveAcknowledgement(r.PathValue("id")) {
+		http.NotFound(w, r)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *API) seek(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		To string `json:"to"`
+	}
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		a.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	target, err := config.ParseSeekTarget(req.To)
+	if err != nil {
+		a.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	offsets, err := a.consumer.Seek(r.Context(), target)
+	switch {
+	case errors.Is(err, pipeline.ErrSeekUnavailable):
+		a.writeError(w, http.StatusConflict, err)
+		return
+	case err != nil:
+		a.writeError(w, http.StatusBadGateway, err)
+		return
+	}
+	a.logger.Info("Seek requested through the admin API", zap.Stringer("target", target))
+	a.writeJSON(w, http.StatusOK, SeekResult{Topic: a.kafka.Subscription(), GroupID: a.kafka.GroupID, To: target.String(), Offsets: offsets})
+}
+
+// pause stops handing consumed messages downstream, e.g. during an upstream backfill
+// that should not be monitored, until resumed.
+func (a *API) pause(w http.ResponseWriter, _ *http.Request) {
+	if err := a.consumer.Pause(); err != nil {
+		a.writeError(w, http.StatusConflict, err)
+		return
+	}
+	a.logger.Info("Consumer paused through the admin API")
+	a.writeJSON(w, http.StatusOK, map[string]bool{"paused": true})
+}
+
+func (a *API) resume(w http.ResponseWriter, _ *http.Request) {
+	if err := a.consumer.Resume(); err != nil {
+		a.writeError(w, http.StatusConflict, err)
+		return
+	}
+	a.logger.Info("Consumer resumed through the admin API")
+	a.writeJSON(w, http.StatusOK, map[string]bool{"paused": false})
+}
+
+func (a *API) listLogLevels(w http.ResponseWriter, _ *http.Request) {
+	a.writeJSON(w, http.StatusOK, a.logLevels())
+}
+
+// setLogLevel changes the level of every logger, or overrides that of a component's
+// loggers, e.g. to debug the alerter during an incident without a restart. Changes last
+// until the process exits.
+func (a *API) setLogLevel(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Level     string `json:"level"`
+		Component string `json:"component"` // Empty for every logger
+	}
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		a.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	level, err := zapcore.ParseLevel(req.Level)
+	if req.Level == "" || err != nil {
+		a.writeError(w, http.StatusBadRequest, fmt.Errorf("%w: %q", ErrInvalidLogLevel, req.Level))
+		return
+	}
+	if req.Component == "" {
+		a.levels.SetLevel(level)
+	} else {
+		a.levels.SetComponent(req.Component, level)
+	}
+	a.logger.Info("Log level changed through the admin API", zap.Stringer("level", level), zap.String("component", req.Component))
+	a.writeJSON(w, http.StatusOK, a.logLevels())
+}
+
+// resetLogLevel removes the override of a component's loggers, which log at the level of
+// every logger again.
+func (a *API) resetLogLevel(w http.ResponseWriter, r *http.Request) {
+	component := r.PathValue("component")
+	if !a.levels.ResetComponent(component) {
+		http.NotFound(w, r)
+		return
+	}
+	a.logger.Info("Log level override removed through the admin API", zap.String("component", component))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *API) logLevels() LogLevels {
+	levels := LogLevels{Level: a.levels.Level().String(), Components: make(map[string]string)}
+	for component, level := range a.levels.Components() {
+		levels.Components[component] = level.String()
+	}
+	return levels
+}
+
+// decode reads a bulk request body, writing a 400 response on failure.
+func (a *API) decode(w http.ResponseWriter, r *http.Request) (bulkRequest, bool) {
+	var req bulkRequest
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		a.writeError(w, http.StatusBadRequest, err)
+		return req, false
+	}
+	return req, true
+}
+
+// parseSelector parses "key=value,key2=value2" into a Selector.
+func parseSelector(raw string) (pipeline.Selector, error) {
+	selector := pipeline.Selector{}
+	if raw == "" {
+		return selector, nil
+	}
+	for _, pair := range strings.Split(raw, ",") {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || key == "" {
+			return nil, ErrInvalidSelector
+		}
+		selector[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return selector, nil
+}
+
+func (a *API) writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		a.logger.Warn("Failed to write admin API response", zap.Error(err))
+	}
+}
+
+func (a *API) writeError(w http.ResponseWriter, status int, err error) {
+	a.writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func nonNil(names []string) []string {
+	if names == nil {
+		return []string{}
+	}
+	return names
+}
@@ -0,0 +1,10 @@
+package admin
+
+import "errors"
+
+var (
+	ErrInvalidSelector  = errors.New("selector must be a comma-separated list of key=value pairs")
+	ErrInvalidLogLevel  = errors.New("log level must be debug, info, warn, error, dpanic, panic or fatal")
+	ErrOperatorRequired = errors.New("operator role required")
+	ErrUnknownFeature   = errors.New("no recent windows of feature")
+)
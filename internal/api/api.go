@@ -0,0 +1,128 @@
+// Package api serves read-only JSON endpoints for scripts and CI checks polling the
+// state of FeatureLens.
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/sanspareilsmyn/featurelens/internal/pipeline"
+	"github.com/sanspareilsmyn/featurelens/internal/schema"
+	"github.com/sanspareilsmyn/featurelens/internal/store"
+)
+
+// Prefix is the path under which the API is mounted.
+const Prefix = "/api/v1/"
+
+// API exposes the recent window statistics of every feature.
+type API struct {
+	windows *pipeline.RecentWindows
+	logger  *zap.Logger
+}
+
+// NewAPI creates the API over the pipeline's recent windows.
+func NewAPI(windows *pipeline.RecentWindows, logger *zap.Logger) *API {
+	return &API{windows: windows, logger: logger}
+}
+
+// WindowSummary is a feature's most recently flushed window: its statistics, whether any
+// check failed and the violations raised.
+type WindowSummary struct {
+	schema.AggregationResult
+	Violated   bool               `json:"violated"`
+	Violations []schema.Violation `json:"violations"`
+}
+
+// LatestWindows is the response of the latest windows endpoint. WindowEnd is the end of
+// the most recently flushed window; features that saw no messages in it report their
+// previous window.
+type LatestWindows struct {
+	WindowEnd *time.Time      `json:"windowEnd"` // null before the first window was flushed
+	Violated  bool            `json:"violated"`  // Whether any feature's latest window violated
+	Features  []WindowSummary `json:"features"`
+}
+
+// FeatureHistory is the response of the feature history endpoint.
+type FeatureHistory struct {
+	Feature string          `json:"feature"`
+	Windows []WindowSummary `json:"windows"` // Oldest first
+}
+
+// Handler returns the routes of the API:
+//
+//	GET /api/v1/windows/latest                     every feature's most recently flushed window
+//	GET /api/v1/features/{name}/history?windows=60 a feature's last windows
+func (a *API) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+Prefix+"windows/latest", a.latestWindows)
+	mux.HandleFunc("GET "+Prefix+"features/{name}/history", a.featureHistory)
+	return mux
+}
+
+func (a *API) latestWindows(w http.ResponseWriter, _ *http.Request) {
+	records := a.windows.Latest()
+	body := LatestWindows{Features: make([]WindowSummary, len(records))}
+	for i, r := range records {
+		summary := summarize(r)
+		if end := r.Result.WindowEnd; body.WindowEnd == nil || end.After(*body.WindowEnd) {
+			body.WindowEnd = &end
+		}
+		body.Violated = body.Violated || summary.Violated
+		body.Features[i] = summary
+	}
+	a.writeJSON(w, http.StatusOK, body)
+}
+
+func (a *API) featureHistory(w http.ResponseWriter, r *http.Request) {
+	n := a.windows.Size()
+	if raw := r.URL.Query().Get("windows"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 {
+			a.writeError(w, http.StatusBadRequest, fmt.Errorf("%w, got %q", ErrInvalidWindows, raw))
+			return
+		}
+		n = parsed // Capped by the windows kept
+	}
+
+	name := r.PathValue("name")
+	records, ok := a.windows.History(name, n)
+	if !ok {
+		a.writeError(w, http.StatusNotFound, fmt.Errorf("%w: %q", ErrUnknownFeature, name))
+		return
+	}
+	body := FeatureHistory{Feature: name, Windows: make([]WindowSummary, len(records))}
+	for i, record := range records {
+		body.Windows[i] = summarize(record)
+	}
+	a.writeJSON(w, http.StatusOK, body)
+}
+
+// summarize returns the summary of a stored window.
+func summarize(r store.Record) WindowSummary {
+	summary := WindowSummary{
+		AggregationResult: r.Result,
+		Violated:          len(r.Violations) > 0,
+		Violations:        r.Violations,
+	}
+	if summary.Violations == nil {
+		summary.Violations = []schema.Violation{}
+	}
+	return summary
+}
+
+func (a *API) writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		a.logger.Warn("Failed to write API response", zap.Error(err))
+	}
+}
+
+func (a *API) writeError(w http.ResponseWriter, status int, err error) {
+	a.writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,8 @@
+package api
+
+import "errors"
+
+var (
+	ErrInvalidWindows = errors.New("windows must be a positive number")
+	ErrUnknownFeature = errors.New("no windows recorded for feature")
+)
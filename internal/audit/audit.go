@@ -0,0 +1,86 @@
+// Package audit keeps a dedicated trail of every violation and alert resolution,
+// separate from the general log, so that compliance reviews and postmortems can
+// reconstruct exactly which feature breached which threshold and when.
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"go.uber.org/zap"
+	"gopkg.in/natefinch/lumberjack.v2"
+
+	"github.com/sanspareilsmyn/featurelens/internal/config"
+	"github.com/sanspareilsmyn/featurelens/internal/signing"
+)
+
+// Trail appends audit records to a size-rotated JSON lines file. Each line is a
+// versioned schema payload (kind "violation", "alert_firing" or "alert_resolved"), or the
+// signing.Envelope sealing it when a signer is configured.
+type Trail struct {
+	out    *lumberjack.Logger
+	signer signing.Signer
+}
+
+// Open opens the trail at cfg.Path, creating it and its parent directories if missing
+// and appending to it otherwise. signer may be nil to write unsigned records.
+func Open(cfg config.AuditConfig, signer signing.Signer, logger *zap.Logger) (*Trail, error) {
+	if err := os.MkdirAll(filepath.Dir(cfg.Path), 0o755); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrOpenFailed, err)
+	}
+	// Fail at startup rather than on the first violation if the file is not writable
+	f, err := os.OpenFile(cfg.Path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o640)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrOpenFailed, err)
+	}
+	if err := f.Close(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrOpenFailed, err)
+	}
+
+	logger.Info("Audit trail opened",
+		zap.String("path", cfg.Path),
+		zap.Int("max_size_mb", cfg.MaxSize),
+		zap.Int("max_backups", cfg.MaxBackups),
+		zap.Int("max_age_days", cfg.MaxAge),
+		zap.Bool("signed", signer != nil),
+	)
+	return &Trail{
+		out: &lumberjack.Logger{
+			Filename:   cfg.Path,
+			MaxSize:    cfg.MaxSize,    // megabytes
+			MaxBackups: cfg.MaxBackups, // files, 0 keeps all
+			MaxAge:     cfg.MaxAge,     // days, 0 keeps all
+			Compress:   cfg.Compress,
+		},
+		signer: signer,
+	}, nil
+}
+
+// Record appends a payload as one line. The line is written with a single write, so
+// records are never interleaved or split across rotated files.
+func (t *Trail) Record(payload interface{}) error {
+	var line []byte
+	var err error
+	if t.signer != nil {
+		var envelope signing.Envelope
+		if envelope, err = signing.Seal(t.signer, payload); err == nil {
+			line, err = json.Marshal(envelope)
+		}
+	} else {
+		line, err = json.Marshal(payload)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrRecordFailed, err)
+	}
+	if _, err := t.out.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("%w: %w", ErrRecordFailed, err)
+	}
+	return nil
+}
+
+// Close closes the current file.
+func (t *Trail) Close() error {
+	return t.out.Close()
+}
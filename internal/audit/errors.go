@@ -0,0 +1,8 @@
+package audit
+
+import "errors"
+
+var (
+	ErrOpenFailed   = errors.New("failed to open audit trail")
+	ErrRecordFailed = errors.New("failed to write audit record")
+)
@@ -1,151 +1,3185 @@
 package config
 
 import (
-	"errors"
+	"bytes"
+	"cmp"
 	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"runtime"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+
+	"github.com/sanspareilsmyn/featurelens/internal/cron"
+	"github.com/sanspareilsmyn/featurelens/internal/expr"
+	"github.com/sanspareilsmyn/featurelens/internal/luascript"
+	"github.com/sanspareilsmyn/featurelens/internal/message"
+	"github.com/sanspareilsmyn/featurelens/internal/sketch"
 )
 
 const (
-	defaultKafkaGroupID   = "featurelens-default-group"
-	defaultPipelineWindow = 1 * time.Minute
-	defaultLogLevel       = "info"
-	defaultLogFormat      = "console"
-	defaultLogFileEnabled = false
-	defaultLogDirectory   = "log"
-	defaultLogFilename    = "app.log"
-	defaultLogMaxSizeMB   = 100
-	defaultLogMaxBackups  = 3
-	defaultLogMaxAgeDays  = 7
-	defaultLogCompress    = false
+	defaultKafkaGroupID     = "featurelens-default-group"
+	defaultPipelineWindow   = 1 * time.Minute
+	defaultInternMaxSize    = 100000
+	defaultMaxDiscovered    = 1000
+	defaultMaxFeatureSeries = 2000
+	defaultMaxGroupSeries   = 10000
+	defaultHistoryWindows   = 60
+	defaultRecentWindows    = 6
+	defaultLearnWindows     = 12
+	defaultSchemaMinShare   = 0.01
+	defaultSchemaMaxFields  = 1000
+	defaultPartitionMinMsgs = 100
+	defaultPartitionRatio   = 10.0
+	defaultPartitionMinNull = 0.01
+	defaultFutureTolerance  = 1 * time.Minute
+	defaultOutOfOrderTol    = 10 * time.Second // Messages of different partitions interleave
+	defaultShutdownTimeout  = 30 * time.Second
+	defaultBatchSize        = 100
+	defaultBatchLinger      = 5 * time.Millisecond
+	defaultSpillDirectory   = "data/window-state"
+	defaultSessionGap       = 30 * time.Minute
+	defaultAllowedLateness  = 10 * time.Second
+	defaultLateRetention    = 10 * time.Minute
+	defaultMaxSessions      = 100000
+	defaultShedHighMark     = 0.8
+	defaultShedLowMark      = 0.5
+	defaultShedNormal       = 0.5
+	defaultShedLow          = 0.1
+	defaultSampleRate       = 1.0
+	defaultApproachMargin   = 0.1
+	defaultCooldownWins     = 3
+	defaultReservoirBoost   = 4.0
+	defaultMaxGroups        = 50
+	defaultLogLevel         = "info"
+	defaultLogFormat        = "console"
+	defaultLogFileEnabled   = false
+	defaultLogDirectory     = "log"
+	defaultLogFilename      = "app.log"
+	defaultLogMaxSizeMB     = 100
+	defaultLogMaxBackups    = 3
+	defaultLogMaxAgeDays    = 7
+	defaultLogCompress      = false
+	defaultLogSampleTick    = time.Second
+	defaultLogSampleFirst   = 100
+	defaultSigningAlgo      = SigningAlgorithmHMACSHA256
+	defaultSkewBins         = 10
+	defaultSkewSamples      = 1000
+	defaultRWTimeout        = 10 * time.Second
+	defaultRWFlush          = 15 * time.Second
+	defaultRWBatchSize      = 500
+	defaultRWQueueSize      = 10000
+	defaultRWMaxRetries     = 3
+	defaultOTelService      = "featurelens"
+	defaultOTelEndpoint     = "localhost:4318"
+	defaultOTelInterval     = 15 * time.Second
+	defaultStoreRetention   = 24 * time.Hour
+	defaultAuditPath        = "logs/audit.jsonl"
+	defaultSketchAccuracy   = 0.01
+	defaultHLLPrecision     = 12
+	defaultCMSWidth         = 1024
+	defaultCMSDepth         = 4
+	defaultSampleMaxLength  = 200
+	defaultExemplars        = 5
+	defaultSinkQueueSize    = 10000
+	defaultSinkBatchSize    = 500
+	defaultSinkFlush        = 5 * time.Second
+	defaultSinkTimeout      = 10 * time.Second
+	defaultSinkRetries      = 3
+	defaultSinkBackoff      = time.Second
+	defaultSinkDedup        = time.Hour
+	defaultSinkMaxBackoff   = time.Minute
+	defaultSinkOverflow     = 10000
+	defaultBreakerFailures  = 5
+	defaultBreakerOpen      = 30 * time.Second
+	defaultActionQueueSize  = 100
+	defaultActionTimeout    = 30 * time.Second
+	defaultActionCooldown   = time.Hour
+	defaultSecretsTimeout   = 10 * time.Second
+	defaultRegistryTimeout  = 10 * time.Second
+	defaultFormatHeader     = "content-type"
+	defaultSecretsRefresh   = 15 * time.Minute
+	defaultVaultKVVersion   = 2
+	defaultLagInterval      = 30 * time.Second
+	defaultReaderMinBytes   = 1
+	defaultReaderMaxBytes   = 1 << 20 // 1 MiB
+	defaultReaderMaxWait    = 10 * time.Second
+	defaultErrorSeverity    = "error"
+	defaultErrorInterval    = 5 * time.Minute
+	defaultLeaseName        = "featurelens"
+	defaultLeaseDuration    = 15 * time.Second
+	defaultRenewDeadline    = 10 * time.Second
+	defaultRetryPeriod      = 2 * time.Second
 
 	// Environment variable prefix
 	envPrefix = "FEATURELENS"
 )
 
 type Config struct {
-	Kafka    KafkaConfig     `mapstructure:"kafka"`
-	Pipeline PipelineConfig  `mapstructure:"pipeline"`
-	Features []FeatureConfig `mapstructure:"features"`
-	Log      LogConfig       `mapstructure:"log"`
+	Kafka       KafkaConfig       `mapstructure:"kafka"`
+	Pipeline    PipelineConfig    `mapstructure:"pipeline"`
+	Features    []FeatureConfig   `mapstructure:"features"`
+	Log         LogConfig         `mapstructure:"log"`
+	Signing     SigningConfig     `mapstructure:"signing"`
+	Skew        SkewConfig        `mapstructure:"skew"`
+	HTTP        HTTPConfig        `mapstructure:"http"`
+	RemoteWrite RemoteWriteConfig `mapstructure:"remoteWrite"`
+	Telemetry   TelemetryConfig   `mapstructure:"telemetry"`
+	Store       StoreConfig       `mapstructure:"store"`
+	Sinks       SinksConfig       `mapstructure:"sinks"`
+	Audit       AuditConfig       `mapstructure:"audit"`
+
+	LeaderElection LeaderElectionConfig `mapstructure:"leaderElection"`
+
+	CompositeMetrics   []CompositeMetricConfig   `mapstructure:"compositeMetrics"`
+	MaintenanceWindows []MaintenanceWindowConfig `mapstructure:"maintenanceWindows"`
+
+	Actions ActionsConfig `mapstructure:"actions"`
+	Secrets SecretsConfig `mapstructure:"secrets"`
+	Errors  ErrorsConfig  `mapstructure:"errors"`
+
+	// DisabledFeatures are the names of the features with enabled: false, dropped from
+	// Features once validated
+	DisabledFeatures []string `mapstructure:"-"`
+	// Deprecations describes the settings migrated from an older config version (see
+	// Version), to be logged as warnings
+	Deprecations []string `mapstructure:"-"`
+	// SecretReferences are the settings fetched from secret stores
+	SecretReferences []SecretReference `mapstructure:"-"`
+}
+
+// MaintenanceWindowConfig silences the alerts it matches during planned maintenance,
+// either once from start to end or for duration from every time its cron schedule fires.
+// Silenced violations are still counted and recorded, but do not notify sinks. Unset
+// matchers match every alert; at least one must be set.
+type MaintenanceWindowConfig struct {
+	Name     string            `mapstructure:"name"`
+	Selector map[string]string `mapstructure:"selector"` // Feature tags that must all be set to these values
+	Features []string          `mapstructure:"features"` // Globs matched against feature names
+	Checks   []string          `mapstructure:"checks"`   // Globs matched against check types, e.g. "null_rate" or "condition:*"
+	Start    string            `mapstructure:"start"`    // RFC 3339 time, with end
+	End      string            `mapstructure:"end"`
+	Schedule string            `mapstructure:"schedule"` // Five-field cron schedule, e.g. "0 2 * * sun", with duration
+	Duration time.Duration     `mapstructure:"duration"`
+	Timezone string            `mapstructure:"timezone"` // IANA time zone the schedule is evaluated in; defaults to UTC
+	Reason   string            `mapstructure:"reason"`
+}
+
+// Period returns the start and end times of a one-off window.
+func (w MaintenanceWindowConfig) Period() (start, end time.Time, err error) {
+	if start, err = time.Parse(time.RFC3339, w.Start); err != nil {
+		return start, end, err
+	}
+	end, err = time.Parse(time.RFC3339, w.End)
+	return start, end, err
+}
+
+// SinksConfig delivers emitted payloads (window results, violations, alert resolutions) to external systems.
+type SinksConfig struct {
+	QueueSize     int           `mapstructure:"queueSize"`     // Buffered events; newer ones are dropped when full
+	MaxBatchSize  int           `mapstructure:"maxBatchSize"`  // Events per delivery
+	FlushInterval time.Duration `mapstructure:"flushInterval"` // Max time an event waits before delivery
+	Timeout       time.Duration `mapstructure:"timeout"`       // Per delivery and sink
+	MaxRetries    int           `mapstructure:"maxRetries"`    // Redeliveries of a failed batch before it is dropped
+	RetryBackoff  time.Duration `mapstructure:"retryBackoff"`  // Wait before the first redelivery, doubled for each further one
+	// DedupRetention is how long each sink remembers the events delivered to it, by
+	// window end, and skips them if they are emitted again; 0 disables deduplication.
+	DedupRetention time.Duration `mapstructure:"dedupRetention"`
+	LedgerPath     string        `mapstructure:"ledgerPath"` // JSON lines file persisting delivered events across restarts; empty keeps them in memory
+	Outputs        []SinkConfig  `mapstructure:"outputs"`
+	Routes         []RouteConfig `mapstructure:"routes"`
+
+	MaxRetryBackoff time.Duration        `mapstructure:"maxRetryBackoff"` // Cap on the doubled retry backoff
+	OverflowSize    int                  `mapstructure:"overflowSize"`    // Failed events kept per sink and redelivered later, oldest dropped first; 0 drops failed batches
+	CircuitBreaker  CircuitBreakerConfig `mapstructure:"circuitBreaker"`
+
+	// MaxNotifyAge is how long after its window ended a violation may still notify sinks
+	// and actions and fire alerts, so that replays and backfills of old data do not page;
+	// later ones are recorded as stale. 0 notifies violations of any age.
+	MaxNotifyAge time.Duration `mapstructure:"maxNotifyAge"`
+}
+
+// CircuitBreakerConfig stops delivering to a sink that keeps failing, so an endpoint that
+// is down costs neither retries nor timeouts on every batch. While a sink's circuit is
+// open its events go to the overflow buffer; after OpenDuration, one delivery is tried
+// and closes the circuit if it succeeds.
+type CircuitBreakerConfig struct {
+	FailureThreshold int           `mapstructure:"failureThreshold"` // Consecutive failed deliveries opening the circuit; 0 disables
+	OpenDuration     time.Duration `mapstructure:"openDuration"`     // Time deliveries are skipped before a trial delivery
+}
+
+// SinkConfig selects a registered sink type and its parameters,
+// e.g. {type: "file", params: {path: "data/results.jsonl"}}.
+type SinkConfig struct {
+	Name  string   `mapstructure:"name"` // Used in logs and metrics; defaults to the type
+	Type  string   `mapstructure:"type"`
+	Kinds []string `mapstructure:"kinds"` // Payload kinds delivered, e.g. ["aggregation_result"]; empty for all
+	// Tenants whose features' events are delivered; empty for all events, including
+	// pipeline-level ones (latency, throughput, correlations) that belong to no tenant.
+	Tenants []string `mapstructure:"tenants"`
+	// Features are globs matched against the name events are reported for, e.g.
+	// "fraud_*" (the topic for pipeline-level violations); empty for all.
+	Features []string `mapstructure:"features"`
+	// Checks whose violations and alert transitions are delivered, e.g. ["schema_change"];
+	// empty for all. Other kinds of events are not filtered by check.
+	Checks    []string               `mapstructure:"checks"`
+	QueueSize int                    `mapstructure:"queueSize"` // Events waiting for this sink, newer ones dropped when full; 0 inherits sinks.queueSize
+	Params    map[string]interface{} `mapstructure:"params"`
+
+	// Template is a Go text/template rendering the violations and alert transitions sent,
+	// in place of the sink's own notification text or JSON, e.g. to match what an incident
+	// tool expects. It is executed with sink.TemplateData: the payload, the feature's
+	// configuration, the window's statistics, the baseline window and recent history.
+	// TemplateFile reads it from a file instead. Only file, kafka, teams, discord,
+	// opsgenie and victorops sinks support templates.
+	Template     string `mapstructure:"template"`
+	TemplateFile string `mapstructure:"templateFile"`
+
+	// MaxRetries and RetryBackoff override sinks.maxRetries and sinks.retryBackoff for this
+	// sink, e.g. to give up sooner on a chat webhook than on an archive.
+	MaxRetries   *int          `mapstructure:"maxRetries"`
+	RetryBackoff time.Duration `mapstructure:"retryBackoff"` // 0 inherits sinks.retryBackoff
+}
+
+// Retries returns the redeliveries of a failed batch and the first backoff for the sink.
+func (c SinkConfig) Retries(defaults SinksConfig) (int, time.Duration) {
+	retries, backoff := defaults.MaxRetries, defaults.RetryBackoff
+	if c.MaxRetries != nil {
+		retries = *c.MaxRetries
+	}
+	if c.RetryBackoff != 0 {
+		backoff = c.RetryBackoff
+	}
+	return retries, backoff
+}
+
+// RouteConfig sends the violations and alert resolutions it matches to specific sinks,
+// e.g. fraud features to the pager and every other feature to chat. Routes are evaluated in
+// order and the first match wins unless it continues; a route without matchers matches
+// every alert. Sinks named by a route only receive the alerts routed to them, while other
+// sinks keep receiving every alert of the kinds and tenants they accept.
+type RouteConfig struct {
+	Name       string            `mapstructure:"name"`
+	Features   []string          `mapstructure:"features"`   // Globs matched against feature names, e.g. "fraud_*"
+	Severities []string          `mapstructure:"severities"` // "info", "warning" or "critical"
+	Tenants    []string          `mapstructure:"tenants"`
+	Tags       map[string]string `mapstructure:"tags"`     // Feature tags that must all be set to these values
+	Sinks      []string          `mapstructure:"sinks"`    // Names of the sinks receiving matched alerts
+	Continue   bool              `mapstructure:"continue"` // Keep evaluating later routes after a match
+}
+
+// ActionsConfig runs remediation when alerts fire, closing the loop from detection to
+// mitigation, e.g. flipping a feature flag off or requesting a model retraining. Actions
+// only run for violations that page: not silenced, acknowledged or grouped under an
+// upstream feature's alert.
+type ActionsConfig struct {
+	QueueSize int            `mapstructure:"queueSize"` // Buffered runs; newer ones are dropped when full
+	Timeout   time.Duration  `mapstructure:"timeout"`   // Per run
+	Cooldown  time.Duration  `mapstructure:"cooldown"`  // Min time between runs of an action for one firing alert
+	Triggers  []ActionConfig `mapstructure:"triggers"`
+}
+
+// ActionConfig is an action run for the violations it matches. Unset matchers match every
+// violation.
+type ActionConfig struct {
+	Name       string                 `mapstructure:"name"`       // Used in logs and metrics; defaults to the type
+	Type       string                 `mapstructure:"type"`       // "webhook", "kafka" or "exec"
+	Features   []string               `mapstructure:"features"`   // Globs matched against feature names, e.g. "fraud_*"
+	Checks     []string               `mapstructure:"checks"`     // Globs matched against check types, e.g. "null_rate" or "condition:*"
+	Severities []string               `mapstructure:"severities"` // "info", "warning" or "critical"
+	Tenants    []string               `mapstructure:"tenants"`
+	Tags       map[string]string      `mapstructure:"tags"`     // Feature tags that must all be set to these values
+	Cooldown   time.Duration          `mapstructure:"cooldown"` // 0 inherits actions.cooldown
+	DryRun     bool                   `mapstructure:"dryRun"`   // Log the runs instead of performing them
+	Params     map[string]interface{} `mapstructure:"params"`
+}
+
+// ErrorsConfig reports the operational failures of FeatureLens itself, such as a sink that
+// is down or a storm of unparseable messages, apart from the data-quality alerts raised
+// on features. Every failure is counted by component, severity and retryability; the
+// sinks named by NotifySinks also receive them as internal_error events.
+type ErrorsConfig struct {
+	// NotifySinks are the names of the sinks receiving internal_error events, whatever
+	// kinds and tenants they accept; other sinks never do. Empty disables notification.
+	NotifySinks    []string      `mapstructure:"notifySinks"`
+	NotifySeverity string        `mapstructure:"notifySeverity"` // Least severity notified: "warning", "error" or "critical"
+	NotifyInterval time.Duration `mapstructure:"notifyInterval"` // Min time between notifications of one operation's failures; 0 notifies each
+}
+
+// StoreConfig keeps window results and their violations for the time-travel view of
+// the web UI.
+type StoreConfig struct {
+	Enabled   bool          `mapstructure:"enabled"`
+	Path      string        `mapstructure:"path"`      // JSON lines file; empty keeps results in memory only
+	Retention time.Duration `mapstructure:"retention"` // Results older than this are dropped
+}
+
+// SecretsConfig configures the secret stores settings may reference with a
+// `{secret: "<provider>:<path>[#<key>]"}` mapping in place of their value: vault (KV
+// secrets engine of HashiCorp Vault) or aws (AWS Secrets Manager). Secrets are fetched
+// when the configuration is loaded, and fetched again every RefreshInterval while
+// running; components keep the values they were built with, so a rotated secret stops
+// the pipeline for its restart to apply it.
+type SecretsConfig struct {
+	Vault           VaultSecretsConfig `mapstructure:"vault"`
+	AWS             AWSSecretsConfig   `mapstructure:"aws"`
+	Timeout         time.Duration      `mapstructure:"timeout"`         // Per fetch
+	RefreshInterval time.Duration      `mapstructure:"refreshInterval"` // 0 disables refreshes
+}
+
+// VaultSecretsConfig connects to HashiCorp Vault; unset settings are read from VAULT_ADDR,
+// VAULT_TOKEN and VAULT_NAMESPACE.
+type VaultSecretsConfig struct {
+	Address   string `mapstructure:"address"`
+	TokenFile string `mapstructure:"tokenFile"` // Re-read for every fetch, e.g. a token renewed by Vault Agent
+	Namespace string `mapstructure:"namespace"`
+	KVVersion int    `mapstructure:"kvVersion"` // Of the KV secrets engine, 1 or 2
+}
+
+// AWSSecretsConfig connects to AWS Secrets Manager with the credentials of the AWS_*
+// environment variables.
+type AWSSecretsConfig struct {
+	Region   string `mapstructure:"region"`   // Default AWS_REGION
+	Endpoint string `mapstructure:"endpoint"` // e.g. a VPC endpoint or LocalStack
+}
+
+// AuditConfig writes every violation and alert resolution to a dedicated JSON lines file,
+// separate from the general log. Records are signed when signing is enabled.
+type AuditConfig struct {
+	Enabled    bool   `mapstructure:"enabled"`
+	Path       string `mapstructure:"path"`
+	MaxSize    int    `mapstructure:"maxSize"`    // Max size in MB before rotation
+	MaxBackups int    `mapstructure:"maxBackups"` // Rotated files kept, 0 keeps all
+	MaxAge     int    `mapstructure:"maxAge"`     // Days rotated files are kept, 0 keeps all
+	Compress   bool   `mapstructure:"compress"`   // Compress rotated files?
+}
+
+// LeaderElectionConfig lets replicas compete for a Kubernetes Lease, so that only the
+// leader consumes and alerts while the others stand by to take over. Replicas must run
+// in the cluster, with a service account allowed to get, create and update the lease.
+type LeaderElectionConfig struct {
+	Enabled       bool          `mapstructure:"enabled"`
+	LeaseName     string        `mapstructure:"leaseName"`
+	Namespace     string        `mapstructure:"namespace"`     // Defaults to the namespace of the pod
+	Identity      string        `mapstructure:"identity"`      // Defaults to the hostname, i.e. the pod name
+	LeaseDuration time.Duration `mapstructure:"leaseDuration"` // How long standbys wait after the last renewal before taking over
+	RenewDeadline time.Duration `mapstructure:"renewDeadline"` // How long the leader keeps trying to renew before it stops leading
+	RetryPeriod   time.Duration `mapstructure:"retryPeriod"`   // Interval between attempts to acquire or renew the lease
+}
+
+// TelemetryConfig exports OpenTelemetry traces and metrics about the pipeline itself over OTLP/HTTP.
+type TelemetryConfig struct {
+	Enabled          bool              `mapstructure:"enabled"`
+	Endpoint         string            `mapstructure:"endpoint"` // OTLP/HTTP collector host:port
+	Insecure         bool              `mapstructure:"insecure"` // Use plain HTTP
+	Headers          map[string]string `mapstructure:"headers"`
+	ServiceName      string            `mapstructure:"serviceName"`
+	TraceSampleRatio float64           `mapstructure:"traceSampleRatio"` // Fraction of root spans sampled
+	MetricInterval   time.Duration     `mapstructure:"metricInterval"`
+}
+
+// RemoteWriteConfig pushes window aggregates to a Prometheus remote-write endpoint
+// (Mimir, Thanos, VictoriaMetrics), timestamped at the window end.
+type RemoteWriteConfig struct {
+	Enabled         bool              `mapstructure:"enabled"`
+	URL             string            `mapstructure:"url"`
+	Timeout         time.Duration     `mapstructure:"timeout"`         // Per request
+	FlushInterval   time.Duration     `mapstructure:"flushInterval"`   // Max time a sample waits before being sent
+	MaxBatchSize    int               `mapstructure:"maxBatchSize"`    // Series per request
+	QueueSize       int               `mapstructure:"queueSize"`       // Buffered series; newer ones are dropped when full
+	MaxRetries      int               `mapstructure:"maxRetries"`      // Retries for 5xx, 429 and network errors
+	BearerTokenFile string            `mapstructure:"bearerTokenFile"` // Optional Authorization: Bearer token
+	Headers         map[string]string `mapstructure:"headers"`         // Extra headers, e.g. X-Scope-OrgID
+	ExternalLabels  map[string]string `mapstructure:"externalLabels"`  // Labels added to every series
+}
+
+// HTTPConfig configures the middleware chains of the HTTP surfaces.
+type HTTPConfig struct {
+	Metrics SurfaceConfig `mapstructure:"metrics"` // /metrics and /schemas/
+	Admin   SurfaceConfig `mapstructure:"admin"`   // /admin/v1/
+	UI      SurfaceConfig `mapstructure:"ui"`      // /ui/
+	API     SurfaceConfig `mapstructure:"api"`     // /api/v1/
+
+	TLS HTTPTLSConfig `mapstructure:"tls"`
+}
+
+// HTTPTLSConfig serves the HTTP surfaces over TLS when CertFile is set. With a
+// ClientCAFile, clients may present a certificate signed by one of its CAs, which
+// clientCert middleware requires (mTLS) on the surfaces it is applied to; the others keep
+// accepting clients without one, e.g. Prometheus scraping /metrics.
+type HTTPTLSConfig struct {
+	CertFile     string `mapstructure:"certFile"`
+	KeyFile      string `mapstructure:"keyFile"`
+	ClientCAFile string `mapstructure:"clientCAFile"` // PEM bundle of the CAs signing client certificates
+}
+
+// SurfaceConfig lists the middleware applied, in order, to an HTTP surface.
+type SurfaceConfig struct {
+	Middleware []MiddlewareConfig `mapstructure:"middleware"`
+}
+
+// MiddlewareConfig selects a registered middleware type and its parameters,
+// e.g. {type: "ipAllowlist", params: {cidrs: ["10.0.0.0/8"]}}.
+type MiddlewareConfig struct {
+	Type   string                 `mapstructure:"type"`
+	Params map[string]interface{} `mapstructure:"params"`
 }
 
 type KafkaConfig struct {
 	Brokers []string `mapstructure:"brokers"`
 	Topic   string   `mapstructure:"topic"`
-	GroupID string   `mapstructure:"groupID"`
+	// TopicPattern is a regular expression subscribing to every topic matching it at
+	// startup, e.g. `^features\.v1\.`, in place of Topic.
+	TopicPattern string    `mapstructure:"topicPattern"`
+	Partitions   []int     `mapstructure:"partitions"` // Consume only these partitions of every topic, assigned outside of group rebalancing
+	GroupID      string    `mapstructure:"groupID"`
+	Lag          LagConfig `mapstructure:"lag"`
+	// StartOffset seeks the consumer group at startup: "earliest", "latest" or an RFC 3339
+	// timestamp. Empty resumes from the committed offsets.
+	StartOffset string `mapstructure:"startOffset"`
+
+	RateLimit RateLimitConfig `mapstructure:"rateLimit"`
+
+	// IsolationLevel is "read_uncommitted" (default) or "read_committed", which skips the
+	// messages of aborted transactions and holds back those of open ones, for topics written
+	// by exactly-once producers.
+	IsolationLevel string            `mapstructure:"isolationLevel"`
+	Reader         KafkaReaderConfig `mapstructure:"reader"`
+}
+
+// Kafka isolation levels.
+const (
+	IsolationReadUncommitted = "read_uncommitted"
+	IsolationReadCommitted   = "read_committed"
+)
+
+// ReadCommitted reports whether messages of aborted and open transactions are skipped.
+func (k KafkaConfig) ReadCommitted() bool {
+	return k.IsolationLevel == IsolationReadCommitted
+}
+
+// KafkaReaderConfig tunes the fetch requests of the Kafka readers.
+type KafkaReaderConfig struct {
+	MinBytes int           `mapstructure:"minBytes"` // Bytes a fetch waits for, up to maxWait
+	MaxBytes int           `mapstructure:"maxBytes"` // Largest fetch response
+	MaxWait  time.Duration `mapstructure:"maxWait"`  // Longest a fetch waits for minBytes
+	// CommitInterval commits offsets asynchronously at this interval; 0 commits them
+	// synchronously. Offsets are only committed once the pipeline has drained either way.
+	CommitInterval time.Duration `mapstructure:"commitInterval"`
+}
+
+// Subscription names the consumed topics: the topic, or the topic pattern.
+func (k KafkaConfig) Subscription() string {
+	if k.TopicPattern != "" {
+		return k.TopicPattern
+	}
+	return k.Topic
+}
+
+// Seek targets besides RFC 3339 timestamps.
+const (
+	OffsetEarliest = "earliest"
+	OffsetLatest   = "latest"
+)
+
+// SeekTarget is a position in every partition of the consumed topic.
+type SeekTarget struct {
+	Earliest bool
+	Latest   bool
+	Time     time.Time // The first message at or after it, unless Earliest or Latest
+}
+
+// ParseSeekTarget parses "earliest", "latest" or an RFC 3339 timestamp.
+func ParseSeekTarget(s string) (SeekTarget, error) {
+	switch s {
+	case OffsetEarliest:
+		return SeekTarget{Earliest: true}, nil
+	case OffsetLatest:
+		return SeekTarget{Latest: true}, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return SeekTarget{}, fmt.Errorf("%w: %q", ErrInvalidSeekTarget, s)
+	}
+	return SeekTarget{Time: t}, nil
+}
+
+func (t SeekTarget) String() string {
+	switch {
+	case t.Earliest:
+		return OffsetEarliest
+	case t.Latest:
+		return OffsetLatest
+	default:
+		return t.Time.Format(time.RFC3339)
+	}
+}
+
+// LagConfig controls per-partition consumer lag monitoring. Stale feature monitoring
+// is itself an incident, so lag beyond the threshold is reported as a violation.
+type LagConfig struct {
+	Interval  time.Duration `mapstructure:"interval"`  // How often partition high watermarks are polled
+	Threshold int64         `mapstructure:"threshold"` // Messages behind per partition; 0 disables alerting
+}
+
+// RateLimitConfig caps how fast messages are consumed, so catching up on a backlog does
+// not starve other consumers of a shared cluster. Tokens refill at MessagesPerSecond up to
+// Burst, and each message handed downstream takes one.
+type RateLimitConfig struct {
+	MessagesPerSecond float64 `mapstructure:"messagesPerSecond"` // 0 consumes at unbounded speed
+	Burst             int     `mapstructure:"burst"`             // Messages consumed at once after idling; defaults to one second's worth
 }
 
 type PipelineConfig struct {
-	WindowSize time.Duration `mapstructure:"windowSize"`
+	WindowSize            time.Duration        `mapstructure:"windowSize"`
+	InternMaxEntries      int                  `mapstructure:"internMaxEntries"`      // Max distinct interned category strings
+	MaxDiscoveredFeatures int                  `mapstructure:"maxDiscoveredFeatures"` // Max features discovered via group patterns
+	MaxFeatureSeries      int                  `mapstructure:"maxFeatureSeries"`      // Distinct feature_name label values exported to Prometheus; 0 for no limit
+	MaxGroupSeries        int                  `mapstructure:"maxGroupSeries"`        // Distinct feature/group label pairs exported to Prometheus; 0 for no limit
+	InitializeSeries      bool                 `mapstructure:"initializeSeries"`      // Export configured features' gauges as NaN at startup, until their first window
+	HistoryWindows        int                  `mapstructure:"historyWindows"`        // Recent windows kept in memory per feature for the history API
+	ShutdownTimeout       time.Duration        `mapstructure:"shutdownTimeout"`       // Hard deadline for draining buffered messages and windows on shutdown
+	ParserWorkers         int                  `mapstructure:"parserWorkers"`         // Goroutines decoding raw messages concurrently; defaults to GOMAXPROCS
+	CalculatorWorkers     int                  `mapstructure:"calculatorWorkers"`     // Goroutines updating disjoint shards of the features' stats; defaults to 1
+	PartialParsing        bool                 `mapstructure:"partialParsing"`        // Decode only monitored fields; ignored when group patterns are configured
+	Format                string               `mapstructure:"format"`                // Payload format: "json" (default), "jsonl", "csv", "msgpack", "cbor" or "auto"
+	FormatHeader          string               `mapstructure:"formatHeader"`          // Header naming the payload format of each message, with the auto format
+	Batch                 BatchConfig          `mapstructure:"batch"`
+	CSV                   CSVConfig            `mapstructure:"csv"`
+	SchemaRegistry        SchemaRegistryConfig `mapstructure:"schemaRegistry"`
+	Sketches              SketchConfig         `mapstructure:"sketches"`
+	LoadShedding          LoadSheddingConfig   `mapstructure:"loadShedding"`
+	Latency               LatencyConfig        `mapstructure:"latency"`
+	EventTime             EventTimeConfig      `mapstructure:"eventTime"`
+	Throughput            ThroughputConfig     `mapstructure:"throughput"`
+	Correlations          []CorrelationConfig  `mapstructure:"correlations"`
+	DerivedFields         []DerivedFieldConfig `mapstructure:"derivedFields"`
+	Scaling               ScalingConfig        `mapstructure:"scaling"`
+	WindowState           WindowStateConfig    `mapstructure:"windowState"`
+	Sessions              SessionConfig        `mapstructure:"sessions"`
+	VersionField          string               `mapstructure:"versionField"` // Message field holding the model/pipeline version; splits every feature's statistics by version
+	TenantField           string               `mapstructure:"tenantField"`  // Message field naming the tenant of each message; tenant features only aggregate their own
+
+	// Filter is a condition over parsed message fields, e.g. `env == "prod"`, scoping the
+	// monitored traffic on shared topics; messages it is not true for are dropped.
+	Filter string `mapstructure:"filter"`
+
+	// Script transforms every decoded message before the filter, derived fields and
+	// aggregation, e.g. to rename fields, unpack encoded payloads or compute values.
+	Script []ScriptStepConfig `mapstructure:"script"`
+
+	// Graph adds filter, script and calculator stages fed by the parser, so some features
+	// can be computed on their own subset or transform of the traffic.
+	Graph GraphConfig `mapstructure:"graph"`
+
+	// ValueSamples keeps a uniform sample of every feature's values per window, shown by
+	// the admin API and optionally in violations, so responders can see example values.
+	ValueSamples ValueSamplesConfig `mapstructure:"valueSamples"`
+
+	// Exemplars traces windows back to the requests their messages came from: the trace
+	// IDs a message field carries are sampled per feature and window, and attached to
+	// results, violations and the violation counters.
+	Exemplars ExemplarsConfig `mapstructure:"exemplars"`
+
+	// Metadata sources message fields from the Kafka message key and headers, which many
+	// producers use for entity IDs and schema hints, so they can be monitored or grouped by.
+	Metadata MetadataConfig `mapstructure:"metadata"`
+
+	// Coercion reads values producers send with another type than the pipeline expects,
+	// e.g. numbers as strings or timestamps in a local format, since heterogeneous
+	// producers rarely agree on types.
+	Coercion CoercionConfig `mapstructure:"coercion"`
+
+	// SchemaTracking fingerprints the fields and value types of each window's messages and
+	// alerts when they change, before value-level metrics degrade.
+	SchemaTracking SchemaTrackingConfig `mapstructure:"schemaTracking"`
+
+	// PartitionStats computes features' null rates and means per Kafka partition and
+	// alerts when one partition diverges from the others, which usually points at a single
+	// bad producer instance.
+	PartitionStats PartitionStatsConfig `mapstructure:"partitionStats"`
+
+	// WindowAlignment places window boundaries on the wall clock and sets how long after
+	// its end a window is flushed.
+	WindowAlignment WindowAlignmentConfig `mapstructure:"windowAlignment"`
+
+	// Rollups are coarser resolutions, e.g. 5m and 1h, that each feature's windows are
+	// rolled up into and exported at alongside them, for smooth trend panels next to fast
+	// alerts. Each must be a multiple of windowSize.
+	Rollups []time.Duration `mapstructure:"rollups"`
 }
 
-type FeatureConfig struct {
-	Name       string     `mapstructure:"name"`
-	MetricType string     `mapstructure:"metricType"` // e.g., "numerical", "categorical"
-	Thresholds Thresholds `mapstructure:"thresholds"`
+// WindowAlignmentConfig aligns windows to clean time buckets. Windows start at multiples
+// of windowSize, counted from midnight UTC (or of TimeZone) for sizes dividing a day
+// (e.g. :00, :05, :10 for 5m windows), shifted by Offset. Windows are flushed FlushGrace after they end,
+// rather than a windowSize after the previous flush, so results are emitted at the same
+// point of every bucket regardless of when the instance started.
+type WindowAlignmentConfig struct {
+	Offset     time.Duration `mapstructure:"offset"`     // Shifts boundaries, e.g. "-9h" for daily windows starting at midnight UTC+9
+	FlushGrace time.Duration `mapstructure:"flushGrace"` // Delay between a window's end and its flush
+
+	// TimeZone is the IANA time zone, e.g. "Asia/Seoul", whose wall clock boundaries are
+	// counted on, for calendar-based features such as daily windows starting at local
+	// midnight. Windows spanning a daylight saving time change last an hour more or less
+	// than windowSize. Empty for UTC.
+	TimeZone string         `mapstructure:"timeZone"`
+	Location *time.Location `mapstructure:"-"` // Of TimeZone, set at load; nil for UTC
 }
 
-type LogConfig struct {
-	Level              string `mapstructure:"level"`
-	Format             string `mapstructure:"format"`
-	FileLoggingEnabled bool   `mapstructure:"fileLoggingEnabled"`
-	Directory          string `mapstructure:"directory"`
-	Filename           string `mapstructure:"filename"`
-	MaxSize            int    `mapstructure:"maxSize"`    // Max size in MB
-	MaxBackups         int    `mapstructure:"maxBackups"` // Max backup files
-	MaxAge             int    `mapstructure:"maxAge"`     // Max days to retain
-	Compress           bool   `mapstructure:"compress"`   // Compress rotated files?
+// WindowStateConfig bounds the memory held by the running aggregates of open windows.
+// Past the budget, the least recently updated feature and segment stats are spilled to
+// files in SpillDirectory and read back when updated again or when their window closes.
+type WindowStateConfig struct {
+	MaxMemoryMB    int    `mapstructure:"maxMemoryMB"`    // Estimated in-memory size of window state; 0 for no limit
+	SpillDirectory string `mapstructure:"spillDirectory"` // Local directory for spilled state, emptied at startup
 }
 
-type Thresholds struct {
-	NullRate  *float64 `mapstructure:"nullRate"`
-	MeanMin   *float64 `mapstructure:"meanMin"`
-	MeanMax   *float64 `mapstructure:"meanMax"`
-	StdDevMin *float64 `mapstructure:"stdDevMin"`
-	StdDevMax *float64 `mapstructure:"stdDevMax"`
+// ScalingConfig runs several instances in the same consumer group, each aggregating the
+// partitions the group assigns to it. Instances publish their partial windows to a
+// coordination topic, and the merger instance combines them before evaluating checks, so
+// thresholds apply to the global window. Replays are not scaled out.
+type ScalingConfig struct {
+	Enabled      bool          `mapstructure:"enabled"`
+	Topic        string        `mapstructure:"topic"`        // Coordination topic, on the brokers consumed from
+	Instances    int           `mapstructure:"instances"`    // Instances publishing partials; a window is merged once all of them did
+	Merger       bool          `mapstructure:"merger"`       // Merge partials and evaluate checks; set on exactly one instance
+	InstanceID   string        `mapstructure:"instanceID"`   // Identifies the instance's partials; defaults to the hostname
+	MergeTimeout time.Duration `mapstructure:"mergeTimeout"` // How long the merger waits for missing partials after a window's first one; 0 waits one window size
 }
 
-// Load initializes viper, reads config, applies defaults, unmarshals, and validates.
-func Load(configPath string) (*Config, error) {
-	v := viper.New()
-	configureViper(v, configPath)
+// Payload formats of consumed messages.
+const (
+	FormatJSON      = "json"  // One JSON object per message
+	FormatJSONLines = "jsonl" // Newline-delimited JSON objects, one per line
+	FormatCSV       = "csv"   // CSV rows, one per line
+	FormatMsgPack   = "msgpack"
+	FormatCBOR      = "cbor"
+	FormatAuto      = "auto" // Detected per message, from its format header or leading bytes
+)
 
-	// Set default values before reading config source .yaml
-	setDefaults(v)
+// SchemaRegistryConfig connects to a Confluent Schema Registry, which the auto format looks
+// up the schemas of payloads in its wire format in: Avro, Protobuf or JSON, framed by a
+// zero magic byte and the schema's ID.
+type SchemaRegistryConfig struct {
+	URL      string        `mapstructure:"url"`      // e.g. http://schema-registry:8081; framed payloads fail to decode without it
+	Username string        `mapstructure:"username"` // Optional HTTP basic auth
+	Password string        `mapstructure:"password"`
+	Timeout  time.Duration `mapstructure:"timeout"` // Per schema lookup
+}
 
-	// Read configuration from file (error if mandatory file is missing)
-	if err := readConfigFile(v); err != nil {
-		return nil, err
+// CSVConfig maps the cells of CSV payloads to field names.
+type CSVConfig struct {
+	Columns   []string `mapstructure:"columns"`   // Field names by cell position
+	Header    bool     `mapstructure:"header"`    // Each payload starts with a header row, naming columns when Columns is empty
+	Delimiter string   `mapstructure:"delimiter"` // Single character separating cells
+}
+
+// Units of numeric event timestamps (since the Unix epoch).
+const (
+	TimestampUnitSeconds      = "s"
+	TimestampUnitMilliseconds = "ms"
+	TimestampUnitMicroseconds = "us"
+	TimestampUnitNanoseconds  = "ns"
+	// TimestampUnitAuto tells the unit by magnitude, for producers disagreeing on it:
+	// seconds below 1e11 (year 5138), then milliseconds, microseconds and nanoseconds.
+	TimestampUnitAuto = "auto"
+)
+
+// Policies for late messages, whose event-time window was already flushed.
+const (
+	LatePolicyDrop       = "drop"       // Count and discard them
+	LatePolicyReemit     = "reemit"     // Reopen their window and emit it again, corrected
+	LatePolicyAccumulate = "accumulate" // Aggregate them into a late bucket of the window in progress
+)
+
+// EventTimeConfig assigns messages to windows by their event timestamp, read from
+// pipeline.latency.timestampField, instead of their processing time. A window is flushed
+// once the watermark, the latest event timestamp seen less AllowedLateness, passes its
+// end; messages of windows flushed before are late and handled by LatePolicy.
+type EventTimeConfig struct {
+	Enabled         bool          `mapstructure:"enabled"`
+	AllowedLateness time.Duration `mapstructure:"allowedLateness"` // How far behind the latest event timestamp a message may be without being late
+	LatePolicy      string        `mapstructure:"latePolicy"`      // "drop" (default), "reemit" or "accumulate"
+	Retention       time.Duration `mapstructure:"retention"`       // How long flushed windows can be reopened with latePolicy reemit
+}
+
+// LatencyConfig measures end-to-end latency: the delay between a message's event
+// timestamp and the time FeatureLens processes it, aggregated per window.
+type LatencyConfig struct {
+	TimestampField string   `mapstructure:"timestampField"` // Message field holding the event time; empty disables
+	TimestampUnit  string   `mapstructure:"timestampUnit"`  // Unit of numeric timestamps: "s", "ms", "us", "ns" or "auto"; strings are parsed as RFC 3339
+	MeanMax        *float64 `mapstructure:"meanMax"`        // Seconds
+	P95Max         *float64 `mapstructure:"p95Max"`         // Seconds
+
+	// Event timestamp ordering. A timestamp more than FutureTolerance ahead of the
+	// processing time is future-dated; one more than OutOfOrderTolerance behind the latest
+	// timestamp seen so far is out of order. Rates are shares of the timestamped messages.
+	FutureTolerance     time.Duration `mapstructure:"futureTolerance"`
+	OutOfOrderTolerance time.Duration `mapstructure:"outOfOrderTolerance"`
+	FutureRateMax       *float64      `mapstructure:"futureRateMax"`
+	OutOfOrderRateMax   *float64      `mapstructure:"outOfOrderRateMax"`
+}
+
+// ThroughputConfig bounds the number of messages processed per window. Windows without
+// any message are checked too, so a stream that stops entirely alerts. Checks are
+// disabled while no bound is set.
+type ThroughputConfig struct {
+	Min           *float64 `mapstructure:"min"`
+	Max           *float64 `mapstructure:"max"`
+	ChangeMax     *float64 `mapstructure:"changeMax"`     // Relative change from the mean of the recent windows, in either direction, e.g. 0.5
+	RecentWindows int      `mapstructure:"recentWindows"` // Windows averaged as the reference for changeMax
+	NoDataWindows int      `mapstructure:"noDataWindows"` // Consecutive windows without any message before a no_data violation; 0 disables
+
+	Completeness CompletenessConfig `mapstructure:"completeness"`
+}
+
+// CompletenessConfig compares every window's message count with the volume expected of
+// it, configured or learned from the recent complete windows, so data partially missing
+// (some producers or partitions stopped) is told apart from a topic gone empty. Disabled
+// while neither expected nor min is set.
+type CompletenessConfig struct {
+	Expected     *float64 `mapstructure:"expected"`     // Messages expected per window; unset learns it
+	LearnWindows int      `mapstructure:"learnWindows"` // Complete windows whose median count is the learned expectation
+	Min          *float64 `mapstructure:"min"`          // Completeness ratio below which a window alerts, e.g. 0.8
+}
+
+// Enabled reports whether window completeness is computed.
+func (c CompletenessConfig) Enabled() bool {
+	return c.Expected != nil || c.Min != nil
+}
+
+// CorrelationConfig bounds the Pearson correlation of two numerical message fields within
+// a window, e.g. a model score and the feature it mostly depends on. A correlation break
+// between fields that normally move together often means a broken join upstream.
+type CorrelationConfig struct {
+	Name     string   `mapstructure:"name"`
+	Features []string `mapstructure:"features"` // Exactly two fields
+	Min      *float64 `mapstructure:"min"`
+	Max      *float64 `mapstructure:"max"`
+	MinCount int      `mapstructure:"minCount"` // Messages holding both values before the bounds are checked
+}
+
+// Script step operations.
+const (
+	ScriptRename = "rename" // Move Field to To
+	ScriptSet    = "set"    // Set Field to the value of Expr
+	ScriptDelete = "delete" // Remove Field
+	ScriptUnpack = "unpack" // Merge the object encoded in Field into the message, keys prefixed with Prefix
+	ScriptLua    = "lua"    // Run the transform(msg) function of a Lua script, from Code or File
+)
+
+// Encodings of the objects unpacked by script steps.
+const (
+	EncodingJSON   = "json"   // A JSON object, or a string holding one
+	EncodingBase64 = "base64" // A string holding a base64-encoded JSON object
+)
+
+// ScriptStepConfig is one step of the message script. Steps run in order on each message;
+// with When, only on the messages the condition is true for. Expressions use the language
+// of conditions with message fields as identifiers.
+type ScriptStepConfig struct {
+	Op       string `mapstructure:"op"`
+	Field    string `mapstructure:"field"`    // Every op but lua
+	To       string `mapstructure:"to"`       // rename
+	Expr     string `mapstructure:"expr"`     // set
+	Encoding string `mapstructure:"encoding"` // unpack: "json" (default) or "base64"
+	Prefix   string `mapstructure:"prefix"`   // unpack, e.g. "payload_"
+	When     string `mapstructure:"when"`
+
+	// Lua steps run a script defining transform(msg), given inline as Code or read from
+	// File, for at most Timeout per message (default 100ms); see package luascript.
+	Code    string        `mapstructure:"code"`
+	File    string        `mapstructure:"file"`
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+// LuaSource returns the script of a lua step and the name it is known by in errors: its
+// file, or "script" for inline code.
+func (s ScriptStepConfig) LuaSource() (name, source string, err error) {
+	if s.File == "" {
+		return "script", s.Code, nil
+	}
+	data, err := os.ReadFile(s.File)
+	if err != nil {
+		return "", "", fmt.Errorf("%w: %w", ErrInvalidScript, err)
 	}
+	return s.File, string(data), nil
+}
 
-	// Unmarshal the configuration
-	var cfg Config
-	if err := v.Unmarshal(&cfg); err != nil {
-		return nil, fmt.Errorf("%w: %w", ErrUnmarshallingConfig, err)
+// Graph stage types.
+const (
+	StageFilter     = "filter"     // Forward the messages Filter is true for
+	StageScript     = "script"     // Transform messages with Script, then forward them
+	StageCalculator = "calculator" // Compute the windows of the features matching Features
+)
+
+// GraphSource is the input of the stages reading the parser's output: the decoded
+// messages after the pipeline's script, filter and derived fields.
+const GraphSource = "parser"
+
+// GraphConfig is a graph of stages fed by the parser. Filter and script stages forward
+// the messages they keep to the stages naming them as input; calculator stages compute
+// the windows of the features they claim from their input, and their results are checked
+// like the main calculator's. The main calculator still reads the parser's output: it
+// computes every feature no stage claims and the pipeline-level latency, throughput and
+// correlations.
+type GraphConfig struct {
+	Stages []GraphStageConfig `mapstructure:"stages"`
+}
+
+// GraphStageConfig is one stage of the graph, e.g. a filter of premium traffic feeding a
+// calculator of the features only monitored for it.
+type GraphStageConfig struct {
+	Name     string             `mapstructure:"name"`
+	Type     string             `mapstructure:"type"`
+	Input    string             `mapstructure:"input"`    // "parser", or the name of a filter or script stage
+	Filter   string             `mapstructure:"filter"`   // filter: condition over message fields
+	Script   []ScriptStepConfig `mapstructure:"script"`   // script
+	Features []string           `mapstructure:"features"` // calculator: globs matched against feature and group names
+}
+
+// Claims reports whether a calculator stage computes a feature.
+func (s GraphStageConfig) Claims(f FeatureConfig) bool {
+	if s.Type != StageCalculator {
+		return false
+	}
+	for _, pattern := range s.Features {
+		if matched, _ := path.Match(pattern, f.Name); matched {
+			return true
+		}
+		if f.Group != "" {
+			if matched, _ := path.Match(pattern, f.Group); matched {
+				return true
+			}
+		}
 	}
+	return false
+}
 
-	if err := validateConfig(&cfg); err != nil {
-		return nil, err
+// Calculators returns the graph's calculator stages.
+func (g GraphConfig) Calculators() []GraphStageConfig {
+	var stages []GraphStageConfig
+	for _, s := range g.Stages {
+		if s.Type == StageCalculator {
+			stages = append(stages, s)
+		}
 	}
+	return stages
+}
 
-	return &cfg, nil
+// ValueSamplesConfig bounds the value samples kept per feature and window. Samples hold
+// raw values, so they are disabled by default for payloads that may carry personal data.
+type ValueSamplesConfig struct {
+	Size         int  `mapstructure:"size"`         // Values sampled per feature and window; 0 disables sampling
+	MaxLength    int  `mapstructure:"maxLength"`    // Characters kept of each value
+	InViolations bool `mapstructure:"inViolations"` // Include the samples in violation notifications
 }
 
-// configureViper sets up viper instance for file and environment variables.
-func configureViper(v *viper.Viper, configPath string) {
-	if configPath != "" {
-		v.SetConfigFile(configPath)
-	}
+// ExemplarsConfig names the message field holding each message's trace or correlation ID,
+// e.g. a W3C trace ID or traceparent, and bounds the IDs kept per feature and window.
+type ExemplarsConfig struct {
+	TraceField string `mapstructure:"traceField"` // Empty disables exemplars
+	Size       int    `mapstructure:"size"`       // IDs sampled per feature and window, of messages with a value and of those without each
+}
 
-	v.SetEnvPrefix(envPrefix)
-	v.AutomaticEnv()
-	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_", "-", "_"))
+// Types of the message fields sourced from keys and headers.
+const (
+	MetadataString = "string" // The raw bytes as a string
+	MetadataAuto   = "auto"   // Typed like CSV cells: numbers, booleans, null when empty, else strings
+)
+
+// MetadataConfig sets message fields from the Kafka message key and headers before the
+// script runs, replacing payload fields of the same name. A field whose key or header is
+// absent is left as decoded.
+type MetadataConfig struct {
+	Key     MetadataFieldConfig   `mapstructure:"key"` // Header is ignored
+	Headers []MetadataFieldConfig `mapstructure:"headers"`
 }
 
-// setDefaults applies default configuration values using Viper.
-func setDefaults(v *viper.Viper) {
-	v.SetDefault("kafka.groupID", defaultKafkaGroupID)
-	v.SetDefault("pipeline.windowSize", defaultPipelineWindow)
-	v.SetDefault("log.level", defaultLogLevel)
-	v.SetDefault("log.format", defaultLogFormat)
-	v.SetDefault("log.fileLoggingEnabled", defaultLogFileEnabled)
-	v.SetDefault("log.directory", defaultLogDirectory)
-	v.SetDefault("log.filename", defaultLogFilename)
-	v.SetDefault("log.maxSize", defaultLogMaxSizeMB)
-	v.SetDefault("log.maxBackups", defaultLogMaxBackups)
-	v.SetDefault("log.maxAge", defaultLogMaxAgeDays)
-	v.SetDefault("log.compress", defaultLogCompress)
+// MetadataFieldConfig is one message field sourced from the key or a header.
+type MetadataFieldConfig struct {
+	Header string `mapstructure:"header"` // Header name, matched exactly; the first of repeated headers wins
+	Field  string `mapstructure:"field"`  // Message field to set; empty leaves the key unused
+	Type   string `mapstructure:"type"`   // "string" (default) or "auto"
 }
 
-// readConfigFile attempts to read the configuration file specified in viper.
-func readConfigFile(v *viper.Viper) error {
-	err := v.ReadInConfig()
-	if err != nil {
-		var configFileNotFoundError viper.ConfigFileNotFoundError
-		if errors.As(err, &configFileNotFoundError) {
-			return ErrConfigFileMissing
+// CoercionConfig converts values after decoding, before the script runs. Numeric strings
+// are converted in the fields read as numbers: those of numerical and latency features,
+// correlations and session fields; other strings are left as sent, so codes such as
+// "00123" stay categorical. Timestamps are converted in pipeline.latency.timestampField.
+type CoercionConfig struct {
+	NumericStrings   bool     `mapstructure:"numericStrings"`   // Read strings such as "42.5" or "1,234.5" as numbers
+	DecimalSeparator string   `mapstructure:"decimalSeparator"` // "." (default) or ","; the other one groups thousands, as do spaces and apostrophes
+	TimeFormats      []string `mapstructure:"timeFormats"`      // Go layouts tried after RFC 3339, e.g. "02/01/2006 15:04:05"; zoneless ones are UTC
+}
+
+// Enabled reports whether any value is converted.
+func (c CoercionConfig) Enabled() bool {
+	return c.NumericStrings || len(c.TimeFormats) > 0
+}
+
+// SchemaTrackingConfig tracks the schema of the messages: each field's value types. A field
+// or type enters a window's schema once it appears in at least MinShare of its messages
+// and leaves it once it no longer appears at all, so rare optional fields do not flap.
+// Windows without messages keep the previous schema.
+type SchemaTrackingConfig struct {
+	Enabled      bool     `mapstructure:"enabled"`
+	MinShare     float64  `mapstructure:"minShare"`     // Share of a window's messages a field or type must appear in to be added, default 0.01
+	MaxFields    int      `mapstructure:"maxFields"`    // Distinct fields tracked per window, default 1000; further ones are ignored
+	IgnoreFields []string `mapstructure:"ignoreFields"` // Glob patterns of fields left out, e.g. "debug_*"
+}
+
+// PartitionStatsConfig compares features' window statistics across the Kafka partitions
+// their messages were consumed from. Each partition with at least MinMessages messages in
+// a window is compared with the median of the other such partitions. Replayed messages
+// have no partition and are not counted.
+type PartitionStatsConfig struct {
+	Enabled       bool     `mapstructure:"enabled"`
+	Features      []string `mapstructure:"features"`      // Features compared, default every feature read from a single field of the messages
+	MinMessages   int64    `mapstructure:"minMessages"`   // Messages a partition needs in a window to be compared, default 100
+	NullRateRatio float64  `mapstructure:"nullRateRatio"` // Alert when a partition's null rate exceeds this multiple of the others', default 10
+	MinNullRate   float64  `mapstructure:"minNullRate"`   // Floor of the others' null rate in the ratio, so clean partitions are not divided by zero, default 0.01
+	MeanDeviation *float64 `mapstructure:"meanDeviation"` // Alert when a numerical feature's mean is further from the others' than this many of their standard deviations; unset to not compare means
+}
+
+// DerivedFieldConfig computes a message field from other fields before aggregation, e.g.
+// a ratio `feature_a / feature_b` or a length `len(feature_c)`, so combinations can be
+// monitored without changing producers. The expression uses the language of conditions
+// with message fields as identifiers. Derived fields are computed in order, so later ones
+// may use earlier ones, and are monitored by listing them under features.
+type DerivedFieldConfig struct {
+	Name string `mapstructure:"name"`
+	Expr string `mapstructure:"expr"`
+}
+
+// BatchConfig groups consumed messages into batches handed from stage to stage, so channel
+// operations and goroutine wake-ups are paid per batch rather than per message.
+type BatchConfig struct {
+	Size   int           `mapstructure:"size"`   // Messages per batch; 1 hands off every message on its own
+	Linger time.Duration `mapstructure:"linger"` // Longest a fetched message waits for its batch to fill
+}
+
+// LoadSheddingConfig samples non-critical features harder while the calculator falls behind,
+// measured by how full its input buffer is, or while the process's heap memory or consumer
+// lag exceed their limits. Critical features are never shed.
+type LoadSheddingConfig struct {
+	Enabled       bool    `mapstructure:"enabled"`
+	HighWatermark float64 `mapstructure:"highWatermark"` // Input buffer fill fraction that starts shedding
+	LowWatermark  float64 `mapstructure:"lowWatermark"`  // Input buffer fill fraction that stops shedding
+	NormalRate    float64 `mapstructure:"normalRate"`    // Fraction of sampled messages kept for normal-priority features while shedding
+	LowRate       float64 `mapstructure:"lowRate"`       // Fraction of sampled messages kept for low-priority features while shedding; 0 drops them
+	MaxHeapMB     int     `mapstructure:"maxHeapMB"`     // Heap memory in use that also starts shedding; 0 for no limit
+	MaxLag        int64   `mapstructure:"maxLag"`        // Consumer lag, in messages, that also starts shedding; 0 for no limit
+}
+
+// SketchConfig adds mergeable sketches of each window's values to emitted results, so
+// offline jobs can combine windows into arbitrary ranges: quantiles for numerical
+// features, cardinality and frequencies for categorical ones.
+type SketchConfig struct {
+	Enabled          bool    `mapstructure:"enabled"`
+	RelativeAccuracy float64 `mapstructure:"relativeAccuracy"` // Quantile error relative to the value, in (0, 1)
+	Precision        int     `mapstructure:"precision"`        // HyperLogLog registers as a power of two, 4..18
+	FrequencyWidth   int     `mapstructure:"frequencyWidth"`   // Count-min counters per row
+	FrequencyDepth   int     `mapstructure:"frequencyDepth"`   // Count-min rows
+}
+
+// RegexPatternPrefix marks a feature pattern as a regular expression instead of a glob.
+const RegexPatternPrefix = "regex:"
+
+// FeatureConfig describes a monitored feature. An entry with Pattern or Members is a
+// named group: its settings apply to every matching (or listed) message field.
+type FeatureConfig struct {
+	Name         string            `mapstructure:"name"`
+	Pattern      string            `mapstructure:"pattern"`    // Glob (e.g. "price_*") or "regex:<expr>" matched against message fields
+	Members      []string          `mapstructure:"members"`    // Explicit field names sharing this entry's settings
+	Group        string            `mapstructure:"-"`          // Group the feature was instantiated from, set at load/discovery
+	MetricType   string            `mapstructure:"metricType"` // e.g., "numerical", "categorical", "text", "vector", "latency"
+	Thresholds   Thresholds        `mapstructure:"thresholds"`
+	ValuePattern string            `mapstructure:"valuePattern"` // Regular expression valid string values match, e.g. "^usr_[0-9a-f]{16}$"
+	Conditions   []ConditionConfig `mapstructure:"conditions"`
+	Sampling     SamplingConfig    `mapstructure:"sampling"`
+	Priority     string            `mapstructure:"priority"`  // "critical", "normal" (default) or "low"; governs load shedding
+	MinCount     int               `mapstructure:"minCount"`  // Minimum observations in a window before checks run
+	DependsOn    []string          `mapstructure:"dependsOn"` // Upstream features this feature is derived from
+	Tags         map[string]string `mapstructure:"tags"`      // Metadata (e.g. team, tier) used to select features in bulk
+	Skew         SkewThresholds    `mapstructure:"skew"`
+	Field        string            `mapstructure:"field"`  // Message field holding the values; defaults to the name, without tenant prefix
+	Topics       []string          `mapstructure:"topics"` // Globs of the topics whose messages the feature aggregates; empty for every topic
+	Scope        string            `mapstructure:"scope"`  // "message" (default) or "session"
+
+	// NoDataWindows raises a no_data violation once the feature has had no non-null
+	// observation for this many consecutive windows, e.g. after its producer died or its
+	// key was renamed upstream; 0 disables the check.
+	NoDataWindows int `mapstructure:"noDataWindows"`
+
+	// ExpectedType declares the JSON type of the feature's values: "number", "string",
+	// "bool" or "array". Non-null values of another type count as type mismatches, and
+	// categorical features with bool or number values count them by their JSON text.
+	// Empty accepts whatever the metric type can read. Strict raises a type_mismatch
+	// violation for every window with type mismatches, whatever typeMismatchRateMax.
+	ExpectedType string `mapstructure:"expectedType"`
+	Strict       bool   `mapstructure:"strict"`
+
+	// Enabled turns monitoring of the feature off when false, e.g. while its producer is
+	// being migrated, without removing its settings. Disabled features are validated like
+	// the others, then dropped when the configuration is loaded.
+	Enabled *bool `mapstructure:"enabled"`
+	// Mode is "enforce" (default) or "canary". Checks of canary features run and their
+	// violations are logged, audited and counted in
+	// featurelens_feature_canary_violations_total, but never notify sinks, trigger actions
+	// or fire alerts, so new thresholds can be trialled before they are enforced.
+	Mode string `mapstructure:"mode"`
+
+	// Ownership and context carried by the feature's violations and alerts, and served by
+	// the admin API, so pages reach the people responsible with what they need to act.
+	Owner       string `mapstructure:"owner"`       // Person or on-call rotation responsible, e.g. "alice@example.com"
+	Team        string `mapstructure:"team"`        // Owning team, e.g. "ranking"; also a label of featurelens_feature_info
+	RunbookURL  string `mapstructure:"runbookUrl"`  // Absolute http(s) URL of the feature's runbook
+	Description string `mapstructure:"description"` // What the feature is and what its consumers rely on
+
+	// Tenant namespaces the feature for one of the teams sharing the instance: its name
+	// becomes <tenant>.<name>, prefixing its Prometheus series and payloads, and dependsOn
+	// names features of the same tenant. With pipeline.tenantField, the feature only
+	// aggregates the messages of its tenant.
+	Tenant string `mapstructure:"tenant"`
+
+	// Vector features (embeddings). Dimensions is the expected length of every vector, 0 to
+	// take the length of the first vector observed. BaselineCentroid is the direction
+	// centroid distances are measured from; when empty, the mean vector of the feature's
+	// first window is used.
+	Dimensions       int       `mapstructure:"dimensions"`
+	BaselineCentroid []float64 `mapstructure:"baselineCentroid"`
+
+	// GroupBy names a message field (e.g. "country", "model_version") whose values split
+	// the feature's statistics into per-group segments, in addition to the overall ones.
+	GroupBy         string                `mapstructure:"groupBy"`
+	GroupThresholds map[string]Thresholds `mapstructure:"groupThresholds"` // Replace Thresholds for specific groups (keys are case-insensitive)
+	MaxGroups       int                   `mapstructure:"maxGroups"`       // Distinct groups tracked before further values share the "__other__" segment
+
+	// Seasonal compares each window with the same window a day or a week earlier, for
+	// features whose normal values follow the time of day or the day of week.
+	Seasonal SeasonalThresholds `mapstructure:"seasonal"`
+
+	// Outliers counts the values of numerical and latency features falling outside
+	// bounds around the bulk of the distribution, reported as the window's outlier rate
+	// and bounded by thresholds.outlierRateMax, catching fat-tail corruption that barely
+	// shifts the mean.
+	Outliers *OutlierConfig `mapstructure:"outliers"`
+
+	// WindowSize aggregates the feature over windows of its own, e.g. 1h for a slow batch
+	// feature next to 1m windows of the others; 0 uses pipeline.windowSize. It must be a
+	// multiple of pipeline.windowSize, so its windows end, and are flushed, on pipeline
+	// window boundaries.
+	WindowSize time.Duration `mapstructure:"windowSize"`
+
+	// CustomMetrics and CustomChecks enable extensions compiled into the binary: metrics
+	// computed from each window's statistics, exported and available to conditions under
+	// their name, and checks raising violations of type custom:<name>.
+	CustomMetrics []ExtensionConfig `mapstructure:"customMetrics"`
+	CustomChecks  []ExtensionConfig `mapstructure:"customChecks"`
+}
+
+// ExtensionConfig enables a custom metric or check of a registered type.
+type ExtensionConfig struct {
+	Name   string                 `mapstructure:"name"` // Variable and check name; defaults to the type
+	Type   string                 `mapstructure:"type"`
+	Params map[string]interface{} `mapstructure:"params"`
+}
+
+// ExtensionName returns the name of a custom metric or check.
+func (e ExtensionConfig) ExtensionName() string {
+	if e.Name != "" {
+		return e.Name
+	}
+	return e.Type
+}
+
+// TracksDistinct reports whether the feature, or one of its groups, has distinct value
+// thresholds.
+func (f FeatureConfig) TracksDistinct() bool {
+	if t := f.Thresholds.Effective(); t.DistinctMin != nil || t.DistinctMax != nil {
+		return true
+	}
+	for _, t := range f.GroupThresholds {
+		if t = t.Effective(); t.DistinctMin != nil || t.DistinctMax != nil {
+			return true
 		}
-		return fmt.Errorf("%w: %w", ErrReadingConfigFile, err)
 	}
-	return nil
+	return false
 }
 
-func validateConfig(cfg *Config) error {
-	if len(cfg.Kafka.Brokers) == 0 {
-		return ErrEmptyKafkaBrokers
+// Window returns the size of the feature's windows, pipelineWindow unless overridden.
+func (f FeatureConfig) Window(pipelineWindow time.Duration) time.Duration {
+	if f.WindowSize > 0 {
+		return f.WindowSize
 	}
-	if cfg.Kafka.Topic == "" {
-		return ErrEmptyKafkaTopic
+	return pipelineWindow
+}
+
+// Outlier rules and the windows their bounds are computed from.
+const (
+	OutlierIQR               = "iqr"      // Outside [Q1 - k·IQR, Q3 + k·IQR]
+	OutlierZScore            = "zscore"   // Further than k standard deviations from the mean
+	OutlierReferenceWindow   = "window"   // Bounds of the window itself
+	OutlierReferenceBaseline = "baseline" // Bounds of the feature's last window within outlierRateMax
+)
+
+// OutlierConfig sets how a feature's outliers are counted. Values are counted from the
+// window's quantile sketch, so within its relative accuracy.
+type OutlierConfig struct {
+	Method    string  `mapstructure:"method"`    // "iqr" (default) or "zscore"
+	K         float64 `mapstructure:"k"`         // Bound multiplier; defaults to 1.5 for iqr, 3 for zscore
+	Reference string  `mapstructure:"reference"` // "window" (default) or "baseline"
+}
+
+// Factor returns the bound multiplier, the method's default when unset.
+func (o OutlierConfig) Factor() float64 {
+	switch {
+	case o.K > 0:
+		return o.K
+	case o.Method == OutlierZScore:
+		return 3
+	default:
+		return 1.5
 	}
-	if cfg.Kafka.GroupID == "" {
-		return ErrEmptyKafkaGroupID
+}
+
+// FieldName returns the message field holding the feature's values.
+func (f FeatureConfig) FieldName() string {
+	if f.Field != "" {
+		return f.Field
 	}
-	if cfg.Pipeline.WindowSize <= 0 {
-		return ErrInvalidPipelineWindowSize
+	return f.Name
+}
+
+// SkewConfig enables training/serving skew comparison. The serving stream is the main
+// Kafka topic; the reference is either a second topic, compared over aligned windows,
+// or a static baseline snapshot.
+type SkewConfig struct {
+	Enabled        bool   `mapstructure:"enabled"`
+	ReferenceTopic string `mapstructure:"referenceTopic"` // Training/offline topic on the same brokers
+	BaselineFile   string `mapstructure:"baselineFile"`   // JSON lines file of reference messages, instead of a topic
+	Bins           int    `mapstructure:"bins"`           // Quantile bins for numerical distributions
+	MaxSamples     int    `mapstructure:"maxSamples"`     // Reservoir size per feature, side and window
+}
+
+// SkewThresholds bound the distribution distance between serving and reference data.
+type SkewThresholds struct {
+	PSIMax          *float64 `mapstructure:"psiMax"`          // Population stability index
+	JSDivergenceMax *float64 `mapstructure:"jsDivergenceMax"` // Jensen-Shannon divergence (base 2, 0..1)
+	MeanDeltaMax    *float64 `mapstructure:"meanDeltaMax"`    // Absolute difference of means, numerical only
+
+	// ChiSquarePValueMin alerts when Pearson's chi-squared goodness-of-fit test rejects
+	// the reference category distribution at this significance level, e.g. 0.001.
+	// Categorical only. Large windows detect small shifts, so prefer low levels.
+	ChiSquarePValueMin *float64 `mapstructure:"chiSquarePValueMin"`
+}
+
+// SeasonalThresholds bound the relative change of a feature's window from the same window
+// one or more periods earlier, e.g. 24h and 168h, so daily and weekly seasonality does not
+// trip static thresholds. Changes are in either direction, e.g. 0.2 for ±20%. With several
+// periods, a window only violates when it is outside the tolerance of every period's
+// window, and is reported against the closest one.
+type SeasonalThresholds struct {
+	Periods        []time.Duration `mapstructure:"periods"` // Multiples of the window size
+	CountChange    *float64        `mapstructure:"countChange"`
+	NullRateChange *float64        `mapstructure:"nullRateChange"`
+	MeanChange     *float64        `mapstructure:"meanChange"` // Numerical only
+}
+
+// Metric types of features, selecting the statistics computed for their values.
+const (
+	MetricTypeNumerical   = "numerical"
+	MetricTypeCategorical = "categorical"
+	MetricTypeText        = "text"
+	MetricTypeVector      = "vector"  // Arrays of numbers, e.g. embeddings
+	MetricTypeLatency     = "latency" // Durations in milliseconds, numerical with percentiles
+	MetricTypeBoolean     = "boolean" // Flags, e.g. is_verified, monitored by their true rate
+)
+
+// Feature scopes, selecting what a feature aggregates.
+const (
+	ScopeMessage = "message" // Message fields (default)
+	ScopeSession = "session" // Fields of closed session summaries, see SessionConfig
+)
+
+// Feature modes.
+const (
+	FeatureModeEnforce = "enforce"
+	FeatureModeCanary  = "canary"
+)
+
+// IsEnabled reports whether the feature is monitored.
+func (f FeatureConfig) IsEnabled() bool {
+	return f.Enabled == nil || *f.Enabled
+}
+
+// Canary reports whether the feature's violations are only recorded, never notified.
+func (f FeatureConfig) Canary() bool {
+	return f.Mode == FeatureModeCanary
+}
+
+// Expected value types, by their JSON name.
+const (
+	ExpectedTypeNumber = "number"
+	ExpectedTypeString = "string"
+	ExpectedTypeBool   = "bool"
+	ExpectedTypeArray  = "array"
+)
+
+// expectedTypes lists the expected value types each metric type can read.
+var expectedTypes = map[string][]string{
+	MetricTypeNumerical:   {ExpectedTypeNumber},
+	MetricTypeLatency:     {ExpectedTypeNumber},
+	MetricTypeCategorical: {ExpectedTypeString, ExpectedTypeBool, ExpectedTypeNumber},
+	MetricTypeText:        {ExpectedTypeString},
+	MetricTypeVector:      {ExpectedTypeArray},
+	MetricTypeBoolean:     {ExpectedTypeBool},
+}
+
+// Feature priorities. Critical features are processed at full fidelity even under load shedding.
+const (
+	PriorityCritical = "critical"
+	PriorityNormal   = "normal"
+	PriorityLow      = "low"
+)
+
+// SamplingConfig controls which fraction of messages is processed for a feature.
+type SamplingConfig struct {
+	Rate            float64 `mapstructure:"rate"`            // Base fraction of messages processed (0 < rate <= 1)
+	Adaptive        bool    `mapstructure:"adaptive"`        // Process every message while metrics approach thresholds
+	ApproachMargin  float64 `mapstructure:"approachMargin"`  // Relative distance to a threshold that counts as approaching
+	CooldownWindows int     `mapstructure:"cooldownWindows"` // Healthy windows required before reverting to the base rate
+	ReservoirBoost  float64 `mapstructure:"reservoirBoost"`  // Factor skew reservoirs (skew.maxSamples) grow by while approaching thresholds
+}
+
+// ConditionConfig is a composite alert rule evaluated against a window's statistics,
+// e.g. `null_rate > 0.2 && count > 1000`.
+type ConditionConfig struct {
+	Name string `mapstructure:"name"`
+	Expr string `mapstructure:"expr"`
+}
+
+// CompositeMetricConfig is a window-level metric derived from the statistics of several
+// features, e.g. `clicks.count / impressions.count`. Statistics are referenced as
+// <feature>.<variable>, using the variables available to conditions.
+type CompositeMetricConfig struct {
+	Name string   `mapstructure:"name"`
+	Expr string   `mapstructure:"expr"`
+	Min  *float64 `mapstructure:"min"`
+	Max  *float64 `mapstructure:"max"`
+}
+
+// SessionConfig groups the messages of each entity (user, device) into sessions, closed
+// after Gap without a message of the entity. Every closed session is summarized into a
+// record of SessionFields, aggregated in the window it closed in by the features with
+// scope "session".
+type SessionConfig struct {
+	EntityField string        `mapstructure:"entityField"` // Message field identifying the entity, e.g. "user_id"; empty disables sessions
+	Gap         time.Duration `mapstructure:"gap"`         // Inactivity closing a session
+	MaxOpen     int           `mapstructure:"maxOpen"`     // Open sessions tracked; past it, the least recently active one is closed early
+	Fields      []string      `mapstructure:"fields"`      // Numerical message fields summed and averaged over each session
+}
+
+// Fields of a session summary, besides the <field>.sum and <field>.mean of every
+// configured field.
+const (
+	SessionEventsField   = "events"          // Messages of the session
+	SessionDurationField = "durationSeconds" // From the session's first message to its last
+)
+
+// SummaryFields returns the fields of a session summary.
+func (s SessionConfig) SummaryFields() []string {
+	fields := []string{SessionEventsField, SessionDurationField}
+	for _, f := range s.Fields {
+		fields = append(fields, f+".sum", f+".mean")
+	}
+	return fields
+}
+
+type LogConfig struct {
+	Level              string `mapstructure:"level"`
+	Format             string `mapstructure:"format"`
+	FileLoggingEnabled bool   `mapstructure:"fileLoggingEnabled"`
+	Directory          string `mapstructure:"directory"`
+	Filename           string `mapstructure:"filename"`
+	MaxSize            int    `mapstructure:"maxSize"`    // Max size in MB
+	MaxBackups         int    `mapstructure:"maxBackups"` // Max backup files
+	MaxAge             int    `mapstructure:"maxAge"`     // Max days to retain
+	Compress           bool   `mapstructure:"compress"`   // Compress rotated files?
+
+	// Pipeline is added to every entry as the pipeline field, so logs of several
+	// deployments can be told apart; defaults to kafka.groupID
+	Pipeline string            `mapstructure:"pipeline"`
+	Sampling LogSamplingConfig `mapstructure:"sampling"`
+	// RepeatInterval logs identical warnings (same message and logger) at most once per
+	// interval, the next one counting those suppressed; 0 logs every warning
+	RepeatInterval time.Duration `mapstructure:"repeatInterval"`
+	// SummaryInterval logs what the pipeline processed (messages consumed, parse failures,
+	// windows, violations and dropped results) every interval, overall and per feature;
+	// 0 disables the summary
+	SummaryInterval time.Duration `mapstructure:"summaryInterval"`
+}
+
+// LogSamplingConfig caps the entries logged per second with the same level and message:
+// within each tick, the first entries are logged, then every thereafter-th one.
+type LogSamplingConfig struct {
+	Enabled    bool          `mapstructure:"enabled"`
+	Tick       time.Duration `mapstructure:"tick"`
+	Initial    int           `mapstructure:"initial"`
+	Thereafter int           `mapstructure:"thereafter"` // 0 drops every entry past the initial ones
+}
+
+// Supported signing algorithms for emitted results and audit records.
+const (
+	SigningAlgorithmHMACSHA256 = "hmac-sha256"
+	SigningAlgorithmEd25519    = "ed25519"
+)
+
+type SigningConfig struct {
+	Enabled   bool   `mapstructure:"enabled"`
+	Algorithm string `mapstructure:"algorithm"` // "hmac-sha256" or "ed25519"
+	KeyFile   string `mapstructure:"keyFile"`   // HMAC secret or PEM-encoded PKCS#8 Ed25519 private key
+	KeyID     string `mapstructure:"keyID"`     // Identifier published alongside signatures for key rotation
+}
+
+type Thresholds struct {
+	NullRate         *float64 `mapstructure:"nullRateMax"`         // Share of messages with an explicit null value
+	MissingRate      *float64 `mapstructure:"missingRateMax"`      // Share of messages without the feature's key
+	TypeMismatchRate *float64 `mapstructure:"typeMismatchRateMax"` // Share of messages whose value is not of the metric type
+	MeanMin          *float64 `mapstructure:"meanMin"`
+	MeanMax          *float64 `mapstructure:"meanMax"`
+	StdDevMin        *float64 `mapstructure:"stdDevMin"`
+	StdDevMax        *float64 `mapstructure:"stdDevMax"`
+	ZeroRateMax      *float64 `mapstructure:"zeroRateMax"`    // Share of numerical values that are exactly zero
+	OutlierRateMax   *float64 `mapstructure:"outlierRateMax"` // Share of numerical values that are outliers, with outliers
+	// ConstantWindows alerts once a feature holds a single value for this many consecutive
+	// windows (stuck sensor, default value bug); 0 disables the check.
+	ConstantWindows int `mapstructure:"constantWindows"`
+
+	// Bounds on the distinct values of a window, estimated with a HyperLogLog of
+	// pipeline.sketches precision: a distinctMin of 2 catches an ID collapsing to one value
+	// after a broken join, a distinctMax one exploding. Not for vector features.
+	DistinctMin *float64 `mapstructure:"distinctMin"`
+	DistinctMax *float64 `mapstructure:"distinctMax"`
+
+	// String values of categorical and text features; lengths are in characters
+	AvgLengthMin        *float64 `mapstructure:"avgLengthMin"`
+	AvgLengthMax        *float64 `mapstructure:"avgLengthMax"`
+	MaxLength           *float64 `mapstructure:"maxLength"`           // Upper bound on the longest value
+	PatternMatchRateMin *float64 `mapstructure:"patternMatchRateMin"` // Share of values matching valuePattern
+
+	// Vector features; norms are Euclidean, centroid distances cosine (0..2)
+	NormMin                  *float64 `mapstructure:"normMin"` // Bounds on the mean norm of the window's vectors
+	NormMax                  *float64 `mapstructure:"normMax"`
+	DimensionMismatchRateMax *float64 `mapstructure:"dimensionMismatchRateMax"` // Share of vectors without the expected dimensions
+	NonFiniteRateMax         *float64 `mapstructure:"nonFiniteRateMax"`         // Share of elements that are NaN, infinite or null
+	CentroidDistanceMax      *float64 `mapstructure:"centroidDistanceMax"`      // Mean cosine distance to the baseline centroid
+
+	// Latency features, in milliseconds
+	P50Max *float64 `mapstructure:"p50Max"`
+	P95Max *float64 `mapstructure:"p95Max"`
+	P99Max *float64 `mapstructure:"p99Max"`
+
+	// Boolean features; shares of the window's boolean values that are true
+	TrueRateMin *float64 `mapstructure:"trueRateMin"`
+	TrueRateMax *float64 `mapstructure:"trueRateMax"`
+
+	// ForWindows withholds a check's violations until it has violated this many
+	// consecutive windows, like Prometheus' for, so noisy features do not flap; 0 or 1
+	// alerts on the first violating window. It applies to every check of the feature,
+	// conditions included.
+	ForWindows int `mapstructure:"forWindows"`
+
+	// Critical holds looser bounds, under the same keys, past which violations are
+	// critical rather than warnings, e.g. nullRateMax 0.1 here and 0.3 there. A check with
+	// only a critical bound raises critical violations only.
+	Critical *Thresholds `mapstructure:"critical"`
+
+	// Resolve holds stricter bounds, under the same keys, that a firing check must get back
+	// within before its alert resolves, e.g. nullRateMax 0.1 above and 0.08 here: the alert
+	// fires above 0.1 and resolves only below 0.08, so a value oscillating around the
+	// threshold does not flap. Checks without a resolve bound resolve at their firing bound.
+	Resolve *Thresholds `mapstructure:"resolve"`
+}
+
+// bounds returns the thresholds' bounds by configuration key.
+func (t *Thresholds) bounds() map[string]**float64 {
+	return map[string]**float64{
+		"nullRateMax":              &t.NullRate,
+		"missingRateMax":           &t.MissingRate,
+		"typeMismatchRateMax":      &t.TypeMismatchRate,
+		"meanMin":                  &t.MeanMin,
+		"meanMax":                  &t.MeanMax,
+		"stdDevMin":                &t.StdDevMin,
+		"stdDevMax":                &t.StdDevMax,
+		"zeroRateMax":              &t.ZeroRateMax,
+		"outlierRateMax":           &t.OutlierRateMax,
+		"distinctMin":              &t.DistinctMin,
+		"distinctMax":              &t.DistinctMax,
+		"avgLengthMin":             &t.AvgLengthMin,
+		"avgLengthMax":             &t.AvgLengthMax,
+		"maxLength":                &t.MaxLength,
+		"patternMatchRateMin":      &t.PatternMatchRateMin,
+		"normMin":                  &t.NormMin,
+		"normMax":                  &t.NormMax,
+		"dimensionMismatchRateMax": &t.DimensionMismatchRateMax,
+		"nonFiniteRateMax":         &t.NonFiniteRateMax,
+		"centroidDistanceMax":      &t.CentroidDistanceMax,
+		"p50Max":                   &t.P50Max,
+		"p95Max":                   &t.P95Max,
+		"p99Max":                   &t.P99Max,
+		"trueRateMin":              &t.TrueRateMin,
+		"trueRateMax":              &t.TrueRateMax,
+	}
+}
+
+// Bound returns the bound configured under key, e.g. "nullRateMax" or "meanMin", or nil.
+func (t Thresholds) Bound(key string) *float64 {
+	if bound, ok := t.bounds()[key]; ok {
+		return *bound
+	}
+	return nil
+}
+
+// Resolving returns the thresholds checked while alerts fire: the resolve bound in place of
+// each bound firing reports true for, by key. Critical and Resolve are kept.
+func (t Thresholds) Resolving(firing func(key string) bool) Thresholds {
+	if t.Resolve == nil {
+		return t
+	}
+	resolve := t.Resolve.bounds()
+	for key, bound := range t.bounds() {
+		if *resolve[key] != nil && firing(key) {
+			*bound = *resolve[key]
+		}
+	}
+	return t
+}
+
+// Effective returns the thresholds checked for violations of any severity: each warning
+// bound, or the critical one where only that is set. Critical is kept.
+func (t Thresholds) Effective() Thresholds {
+	if t.Critical == nil {
+		return t
+	}
+	critical := t.Critical.bounds()
+	for key, bound := range t.bounds() {
+		if *bound == nil {
+			*bound = *critical[key]
+		}
+	}
+	if t.ConstantWindows == 0 {
+		t.ConstantWindows = t.Critical.ConstantWindows
+	}
+	return t
+}
+
+// Load initializes viper, reads config, applies defaults, unmarshals, and validates.
+// configPath is a comma-separated list of files and directories merged in order (see
+// loadDocument). Validation failures are a *ValidationError listing every problem
+// found, located in the files where possible.
+func Load(configPath string) (*Config, error) {
+	cfg, doc, err := read(configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateConfig(cfg); err != nil {
+		doc.locate(err)
+		return nil, err
+	}
+	dropDisabledFeatures(cfg)
+
+	return cfg, nil
+}
+
+// dropDisabledFeatures removes the disabled features, recording their names, and the
+// dependencies of the others on them.
+func dropDisabledFeatures(cfg *Config) {
+	disabled := make(map[string]bool)
+	enabled := cfg.Features[:0]
+	for _, f := range cfg.Features {
+		if f.IsEnabled() {
+			enabled = append(enabled, f)
+			continue
+		}
+		disabled[f.Name] = true
+		cfg.DisabledFeatures = append(cfg.DisabledFeatures, cmp.Or(f.Name, f.Pattern))
+	}
+	if len(disabled) == 0 {
+		return
+	}
+	cfg.Features = enabled
+	for i := range cfg.Features {
+		deps := cfg.Features[i].DependsOn[:0:0]
+		for _, dep := range cfg.Features[i].DependsOn {
+			if !disabled[dep] {
+				deps = append(deps, dep)
+			}
+		}
+		cfg.Features[i].DependsOn = deps
+	}
+}
+
+// read loads the configuration without validating it, returning it along with the
+// merged document it was read from.
+func read(configPath string) (*Config, *document, error) {
+	v := viper.New()
+	configureViper(v)
+
+	// Set default values before reading config source .yaml
+	setDefaults(v)
+
+	// Read configuration from files (error if a mandatory file is missing)
+	doc, err := readConfigFiles(v, configPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Unmarshal the configuration
+	var cfg Config
+	if err := v.Unmarshal(&cfg); err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", ErrUnmarshallingConfig, err)
+	}
+	expandFeatureGroups(&cfg)
+	resolveTimeZone(&cfg)
+	applyTenants(&cfg)
+	applyFeatureDefaults(&cfg)
+	for _, fe := range doc.deprecations {
+		cfg.Deprecations = append(cfg.Deprecations, fe.Error())
+	}
+	cfg.SecretReferences = doc.secretRefs
+
+	return &cfg, doc, nil
+}
+
+// resolveTimeZone loads the time zone windows are aligned to; an unknown zone is left
+// unresolved and reported by validation.
+func resolveTimeZone(cfg *Config) {
+	if zone := cfg.Pipeline.WindowAlignment.TimeZone; zone != "" {
+		cfg.Pipeline.WindowAlignment.Location, _ = time.LoadLocation(zone)
+	}
+}
+
+// configureViper sets up viper instance for environment variables.
+func configureViper(v *viper.Viper) {
+	v.SetEnvPrefix(envPrefix)
+	v.AutomaticEnv()
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_", "-", "_"))
+}
+
+// setDefaults applies default configuration values using Viper.
+func setDefaults(v *viper.Viper) {
+	v.SetDefault("kafka.groupID", defaultKafkaGroupID)
+	v.SetDefault("kafka.lag.interval", defaultLagInterval)
+	v.SetDefault("kafka.lag.threshold", 0)
+	v.SetDefault("kafka.isolationLevel", IsolationReadUncommitted)
+	v.SetDefault("kafka.reader.minBytes", defaultReaderMinBytes)
+	v.SetDefault("kafka.reader.maxBytes", defaultReaderMaxBytes)
+	v.SetDefault("kafka.reader.maxWait", defaultReaderMaxWait)
+	v.SetDefault("kafka.reader.commitInterval", 0)
+	v.SetDefault("pipeline.windowSize", defaultPipelineWindow)
+	v.SetDefault("pipeline.internMaxEntries", defaultInternMaxSize)
+	v.SetDefault("pipeline.maxDiscoveredFeatures", defaultMaxDiscovered)
+	v.SetDefault("pipeline.maxFeatureSeries", defaultMaxFeatureSeries)
+	v.SetDefault("pipeline.maxGroupSeries", defaultMaxGroupSeries)
+	v.SetDefault("pipeline.historyWindows", defaultHistoryWindows)
+	v.SetDefault("pipeline.shutdownTimeout", defaultShutdownTimeout)
+	v.SetDefault("pipeline.parserWorkers", runtime.GOMAXPROCS(0))
+	v.SetDefault("pipeline.calculatorWorkers", 1)
+	v.SetDefault("pipeline.batch.size", defaultBatchSize)
+	v.SetDefault("pipeline.batch.linger", defaultBatchLinger)
+	v.SetDefault("pipeline.windowState.maxMemoryMB", 0)
+	v.SetDefault("pipeline.windowState.spillDirectory", defaultSpillDirectory)
+	v.SetDefault("pipeline.sessions.gap", defaultSessionGap)
+	v.SetDefault("pipeline.sessions.maxOpen", defaultMaxSessions)
+	v.SetDefault("pipeline.partialParsing", true)
+	v.SetDefault("pipeline.format", FormatJSON)
+	v.SetDefault("pipeline.csv.delimiter", ",")
+	v.SetDefault("pipeline.formatHeader", defaultFormatHeader)
+	v.SetDefault("pipeline.schemaRegistry.timeout", defaultRegistryTimeout)
+	v.SetDefault("pipeline.coercion.decimalSeparator", ".")
+	v.SetDefault("pipeline.latency.timestampUnit", TimestampUnitMilliseconds)
+	v.SetDefault("pipeline.latency.futureTolerance", defaultFutureTolerance)
+	v.SetDefault("pipeline.latency.outOfOrderTolerance", defaultOutOfOrderTol)
+	v.SetDefault("pipeline.eventTime.allowedLateness", defaultAllowedLateness)
+	v.SetDefault("pipeline.eventTime.latePolicy", LatePolicyDrop)
+	v.SetDefault("pipeline.eventTime.retention", defaultLateRetention)
+	v.SetDefault("pipeline.throughput.recentWindows", defaultRecentWindows)
+	v.SetDefault("pipeline.throughput.completeness.learnWindows", defaultLearnWindows)
+	v.SetDefault("pipeline.schemaTracking.minShare", defaultSchemaMinShare)
+	v.SetDefault("pipeline.schemaTracking.maxFields", defaultSchemaMaxFields)
+	v.SetDefault("pipeline.partitionStats.minMessages", defaultPartitionMinMsgs)
+	v.SetDefault("pipeline.partitionStats.nullRateRatio", defaultPartitionRatio)
+	v.SetDefault("pipeline.partitionStats.minNullRate", defaultPartitionMinNull)
+	v.SetDefault("pipeline.loadShedding.enabled", false)
+	v.SetDefault("pipeline.loadShedding.highWatermark", defaultShedHighMark)
+	v.SetDefault("pipeline.loadShedding.lowWatermark", defaultShedLowMark)
+	v.SetDefault("pipeline.loadShedding.normalRate", defaultShedNormal)
+	v.SetDefault("pipeline.loadShedding.lowRate", defaultShedLow)
+	v.SetDefault("log.level", defaultLogLevel)
+	v.SetDefault("log.format", defaultLogFormat)
+	v.SetDefault("log.fileLoggingEnabled", defaultLogFileEnabled)
+	v.SetDefault("log.directory", defaultLogDirectory)
+	v.SetDefault("log.filename", defaultLogFilename)
+	v.SetDefault("log.maxSize", defaultLogMaxSizeMB)
+	v.SetDefault("log.maxBackups", defaultLogMaxBackups)
+	v.SetDefault("log.maxAge", defaultLogMaxAgeDays)
+	v.SetDefault("log.compress", defaultLogCompress)
+	v.SetDefault("log.sampling.enabled", true)
+	v.SetDefault("log.sampling.tick", defaultLogSampleTick)
+	v.SetDefault("log.sampling.initial", defaultLogSampleFirst)
+	v.SetDefault("log.sampling.thereafter", defaultLogSampleFirst)
+	v.SetDefault("log.repeatInterval", 0)
+	v.SetDefault("log.summaryInterval", 0)
+	v.SetDefault("signing.enabled", false)
+	v.SetDefault("signing.algorithm", defaultSigningAlgo)
+	v.SetDefault("skew.enabled", false)
+	v.SetDefault("skew.bins", defaultSkewBins)
+	v.SetDefault("skew.maxSamples", defaultSkewSamples)
+	v.SetDefault("remoteWrite.enabled", false)
+	v.SetDefault("remoteWrite.timeout", defaultRWTimeout)
+	v.SetDefault("remoteWrite.flushInterval", defaultRWFlush)
+	v.SetDefault("remoteWrite.maxBatchSize", defaultRWBatchSize)
+	v.SetDefault("remoteWrite.queueSize", defaultRWQueueSize)
+	v.SetDefault("remoteWrite.maxRetries", defaultRWMaxRetries)
+	v.SetDefault("telemetry.enabled", false)
+	v.SetDefault("telemetry.endpoint", defaultOTelEndpoint)
+	v.SetDefault("telemetry.serviceName", defaultOTelService)
+	v.SetDefault("telemetry.traceSampleRatio", 1.0)
+	v.SetDefault("telemetry.metricInterval", defaultOTelInterval)
+	v.SetDefault("store.enabled", false)
+	v.SetDefault("store.retention", defaultStoreRetention)
+	v.SetDefault("secrets.timeout", defaultSecretsTimeout)
+	v.SetDefault("secrets.refreshInterval", defaultSecretsRefresh)
+	v.SetDefault("secrets.vault.kvVersion", defaultVaultKVVersion)
+	v.SetDefault("errors.notifySeverity", defaultErrorSeverity)
+	v.SetDefault("errors.notifyInterval", defaultErrorInterval)
+	v.SetDefault("audit.enabled", false)
+	v.SetDefault("audit.path", defaultAuditPath)
+	v.SetDefault("audit.maxSize", defaultLogMaxSizeMB)
+	v.SetDefault("pipeline.valueSamples.size", 0)
+	v.SetDefault("pipeline.valueSamples.maxLength", defaultSampleMaxLength)
+	v.SetDefault("pipeline.exemplars.size", defaultExemplars)
+	v.SetDefault("pipeline.sketches.enabled", false)
+	v.SetDefault("pipeline.sketches.relativeAccuracy", defaultSketchAccuracy)
+	v.SetDefault("pipeline.sketches.precision", defaultHLLPrecision)
+	v.SetDefault("pipeline.sketches.frequencyWidth", defaultCMSWidth)
+	v.SetDefault("pipeline.sketches.frequencyDepth", defaultCMSDepth)
+	v.SetDefault("sinks.queueSize", defaultSinkQueueSize)
+	v.SetDefault("sinks.maxBatchSize", defaultSinkBatchSize)
+	v.SetDefault("sinks.flushInterval", defaultSinkFlush)
+	v.SetDefault("sinks.timeout", defaultSinkTimeout)
+	v.SetDefault("sinks.maxRetries", defaultSinkRetries)
+	v.SetDefault("sinks.retryBackoff", defaultSinkBackoff)
+	v.SetDefault("sinks.dedupRetention", defaultSinkDedup)
+	v.SetDefault("sinks.maxRetryBackoff", defaultSinkMaxBackoff)
+	v.SetDefault("sinks.overflowSize", defaultSinkOverflow)
+	v.SetDefault("sinks.circuitBreaker.failureThreshold", defaultBreakerFailures)
+	v.SetDefault("sinks.circuitBreaker.openDuration", defaultBreakerOpen)
+	v.SetDefault("actions.queueSize", defaultActionQueueSize)
+	v.SetDefault("actions.timeout", defaultActionTimeout)
+	v.SetDefault("actions.cooldown", defaultActionCooldown)
+	v.SetDefault("leaderElection.enabled", false)
+	v.SetDefault("leaderElection.leaseName", defaultLeaseName)
+	v.SetDefault("leaderElection.leaseDuration", defaultLeaseDuration)
+	v.SetDefault("leaderElection.renewDeadline", defaultRenewDeadline)
+	v.SetDefault("leaderElection.retryPeriod", defaultRetryPeriod)
+}
+
+// expandFeatureGroups replaces entries listing members with one feature per member.
+func expandFeatureGroups(cfg *Config) {
+	expanded := make([]FeatureConfig, 0, len(cfg.Features))
+	for _, f := range cfg.Features {
+		if len(f.Members) == 0 {
+			expanded = append(expanded, f)
+			continue
+		}
+		for _, member := range f.Members {
+			m := f
+			m.Name = member
+			m.Group = f.Name
+			m.Members = nil
+			expanded = append(expanded, m)
+		}
+	}
+	cfg.Features = expanded
+}
+
+// applyTenants prefixes the names of tenant features, and of the features they depend on,
+// with their tenant. The features keep reading the message field they were named after.
+func applyTenants(cfg *Config) {
+	for i := range cfg.Features {
+		f := &cfg.Features[i]
+		if f.Tenant == "" || f.Name == "" || f.Pattern != "" {
+			continue // Pattern groups cannot have a tenant, see validateFeature
+		}
+		if f.Field == "" {
+			f.Field = f.Name
+		}
+		f.Name = f.Tenant + "." + f.Name
+		deps := make([]string, len(f.DependsOn))
+		for j, dep := range f.DependsOn {
+			deps[j] = f.Tenant + "." + dep
+		}
+		f.DependsOn = deps
+	}
+}
+
+// applyFeatureDefaults fills per-feature defaults, which viper cannot express for list entries.
+func applyFeatureDefaults(cfg *Config) {
+	for i := range cfg.Features {
+		sampling := &cfg.Features[i].Sampling
+		if sampling.Rate == 0 {
+			sampling.Rate = defaultSampleRate
+		}
+		if sampling.ApproachMargin == 0 {
+			sampling.ApproachMargin = defaultApproachMargin
+		}
+		if sampling.CooldownWindows == 0 {
+			sampling.CooldownWindows = defaultCooldownWins
+		}
+		if sampling.ReservoirBoost == 0 {
+			sampling.ReservoirBoost = defaultReservoirBoost
+		}
+		if cfg.Features[i].Priority == "" {
+			cfg.Features[i].Priority = PriorityNormal
+		}
+		if cfg.Features[i].Mode == "" {
+			cfg.Features[i].Mode = FeatureModeEnforce
+		}
+		if cfg.Features[i].GroupBy != "" && cfg.Features[i].MaxGroups == 0 {
+			cfg.Features[i].MaxGroups = defaultMaxGroups
+		}
+	}
+}
+
+// readConfigFiles merges the configuration files into viper, resolving environment
+// variable, secret file and secret store references first (see interpolate and
+// resolveSecrets).
+func readConfigFiles(v *viper.Viper, configPath string) (*document, error) {
+	doc, err := loadDocument(configPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := doc.migrationErrors.err(); err != nil {
+		return nil, err // Located as migrated
+	}
+	if err := interpolate(doc); err != nil {
+		return nil, err
+	}
+	if err := readDocument(v, doc); err != nil {
+		return nil, err
+	}
+	if len(doc.secrets) == 0 {
+		return doc, nil
+	}
+
+	// Secret references are resolved with the secrets settings, read with the rest
+	var secretsCfg SecretsConfig
+	if err := v.UnmarshalKey("secrets", &secretsCfg); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUnmarshallingConfig, err)
+	}
+	if doc.secretRefs, err = doc.resolveSecrets(secretsCfg); err != nil {
+		return nil, err
+	}
+	return doc, readDocument(v, doc)
+}
+
+// readDocument reads the document into viper, replacing the configuration it held.
+func readDocument(v *viper.Viper, doc *document) error {
+	resolved, err := yaml.Marshal(doc.root)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrReadingConfigFile, err)
+	}
+	v.SetConfigType("yaml") // JSON documents are YAML too
+	if err := v.ReadConfig(bytes.NewReader(resolved)); err != nil {
+		return fmt.Errorf("%w: %w", ErrReadingConfigFile, err)
+	}
+	return nil
+}
+
+// validateConfig checks the whole configuration, reporting every problem found rather
+// than the first. The returned error joins one FieldError per problem.
+func validateConfig(cfg *Config) error {
+	var errs fieldErrors
+	if len(cfg.Kafka.Brokers) == 0 {
+		errs.add(ErrEmptyKafkaBrokers, "kafka", "brokers")
+	}
+	errs.add(validateSubscription(cfg.Kafka, cfg.Pipeline.Scaling), "kafka")
+	if cfg.Kafka.GroupID == "" {
+		errs.add(ErrEmptyKafkaGroupID, "kafka", "groupID")
+	}
+	if cfg.Kafka.Lag.Interval <= 0 || cfg.Kafka.Lag.Threshold < 0 {
+		errs.add(ErrInvalidLagConfig, "kafka", "lag")
+	}
+	if cfg.Kafka.RateLimit.MessagesPerSecond < 0 || cfg.Kafka.RateLimit.Burst < 0 {
+		errs.add(ErrInvalidRateLimit, "kafka", "rateLimit")
+	}
+	switch cfg.Kafka.IsolationLevel {
+	case IsolationReadUncommitted, IsolationReadCommitted:
+	default:
+		errs.add(fmt.Errorf("%w: %q", ErrInvalidIsolationLevel, cfg.Kafka.IsolationLevel), "kafka", "isolationLevel")
+	}
+	if r := cfg.Kafka.Reader; r.MinBytes < 1 || r.MaxBytes < r.MinBytes || r.MaxWait <= 0 || r.CommitInterval < 0 {
+		errs.add(ErrInvalidKafkaReader, "kafka", "reader")
+	}
+	if cfg.Kafka.StartOffset != "" {
+		if _, err := ParseSeekTarget(cfg.Kafka.StartOffset); err != nil {
+			errs.add(err, "kafka", "startOffset")
+		} else if cfg.Pipeline.Scaling.Enabled {
+			errs.add(fmt.Errorf("%w: every instance would seek the shared consumer group at startup", ErrInvalidScaling), "kafka", "startOffset")
+		}
+	}
+	if s := cfg.Log.Sampling; s.Enabled && (s.Tick <= 0 || s.Initial < 1 || s.Thereafter < 0) {
+		errs.add(fmt.Errorf("%w: tick %s, initial %d, thereafter %d", ErrInvalidLogSampling, s.Tick, s.Initial, s.Thereafter), "log", "sampling")
+	}
+	if cfg.Log.RepeatInterval < 0 {
+		errs.add(ErrInvalidRepeatInterval, "log", "repeatInterval")
+	}
+	if cfg.Log.SummaryInterval < 0 {
+		errs.add(ErrInvalidSummaryInterval, "log", "summaryInterval")
+	}
+	if cfg.Pipeline.WindowSize <= 0 {
+		errs.add(ErrInvalidPipelineWindowSize, "pipeline", "windowSize")
+	}
+	if cfg.Pipeline.ShutdownTimeout <= 0 {
+		errs.add(ErrInvalidShutdownTimeout, "pipeline", "shutdownTimeout")
+	}
+	if cfg.Pipeline.ParserWorkers < 1 {
+		errs.add(ErrInvalidParserWorkers, "pipeline", "parserWorkers")
+	}
+	// Reopening windows and spilling stats touch every feature's state from the processing loop
+	if n := cfg.Pipeline.CalculatorWorkers; n < 1 || n > 1 && (cfg.Pipeline.EventTime.Enabled || cfg.Pipeline.WindowState.MaxMemoryMB > 0) {
+		errs.add(fmt.Errorf("%w: %d", ErrInvalidCalculatorWorkers, n), "pipeline", "calculatorWorkers")
+	}
+	if ws := cfg.Pipeline.WindowState; ws.MaxMemoryMB < 0 || ws.MaxMemoryMB > 0 && ws.SpillDirectory == "" {
+		errs.add(fmt.Errorf("%w: maxMemoryMB %d, spillDirectory %q", ErrInvalidWindowState, ws.MaxMemoryMB, ws.SpillDirectory), "pipeline", "windowState")
+	}
+	if s := cfg.Pipeline.Sessions; s.EntityField != "" && (s.Gap <= 0 || s.MaxOpen < 1) {
+		errs.add(fmt.Errorf("%w: gap %s, maxOpen %d", ErrInvalidSessions, s.Gap, s.MaxOpen), "pipeline", "sessions")
+	}
+	if cfg.Pipeline.Batch.Size < 1 || cfg.Pipeline.Batch.Linger < 0 {
+		errs.add(fmt.Errorf("%w: size %d, linger %s", ErrInvalidBatch, cfg.Pipeline.Batch.Size, cfg.Pipeline.Batch.Linger), "pipeline", "batch")
+	}
+	if cfg.Pipeline.HistoryWindows < 1 {
+		errs.add(fmt.Errorf("%w: %d", ErrInvalidHistoryWindows, cfg.Pipeline.HistoryWindows), "pipeline", "historyWindows")
+	}
+	if cfg.Pipeline.MaxFeatureSeries < 0 {
+		errs.add(fmt.Errorf("%w: %d", ErrInvalidSeriesLimit, cfg.Pipeline.MaxFeatureSeries), "pipeline", "maxFeatureSeries")
+	}
+	if cfg.Pipeline.MaxGroupSeries < 0 {
+		errs.add(fmt.Errorf("%w: %d", ErrInvalidSeriesLimit, cfg.Pipeline.MaxGroupSeries), "pipeline", "maxGroupSeries")
+	}
+	switch cfg.Pipeline.Latency.TimestampUnit {
+	case TimestampUnitSeconds, TimestampUnitMilliseconds, TimestampUnitMicroseconds, TimestampUnitNanoseconds, TimestampUnitAuto:
+	default:
+		errs.add(fmt.Errorf("%w: %q", ErrInvalidTimestampUnit, cfg.Pipeline.Latency.TimestampUnit), "pipeline", "latency", "timestampUnit")
+	}
+	errs.add(validateTimestampOrdering(cfg.Pipeline.Latency), "pipeline", "latency")
+	errs.add(validateEventTime(cfg.Pipeline), "pipeline", "eventTime")
+	errs.add(validateWindowAlignment(cfg.Pipeline), "pipeline", "windowAlignment")
+	errs.add(validateRollups(cfg.Pipeline), "pipeline", "rollups")
+	errs.add(validateFormat(cfg.Pipeline), "pipeline", "format")
+	errs.add(validateSchemaRegistry(cfg.Pipeline.SchemaRegistry), "pipeline", "schemaRegistry")
+	errs.add(validateCorrelations(cfg.Pipeline.Correlations), "pipeline", "correlations")
+	errs.add(validateDerivedFields(cfg.Pipeline.DerivedFields), "pipeline", "derivedFields")
+	errs.add(validateScript(cfg.Pipeline.Script), "pipeline", "script")
+	errs.add(validateGraph(cfg.Pipeline, cfg.Features), "pipeline", "graph")
+	errs.add(validateMetadata(cfg.Pipeline.Metadata), "pipeline", "metadata")
+	errs.add(validateCoercion(cfg.Pipeline.Coercion), "pipeline", "coercion")
+	if s := cfg.Pipeline.ValueSamples; s.Size < 0 || (s.Size > 0 && s.MaxLength <= 0) {
+		errs.add(fmt.Errorf("%w: size %d, maxLength %d", ErrInvalidValueSamples, s.Size, s.MaxLength), "pipeline", "valueSamples")
+	}
+	if e := cfg.Pipeline.Exemplars; e.TraceField != "" && e.Size < 1 {
+		errs.add(fmt.Errorf("%w: size %d", ErrInvalidExemplars, e.Size), "pipeline", "exemplars", "size")
+	}
+	if cfg.Pipeline.Filter != "" {
+		if _, err := expr.Compile(cfg.Pipeline.Filter); err != nil {
+			errs.add(fmt.Errorf("%w: %w", ErrInvalidFilter, err), "pipeline", "filter")
+		}
+	}
+	errs.add(validateLoadShedding(cfg.Pipeline.LoadShedding), "pipeline", "loadShedding")
+	errs.add(validateThroughput(cfg.Pipeline.Throughput), "pipeline", "throughput")
+	errs.add(validateSchemaTracking(cfg.Pipeline.SchemaTracking), "pipeline", "schemaTracking")
+	errs.add(validatePartitionStats(cfg.Pipeline.PartitionStats, cfg.Features), "pipeline", "partitionStats")
+	errs.add(validateSketches(cfg.Pipeline.Sketches, slices.ContainsFunc(cfg.Features, FeatureConfig.TracksDistinct)), "pipeline", "sketches")
+	errs.add(validateScaling(cfg.Pipeline.Scaling, cfg.Skew, cfg.LeaderElection), "pipeline", "scaling")
+	errs.add(validateSinks(cfg.Sinks), "sinks")
+	errs.add(validateActions(cfg.Actions), "actions")
+	errs.add(validateSigning(cfg.Signing), "signing")
+	errs.add(validateSkew(cfg.Skew), "skew")
+	errs.add(validateRemoteWrite(cfg.RemoteWrite), "remoteWrite")
+	errs.add(validateTelemetry(cfg.Telemetry), "telemetry")
+	if cfg.Store.Enabled && cfg.Store.Retention <= 0 {
+		errs.add(ErrInvalidStoreRetention, "store", "retention")
+	}
+	if s := cfg.Secrets; s.Timeout <= 0 || s.RefreshInterval < 0 || (s.Vault.KVVersion != 1 && s.Vault.KVVersion != 2) {
+		errs.add(ErrInvalidSecrets, "secrets")
+	}
+	errs.add(validateErrors(cfg.Errors, cfg.Sinks), "errors")
+	errs.add(validateHTTP(cfg.HTTP), "http")
+	errs.add(validateAudit(cfg.Audit), "audit")
+	errs.add(validateLeaderElection(cfg.LeaderElection), "leaderElection")
+	for _, f := range cfg.Features {
+		errs.add(validateFeature(f, cfg.Pipeline.CSV), featurePath(f)...)
+		errs.add(validateSeasonal(f.Name, f.Seasonal, f.Window(cfg.Pipeline.WindowSize)), append(featurePath(f), "seasonal")...)
+		if size := cfg.Pipeline.WindowSize; f.WindowSize < 0 || (size > 0 && f.WindowSize%size != 0) {
+			errs.add(fmt.Errorf("%w: feature %q windowSize %v must be a multiple of the pipeline windowSize %v", ErrInvalidFeatureWindowSize, f.Name, f.WindowSize, size), append(featurePath(f), "windowSize")...)
+		}
+		errs.add(validateExtensions(f.Name, "customMetrics", f.CustomMetrics), append(featurePath(f), "customMetrics")...)
+		errs.add(validateExtensions(f.Name, "customChecks", f.CustomChecks), append(featurePath(f), "customChecks")...)
+		if f.Scope == ScopeSession && cfg.Pipeline.Sessions.EntityField == "" {
+			errs.add(fmt.Errorf("%w: feature %q has scope %q without a pipeline sessions entityField", ErrInvalidScope, f.Name, f.Scope), append(featurePath(f), "scope")...)
+		}
+	}
+	errs.add(validateDependencies(cfg.Features), "features")
+	errs.add(validateCompositeMetrics(cfg.CompositeMetrics), "compositeMetrics")
+	windows := make(map[string]bool, len(cfg.MaintenanceWindows))
+	for i, w := range cfg.MaintenanceWindows {
+		name := cmp.Or(w.Name, strconv.Itoa(i))
+		if windows[name] {
+			errs.add(fmt.Errorf("%w: duplicate name %q", ErrInvalidMaintenanceWindow, name), "maintenanceWindows", name)
+		}
+		windows[name] = true
+		errs.add(validateMaintenanceWindow(w), "maintenanceWindows", name)
+	}
+	return errs.err()
+}
+
+// validateFeatureIdentity checks that an entry has a name or a valid pattern.
+func validateFeatureIdentity(f FeatureConfig) error {
+	if f.Pattern == "" {
+		if f.Name == "" {
+			return ErrEmptyFeatureName
+		}
+		return nil
+	}
+	if expression, ok := strings.CutPrefix(f.Pattern, RegexPatternPrefix); ok {
+		if _, err := regexp.Compile(expression); err != nil {
+			return fmt.Errorf("%w: %q: %w", ErrInvalidFeaturePattern, f.Pattern, err)
+		}
+		return nil
+	}
+	if _, err := path.Match(f.Pattern, ""); err != nil {
+		return fmt.Errorf("%w: %q: %w", ErrInvalidFeaturePattern, f.Pattern, err)
+	}
+	return nil
+}
+
+// validateDependencies ensures dependsOn references configured features and contains no cycles.
+func validateDependencies(features []FeatureConfig) error {
+	upstream := make(map[string][]string, len(features))
+	for _, f := range features {
+		upstream[f.Name] = f.DependsOn
+	}
+	for _, f := range features {
+		for _, dep := range f.DependsOn {
+			if _, ok := upstream[dep]; !ok {
+				return fmt.Errorf("%w: feature %q depends on %q", ErrUnknownDependency, f.Name, dep)
+			}
+		}
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make(map[string]int, len(features))
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case visiting:
+			return fmt.Errorf("%w: involving feature %q", ErrDependencyCycle, name)
+		case done:
+			return nil
+		}
+		state[name] = visiting
+		for _, dep := range upstream[name] {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		state[name] = done
+		return nil
+	}
+	for _, f := range features {
+		if err := visit(f.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateFeature checks one feature entry, locating each problem at the setting
+// responsible relative to the entry. csv lists the columns of CSV payloads, if known.
+func validateFeature(f FeatureConfig, csv CSVConfig) error {
+	var errs fieldErrors
+	errs.add(validateFeatureIdentity(f))
+	switch f.MetricType {
+	case MetricTypeNumerical, MetricTypeCategorical, MetricTypeText, MetricTypeVector, MetricTypeLatency, MetricTypeBoolean:
+	default:
+		errs.add(fmt.Errorf("%w: feature %q metricType %q, expected %s, %s, %s, %s, %s or %s", ErrUnknownMetricType, f.Name, f.MetricType,
+			MetricTypeNumerical, MetricTypeCategorical, MetricTypeText, MetricTypeVector, MetricTypeLatency, MetricTypeBoolean), "metricType")
+	}
+	switch f.ExpectedType {
+	case "", ExpectedTypeNumber, ExpectedTypeString, ExpectedTypeBool, ExpectedTypeArray:
+		if types, ok := expectedTypes[f.MetricType]; ok && f.ExpectedType != "" && !slices.Contains(types, f.ExpectedType) {
+			errs.add(fmt.Errorf("%w: feature %q: %s features cannot read %s values", ErrInvalidExpectedType, f.Name, f.MetricType, f.ExpectedType), "expectedType")
+		}
+	default:
+		errs.add(fmt.Errorf("%w: feature %q expectedType %q, expected %s, %s, %s or %s", ErrInvalidExpectedType, f.Name, f.ExpectedType,
+			ExpectedTypeNumber, ExpectedTypeString, ExpectedTypeBool, ExpectedTypeArray), "expectedType")
+	}
+	if f.Tenant != "" && f.Pattern != "" {
+		errs.add(fmt.Errorf("%w: feature group %q: pattern groups cannot have a tenant", ErrInvalidTenant, f.Pattern), "tenant")
+	}
+	switch f.Scope {
+	case "", ScopeMessage:
+	case ScopeSession:
+		if f.Pattern != "" {
+			errs.add(fmt.Errorf("%w: feature group %q: pattern groups match message fields", ErrInvalidScope, f.Pattern), "scope")
+		}
+	default:
+		errs.add(fmt.Errorf("%w: feature %q scope %q, expected %s or %s", ErrInvalidScope, f.Name, f.Scope, ScopeMessage, ScopeSession), "scope")
+	}
+	for _, topic := range f.Topics {
+		if _, err := path.Match(topic, ""); err != nil {
+			errs.add(fmt.Errorf("%w: feature %q topics %q: %w", ErrInvalidSubscription, f.Name, topic, err), "topics")
+		}
+	}
+	if f.Dimensions < 0 {
+		errs.add(fmt.Errorf("%w: feature %q dimensions %d", ErrInvalidDimensions, f.Name, f.Dimensions), "dimensions")
+	}
+	if n := len(f.BaselineCentroid); n > 0 && f.Dimensions > 0 && n != f.Dimensions {
+		errs.add(fmt.Errorf("%w: feature %q baselineCentroid has %d elements, expected %d", ErrInvalidDimensions, f.Name, n, f.Dimensions), "baselineCentroid")
+	}
+	errs.add(validateThresholds(f.Name, f.Thresholds), "thresholds")
+	if p := f.Skew.ChiSquarePValueMin; p != nil && (*p <= 0 || *p >= 1) {
+		errs.add(fmt.Errorf("%w: feature %q chiSquarePValueMin %v must be in (0, 1)", ErrInvalidThresholds, f.Name, *p), "skew", "chiSquarePValueMin")
+	}
+	if f.ValuePattern != "" {
+		if _, err := regexp.Compile(f.ValuePattern); err != nil {
+			errs.add(fmt.Errorf("%w: feature %q: %w", ErrInvalidValuePattern, f.Name, err), "valuePattern")
+		}
+	} else if f.Thresholds.PatternMatchRateMin != nil {
+		errs.add(fmt.Errorf("%w: feature %q has patternMatchRateMin without a valuePattern", ErrInvalidValuePattern, f.Name), "thresholds", "patternMatchRateMin")
+	}
+	errs.add(validateOutliers(f), "outliers")
+	if f.GroupBy != "" && (f.GroupBy == f.Name || f.MaxGroups < 1) {
+		errs.add(fmt.Errorf("%w: feature %q groupBy %q must name another field with maxGroups of at least 1, got %d", ErrInvalidGroupBy, f.Name, f.GroupBy, f.MaxGroups), "groupBy")
+	}
+	if f.GroupBy != "" && len(csv.Columns) > 0 && !slices.Contains(csv.Columns, f.GroupBy) {
+		errs.add(fmt.Errorf("%w: feature %q groupBy %q is not one of the pipeline csv columns", ErrInvalidGroupBy, f.Name, f.GroupBy), "groupBy")
+	}
+	for group, thresholds := range f.GroupThresholds {
+		if f.GroupBy == "" {
+			errs.add(fmt.Errorf("%w: feature %q has groupThresholds without a groupBy", ErrInvalidGroupBy, f.Name), "groupThresholds")
+			break
+		}
+		errs.add(validateThresholds(fmt.Sprintf("%s[%s=%s]", f.Name, f.GroupBy, group), thresholds), "groupThresholds", group)
+	}
+	if f.MinCount < 0 {
+		errs.add(fmt.Errorf("%w: feature %q minCount %d", ErrInvalidMinCount, f.Name, f.MinCount), "minCount")
+	}
+	if f.NoDataWindows < 0 {
+		errs.add(fmt.Errorf("%w: feature %q noDataWindows %d", ErrInvalidNoDataWindows, f.Name, f.NoDataWindows), "noDataWindows")
+	}
+	if f.Sampling.Rate <= 0 || f.Sampling.Rate > 1 {
+		errs.add(fmt.Errorf("%w: feature %q rate %v", ErrInvalidSamplingRate, f.Name, f.Sampling.Rate), "sampling", "rate")
+	}
+	if f.Sampling.ReservoirBoost < 1 {
+		errs.add(fmt.Errorf("%w: feature %q reservoirBoost %v", ErrInvalidReservoirBoost, f.Name, f.Sampling.ReservoirBoost), "sampling", "reservoirBoost")
+	}
+	switch f.Priority {
+	case PriorityCritical:
+		if f.Sampling.Rate < 1 {
+			errs.add(fmt.Errorf("%w: critical feature %q cannot have sampling rate %v", ErrInvalidPriority, f.Name, f.Sampling.Rate), "priority")
+		}
+	case PriorityNormal, PriorityLow:
+	default:
+		errs.add(fmt.Errorf("%w: feature %q priority %q", ErrInvalidPriority, f.Name, f.Priority), "priority")
+	}
+	if f.Mode != FeatureModeEnforce && f.Mode != FeatureModeCanary {
+		errs.add(fmt.Errorf("%w: feature %q mode %q, must be %q or %q", ErrInvalidFeatureMode, f.Name, f.Mode, FeatureModeEnforce, FeatureModeCanary), "mode")
+	}
+	if f.RunbookURL != "" {
+		if u, err := url.Parse(f.RunbookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs.add(fmt.Errorf("%w: feature %q runbookUrl %q must be an absolute http(s) URL", ErrInvalidRunbookURL, f.Name, f.RunbookURL), "runbookUrl")
+		}
+	}
+	for i, cond := range f.Conditions {
+		if cond.Name == "" {
+			errs.add(fmt.Errorf("%w: feature %q has a condition without a name", ErrInvalidCondition, f.Name), "conditions", strconv.Itoa(i))
+			continue
+		}
+		if _, err := expr.Compile(cond.Expr); err != nil {
+			errs.add(fmt.Errorf("%w: feature %q condition %q: %w", ErrInvalidCondition, f.Name, cond.Name, err), "conditions", cond.Name, "expr")
+		}
+	}
+	return errs.err()
+}
+
+// validateThresholds checks that rates are shares, that lower bounds do not exceed
+// upper bounds, and that lengths and deviations are not negative. feature names the
+// thresholds' owner in messages.
+func validateThresholds(feature string, t Thresholds) error {
+	var errs fieldErrors
+	for _, rate := range []struct {
+		key   string
+		value *float64
+	}{
+		{"nullRateMax", t.NullRate},
+		{"missingRateMax", t.MissingRate},
+		{"typeMismatchRateMax", t.TypeMismatchRate},
+		{"zeroRateMax", t.ZeroRateMax},
+		{"outlierRateMax", t.OutlierRateMax},
+		{"patternMatchRateMin", t.PatternMatchRateMin},
+		{"dimensionMismatchRateMax", t.DimensionMismatchRateMax},
+		{"nonFiniteRateMax", t.NonFiniteRateMax},
+		{"trueRateMin", t.TrueRateMin},
+		{"trueRateMax", t.TrueRateMax},
+	} {
+		if rate.value != nil && (*rate.value < 0 || *rate.value > 1) {
+			errs.add(fmt.Errorf("%w: feature %q %s %v must be in [0, 1]", ErrInvalidThresholds, feature, rate.key, *rate.value), rate.key)
+		}
+	}
+	for _, bound := range []struct {
+		key   string
+		value *float64
+	}{
+		{"stdDevMin", t.StdDevMin},
+		{"stdDevMax", t.StdDevMax},
+		{"avgLengthMin", t.AvgLengthMin},
+		{"avgLengthMax", t.AvgLengthMax},
+		{"maxLength", t.MaxLength},
+		{"normMin", t.NormMin},
+		{"normMax", t.NormMax},
+		{"centroidDistanceMax", t.CentroidDistanceMax},
+		{"p50Max", t.P50Max},
+		{"p95Max", t.P95Max},
+		{"p99Max", t.P99Max},
+		{"distinctMin", t.DistinctMin},
+		{"distinctMax", t.DistinctMax},
+	} {
+		if bound.value != nil && *bound.value < 0 {
+			errs.add(fmt.Errorf("%w: feature %q %s %v cannot be negative", ErrInvalidThresholds, feature, bound.key, *bound.value), bound.key)
+		}
+	}
+	for _, r := range []struct {
+		minKey, maxKey string
+		min, max       *float64
+	}{
+		{"meanMin", "meanMax", t.MeanMin, t.MeanMax},
+		{"stdDevMin", "stdDevMax", t.StdDevMin, t.StdDevMax},
+		{"avgLengthMin", "avgLengthMax", t.AvgLengthMin, t.AvgLengthMax},
+		{"avgLengthMin", "maxLength", t.AvgLengthMin, t.MaxLength},
+		{"normMin", "normMax", t.NormMin, t.NormMax},
+		{"p50Max", "p95Max", t.P50Max, t.P95Max},
+		{"p95Max", "p99Max", t.P95Max, t.P99Max},
+		{"distinctMin", "distinctMax", t.DistinctMin, t.DistinctMax},
+		{"trueRateMin", "trueRateMax", t.TrueRateMin, t.TrueRateMax},
+	} {
+		if r.min != nil && r.max != nil && *r.min > *r.max {
+			errs.add(fmt.Errorf("%w: feature %q %s %v is greater than %s %v", ErrInvalidThresholds, feature, r.minKey, *r.min, r.maxKey, *r.max), r.minKey)
+		}
+	}
+	if t.ConstantWindows < 0 {
+		errs.add(fmt.Errorf("%w: feature %q constantWindows %d", ErrInvalidConstantWindows, feature, t.ConstantWindows), "constantWindows")
+	}
+	if t.ForWindows < 0 {
+		errs.add(fmt.Errorf("%w: feature %q forWindows %d cannot be negative", ErrInvalidThresholds, feature, t.ForWindows), "forWindows")
+	}
+	if t.Critical != nil {
+		errs.add(validateCriticalThresholds(feature, t), "critical")
+	}
+	if t.Resolve != nil {
+		errs.add(validateResolveThresholds(feature, t), "resolve")
+	}
+	return errs.err()
+}
+
+// validateResolveThresholds checks the resolve bounds of thresholds, each of which needs a
+// firing bound to resolve and must not be looser than it.
+func validateResolveThresholds(feature string, t Thresholds) error {
+	var errs fieldErrors
+	resolve := *t.Resolve
+	if resolve.Critical != nil {
+		errs.add(fmt.Errorf("%w: feature %q resolve thresholds cannot be nested", ErrInvalidThresholds, feature), "critical")
+		resolve.Critical = nil
+	}
+	if resolve.Resolve != nil {
+		errs.add(fmt.Errorf("%w: feature %q resolve thresholds cannot be nested", ErrInvalidThresholds, feature), "resolve")
+		resolve.Resolve = nil
+	}
+	if resolve.ForWindows != 0 {
+		errs.add(fmt.Errorf("%w: feature %q resolve thresholds only take bounds", ErrInvalidThresholds, feature), "forWindows")
+	}
+	if resolve.ConstantWindows != 0 {
+		errs.add(fmt.Errorf("%w: feature %q resolve thresholds only take bounds", ErrInvalidThresholds, feature), "constantWindows")
+	}
+	errs.add(validateThresholds(feature, resolve))
+	firing := t.Effective()
+	for key, bound := range resolve.bounds() {
+		if *bound == nil {
+			continue
+		}
+		fire := firing.Bound(key)
+		if fire == nil {
+			errs.add(fmt.Errorf("%w: feature %q resolve %s has no firing bound to resolve", ErrInvalidThresholds, feature, key), key)
+			continue
+		}
+		if lower := strings.HasSuffix(key, "Min"); lower && **bound < *fire || !lower && **bound > *fire {
+			errs.add(fmt.Errorf("%w: feature %q resolve %s %v is looser than its firing bound %v", ErrInvalidThresholds, feature, key, **bound, *fire), key)
+		}
+	}
+	return errs.err()
+}
+
+// validateCriticalThresholds checks the critical bounds of thresholds, which must not be
+// stricter than the warning bounds they escalate.
+func validateCriticalThresholds(feature string, t Thresholds) error {
+	var errs fieldErrors
+	critical := *t.Critical
+	if critical.Critical != nil {
+		errs.add(fmt.Errorf("%w: feature %q critical thresholds cannot be nested", ErrInvalidThresholds, feature), "critical")
+		critical.Critical = nil
+	}
+	if critical.ForWindows != 0 {
+		errs.add(fmt.Errorf("%w: feature %q forWindows applies to both severities, set it outside critical", ErrInvalidThresholds, feature), "forWindows")
+	}
+	if critical.Resolve != nil {
+		errs.add(fmt.Errorf("%w: feature %q resolve applies to both severities, set it outside critical", ErrInvalidThresholds, feature), "resolve")
+		critical.Resolve = nil
+	}
+	errs.add(validateThresholds(feature, critical))
+	for key, bound := range critical.bounds() {
+		warning := t.Bound(key)
+		if *bound == nil || warning == nil {
+			continue
+		}
+		if lower := strings.HasSuffix(key, "Min"); lower && **bound > *warning || !lower && **bound < *warning {
+			errs.add(fmt.Errorf("%w: feature %q critical %s %v is stricter than its warning bound %v", ErrInvalidThresholds, feature, key, **bound, *warning), key)
+		}
+	}
+	if critical.ConstantWindows > 0 && t.ConstantWindows > 0 && critical.ConstantWindows < t.ConstantWindows {
+		errs.add(fmt.Errorf("%w: feature %q critical constantWindows %d is stricter than its warning bound %d", ErrInvalidConstantWindows, feature, critical.ConstantWindows, t.ConstantWindows), "constantWindows")
+	}
+	return errs.err()
+}
+
+func validateCompositeMetrics(metrics []CompositeMetricConfig) error {
+	seen := make(map[string]bool, len(metrics))
+	for _, m := range metrics {
+		if m.Name == "" {
+			return fmt.Errorf("%w: composite metric without a name", ErrInvalidCompositeMetric)
+		}
+		if seen[m.Name] {
+			return fmt.Errorf("%w: duplicate name %q", ErrInvalidCompositeMetric, m.Name)
+		}
+		seen[m.Name] = true
+		e, err := expr.Compile(m.Expr)
+		if err != nil {
+			return fmt.Errorf("%w: %q: %w", ErrInvalidCompositeMetric, m.Name, err)
+		}
+		for _, ident := range e.Identifiers() {
+			if !strings.Contains(ident, ".") {
+				return fmt.Errorf("%w: %q: %q is not of the form <feature>.<variable>", ErrInvalidCompositeMetric, m.Name, ident)
+			}
+		}
+		if m.Min != nil && m.Max != nil && *m.Min > *m.Max {
+			return fmt.Errorf("%w: %q: min is greater than max", ErrInvalidCompositeMetric, m.Name)
+		}
+	}
+	return nil
+}
+
+func validateCorrelations(correlations []CorrelationConfig) error {
+	seen := make(map[string]bool, len(correlations))
+	for _, c := range correlations {
+		if c.Name == "" {
+			return fmt.Errorf("%w: correlation without a name", ErrInvalidCorrelation)
+		}
+		if seen[c.Name] {
+			return fmt.Errorf("%w: duplicate name %q", ErrInvalidCorrelation, c.Name)
+		}
+		seen[c.Name] = true
+		if len(c.Features) != 2 || c.Features[0] == "" || c.Features[1] == "" || c.Features[0] == c.Features[1] {
+			return fmt.Errorf("%w: %q must name two different features", ErrInvalidCorrelation, c.Name)
+		}
+		for _, bound := range []*float64{c.Min, c.Max} {
+			if bound != nil && (*bound < -1 || *bound > 1) {
+				return fmt.Errorf("%w: %q: bounds must be in [-1, 1]", ErrInvalidCorrelation, c.Name)
+			}
+		}
+		if c.Min != nil && c.Max != nil && *c.Min > *c.Max {
+			return fmt.Errorf("%w: %q: min is greater than max", ErrInvalidCorrelation, c.Name)
+		}
+		if c.MinCount < 0 {
+			return fmt.Errorf("%w: %q: minCount cannot be negative", ErrInvalidCorrelation, c.Name)
+		}
+	}
+	return nil
+}
+
+func validateDerivedFields(fields []DerivedFieldConfig) error {
+	seen := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		if f.Name == "" {
+			return fmt.Errorf("%w: derived field without a name", ErrInvalidDerivedField)
+		}
+		if seen[f.Name] {
+			return fmt.Errorf("%w: duplicate name %q", ErrInvalidDerivedField, f.Name)
+		}
+		seen[f.Name] = true
+		if _, err := expr.Compile(f.Expr); err != nil {
+			return fmt.Errorf("%w: %q: %w", ErrInvalidDerivedField, f.Name, err)
+		}
+	}
+	return nil
+}
+
+// validateOutliers checks the outlier rule of a numerical or latency feature, and that
+// an outlierRateMax has one.
+func validateOutliers(f FeatureConfig) error {
+	o := f.Outliers
+	if o == nil {
+		if f.Thresholds.OutlierRateMax != nil || (f.Thresholds.Critical != nil && f.Thresholds.Critical.OutlierRateMax != nil) {
+			return fmt.Errorf("%w: feature %q has outlierRateMax without outliers", ErrInvalidOutliers, f.Name)
+		}
+		return nil
+	}
+	var errs fieldErrors
+	if f.MetricType != MetricTypeNumerical && f.MetricType != MetricTypeLatency {
+		errs.add(fmt.Errorf("%w: feature %q: outliers need a %s or %s feature", ErrInvalidOutliers, f.Name, MetricTypeNumerical, MetricTypeLatency))
+	}
+	switch o.Method {
+	case "", OutlierIQR, OutlierZScore:
+	default:
+		errs.add(fmt.Errorf("%w: feature %q method %q, expected %s or %s", ErrInvalidOutliers, f.Name, o.Method, OutlierIQR, OutlierZScore), "method")
+	}
+	if o.K < 0 {
+		errs.add(fmt.Errorf("%w: feature %q k %v must not be negative", ErrInvalidOutliers, f.Name, o.K), "k")
+	}
+	switch o.Reference {
+	case "", OutlierReferenceWindow, OutlierReferenceBaseline:
+	default:
+		errs.add(fmt.Errorf("%w: feature %q reference %q, expected %s or %s", ErrInvalidOutliers, f.Name, o.Reference, OutlierReferenceWindow, OutlierReferenceBaseline), "reference")
+	}
+	return errs.err()
+}
+
+// validateMetadata checks that every header field names its header, that types are known
+// and that no two sources set the same field.
+func validateMetadata(cfg MetadataConfig) error {
+	var errs fieldErrors
+	seen := make(map[string]bool)
+	check := func(f MetadataFieldConfig, path ...string) {
+		switch {
+		case f.Field == message.TopicKey || f.Field == message.PartitionKey:
+			errs.add(fmt.Errorf("%w: field %q is reserved", ErrInvalidMetadata, f.Field), append(path, "field")...)
+		case seen[f.Field]:
+			errs.add(fmt.Errorf("%w: field %q is set twice", ErrInvalidMetadata, f.Field), append(path, "field")...)
+		}
+		seen[f.Field] = true
+		if f.Type != "" && f.Type != MetadataString && f.Type != MetadataAuto {
+			errs.add(fmt.Errorf("%w: type %q", ErrInvalidMetadata, f.Type), append(path, "type")...)
+		}
+	}
+	if cfg.Key.Field != "" {
+		check(cfg.Key, "key")
+	}
+	for i, h := range cfg.Headers {
+		path := []string{"headers", strconv.Itoa(i)}
+		if h.Header == "" || h.Field == "" {
+			errs.add(fmt.Errorf("%w: header %d needs a header and a field", ErrInvalidMetadata, i), path...)
+			continue
+		}
+		check(h, path...)
+	}
+	return errs.err()
+}
+
+// validateCoercion checks the decimal separator and that every time format holds at
+// least one element of the reference time.
+func validateCoercion(cfg CoercionConfig) error {
+	var errs fieldErrors
+	if cfg.DecimalSeparator != "." && cfg.DecimalSeparator != "," {
+		errs.add(fmt.Errorf("%w: decimalSeparator must be \".\" or \",\", got %q", ErrInvalidCoercion, cfg.DecimalSeparator), "decimalSeparator")
+	}
+	reference := time.Date(2006, time.January, 2, 15, 4, 5, 0, time.UTC)
+	for i, format := range cfg.TimeFormats {
+		if reference.Format(format) == format {
+			errs.add(fmt.Errorf("%w: time format %q has no date or time element", ErrInvalidCoercion, format), "timeFormats", strconv.Itoa(i))
+		}
+	}
+	return errs.err()
+}
+
+// validateScript checks that every step has the fields its operation needs and that its
+// expressions and Lua scripts compile.
+func validateScript(steps []ScriptStepConfig) error {
+	var errs fieldErrors
+	for i, step := range steps {
+		path := strconv.Itoa(i)
+		if step.Field == "" && step.Op != ScriptLua {
+			errs.add(fmt.Errorf("%w: step %d (%s) has no field", ErrInvalidScript, i, step.Op), path, "field")
+		}
+		switch step.Op {
+		case ScriptRename:
+			if step.To == "" || step.To == step.Field {
+				errs.add(fmt.Errorf("%w: rename step %d needs a to field other than %q", ErrInvalidScript, i, step.Field), path, "to")
+			}
+		case ScriptSet:
+			if _, err := expr.Compile(step.Expr); err != nil {
+				errs.add(fmt.Errorf("%w: set step %d: %w", ErrInvalidScript, i, err), path, "expr")
+			}
+		case ScriptDelete:
+		case ScriptUnpack:
+			switch step.Encoding {
+			case "", EncodingJSON, EncodingBase64:
+			default:
+				errs.add(fmt.Errorf("%w: unpack step %d encoding %q", ErrInvalidScript, i, step.Encoding), path, "encoding")
+			}
+		case ScriptLua:
+			if (step.Code == "") == (step.File == "") || step.Timeout < 0 {
+				errs.add(fmt.Errorf("%w: lua step %d needs one of code and file, and a timeout that is not negative", ErrInvalidScript, i), path)
+				break
+			}
+			name, source, err := step.LuaSource()
+			if err == nil {
+				_, err = luascript.Compile(name, source, step.Timeout)
+			}
+			if err != nil {
+				key := "code"
+				if step.File != "" {
+					key = "file"
+				}
+				errs.add(fmt.Errorf("%w: lua step %d: %w", ErrInvalidScript, i, err), path, key)
+			}
+		default:
+			errs.add(fmt.Errorf("%w: step %d op %q", ErrInvalidScript, i, step.Op), path, "op")
+		}
+		if step.When != "" {
+			if _, err := expr.Compile(step.When); err != nil {
+				errs.add(fmt.Errorf("%w: step %d when: %w", ErrInvalidScript, i, err), path, "when")
+			}
+		}
+	}
+	return errs.err()
+}
+
+// validateGraph checks that every stage has a unique name and the settings of its type,
+// that inputs name the parser or a filter or script stage without forming a cycle, that
+// every filter and script stage feeds another stage, and that no feature is claimed by
+// two calculator stages. Calculator stages window by processing time in this process, so
+// they cannot be combined with event time, spilled window state or scaling out.
+func validateGraph(cfg PipelineConfig, features []FeatureConfig) error {
+	stages := cfg.Graph.Stages
+	if len(stages) == 0 {
+		return nil
+	}
+	var errs fieldErrors
+	byName := make(map[string]GraphStageConfig, len(stages))
+	for _, s := range stages {
+		if s.Name == "" || s.Name == GraphSource {
+			errs.add(fmt.Errorf("%w: stage name %q", ErrInvalidGraph, s.Name), "stages", s.Name)
+			continue
+		}
+		if _, dup := byName[s.Name]; dup {
+			errs.add(fmt.Errorf("%w: duplicate stage %q", ErrInvalidGraph, s.Name), "stages", s.Name)
+		}
+		byName[s.Name] = s
+	}
+
+	fed := make(map[string]bool, len(stages))
+	for _, s := range stages {
+		at := []string{"stages", s.Name}
+		switch s.Type {
+		case StageFilter:
+			if _, err := expr.Compile(s.Filter); err != nil {
+				errs.add(fmt.Errorf("%w: stage %q filter: %w", ErrInvalidGraph, s.Name, err), append(at, "filter")...)
+			}
+		case StageScript:
+			if len(s.Script) == 0 {
+				errs.add(fmt.Errorf("%w: script stage %q has no steps", ErrInvalidGraph, s.Name), append(at, "script")...)
+			}
+			errs.add(validateScript(s.Script), append(at, "script")...)
+		case StageCalculator:
+			if len(s.Features) == 0 {
+				errs.add(fmt.Errorf("%w: calculator stage %q claims no features", ErrInvalidGraph, s.Name), append(at, "features")...)
+			}
+			for _, pattern := range s.Features {
+				if _, err := path.Match(pattern, ""); err != nil {
+					errs.add(fmt.Errorf("%w: stage %q feature pattern %q: %w", ErrInvalidGraph, s.Name, pattern, err), append(at, "features")...)
+				}
+			}
+		default:
+			errs.add(fmt.Errorf("%w: stage %q type %q", ErrInvalidGraph, s.Name, s.Type), append(at, "type")...)
+		}
+
+		if s.Input == GraphSource {
+			continue
+		}
+		input, ok := byName[s.Input]
+		switch {
+		case !ok:
+			errs.add(fmt.Errorf("%w: stage %q input %q is not a stage", ErrInvalidGraph, s.Name, s.Input), append(at, "input")...)
+			continue
+		case input.Type == StageCalculator:
+			errs.add(fmt.Errorf("%w: stage %q reads calculator stage %q", ErrInvalidGraph, s.Name, s.Input), append(at, "input")...)
+			continue
+		}
+		fed[s.Input] = true
+		// Inputs lead back to the parser within as many steps as there are stages
+		for range stages {
+			if input.Input == GraphSource {
+				break
+			}
+			if input, ok = byName[input.Input]; !ok {
+				break // Reported for the stage naming it
+			}
+		}
+		if ok && input.Input != GraphSource {
+			errs.add(fmt.Errorf("%w: stage %q input %q does not lead back to the parser", ErrInvalidGraph, s.Name, s.Input), append(at, "input")...)
+		}
+	}
+	for _, s := range stages {
+		if s.Type != StageCalculator && !fed[s.Name] {
+			errs.add(fmt.Errorf("%w: stage %q feeds no stage", ErrInvalidGraph, s.Name), "stages", s.Name)
+		}
+	}
+
+	calculators := cfg.Graph.Calculators()
+	for _, f := range features {
+		var claimedBy []string
+		for _, s := range calculators {
+			if s.Claims(f) {
+				claimedBy = append(claimedBy, s.Name)
+			}
+		}
+		if len(claimedBy) > 1 {
+			errs.add(fmt.Errorf("%w: feature %q is claimed by stages %s", ErrInvalidGraph, cmp.Or(f.Name, f.Pattern), strings.Join(claimedBy, ", ")), "stages", claimedBy[1], "features")
+		}
+	}
+	if len(calculators) > 0 {
+		switch {
+		case cfg.EventTime.Enabled:
+			errs.add(fmt.Errorf("%w: calculator stages window by processing time, so they cannot be used with eventTime", ErrInvalidGraph), "stages")
+		case cfg.WindowState.MaxMemoryMB > 0:
+			errs.add(fmt.Errorf("%w: calculator stages cannot spill window state", ErrInvalidGraph), "stages")
+		case cfg.Scaling.Enabled:
+			errs.add(fmt.Errorf("%w: calculator stages cannot be scaled out", ErrInvalidGraph), "stages")
+		}
+	}
+	return errs.err()
+}
+
+func validateFormat(cfg PipelineConfig) error {
+	switch cfg.Format {
+	case FormatJSON, FormatJSONLines, FormatMsgPack, FormatCBOR, FormatAuto:
+		return nil
+	case FormatCSV:
+	default:
+		return fmt.Errorf("%w: unknown format %q", ErrInvalidFormat, cfg.Format)
+	}
+	if len(cfg.CSV.Columns) == 0 && !cfg.CSV.Header {
+		return fmt.Errorf("%w: csv requires columns or a header row", ErrInvalidFormat)
+	}
+	if d := []rune(cfg.CSV.Delimiter); len(d) != 1 || d[0] == '"' || d[0] == '\r' || d[0] == '\n' {
+		return fmt.Errorf("%w: csv delimiter must be a single character other than a quote or newline, got %q", ErrInvalidFormat, cfg.CSV.Delimiter)
+	}
+	return nil
+}
+
+// validateSchemaRegistry checks the schema registry the auto format looks schemas up in,
+// if any.
+func validateSchemaRegistry(cfg SchemaRegistryConfig) error {
+	if cfg.URL == "" {
+		return nil
+	}
+	if u, err := url.Parse(cfg.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%w: url %q must be an http(s) URL", ErrInvalidFormat, cfg.URL)
+	}
+	if cfg.Timeout <= 0 {
+		return fmt.Errorf("%w: timeout must be positive", ErrInvalidFormat)
+	}
+	return nil
+}
+
+func validateLoadShedding(cfg LoadSheddingConfig) error {
+	if !cfg.Enabled {
+		return nil
+	}
+	if cfg.LowWatermark < 0 || cfg.LowWatermark >= cfg.HighWatermark || cfg.HighWatermark > 1 {
+		return fmt.Errorf("%w: watermarks must satisfy 0 <= lowWatermark < highWatermark <= 1", ErrInvalidLoadShedding)
+	}
+	if cfg.NormalRate <= 0 || cfg.NormalRate > 1 || cfg.LowRate < 0 || cfg.LowRate > 1 {
+		return fmt.Errorf("%w: normalRate must be in (0, 1] and lowRate in [0, 1]", ErrInvalidLoadShedding)
+	}
+	if cfg.MaxHeapMB < 0 || cfg.MaxLag < 0 {
+		return fmt.Errorf("%w: maxHeapMB and maxLag cannot be negative", ErrInvalidLoadShedding)
+	}
+	return nil
+}
+
+// validateTimestampOrdering checks the tolerances and rate thresholds of event timestamps.
+func validateTimestampOrdering(cfg LatencyConfig) error {
+	var errs fieldErrors
+	if cfg.FutureTolerance < 0 {
+		errs.add(fmt.Errorf("%w: futureTolerance %v cannot be negative", ErrInvalidTimestampOrdering, cfg.FutureTolerance), "futureTolerance")
+	}
+	if cfg.OutOfOrderTolerance < 0 {
+		errs.add(fmt.Errorf("%w: outOfOrderTolerance %v cannot be negative", ErrInvalidTimestampOrdering, cfg.OutOfOrderTolerance), "outOfOrderTolerance")
+	}
+	for _, rate := range []struct {
+		key   string
+		value *float64
+	}{
+		{"futureRateMax", cfg.FutureRateMax},
+		{"outOfOrderRateMax", cfg.OutOfOrderRateMax},
+	} {
+		if rate.value != nil && (*rate.value < 0 || *rate.value > 1) {
+			errs.add(fmt.Errorf("%w: %s %v must be in [0, 1]", ErrInvalidTimestampOrdering, rate.key, *rate.value), rate.key)
+		}
+	}
+	return errs.err()
+}
+
+// validateThroughput checks that the bounds are coherent and the change and completeness
+// references cover at least one window.
+func validateThroughput(cfg ThroughputConfig) error {
+	var errs fieldErrors
+	if cfg.Min != nil && *cfg.Min < 0 {
+		errs.add(fmt.Errorf("%w: min %v cannot be negative", ErrInvalidThroughput, *cfg.Min), "min")
+	}
+	if cfg.Min != nil && cfg.Max != nil && *cfg.Min > *cfg.Max {
+		errs.add(fmt.Errorf("%w: min %v is greater than max %v", ErrInvalidThroughput, *cfg.Min, *cfg.Max), "min")
+	}
+	if cfg.ChangeMax != nil && *cfg.ChangeMax <= 0 {
+		errs.add(fmt.Errorf("%w: changeMax %v must be positive", ErrInvalidThroughput, *cfg.ChangeMax), "changeMax")
+	}
+	if cfg.RecentWindows < 1 {
+		errs.add(fmt.Errorf("%w: recentWindows %d must be at least 1", ErrInvalidThroughput, cfg.RecentWindows), "recentWindows")
+	}
+	if cfg.NoDataWindows < 0 {
+		errs.add(fmt.Errorf("%w: noDataWindows %d cannot be negative", ErrInvalidThroughput, cfg.NoDataWindows), "noDataWindows")
+	}
+	c := cfg.Completeness
+	if c.Expected != nil && *c.Expected <= 0 {
+		errs.add(fmt.Errorf("%w: completeness expected %v must be positive", ErrInvalidThroughput, *c.Expected), "completeness", "expected")
+	}
+	if c.Min != nil && (*c.Min <= 0 || *c.Min > 1) {
+		errs.add(fmt.Errorf("%w: completeness min %v must be in (0, 1]", ErrInvalidThroughput, *c.Min), "completeness", "min")
+	}
+	if c.Expected == nil && c.LearnWindows < 1 {
+		errs.add(fmt.Errorf("%w: completeness learnWindows %d must be at least 1", ErrInvalidThroughput, c.LearnWindows), "completeness", "learnWindows")
+	}
+	return errs.err()
+}
+
+// validateSchemaTracking checks the share and field bounds and the ignored field patterns.
+func validateSchemaTracking(cfg SchemaTrackingConfig) error {
+	var errs fieldErrors
+	if cfg.MinShare < 0 || cfg.MinShare > 1 {
+		errs.add(fmt.Errorf("%w: minShare %v must be in [0, 1]", ErrInvalidSchemaTracking, cfg.MinShare), "minShare")
+	}
+	if cfg.MaxFields <= 0 {
+		errs.add(fmt.Errorf("%w: maxFields %d must be positive", ErrInvalidSchemaTracking, cfg.MaxFields), "maxFields")
+	}
+	for i, pattern := range cfg.IgnoreFields {
+		if _, err := path.Match(pattern, ""); err != nil {
+			errs.add(fmt.Errorf("%w: ignoreFields %q: %w", ErrInvalidSchemaTracking, pattern, err), "ignoreFields", strconv.Itoa(i))
+		}
+	}
+	return errs.err()
+}
+
+// validatePartitionStats checks the comparison bounds and that the compared features are
+// read from a single field of the messages.
+func validatePartitionStats(cfg PartitionStatsConfig, features []FeatureConfig) error {
+	var errs fieldErrors
+	if cfg.MinMessages <= 0 {
+		errs.add(fmt.Errorf("%w: minMessages %d must be positive", ErrInvalidPartitionStats, cfg.MinMessages), "minMessages")
+	}
+	if cfg.NullRateRatio <= 1 {
+		errs.add(fmt.Errorf("%w: nullRateRatio %v must be greater than 1", ErrInvalidPartitionStats, cfg.NullRateRatio), "nullRateRatio")
+	}
+	if cfg.MinNullRate <= 0 || cfg.MinNullRate > 1 {
+		errs.add(fmt.Errorf("%w: minNullRate %v must be in (0, 1]", ErrInvalidPartitionStats, cfg.MinNullRate), "minNullRate")
+	}
+	if cfg.MeanDeviation != nil && *cfg.MeanDeviation <= 0 {
+		errs.add(fmt.Errorf("%w: meanDeviation %v must be positive", ErrInvalidPartitionStats, *cfg.MeanDeviation), "meanDeviation")
+	}
+	for i, name := range cfg.Features {
+		j := slices.IndexFunc(features, func(f FeatureConfig) bool { return f.Name == name })
+		switch {
+		case j < 0:
+			errs.add(fmt.Errorf("%w: %q is not a configured feature", ErrInvalidPartitionStats, name), "features", strconv.Itoa(i))
+		case features[j].Pattern != "" || features[j].Scope == ScopeSession:
+			errs.add(fmt.Errorf("%w: feature %q is not read from a single message field", ErrInvalidPartitionStats, name), "features", strconv.Itoa(i))
+		}
+	}
+	return errs.err()
+}
+
+// validateSeasonal checks a feature's seasonal thresholds. Periods must be whole windows,
+// so that each window has a counterpart one period earlier.
+// extensionName matches the names of custom metrics and checks: identifiers, since custom
+// metrics are condition variables.
+var extensionName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// validateExtensions checks that a feature's custom metrics or checks have a type and
+// unique names usable as condition variables. Types are resolved when the pipeline starts,
+// since extensions are registered in code.
+func validateExtensions(feature, key string, extensions []ExtensionConfig) error {
+	var errs fieldErrors
+	seen := make(map[string]bool, len(extensions))
+	for i, e := range extensions {
+		path := strconv.Itoa(i)
+		if e.Type == "" {
+			errs.add(fmt.Errorf("%w: feature %q %s entry %d has no type", ErrInvalidExtension, feature, key, i), path, "type")
+			continue
+		}
+		name := e.ExtensionName()
+		if !extensionName.MatchString(name) {
+			errs.add(fmt.Errorf("%w: feature %q %s name %q must be an identifier", ErrInvalidExtension, feature, key, name), path, "name")
+		} else if seen[name] {
+			errs.add(fmt.Errorf("%w: feature %q has several %s named %q", ErrInvalidExtension, feature, key, name), path, "name")
+		}
+		seen[name] = true
+	}
+	return errs.err()
+}
+
+func validateSeasonal(feature string, s SeasonalThresholds, windowSize time.Duration) error {
+	var errs fieldErrors
+	for i, period := range s.Periods {
+		if period <= 0 || (windowSize > 0 && period%windowSize != 0) {
+			errs.add(fmt.Errorf("%w: feature %q period %v must be a positive multiple of the window size %v", ErrInvalidSeasonal, feature, period, windowSize), "periods", strconv.Itoa(i))
+		}
+	}
+	for key, change := range map[string]*float64{"countChange": s.CountChange, "nullRateChange": s.NullRateChange, "meanChange": s.MeanChange} {
+		if change != nil && *change <= 0 {
+			errs.add(fmt.Errorf("%w: feature %q %s %v must be positive", ErrInvalidSeasonal, feature, key, *change), key)
+		}
+	}
+	if len(s.Periods) == 0 && (s.CountChange != nil || s.NullRateChange != nil || s.MeanChange != nil) {
+		errs.add(fmt.Errorf("%w: feature %q has seasonal tolerances without periods", ErrInvalidSeasonal, feature), "periods")
+	}
+	return errs.err()
+}
+
+func validateSkew(cfg SkewConfig) error {
+	if !cfg.Enabled {
+		return nil
+	}
+	if (cfg.ReferenceTopic == "") == (cfg.BaselineFile == "") {
+		return ErrInvalidSkewReference
+	}
+	if cfg.Bins < 2 {
+		return fmt.Errorf("%w: %d", ErrInvalidSkewBins, cfg.Bins)
+	}
+	if cfg.MaxSamples < cfg.Bins {
+		return fmt.Errorf("%w: %d", ErrInvalidSkewSamples, cfg.MaxSamples)
+	}
+	return nil
+}
+
+func validateRemoteWrite(cfg RemoteWriteConfig) error {
+	if !cfg.Enabled {
+		return nil
+	}
+	if cfg.URL == "" {
+		return ErrEmptyRemoteWriteURL
+	}
+	if cfg.Timeout <= 0 || cfg.FlushInterval <= 0 || cfg.MaxBatchSize <= 0 || cfg.QueueSize <= 0 || cfg.MaxRetries < 0 {
+		return ErrInvalidRemoteWrite
+	}
+	return nil
+}
+
+func validateTelemetry(cfg TelemetryConfig) error {
+	if !cfg.Enabled {
+		return nil
+	}
+	if cfg.TraceSampleRatio < 0 || cfg.TraceSampleRatio > 1 {
+		return fmt.Errorf("%w: %v", ErrInvalidTraceSampleRatio, cfg.TraceSampleRatio)
+	}
+	if cfg.MetricInterval <= 0 {
+		return ErrInvalidMetricInterval
+	}
+	return nil
+}
+
+// validateSketches checks the sketch parameters. Distinct value thresholds use the
+// HyperLogLog precision even when sketch export is disabled.
+func validateSketches(cfg SketchConfig, distinct bool) error {
+	if (cfg.Enabled || distinct) && (cfg.Precision < sketch.MinPrecision || cfg.Precision > sketch.MaxPrecision) {
+		return fmt.Errorf("%w: precision %d", ErrInvalidSketch, cfg.Precision)
+	}
+	if !cfg.Enabled {
+		return nil
+	}
+	if cfg.RelativeAccuracy <= 0 || cfg.RelativeAccuracy >= 1 {
+		return fmt.Errorf("%w: relativeAccuracy %v", ErrInvalidSketch, cfg.RelativeAccuracy)
+	}
+	if cfg.FrequencyWidth < 1 || cfg.FrequencyDepth < 1 {
+		return fmt.Errorf("%w: frequencyWidth %d, frequencyDepth %d", ErrInvalidSketch, cfg.FrequencyWidth, cfg.FrequencyDepth)
+	}
+	return nil
+}
+
+func validateSinks(cfg SinksConfig) error {
+	if cfg.MaxNotifyAge < 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidMaxNotifyAge, cfg.MaxNotifyAge)
+	}
+	if len(cfg.Outputs) == 0 {
+		return validateRoutes(cfg.Routes, nil)
+	}
+	if cfg.QueueSize <= 0 || cfg.MaxBatchSize <= 0 || cfg.FlushInterval <= 0 || cfg.Timeout <= 0 {
+		return ErrInvalidSinks
+	}
+	if cfg.MaxRetries < 0 || (cfg.MaxRetries > 0 && cfg.RetryBackoff <= 0) || cfg.DedupRetention < 0 ||
+		cfg.MaxRetryBackoff < 0 || cfg.OverflowSize < 0 {
+		return ErrInvalidSinkDelivery
+	}
+	if b := cfg.CircuitBreaker; b.FailureThreshold < 0 || (b.FailureThreshold > 0 && b.OpenDuration <= 0) {
+		return ErrInvalidCircuitBreaker
+	}
+	names := make(map[string]bool, len(cfg.Outputs))
+	for _, out := range cfg.Outputs {
+		if out.Type == "" {
+			return fmt.Errorf("%w: output %q", ErrEmptySinkType, out.Name)
+		}
+		name := out.Name
+		if name == "" {
+			name = out.Type
+		}
+		if names[name] {
+			return fmt.Errorf("%w: %q", ErrDuplicateSinkName, name)
+		}
+		if retries, backoff := out.Retries(cfg); retries < 0 || out.RetryBackoff < 0 || (retries > 0 && backoff <= 0) {
+			return fmt.Errorf("%w: output %q", ErrInvalidSinkDelivery, name)
+		}
+		if out.QueueSize < 0 {
+			return fmt.Errorf("%w: output %q", ErrInvalidSinks, name)
+		}
+		for _, pattern := range out.Features {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("%w: output %q: feature pattern %q: %w", ErrInvalidSinkFilter, name, pattern, err)
+			}
+		}
+		if out.Template != "" && out.TemplateFile != "" {
+			return fmt.Errorf("%w: output %q", ErrInvalidSinkTemplate, name)
+		}
+		names[name] = true
+	}
+	return validateRoutes(cfg.Routes, names)
+}
+
+// validateRoutes checks that routes send alerts to configured sinks.
+func validateRoutes(routes []RouteConfig, sinks map[string]bool) error {
+	for i, r := range routes {
+		name := cmp.Or(r.Name, strconv.Itoa(i))
+		if len(r.Sinks) == 0 {
+			return fmt.Errorf("%w: route %q has no sinks", ErrInvalidRoute, name)
+		}
+		for _, s := range r.Sinks {
+			if !sinks[s] {
+				return fmt.Errorf("%w: route %q: %q is not a configured sink", ErrInvalidRoute, name, s)
+			}
+		}
+		for _, pattern := range r.Features {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("%w: route %q: feature pattern %q: %w", ErrInvalidRoute, name, pattern, err)
+			}
+		}
+		for _, severity := range r.Severities {
+			switch severity {
+			case "info", "warning", "critical":
+			default:
+				return fmt.Errorf("%w: route %q: unknown severity %q", ErrInvalidRoute, name, severity)
+			}
+		}
+	}
+	return nil
+}
+
+func validateActions(cfg ActionsConfig) error {
+	if len(cfg.Triggers) == 0 {
+		return nil
+	}
+	if cfg.QueueSize <= 0 || cfg.Timeout <= 0 || cfg.Cooldown < 0 {
+		return ErrInvalidActions
+	}
+	names := make(map[string]bool, len(cfg.Triggers))
+	for _, a := range cfg.Triggers {
+		if a.Type == "" {
+			return fmt.Errorf("%w: trigger %q has no type", ErrInvalidAction, a.Name)
+		}
+		name := cmp.Or(a.Name, a.Type)
+		if names[name] {
+			return fmt.Errorf("%w: duplicate name %q", ErrInvalidAction, name)
+		}
+		names[name] = true
+		if a.Cooldown < 0 {
+			return fmt.Errorf("%w: %q: cooldown cannot be negative", ErrInvalidAction, name)
+		}
+		for _, pattern := range slices.Concat(a.Features, a.Checks) {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("%w: %q: pattern %q: %w", ErrInvalidAction, name, pattern, err)
+			}
+		}
+		for _, severity := range a.Severities {
+			switch severity {
+			case "info", "warning", "critical":
+			default:
+				return fmt.Errorf("%w: %q: unknown severity %q", ErrInvalidAction, name, severity)
+			}
+		}
+	}
+	return nil
+}
+
+// validateErrors checks that internal errors are notified to configured sinks.
+func validateErrors(cfg ErrorsConfig, sinks SinksConfig) error {
+	switch cfg.NotifySeverity {
+	case "warning", "error", "critical":
+	default:
+		return fmt.Errorf("%w: unknown notifySeverity %q", ErrInvalidErrors, cfg.NotifySeverity)
+	}
+	if cfg.NotifyInterval < 0 {
+		return fmt.Errorf("%w: notifyInterval cannot be negative", ErrInvalidErrors)
+	}
+	for _, name := range cfg.NotifySinks {
+		if !slices.ContainsFunc(sinks.Outputs, func(out SinkConfig) bool { return cmp.Or(out.Name, out.Type) == name }) {
+			return fmt.Errorf("%w: %q is not a configured sink", ErrInvalidErrors, name)
+		}
+	}
+	return nil
+}
+
+func validateMaintenanceWindow(w MaintenanceWindowConfig) error {
+	if len(w.Selector) == 0 && len(w.Features) == 0 && len(w.Checks) == 0 {
+		return fmt.Errorf("%w: no selector, features or checks", ErrInvalidMaintenanceWindow)
+	}
+	for _, pattern := range slices.Concat(w.Features, w.Checks) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("%w: pattern %q: %w", ErrInvalidMaintenanceWindow, pattern, err)
+		}
+	}
+
+	if w.Schedule == "" {
+		if w.Duration != 0 || w.Timezone != "" {
+			return fmt.Errorf("%w: duration and timezone require a schedule", ErrInvalidMaintenanceWindow)
+		}
+		start, end, err := w.Period()
+		if err != nil {
+			return fmt.Errorf("%w: start and end must be RFC 3339 times: %w", ErrInvalidMaintenanceWindow, err)
+		}
+		if !end.After(start) {
+			return fmt.Errorf("%w: end %s is not after start %s", ErrInvalidMaintenanceWindow, w.End, w.Start)
+		}
+		return nil
+	}
+	if w.Start != "" || w.End != "" {
+		return fmt.Errorf("%w: set either start and end, or a schedule", ErrInvalidMaintenanceWindow)
+	}
+	if _, err := cron.Parse(w.Schedule); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidMaintenanceWindow, err)
+	}
+	if w.Duration <= 0 {
+		return fmt.Errorf("%w: scheduled windows need a positive duration", ErrInvalidMaintenanceWindow)
+	}
+	if _, err := time.LoadLocation(w.Timezone); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidMaintenanceWindow, err)
+	}
+	return nil
+}
+
+func validateSubscription(cfg KafkaConfig, scaling ScalingConfig) error {
+	var errs fieldErrors
+	switch {
+	case cfg.Topic == "" && cfg.TopicPattern == "":
+		errs.add(ErrEmptyKafkaTopic, "topic")
+	case cfg.Topic != "" && cfg.TopicPattern != "":
+		errs.add(fmt.Errorf("%w: set topic or topicPattern, not both", ErrInvalidSubscription), "topicPattern")
+	case cfg.TopicPattern != "":
+		if _, err := regexp.Compile(cfg.TopicPattern); err != nil {
+			errs.add(fmt.Errorf("%w: %w", ErrInvalidSubscription, err), "topicPattern")
+		}
+	}
+	seen := make(map[int]bool, len(cfg.Partitions))
+	for _, p := range cfg.Partitions {
+		if p < 0 || seen[p] {
+			errs.add(fmt.Errorf("%w: partitions must be distinct and non-negative, got %v", ErrInvalidSubscription, cfg.Partitions), "partitions")
+			break
+		}
+		seen[p] = true
+	}
+	if len(cfg.Partitions) > 0 && scaling.Enabled {
+		errs.add(fmt.Errorf("%w: scaled-out instances share partitions through the consumer group, so partitions cannot be assigned", ErrInvalidScaling), "partitions")
+	}
+	return errs.err()
+}
+
+// validateWindowAlignment checks the window boundaries and flush grace of a pipeline.
+func validateWindowAlignment(cfg PipelineConfig) error {
+	a := cfg.WindowAlignment
+	if cfg.WindowSize <= 0 {
+		return nil // Reported on windowSize
+	}
+	var errs fieldErrors
+	if a.Offset <= -cfg.WindowSize || a.Offset >= cfg.WindowSize {
+		errs.add(fmt.Errorf("%w: offset %v must be shorter than windowSize %v", ErrInvalidWindowAlignment, a.Offset, cfg.WindowSize), "offset")
+	}
+	if a.FlushGrace < 0 || a.FlushGrace >= cfg.WindowSize {
+		errs.add(fmt.Errorf("%w: flushGrace %v must be in [0, windowSize %v)", ErrInvalidWindowAlignment, a.FlushGrace, cfg.WindowSize), "flushGrace")
+	}
+	if a.TimeZone != "" {
+		if _, err := time.LoadLocation(a.TimeZone); err != nil {
+			errs.add(fmt.Errorf("%w: timeZone %q: %w", ErrInvalidWindowAlignment, a.TimeZone, err), "timeZone")
+		}
+	}
+	return errs.err()
+}
+
+// validateRollups checks that rollup resolutions are distinct whole numbers of windows
+// longer than one.
+func validateRollups(cfg PipelineConfig) error {
+	if cfg.WindowSize <= 0 {
+		return nil // Reported on windowSize
+	}
+	var errs fieldErrors
+	for i, size := range cfg.Rollups {
+		switch {
+		case size <= cfg.WindowSize || size%cfg.WindowSize != 0:
+			errs.add(fmt.Errorf("%w: %v must be a multiple of windowSize %v longer than it", ErrInvalidRollup, size, cfg.WindowSize), strconv.Itoa(i))
+		case slices.Index(cfg.Rollups, size) < i:
+			errs.add(fmt.Errorf("%w: duplicate resolution %v", ErrInvalidRollup, size), strconv.Itoa(i))
+		}
+	}
+	return errs.err()
+}
+
+// validateEventTime checks the event-time windowing of a pipeline.
+func validateEventTime(cfg PipelineConfig) error {
+	et := cfg.EventTime
+	if !et.Enabled {
+		return nil
+	}
+	var errs fieldErrors
+	if cfg.Latency.TimestampField == "" {
+		errs.add(fmt.Errorf("%w: requires pipeline latency timestampField", ErrInvalidEventTime), "enabled")
+	}
+	if et.AllowedLateness < 0 {
+		errs.add(fmt.Errorf("%w: allowedLateness %v cannot be negative", ErrInvalidEventTime, et.AllowedLateness), "allowedLateness")
+	}
+	switch et.LatePolicy {
+	case LatePolicyDrop, LatePolicyAccumulate:
+	case LatePolicyReemit:
+		if et.Retention <= 0 {
+			errs.add(fmt.Errorf("%w: retention must be positive with latePolicy %s", ErrInvalidEventTime, et.LatePolicy), "retention")
+		}
+	default:
+		errs.add(fmt.Errorf("%w: latePolicy %q, expected %s, %s or %s", ErrInvalidEventTime, et.LatePolicy, LatePolicyDrop, LatePolicyReemit, LatePolicyAccumulate), "latePolicy")
+	}
+	if cfg.Scaling.Enabled && et.LatePolicy != LatePolicyDrop {
+		errs.add(fmt.Errorf("%w: the merger drops partials of merged windows, so scaled-out pipelines only support latePolicy %s", ErrInvalidEventTime, LatePolicyDrop), "latePolicy")
+	}
+	return errs.err()
+}
+
+func validateScaling(cfg ScalingConfig, skew SkewConfig, leader LeaderElectionConfig) error {
+	if !cfg.Enabled {
+		return nil
+	}
+	if cfg.Topic == "" {
+		return fmt.Errorf("%w: topic cannot be empty", ErrInvalidScaling)
+	}
+	if cfg.Instances < 1 {
+		return fmt.Errorf("%w: instances must be at least 1, got %d", ErrInvalidScaling, cfg.Instances)
+	}
+	if cfg.MergeTimeout < 0 {
+		return fmt.Errorf("%w: mergeTimeout cannot be negative", ErrInvalidScaling)
+	}
+	if skew.Enabled {
+		return fmt.Errorf("%w: skew monitoring compares each instance's own distributions, so it cannot be scaled out", ErrInvalidScaling)
+	}
+	if leader.Enabled {
+		return fmt.Errorf("%w: only the leader consumes with leaderElection enabled, so instances cannot share partitions", ErrInvalidScaling)
+	}
+	return nil
+}
+
+func validateLeaderElection(cfg LeaderElectionConfig) error {
+	if !cfg.Enabled {
+		return nil
+	}
+	if cfg.LeaseName == "" {
+		return fmt.Errorf("%w: leaseName cannot be empty", ErrInvalidLeaderElection)
+	}
+	if cfg.RetryPeriod <= 0 || cfg.RenewDeadline <= cfg.RetryPeriod || cfg.LeaseDuration <= cfg.RenewDeadline {
+		return fmt.Errorf("%w: leaseDuration %s must exceed renewDeadline %s, which must exceed the positive retryPeriod %s",
+			ErrInvalidLeaderElection, cfg.LeaseDuration, cfg.RenewDeadline, cfg.RetryPeriod)
+	}
+	return nil
+}
+
+// validateHTTP checks the HTTP TLS settings, and that client certificates are verified
+// for the surfaces requiring them.
+func validateHTTP(h HTTPConfig) error {
+	var errs fieldErrors
+	if (h.TLS.CertFile == "") != (h.TLS.KeyFile == "") || (h.TLS.ClientCAFile != "" && h.TLS.CertFile == "") {
+		errs.add(ErrInvalidHTTPTLS, "tls")
+	}
+	for _, surface := range []struct {
+		name string
+		cfg  SurfaceConfig
+	}{{"metrics", h.Metrics}, {"admin", h.Admin}, {"ui", h.UI}, {"api", h.API}} {
+		for i, mw := range surface.cfg.Middleware {
+			if mw.Type == "clientCert" && h.TLS.ClientCAFile == "" { // middleware.TypeClientCert
+				errs.add(ErrClientCertWithoutCA, surface.name, "middleware", strconv.Itoa(i))
+			}
+		}
+	}
+	return errs.err()
+}
+
+func validateAudit(cfg AuditConfig) error {
+	if !cfg.Enabled {
+		return nil
+	}
+	if cfg.Path == "" {
+		return ErrEmptyAuditPath
+	}
+	if cfg.MaxSize < 0 || cfg.MaxBackups < 0 || cfg.MaxAge < 0 {
+		return ErrInvalidAudit
+	}
+	return nil
+}
+
+func validateSigning(cfg SigningConfig) error {
+	if !cfg.Enabled {
+		return nil
+	}
+	switch cfg.Algorithm {
+	case SigningAlgorithmHMACSHA256, SigningAlgorithmEd25519:
+	default:
+		return fmt.Errorf("%w: %q", ErrUnknownSigningAlgorithm, cfg.Algorithm)
+	}
+	if cfg.KeyFile == "" {
+		return ErrEmptySigningKeyFile
 	}
 	return nil
 }
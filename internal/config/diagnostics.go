@@ -0,0 +1,320 @@
+package config
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sanspareilsmyn/featurelens/internal/expr"
+)
+
+// FieldError is a validation problem located at a setting of the configuration.
+type FieldError struct {
+	// Path holds the keys leading to the setting from the document root. List items are
+	// addressed by their name (or pattern), e.g. [features feature_a thresholds meanMin].
+	Path []string
+	File string // Configuration file that set it, "" when unknown (e.g. defaults)
+	Line int    // 0 when unknown
+	Err  error
+}
+
+func (e *FieldError) Error() string {
+	if e.Line > 0 {
+		return e.File + ":" + strconv.Itoa(e.Line) + ": " + e.Err.Error()
+	}
+	if len(e.Path) > 0 {
+		return e.Key() + ": " + e.Err.Error()
+	}
+	return e.Err.Error()
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// Key returns the dotted path of the setting, e.g. features.feature_a.thresholds.meanMin.
+func (e *FieldError) Key() string {
+	return strings.Join(e.Path, ".")
+}
+
+// ValidationError lists every problem found while validating a configuration.
+type ValidationError struct {
+	Errors []*FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+func (e *ValidationError) Unwrap() []error {
+	errs := make([]error, len(e.Errors))
+	for i, err := range e.Errors {
+		errs[i] = err
+	}
+	return errs
+}
+
+// fieldErrors collects validation problems, locating each at a setting.
+type fieldErrors []*FieldError
+
+// add records err at the setting path. The problems of a nested ValidationError, and
+// FieldErrors, keep their own paths, relative to path.
+func (l *fieldErrors) add(err error, path ...string) {
+	switch e := err.(type) {
+	case nil:
+	case *ValidationError:
+		for _, fe := range e.Errors {
+			l.add(fe, path...)
+		}
+	case *FieldError:
+		e.Path = append(slices.Clone(path), e.Path...)
+		*l = append(*l, e)
+	default:
+		*l = append(*l, &FieldError{Path: slices.Clone(path), Err: err})
+	}
+}
+
+func (l fieldErrors) err() error {
+	if len(l) == 0 {
+		return nil
+	}
+	return &ValidationError{Errors: l}
+}
+
+// featurePath returns the path of the features entry a feature was configured by.
+func featurePath(f FeatureConfig) []string {
+	switch {
+	case f.Group != "":
+		return []string{"features", f.Group} // Expanded from a members list
+	case f.Tenant != "" && f.Pattern == "":
+		return []string{"features", strings.TrimPrefix(f.Name, f.Tenant+".")}
+	case f.Name != "":
+		return []string{"features", f.Name}
+	default:
+		return []string{"features", f.Pattern}
+	}
+}
+
+// Severities of diagnostics.
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// Diagnostic is a problem found in a configuration file by Diagnose.
+type Diagnostic struct {
+	Severity string
+	Key      string // Dotted path of the setting; empty when the configuration as a whole is at fault
+	File     string // File that set the setting, "" when unknown
+	Line     int    // 0 when unknown
+	Message  string
+}
+
+// Diagnose loads a configuration like Load, but reports every problem rather than
+// failing, along with warnings about valid settings that have no effect. The
+// configuration is nil when any error was found. Diagnostics are sorted by file and line.
+func Diagnose(configPath string) (*Config, []Diagnostic) {
+	var diagnostics []Diagnostic
+	collect := func(severity string, err error, doc *document) {
+		if err == nil {
+			return
+		}
+		doc.locate(err)
+		for _, fe := range err.(*ValidationError).Errors {
+			diagnostics = append(diagnostics, Diagnostic{Severity: severity, Key: fe.Key(), File: fe.File, Line: fe.Line, Message: fe.Err.Error()})
+		}
+	}
+
+	cfg, doc, err := read(configPath)
+	var verr *ValidationError
+	if errors.As(err, &verr) {
+		collect(SeverityError, verr, nil) // Unresolvable references or renamed settings, already located
+		return nil, diagnostics
+	}
+	if err != nil {
+		return nil, []Diagnostic{{Severity: SeverityError, Message: err.Error()}}
+	}
+
+	validationErr := validateConfig(cfg)
+	collect(SeverityError, validationErr, doc)
+	collect(SeverityWarning, lintConfig(cfg), doc)
+	collect(SeverityWarning, doc.deprecations.err(), nil) // Located before the keys were renamed
+
+	slices.SortStableFunc(diagnostics, func(a, b Diagnostic) int {
+		return cmp.Or(cmp.Compare(a.File, b.File), cmp.Compare(a.Line, b.Line))
+	})
+	if validationErr != nil {
+		return nil, diagnostics
+	}
+	dropDisabledFeatures(cfg)
+	return cfg, diagnostics
+}
+
+// Thresholds that only apply to some metric types.
+var (
+	numericalThresholds = []string{"meanMin", "meanMax", "stdDevMin", "stdDevMax", "zeroRateMax", "outlierRateMax"}
+	stringThresholds    = []string{"avgLengthMin", "avgLengthMax", "maxLength", "patternMatchRateMin"}
+	vectorThresholds    = []string{"normMin", "normMax", "dimensionMismatchRateMax", "nonFiniteRateMax", "centroidDistanceMax"}
+	latencyThresholds   = []string{"p50Max", "p95Max", "p99Max"}
+	distinctThresholds  = []string{"distinctMin", "distinctMax"}
+	booleanThresholds   = []string{"trueRateMin", "trueRateMax"}
+)
+
+// lintSeasonal warns about seasonal thresholds that cannot be checked: without a
+// tolerance, on a statistic the feature does not have, or with a period longer than the
+// windows kept, in the results store or else for the history API.
+func lintSeasonal(cfg *Config, f FeatureConfig) error {
+	var warnings fieldErrors
+	s := f.Seasonal
+	if len(s.Periods) > 0 && s.CountChange == nil && s.NullRateChange == nil && s.MeanChange == nil {
+		warnings.add(fmt.Errorf("feature %q: seasonal periods have no effect without countChange, nullRateChange or meanChange", f.Name), "periods")
+	}
+	if s.MeanChange != nil && f.MetricType != MetricTypeNumerical && f.MetricType != MetricTypeLatency {
+		warnings.add(fmt.Errorf("feature %q: meanChange has no effect on %s features", f.Name, f.MetricType), "meanChange")
+	}
+	kept, source := time.Duration(cfg.Pipeline.HistoryWindows)*cfg.Pipeline.WindowSize, "pipeline historyWindows"
+	if cfg.Store.Enabled {
+		kept, source = cfg.Store.Retention, "store retention"
+	}
+	for i, period := range s.Periods {
+		if period > kept {
+			warnings.add(fmt.Errorf("feature %q: seasonal period %v is longer than the %v of windows kept by the %s", f.Name, period, kept, source), "periods", strconv.Itoa(i))
+		}
+	}
+	return warnings.err()
+}
+
+// lintConfig finds valid settings that have no effect, or refer to nothing configured.
+func lintConfig(cfg *Config) error {
+	var warnings fieldErrors
+	names := make(map[string]bool, len(cfg.Features))
+	fields := make(map[string]bool, len(cfg.Features))
+	tenants := make(map[string]bool)
+	patterns := false
+	for _, f := range cfg.Features {
+		names[f.Name] = true
+		fields[f.FieldName()] = true
+		tenants[f.Tenant] = f.Tenant != ""
+		patterns = patterns || f.Pattern != ""
+	}
+
+	for _, f := range cfg.Features {
+		set := setThresholds(f.Thresholds.Effective())
+		var inapplicable []string
+		switch f.MetricType {
+		case MetricTypeNumerical:
+			inapplicable = slices.Concat(stringThresholds, vectorThresholds, latencyThresholds, booleanThresholds)
+		case MetricTypeLatency:
+			inapplicable = slices.Concat(stringThresholds, vectorThresholds, booleanThresholds)
+		case MetricTypeCategorical, MetricTypeText:
+			inapplicable = slices.Concat(numericalThresholds, vectorThresholds, latencyThresholds, booleanThresholds)
+		case MetricTypeVector:
+			inapplicable = slices.Concat(numericalThresholds, stringThresholds, latencyThresholds, distinctThresholds, booleanThresholds)
+		case MetricTypeBoolean:
+			inapplicable = slices.Concat(numericalThresholds, stringThresholds, vectorThresholds, latencyThresholds, distinctThresholds)
+		}
+		for _, key := range inapplicable {
+			if set[key] {
+				warnings.add(fmt.Errorf("feature %q: %s has no effect on %s features", f.Name, key, f.MetricType), append(featurePath(f), "thresholds", key)...)
+			}
+		}
+		if f.MetricType != MetricTypeVector && (f.Dimensions != 0 || len(f.BaselineCentroid) > 0) {
+			warnings.add(fmt.Errorf("feature %q: dimensions and baselineCentroid have no effect on %s features", f.Name, f.MetricType), featurePath(f)...)
+		}
+		if len(f.Topics) > 0 && cfg.Kafka.Topic != "" && !slices.ContainsFunc(f.Topics, func(topic string) bool {
+			matched, _ := path.Match(topic, cfg.Kafka.Topic)
+			return matched
+		}) {
+			warnings.add(fmt.Errorf("feature %q: topics %v do not match the consumed topic %q", f.Name, f.Topics, cfg.Kafka.Topic), append(featurePath(f), "topics")...)
+		}
+		if f.Scope == ScopeSession && cfg.Pipeline.Sessions.EntityField != "" && !slices.Contains(cfg.Pipeline.Sessions.SummaryFields(), f.FieldName()) {
+			warnings.add(fmt.Errorf("feature %q: field %q is not a session summary field, expected one of %v", f.Name, f.FieldName(), cfg.Pipeline.Sessions.SummaryFields()), append(featurePath(f), "field")...)
+		}
+		if !cfg.Skew.Enabled && (f.Skew.PSIMax != nil || f.Skew.JSDivergenceMax != nil || f.Skew.MeanDeltaMax != nil || f.Skew.ChiSquarePValueMin != nil) {
+			warnings.add(fmt.Errorf("feature %q: skew thresholds have no effect while skew is disabled", f.Name), append(featurePath(f), "skew")...)
+		}
+		if f.Skew.ChiSquarePValueMin != nil && f.MetricType != MetricTypeCategorical {
+			warnings.add(fmt.Errorf("feature %q: chiSquarePValueMin has no effect on %s features", f.Name, f.MetricType), append(featurePath(f), "skew", "chiSquarePValueMin")...)
+		}
+		warnings.add(lintSeasonal(cfg, f), append(featurePath(f), "seasonal")...)
+	}
+
+	for _, d := range cfg.Pipeline.DerivedFields {
+		if !fields[d.Name] && !patterns {
+			warnings.add(fmt.Errorf("derived field %q is not monitored by any feature", d.Name), "pipeline", "derivedFields", d.Name)
+		}
+	}
+
+	if cfg.Pipeline.SchemaRegistry.URL != "" && cfg.Pipeline.Format != FormatAuto {
+		warnings.add(fmt.Errorf("schemaRegistry has no effect with the %s format, only with auto", cfg.Pipeline.Format), "pipeline", "schemaRegistry")
+	}
+
+	for _, m := range cfg.CompositeMetrics {
+		e, err := expr.Compile(m.Expr)
+		if err != nil || patterns {
+			continue // Invalid expressions are errors; pattern groups may add any feature
+		}
+		for _, ident := range e.Identifiers() {
+			feature := ident[:max(strings.LastIndexByte(ident, '.'), 0)] // Feature names may contain dots, e.g. tenant prefixes
+			if !names[feature] {
+				warnings.add(fmt.Errorf("composite metric %q: %q is not a configured feature", m.Name, feature), "compositeMetrics", m.Name, "expr")
+			}
+		}
+	}
+	for _, out := range cfg.Sinks.Outputs {
+		for _, tenant := range out.Tenants {
+			if !tenants[tenant] {
+				warnings.add(fmt.Errorf("sink %q: tenant %q has no features", cmp.Or(out.Name, out.Type), tenant), "sinks", "outputs", cmp.Or(out.Name, out.Type), "tenants")
+			}
+		}
+	}
+	for i, w := range cfg.MaintenanceWindows {
+		if _, end, err := w.Period(); err == nil && w.Schedule == "" && end.Before(time.Now()) {
+			name := cmp.Or(w.Name, strconv.Itoa(i))
+			warnings.add(fmt.Errorf("maintenance window %q ended at %s", name, w.End), "maintenanceWindows", name, "end")
+		}
+	}
+	return warnings.err()
+}
+
+// setThresholds returns the keys of the thresholds that are set.
+func setThresholds(t Thresholds) map[string]bool {
+	set := make(map[string]bool)
+	for key, value := range map[string]*float64{
+		"meanMin":             t.MeanMin,
+		"meanMax":             t.MeanMax,
+		"stdDevMin":           t.StdDevMin,
+		"stdDevMax":           t.StdDevMax,
+		"zeroRateMax":         t.ZeroRateMax,
+		"outlierRateMax":      t.OutlierRateMax,
+		"avgLengthMin":        t.AvgLengthMin,
+		"avgLengthMax":        t.AvgLengthMax,
+		"maxLength":           t.MaxLength,
+		"patternMatchRateMin": t.PatternMatchRateMin,
+
+		"normMin":                  t.NormMin,
+		"normMax":                  t.NormMax,
+		"dimensionMismatchRateMax": t.DimensionMismatchRateMax,
+		"nonFiniteRateMax":         t.NonFiniteRateMax,
+		"centroidDistanceMax":      t.CentroidDistanceMax,
+		"p50Max":                   t.P50Max,
+		"p95Max":                   t.P95Max,
+		"p99Max":                   t.P99Max,
+		"distinctMin":              t.DistinctMin,
+		"distinctMax":              t.DistinctMax,
+		"trueRateMin":              t.TrueRateMin,
+		"trueRateMax":              t.TrueRateMax,
+	} {
+		set[key] = value != nil
+	}
+	return set
+}
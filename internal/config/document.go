@@ -0,0 +1,297 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// includeKey lists further files merged into a configuration file, e.g.
+// `include: ["features/*.yaml"]`, resolved relative to the including file.
+const includeKey = "include"
+
+// document is a configuration merged from one or more YAML files. It remembers the
+// file every node was read from, so problems can be located across files.
+type document struct {
+	root    *yaml.Node            // Mapping node
+	origins map[*yaml.Node]string // Node to the file it was read from
+
+	deprecations    fieldErrors // Settings migrated from older layouts, see migrate
+	migrationErrors fieldErrors // Settings under names their file's layout no longer has
+
+	secrets    []secretNode      // {secret: ref} mappings, see resolveSecrets
+	secretRefs []SecretReference // The settings they resolved
+}
+
+// loadDocument reads the files a -config value names: a comma-separated list of files
+// and directories, whose *.yaml and *.yml files are read in name order. Later files
+// are merged over earlier ones (see mergeNodes), so a base file can be followed by
+// per-environment overlays.
+func loadDocument(configPath string) (*document, error) {
+	var files []string
+	for _, entry := range strings.Split(configPath, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		info, err := os.Stat(entry)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("%w: %s", ErrConfigFileMissing, entry)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrReadingConfigFile, err)
+		}
+		if !info.IsDir() {
+			files = append(files, entry)
+			continue
+		}
+		yamlFiles, err := filepath.Glob(filepath.Join(entry, "*.yaml"))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrReadingConfigFile, err)
+		}
+		ymlFiles, _ := filepath.Glob(filepath.Join(entry, "*.yml")) // Same directory, so the pattern is valid too
+		dirFiles := append(yamlFiles, ymlFiles...)
+		slices.Sort(dirFiles)
+		files = append(files, dirFiles...)
+	}
+	if len(files) == 0 {
+		return nil, ErrConfigFileMissing
+	}
+
+	doc := &document{root: &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}, origins: make(map[*yaml.Node]string)}
+	for _, file := range files {
+		root, err := doc.readFile(file, nil)
+		if err != nil {
+			return nil, err
+		}
+		doc.root = mergeNodes(doc.root, root)
+	}
+	return doc, nil
+}
+
+// readFile parses a file and merges it over the files it includes, returning its root
+// mapping. including holds the files being read, to detect include cycles.
+func (d *document) readFile(file string, including []string) (*yaml.Node, error) {
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrReadingConfigFile, err)
+	}
+	if slices.Contains(including, abs) {
+		return nil, fmt.Errorf("%w: %s", ErrIncludeCycle, strings.Join(append(including, abs), " -> "))
+	}
+	including = append(including, abs)
+
+	raw, err := os.ReadFile(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrConfigFileMissing, file)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrReadingConfigFile, err)
+	}
+	var parsed yaml.Node
+	if err := yaml.Unmarshal(raw, &parsed); err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", ErrReadingConfigFile, file, err)
+	}
+	root := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	if len(parsed.Content) > 0 {
+		root = parsed.Content[0]
+	}
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%w: %s: the document must be a mapping", ErrReadingConfigFile, file)
+	}
+	d.track(root, file)
+
+	patterns, err := takeIncludes(root)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", ErrInvalidInclude, file, err)
+	}
+	version, err := takeVersion(root)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	d.migrate(root, version) // Before merging, since included files may be of other versions
+	merged := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	for _, pattern := range patterns {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(filepath.Dir(file), pattern)
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %w", ErrInvalidInclude, file, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("%w: %s: %q matches no files", ErrInvalidInclude, file, pattern)
+		}
+		for _, match := range matches { // Glob sorts them
+			included, err := d.readFile(match, including)
+			if err != nil {
+				return nil, err
+			}
+			merged = mergeNodes(merged, included)
+		}
+	}
+	return mergeNodes(merged, root), nil
+}
+
+// track records the file every node under node was read from.
+func (d *document) track(node *yaml.Node, file string) {
+	d.origins[node] = file
+	for _, child := range node.Content {
+		d.track(child, file)
+	}
+}
+
+// takeIncludes removes the include key from a root mapping and returns its paths.
+func takeIncludes(root *yaml.Node) ([]string, error) {
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value != includeKey {
+			continue
+		}
+		value := root.Content[i+1]
+		root.Content = slices.Delete(root.Content, i, i+2)
+		switch value.Kind {
+		case yaml.ScalarNode:
+			return []string{value.Value}, nil
+		case yaml.SequenceNode:
+			paths := make([]string, 0, len(value.Content))
+			for _, item := range value.Content {
+				if item.Kind != yaml.ScalarNode {
+					return nil, errors.New("include must list file paths")
+				}
+				paths = append(paths, item.Value)
+			}
+			return paths, nil
+		default:
+			return nil, errors.New("include must be a file path or a list of them")
+		}
+	}
+	return nil, nil
+}
+
+// mergeNodes merges src over dst and returns the result, reusing both trees' nodes.
+// Mappings are merged key by key. Lists whose items all have a name (or pattern), such
+// as features and sinks outputs, are merged item by item: an item named like one of
+// dst is merged over it, others are appended. Anything else in src replaces dst.
+func mergeNodes(dst, src *yaml.Node) *yaml.Node {
+	switch {
+	case dst.Kind == yaml.MappingNode && src.Kind == yaml.MappingNode:
+		for i := 0; i+1 < len(src.Content); i += 2 {
+			key, value := src.Content[i], src.Content[i+1]
+			j := mappingIndex(dst, key.Value)
+			if j < 0 {
+				dst.Content = append(dst.Content, key, value)
+				continue
+			}
+			merged := mergeNodes(dst.Content[j+1], value)
+			if merged == value {
+				dst.Content[j] = key // Locate the setting in the file that set it
+			}
+			dst.Content[j+1] = merged
+		}
+		return dst
+	case dst.Kind == yaml.SequenceNode && src.Kind == yaml.SequenceNode && namedItems(dst) && namedItems(src):
+		for _, item := range src.Content {
+			name := itemName(item)
+			j := slices.IndexFunc(dst.Content, func(n *yaml.Node) bool { return itemName(n) == name })
+			if j < 0 {
+				dst.Content = append(dst.Content, item)
+				continue
+			}
+			dst.Content[j] = mergeNodes(dst.Content[j], item)
+		}
+		return dst
+	default:
+		return src
+	}
+}
+
+// mappingIndex returns the index of a key in a mapping node (case-insensitively, like
+// viper), or -1.
+func mappingIndex(node *yaml.Node, key string) int {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if strings.EqualFold(node.Content[i].Value, key) {
+			return i
+		}
+	}
+	return -1
+}
+
+// itemName returns the name, or else the pattern, of a list item, "" if it has neither.
+func itemName(item *yaml.Node) string {
+	for _, field := range []string{"name", "pattern"} {
+		if value, _ := childNode(item, field); value != nil && value.Kind == yaml.ScalarNode && value.Value != "" {
+			return value.Value
+		}
+	}
+	return ""
+}
+
+// namedItems reports whether every item of a non-empty list has a name or pattern.
+func namedItems(list *yaml.Node) bool {
+	if len(list.Content) == 0 {
+		return false
+	}
+	for _, item := range list.Content {
+		if itemName(item) == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// locate sets the file and line of every problem of a ValidationError.
+func (d *document) locate(err error) {
+	verr, ok := err.(*ValidationError)
+	if !ok || d == nil {
+		return
+	}
+	for _, fe := range verr.Errors {
+		if node := d.find(fe.Path); node != nil {
+			fe.File, fe.Line = d.origins[node], node.Line
+		}
+	}
+}
+
+// find returns the key node of the deepest key of path present in the document (or list
+// item, for paths ending at one), so a setting left at its default points at its
+// enclosing section. It returns nil if not even the first key is present.
+func (d *document) find(path []string) *yaml.Node {
+	node := d.root
+	var found *yaml.Node
+	for _, key := range path {
+		next, keyNode := childNode(node, key)
+		if next == nil {
+			break
+		}
+		node, found = next, keyNode
+	}
+	return found
+}
+
+// childNode returns the value under a mapping key (case-insensitively, like viper) or
+// the list item at an index or with that name or pattern, along with the node locating
+// it: the mapping key, or the item itself.
+func childNode(node *yaml.Node, key string) (value, keyNode *yaml.Node) {
+	switch node.Kind {
+	case yaml.MappingNode:
+		if i := mappingIndex(node, key); i >= 0 {
+			return node.Content[i+1], node.Content[i]
+		}
+	case yaml.SequenceNode:
+		if i, err := strconv.Atoi(key); err == nil && i >= 0 && i < len(node.Content) {
+			return node.Content[i], node.Content[i]
+		}
+		for _, item := range node.Content {
+			if itemName(item) == key {
+				return item, item
+			}
+		}
+	}
+	return nil, nil
+}
@@ -8,6 +8,107 @@ var (
 	ErrEmptyKafkaBrokers         = errors.New("kafka brokers list cannot be empty")
 	ErrEmptyKafkaTopic           = errors.New("kafka topic cannot be empty")
 	ErrEmptyKafkaGroupID         = errors.New("kafka groupID cannot be empty")
+	ErrInvalidLogSampling        = errors.New("log sampling tick must be positive, initial at least 1 and thereafter not negative")
+	ErrInvalidRepeatInterval     = errors.New("log repeatInterval cannot be negative")
+	ErrInvalidSummaryInterval    = errors.New("log summaryInterval cannot be negative")
+	ErrInvalidLagConfig          = errors.New("kafka lag interval must be positive and threshold non-negative")
+	ErrInvalidRateLimit          = errors.New("kafka rateLimit messagesPerSecond and burst cannot be negative")
+	ErrInvalidIsolationLevel     = errors.New("kafka isolationLevel must be read_uncommitted or read_committed")
+	ErrInvalidKafkaReader        = errors.New("kafka reader minBytes must be at least 1, maxBytes at least minBytes, maxWait positive and commitInterval non-negative")
+	ErrInvalidSubscription       = errors.New("invalid kafka subscription")
+	ErrInvalidSeekTarget         = errors.New("invalid offset, expected earliest, latest or an RFC 3339 timestamp")
 	ErrInvalidPipelineWindowSize = errors.New("pipeline windowSize must be positive")
+	ErrInvalidFeatureWindowSize  = errors.New("invalid feature windowSize")
+	ErrInvalidShutdownTimeout    = errors.New("pipeline shutdownTimeout must be positive")
+	ErrInvalidParserWorkers      = errors.New("pipeline parserWorkers must be at least 1")
+	ErrInvalidCalculatorWorkers  = errors.New("pipeline calculatorWorkers must be at least 1, and only 1 with event time or a windowState memory limit")
+	ErrInvalidBatch              = errors.New("pipeline batch size must be at least 1 and linger cannot be negative")
+	ErrInvalidWindowState        = errors.New("pipeline windowState maxMemoryMB cannot be negative, and a limit requires a spillDirectory")
+	ErrInvalidSessions           = errors.New("pipeline sessions gap must be positive and maxOpen at least 1")
+	ErrInvalidHistoryWindows     = errors.New("pipeline historyWindows must be at least 1")
+	ErrInvalidSeriesLimit        = errors.New("pipeline series limits must not be negative")
+	ErrInvalidFormat             = errors.New("invalid pipeline payload format")
 	ErrConfigFileMissing         = errors.New("config file not found")
+	ErrInvalidInclude            = errors.New("invalid config include")
+	ErrIncludeCycle              = errors.New("config files include each other")
+	ErrInvalidConfigVersion      = errors.New("config version must be a positive integer")
+	ErrUnsupportedConfigVersion  = errors.New("config version is newer than this FeatureLens supports")
+	ErrRenamedSetting            = errors.New("renamed setting")
+	ErrUndefinedEnvVar           = errors.New("config references undefined environment variables")
+	ErrReadingSecretFile         = errors.New("failed to read config secret file")
+	ErrResolvingSecret           = errors.New("failed to resolve config secret reference")
+	ErrUnknownSigningAlgorithm   = errors.New("unknown signing algorithm")
+	ErrEmptySigningKeyFile       = errors.New("signing keyFile cannot be empty when signing is enabled")
+	ErrInvalidCondition          = errors.New("invalid feature condition")
+	ErrInvalidCompositeMetric    = errors.New("invalid composite metric")
+	ErrInvalidCorrelation        = errors.New("invalid pipeline correlation")
+	ErrInvalidDerivedField       = errors.New("invalid pipeline derived field")
+	ErrInvalidFilter             = errors.New("invalid pipeline filter")
+	ErrInvalidScript             = errors.New("invalid pipeline script")
+	ErrInvalidMetadata           = errors.New("invalid pipeline metadata")
+	ErrInvalidCoercion           = errors.New("invalid pipeline coercion")
+	ErrInvalidValueSamples       = errors.New("invalid pipeline value samples")
+	ErrInvalidExemplars          = errors.New("pipeline exemplars size must be at least 1 with a traceField")
+	ErrInvalidOutliers           = errors.New("invalid feature outliers")
+	ErrInvalidSamplingRate       = errors.New("feature sampling rate must be in (0, 1]")
+	ErrInvalidReservoirBoost     = errors.New("feature sampling reservoirBoost must be at least 1")
+	ErrInvalidTimestampUnit      = errors.New("pipeline latency timestampUnit must be one of s, ms, us, ns, auto")
+	ErrInvalidTimestampOrdering  = errors.New("invalid pipeline latency timestamp ordering configuration")
+	ErrInvalidEventTime          = errors.New("invalid pipeline eventTime configuration")
+	ErrInvalidWindowAlignment    = errors.New("invalid pipeline windowAlignment configuration")
+	ErrInvalidRollup             = errors.New("invalid pipeline rollup")
+	ErrInvalidPriority           = errors.New("invalid feature priority")
+	ErrInvalidFeatureMode        = errors.New("invalid feature mode")
+	ErrInvalidRunbookURL         = errors.New("invalid feature runbook URL")
+	ErrInvalidLoadShedding       = errors.New("invalid pipeline loadShedding configuration")
+	ErrInvalidThroughput         = errors.New("invalid pipeline throughput configuration")
+	ErrInvalidSchemaTracking     = errors.New("invalid pipeline schema tracking configuration")
+	ErrInvalidPartitionStats     = errors.New("invalid pipeline partition statistics configuration")
+	ErrUnknownMetricType         = errors.New("unknown feature metricType")
+	ErrInvalidExpectedType       = errors.New("invalid feature expectedType")
+	ErrInvalidScope              = errors.New("invalid feature scope")
+	ErrInvalidThresholds         = errors.New("incoherent feature thresholds")
+	ErrInvalidMinCount           = errors.New("feature minCount cannot be negative")
+	ErrInvalidConstantWindows    = errors.New("feature constantWindows cannot be negative")
+	ErrInvalidNoDataWindows      = errors.New("feature noDataWindows cannot be negative")
+	ErrInvalidDimensions         = errors.New("invalid vector feature dimensions")
+	ErrInvalidTenant             = errors.New("invalid feature tenant")
+	ErrInvalidGroupBy            = errors.New("invalid feature groupBy configuration")
+	ErrInvalidSeasonal           = errors.New("invalid feature seasonal thresholds")
+	ErrUnknownDependency         = errors.New("feature depends on an unconfigured feature")
+	ErrDependencyCycle           = errors.New("feature dependencies contain a cycle")
+	ErrEmptyFeatureName          = errors.New("feature must have a name or a pattern")
+	ErrInvalidFeaturePattern     = errors.New("invalid feature pattern")
+	ErrInvalidValuePattern       = errors.New("invalid feature valuePattern")
+	ErrInvalidSkewReference      = errors.New("skew requires exactly one of referenceTopic or baselineFile")
+	ErrInvalidSkewBins           = errors.New("skew bins must be at least 2")
+	ErrInvalidSkewSamples        = errors.New("skew maxSamples must be at least the number of bins")
+	ErrEmptyRemoteWriteURL       = errors.New("remoteWrite url cannot be empty when enabled")
+	ErrInvalidTraceSampleRatio   = errors.New("telemetry traceSampleRatio must be in [0, 1]")
+	ErrInvalidMetricInterval     = errors.New("telemetry metricInterval must be positive")
+	ErrInvalidStoreRetention     = errors.New("store retention must be positive")
+	ErrInvalidSecrets            = errors.New("secrets timeout must be positive, refreshInterval cannot be negative, and vault kvVersion must be 1 or 2")
+	ErrInvalidHTTPTLS            = errors.New("http tls certFile and keyFile must be set together, and clientCAFile requires them")
+	ErrClientCertWithoutCA       = errors.New("clientCert middleware requires http tls clientCAFile")
+	ErrEmptyAuditPath            = errors.New("audit path cannot be empty when enabled")
+	ErrInvalidAudit              = errors.New("audit maxSize, maxBackups and maxAge cannot be negative")
+	ErrInvalidSketch             = errors.New("invalid pipeline sketches configuration")
+	ErrInvalidSinks              = errors.New("sinks queueSize, maxBatchSize, flushInterval and timeout must be positive")
+	ErrInvalidSinkDelivery       = errors.New("sinks maxRetries, dedupRetention, maxRetryBackoff and overflowSize cannot be negative, and retryBackoff must be positive with retries")
+	ErrInvalidMaxNotifyAge       = errors.New("sinks maxNotifyAge cannot be negative")
+	ErrInvalidCircuitBreaker     = errors.New("sinks circuitBreaker failureThreshold cannot be negative, and openDuration must be positive with a threshold")
+	ErrEmptySinkType             = errors.New("sink type cannot be empty")
+	ErrInvalidRoute              = errors.New("invalid sinks route")
+	ErrDuplicateSinkName         = errors.New("sink names must be unique")
+	ErrInvalidSinkFilter         = errors.New("invalid sink filter")
+	ErrInvalidSinkTemplate       = errors.New("sink template and templateFile are mutually exclusive")
+	ErrInvalidMaintenanceWindow  = errors.New("invalid maintenance window")
+	ErrInvalidActions            = errors.New("actions queueSize and timeout must be positive and cooldown non-negative")
+	ErrInvalidAction             = errors.New("invalid action trigger")
+	ErrInvalidErrors             = errors.New("invalid internal errors configuration")
+	ErrInvalidLeaderElection     = errors.New("invalid leader election configuration")
+	ErrInvalidScaling            = errors.New("invalid pipeline scaling configuration")
+	ErrInvalidGraph              = errors.New("invalid pipeline graph")
+	ErrInvalidExtension          = errors.New("invalid custom metric or check")
+	ErrInvalidRemoteWrite        = errors.New("remoteWrite timeout, flushInterval, maxBatchSize and queueSize must be positive and maxRetries non-negative")
 )
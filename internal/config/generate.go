@@ -0,0 +1,63 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// GeneratedFile is a `features:` config block generated from definitions kept elsewhere,
+// e.g. by `featurelens feast import`, meant to be kept in its own file and included from
+// the main configuration.
+type GeneratedFile struct {
+	Command  string   // Command that generated the file, e.g. feast import
+	Source   string   // What it was generated from, e.g. the registry path
+	Comments []string // Listed in the header, e.g. skipped features
+	Features []GeneratedFeature
+}
+
+// GeneratedFeature is an entry of the features list of a GeneratedFile.
+type GeneratedFeature struct {
+	Name         string             `yaml:"name"`
+	MetricType   string             `yaml:"metricType"`
+	ValuePattern string             `yaml:"valuePattern,omitempty"`
+	Tags         map[string]string  `yaml:"tags,omitempty"`
+	Thresholds   map[string]float64 `yaml:"thresholds,omitempty"`
+}
+
+// WriteGenerated writes f in the current layout version, its header naming the command
+// and source it was generated by and listing its comments.
+func WriteGenerated(w io.Writer, f GeneratedFile) error {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "# Generated by `featurelens %s` from %s; regenerate instead of editing.\n", f.Command, oneLine(f.Source))
+	fmt.Fprintf(&b, "# Tune thresholds by overriding features by name in the including file.\n")
+	for _, c := range f.Comments {
+		fmt.Fprintf(&b, "# %s\n", oneLine(c))
+	}
+
+	file := struct {
+		Version  int                `yaml:"version"`
+		Features []GeneratedFeature `yaml:"features"`
+	}{Version: Version, Features: f.Features}
+	if file.Features == nil {
+		file.Features = []GeneratedFeature{}
+	}
+	enc := yaml.NewEncoder(&b)
+	enc.SetIndent(2)
+	if err := enc.Encode(file); err != nil {
+		return err
+	}
+	if err := enc.Close(); err != nil {
+		return err
+	}
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// oneLine keeps text written into a YAML comment on a single line.
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
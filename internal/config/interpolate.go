@@ -0,0 +1,113 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// secretFileKey marks a mapping replaced with the contents of a file, e.g.
+// `password: {secretFile: /run/secrets/kafka-password}`.
+const secretFileKey = "secretFile"
+
+// envReference matches ${VAR} and ${VAR:-default} references, and $$ escapes.
+var envReference = regexp.MustCompile(`\$\$|\$\{([A-Za-z_][A-Za-z0-9_]*)(?::-([^}]*))?\}`)
+
+// interpolate resolves the references in a YAML configuration document: ${VAR} in
+// string values is replaced with the environment variable (${VAR:-default} when unset
+// or empty, $$ for a literal $), and every {secretFile: path} mapping with the trimmed
+// contents of the file. {secret: ref} mappings are collected for resolveSecrets, which
+// needs the secrets settings resolved first. Comments are left alone, so commented-out
+// examples may reference anything. All unresolvable references are reported at once,
+// as a *ValidationError.
+func interpolate(doc *document) error {
+	var errs fieldErrors
+	resolveNode(doc.root, nil, &errs, &doc.secrets)
+	err := errs.err()
+	doc.locate(err)
+	return err
+}
+
+// resolveNode resolves the references under node, found at path, and collects its
+// secret references.
+func resolveNode(node *yaml.Node, path []string, errs *fieldErrors, secrets *[]secretNode) {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		if node.Tag != "!!str" || !strings.Contains(node.Value, "$") {
+			return
+		}
+		value, err := expandEnv(node.Value)
+		if err != nil {
+			errs.add(err, path...)
+			return
+		}
+		node.Value = value
+	case yaml.MappingNode:
+		if len(node.Content) == 2 && node.Content[0].Value == secretFileKey {
+			secret, err := readSecretFile(node.Content[1].Value)
+			if err != nil {
+				errs.add(err, append(path, secretFileKey)...)
+				return
+			}
+			*node = yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: secret, Line: node.Line, Column: node.Column}
+			return
+		}
+		if len(node.Content) == 2 && node.Content[0].Value == secretKey {
+			resolveNode(node.Content[1], append(path, secretKey), errs, secrets) // The reference may use ${VAR}
+			*secrets = append(*secrets, secretNode{node: node, path: slices.Clone(path)})
+			return
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			resolveNode(node.Content[i+1], append(path, node.Content[i].Value), errs, secrets)
+		}
+	case yaml.SequenceNode:
+		for i, item := range node.Content {
+			key := itemName(item) // Addressed like validation problems
+			if key == "" {
+				key = strconv.Itoa(i)
+			}
+			resolveNode(item, append(path, key), errs, secrets)
+		}
+	}
+}
+
+// expandEnv replaces the environment variable references in s.
+func expandEnv(s string) (string, error) {
+	var undefined []string
+	expanded := envReference.ReplaceAllStringFunc(s, func(ref string) string {
+		if ref == "$$" {
+			return "$"
+		}
+		m := envReference.FindStringSubmatch(ref)
+		if value := os.Getenv(m[1]); value != "" {
+			return value
+		}
+		if strings.Contains(ref, ":-") {
+			return m[2]
+		}
+		undefined = append(undefined, m[1])
+		return ref
+	})
+	if len(undefined) > 0 {
+		return "", fmt.Errorf("%w: %s", ErrUndefinedEnvVar, strings.Join(undefined, ", "))
+	}
+	return expanded, nil
+}
+
+// readSecretFile returns the contents of a secret file without surrounding whitespace.
+func readSecretFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrReadingSecretFile, err)
+	}
+	secret := strings.TrimSpace(string(data))
+	if secret == "" {
+		return "", fmt.Errorf("%w: %q is empty", ErrReadingSecretFile, path)
+	}
+	return secret, nil
+}
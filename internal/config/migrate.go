@@ -0,0 +1,167 @@
+package config
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Version is the configuration layout this build reads. Files declare theirs with a
+// top-level `version:`, and files without one are version 1, the layout before
+// versioning. Older files are migrated as they are read, with a deprecation warning per
+// migrated setting, so deployments keep working across layout changes; newer files are
+// rejected.
+const Version = 3
+
+// versionKey declares the layout version of a configuration file.
+const versionKey = "version"
+
+// migration moves settings to the layout of version to, renaming keys of the mappings
+// at paths and rewriting those of older files. Path keys of "*" match every key of a
+// mapping or item of a list.
+type migration struct {
+	to      int
+	paths   [][]string
+	renames map[string]string // Old key to new key
+
+	// rewrite, if set, adapts a mapping of a file older than to whose settings changed
+	// meaning, returning the key of the setting to warn about and why, or nil.
+	rewrite func(d *document, mapping *yaml.Node) (*yaml.Node, error)
+}
+
+// thresholdPaths are the paths of every thresholds mapping of a file.
+var thresholdPaths = [][]string{
+	{"features", "*", "thresholds"},
+	{"features", "*", "thresholds", "critical"},
+	{"features", "*", "groupThresholds", "*"},
+	{"features", "*", "groupThresholds", "*", "critical"},
+}
+
+// migrations are the layout changes since version 1, in order.
+var migrations = []migration{
+	// Version 2 names upper bounds on rates like the other bounds, e.g. zeroRateMax
+	{to: 2, paths: thresholdPaths, renames: map[string]string{
+		"nullRate":         "nullRateMax",
+		"missingRate":      "missingRateMax",
+		"typeMismatchRate": "typeMismatchRateMax",
+	}},
+	// Version 3 counts explicit nulls only in nullRateMax, like every other null rate
+	{to: 3, paths: thresholdPaths, rewrite: splitNullRate},
+}
+
+// splitNullRate keeps a nullRateMax written before version 3, which also counted messages
+// without the feature's key, bounding those too: missingRateMax takes the same bound
+// unless set. Both rates are now checked apart, so a window with some nulls and some
+// missing keys may stay under both where it exceeded the old bound.
+func splitNullRate(d *document, mapping *yaml.Node) (*yaml.Node, error) {
+	i := mappingIndex(mapping, "nullRateMax")
+	if i < 0 {
+		return nil, nil
+	}
+	key := mapping.Content[i]
+	if mappingIndex(mapping, "missingRateMax") >= 0 {
+		return key, fmt.Errorf("nullRateMax counts explicit nulls only since config version 3, not messages without the feature's key, which missingRateMax bounds; set version: %d", Version)
+	}
+	missingKey := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "missingRateMax", Line: key.Line, Column: key.Column}
+	missingValue := *mapping.Content[i+1]
+	d.origins[missingKey], d.origins[&missingValue] = d.origins[key], d.origins[mapping.Content[i+1]]
+	mapping.Content = append(mapping.Content, missingKey, &missingValue)
+	return key, fmt.Errorf("nullRateMax counts explicit nulls only since config version 3, so missingRateMax %s was added to keep bounding messages without the feature's key; set both and version: %d", missingValue.Value, Version)
+}
+
+// MigratedThresholdKey returns the current key of a threshold named as in an older
+// layout, e.g. nullRateMax for nullRate, or key itself.
+func MigratedThresholdKey(key string) string {
+	for _, m := range migrations {
+		if slices.EqualFunc(m.paths, thresholdPaths, slices.Equal[[]string]) && m.renames[key] != "" {
+			key = m.renames[key]
+		}
+	}
+	return key
+}
+
+// takeVersion removes the version key from a file's root mapping and returns it, 1 when
+// it is absent.
+func takeVersion(root *yaml.Node) (int, error) {
+	i := mappingIndex(root, versionKey)
+	if i < 0 {
+		return 1, nil
+	}
+	value := root.Content[i+1]
+	root.Content = slices.Delete(root.Content, i, i+2)
+	version, err := strconv.Atoi(value.Value)
+	if value.Kind != yaml.ScalarNode || err != nil || version < 1 {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidConfigVersion, value.Value)
+	}
+	if version > Version {
+		return 0, fmt.Errorf("%w: version %d, this build reads up to %d", ErrUnsupportedConfigVersion, version, Version)
+	}
+	return version, nil
+}
+
+// migrate renames the settings of a file of version that later layouts renamed, and
+// rewrites those whose meaning they changed, recording a deprecation warning for each. Settings under their old name in a file of a
+// layout that renamed them are errors: they would otherwise be silently ignored.
+func (d *document) migrate(root *yaml.Node, version int) {
+	for _, m := range migrations {
+		for _, path := range m.paths {
+			walkMappings(root, path, nil, func(mapping *yaml.Node, at []string) {
+				for from, to := range m.renames {
+					i := mappingIndex(mapping, from)
+					if i < 0 {
+						continue
+					}
+					key := mapping.Content[i]
+					fe := &FieldError{Path: append(slices.Clone(at), key.Value), File: d.origins[key], Line: key.Line}
+					switch {
+					case version >= m.to:
+						fe.Err = fmt.Errorf("%w: %s was renamed %s in config version %d", ErrRenamedSetting, key.Value, to, m.to)
+						d.migrationErrors = append(d.migrationErrors, fe)
+					case mappingIndex(mapping, to) >= 0:
+						fe.Err = fmt.Errorf("%w: %s and %s, its name since config version %d, are both set", ErrRenamedSetting, key.Value, to, m.to)
+						d.migrationErrors = append(d.migrationErrors, fe)
+					default:
+						fe.Err = fmt.Errorf("%s is deprecated, renamed %s in config version %d; rename it and set version: %d", key.Value, to, m.to, Version)
+						d.deprecations = append(d.deprecations, fe)
+						key.Value = to
+					}
+				}
+				if m.rewrite == nil || version >= m.to {
+					return
+				}
+				if key, err := m.rewrite(d, mapping); key != nil {
+					d.deprecations = append(d.deprecations, &FieldError{Path: append(slices.Clone(at), key.Value), File: d.origins[key], Line: key.Line, Err: err})
+				}
+			})
+		}
+	}
+}
+
+// walkMappings calls fn with every mapping under node at path, and the concrete path
+// leading to it from the document root, list items addressed by name or index.
+func walkMappings(node *yaml.Node, path, at []string, fn func(mapping *yaml.Node, at []string)) {
+	if len(path) == 0 {
+		if node.Kind == yaml.MappingNode {
+			fn(node, at)
+		}
+		return
+	}
+	key := path[0]
+	switch {
+	case key != "*":
+		if child, _ := childNode(node, key); child != nil {
+			walkMappings(child, path[1:], append(slices.Clone(at), key), fn)
+		}
+	case node.Kind == yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			walkMappings(node.Content[i+1], path[1:], append(slices.Clone(at), node.Content[i].Value), fn)
+		}
+	case node.Kind == yaml.SequenceNode:
+		for i, item := range node.Content {
+			walkMappings(item, path[1:], append(slices.Clone(at), cmp.Or(itemName(item), strconv.Itoa(i))), fn)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package config
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/sanspareilsmyn/featurelens/internal/secrets"
+)
+
+// secretKey marks a mapping replaced with a secret fetched from a secret store, e.g.
+// `password: {secret: "vault:kv/featurelens/kafka#password"}` (see SecretsConfig).
+const secretKey = "secret"
+
+// secretNode is a {secret: ref} mapping of a document, at path.
+type secretNode struct {
+	node *yaml.Node
+	path []string
+}
+
+// SecretReference records a setting fetched from a secret store, so that rotations of
+// the secret can be detected (see RefreshSecrets).
+type SecretReference struct {
+	Path string // Setting, e.g. sinks.outputs.opsgenie.params.apiKey
+	Ref  string
+
+	digest [sha256.Size]byte // Of the fetched value
+}
+
+// resolveSecrets replaces the document's {secret: ref} mappings with the secrets they
+// reference, fetched with the providers of cfg. All failures are reported at once, as a
+// *ValidationError.
+func (d *document) resolveSecrets(cfg SecretsConfig) ([]SecretReference, error) {
+	var errs fieldErrors
+	var resolver *secrets.Resolver
+	refs := make([]SecretReference, 0, len(d.secrets))
+	for _, s := range d.secrets {
+		path := append(s.path, secretKey)
+		if len(s.path) > 0 && strings.EqualFold(s.path[0], "secrets") {
+			errs.add(fmt.Errorf("%w: secrets settings cannot reference secret stores", ErrResolvingSecret), path...)
+			continue
+		}
+		if resolver == nil {
+			var err error
+			if resolver, err = newSecretResolver(cfg); err != nil {
+				errs.add(fmt.Errorf("%w: %w", ErrResolvingSecret, err), "secrets")
+				break
+			}
+		}
+		ref := s.node.Content[1].Value
+		value, err := resolver.Resolve(context.Background(), ref)
+		if err != nil {
+			errs.add(fmt.Errorf("%w: %w", ErrResolvingSecret, err), path...)
+			continue
+		}
+		*s.node = yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value, Line: s.node.Line, Column: s.node.Column}
+		refs = append(refs, SecretReference{Path: strings.Join(s.path, "."), Ref: ref, digest: sha256.Sum256([]byte(value))})
+	}
+	err := errs.err()
+	d.locate(err)
+	return refs, err
+}
+
+// RefreshSecrets fetches the secrets referenced by cfg again, returning the settings
+// whose secret changed since cfg was loaded.
+func RefreshSecrets(ctx context.Context, cfg *Config) ([]string, error) {
+	if len(cfg.SecretReferences) == 0 {
+		return nil, nil
+	}
+	resolver, err := newSecretResolver(cfg.Secrets)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrResolvingSecret, err)
+	}
+	var changed []string
+	for _, ref := range cfg.SecretReferences {
+		value, err := resolver.Resolve(ctx, ref.Ref)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %w", ErrResolvingSecret, ref.Path, err)
+		}
+		if sha256.Sum256([]byte(value)) != ref.digest {
+			changed = append(changed, ref.Path)
+		}
+	}
+	return changed, nil
+}
+
+// newSecretResolver returns a resolver of the configured secret stores. Settings left
+// empty fall back to the variables the stores' own tools read: VAULT_ADDR, VAULT_TOKEN
+// and VAULT_NAMESPACE for Vault, AWS_REGION (or AWS_DEFAULT_REGION) and the
+// AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN credentials for AWS.
+func newSecretResolver(cfg SecretsConfig) (*secrets.Resolver, error) {
+	providers := make(map[string]secrets.Provider)
+	if address := cmp.Or(cfg.Vault.Address, os.Getenv("VAULT_ADDR")); address != "" {
+		vault, err := secrets.NewVault(secrets.VaultOptions{
+			Address:   address,
+			Token:     os.Getenv("VAULT_TOKEN"),
+			TokenFile: cfg.Vault.TokenFile,
+			Namespace: cmp.Or(cfg.Vault.Namespace, os.Getenv("VAULT_NAMESPACE")),
+			KVVersion: cfg.Vault.KVVersion,
+			Timeout:   cfg.Timeout,
+		})
+		if err != nil {
+			return nil, err
+		}
+		providers[secrets.ProviderVault] = vault
+	}
+	if region := cmp.Or(cfg.AWS.Region, os.Getenv("AWS_REGION"), os.Getenv("AWS_DEFAULT_REGION")); region != "" {
+		aws, err := secrets.NewAWS(secrets.AWSOptions{
+			Region:          region,
+			Endpoint:        cfg.AWS.Endpoint,
+			AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+			Timeout:         cfg.Timeout,
+		})
+		if err != nil {
+			return nil, err
+		}
+		providers[secrets.ProviderAWS] = aws
+	}
+	return secrets.NewResolver(providers), nil
+}
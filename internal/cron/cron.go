@@ -0,0 +1,157 @@
+// Package cron parses standard five-field cron schedules: minute, hour, day of month,
+// month and day of week.
+package cron
+
+import (
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a parsed cron schedule. Each field is a bit set of the values it matches.
+type Schedule struct {
+	minute, hour, dom, month, dow uint64
+	// Both day fields restricted: a day matches when either does, as in Vixie cron
+	domDowUnion bool
+}
+
+type field struct {
+	min, max int
+	names    []string // Names of the values from min, e.g. "jan" for months
+}
+
+var (
+	minuteField = field{min: 0, max: 59}
+	hourField   = field{min: 0, max: 23}
+	domField    = field{min: 1, max: 31}
+	monthField  = field{min: 1, max: 12, names: []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}}
+	dowField    = field{min: 0, max: 7, names: []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}} // 7 is Sunday too
+)
+
+// Parse parses a schedule such as "0 2 * * sat,sun". Fields accept *, values, ranges
+// (1-5), steps (*/15, 0-30/10), lists of those, and English month and day names.
+func Parse(spec string) (*Schedule, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("%w: %q: expected 5 fields, got %d", ErrInvalidSchedule, spec, len(fields))
+	}
+	var s Schedule
+	var err error
+	for i, target := range []struct {
+		bits *uint64
+		f    field
+	}{{&s.minute, minuteField}, {&s.hour, hourField}, {&s.dom, domField}, {&s.month, monthField}, {&s.dow, dowField}} {
+		if *target.bits, err = parseField(fields[i], target.f); err != nil {
+			return nil, fmt.Errorf("%w: %q: %w", ErrInvalidSchedule, spec, err)
+		}
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1 // Sunday
+	}
+	s.domDowUnion = fields[2] != "*" && fields[4] != "*"
+	return &s, nil
+}
+
+// parseField parses a comma-separated list of ranges into a bit set.
+func parseField(spec string, f field) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(spec, ",") {
+		rng, stepSpec, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepSpec)
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("invalid step %q", stepSpec)
+			}
+			step = n
+		}
+
+		lo, hi := f.min, f.max
+		if rng != "*" {
+			loSpec, hiSpec, isRange := strings.Cut(rng, "-")
+			var err error
+			if lo, err = f.value(loSpec); err != nil {
+				return 0, err
+			}
+			hi = lo
+			if isRange {
+				if hi, err = f.value(hiSpec); err != nil {
+					return 0, err
+				}
+			} else if hasStep {
+				hi = f.max // "5/15" steps from 5 to the end
+			}
+			if hi < lo {
+				return 0, fmt.Errorf("invalid range %q", rng)
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			set |= 1 << v
+		}
+	}
+	return set, nil
+}
+
+// value parses a number or name within the field's bounds.
+func (f field) value(s string) (int, error) {
+	for i, name := range f.names {
+		if strings.EqualFold(s, name) {
+			return f.min + i, nil
+		}
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("value %q out of range %d-%d", s, f.min, f.max)
+	}
+	return v, nil
+}
+
+// Matches reports whether the schedule fires in the minute of t, in t's location.
+func (s *Schedule) Matches(t time.Time) bool {
+	return s.minute&(1<<t.Minute()) != 0 && s.hour&(1<<t.Hour()) != 0 && s.dayMatches(t)
+}
+
+func (s *Schedule) dayMatches(t time.Time) bool {
+	if s.month&(1<<int(t.Month())) == 0 {
+		return false
+	}
+	dom, dow := s.dom&(1<<t.Day()) != 0, s.dow&(1<<int(t.Weekday())) != 0
+	if s.domDowUnion {
+		return dom || dow
+	}
+	return dom && dow
+}
+
+// Prev returns the latest minute at or before t, and after t minus within, at which the
+// schedule fires, or false if it does not fire in that span. Days and hours that do not
+// match are skipped whole.
+func (s *Schedule) Prev(t time.Time, within time.Duration) (time.Time, bool) {
+	earliest := t.Add(-within)
+	for t = t.Truncate(time.Minute); t.After(earliest); {
+		switch {
+		case !s.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location()).Add(-time.Minute)
+		case s.hour&(1<<t.Hour()) == 0:
+			t = startOfHour(t).Add(-time.Minute)
+		case s.minute&(1<<t.Minute()) == 0:
+			// Step back to the previous matching minute of the hour, if any
+			below := s.minute & (1<<t.Minute() - 1)
+			if below == 0 {
+				t = startOfHour(t).Add(-time.Minute)
+				continue
+			}
+			t = t.Add(-time.Duration(t.Minute()-(63-bits.LeadingZeros64(below))) * time.Minute)
+		default:
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// startOfHour truncates t to the hour in its location, which Truncate does not do for
+// zones with fractional-hour offsets.
+func startOfHour(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, t.Location())
+}
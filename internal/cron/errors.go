@@ -0,0 +1,5 @@
+package cron
+
+import "errors"
+
+var ErrInvalidSchedule = errors.New("invalid cron schedule")
@@ -0,0 +1,49 @@
+package dataset
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+
+	"github.com/sanspareilsmyn/featurelens/internal/message"
+)
+
+// csvReader reads a CSV file with a header row. Cells are typed by message.CSVValue.
+type csvReader struct {
+	file   *os.File
+	reader *csv.Reader
+	header []string
+}
+
+func openCSV(path string) (Reader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrOpenFailed, err)
+	}
+	r := csv.NewReader(f)
+	r.ReuseRecord = true
+	header, err := r.Read()
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%w: reading header: %w", ErrOpenFailed, err)
+	}
+	return &csvReader{file: f, reader: r, header: append([]string(nil), header...)}, nil
+}
+
+func (c *csvReader) Read() (message.DynamicMessage, error) {
+	record, err := c.reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	msg := make(message.DynamicMessage, len(c.header))
+	for i, name := range c.header {
+		if i < len(record) {
+			msg[name] = message.CSVValue(record[i])
+		}
+	}
+	return msg, nil
+}
+
+func (c *csvReader) Close() error {
+	return c.file.Close()
+}
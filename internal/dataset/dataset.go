@@ -0,0 +1,60 @@
+// Package dataset reads offline datasets (e.g. the data a model was trained on) as
+// messages, so they can be profiled like the stream or turned into skew baselines.
+package dataset
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"path/filepath"
+	"strings"
+
+	"github.com/sanspareilsmyn/featurelens/internal/message"
+)
+
+// Supported dataset formats, selected by file extension.
+const (
+	FormatCSV     = "csv"
+	FormatParquet = "parquet"
+)
+
+// Reader yields a dataset's rows as messages. Read returns io.EOF after the last row.
+type Reader interface {
+	Read() (message.DynamicMessage, error)
+	Close() error
+}
+
+// Open opens a dataset, choosing the format from the file extension.
+func Open(path string) (Reader, error) {
+	switch format := strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), "."); format {
+	case FormatCSV:
+		return openCSV(path)
+	case FormatParquet:
+		return openParquet(path)
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedFormat, format)
+	}
+}
+
+// Sample reads every row and keeps a uniform random sample of at most maxRows of them
+// (reservoir sampling). It returns the sample and the total number of rows read.
+func Sample(r Reader, maxRows int, rng *rand.Rand) ([]message.DynamicMessage, int64, error) {
+	sample := make([]message.DynamicMessage, 0, min(maxRows, 1024))
+	var rows int64
+	for {
+		msg, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			return sample, rows, nil
+		}
+		if err != nil {
+			return nil, rows, fmt.Errorf("%w: row %d: %w", ErrReadFailed, rows+1, err)
+		}
+		rows++
+		if len(sample) < maxRows {
+			sample = append(sample, msg)
+		} else if j := rng.Int64N(rows); j < int64(maxRows) {
+			sample[j] = msg
+		}
+	}
+}
@@ -0,0 +1,9 @@
+package dataset
+
+import "errors"
+
+var (
+	ErrUnsupportedFormat = errors.New("unsupported dataset format, expected .csv or .parquet")
+	ErrOpenFailed        = errors.New("failed to open dataset")
+	ErrReadFailed        = errors.New("failed to read dataset")
+)
@@ -0,0 +1,95 @@
+package dataset
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+
+	"github.com/sanspareilsmyn/featurelens/internal/message"
+)
+
+// parquetReader reads the rows of a Parquet file. Integer and float columns become
+// numbers, byte arrays strings and timestamps RFC 3339 strings, like their JSON form.
+type parquetReader struct {
+	file   *os.File
+	reader *parquet.Reader
+}
+
+func openParquet(path string) (Reader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrOpenFailed, err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%w: %w", ErrOpenFailed, err)
+	}
+	// OpenFile validates the footer; NewReader would panic on a malformed file.
+	pf, err := parquet.OpenFile(f, info.Size())
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%w: %w", ErrOpenFailed, err)
+	}
+	return &parquetReader{file: f, reader: parquet.NewReader(pf)}, nil
+}
+
+func (p *parquetReader) Read() (message.DynamicMessage, error) {
+	row := make(map[string]interface{})
+	if err := p.reader.Read(&row); err != nil {
+		return nil, err
+	}
+	msg := make(message.DynamicMessage, len(row))
+	for name, value := range row {
+		msg[name] = parquetValue(value)
+	}
+	return msg, nil
+}
+
+func (p *parquetReader) Close() error {
+	p.reader.Close()
+	return p.file.Close()
+}
+
+func parquetValue(v interface{}) interface{} {
+	switch x := v.(type) {
+	case int32:
+		return float64(x)
+	case int64:
+		return float64(x)
+	case uint32:
+		return float64(x)
+	case uint64:
+		return float64(x)
+	case float32:
+		return parquetFloat(float64(x))
+	case float64:
+		return parquetFloat(x)
+	case []byte:
+		return string(x)
+	case time.Time:
+		return x.Format(time.RFC3339Nano)
+	case map[string]interface{}:
+		for k, elem := range x {
+			x[k] = parquetValue(elem)
+		}
+		return x
+	case []interface{}:
+		for i, elem := range x {
+			x[i] = parquetValue(elem)
+		}
+		return x
+	default:
+		return v
+	}
+}
+
+func parquetFloat(f float64) interface{} {
+	if math.IsNaN(f) {
+		return nil
+	}
+	return f
+}
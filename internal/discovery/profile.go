@@ -0,0 +1,197 @@
+// Package discovery infers feature fields and types from sampled messages and
+// suggests a starting `features:` configuration.
+package discovery
+
+import (
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/sanspareilsmyn/featurelens/internal/message"
+)
+
+// Inferred field types.
+const (
+	TypeNumerical   = "numerical"
+	TypeCategorical = "categorical"
+	TypeBoolean     = "boolean"
+	TypeTimestamp   = "timestamp"
+	TypeString      = "string" // High-cardinality free text or identifiers
+	TypeNested      = "nested" // Objects and arrays
+	TypeMixed       = "mixed"  // No type dominates
+	TypeNull        = "null"   // Only null values were observed
+)
+
+// dominantShare is the fraction of non-null values a type needs to be inferred.
+const dominantShare = 0.95
+
+// FieldProfile accumulates what was observed for a single message field.
+type FieldProfile struct {
+	Name      string
+	Present   int64 // Messages containing the field, including explicit nulls
+	NullCount int64
+
+	numbers    int64
+	sum        float64
+	sumSq      float64
+	min, max   float64
+	strings    int64
+	timestamps int64
+	booleans   int64
+	nested     int64
+	distinct   map[string]struct{}
+	overflowed bool // More distinct strings than the profiler tracks
+}
+
+// NonNull returns the number of non-null observations.
+func (p *FieldProfile) NonNull() int64 {
+	return p.Present - p.NullCount
+}
+
+// Type returns the inferred type of the field.
+func (p *FieldProfile) Type(maxCategories int) string {
+	nonNull := p.NonNull()
+	if nonNull == 0 {
+		return TypeNull
+	}
+	dominates := func(n int64) bool { return float64(n) >= dominantShare*float64(nonNull) }
+	switch {
+	case dominates(p.numbers):
+		return TypeNumerical
+	case dominates(p.booleans):
+		return TypeBoolean
+	case dominates(p.nested):
+		return TypeNested
+	case dominates(p.timestamps):
+		return TypeTimestamp
+	case dominates(p.strings):
+		if p.overflowed || len(p.distinct) > maxCategories {
+			return TypeString
+		}
+		return TypeCategorical
+	}
+	return TypeMixed
+}
+
+// Mean returns the mean of the numeric values observed, NaN if there were none.
+func (p *FieldProfile) Mean() float64 {
+	if p.numbers == 0 {
+		return math.NaN()
+	}
+	return p.sum / float64(p.numbers)
+}
+
+// StdDev returns the population standard deviation of the numeric values observed.
+func (p *FieldProfile) StdDev() float64 {
+	if p.numbers == 0 {
+		return math.NaN()
+	}
+	mean := p.Mean()
+	variance := p.sumSq/float64(p.numbers) - mean*mean
+	if variance < 0 {
+		variance = 0 // Floating point error on near-constant values
+	}
+	return math.Sqrt(variance)
+}
+
+// Range returns the minimum and maximum numeric values observed.
+func (p *FieldProfile) Range() (float64, float64) {
+	return p.min, p.max
+}
+
+// DistinctValues returns the number of distinct string values tracked.
+func (p *FieldProfile) DistinctValues() int {
+	return len(p.distinct)
+}
+
+// Profiler observes messages and builds a FieldProfile per field. It is safe for concurrent use.
+type Profiler struct {
+	maxDistinct int
+
+	mu       sync.Mutex
+	messages int64
+	fields   map[string]*FieldProfile
+}
+
+// NewProfiler creates a Profiler tracking at most maxDistinct string values per field.
+func NewProfiler(maxDistinct int) *Profiler {
+	return &Profiler{
+		maxDistinct: maxDistinct,
+		fields:      make(map[string]*FieldProfile),
+	}
+}
+
+// Observe records every field of msg.
+func (p *Profiler) Observe(msg message.DynamicMessage) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.messages++
+	for name, value := range msg {
+		f, ok := p.fields[name]
+		if !ok {
+			f = &FieldProfile{Name: name, distinct: make(map[string]struct{})}
+			p.fields[name] = f
+		}
+		f.Present++
+		p.observeValue(f, msg, name, value)
+	}
+}
+
+func (p *Profiler) observeValue(f *FieldProfile, msg message.DynamicMessage, name string, value interface{}) {
+	if value == nil {
+		f.NullCount++
+		return
+	}
+	if v, ok := msg.GetFloat64(name); ok {
+		if f.numbers == 0 || *v < f.min {
+			f.min = *v
+		}
+		if f.numbers == 0 || *v > f.max {
+			f.max = *v
+		}
+		f.numbers++
+		f.sum += *v
+		f.sumSq += *v * *v
+		return
+	}
+	switch v := value.(type) {
+	case bool:
+		f.booleans++
+	case string:
+		if _, ok := msg.GetTime(name); ok {
+			f.timestamps++
+			return
+		}
+		f.strings++
+		if _, seen := f.distinct[v]; !seen {
+			if len(f.distinct) >= p.maxDistinct {
+				f.overflowed = true
+				return
+			}
+			f.distinct[v] = struct{}{}
+		}
+	case map[string]interface{}, []interface{}:
+		f.nested++
+	}
+}
+
+// Messages returns the number of messages observed.
+func (p *Profiler) Messages() int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.messages
+}
+
+// Fields returns the profiles of every field observed, sorted by name.
+func (p *Profiler) Fields() []*FieldProfile {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	fields := make([]*FieldProfile, 0, len(p.fields))
+	for _, f := range p.fields {
+		fields = append(fields, f)
+	}
+	sort.Slice(fields, func(i, j int) bool { return fields[i].Name < fields[j].Name })
+	return fields
+}
@@ -0,0 +1,160 @@
+package discovery
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"time"
+)
+
+// Options tune how profiles are turned into suggested features.
+type Options struct {
+	MaxCategories int           // String fields with more distinct values are treated as free text
+	Duration      time.Duration // Sampling duration, recorded in the generated header
+}
+
+// Suggestion is a suggested feature entry; Skipped explains why a field was left out.
+type Suggestion struct {
+	Name       string
+	MetricType string
+	Thresholds
+	Skipped string
+}
+
+// Thresholds are suggested bounds of a feature; the mean and standard deviation bounds
+// are nil for non-numerical features.
+type Thresholds struct {
+	NullRate    float64
+	MissingRate float64
+	MeanMin     *float64
+	MeanMax     *float64
+	StdDevMin   *float64
+	StdDevMax   *float64
+}
+
+// Suggest derives a feature entry with default thresholds for every profiled field.
+//
+// Thresholds are deliberately loose starting points: the null and missing rates allow the
+// observed rate plus the larger of 5 points or the observed rate again, the mean may drift by one
+// observed standard deviation, and the standard deviation may halve or double.
+func Suggest(p *Profiler, opts Options) []Suggestion {
+	messages := p.Messages()
+	fields := p.Fields()
+	suggestions := make([]Suggestion, 0, len(fields))
+
+	for _, f := range fields {
+		s := Suggestion{Name: f.Name}
+		switch t := f.Type(opts.MaxCategories); t {
+		case TypeNumerical, TypeCategorical, TypeBoolean:
+			s.MetricType = t
+		case TypeString:
+			s.MetricType = "text" // Identifiers and free text: lengths are monitored, not value frequencies
+		default:
+			s.Skipped = t + " values are not supported"
+		}
+		if s.Skipped != "" {
+			suggestions = append(suggestions, s)
+			continue
+		}
+
+		s.Thresholds = SuggestThresholds(messages, f.NullCount, messages-f.Present)
+		if s.MetricType == TypeNumerical {
+			s.Thresholds.suggestSpread(f.Mean(), f.StdDev())
+		}
+		suggestions = append(suggestions, s)
+	}
+	return suggestions
+}
+
+// SuggestThresholds derives the null and missing rate bounds of a feature absent or null
+// in some of messages, as Suggest does.
+func SuggestThresholds(messages, nulls, missing int64) Thresholds {
+	return Thresholds{NullRate: looseRate(nulls, messages), MissingRate: looseRate(missing, messages)}
+}
+
+// SuggestNumericalThresholds derives the bounds of a numerical feature whose values had
+// mean and standard deviation, as Suggest does.
+func SuggestNumericalThresholds(messages, nulls, missing int64, mean, stdDev float64) Thresholds {
+	t := SuggestThresholds(messages, nulls, missing)
+	t.suggestSpread(mean, stdDev)
+	return t
+}
+
+// suggestSpread sets the mean and standard deviation bounds.
+func (t *Thresholds) suggestSpread(mean, stdDev float64) {
+	drift := stdDev
+	if drift == 0 {
+		drift = math.Max(math.Abs(mean)*0.1, 1) // Constant in the sample; allow a small shift
+	}
+	t.MeanMin, t.MeanMax = ptr(round(mean-drift)), ptr(round(mean+drift))
+	if stdDev > 0 {
+		t.StdDevMin, t.StdDevMax = ptr(round(stdDev/2)), ptr(round(stdDev*2))
+	}
+}
+
+// looseRate returns the observed rate of n in messages plus the larger of 5 points or
+// the observed rate again, capped at 1.
+func looseRate(n, messages int64) float64 {
+	observed := 0.0
+	if messages > 0 {
+		observed = float64(n) / float64(messages)
+	}
+	return round(math.Min(1, observed+math.Max(0.05, observed)))
+}
+
+// WriteConfig writes the suggestions as a YAML `features:` block ready to paste into a config file.
+func WriteConfig(w io.Writer, p *Profiler, suggestions []Suggestion, opts Options) error {
+	ew := &errWriter{w: w}
+	ew.printf("# Generated by FeatureLens discovery from %d messages sampled over %s.\n", p.Messages(), opts.Duration)
+	ew.printf("# Review thresholds before use; they are derived from the sampled data only.\n")
+	ew.printf("features:\n")
+	for _, s := range suggestions {
+		if s.Skipped != "" {
+			ew.printf("  # skipped %q: %s\n", s.Name, s.Skipped)
+			continue
+		}
+		ew.printf("  - name: %q\n", s.Name)
+		ew.printf("    metricType: %q\n", s.MetricType)
+		ew.printf("    thresholds:\n")
+		ew.printf("      nullRateMax: %s\n", formatFloat(s.NullRate))
+		ew.printf("      missingRateMax: %s\n", formatFloat(s.MissingRate))
+		writeOptional(ew, "meanMin", s.MeanMin)
+		writeOptional(ew, "meanMax", s.MeanMax)
+		writeOptional(ew, "stdDevMin", s.StdDevMin)
+		writeOptional(ew, "stdDevMax", s.StdDevMax)
+	}
+	return ew.err
+}
+
+func writeOptional(ew *errWriter, key string, value *float64) {
+	if value != nil {
+		ew.printf("      %s: %s\n", key, formatFloat(*value))
+	}
+}
+
+// errWriter keeps the first write error so callers can check it once.
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (ew *errWriter) printf(format string, args ...interface{}) {
+	if ew.err == nil {
+		_, ew.err = fmt.Fprintf(ew.w, format, args...)
+	}
+}
+
+// round keeps four significant digits so suggestions stay readable.
+func round(v float64) float64 {
+	rounded, _ := strconv.ParseFloat(strconv.FormatFloat(v, 'g', 4, 64), 64)
+	return rounded
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+func ptr(v float64) *float64 {
+	return &v
+}
@@ -0,0 +1,143 @@
+package discovery
+
+import (
+	"io"
+	"math"
+	"slices"
+	"time"
+)
+
+// minRateHeadroom is the least a tuned rate bound exceeds the rate observed, so a
+// feature never null during learning is not alerted on for its first null.
+const minRateHeadroom = 0.01
+
+// TuneOptions tune how thresholds are fitted to the windows observed while learning.
+type TuneOptions struct {
+	Quantile   float64       // Upper quantile of each statistic bounds are fitted to, e.g. 0.99; the lower one is 1-Quantile
+	Margin     float64       // Fraction of the quantiles' range bounds are widened by
+	MinWindows int           // Windows a feature must be observed in to be tuned
+	Period     time.Duration // Learning period, recorded in the generated header
+}
+
+// WindowSamples are a feature's statistics in each window observed while learning;
+// Means and StdDevs are empty for non-numerical features.
+type WindowSamples struct {
+	NullRates    []float64
+	MissingRates []float64
+	Means        []float64
+	StdDevs      []float64
+}
+
+// Tuned is the thresholds fitted to a feature's windows; Skipped explains why a feature
+// was not tuned.
+type Tuned struct {
+	Name    string // Name of the feature's configuration entry, without its tenant
+	Tenant  string
+	Windows int
+	Thresholds
+	Skipped string
+}
+
+// Tune fits thresholds to the windows of a feature observed while learning. Each
+// statistic's bounds are its 1-Quantile and Quantile quantiles over the windows, widened
+// by Margin times their range; rate bounds allow at least one more point of nulls or
+// missing keys than observed.
+func Tune(name, tenant string, samples WindowSamples, opts TuneOptions) Tuned {
+	t := Tuned{Name: name, Tenant: tenant, Windows: len(samples.NullRates)}
+	if t.Windows < opts.MinWindows {
+		t.Skipped = "observed in too few windows"
+		return t
+	}
+	_, t.NullRate = fitBounds(samples.NullRates, opts)
+	_, t.MissingRate = fitBounds(samples.MissingRates, opts)
+	t.NullRate = round(math.Min(1, math.Max(t.NullRate, maxOf(samples.NullRates)+minRateHeadroom)))
+	t.MissingRate = round(math.Min(1, math.Max(t.MissingRate, maxOf(samples.MissingRates)+minRateHeadroom)))
+	if len(samples.Means) >= opts.MinWindows {
+		lower, upper := fitBounds(samples.Means, opts)
+		t.MeanMin, t.MeanMax = ptr(round(lower)), ptr(round(upper))
+	}
+	if len(samples.StdDevs) >= opts.MinWindows {
+		lower, upper := fitBounds(samples.StdDevs, opts)
+		t.StdDevMin, t.StdDevMax = ptr(round(math.Max(lower, 0))), ptr(round(upper))
+	}
+	return t
+}
+
+// fitBounds returns the quantile bounds of values, widened by the margin. Bounds of a
+// constant statistic are widened by the margin of its value.
+func fitBounds(values []float64, opts TuneOptions) (lower, upper float64) {
+	if len(values) == 0 {
+		return 0, 0
+	}
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+	lower, upper = quantile(sorted, 1-opts.Quantile), quantile(sorted, opts.Quantile)
+	pad := (upper - lower) * opts.Margin
+	if pad == 0 {
+		pad = math.Abs(upper) * opts.Margin
+	}
+	return lower - pad, upper + pad
+}
+
+// quantile returns the q quantile of sorted values, interpolating between ranks.
+func quantile(sorted []float64, q float64) float64 {
+	pos := q * float64(len(sorted)-1)
+	i := int(pos)
+	if i >= len(sorted)-1 {
+		return sorted[len(sorted)-1]
+	}
+	return sorted[i] + (sorted[i+1]-sorted[i])*(pos-float64(i))
+}
+
+func maxOf(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	return slices.Max(values)
+}
+
+// WritePatch writes the tuned thresholds as a configuration overlay: a `features:`
+// block naming each feature with only its thresholds, merged over the configuration
+// when listed after it in -config. current returns a feature's configured bound, shown
+// next to the suggestion for review.
+func WritePatch(w io.Writer, tuned []Tuned, opts TuneOptions, current func(t Tuned, key string) *float64) error {
+	ew := &errWriter{w: w}
+	ew.printf("# Generated by `featurelens tune` from the windows observed over %s.\n", opts.Period)
+	ew.printf("# Bounds are the %s and %s quantiles of each statistic per window, widened by %s of their range.\n",
+		formatFloat(round(1-opts.Quantile)), formatFloat(opts.Quantile), formatFloat(opts.Margin))
+	ew.printf("# Review, then apply by listing this file after the configuration: -config config.yaml,<this file>.\n")
+	ew.printf("features:\n")
+	for _, t := range tuned {
+		if t.Skipped != "" {
+			ew.printf("  # skipped %q: %s (%d windows)\n", t.Name, t.Skipped, t.Windows)
+			continue
+		}
+		if t.Tenant != "" {
+			ew.printf("  - name: %q # tenant %s, %d windows\n", t.Name, t.Tenant, t.Windows)
+		} else {
+			ew.printf("  - name: %q # %d windows\n", t.Name, t.Windows)
+		}
+		ew.printf("    thresholds:\n")
+		for _, b := range []struct {
+			key   string
+			value *float64
+		}{
+			{"nullRateMax", &t.NullRate},
+			{"missingRateMax", &t.MissingRate},
+			{"meanMin", t.MeanMin},
+			{"meanMax", t.MeanMax},
+			{"stdDevMin", t.StdDevMin},
+			{"stdDevMax", t.StdDevMax},
+		} {
+			if b.value == nil {
+				continue
+			}
+			if was := current(t, b.key); was != nil {
+				ew.printf("      %s: %s # was %s\n", b.key, formatFloat(*b.value), formatFloat(*was))
+			} else {
+				ew.printf("      %s: %s\n", b.key, formatFloat(*b.value))
+			}
+		}
+	}
+	return ew.err
+}
@@ -0,0 +1,257 @@
+package expr
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+type node interface {
+	eval(env Env) (any, error)
+	collectIdents(seen map[string]struct{})
+}
+
+type literalNode struct{ value any }
+
+func (n *literalNode) eval(Env) (any, error)             { return n.value, nil }
+func (n *literalNode) collectIdents(map[string]struct{}) {}
+
+type identNode struct{ name string }
+
+func (n *identNode) eval(env Env) (any, error) {
+	val, ok := env.Lookup(n.name)
+	if !ok {
+		return nil, nil // Undefined identifiers behave like null so missing fields never match
+	}
+	return normalize(val), nil
+}
+
+func (n *identNode) collectIdents(seen map[string]struct{}) { seen[n.name] = struct{}{} }
+
+type unaryNode struct {
+	op      string
+	operand node
+}
+
+func (n *unaryNode) eval(env Env) (any, error) {
+	val, err := n.operand.eval(env)
+	if err != nil || val == nil {
+		return nil, err
+	}
+	switch n.op {
+	case "!":
+		b, ok := val.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%w: '!' requires a boolean, got %T", ErrTypeMismatch, val)
+		}
+		return !b, nil
+	default: // "-"
+		f, ok := val.(float64)
+		if !ok {
+			return nil, fmt.Errorf("%w: unary '-' requires a number, got %T", ErrTypeMismatch, val)
+		}
+		return -f, nil
+	}
+}
+
+func (n *unaryNode) collectIdents(seen map[string]struct{}) { n.operand.collectIdents(seen) }
+
+type binaryNode struct {
+	op          string
+	left, right node
+}
+
+func (n *binaryNode) eval(env Env) (any, error) {
+	if n.op == "&&" || n.op == "||" {
+		return n.evalLogical(env)
+	}
+
+	left, err := n.left.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	right, err := n.right.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "==":
+		return equal(left, right), nil
+	case "!=":
+		return !equal(left, right), nil
+	case "<", "<=", ">", ">=":
+		return compare(n.op, left, right)
+	default:
+		return arithmetic(n.op, left, right)
+	}
+}
+
+// evalLogical short-circuits && and ||; null operands are treated as false.
+func (n *binaryNode) evalLogical(env Env) (any, error) {
+	left, err := n.left.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	lb, err := truthy(left)
+	if err != nil {
+		return nil, err
+	}
+	if n.op == "&&" && !lb {
+		return false, nil
+	}
+	if n.op == "||" && lb {
+		return true, nil
+	}
+	right, err := n.right.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	return truthy(right)
+}
+
+func (n *binaryNode) collectIdents(seen map[string]struct{}) {
+	n.left.collectIdents(seen)
+	n.right.collectIdents(seen)
+}
+
+type callNode struct {
+	name string
+	fn   function
+	args []node
+}
+
+func (n *callNode) eval(env Env) (any, error) {
+	args := make([]any, len(n.args))
+	for i, arg := range n.args {
+		val, err := arg.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = val
+	}
+	return n.fn.call(args)
+}
+
+func (n *callNode) collectIdents(seen map[string]struct{}) {
+	for _, arg := range n.args {
+		arg.collectIdents(seen)
+	}
+}
+
+func truthy(v any) (bool, error) {
+	switch b := v.(type) {
+	case nil:
+		return false, nil
+	case bool:
+		return b, nil
+	default:
+		return false, fmt.Errorf("%w: expected boolean operand, got %T", ErrTypeMismatch, v)
+	}
+}
+
+func equal(a, b any) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	switch av := a.(type) {
+	case float64:
+		bv, ok := b.(float64)
+		return ok && av == bv
+	case string:
+		bv, ok := b.(string)
+		return ok && av == bv
+	case bool:
+		bv, ok := b.(bool)
+		return ok && av == bv
+	}
+	return false
+}
+
+// compare orders numbers or strings; comparisons involving null are always false.
+func compare(op string, a, b any) (any, error) {
+	if a == nil || b == nil {
+		return false, nil
+	}
+	var cmp int
+	switch av := a.(type) {
+	case float64:
+		bv, ok := b.(float64)
+		if !ok {
+			return nil, fmt.Errorf("%w: cannot compare number with %T", ErrTypeMismatch, b)
+		}
+		if math.IsNaN(av) || math.IsNaN(bv) {
+			return false, nil
+		}
+		switch {
+		case av < bv:
+			cmp = -1
+		case av > bv:
+			cmp = 1
+		}
+	case string:
+		bv, ok := b.(string)
+		if !ok {
+			return nil, fmt.Errorf("%w: cannot compare string with %T", ErrTypeMismatch, b)
+		}
+		cmp = strings.Compare(av, bv)
+	default:
+		return nil, fmt.Errorf("%w: cannot order values of type %T", ErrTypeMismatch, a)
+	}
+
+	switch op {
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	default: // ">="
+		return cmp >= 0, nil
+	}
+}
+
+// arithmetic applies numeric operators; null operands propagate as null.
+func arithmetic(op string, a, b any) (any, error) {
+	if a == nil || b == nil {
+		return nil, nil
+	}
+	av, aok := a.(float64)
+	bv, bok := b.(float64)
+	if !aok || !bok {
+		return nil, fmt.Errorf("%w: '%s' requires numbers, got %T and %T", ErrTypeMismatch, op, a, b)
+	}
+	switch op {
+	case "+":
+		return av + bv, nil
+	case "-":
+		return av - bv, nil
+	case "*":
+		return av * bv, nil
+	case "/":
+		return av / bv, nil
+	default: // "%"
+		return math.Mod(av, bv), nil
+	}
+}
+
+// normalize converts numeric values of any Go type to float64 so operators see a single number type.
+func normalize(v any) any {
+	switch n := v.(type) {
+	case int:
+		return float64(n)
+	case int32:
+		return float64(n)
+	case int64:
+		return float64(n)
+	case uint:
+		return float64(n)
+	case uint32:
+		return float64(n)
+	case uint64:
+		return float64(n)
+	case float32:
+		return float64(n)
+	}
+	return v
+}
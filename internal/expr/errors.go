@@ -0,0 +1,13 @@
+package expr
+
+import "errors"
+
+var (
+	ErrSyntax              = errors.New("expression syntax error")
+	ErrTypeMismatch        = errors.New("expression type mismatch")
+	ErrUnknownFunction     = errors.New("unknown expression function")
+	ErrWrongArgumentCount  = errors.New("wrong number of function arguments")
+	ErrNotBoolean          = errors.New("expression did not evaluate to a boolean")
+	ErrNotNumber           = errors.New("expression did not evaluate to a number")
+	ErrUndefinedIdentifier = errors.New("undefined identifier")
+)
@@ -0,0 +1,89 @@
+// Package expr implements the small expression language used in configuration for
+// alert conditions, filters and derived values, e.g. `null_rate > 0.2 && count > 1000`.
+//
+// Values are numbers (float64), strings, booleans or null. Undefined identifiers
+// evaluate to null; comparisons involving null are false and arithmetic on null
+// yields null, so expressions over missing data never match by accident.
+package expr
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Env resolves identifiers during evaluation.
+type Env interface {
+	Lookup(name string) (any, bool)
+}
+
+// MapEnv is an Env backed by a map.
+type MapEnv map[string]any
+
+func (m MapEnv) Lookup(name string) (any, bool) {
+	v, ok := m[name]
+	return v, ok
+}
+
+// Expr is a compiled expression, safe for concurrent evaluation.
+type Expr struct {
+	source string
+	root   node
+}
+
+// Compile parses an expression.
+func Compile(source string) (*Expr, error) {
+	root, err := parse(source)
+	if err != nil {
+		return nil, fmt.Errorf("%w (in %q)", err, source)
+	}
+	return &Expr{source: source, root: root}, nil
+}
+
+// String returns the expression source.
+func (e *Expr) String() string { return e.source }
+
+// Identifiers returns the sorted, de-duplicated identifiers referenced by the expression.
+func (e *Expr) Identifiers() []string {
+	seen := make(map[string]struct{})
+	e.root.collectIdents(seen)
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Eval evaluates the expression and returns its raw value.
+func (e *Expr) Eval(env Env) (any, error) {
+	return e.root.eval(env)
+}
+
+// EvalBool evaluates the expression as a condition. A null result is treated as false.
+func (e *Expr) EvalBool(env Env) (bool, error) {
+	val, err := e.root.eval(env)
+	if err != nil {
+		return false, err
+	}
+	switch b := val.(type) {
+	case nil:
+		return false, nil
+	case bool:
+		return b, nil
+	default:
+		return false, fmt.Errorf("%w: got %T", ErrNotBoolean, val)
+	}
+}
+
+// EvalFloat evaluates the expression as a number. ok is false when the result is null.
+func (e *Expr) EvalFloat(env Env) (value float64, ok bool, err error) {
+	val, err := e.root.eval(env)
+	if err != nil || val == nil {
+		return 0, false, err
+	}
+	f, isNum := val.(float64)
+	if !isNum {
+		return 0, false, fmt.Errorf("%w: got %T", ErrNotNumber, val)
+	}
+	return f, true, nil
+}
@@ -0,0 +1,223 @@
+package expr
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		src   string
+		kinds []tokenKind
+		texts []string
+	}{
+		{"", []tokenKind{tokEOF}, []string{""}},
+		{"  \t\n", []tokenKind{tokEOF}, []string{""}},
+		{"a>=1", []tokenKind{tokIdent, tokOp, tokNumber, tokEOF}, []string{"a", ">=", "1", ""}},
+		{"a>-1", []tokenKind{tokIdent, tokOp, tokOp, tokNumber, tokEOF}, []string{"a", ">", "-", "1", ""}},
+		{"x&&!y||z", []tokenKind{tokIdent, tokOp, tokOp, tokIdent, tokOp, tokIdent, tokEOF}, []string{"x", "&&", "!", "y", "||", "z", ""}},
+		{"1.5e-3 .5 2E+2", []tokenKind{tokNumber, tokNumber, tokNumber, tokEOF}, []string{"1.5e-3", ".5", "2E+2", ""}},
+		{"prev_mean clicks.count _x2", []tokenKind{tokIdent, tokIdent, tokIdent, tokEOF}, []string{"prev_mean", "clicks.count", "_x2", ""}},
+		{`"a \"b\"" 'c\'d'`, []tokenKind{tokString, tokString, tokEOF}, []string{`a "b"`, "c'd", ""}},
+		{"max(a, 2)", []tokenKind{tokIdent, tokLParen, tokIdent, tokComma, tokNumber, tokRParen, tokEOF}, []string{"max", "(", "a", ",", "2", ")", ""}},
+	}
+	for _, tt := range tests {
+		tokens, err := tokenize(tt.src)
+		if err != nil {
+			t.Errorf("tokenize(%q): %v", tt.src, err)
+			continue
+		}
+		kinds, texts := make([]tokenKind, len(tokens)), make([]string, len(tokens))
+		for i, tok := range tokens {
+			kinds[i], texts[i] = tok.kind, tok.text
+		}
+		if !reflect.DeepEqual(kinds, tt.kinds) || !reflect.DeepEqual(texts, tt.texts) {
+			t.Errorf("tokenize(%q): got kinds %v texts %q, want %v %q", tt.src, kinds, texts, tt.kinds, tt.texts)
+		}
+	}
+}
+
+func TestTokenizeErrors(t *testing.T) {
+	for _, src := range []string{`"unterminated`, `'x`, "a # b", "a = 1", "a & b", "1.2.3", "1e"} {
+		if _, err := tokenize(src); !errors.Is(err, ErrSyntax) {
+			t.Errorf("tokenize(%q): got %v, want %v", src, err, ErrSyntax)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		want error
+	}{
+		{"", ErrSyntax},
+		{"a >", ErrSyntax},
+		{"(a > 1", ErrSyntax},
+		{"a > 1)", ErrSyntax},
+		{"a b", ErrSyntax},
+		{"max(1,", ErrSyntax},
+		{"max(1 2)", ErrSyntax},
+		{"* 2", ErrSyntax},
+		{"nope(1)", ErrUnknownFunction},
+		{"abs()", ErrWrongArgumentCount},
+		{"abs(1, 2)", ErrWrongArgumentCount},
+		{"min()", ErrWrongArgumentCount},
+	}
+	for _, tt := range tests {
+		if _, err := Compile(tt.src); !errors.Is(err, tt.want) {
+			t.Errorf("Compile(%q): got %v, want %v", tt.src, err, tt.want)
+		}
+	}
+}
+
+// TestPrecedence checks operator binding and associativity through the values the
+// expressions evaluate to.
+func TestPrecedence(t *testing.T) {
+	tests := []struct {
+		src  string
+		want any
+	}{
+		{"1 + 2 * 3", 7.0},
+		{"(1 + 2) * 3", 9.0},
+		{"10 - 4 - 3", 3.0}, // Left-associative
+		{"64 / 4 / 2", 8.0}, // Left-associative
+		{"7 % 4 * 2", 6.0},  // Same level as *, left to right
+		{"-2 * 3", -6.0},    // Unary minus binds tighter
+		{"- 2 - -3", 1.0},   // Unary minus on either operand
+		{"2 * -(1 + 2)", -6.0},
+		{"1 + 2 > 2", true},              // Arithmetic before comparison
+		{"1 < 2 == 2 < 3", true},         // Comparison before equality
+		{"true || false && false", true}, // && before ||
+		{"(true || false) && false", false},
+		{"!false && false", false}, // ! binds tighter than &&
+		{"!(false && false)", true},
+		{"1 + 1 == 2 && 3 > 2 || false", true},
+		{"abs(-3) + max(1, 4, 2) * min(2, 3)", 11.0},
+		{"sqrt(16) - len('héllo')", -1.0},
+	}
+	for _, tt := range tests {
+		e, err := Compile(tt.src)
+		if err != nil {
+			t.Errorf("Compile(%q): %v", tt.src, err)
+			continue
+		}
+		got, err := e.Eval(MapEnv{})
+		if err != nil || got != tt.want {
+			t.Errorf("%q: got %v (err %v), want %v", tt.src, got, err, tt.want)
+		}
+	}
+}
+
+// TestNullHandling checks that null, undefined identifiers included, propagates through
+// arithmetic and functions, makes comparisons false and is false in conditions.
+func TestNullHandling(t *testing.T) {
+	env := MapEnv{"n": nil, "x": 2.0, "i": int64(3), "s": "a"}
+	tests := []struct {
+		src  string
+		want any
+	}{
+		{"missing", nil},
+		{"n + 1", nil},
+		{"missing * x", nil},
+		{"-missing", nil},
+		{"!missing", nil},
+		{"abs(missing)", nil},
+		{"max(x, missing)", nil},
+		{"len(missing)", nil},
+		{"missing > 1", false},
+		{"missing < 1", false},
+		{"missing >= missing", false},
+		{"missing == null", true},
+		{"n == missing", true},
+		{"x == null", false},
+		{"x != null", true},
+		{"missing && true", false},
+		{"missing || true", true},
+		{"missing || missing", false},
+		{"i + x", 5.0}, // Integers are numbers
+		{"s == 'a'", true},
+		{"x / 0 > 1", true},  // +Inf
+		{"0 / 0 > 1", false}, // NaN compares false
+	}
+	for _, tt := range tests {
+		e, err := Compile(tt.src)
+		if err != nil {
+			t.Errorf("Compile(%q): %v", tt.src, err)
+			continue
+		}
+		got, err := e.Eval(env)
+		if err != nil || got != tt.want {
+			t.Errorf("%q: got %v (err %v), want %v", tt.src, got, err, tt.want)
+		}
+	}
+
+	for _, src := range []string{"missing", "missing > 1", "n + 1 > 0"} {
+		if match, err := mustCompile(t, src).EvalBool(env); err != nil || match {
+			t.Errorf("EvalBool(%q): got %v (err %v), want false", src, match, err)
+		}
+	}
+	if _, ok, err := mustCompile(t, "missing * 2").EvalFloat(env); ok || err != nil {
+		t.Errorf("EvalFloat of null: got ok %v (err %v), want not ok", ok, err)
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	env := MapEnv{"s": "a", "x": 1.0, "b": true}
+	tests := []struct {
+		src  string
+		want error
+	}{
+		{"s + 1", ErrTypeMismatch},
+		{"s > 1", ErrTypeMismatch},
+		{"b < true", ErrTypeMismatch},
+		{"!x", ErrTypeMismatch},
+		{"-s", ErrTypeMismatch},
+		{"x && true", ErrTypeMismatch},
+		{"abs(s)", ErrTypeMismatch},
+		{"len(x)", ErrTypeMismatch},
+	}
+	for _, tt := range tests {
+		if _, err := mustCompile(t, tt.src).Eval(env); !errors.Is(err, tt.want) {
+			t.Errorf("%q: got %v, want %v", tt.src, err, tt.want)
+		}
+	}
+	if _, err := mustCompile(t, "x + 1").EvalBool(env); !errors.Is(err, ErrNotBoolean) {
+		t.Errorf("EvalBool of a number: got %v, want %v", err, ErrNotBoolean)
+	}
+	if _, _, err := mustCompile(t, "s").EvalFloat(env); !errors.Is(err, ErrNotNumber) {
+		t.Errorf("EvalFloat of a string: got %v, want %v", err, ErrNotNumber)
+	}
+}
+
+func TestShortCircuit(t *testing.T) {
+	// The right operands would fail on a string, so they must not be evaluated
+	env := MapEnv{"s": "a"}
+	for src, want := range map[string]bool{"false && s > 1": false, "true || -s": true} {
+		got, err := mustCompile(t, src).EvalBool(env)
+		if err != nil || got != want {
+			t.Errorf("%q: got %v (err %v), want %v", src, got, err, want)
+		}
+	}
+}
+
+func TestIdentifiers(t *testing.T) {
+	e := mustCompile(t, "abs(mean - prev_mean) > 0.1 * prev_mean && clicks.count > 0 && true")
+	want := []string{"clicks.count", "mean", "prev_mean"}
+	if got := e.Identifiers(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got := mustCompile(t, "1 + 2").Identifiers(); len(got) != 0 {
+		t.Errorf("literals: got %v, want none", got)
+	}
+}
+
+// mustCompile compiles src, failing the test on error.
+func mustCompile(t *testing.T, src string) *Expr {
+	t.Helper()
+	e, err := Compile(src)
+	if err != nil {
+		t.Fatalf("Compile(%q): %v", src, err)
+	}
+	return e
+}
@@ -0,0 +1,72 @@
+package expr
+
+import (
+	"fmt"
+	"math"
+	"unicode/utf8"
+)
+
+type function struct {
+	minArgs int
+	maxArgs int // -1 for variadic
+	call    func(args []any) (any, error)
+}
+
+// functions lists the built-in functions available to expressions.
+var functions = map[string]function{
+	"abs":  {minArgs: 1, maxArgs: 1, call: numericUnary(math.Abs)},
+	"sqrt": {minArgs: 1, maxArgs: 1, call: numericUnary(math.Sqrt)},
+	"log":  {minArgs: 1, maxArgs: 1, call: numericUnary(math.Log)},
+	"min":  {minArgs: 1, maxArgs: -1, call: numericFold(math.Min)},
+	"max":  {minArgs: 1, maxArgs: -1, call: numericFold(math.Max)},
+	"len":  {minArgs: 1, maxArgs: 1, call: length},
+}
+
+func numericUnary(fn func(float64) float64) func([]any) (any, error) {
+	return func(args []any) (any, error) {
+		if args[0] == nil {
+			return nil, nil
+		}
+		f, ok := args[0].(float64)
+		if !ok {
+			return nil, fmt.Errorf("%w: expected number, got %T", ErrTypeMismatch, args[0])
+		}
+		return fn(f), nil
+	}
+}
+
+func numericFold(fn func(a, b float64) float64) func([]any) (any, error) {
+	return func(args []any) (any, error) {
+		var acc float64
+		for i, arg := range args {
+			if arg == nil {
+				return nil, nil
+			}
+			f, ok := arg.(float64)
+			if !ok {
+				return nil, fmt.Errorf("%w: expected number, got %T", ErrTypeMismatch, arg)
+			}
+			if i == 0 {
+				acc = f
+				continue
+			}
+			acc = fn(acc, f)
+		}
+		return acc, nil
+	}
+}
+
+func length(args []any) (any, error) {
+	switch v := args[0].(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return float64(utf8.RuneCountInString(v)), nil
+	case []any:
+		return float64(len(v)), nil
+	case map[string]any:
+		return float64(len(v)), nil
+	default:
+		return nil, fmt.Errorf("%w: len() requires a string, array or object, got %T", ErrTypeMismatch, v)
+	}
+}
@@ -0,0 +1,10 @@
+package feast
+
+import "errors"
+
+var (
+	ErrReadingRegistry     = errors.New("failed to read Feast registry")
+	ErrUnsupportedRegistry = errors.New("unsupported Feast registry format, export it with `feast registry-dump`")
+	ErrUnknownFeatureView  = errors.New("feature view not found in Feast registry")
+	ErrInvalidMetricType   = errors.New("featurelens.metricType tag must be numerical or categorical")
+)
@@ -0,0 +1,219 @@
+// Package feast generates FeatureLens feature configs from the feature definitions of a
+// Feast feature store registry, so monitoring follows the feature store instead of a
+// hand-maintained list.
+package feast
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/sanspareilsmyn/featurelens/internal/config"
+)
+
+// tagPrefix marks Feast feature tags read by FeatureLens, e.g. featurelens.min.
+const tagPrefix = "featurelens."
+
+// thresholdTags are the threshold keys that may be set through tags, e.g.
+// `featurelens.nullRateMax: "0.05"`. Keys renamed by later config versions are accepted
+// under their old name too.
+var thresholdTags = []string{
+	"nullRateMax", "missingRateMax", "typeMismatchRateMax", "meanMin", "meanMax", "stdDevMin", "stdDevMax", "zeroRateMax", "outlierRateMax",
+	"avgLengthMin", "avgLengthMax", "maxLength", "patternMatchRateMin", "trueRateMin", "trueRateMax",
+}
+
+// Registry is the part of a Feast registry dump (`feast registry-dump`) FeatureLens reads.
+type Registry struct {
+	FeatureViews       []FeatureView `json:"featureViews"`
+	StreamFeatureViews []FeatureView `json:"streamFeatureViews"`
+}
+
+// FeatureView is a Feast feature view.
+type FeatureView struct {
+	Spec struct {
+		Name     string            `json:"name"`
+		Project  string            `json:"project"`
+		Features []Feature         `json:"features"`
+		Tags     map[string]string `json:"tags"`
+	} `json:"spec"`
+}
+
+// Feature is a feature of a Feast feature view.
+type Feature struct {
+	Name      string            `json:"name"`
+	ValueType string            `json:"valueType"`
+	Tags      map[string]string `json:"tags"`
+}
+
+// Load reads a Feast registry dump in JSON.
+func Load(path string) (*Registry, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrReadingRegistry, err)
+	}
+	if !json.Valid(raw) {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedRegistry, path) // e.g. the protobuf registry.db
+	}
+	var reg Registry
+	if err := json.Unmarshal(raw, &reg); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrReadingRegistry, err)
+	}
+	return &reg, nil
+}
+
+// Options select the features imported from a registry.
+type Options struct {
+	Project      string   // Only feature views of this project; empty for all
+	FeatureViews []string // Only these feature views; empty for all
+	// FullFeatureNames names features <view>__<feature>, as Feast does with
+	// full_feature_names=True, for streams carrying features of several views.
+	FullFeatureNames bool
+}
+
+// Definition is a feature imported from a registry.
+type Definition struct {
+	Name        string
+	FeatureView string
+	MetricType  string
+	Tags        map[string]string
+	Thresholds  map[string]float64 // By threshold key, e.g. meanMin
+	Skipped     string             // Why the feature is not monitored, empty if it is
+}
+
+// Definitions returns the features of the selected feature views, ordered by view and
+// feature. Numerical value types are monitored as numerical features, strings as
+// categorical ones, booleans as boolean ones, and other types (lists, bytes, timestamps)
+// are skipped.
+//
+// Feature tags refine the definition: featurelens.metricType overrides the metric type
+// (numerical, categorical or boolean; other values are an error), featurelens.min and
+// featurelens.max give the expected range of values (which window means must stay
+// within), featurelens.<threshold> sets a threshold and featurelens.skip=true leaves the
+// feature out. The view's other tags (e.g. team) are
+// copied to its features for bulk operations.
+func Definitions(reg *Registry, opts Options) ([]Definition, error) {
+	var views []FeatureView
+	for _, v := range append(slices.Clone(reg.FeatureViews), reg.StreamFeatureViews...) {
+		if opts.Project != "" && v.Spec.Project != opts.Project {
+			continue
+		}
+		if len(opts.FeatureViews) > 0 && !slices.Contains(opts.FeatureViews, v.Spec.Name) {
+			continue
+		}
+		views = append(views, v)
+	}
+	for _, name := range opts.FeatureViews {
+		if !slices.ContainsFunc(views, func(v FeatureView) bool { return v.Spec.Name == name }) {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownFeatureView, name)
+		}
+	}
+	sort.SliceStable(views, func(i, j int) bool { return views[i].Spec.Name < views[j].Spec.Name })
+
+	var defs []Definition
+	for _, v := range views {
+		for _, f := range v.Spec.Features {
+			def, err := define(v, f, opts)
+			if err != nil {
+				return nil, err
+			}
+			defs = append(defs, def)
+		}
+	}
+	return defs, nil
+}
+
+// define converts a feature of a view.
+func define(v FeatureView, f Feature, opts Options) (Definition, error) {
+	def := Definition{
+		Name:        f.Name,
+		FeatureView: v.Spec.Name,
+		MetricType:  metricType(f.ValueType),
+		Tags:        map[string]string{"source": "feast", "feature_view": v.Spec.Name},
+		Thresholds:  make(map[string]float64),
+	}
+	if opts.FullFeatureNames {
+		def.Name = v.Spec.Name + "__" + f.Name
+	}
+	for key, value := range v.Spec.Tags {
+		if !strings.HasPrefix(key, tagPrefix) {
+			def.Tags[key] = value
+		}
+	}
+	if def.MetricType == "" {
+		def.Skipped = fmt.Sprintf("value type %s is not monitored", cmp.Or(f.ValueType, "INVALID"))
+	}
+
+	for key, value := range f.Tags {
+		setting, ok := strings.CutPrefix(key, tagPrefix)
+		if !ok {
+			continue
+		}
+		switch setting {
+		case "skip":
+			if skip, _ := strconv.ParseBool(value); skip {
+				def.Skipped = "tagged " + key
+			}
+			continue
+		case "metricType":
+			if value != config.MetricTypeNumerical && value != config.MetricTypeCategorical && value != config.MetricTypeBoolean {
+				return Definition{}, fmt.Errorf("%w: %s tag %q of feature %q in %q", ErrInvalidMetricType, key, value, f.Name, v.Spec.Name)
+			}
+			def.MetricType = value
+			if def.Skipped != "" && !strings.HasPrefix(def.Skipped, "tagged") {
+				def.Skipped = ""
+			}
+			continue
+		case "min":
+			setting = "meanMin"
+		case "max":
+			setting = "meanMax"
+		}
+		setting = config.MigratedThresholdKey(setting) // Tags predate the registry's config version
+		if !slices.Contains(thresholdTags, setting) {
+			continue // Unknown featurelens.* tags are ignored
+		}
+		if n, err := strconv.ParseFloat(value, 64); err == nil {
+			def.Thresholds[setting] = n
+		}
+	}
+	return def, nil
+}
+
+// metricType returns the metric type monitoring a Feast value type, empty if none does.
+func metricType(valueType string) string {
+	switch valueType {
+	case "INT32", "INT64", "FLOAT", "DOUBLE":
+		return config.MetricTypeNumerical
+	case "STRING":
+		return config.MetricTypeCategorical
+	case "BOOL":
+		return config.MetricTypeBoolean
+	}
+	return ""
+}
+
+// WriteConfig writes the definitions as a `features:` config block, meant to be kept in
+// its own file and included from the main configuration. Skipped features are listed in
+// the header comment.
+func WriteConfig(w io.Writer, defs []Definition, source string) error {
+	file := config.GeneratedFile{Command: "feast import", Source: source}
+	for _, d := range defs {
+		if d.Skipped != "" {
+			file.Comments = append(file.Comments, fmt.Sprintf("skipped %q (%s): %s", d.Name, d.FeatureView, d.Skipped))
+			continue
+		}
+		file.Features = append(file.Features, config.GeneratedFeature{
+			Name:       d.Name,
+			MetricType: d.MetricType,
+			Tags:       d.Tags,
+			Thresholds: d.Thresholds,
+		})
+	}
+	return config.WriteGenerated(w, file)
+}
@@ -0,0 +1,62 @@
+// Package intern deduplicates frequently repeated strings (category values,
+// feature names) so identical values share a single backing allocation.
+package intern
+
+import "sync"
+
+// Pool is a bounded, concurrency-safe string interning table.
+// Once maxEntries distinct strings are held, new strings are returned as-is
+// rather than retained, so memory stays bounded under high-cardinality input.
+type Pool struct {
+	mu         sync.RWMutex
+	strings    map[string]string
+	maxEntries int
+}
+
+// New creates a Pool holding at most maxEntries distinct strings.
+func New(maxEntries int) *Pool {
+	return &Pool{
+		strings:    make(map[string]string),
+		maxEntries: maxEntries,
+	}
+}
+
+// Intern returns the canonical copy of s.
+func (p *Pool) Intern(s string) string {
+	p.mu.RLock()
+	canonical, ok := p.strings[s]
+	p.mu.RUnlock()
+	if ok {
+		return canonical
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if canonical, ok := p.strings[s]; ok {
+		return canonical
+	}
+	if len(p.strings) >= p.maxEntries {
+		return s
+	}
+	p.strings[s] = s
+	return s
+}
+
+// InternBytes returns the canonical string for b. Lookups of already interned
+// values do not allocate.
+func (p *Pool) InternBytes(b []byte) string {
+	p.mu.RLock()
+	canonical, ok := p.strings[string(b)] // Compiler optimises map lookup by string(b) without allocating
+	p.mu.RUnlock()
+	if ok {
+		return canonical
+	}
+	return p.Intern(string(b))
+}
+
+// Len returns the number of interned strings.
+func (p *Pool) Len() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return len(p.strings)
+}
@@ -0,0 +1,77 @@
+package intern
+
+import (
+	"fmt"
+	"runtime"
+	"testing"
+)
+
+// labelValues are categorical values as decoded from payloads: the same few strings,
+// each occurrence in its own byte slice.
+func labelValues(n, distinct int) [][]byte {
+	values := make([][]byte, n)
+	for i := range values {
+		values[i] = []byte(fmt.Sprintf("country_code_%03d", i%distinct))
+	}
+	return values
+}
+
+func TestInternBytesDoesNotAllocateForKnownValues(t *testing.T) {
+	p := New(16)
+	value := []byte("country_code_001")
+	p.InternBytes(value)
+
+	if allocs := testing.AllocsPerRun(100, func() { p.InternBytes(value) }); allocs != 0 {
+		t.Fatalf("InternBytes of an interned value allocated %v times, want 0", allocs)
+	}
+}
+
+func TestPoolStopsRetainingAtMaxEntries(t *testing.T) {
+	p := New(2)
+	for _, s := range []string{"a", "b", "c", "a"} {
+		if got := p.Intern(s); got != s {
+			t.Fatalf("Intern(%q) = %q", s, got)
+		}
+	}
+	if p.Len() != 2 {
+		t.Fatalf("Len() = %d, want 2", p.Len())
+	}
+}
+
+// BenchmarkLabelStrings compares holding a window's worth of categorical label values
+// as fresh strings with holding them as interned by the field parser, from the payload
+// bytes. Besides allocations per op, it reports the heap retained by the held values.
+func BenchmarkLabelStrings(b *testing.B) {
+	const window, distinct = 10000, 50
+	values := labelValues(window, distinct)
+
+	run := func(b *testing.B, convert func([]byte) string) {
+		b.ReportAllocs()
+		held := make([]string, window)
+		var retained uint64
+		for i := 0; i < b.N; i++ {
+			var before, after runtime.MemStats
+			clear(held) // Release the previous round's strings
+			runtime.GC()
+			runtime.ReadMemStats(&before)
+			for j, v := range values {
+				held[j] = convert(v)
+			}
+			runtime.GC()
+			runtime.ReadMemStats(&after)
+			if after.HeapAlloc > before.HeapAlloc {
+				retained += after.HeapAlloc - before.HeapAlloc
+			}
+		}
+		runtime.KeepAlive(held)
+		b.ReportMetric(float64(retained)/float64(b.N), "retained-B/op")
+	}
+
+	b.Run("plain", func(b *testing.B) {
+		run(b, func(v []byte) string { return string(v) })
+	})
+	b.Run("interned", func(b *testing.B) {
+		p := New(distinct)
+		run(b, p.InternBytes)
+	})
+}
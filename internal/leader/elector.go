@@ -0,0 +1,232 @@
+// Package leader elects one leader among replicas through a Kubernetes Lease, so that
+// highly available deployments consume and alert only once.
+package leader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+
+	"github.com/sanspareilsmyn/featurelens/internal/config"
+)
+
+// Elector competes for a lease with the other replicas. The lease's expiry is judged by
+// the local clock from when its record last changed, so clock skew between replicas does
+// not cause two leaders.
+type Elector struct {
+	cfg      config.LeaderElectionConfig
+	identity string
+	client   *leaseClient
+	isLeader prometheus.Gauge
+	logger   *zap.Logger
+
+	observed   leaseSpec // Lease record last read
+	observedAt time.Time // When the record last changed
+}
+
+// NewElector creates an elector for the configured lease, using the in-cluster
+// Kubernetes API credentials. The identity defaults to the hostname. Its leadership
+// gauge is registered on reg, unless nil.
+func NewElector(cfg config.LeaderElectionConfig, reg prometheus.Registerer, logger *zap.Logger) (*Elector, error) {
+	identity := cfg.Identity
+	if identity == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrIdentityUnknown, err)
+		}
+		identity = hostname
+	}
+	client, err := newInClusterClient(cfg.Namespace, cfg.LeaseName, cfg.RetryPeriod)
+	if err != nil {
+		return nil, err
+	}
+	isLeader := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "featurelens_leader",
+		Help: "Whether this instance holds the leader election lease (1) or stands by (0).",
+	})
+	if reg != nil {
+		if err := reg.Register(isLeader); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrMetricsRegistration, err)
+		}
+	}
+	return &Elector{cfg: cfg, identity: identity, client: client, isLeader: isLeader, logger: logger}, nil
+}
+
+// Run waits until this replica holds the lease, then runs lead with a context that is
+// cancelled if the lease cannot be renewed within the renew deadline. When lead returns,
+// the lease is released so a standby takes over within its retry period rather than
+// after the lease expires.
+// Returns lead's error, ErrLeadershipLost if leadership was lost, or the context's
+// error if it is cancelled before this replica leads.
+func (e *Elector) Run(ctx context.Context, lead func(context.Context) error) error {
+	sugar := e.logger.Sugar()
+	e.isLeader.Set(0)
+	sugar.Infow("Waiting for leadership",
+		"lease", e.client.namespace+"/"+e.client.name,
+		"identity", e.identity,
+	)
+	if err := e.acquire(ctx); err != nil {
+		return err
+	}
+	sugar.Infow("Acquired leadership", "identity", e.identity)
+	e.isLeader.Set(1)
+	defer e.isLeader.Set(0)
+
+	leadCtx, stop := context.WithCancelCause(ctx)
+	renewed := make(chan struct{})
+	go func() {
+		defer close(renewed)
+		e.renew(leadCtx, stop)
+	}()
+	err := lead(leadCtx)
+	lost := errors.Is(context.Cause(leadCtx), ErrLeadershipLost)
+	stop(nil)
+	<-renewed
+
+	if lost {
+		sugar.Errorw("Lost leadership", "identity", e.identity)
+		return ErrLeadershipLost
+	}
+	e.release()
+	return err
+}
+
+// acquire retries until this replica holds the lease or the context is cancelled.
+func (e *Elector) acquire(ctx context.Context) error {
+	for {
+		ok, err := e.tryAcquireOrRenew(ctx)
+		if err != nil && ctx.Err() == nil {
+			e.logger.Warn("Failed to acquire lease", zap.Error(err))
+		}
+		if ok {
+			return nil
+		}
+		// Jitter keeps standbys that started together from contending in lockstep
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(e.cfg.RetryPeriod + rand.N(e.cfg.RetryPeriod/5+1)):
+		}
+	}
+}
+
+// renew renews the lease every retry period until ctx is done, cancelling it with
+// ErrLeadershipLost once no renewal succeeded for the renew deadline, or another
+// replica took the lease.
+func (e *Elector) renew(ctx context.Context, stop context.CancelCauseFunc) {
+	ticker := time.NewTicker(e.cfg.RetryPeriod)
+	defer ticker.Stop()
+	lastRenewal := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		ok, err := e.tryAcquireOrRenew(ctx)
+		switch {
+		case ok:
+			lastRenewal = time.Now()
+			continue
+		case ctx.Err() != nil:
+			return
+		case err == nil:
+			e.logger.Error("Lease taken by another replica", zap.String("holder", e.observed.HolderIdentity))
+		case time.Since(lastRenewal) < e.cfg.RenewDeadline:
+			e.logger.Warn("Failed to renew lease, retrying", zap.Error(err))
+			continue
+		default:
+			e.logger.Error("Failed to renew lease before the renew deadline", zap.Error(err))
+		}
+		stop(ErrLeadershipLost)
+		return
+	}
+}
+
+// tryAcquireOrRenew takes the lease if it is free or expired, or renews it if this
+// replica holds it. It reports whether this replica holds the lease afterwards.
+func (e *Elector) tryAcquireOrRenew(ctx context.Context) (bool, error) {
+	now := time.Now()
+	l, err := e.client.get(ctx)
+	if err != nil {
+		return false, err
+	}
+	if l == nil {
+		l = &lease{Spec: e.record(now, leaseSpec{})}
+		if err := e.client.create(ctx, l); err != nil {
+			if errors.Is(err, ErrLeaseConflict) {
+				return false, nil // Another replica created it first
+			}
+			return false, err
+		}
+		e.observe(l.Spec, now)
+		return true, nil
+	}
+
+	if l.Spec != e.observed {
+		if l.Spec.HolderIdentity != e.observed.HolderIdentity && l.Spec.HolderIdentity != e.identity {
+			e.logger.Info("Lease holder changed", zap.String("holder", l.Spec.HolderIdentity))
+		}
+		e.observe(l.Spec, now)
+	}
+	expiry := e.observedAt.Add(time.Duration(l.Spec.LeaseDurationSeconds) * time.Second)
+	if holder := l.Spec.HolderIdentity; holder != "" && holder != e.identity && now.Before(expiry) {
+		return false, nil
+	}
+
+	l.Spec = e.record(now, l.Spec)
+	if err := e.client.update(ctx, l); err != nil {
+		if errors.Is(err, ErrLeaseConflict) {
+			return false, nil // Another replica updated it first
+		}
+		return false, err
+	}
+	e.observe(l.Spec, now)
+	return true, nil
+}
+
+// record returns the lease record held by this replica, renewed at now.
+func (e *Elector) record(now time.Time, prev leaseSpec) leaseSpec {
+	spec := leaseSpec{
+		HolderIdentity:       e.identity,
+		LeaseDurationSeconds: max(int(e.cfg.LeaseDuration.Round(time.Second)/time.Second), 1),
+		AcquireTime:          prev.AcquireTime,
+		RenewTime:            now.UTC().Format(microTime),
+		LeaseTransitions:     prev.LeaseTransitions,
+	}
+	if prev.HolderIdentity != e.identity {
+		spec.AcquireTime = spec.RenewTime
+		spec.LeaseTransitions++
+	}
+	return spec
+}
+
+func (e *Elector) observe(spec leaseSpec, now time.Time) {
+	e.observed, e.observedAt = spec, now
+}
+
+// release gives up the lease if this replica still holds it.
+func (e *Elector) release() {
+	ctx, cancel := context.WithTimeout(context.Background(), e.cfg.RenewDeadline)
+	defer cancel()
+	l, err := e.client.get(ctx)
+	if err == nil && (l == nil || l.Spec.HolderIdentity != e.identity) {
+		return
+	}
+	if err == nil {
+		now := time.Now().UTC().Format(microTime)
+		l.Spec = leaseSpec{LeaseDurationSeconds: 1, AcquireTime: now, RenewTime: now, LeaseTransitions: l.Spec.LeaseTransitions}
+		err = e.client.update(ctx, l)
+	}
+	if err != nil {
+		e.logger.Warn("Failed to release lease; standbys take over once it expires", zap.Error(err))
+		return
+	}
+	e.logger.Info("Released leadership", zap.String("identity", e.identity))
+}
@@ -0,0 +1,12 @@
+package leader
+
+import "errors"
+
+var (
+	ErrNotInCluster        = errors.New("leader election requires running in a Kubernetes cluster")
+	ErrLeaseAPI            = errors.New("kubernetes lease request failed")
+	ErrLeaseConflict       = errors.New("lease was modified concurrently")
+	ErrLeadershipLost      = errors.New("lost leadership: the lease could not be renewed")
+	ErrIdentityUnknown     = errors.New("failed to determine leader election identity")
+	ErrMetricsRegistration = errors.New("failed to register leader election metrics")
+)
@@ -0,0 +1,162 @@
+package leader
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// serviceAccountDir holds the credentials Kubernetes mounts into every pod.
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// microTime is the layout of the API's MicroTime fields.
+const microTime = "2006-01-02T15:04:05.000000Z07:00"
+
+// lease is a coordination.k8s.io/v1 Lease, with the fields leader election uses.
+type lease struct {
+	APIVersion string     `json:"apiVersion"`
+	Kind       string     `json:"kind"`
+	Metadata   objectMeta `json:"metadata"`
+	Spec       leaseSpec  `json:"spec"`
+}
+
+type objectMeta struct {
+	Name            string `json:"name"`
+	Namespace       string `json:"namespace"`
+	ResourceVersion string `json:"resourceVersion,omitempty"` // Rejects updates based on a stale read
+}
+
+type leaseSpec struct {
+	HolderIdentity       string `json:"holderIdentity,omitempty"`
+	LeaseDurationSeconds int    `json:"leaseDurationSeconds,omitempty"`
+	AcquireTime          string `json:"acquireTime,omitempty"`
+	RenewTime            string `json:"renewTime,omitempty"`
+	LeaseTransitions     int    `json:"leaseTransitions,omitempty"`
+}
+
+// leaseClient reads and writes one Lease through the Kubernetes API.
+type leaseClient struct {
+	namespace string
+	name      string
+	baseURL   string // e.g. https://10.0.0.1:443
+	tokenFile string // Re-read for every request, as projected tokens are rotated
+	http      *http.Client
+}
+
+// newInClusterClient creates a client for the lease, authenticating with the pod's
+// service account. The namespace defaults to the pod's.
+func newInClusterClient(namespace, name string, timeout time.Duration) (*leaseClient, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, fmt.Errorf("%w: KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT are not set", ErrNotInCluster)
+	}
+	ca, err := os.ReadFile(filepath.Join(serviceAccountDir, "ca.crt"))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrNotInCluster, err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("%w: no certificates in the service account CA", ErrNotInCluster)
+	}
+	if namespace == "" {
+		raw, err := os.ReadFile(filepath.Join(serviceAccountDir, "namespace"))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrNotInCluster, err)
+		}
+		namespace = strings.TrimSpace(string(raw))
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	return &leaseClient{
+		namespace: namespace,
+		name:      name,
+		baseURL:   "https://" + net.JoinHostPort(host, port),
+		tokenFile: filepath.Join(serviceAccountDir, "token"),
+		http:      &http.Client{Timeout: timeout, Transport: transport},
+	}, nil
+}
+
+func (c *leaseClient) collectionURL() string {
+	return c.baseURL + "/apis/coordination.k8s.io/v1/namespaces/" + url.PathEscape(c.namespace) + "/leases"
+}
+
+// get returns the lease, or nil if it does not exist.
+func (c *leaseClient) get(ctx context.Context) (*lease, error) {
+	var l lease
+	status, err := c.do(ctx, http.MethodGet, c.collectionURL()+"/"+url.PathEscape(c.name), nil, &l)
+	if status == http.StatusNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+// create creates the lease. It fails with ErrLeaseConflict if another replica created
+// it first.
+func (c *leaseClient) create(ctx context.Context, l *lease) error {
+	l.APIVersion, l.Kind = "coordination.k8s.io/v1", "Lease"
+	l.Metadata = objectMeta{Name: c.name, Namespace: c.namespace}
+	_, err := c.do(ctx, http.MethodPost, c.collectionURL(), l, l)
+	return err
+}
+
+// update replaces the lease read earlier. It fails with ErrLeaseConflict if the lease
+// changed since.
+func (c *leaseClient) update(ctx context.Context, l *lease) error {
+	_, err := c.do(ctx, http.MethodPut, c.collectionURL()+"/"+url.PathEscape(c.name), l, l)
+	return err
+}
+
+// do sends a request, decoding a successful response into out, and returns the status.
+func (c *leaseClient) do(ctx context.Context, method, target string, in, out interface{}) (int, error) {
+	var body io.Reader
+	if in != nil {
+		raw, err := json.Marshal(in)
+		if err != nil {
+			return 0, err
+		}
+		body = bytes.NewReader(raw)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "featurelens")
+	if c.tokenFile != "" {
+		token, err := os.ReadFile(c.tokenFile)
+		if err != nil {
+			return 0, fmt.Errorf("%w: %w", ErrLeaseAPI, err)
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrLeaseAPI, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		return resp.StatusCode, json.NewDecoder(resp.Body).Decode(out)
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if resp.StatusCode == http.StatusConflict {
+		return resp.StatusCode, ErrLeaseConflict
+	}
+	return resp.StatusCode, fmt.Errorf("%w: %s %s: status %d: %s", ErrLeaseAPI, method, target, resp.StatusCode, bytes.TrimSpace(msg))
+}
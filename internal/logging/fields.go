@@ -0,0 +1,42 @@
+package logging
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Keys of the structured fields shared by every component, so that entries about the
+// same feature, window or check can be correlated whichever component logged them.
+const (
+	PipelineKey    = "pipeline"     // Deployment the entry comes from, set on the root logger
+	FeatureKey     = "feature_name" // Feature, or segment of a feature, the entry is about
+	CheckKey       = "check_type"   // Check the entry is about, e.g. "null_rate"
+	WindowStartKey = "window_start"
+	WindowEndKey   = "window_end"
+)
+
+// Pipeline returns the pipeline field.
+func Pipeline(name string) zap.Field {
+	return zap.String(PipelineKey, name)
+}
+
+// Feature returns the field of the feature an entry is about.
+func Feature(name string) zap.Field {
+	return zap.String(FeatureKey, name)
+}
+
+// Check returns the field of the check an entry is about.
+func Check(checkType string) zap.Field {
+	return zap.String(CheckKey, checkType)
+}
+
+// WindowStart returns the field of the start of the window an entry is about.
+func WindowStart(t time.Time) zap.Field {
+	return zap.Time(WindowStartKey, t)
+}
+
+// WindowEnd returns the field of the end of the window an entry is about.
+func WindowEnd(t time.Time) zap.Field {
+	return zap.Time(WindowEndKey, t)
+}
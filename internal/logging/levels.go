@@ -0,0 +1,125 @@
+package logging
+
+import (
+	"maps"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Levels is the verbosity of a logger built by NewLogger, adjustable at runtime, e.g.
+// through the admin API during an incident: a level for every entry, overridden for the
+// loggers of some components. A component is a logger name, e.g. "alerter", and covers
+// the loggers named under it, e.g. "alerter.extensions"; the most specific one applies.
+// It is safe for concurrent use.
+type Levels struct {
+	base zap.AtomicLevel
+
+	mu         sync.RWMutex
+	components map[string]zapcore.Level
+	minimum    atomic.Int32 // Lowest level enabled for any component, read without the lock on every entry
+}
+
+func newLevels(level zapcore.Level) *Levels {
+	l := &Levels{base: zap.NewAtomicLevelAt(level), components: make(map[string]zapcore.Level)}
+	l.minimum.Store(int32(level))
+	return l
+}
+
+// Level returns the level of the loggers of components without an override.
+func (l *Levels) Level() zapcore.Level {
+	return l.base.Level()
+}
+
+// SetLevel changes the level of the loggers of components without an override.
+func (l *Levels) SetLevel(level zapcore.Level) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.base.SetLevel(level)
+	l.updateMinimum()
+}
+
+// SetComponent overrides the level of the component's loggers.
+func (l *Levels) SetComponent(component string, level zapcore.Level) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.components[component] = level
+	l.updateMinimum()
+}
+
+// ResetComponent removes the override of the component's loggers, reporting whether it
+// had one.
+func (l *Levels) ResetComponent(component string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.components[component]; !ok {
+		return false
+	}
+	delete(l.components, component)
+	l.updateMinimum()
+	return true
+}
+
+// Components returns the overridden levels by component.
+func (l *Levels) Components() map[string]zapcore.Level {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return maps.Clone(l.components)
+}
+
+// enabled reports whether entries of the level are logged by the named logger.
+func (l *Levels) enabled(loggerName string, level zapcore.Level) bool {
+	if !l.anyEnabled(level) {
+		return false
+	}
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	for name := loggerName; ; {
+		if componentLevel, ok := l.components[name]; ok {
+			return level >= componentLevel
+		}
+		i := strings.LastIndexByte(name, '.')
+		if i < 0 {
+			return l.base.Enabled(level)
+		}
+		name = name[:i]
+	}
+}
+
+// anyEnabled reports whether entries of the level are logged by any logger.
+func (l *Levels) anyEnabled(level zapcore.Level) bool {
+	return int32(level) >= l.minimum.Load()
+}
+
+func (l *Levels) updateMinimum() {
+	minimum := l.base.Level()
+	for _, level := range l.components {
+		minimum = min(minimum, level)
+	}
+	l.minimum.Store(int32(minimum))
+}
+
+// levelFilter is a core logging the entries its Levels enable for their logger. The
+// cores it wraps log every level.
+type levelFilter struct {
+	zapcore.Core
+	levels *Levels
+}
+
+func (f *levelFilter) Enabled(level zapcore.Level) bool {
+	return f.levels.anyEnabled(level)
+}
+
+func (f *levelFilter) With(fields []zapcore.Field) zapcore.Core {
+	return &levelFilter{Core: f.Core.With(fields), levels: f.levels}
+}
+
+func (f *levelFilter) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if !f.levels.enabled(entry.LoggerName, entry.Level) {
+		return checked
+	}
+	return f.Core.Check(entry, checked)
+}
@@ -14,8 +14,9 @@ import (
 )
 
 // NewLogger initializes a zap logger based on the provided configuration,
-// supporting both console and rotating file output.
-func NewLogger(cfg config.LogConfig) (*zap.Logger, error) {
+// supporting both console and rotating file output. The returned Levels change the
+// verbosity of the logger and those derived from it at runtime.
+func NewLogger(cfg config.LogConfig) (*zap.Logger, *Levels, error) {
 	level, err := parseLevel(cfg.Level)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "WARN: %v, defaulting to INFO level\n", err)
@@ -32,12 +33,12 @@ func NewLogger(cfg config.LogConfig) (*zap.Logger, error) {
 		consoleEncoder := buildEncoder(true)
 		consoleDebugging := zapcore.Lock(os.Stdout)
 		consoleErrors := zapcore.Lock(os.Stderr)
-		// Filter levels for different console outputs
+		// Filter levels for different console outputs; the configured level is applied by levelFilter
 		coreConsoleInfo := zapcore.NewCore(consoleEncoder, consoleDebugging, zap.LevelEnablerFunc(func(lvl zapcore.Level) bool {
-			return lvl >= level && lvl < zapcore.ErrorLevel // Log configured level up to Warn on stdout
+			return lvl < zapcore.ErrorLevel // Log up to Warn on stdout
 		}))
 		coreConsoleError := zapcore.NewCore(consoleEncoder, consoleErrors, zap.LevelEnablerFunc(func(lvl zapcore.Level) bool {
-			return lvl >= level && lvl >= zapcore.ErrorLevel // Log Error and above on stderr
+			return lvl >= zapcore.ErrorLevel // Log Error and above on stderr
 		}))
 		cores = append(cores, coreConsoleInfo, coreConsoleError)
 	}
@@ -45,7 +46,7 @@ func NewLogger(cfg config.LogConfig) (*zap.Logger, error) {
 	// Configure File Output
 	if cfg.FileLoggingEnabled {
 		if err := os.MkdirAll(cfg.Directory, 0755); err != nil {
-			return nil, fmt.Errorf("failed to create log directory '%s': %w", cfg.Directory, err)
+			return nil, nil, fmt.Errorf("failed to create log directory '%s': %w", cfg.Directory, err)
 		}
 
 		// Configure lumberjack
@@ -59,24 +60,34 @@ func NewLogger(cfg config.LogConfig) (*zap.Logger, error) {
 		fileEncoder := buildEncoder(false)
 		fileSyncer := zapcore.AddSync(ljack)
 
-		coreFile := zapcore.NewCore(fileEncoder, fileSyncer, level)
+		coreFile := zapcore.NewCore(fileEncoder, fileSyncer, zapcore.DebugLevel)
 		cores = append(cores, coreFile)
 	}
 
 	// Combine cores if multiple outputs are configured
 	var combinedCore zapcore.Core
 	if len(cores) == 0 {
-		return nil, fmt.Errorf("no logging outputs configured (neither console nor file enabled)")
+		return nil, nil, fmt.Errorf("no logging outputs configured (neither console nor file enabled)")
 	} else if len(cores) == 1 {
 		combinedCore = cores[0]
 	} else {
 		combinedCore = zapcore.NewTee(cores...)
 	}
+	if cfg.Sampling.Enabled {
+		combinedCore = zapcore.NewSamplerWithOptions(combinedCore, cfg.Sampling.Tick, cfg.Sampling.Initial, cfg.Sampling.Thereafter)
+	}
+	if cfg.RepeatInterval > 0 {
+		// Outside the sampler, so that sampled out warnings are counted as suppressed too
+		combinedCore = newRepeatLimiter(combinedCore, cfg.RepeatInterval)
+	}
+	// Outermost, so that entries of disabled levels are neither sampled nor counted as repeats
+	levels := newLevels(level)
+	combinedCore = &levelFilter{Core: combinedCore, levels: levels}
 
 	// --- Build Logger Options ---
+	// Components log through zap directly, so the caller is the frame calling the logger
 	loggerOptions := []zap.Option{
 		zap.AddCaller(),
-		zap.AddCallerSkip(1),
 	}
 	if isDevelopment {
 		loggerOptions = append(loggerOptions, zap.Development(), zap.AddStacktrace(zapcore.WarnLevel))
@@ -85,6 +96,9 @@ func NewLogger(cfg config.LogConfig) (*zap.Logger, error) {
 	}
 
 	logger := zap.New(combinedCore, loggerOptions...)
+	if cfg.Pipeline != "" {
+		logger = logger.With(Pipeline(cfg.Pipeline))
+	}
 
 	logger.Debug("Zap logger constructed",
 		zap.String("final_level", level.String()),
@@ -92,9 +106,11 @@ func NewLogger(cfg config.LogConfig) (*zap.Logger, error) {
 		zap.Bool("file_logging_enabled", cfg.FileLoggingEnabled),
 		zap.String("file_path", filepath.Join(cfg.Directory, cfg.Filename)),
 		zap.Bool("development_mode", isDevelopment),
+		zap.Bool("sampling_enabled", cfg.Sampling.Enabled),
+		zap.Duration("repeat_interval", cfg.RepeatInterval),
 	)
 
-	return logger, nil
+	return logger, levels, nil
 }
 
 func parseLevel(levelStr string) (zapcore.Level, error) {
@@ -0,0 +1,92 @@
+package logging
+
+import (
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// repeatLimiter is a core logging each warning at most once per interval, by logger name
+// and message, so a storm of identical warnings (e.g. a parse failure per message) does
+// not flood the logs. The next warning logged after an interval counts the ones
+// suppressed in a suppressed field. Other levels are logged as they are.
+type repeatLimiter struct {
+	zapcore.Core
+	interval time.Duration
+	now      func() time.Time
+	state    *repeatState // Shared by the cores derived with With
+}
+
+type repeatState struct {
+	mu      sync.Mutex
+	entries map[repeatKey]*repeatEntry
+}
+
+type repeatKey struct {
+	logger, message string
+}
+
+type repeatEntry struct {
+	logged     time.Time
+	suppressed int
+}
+
+// maxRepeatEntries bounds the warnings tracked; once reached, entries of past intervals
+// are forgotten.
+const maxRepeatEntries = 10000
+
+func newRepeatLimiter(core zapcore.Core, interval time.Duration) zapcore.Core {
+	return &repeatLimiter{
+		Core:     core,
+		interval: interval,
+		now:      time.Now,
+		state:    &repeatState{entries: make(map[repeatKey]*repeatEntry)},
+	}
+}
+
+func (r *repeatLimiter) With(fields []zapcore.Field) zapcore.Core {
+	return &repeatLimiter{Core: r.Core.With(fields), interval: r.interval, now: r.now, state: r.state}
+}
+
+func (r *repeatLimiter) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if entry.Level != zapcore.WarnLevel || !r.Enabled(entry.Level) {
+		return r.Core.Check(entry, checked)
+	}
+	suppressed, ok := r.state.allow(repeatKey{entry.LoggerName, entry.Message}, r.now(), r.interval)
+	if !ok {
+		return checked
+	}
+	if suppressed > 0 {
+		return r.Core.With([]zapcore.Field{zap.Int("suppressed", suppressed)}).Check(entry, checked)
+	}
+	return r.Core.Check(entry, checked)
+}
+
+// allow reports whether a warning may be logged at now, and how many identical ones were
+// suppressed since the last one logged.
+func (s *repeatState) allow(key repeatKey, now time.Time, interval time.Duration) (int, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[key]
+	if ok && now.Sub(e.logged) < interval {
+		e.suppressed++
+		return 0, false
+	}
+	if !ok {
+		if len(s.entries) >= maxRepeatEntries {
+			for k, old := range s.entries {
+				if now.Sub(old.logged) >= interval {
+					delete(s.entries, k)
+				}
+			}
+		}
+		e = &repeatEntry{}
+		s.entries[key] = e
+	}
+	suppressed := e.suppressed
+	e.logged, e.suppressed = now, 0
+	return suppressed, true
+}
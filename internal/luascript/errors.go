@@ -0,0 +1,8 @@
+package luascript
+
+import "errors"
+
+var (
+	ErrCompileFailed   = errors.New("failed to compile lua script")
+	ErrTransformFailed = errors.New("lua script failed to transform message")
+)
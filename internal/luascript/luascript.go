@@ -0,0 +1,232 @@
+// Package luascript runs the Lua scripts of pipeline script steps, which transform
+// decoded messages with logic the built-in steps cannot express. Scripts run in a pure-Go
+// Lua 5.1 interpreter (gopher-lua), so the binary stays statically linked.
+//
+// A script defines a global function transform(msg), called with each message as a
+// table of its fields. It changes the table in place, or returns a table replacing it.
+// Explicit nulls are the global null, so `msg.x = null` keeps x as a null value while
+// `msg.x = nil` removes it. Only the base, table, string and math libraries are opened:
+// scripts cannot read files, run commands or load other code.
+package luascript
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+)
+
+// entryPoint is the function a script must define.
+const entryPoint = "transform"
+
+// DefaultTimeout bounds a script's run on one message when its step sets no timeout.
+const DefaultTimeout = 100 * time.Millisecond
+
+// Script is a compiled script, safe for concurrent use: every goroutine running it
+// borrows an interpreter of its own from a pool.
+type Script struct {
+	name    string
+	proto   *lua.FunctionProto
+	timeout time.Duration
+	states  sync.Pool
+}
+
+// Compile compiles a script and checks that it defines transform. name identifies it in
+// errors, e.g. its file. A timeout of 0 is DefaultTimeout.
+func Compile(name, source string, timeout time.Duration) (*Script, error) {
+	chunk, err := parse.Parse(strings.NewReader(source), name)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrCompileFailed, err)
+	}
+	proto, err := lua.Compile(chunk, name)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrCompileFailed, err)
+	}
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	s := &Script{name: name, proto: proto, timeout: timeout}
+	L, err := s.newState()
+	if err != nil {
+		return nil, err
+	}
+	s.states.Put(L)
+	return s, nil
+}
+
+// newState returns a sandboxed interpreter that ran the script's top level, so its
+// transform function is defined.
+func (s *Script) newState() (*lua.LState, error) {
+	L := lua.NewState(lua.Options{SkipOpenLibs: true})
+	for _, lib := range []struct {
+		name string
+		open lua.LGFunction
+	}{
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.StringLibName, lua.OpenString},
+		{lua.MathLibName, lua.OpenMath},
+	} {
+		L.Push(L.NewFunction(lib.open))
+		L.Push(lua.LString(lib.name))
+		L.Call(1, 0)
+	}
+	for _, unsafe := range []string{"dofile", "loadfile", "load", "loadstring", "require", "module"} {
+		L.SetGlobal(unsafe, lua.LNil)
+	}
+	L.SetGlobal("null", null(L))
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	L.SetContext(ctx)
+	L.Push(L.NewFunctionFromProto(s.proto))
+	err := L.PCall(0, 0, nil)
+	L.RemoveContext()
+	if err != nil {
+		L.Close()
+		return nil, fmt.Errorf("%w: %s: %w", ErrCompileFailed, s.name, err)
+	}
+	if L.GetGlobal(entryPoint).Type() != lua.LTFunction {
+		L.Close()
+		return nil, fmt.Errorf("%w: %s does not define a %s(msg) function", ErrCompileFailed, s.name, entryPoint)
+	}
+	return L, nil
+}
+
+// Transform runs the script on a message, replacing its fields with those of the table
+// transform left or returned. On error, the message is left as it was.
+func (s *Script) Transform(msg map[string]interface{}) error {
+	L, _ := s.states.Get().(*lua.LState)
+	if L == nil {
+		var err error
+		if L, err = s.newState(); err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	L.SetContext(ctx)
+	table := toLua(L, msg).(*lua.LTable)
+	L.Push(L.GetGlobal(entryPoint))
+	L.Push(table)
+	err := L.PCall(1, 1, nil)
+	L.RemoveContext()
+	if err != nil {
+		L.Close() // May be left mid-call, e.g. on a timeout
+		return fmt.Errorf("%w: %s: %w", ErrTransformFailed, s.name, err)
+	}
+	result := L.Get(-1)
+	L.Pop(1)
+	switch result := result.(type) {
+	case *lua.LTable:
+		table = result
+	case *lua.LNilType:
+	default:
+		s.states.Put(L)
+		return fmt.Errorf("%w: %s: %s returned a %s, not a table or nothing", ErrTransformFailed, s.name, entryPoint, result.Type())
+	}
+
+	fields, ok := fromLua(table).(map[string]interface{})
+	s.states.Put(L)
+	if !ok {
+		return fmt.Errorf("%w: %s: the message became a list", ErrTransformFailed, s.name)
+	}
+	clear(msg)
+	for k, v := range fields {
+		msg[k] = v
+	}
+	return nil
+}
+
+// nullKey is the registry key of the null value of an interpreter.
+const nullKey = "featurelens.null"
+
+// null returns the value standing for explicit nulls in an interpreter.
+func null(L *lua.LState) lua.LValue {
+	if v := L.GetField(L.Get(lua.RegistryIndex), nullKey); v != lua.LNil {
+		return v
+	}
+	v := L.NewUserData()
+	L.SetField(L.Get(lua.RegistryIndex), nullKey, v)
+	return v
+}
+
+// toLua converts a decoded message value to Lua: objects to tables by key, lists to
+// sequences, numbers to Lua numbers and nulls to null.
+func toLua(L *lua.LState, v interface{}) lua.LValue {
+	switch v := v.(type) {
+	case nil:
+		return null(L)
+	case bool:
+		return lua.LBool(v)
+	case string:
+		return lua.LString(v)
+	case float64:
+		return lua.LNumber(v)
+	case float32:
+		return lua.LNumber(v)
+	case int:
+		return lua.LNumber(v)
+	case int32:
+		return lua.LNumber(v)
+	case int64:
+		return lua.LNumber(v)
+	case map[string]interface{}:
+		table := L.CreateTable(0, len(v))
+		for k, item := range v {
+			table.RawSetString(k, toLua(L, item))
+		}
+		return table
+	case []interface{}:
+		table := L.CreateTable(len(v), 0)
+		for _, item := range v {
+			table.Append(toLua(L, item))
+		}
+		return table
+	default:
+		return lua.LString(fmt.Sprint(v))
+	}
+}
+
+// fromLua converts a Lua value back to a message value: tables whose keys are 1..n to
+// lists, other tables to objects, non-finite numbers and functions to null.
+func fromLua(v lua.LValue) interface{} {
+	switch v := v.(type) {
+	case lua.LBool:
+		return bool(v)
+	case lua.LString:
+		return string(v)
+	case lua.LNumber:
+		if f := float64(v); !math.IsNaN(f) && !math.IsInf(f, 0) {
+			return f
+		}
+		return nil
+	case *lua.LTable:
+		if n := v.MaxN(); n > 0 && n == countKeys(v) {
+			list := make([]interface{}, 0, n)
+			for i := 1; i <= n; i++ {
+				list = append(list, fromLua(v.RawGetInt(i)))
+			}
+			return list
+		}
+		object := make(map[string]interface{})
+		v.ForEach(func(k, item lua.LValue) {
+			object[k.String()] = fromLua(item)
+		})
+		return object
+	default: // nil, null, functions and userdata
+		return nil
+	}
+}
+
+func countKeys(t *lua.LTable) int {
+	n := 0
+	t.ForEach(func(lua.LValue, lua.LValue) { n++ })
+	return n
+}
@@ -0,0 +1,114 @@
+package luascript
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestTransform checks that scripts see and change messages with their value types,
+// explicit nulls and removed fields preserved.
+func TestTransform(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		input  map[string]interface{}
+		want   map[string]interface{}
+	}{
+		{
+			name:   "in place",
+			source: `function transform(msg) msg.total = msg.price * msg.qty; msg.qty = nil end`,
+			input:  map[string]interface{}{"price": 2.5, "qty": 4.0},
+			want:   map[string]interface{}{"price": 2.5, "total": 10.0},
+		},
+		{
+			name:   "returned table replaces the message",
+			source: `function transform(msg) return {id = msg.id} end`,
+			input:  map[string]interface{}{"id": "a", "other": true},
+			want:   map[string]interface{}{"id": "a"},
+		},
+		{
+			name:   "explicit nulls survive and can be set",
+			source: `function transform(msg) msg.b = null end`,
+			input:  map[string]interface{}{"a": nil},
+			want:   map[string]interface{}{"a": nil, "b": nil},
+		},
+		{
+			name:   "objects and lists",
+			source: `function transform(msg) msg.first = msg.items[1]; msg.kind = msg.meta.kind; msg.empty = {} end`,
+			input:  map[string]interface{}{"items": []interface{}{"x", "y"}, "meta": map[string]interface{}{"kind": "k"}},
+			want: map[string]interface{}{
+				"items": []interface{}{"x", "y"}, "meta": map[string]interface{}{"kind": "k"},
+				"first": "x", "kind": "k", "empty": map[string]interface{}{},
+			},
+		},
+		{
+			name:   "non-finite numbers become null",
+			source: `function transform(msg) msg.ratio = msg.a / msg.b end`,
+			input:  map[string]interface{}{"a": 1.0, "b": 0.0},
+			want:   map[string]interface{}{"a": 1.0, "b": 0.0, "ratio": nil},
+		},
+		{
+			name:   "string library",
+			source: `function transform(msg) msg.code = string.upper(string.sub(msg.country, 1, 2)) end`,
+			input:  map[string]interface{}{"country": "fr-be"},
+			want:   map[string]interface{}{"country": "fr-be", "code": "FR"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := Compile("test", tt.source, 0)
+			if err != nil {
+				t.Fatalf("Compile: %v", err)
+			}
+			if err := s.Transform(tt.input); err != nil {
+				t.Fatalf("Transform: %v", err)
+			}
+			if !reflect.DeepEqual(tt.input, tt.want) {
+				t.Errorf("got %#v, want %#v", tt.input, tt.want)
+			}
+		})
+	}
+}
+
+// TestCompileRejects checks that scripts failing to compile, to define transform or to
+// stay in the sandbox are rejected when compiled.
+func TestCompileRejects(t *testing.T) {
+	for name, source := range map[string]string{
+		"syntax error":     `function transform(`,
+		"no transform":     `x = 1`,
+		"transform not fn": `transform = 1`,
+		"os library":       `os.exit(1) function transform(msg) end`,
+		"io library":       `io.open("/etc/passwd") function transform(msg) end`,
+		"dofile":           `dofile("/tmp/x.lua") function transform(msg) end`,
+	} {
+		if _, err := Compile("test", source, 0); !errors.Is(err, ErrCompileFailed) {
+			t.Errorf("%s: got %v, want %v", name, err, ErrCompileFailed)
+		}
+	}
+}
+
+// TestTransformFailures checks that a failing script leaves the message unchanged, and
+// that a script stopped by its timeout can run again.
+func TestTransformFailures(t *testing.T) {
+	for name, source := range map[string]string{
+		"runtime error":  `function transform(msg) msg.a = msg.missing.field end`,
+		"returns string": `function transform(msg) return "x" end`,
+		"timeout":        `function transform(msg) while true do end end`,
+	} {
+		s, err := Compile("test", source, 20*time.Millisecond)
+		if err != nil {
+			t.Fatalf("%s: Compile: %v", name, err)
+		}
+		for run := 0; run < 2; run++ {
+			msg := map[string]interface{}{"a": 1.0}
+			if err := s.Transform(msg); !errors.Is(err, ErrTransformFailed) {
+				t.Errorf("%s: run %d: got %v, want %v", name, run, err, ErrTransformFailed)
+			}
+			if want := map[string]interface{}{"a": 1.0}; !reflect.DeepEqual(msg, want) {
+				t.Errorf("%s: run %d: message changed to %#v", name, run, msg)
+			}
+		}
+	}
+}
@@ -0,0 +1,388 @@
+package message
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+)
+
+// AvroSchema decodes the Avro binary encoding of a schema's datums.
+type AvroSchema struct {
+	root *avroType
+}
+
+// avroType is a node of a parsed Avro schema.
+type avroType struct {
+	kind     string      // Primitive or complex type name
+	logical  string      // Logical type, "" if none
+	scale    int         // Of decimals
+	fields   []avroField // Records
+	symbols  []string    // Enums
+	size     int         // Fixed
+	items    *avroType   // Array items and map values
+	branches []*avroType // Unions
+}
+
+type avroField struct {
+	name string
+	typ  *avroType
+}
+
+// avroPrimitives are the Avro primitive type names.
+var avroPrimitives = map[string]bool{
+	"null": true, "boolean": true, "int": true, "long": true,
+	"float": true, "double": true, "bytes": true, "string": true,
+}
+
+// ParseAvroSchema parses an Avro schema in its JSON form. Named types may be referenced
+// by name or full name once defined, including recursively, or when defined by one of the
+// named schemas, which are parsed first, in order.
+// It returns ErrInvalidAvroSchema (wrapping the cause) for malformed schemas.
+func ParseAvroSchema(schema string, named ...string) (*AvroSchema, error) {
+	p := avroSchemaParser{named: make(map[string]*avroType)}
+	var root *avroType
+	for _, s := range slices.Concat(named, []string{schema}) {
+		var v interface{}
+		if err := json.Unmarshal([]byte(s), &v); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidAvroSchema, err)
+		}
+		var err error
+		if root, err = p.parse(v, "", 0); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidAvroSchema, err)
+		}
+	}
+	return &AvroSchema{root: root}, nil
+}
+
+type avroSchemaParser struct {
+	named map[string]*avroType // By full name
+}
+
+// fullName qualifies name with namespace unless it already is.
+func fullName(name, namespace string) string {
+	if strings.Contains(name, ".") || namespace == "" {
+		return name
+	}
+	return namespace + "." + name
+}
+
+func (p *avroSchemaParser) parse(v interface{}, namespace string, depth int) (*avroType, error) {
+	if depth > maxNestingDepth {
+		return nil, errTooDeep
+	}
+	switch s := v.(type) {
+	case string:
+		if avroPrimitives[s] {
+			return &avroType{kind: s}, nil
+		}
+		if t, ok := p.named[fullName(s, namespace)]; ok {
+			return t, nil
+		}
+		if t, ok := p.named[s]; ok {
+			return t, nil
+		}
+		return nil, fmt.Errorf("unknown type %q", s)
+	case []interface{}:
+		t := &avroType{kind: "union"}
+		for _, branch := range s {
+			b, err := p.parse(branch, namespace, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			t.branches = append(t.branches, b)
+		}
+		return t, nil
+	case map[string]interface{}:
+		return p.parseComplex(s, namespace, depth)
+	default:
+		return nil, fmt.Errorf("unexpected %T in schema", v)
+	}
+}
+
+func (p *avroSchemaParser) parseComplex(s map[string]interface{}, namespace string, depth int) (*avroType, error) {
+	kind, ok := s["type"].(string)
+	if !ok { // A nested schema in place of a type name
+		return p.parse(s["type"], namespace, depth+1)
+	}
+	logical, _ := s["logicalType"].(string)
+	switch kind {
+	case "record", "error", "enum", "fixed":
+		name, _ := s["name"].(string)
+		if name == "" {
+			return nil, fmt.Errorf("%s without a name", kind)
+		}
+		if ns, ok := s["namespace"].(string); ok {
+			namespace = ns
+		}
+		full := fullName(name, namespace)
+		if i := strings.LastIndex(full, "."); i >= 0 {
+			namespace = full[:i]
+		}
+		t := &avroType{kind: kind, logical: logical}
+		p.named[full] = t // Before the fields, which may reference it
+		switch kind {
+		case "enum":
+			symbols, _ := s["symbols"].([]interface{})
+			for _, symbol := range symbols {
+				name, _ := symbol.(string)
+				t.symbols = append(t.symbols, name)
+			}
+		case "fixed":
+			size, _ := s["size"].(float64)
+			t.size = int(size)
+			t.scale = avroScale(s)
+		default:
+			t.kind = "record"
+			fields, _ := s["fields"].([]interface{})
+			for _, field := range fields {
+				f, _ := field.(map[string]interface{})
+				name, _ := f["name"].(string)
+				if name == "" {
+					return nil, fmt.Errorf("field of record %q without a name", full)
+				}
+				typ, err := p.parse(f["type"], namespace, depth+1)
+				if err != nil {
+					return nil, fmt.Errorf("field %q of record %q: %w", name, full, err)
+				}
+				t.fields = append(t.fields, avroField{name: name, typ: typ})
+			}
+		}
+		return t, nil
+	case "array", "map":
+		element := s["items"]
+		if kind == "map" {
+			element = s["values"]
+		}
+		items, err := p.parse(element, namespace, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		return &avroType{kind: kind, items: items}, nil
+	default:
+		t, err := p.parse(kind, namespace, depth+1)
+		if err != nil || logical == "" {
+			return t, err
+		}
+		annotated := *t // Named types are shared, so the annotation goes on a copy
+		annotated.logical, annotated.scale = logical, avroScale(s)
+		return &annotated, nil
+	}
+}
+
+// avroScale returns the scale of a decimal schema, 0 by default.
+func avroScale(s map[string]interface{}) int {
+	scale, _ := s["scale"].(float64)
+	return int(scale)
+}
+
+// Parse decodes a datum of the schema, which must be a record, into a DynamicMessage.
+// Values take the types ParseDynamicJSON produces so features behave the same whatever
+// the encoding: numbers are float64, bytes and fixed are strings, enums their symbol,
+// unions the value of their branch, decimals float64, and timestamps and dates RFC 3339
+// strings.
+// It returns ErrAvroDecodeFailed (wrapping the cause) for malformed input.
+func (s *AvroSchema) Parse(data []byte) (DynamicMessage, error) {
+	d := avroDecoder{data: data}
+	v, err := d.value(s.root, 0)
+	if err == nil && d.pos != len(d.data) {
+		err = fmt.Errorf("unexpected data after value at offset %d", d.pos)
+	}
+	var msg DynamicMessage
+	if err == nil {
+		msg, err = toMessage(v)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrAvroDecodeFailed, err)
+	}
+	return msg, nil
+}
+
+type avroDecoder struct {
+	data []byte
+	pos  int
+}
+
+func (d *avroDecoder) next(n int64) ([]byte, error) {
+	if n < 0 || n > int64(len(d.data)-d.pos) {
+		return nil, errTruncated(d.pos)
+	}
+	b := d.data[d.pos : d.pos+int(n)]
+	d.pos += int(n)
+	return b, nil
+}
+
+// long reads a zigzag-encoded variable-length integer, the encoding of ints and longs.
+func (d *avroDecoder) long() (int64, error) {
+	v, n := binary.Varint(d.data[d.pos:])
+	if n <= 0 {
+		return 0, errTruncated(d.pos)
+	}
+	d.pos += n
+	return v, nil
+}
+
+func (d *avroDecoder) value(t *avroType, depth int) (interface{}, error) {
+	if depth > maxNestingDepth {
+		return nil, errTooDeep
+	}
+	switch t.kind {
+	case "null":
+		return nil, nil
+	case "boolean":
+		b, err := d.next(1)
+		if err != nil {
+			return nil, err
+		}
+		return b[0] != 0, nil
+	case "int", "long":
+		v, err := d.long()
+		if err != nil {
+			return nil, err
+		}
+		return avroLogical(t, v), nil
+	case "float":
+		b, err := d.next(4)
+		if err != nil {
+			return nil, err
+		}
+		return float64(math.Float32frombits(binary.LittleEndian.Uint32(b))), nil
+	case "double":
+		b, err := d.next(8)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(binary.LittleEndian.Uint64(b)), nil
+	case "bytes", "string":
+		n, err := d.long()
+		if err != nil {
+			return nil, err
+		}
+		b, err := d.next(n)
+		if err != nil {
+			return nil, err
+		}
+		if t.logical == "decimal" {
+			return decimal(b, t.scale), nil
+		}
+		return string(b), nil
+	case "fixed":
+		b, err := d.next(int64(t.size))
+		if err != nil {
+			return nil, err
+		}
+		if t.logical == "decimal" {
+			return decimal(b, t.scale), nil
+		}
+		return string(b), nil
+	case "enum":
+		i, err := d.long()
+		if err != nil {
+			return nil, err
+		}
+		if i < 0 || i >= int64(len(t.symbols)) {
+			return nil, fmt.Errorf("enum index %d out of range at offset %d", i, d.pos)
+		}
+		return t.symbols[i], nil
+	case "union":
+		i, err := d.long()
+		if err != nil {
+			return nil, err
+		}
+		if i < 0 || i >= int64(len(t.branches)) {
+			return nil, fmt.Errorf("union branch %d out of range at offset %d", i, d.pos)
+		}
+		return d.value(t.branches[i], depth+1)
+	case "record":
+		m := make(map[string]interface{}, len(t.fields))
+		for _, f := range t.fields {
+			v, err := d.value(f.typ, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			m[f.name] = v
+		}
+		return m, nil
+	case "array":
+		items := []interface{}{}
+		err := d.blocks(func() error {
+			v, err := d.value(t.items, depth+1)
+			items = append(items, v)
+			return err
+		})
+		return items, err
+	case "map":
+		m := make(map[string]interface{})
+		err := d.blocks(func() error {
+			n, err := d.long()
+			if err != nil {
+				return err
+			}
+			k, err := d.next(n)
+			if err != nil {
+				return err
+			}
+			v, err := d.value(t.items, depth+1)
+			m[string(k)] = v
+			return err
+		})
+		return m, err
+	default:
+		return nil, fmt.Errorf("unsupported type %q", t.kind)
+	}
+}
+
+// blocks reads the blocks of an array or map, calling item for each of their items.
+func (d *avroDecoder) blocks(item func() error) error {
+	for {
+		count, err := d.long()
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			return nil
+		}
+		if count < 0 { // Followed by the block's size in bytes
+			count = -count
+			if _, err := d.long(); err != nil {
+				return err
+			}
+		}
+		if count > int64(len(d.data)-d.pos) { // Items take a byte or more, but nulls
+			return fmt.Errorf("block of %d items exceeds the data left at offset %d", count, d.pos)
+		}
+		for range count {
+			if err := item(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// avroLogical interprets an int or long of a logical type.
+func avroLogical(t *avroType, v int64) interface{} {
+	switch t.logical {
+	case "timestamp-millis":
+		return time.UnixMilli(v).UTC().Format(time.RFC3339Nano)
+	case "timestamp-micros":
+		return time.UnixMicro(v).UTC().Format(time.RFC3339Nano)
+	case "date":
+		return time.Unix(v*86400, 0).UTC().Format(time.DateOnly)
+	default:
+		return float64(v)
+	}
+}
+
+// decimal converts the big-endian two's-complement unscaled value of a decimal.
+func decimal(b []byte, scale int) float64 {
+	unscaled := new(big.Int).SetBytes(b)
+	if len(b) > 0 && b[0]&0x80 != 0 {
+		unscaled.Sub(unscaled, new(big.Int).Lsh(big.NewInt(1), uint(len(b)*8)))
+	}
+	f, _ := new(big.Float).SetInt(unscaled).Float64()
+	return f / math.Pow10(scale)
+}
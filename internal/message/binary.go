@@ -0,0 +1,37 @@
+package message
+
+import (
+	"errors"
+	"fmt"
+)
+
+// maxNestingDepth bounds the nesting of arrays and maps in binary payloads, so a
+// malicious message cannot exhaust the stack.
+const maxNestingDepth = 1000
+
+var errTooDeep = errors.New("maximum nesting depth exceeded")
+
+func errTruncated(offset int) error {
+	return fmt.Errorf("truncated input at offset %d", offset)
+}
+
+// mapKey formats a decoded map key as a field name.
+func mapKey(k interface{}) string {
+	if s, ok := k.(string); ok {
+		return s
+	}
+	return fmt.Sprint(k)
+}
+
+// toMessage converts a decoded top-level value to a message. Like JSON, a null payload
+// is an empty message and anything other than a map is an error.
+func toMessage(v interface{}) (DynamicMessage, error) {
+	switch m := v.(type) {
+	case nil:
+		return nil, nil
+	case map[string]interface{}:
+		return DynamicMessage(m), nil
+	default:
+		return nil, fmt.Errorf("%w: got %T", ErrNotAMap, v)
+	}
+}
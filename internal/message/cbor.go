@@ -0,0 +1,255 @@
+package message
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// CBOR major types.
+const (
+	cborUint = iota
+	cborNegInt
+	cborBytes
+	cborText
+	cborArray
+	cborMap
+	cborTag
+	cborSimple
+)
+
+// CBOR tags given special treatment.
+const (
+	cborTagDateTime = 0 // RFC 3339 string
+	cborTagEpoch    = 1 // Seconds since the Unix epoch
+)
+
+// cborIndefinite is the additional information of indefinite-length items and "break".
+const cborIndefinite = 31
+
+// errBreak is returned by value when it reads the "break" stop code.
+var errBreak = errors.New("unexpected break")
+
+// ParseCBOR decodes a CBOR map into a DynamicMessage. Values take the types
+// ParseDynamicJSON produces so features behave the same whatever the encoding: numbers
+// are float64, byte strings are strings, non-string map keys are formatted as strings,
+// undefined is null, and epoch timestamps (tag 1) are RFC 3339 strings. Other tags are
+// ignored in favour of their content.
+// It returns ErrCBORDecodeFailed (wrapping the cause) for malformed input.
+func ParseCBOR(data []byte) (DynamicMessage, error) {
+	d := cborDecoder{data: data}
+	v, err := d.value(0)
+	if err == nil && d.pos != len(d.data) {
+		err = fmt.Errorf("unexpected data after value at offset %d", d.pos)
+	}
+	var msg DynamicMessage
+	if err == nil {
+		msg, err = toMessage(v)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrCBORDecodeFailed, err)
+	}
+	return msg, nil
+}
+
+type cborDecoder struct {
+	data []byte
+	pos  int
+}
+
+func (d *cborDecoder) next(n uint64) ([]byte, error) {
+	if n > uint64(len(d.data)-d.pos) {
+		return nil, errTruncated(d.pos)
+	}
+	b := d.data[d.pos : d.pos+int(n)]
+	d.pos += int(n)
+	return b, nil
+}
+
+// head reads an item's initial byte and argument. For indefinite-length items the
+// argument is meaningless and indefinite is true.
+func (d *cborDecoder) head() (major byte, info byte, arg uint64, err error) {
+	b, err := d.next(1)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	major, info = b[0]>>5, b[0]&0x1f
+	switch {
+	case info < 24:
+		return major, info, uint64(info), nil
+	case info <= 27:
+		size := uint64(1) << (info - 24)
+		b, err := d.next(size)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		switch size {
+		case 1:
+			arg = uint64(b[0])
+		case 2:
+			arg = uint64(binary.BigEndian.Uint16(b))
+		case 4:
+			arg = uint64(binary.BigEndian.Uint32(b))
+		default:
+			arg = binary.BigEndian.Uint64(b)
+		}
+		return major, info, arg, nil
+	case info == cborIndefinite:
+		return major, info, 0, nil
+	default:
+		return 0, 0, 0, fmt.Errorf("reserved additional information %d at offset %d", info, d.pos-1)
+	}
+}
+
+func (d *cborDecoder) value(depth int) (interface{}, error) {
+	if depth > maxNestingDepth {
+		return nil, errTooDeep
+	}
+	start := d.pos
+	major, info, arg, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+	indefinite := info == cborIndefinite
+
+	switch major {
+	case cborUint:
+		if indefinite {
+			break
+		}
+		return float64(arg), nil
+	case cborNegInt:
+		if indefinite {
+			break
+		}
+		return -1 - float64(arg), nil
+	case cborBytes, cborText:
+		if !indefinite {
+			b, err := d.next(arg)
+			return string(b), err
+		}
+		var s []byte
+		for { // Concatenated definite-length chunks of the same major type
+			chunk, err := d.value(depth + 1)
+			if errors.Is(err, errBreak) {
+				return string(s), nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			str, ok := chunk.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid string chunk at offset %d", start)
+			}
+			s = append(s, str...)
+		}
+	case cborArray:
+		return d.arrayOf(arg, indefinite, depth)
+	case cborMap:
+		return d.mapOf(arg, indefinite, depth)
+	case cborTag:
+		if indefinite {
+			break
+		}
+		v, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if arg == cborTagEpoch {
+			if secs, ok := v.(float64); ok {
+				whole, frac := math.Modf(secs)
+				return time.Unix(int64(whole), int64(frac*1e9)).UTC().Format(time.RFC3339Nano), nil
+			}
+		}
+		return v, nil // cborTagDateTime is already a string
+	case cborSimple:
+		return d.simple(info, arg)
+	}
+	return nil, fmt.Errorf("invalid indefinite length at offset %d", start)
+}
+
+func (d *cborDecoder) simple(info byte, arg uint64) (interface{}, error) {
+	switch info {
+	case 20:
+		return false, nil
+	case 21:
+		return true, nil
+	case 22, 23: // null, undefined
+		return nil, nil
+	case 25:
+		return halfToFloat(uint16(arg)), nil
+	case 26:
+		return float64(math.Float32frombits(uint32(arg))), nil
+	case 27:
+		return math.Float64frombits(arg), nil
+	case cborIndefinite:
+		return nil, errBreak
+	default:
+		return nil, nil // Unassigned simple values carry no feature data
+	}
+}
+
+func (d *cborDecoder) arrayOf(n uint64, indefinite bool, depth int) (interface{}, error) {
+	if !indefinite && n > uint64(len(d.data)-d.pos) { // Every element takes at least one byte
+		return nil, errTruncated(d.pos)
+	}
+	arr := make([]interface{}, 0, n)
+	for i := uint64(0); indefinite || i < n; i++ {
+		v, err := d.value(depth + 1)
+		if indefinite && errors.Is(err, errBreak) {
+			return arr, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		arr = append(arr, v)
+	}
+	return arr, nil
+}
+
+func (d *cborDecoder) mapOf(n uint64, indefinite bool, depth int) (interface{}, error) {
+	if !indefinite && n > uint64(len(d.data)-d.pos)/2 { // Every entry takes at least two bytes
+		return nil, errTruncated(d.pos)
+	}
+	m := make(map[string]interface{}, n)
+	for i := uint64(0); indefinite || i < n; i++ {
+		k, err := d.value(depth + 1)
+		if indefinite && errors.Is(err, errBreak) {
+			return m, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		v, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		m[mapKey(k)] = v
+	}
+	return m, nil
+}
+
+// halfToFloat converts an IEEE 754 half-precision float.
+func halfToFloat(h uint16) float64 {
+	exp := int(h>>10) & 0x1f
+	mant := float64(h & 0x3ff)
+	var v float64
+	switch exp {
+	case 0:
+		v = math.Ldexp(mant, -24)
+	case 0x1f:
+		if mant == 0 {
+			v = math.Inf(1)
+		} else {
+			v = math.NaN()
+		}
+	default:
+		v = math.Ldexp(mant+1024, exp-25)
+	}
+	if h&0x8000 != 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,87 @@
+package message
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// timeFormats are the layouts GetTime parses timestamp strings with, in order.
+var timeFormats = []string{
+	time.RFC3339Nano,
+	time.RFC3339,
+	"2006-01-02T15:04:05Z07:00", // RFC3339 without nano part
+	"2006-01-02 15:04:05",       // Common space-separated format
+}
+
+// ParseTime parses a timestamp string with the layouts GetTime accepts, then with the
+// extra layouts in order. Layouts without a zone are read as UTC.
+func ParseTime(s string, extra []string) (time.Time, bool) {
+	for _, format := range timeFormats {
+		if t, err := time.Parse(format, s); err == nil {
+			return t, true
+		}
+	}
+	for _, format := range extra {
+		if t, err := time.Parse(format, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// ParseNumber parses a number written as a string by producers that do not send JSON
+// numbers, e.g. "42.5", " -3 " or "1,234.5". With decimalComma the roles of '.' and ','
+// are swapped, as in "1.234,5"; a space or an apostrophe may group thousands too.
+// Grouping separators must split the integer part into groups of three digits, so a list
+// such as "1,2" is not read as a number. Hexadecimal, NaN and infinite values are rejected.
+func ParseNumber(s string, decimalComma bool) (float64, bool) {
+	s = strings.TrimSpace(s)
+	decimal, group := byte('.'), byte(',')
+	if decimalComma {
+		decimal, group = ',', '.'
+	}
+	var b strings.Builder
+	b.Grow(len(s))
+	i := 0
+	if i < len(s) && (s[i] == '-' || s[i] == '+') {
+		b.WriteByte(s[i])
+		i++
+	}
+	// Integer part, with thousands optionally grouped
+	digits, grouped, sinceGroup := 0, false, 0
+	for ; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c >= '0' && c <= '9':
+			b.WriteByte(c)
+			digits++
+			sinceGroup++
+			continue
+		case c == group || c == ' ' || c == '\'':
+			if digits == 0 || (grouped && sinceGroup != 3) || (!grouped && sinceGroup > 3) {
+				return 0, false
+			}
+			grouped, sinceGroup = true, 0
+			continue
+		}
+		break
+	}
+	if digits == 0 || (grouped && sinceGroup != 3) {
+		return 0, false
+	}
+	// Fraction and exponent, without grouping
+	if i < len(s) && s[i] == decimal {
+		b.WriteByte('.')
+		i++
+	}
+	for ; i < len(s); i++ {
+		c := s[i]
+		if (c < '0' || c > '9') && c != 'e' && c != 'E' && c != '-' && c != '+' {
+			return 0, false
+		}
+		b.WriteByte(c)
+	}
+	f, err := strconv.ParseFloat(b.String(), 64)
+	return f, err == nil
+}
@@ -0,0 +1,91 @@
+package message
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// CSVParser decodes payloads of CSV rows, one message per row. Cells are mapped to
+// field names by position, from the configured columns or from a header row at the
+// start of each payload.
+type CSVParser struct {
+	columns []string
+	comma   rune
+	header  bool
+}
+
+// NewCSVParser creates a CSV parser. With header, the first row of every payload names
+// the columns; it is skipped when columns are configured.
+func NewCSVParser(columns []string, comma rune, header bool) *CSVParser {
+	return &CSVParser{columns: columns, comma: comma, header: header}
+}
+
+// Parse decodes every row of a payload. Cells beyond the known columns are ignored and
+// missing trailing cells are absent from the message; values are typed as by CSVValue.
+// It returns ErrCSVParseFailed (wrapping the cause) with the rows decoded before a
+// malformed one.
+func (p *CSVParser) Parse(data []byte) ([]DynamicMessage, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.Comma = p.comma
+	r.FieldsPerRecord = -1
+	r.ReuseRecord = true
+
+	columns := p.columns
+	if p.header {
+		header, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: header: %w", ErrCSVParseFailed, err)
+		}
+		if len(columns) == 0 {
+			columns = append([]string(nil), header...)
+		}
+	}
+
+	var msgs []DynamicMessage
+	for {
+		record, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			return msgs, nil
+		}
+		if err != nil {
+			return msgs, fmt.Errorf("%w: %w", ErrCSVParseFailed, err)
+		}
+		msg := NewMessage()
+		for i, name := range columns {
+			if i < len(record) {
+				msg[name] = CSVValue(record[i])
+			}
+		}
+		msgs = append(msgs, msg)
+	}
+}
+
+// CSVValue types a CSV cell. Empty and NaN cells are null; cells that parse as numbers
+// or booleans are typed accordingly, everything else is a string.
+func CSVValue(cell string) interface{} {
+	switch trimmed := strings.TrimSpace(cell); {
+	case trimmed == "":
+		return nil
+	case strings.EqualFold(trimmed, "true"):
+		return true
+	case strings.EqualFold(trimmed, "false"):
+		return false
+	default:
+		if f, err := strconv.ParseFloat(trimmed, 64); err == nil {
+			if math.IsNaN(f) {
+				return nil // Pandas and friends write missing values as NaN
+			}
+			return f
+		}
+		return cell
+	}
+}
@@ -4,4 +4,11 @@ import "errors"
 
 var (
 	ErrJSONUnmarshalFailed = errors.New("failed to unmarshal JSON message")
+	ErrCSVParseFailed      = errors.New("failed to parse CSV message")
+	ErrMsgPackDecodeFailed = errors.New("failed to decode MessagePack message")
+	ErrCBORDecodeFailed    = errors.New("failed to decode CBOR message")
+	ErrAvroDecodeFailed    = errors.New("failed to decode Avro message")
+	ErrInvalidAvroSchema   = errors.New("invalid Avro schema")
+	ErrProtoDecodeFailed   = errors.New("failed to decode Protobuf message")
+	ErrNotAMap             = errors.New("message payload is not a map")
 )
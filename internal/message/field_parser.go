@@ -0,0 +1,311 @@
+package message
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/sanspareilsmyn/featurelens/internal/intern"
+)
+
+// FieldParser decodes only selected top-level fields of a JSON object. The values of
+// other fields are skipped without being decoded or allocated, which is much cheaper
+// than ParseDynamicJSON when a payload has hundreds of fields and few are monitored.
+// Keys and selected values are validated like ParseDynamicJSON does; skipped values are
+// only checked for well-formed strings and matching brackets, not fully validated.
+type FieldParser struct {
+	fields   map[string]string // Selected fields, to the copy of their name keying messages
+	interned map[string]bool   // Fields whose plain string values are interned in values
+	values   *intern.Pool
+}
+
+// NewFieldParser creates a parser extracting the given top-level fields. Messages are
+// keyed by the parser's copy of each field name, not by one allocated per message.
+func NewFieldParser(fields []string) *FieldParser {
+	set := make(map[string]string, len(fields))
+	for _, f := range fields {
+		set[f] = f
+	}
+	return &FieldParser{fields: set}
+}
+
+// InternValues interns the string values of the given fields, e.g. categorical features,
+// in pool straight from the payload bytes: values seen before are not allocated again.
+func (p *FieldParser) InternValues(pool *intern.Pool, fields []string) {
+	p.values = pool
+	p.interned = make(map[string]bool, len(fields))
+	for _, f := range fields {
+		p.interned[f] = true
+	}
+}
+
+// Parse extracts the parser's fields from a JSON object. Selected values decode to the
+// same types as with ParseDynamicJSON; absent fields are absent from the message.
+// It returns ErrJSONUnmarshalFailed (wrapping the cause) for malformed input.
+func (p *FieldParser) Parse(data []byte) (DynamicMessage, error) {
+	msg, err := p.parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrJSONUnmarshalFailed, err)
+	}
+	return msg, nil
+}
+
+func (p *FieldParser) parse(data []byte) (DynamicMessage, error) {
+	if bytes.Equal(bytes.TrimSpace(data), []byte("null")) {
+		return nil, nil // Same as unmarshalling null into a map
+	}
+	i := skipSpace(data, 0)
+	if i >= len(data) || data[i] != '{' {
+		return nil, syntaxError("expected '{'", i)
+	}
+	msg := NewMessage()
+
+	i = skipSpace(data, i+1)
+	if i < len(data) && data[i] == '}' {
+		return msg, trailing(data, i+1)
+	}
+	for {
+		if i >= len(data) || data[i] != '"' {
+			return nil, syntaxError("expected object key", i)
+		}
+		keyEnd, escaped, err := scanString(data, i)
+		if err != nil {
+			return nil, err
+		}
+		var key string
+		var wanted bool
+		if escaped || !plainString(data[i+1:keyEnd-1]) {
+			if key, err = unquote(data[i:keyEnd]); err != nil {
+				return nil, err
+			}
+			key, wanted = p.fields[key]
+		} else {
+			key, wanted = p.fields[string(data[i+1:keyEnd-1])] // The conversion does not allocate
+		}
+
+		i = skipSpace(data, keyEnd)
+		if i >= len(data) || data[i] != ':' {
+			return nil, syntaxError("expected ':' after object key", i)
+		}
+		i = skipSpace(data, i+1)
+		valueEnd, err := skipValue(data, i)
+		if err != nil {
+			return nil, err
+		}
+		if wanted {
+			raw := data[i:valueEnd]
+			if p.interned[key] && raw[0] == '"' && plainString(raw[1:len(raw)-1]) {
+				msg[key] = p.values.InternBytes(raw[1 : len(raw)-1])
+			} else {
+				value, err := decodeValue(raw)
+				if err != nil {
+					return nil, err
+				}
+				msg[key] = value
+			}
+		}
+
+		i = skipSpace(data, valueEnd)
+		if i >= len(data) {
+			return nil, syntaxError("unexpected end of input", i)
+		}
+		switch data[i] {
+		case ',':
+			i = skipSpace(data, i+1)
+		case '}':
+			return msg, trailing(data, i+1)
+		default:
+			return nil, syntaxError("expected ',' or '}' after object value", i)
+		}
+	}
+}
+
+// decodeValue decodes a selected value, parsing the common scalar cases directly.
+func decodeValue(raw []byte) (interface{}, error) {
+	switch raw[0] {
+	case 'n':
+		if string(raw) == "null" {
+			return nil, nil
+		}
+	case 't':
+		if string(raw) == "true" {
+			return true, nil
+		}
+	case 'f':
+		if string(raw) == "false" {
+			return false, nil
+		}
+	case '"':
+		if plainString(raw[1 : len(raw)-1]) {
+			return string(raw[1 : len(raw)-1]), nil
+		}
+	case '-', '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
+		if isNumber(raw) {
+			return strconv.ParseFloat(string(raw), 64)
+		}
+	}
+	var v interface{} // Objects, arrays, escaped or invalid strings and anything malformed
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// unquote decodes a JSON string containing escape sequences.
+func unquote(raw []byte) (string, error) {
+	var s string
+	err := json.Unmarshal(raw, &s)
+	return s, err
+}
+
+// skipValue returns the index just past the JSON value starting at i.
+func skipValue(data []byte, i int) (int, error) {
+	if i >= len(data) {
+		return 0, syntaxError("expected value", i)
+	}
+	switch data[i] {
+	case '"':
+		end, _, err := scanString(data, i)
+		return end, err
+	case '{', '[':
+		var buf [16]byte
+		closers := buf[:0] // Expected closing brackets, innermost last
+		for j := i; j < len(data); j++ {
+			switch c := data[j]; c {
+			case '"':
+				end, _, err := scanString(data, j)
+				if err != nil {
+					return 0, err
+				}
+				j = end - 1
+			case '{':
+				closers = append(closers, '}')
+			case '[':
+				closers = append(closers, ']')
+			case '}', ']':
+				if closers[len(closers)-1] != c {
+					return 0, syntaxError("mismatched bracket", j)
+				}
+				closers = closers[:len(closers)-1]
+				if len(closers) == 0 {
+					return j + 1, nil
+				}
+			}
+		}
+		return 0, syntaxError("unterminated object or array", i)
+	default:
+		j := i
+		for j < len(data) && !isDelimiter(data[j]) {
+			j++
+		}
+		if j == i {
+			return 0, syntaxError("expected value", i)
+		}
+		return j, nil
+	}
+}
+
+// scanString returns the index just past the string starting at the quote at i, and
+// whether it contains escape sequences.
+func scanString(data []byte, i int) (int, bool, error) {
+	escaped := false
+	for j := i + 1; j < len(data); j++ {
+		switch data[j] {
+		case '\\':
+			escaped = true
+			j++
+		case '"':
+			return j + 1, escaped, nil
+		}
+	}
+	return 0, false, syntaxError("unterminated string", i)
+}
+
+// plainString reports whether the contents of a JSON string hold no escape sequences,
+// control characters or invalid UTF-8, so they can be used as they are.
+func plainString(contents []byte) bool {
+	for _, c := range contents {
+		if c < 0x20 || c == '\\' {
+			return false
+		}
+	}
+	return utf8.Valid(contents)
+}
+
+// isNumber reports whether raw follows the JSON number grammar, so that
+// strconv.ParseFloat does not accept forms JSON lacks (hex, "Inf", underscores, leading
+// zeros or a leading '+').
+func isNumber(raw []byte) bool {
+	i := 0
+	if i < len(raw) && raw[i] == '-' {
+		i++
+	}
+	switch {
+	case i < len(raw) && raw[i] == '0':
+		i++
+	case i < len(raw) && raw[i] >= '1' && raw[i] <= '9':
+		i = skipDigits(raw, i)
+	default:
+		return false
+	}
+	if i < len(raw) && raw[i] == '.' {
+		i++
+		start := i
+		if i = skipDigits(raw, i); i == start {
+			return false
+		}
+	}
+	if i < len(raw) && (raw[i] == 'e' || raw[i] == 'E') {
+		i++
+		if i < len(raw) && (raw[i] == '+' || raw[i] == '-') {
+			i++
+		}
+		start := i
+		if i = skipDigits(raw, i); i == start {
+			return false
+		}
+	}
+	return i == len(raw)
+}
+
+// skipDigits returns the index of the first non-digit at or after i.
+func skipDigits(raw []byte, i int) int {
+	for i < len(raw) && raw[i] >= '0' && raw[i] <= '9' {
+		i++
+	}
+	return i
+}
+
+func isDelimiter(c byte) bool {
+	switch c {
+	case ',', '}', ']', ' ', '\t', '\n', '\r':
+		return true
+	}
+	return false
+}
+
+func skipSpace(data []byte, i int) int {
+	for i < len(data) {
+		switch data[i] {
+		case ' ', '\t', '\n', '\r':
+			i++
+		default:
+			return i
+		}
+	}
+	return i
+}
+
+// trailing checks that only whitespace follows the object.
+func trailing(data []byte, i int) error {
+	if i = skipSpace(data, i); i < len(data) {
+		return syntaxError("unexpected data after object", i)
+	}
+	return nil
+}
+
+func syntaxError(msg string, offset int) error {
+	return fmt.Errorf("%s at offset %d", msg, offset)
+}
@@ -0,0 +1,220 @@
+package message
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"unsafe"
+
+	"github.com/sanspareilsmyn/featurelens/internal/intern"
+)
+
+// TestFieldParserMatchesParseDynamicJSON checks that FieldParser accepts and rejects
+// the same inputs as ParseDynamicJSON and decodes the selected fields to the same values.
+func TestFieldParserMatchesParseDynamicJSON(t *testing.T) {
+	fields := []string{"a", "b", "é", "😀", "\uFFFD"}
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"empty object", `{}`},
+		{"null", `null`},
+		{"whitespace", " \t\n{ \"a\" : 1 ,\r\n \"b\":\"x\" } \n"},
+		{"scalars", `{"a":-1.5e3,"b":true,"c":false,"d":null}`},
+		{"absent fields", `{"c":1,"d":"x"}`},
+		{"duplicate key keeps last", `{"a":1,"a":2}`},
+		{"zero", `{"a":0,"b":-0.0}`},
+		{"exponents", `{"a":1E+2,"b":2e-2}`},
+
+		{"simple escapes", `{"a":"line\nbreak \"quoted\" back\\slash \/ \t"}`},
+		{"unicode escape", `{"a":"caf\u00e9"}`},
+		{"surrogate pair", `{"a":"\ud83d\ude00"}`},
+		{"lone surrogate", `{"a":"\ud83d"}`},
+		{"reversed surrogates", `{"a":"\ude00\ud83d"}`},
+		{"escaped key", `{"\u0061":1,"\u00e9":2}`},
+		{"escaped surrogate key", `{"\ud83d\ude00":3}`},
+		{"invalid escape", `{"a":"\x41"}`},
+		{"short unicode escape", `{"a":"\u12"}`},
+
+		{"nested object selected", `{"a":{"x":[1,{"y":"}"}],"z":null},"b":1}`},
+		{"nested array selected", `{"a":[[1,2],[],["]",{}]]}`},
+		{"nested skipped", `{"c":{"x":[1,{"y":"]}"}]},"a":1}`},
+		{"deep nesting skipped", `{"c":` + strings.Repeat("[", 40) + strings.Repeat("]", 40) + `,"a":2}`},
+		{"mismatched brackets selected", `{"a":[1}`},
+		{"mismatched brackets skipped", `{"c":[1},"a":1}`},
+
+		{"truncated object", `{"a":1`},
+		{"truncated key", `{"a`},
+		{"truncated value", `{"a":`},
+		{"truncated string", `{"a":"abc`},
+		{"truncated nested", `{"c":{"x":[1,2`},
+		{"trailing escape", `{"a":"abc\`},
+		{"empty input", ``},
+		{"not an object", `[1,2]`},
+		{"string document", `"a"`},
+		{"trailing data", `{"a":1} x`},
+		{"two objects", `{"a":1}{"b":2}`},
+		{"missing colon", `{"a" 1}`},
+		{"missing comma", `{"a":1 "b":2}`},
+		{"trailing comma", `{"a":1,}`},
+		{"unquoted key", `{a:1}`},
+		{"bad literal selected", `{"a":tru}`},
+		{"bad literal null", `{"a":nul}`},
+
+		{"leading zero", `{"a":01}`},
+		{"leading zeros fraction", `{"a":00.5}`},
+		{"negative leading zero", `{"a":-01}`},
+		{"leading plus", `{"a":+1}`},
+		{"bare minus", `{"a":-}`},
+		{"missing fraction digits", `{"a":1.}`},
+		{"missing integer digits", `{"a":.5}`},
+		{"missing exponent digits", `{"a":1e}`},
+		{"hex", `{"a":0x10}`},
+		{"infinity", `{"a":Infinity}`},
+		{"out of range", `{"a":1e400}`},
+
+		{"invalid utf-8 value", "{\"a\":\"ab\xffcd\"}"},
+		{"invalid utf-8 key", "{\"\xff\":1}"},
+		{"truncated utf-8 value", "{\"b\":\"\xe2\x82\"}"},
+		{"utf-8 key and value", `{"é":"naïve","😀":"ok"}`},
+		{"control character in value", "{\"a\":\"tab\there\"}"},
+		{"control character in key", "{\"a\x01\":1}"},
+	}
+	parser := NewFieldParser(fields)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want, wantErr := ParseDynamicJSON([]byte(tt.input))
+			got, err := parser.Parse([]byte(tt.input))
+			if (err != nil) != (wantErr != nil) {
+				t.Fatalf("Parse(%q) error = %v, ParseDynamicJSON error = %v", tt.input, err, wantErr)
+			}
+			if err != nil {
+				if !errors.Is(err, ErrJSONUnmarshalFailed) {
+					t.Errorf("Parse(%q) error = %v, want it to wrap ErrJSONUnmarshalFailed", tt.input, err)
+				}
+				return
+			}
+			if want != nil {
+				want = selectFields(want, fields)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Parse(%q) = %#v, want %#v", tt.input, got, want)
+			}
+		})
+	}
+}
+
+// TestFieldParserSkippedValues documents the leniency of skipped values: only their
+// strings and brackets are checked.
+func TestFieldParserSkippedValues(t *testing.T) {
+	parser := NewFieldParser([]string{"a"})
+	got, err := parser.Parse([]byte(`{"c":tru,"d":01,"a":1}`))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if want := (DynamicMessage{"a": 1.0}); !reflect.DeepEqual(got, want) {
+		t.Errorf("Parse() = %#v, want %#v", got, want)
+	}
+}
+
+func selectFields(msg DynamicMessage, fields []string) DynamicMessage {
+	selected := make(DynamicMessage)
+	for _, f := range fields {
+		if v, ok := msg[f]; ok {
+			selected[f] = v
+		}
+	}
+	return selected
+}
+
+// benchmarkPayload is a message with 200 fields, of which the benchmark selects 5.
+func benchmarkPayload() ([]byte, []string) {
+	var b strings.Builder
+	b.WriteString("{")
+	for i := range 200 {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		switch i % 4 {
+		case 0:
+			fmt.Fprintf(&b, `"num_%d":%d.5`, i, i)
+		case 1:
+			fmt.Fprintf(&b, `"str_%d":"value_%d"`, i, i)
+		case 2:
+			fmt.Fprintf(&b, `"arr_%d":[%d,%d,{"k":"v"}]`, i, i, i+1)
+		default:
+			fmt.Fprintf(&b, `"obj_%d":{"nested":{"x":%d,"y":"z"}}`, i, i)
+		}
+	}
+	b.WriteString("}")
+	return []byte(b.String()), []string{"num_0", "str_1", "num_40", "str_101", "arr_2"}
+}
+
+// BenchmarkParse compares decoding a wide message in full with extracting a few fields.
+func BenchmarkParse(b *testing.B) {
+	payload, fields := benchmarkPayload()
+
+	b.Run("ParseDynamicJSON", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(payload)))
+		for i := 0; i < b.N; i++ {
+			if _, err := ParseDynamicJSON(payload); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("ParseDynamicJSON/pooled", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(payload)))
+		for i := 0; i < b.N; i++ {
+			msg, err := ParseDynamicJSON(payload)
+			if err != nil {
+				b.Fatal(err)
+			}
+			Release(msg)
+		}
+	})
+	b.Run("FieldParser", func(b *testing.B) {
+		parser := NewFieldParser(fields)
+		b.ReportAllocs()
+		b.SetBytes(int64(len(payload)))
+		for i := 0; i < b.N; i++ {
+			if _, err := parser.Parse(payload); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// TestFieldParserInternValues checks that interned fields decode to the same values,
+// sharing one copy across messages, and that other fields are left alone.
+func TestFieldParserInternValues(t *testing.T) {
+	parser := NewFieldParser([]string{"country", "name"})
+	parser.InternValues(intern.New(10), []string{"country"})
+	var countries []string
+	for _, input := range []string{`{"country":"KR","name":"a"}`, `{"name":"b","country":"KR"}`} {
+		got, err := parser.Parse([]byte(input))
+		if err != nil {
+			t.Fatalf("Parse(%q) error = %v", input, err)
+		}
+		want, _ := ParseDynamicJSON([]byte(input))
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Parse(%q) = %#v, want %#v", input, got, want)
+		}
+		countries = append(countries, got["country"].(string))
+	}
+	if unsafe.StringData(countries[0]) != unsafe.StringData(countries[1]) {
+		t.Error("interned values of two messages do not share their bytes")
+	}
+
+	// Escaped strings and other types decode as without interning
+	got, err := parser.Parse([]byte(`{"country":"\u004bR"}`))
+	if err != nil || got["country"] != "KR" {
+		t.Errorf("escaped value: got %#v, %v, want KR", got, err)
+	}
+	if got, err := parser.Parse([]byte(`{"country":82}`)); err != nil || got["country"] != 82.0 {
+		t.Errorf("number value: got %#v, %v, want 82", got, err)
+	}
+}
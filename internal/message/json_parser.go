@@ -5,13 +5,15 @@ import (
 	"fmt"
 )
 
-// ParseDynamicJSON parses JSON data from a byte slice into a DynamicMessage map.
-// It returns ErrJSONUnmarshalFailed (wrapping the original error) if unmarshalling fails.
+// ParseDynamicJSON parses JSON data from a byte slice into a DynamicMessage map, taken
+// from the message pool. It returns ErrJSONUnmarshalFailed (wrapping the original error)
+// if unmarshalling fails.
 func ParseDynamicJSON(data []byte) (DynamicMessage, error) {
-	var msg DynamicMessage
+	msg := NewMessage()
 
 	err := json.Unmarshal(data, &msg)
 	if err != nil {
+		Release(msg)
 		return nil, fmt.Errorf("%w: %w", ErrJSONUnmarshalFailed, err)
 	}
 	return msg, nil
@@ -0,0 +1,29 @@
+package message
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// ParseLines decodes a payload of newline-delimited records (e.g. JSON lines), one
+// message per non-blank line. Lines that fail to decode are skipped; their errors are
+// returned joined, alongside the messages that did decode.
+func ParseLines(data []byte, parse func([]byte) (DynamicMessage, error)) ([]DynamicMessage, error) {
+	var msgs []DynamicMessage
+	var errs []error
+	for line := 1; len(data) > 0; line++ {
+		var record []byte
+		record, data, _ = bytes.Cut(data, []byte{'\n'})
+		if len(bytes.TrimSpace(record)) == 0 {
+			continue
+		}
+		msg, err := parse(record)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("line %d: %w", line, err))
+			continue
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs, errors.Join(errs...)
+}
@@ -0,0 +1,227 @@
+package message
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"time"
+)
+
+// msgpackTimestampExt is the MessagePack extension type of timestamps.
+const msgpackTimestampExt = -1
+
+// ParseMsgPack decodes a MessagePack map into a DynamicMessage. Values take the types
+// ParseDynamicJSON produces so features behave the same whatever the encoding: numbers
+// are float64, binary data is a string, non-string map keys are formatted as strings,
+// and timestamps are RFC 3339 strings. Other extension types are null.
+// It returns ErrMsgPackDecodeFailed (wrapping the cause) for malformed input.
+func ParseMsgPack(data []byte) (DynamicMessage, error) {
+	d := msgpackDecoder{data: data}
+	v, err := d.value(0)
+	if err == nil && d.pos != len(d.data) {
+		err = fmt.Errorf("unexpected data after value at offset %d", d.pos)
+	}
+	var msg DynamicMessage
+	if err == nil {
+		msg, err = toMessage(v)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrMsgPackDecodeFailed, err)
+	}
+	return msg, nil
+}
+
+type msgpackDecoder struct {
+	data []byte
+	pos  int
+}
+
+// next consumes n bytes.
+func (d *msgpackDecoder) next(n int) ([]byte, error) {
+	if n < 0 || n > len(d.data)-d.pos {
+		return nil, errTruncated(d.pos)
+	}
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+// uint reads a big-endian unsigned integer of size bytes.
+func (d *msgpackDecoder) uint(size int) (uint64, error) {
+	b, err := d.next(size)
+	if err != nil {
+		return 0, err
+	}
+	switch size {
+	case 1:
+		return uint64(b[0]), nil
+	case 2:
+		return uint64(binary.BigEndian.Uint16(b)), nil
+	case 4:
+		return uint64(binary.BigEndian.Uint32(b)), nil
+	default:
+		return binary.BigEndian.Uint64(b), nil
+	}
+}
+
+// length reads a length of size bytes.
+func (d *msgpackDecoder) length(size int) (int, error) {
+	n, err := d.uint(size)
+	if err != nil {
+		return 0, err
+	}
+	if n > uint64(len(d.data)) {
+		return 0, errTruncated(d.pos)
+	}
+	return int(n), nil
+}
+
+func (d *msgpackDecoder) value(depth int) (interface{}, error) {
+	if depth > maxNestingDepth {
+		return nil, errTooDeep
+	}
+	b, err := d.next(1)
+	if err != nil {
+		return nil, err
+	}
+	switch c := b[0]; {
+	case c <= 0x7f: // positive fixint
+		return float64(c), nil
+	case c >= 0xe0: // negative fixint
+		return float64(int8(c)), nil
+	case c >= 0x80 && c <= 0x8f:
+		return d.mapOf(int(c&0x0f), depth)
+	case c >= 0x90 && c <= 0x9f:
+		return d.arrayOf(int(c&0x0f), depth)
+	case c >= 0xa0 && c <= 0xbf:
+		return d.str(int(c & 0x1f))
+	}
+
+	switch c := b[0]; c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6: // bin 8/16/32
+		n, err := d.length(1 << (c - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+		return d.str(n)
+	case 0xc7, 0xc8, 0xc9: // ext 8/16/32
+		n, err := d.length(1 << (c - 0xc7))
+		if err != nil {
+			return nil, err
+		}
+		return d.ext(n)
+	case 0xca:
+		bits, err := d.uint(4)
+		return float64(math.Float32frombits(uint32(bits))), err
+	case 0xcb:
+		bits, err := d.uint(8)
+		return math.Float64frombits(bits), err
+	case 0xcc, 0xcd, 0xce, 0xcf: // uint 8/16/32/64
+		n, err := d.uint(1 << (c - 0xcc))
+		return float64(n), err
+	case 0xd0, 0xd1, 0xd2, 0xd3: // int 8/16/32/64
+		size := 1 << (c - 0xd0)
+		n, err := d.uint(size)
+		shift := 64 - 8*size
+		return float64(int64(n<<shift) >> shift), err // Sign-extend
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8: // fixext 1/2/4/8/16
+		return d.ext(1 << (c - 0xd4))
+	case 0xd9, 0xda, 0xdb: // str 8/16/32
+		n, err := d.length(1 << (c - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return d.str(n)
+	case 0xdc, 0xdd: // array 16/32
+		n, err := d.length(2 << (c - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return d.arrayOf(n, depth)
+	case 0xde, 0xdf: // map 16/32
+		n, err := d.length(2 << (c - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return d.mapOf(n, depth)
+	default:
+		return nil, fmt.Errorf("invalid type byte 0x%02x at offset %d", c, d.pos-1)
+	}
+}
+
+func (d *msgpackDecoder) str(n int) (interface{}, error) {
+	b, err := d.next(n)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func (d *msgpackDecoder) arrayOf(n int, depth int) (interface{}, error) {
+	if n > len(d.data)-d.pos { // Every element takes at least one byte
+		return nil, errTruncated(d.pos)
+	}
+	arr := make([]interface{}, n)
+	for i := range arr {
+		v, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		arr[i] = v
+	}
+	return arr, nil
+}
+
+func (d *msgpackDecoder) mapOf(n int, depth int) (interface{}, error) {
+	if n > (len(d.data)-d.pos)/2 { // Every entry takes at least two bytes
+		return nil, errTruncated(d.pos)
+	}
+	m := make(map[string]interface{}, n)
+	for i := 0; i < n; i++ {
+		k, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		v, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		m[mapKey(k)] = v
+	}
+	return m, nil
+}
+
+// ext decodes an extension value of n data bytes: timestamps become RFC 3339 strings,
+// other types are null.
+func (d *msgpackDecoder) ext(n int) (interface{}, error) {
+	typ, err := d.next(1)
+	if err != nil {
+		return nil, err
+	}
+	b, err := d.next(n)
+	if err != nil {
+		return nil, err
+	}
+	if int8(typ[0]) != msgpackTimestampExt {
+		return nil, nil
+	}
+	var t time.Time
+	switch n {
+	case 4:
+		t = time.Unix(int64(binary.BigEndian.Uint32(b)), 0)
+	case 8:
+		v := binary.BigEndian.Uint64(b)
+		t = time.Unix(int64(v&(1<<34-1)), int64(v>>34))
+	case 12:
+		t = time.Unix(int64(binary.BigEndian.Uint64(b[4:])), int64(binary.BigEndian.Uint32(b)))
+	default:
+		return nil, fmt.Errorf("invalid timestamp length %d at offset %d", n, d.pos-n)
+	}
+	return t.UTC().Format(time.RFC3339Nano), nil
+}
@@ -0,0 +1,63 @@
+package message
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Messages and payload buffers are recycled once the pipeline is done with them, so a
+// steady stream allocates few new maps and buffers. Recycling is optional: a message or
+// buffer that is never released is simply collected.
+const (
+	maxPooledFields = 1024     // Larger messages are not pooled, so one outlier does not pin its map
+	maxPooledBuffer = 64 << 10 // Larger buffers are not pooled
+)
+
+var (
+	messagePool sync.Pool // Of cleared DynamicMessage
+	bufferPool  sync.Pool // Of *[]byte
+
+	// fieldsHint is the number of fields of the last message released, which new messages
+	// are allocated with room for, as messages of a stream mostly share their schema.
+	fieldsHint atomic.Int64
+)
+
+// NewMessage returns an empty message, recycled or allocated with room for as many fields
+// as recently released messages had.
+func NewMessage() DynamicMessage {
+	if msg, ok := messagePool.Get().(DynamicMessage); ok {
+		return msg
+	}
+	return make(DynamicMessage, fieldsHint.Load())
+}
+
+// Release clears msg and returns it to the pool. msg must not be used afterwards; its
+// values, including nested maps and arrays, are not recycled and may be kept.
+func Release(msg DynamicMessage) {
+	n := len(msg)
+	if msg == nil || n > maxPooledFields {
+		return
+	}
+	fieldsHint.Store(int64(n))
+	clear(msg)
+	messagePool.Put(msg)
+}
+
+// NewBuffer returns an empty buffer for a payload, to be returned with ReleaseBuffer once
+// the payload is decoded.
+func NewBuffer() *[]byte {
+	if buf, ok := bufferPool.Get().(*[]byte); ok {
+		return buf
+	}
+	return new([]byte)
+}
+
+// ReleaseBuffer empties buf and returns it to the pool. Decoded messages do not reference
+// their payload, so it may be released as soon as it is decoded.
+func ReleaseBuffer(buf *[]byte) {
+	if cap(*buf) > maxPooledBuffer {
+		return
+	}
+	*buf = (*buf)[:0]
+	bufferPool.Put(buf)
+}
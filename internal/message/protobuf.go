@@ -0,0 +1,110 @@
+package message
+
+import (
+	"fmt"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// timestampMessage is the full name of the well-known Timestamp message.
+const timestampMessage = "google.protobuf.Timestamp"
+
+// ParseProtobuf decodes a binary Protobuf message of the given type into a
+// DynamicMessage keyed by field name. Values take the types ParseDynamicJSON produces so
+// features behave the same whatever the encoding: numbers are float64, bytes are strings,
+// enums their value's name, map keys strings and Timestamps RFC 3339 strings. Fields
+// without explicit presence read as their default when unset, like in proto3; unset
+// fields with presence (optional, oneof and message fields) are missing.
+// It returns ErrProtoDecodeFailed (wrapping the cause) for malformed input.
+func ParseProtobuf(desc protoreflect.MessageDescriptor, data []byte) (DynamicMessage, error) {
+	msg := dynamicpb.NewMessage(desc)
+	if err := proto.Unmarshal(data, msg); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrProtoDecodeFailed, err)
+	}
+	return protoMessage(msg, 0)
+}
+
+func protoMessage(msg protoreflect.Message, depth int) (DynamicMessage, error) {
+	if depth > maxNestingDepth {
+		return nil, fmt.Errorf("%w: %w", ErrProtoDecodeFailed, errTooDeep)
+	}
+	fields := msg.Descriptor().Fields()
+	m := make(DynamicMessage, fields.Len())
+	for i := range fields.Len() {
+		fd := fields.Get(i)
+		if fd.HasPresence() && !msg.Has(fd) {
+			continue
+		}
+		v, err := protoValue(fd, msg.Get(fd), depth+1)
+		if err != nil {
+			return nil, err
+		}
+		m[string(fd.Name())] = v
+	}
+	return m, nil
+}
+
+// protoValue converts the value of a field.
+func protoValue(fd protoreflect.FieldDescriptor, v protoreflect.Value, depth int) (interface{}, error) {
+	switch {
+	case fd.IsList():
+		list := v.List()
+		items := make([]interface{}, list.Len())
+		for i := range list.Len() {
+			item, err := protoScalar(fd, list.Get(i), depth)
+			if err != nil {
+				return nil, err
+			}
+			items[i] = item
+		}
+		return items, nil
+	case fd.IsMap():
+		m := make(map[string]interface{}, v.Map().Len())
+		var err error
+		v.Map().Range(func(k protoreflect.MapKey, v protoreflect.Value) bool {
+			m[k.String()], err = protoScalar(fd.MapValue(), v, depth)
+			return err == nil
+		})
+		return m, err
+	default:
+		return protoScalar(fd, v, depth)
+	}
+}
+
+// protoScalar converts a single value of a field, or of a list or map field's elements.
+func protoScalar(fd protoreflect.FieldDescriptor, v protoreflect.Value, depth int) (interface{}, error) {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		return v.Bool(), nil
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return float64(v.Int()), nil
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind, protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return float64(v.Uint()), nil
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		return v.Float(), nil
+	case protoreflect.StringKind:
+		return v.String(), nil
+	case protoreflect.BytesKind:
+		return string(v.Bytes()), nil
+	case protoreflect.EnumKind:
+		if value := fd.Enum().Values().ByNumber(v.Enum()); value != nil {
+			return string(value.Name()), nil
+		}
+		return float64(v.Enum()), nil
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		msg := v.Message()
+		if msg.Descriptor().FullName() == timestampMessage {
+			fields := msg.Descriptor().Fields()
+			seconds, nanos := msg.Get(fields.ByName("seconds")).Int(), msg.Get(fields.ByName("nanos")).Int()
+			return time.Unix(seconds, nanos).UTC().Format(time.RFC3339Nano), nil
+		}
+		m, err := protoMessage(msg, depth)
+		return map[string]interface{}(m), err
+	default:
+		return nil, nil
+	}
+}
@@ -2,9 +2,19 @@ package message
 
 import (
 	"fmt"
+	"math"
 	"time"
 )
 
+// TopicKey is the reserved field under which the pipeline records the Kafka topic a
+// message was consumed from, when features are bound to topics.
+const TopicKey = "__topic"
+
+// PartitionKey is the reserved field under which the pipeline records the Kafka topic and
+// partition a message was consumed from, as "topic:partition", when partition statistics
+// are enabled.
+const PartitionKey = "__partition"
+
 // DynamicMessage represents a message with arbitrary key-value pairs,
 // typically parsed from JSON.
 type DynamicMessage map[string]interface{}
@@ -18,26 +28,73 @@ func (dm DynamicMessage) GetFloat64(key string) (*float64, bool) {
 		return nil, false
 	}
 
+	if fVal, ok := asFloat64(val); ok {
+		return &fVal, true
+	}
+
+	// Value exists but is not a convertible numeric type
+	return nil, false
+}
+
+// asFloat64 converts a numeric value to float64.
+func asFloat64(val interface{}) (float64, bool) {
 	// Try direct assertion first (most common case with JSON numbers)
 	if fVal, ok := val.(float64); ok {
-		return &fVal, true
+		return fVal, true
 	}
 
 	// Handle potential integer types if the map wasn't strictly from JSON unmarshal
 	switch v := val.(type) {
 	case int:
-		fVal := float64(v)
-		return &fVal, true
+		return float64(v), true
 	case int64:
-		fVal := float64(v)
-		return &fVal, true
+		return float64(v), true
 	case float32:
-		fVal := float64(v)
-		return &fVal, true
+		return float64(v), true
 	}
+	return 0, false
+}
 
-	// Value exists but is not a convertible numeric type
-	return nil, false
+// AppendFloat64s appends the elements of an array value to dst and returns the extended
+// slice. JSON cannot encode NaN or infinities, so null elements and the strings "NaN",
+// "Infinity" and "-Infinity" that encoders emit instead are appended as NaN and ±Inf.
+// Returns (dst, false) if the key does not hold an array of numbers.
+func (dm DynamicMessage) AppendFloat64s(dst []float64, key string) ([]float64, bool) {
+	arr, ok := dm[key].([]interface{})
+	if !ok {
+		return dst, false
+	}
+	n := len(dst)
+	for _, elem := range arr {
+		if f, ok := asFloat64(elem); ok {
+			dst = append(dst, f)
+			continue
+		}
+		switch elem {
+		case nil, "NaN":
+			dst = append(dst, math.NaN())
+		case "Infinity":
+			dst = append(dst, math.Inf(1))
+		case "-Infinity":
+			dst = append(dst, math.Inf(-1))
+		default:
+			return dst[:n], false
+		}
+	}
+	return dst, true
+}
+
+// GetString retrieves a string value for a given key.
+// Returns the value and true if the key holds a string, otherwise ("", false).
+func (dm DynamicMessage) GetString(key string) (string, bool) {
+	strVal, ok := dm[key].(string)
+	return strVal, ok
+}
+
+// Has checks if a key exists, whether or not its value is null.
+func (dm DynamicMessage) Has(key string) bool {
+	_, exists := dm[key]
+	return exists
 }
 
 // HasNonNull checks if a key exists and its value is not explicitly null.
@@ -46,8 +103,33 @@ func (dm DynamicMessage) HasNonNull(key string) bool {
 	return exists && val != nil
 }
 
+// JSONType returns the JSON type of a key's value: "null", "bool", "number", "string",
+// "array" or "object", or "" if the key is missing or holds another Go type.
+func (dm DynamicMessage) JSONType(key string) string {
+	val, exists := dm[key]
+	if !exists {
+		return ""
+	}
+	switch val.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "bool"
+	case float64, float32, int, int64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}, DynamicMessage:
+		return "object"
+	default:
+		return ""
+	}
+}
+
 // GetTime attempts to retrieve a time.Time value for a given key.
-// Assumes the timestamp is stored as a string parsable by common formats.
+// Assumes the timestamp is stored as a string parsable by common formats; see ParseTime.
 // Returns the time pointer and true if successful, otherwise (nil, false).
 func (dm DynamicMessage) GetTime(key string) (*time.Time, bool) {
 	val, exists := dm[key]
@@ -60,23 +142,9 @@ func (dm DynamicMessage) GetTime(key string) (*time.Time, bool) {
 		// Value exists but is not a string
 		return nil, false
 	}
-
-	// Define common timestamp formats to try
-	formats := []string{
-		time.RFC3339Nano,
-		time.RFC3339,
-		"2006-01-02T15:04:05Z07:00", // RFC3339 without nano part
-		"2006-01-02 15:04:05",       // Common space-separated format
+	if t, ok := ParseTime(timeStr, nil); ok {
+		return &t, true
 	}
-
-	// Attempt parsing with each defined format
-	for _, format := range formats {
-		if t, err := time.Parse(format, timeStr); err == nil {
-			return &t, true
-		}
-	}
-
-	// None of the defined formats matched
 	return nil, false
 }
 
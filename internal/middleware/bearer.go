@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// newBearerToken accepts requests carrying one of a set of static bearer tokens.
+//
+// Params: tokensFile (one token per line, optionally followed by the role it grants,
+// e.g. "s3cr3t read-only"; blank lines and lines starting with # are ignored), role
+// (granted to tokens without one, default operator).
+func newBearerToken(params Params, logger *zap.Logger) (Middleware, error) {
+	path, err := params.String("tokensFile", "")
+	if err != nil {
+		return nil, err
+	}
+	if path == "" {
+		return nil, fmt.Errorf("%w: tokensFile cannot be empty", ErrInvalidParams)
+	}
+	role, err := roleParam(params, RoleOperator)
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := readTokens(path, role)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, ok := bearerToken(r)
+			if ok {
+				digest := sha256.Sum256([]byte(token))
+				for _, known := range tokens {
+					if subtle.ConstantTimeCompare(digest[:], known.digest[:]) == 1 {
+						next.ServeHTTP(w, r.WithContext(withPrincipal(r.Context(), Principal{Role: known.role})))
+						return
+					}
+				}
+			}
+			logger.Warn("Rejected request with missing or unknown bearer token", zap.String("path", r.URL.Path))
+			unauthorized(w, "Bearer")
+		})
+	}, nil
+}
+
+// knownToken is a token of a tokens file, as a SHA-256 digest so comparisons take
+// constant time.
+type knownToken struct {
+	digest [sha256.Size]byte
+	role   Role
+}
+
+// readTokens loads the tokens of a tokens file, granting role to those without one.
+func readTokens(path string, role Role) ([]knownToken, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidParams, err)
+	}
+	defer f.Close()
+
+	var tokens []knownToken
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) > 2 {
+			return nil, fmt.Errorf("%w: %s:%d: expected a token and an optional role", ErrInvalidParams, path, line)
+		}
+		t := knownToken{digest: sha256.Sum256([]byte(fields[0])), role: role}
+		if len(fields) == 2 {
+			if t.role, err = parseRole(fields[1], role); err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+			}
+		}
+		tokens = append(tokens, t)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidParams, err)
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("%w: %s contains no tokens", ErrInvalidParams, path)
+	}
+	return tokens, nil
+}
+
+// bearerToken extracts the token from an "Authorization: Bearer <token>" header.
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", false
+	}
+	return strings.TrimSpace(token), true
+}
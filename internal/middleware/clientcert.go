@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"crypto/x509"
+	"net/http"
+	"slices"
+
+	"go.uber.org/zap"
+)
+
+// newClientCert accepts requests presenting a client certificate verified against the
+// CAs of http.tls.clientCAFile (mTLS). The certificate's identities are its subject
+// common name and its DNS, email and URI subject alternative names.
+//
+// Params: identities (accepted identities; empty accepts every verified certificate),
+// role (granted, default operator), operators and readOnly (identities granted operator
+// and read-only instead; operator wins for certificates in both).
+func newClientCert(params Params, logger *zap.Logger) (Middleware, error) {
+	identities, err := params.Strings("identities")
+	if err != nil {
+		return nil, err
+	}
+	role, err := roleParam(params, RoleOperator)
+	if err != nil {
+		return nil, err
+	}
+	operators, err := params.Strings("operators")
+	if err != nil {
+		return nil, err
+	}
+	readOnly, err := params.Strings("readOnly")
+	if err != nil {
+		return nil, err
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+				logger.Warn("Rejected request without a verified client certificate", zap.String("path", r.URL.Path))
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+			cert := r.TLS.VerifiedChains[0][0]
+			ids := certIdentities(cert)
+			if len(identities) > 0 && !slices.ContainsFunc(ids, func(id string) bool { return slices.Contains(identities, id) }) {
+				logger.Warn("Rejected request with an unknown client certificate",
+					zap.String("path", r.URL.Path),
+					zap.Strings("identities", ids),
+				)
+				http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+				return
+			}
+			granted := role
+			switch {
+			case slices.ContainsFunc(ids, func(id string) bool { return slices.Contains(operators, id) }):
+				granted = RoleOperator
+			case slices.ContainsFunc(ids, func(id string) bool { return slices.Contains(readOnly, id) }):
+				granted = RoleReadOnly
+			}
+			next.ServeHTTP(w, r.WithContext(withPrincipal(r.Context(), Principal{Name: cert.Subject.CommonName, Role: granted})))
+		})
+	}, nil
+}
+
+// certIdentities returns the identities of a client certificate.
+func certIdentities(cert *x509.Certificate) []string {
+	var ids []string
+	if cert.Subject.CommonName != "" {
+		ids = append(ids, cert.Subject.CommonName)
+	}
+	ids = append(ids, cert.DNSNames...)
+	ids = append(ids, cert.EmailAddresses...)
+	for _, u := range cert.URIs {
+		ids = append(ids, u.String())
+	}
+	return ids
+}
@@ -0,0 +1,13 @@
+package middleware
+
+import "errors"
+
+var (
+	ErrUnknownType       = errors.New("unknown middleware type")
+	ErrInvalidParams     = errors.New("invalid middleware parameters")
+	ErrInvalidToken      = errors.New("invalid token")
+	ErrTokenExpired      = errors.New("token expired")
+	ErrUnknownSigningKey = errors.New("unknown token signing key")
+	ErrJWKSFetchFailed   = errors.New("failed to fetch JWKS")
+	ErrInvalidTLS        = errors.New("invalid HTTP TLS configuration")
+)
@@ -0,0 +1,110 @@
+package middleware
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// newIPAllowlist rejects requests whose client address is outside the configured CIDRs.
+//
+// Params: cidrs (list of CIDRs or addresses), trustForwardedFor (take the client address
+// from X-Forwarded-For; only enable behind trusted proxies, which must append to it) and
+// trustedHops (the number of trusted proxies in front of FeatureLens, default 1). The
+// client address is the trustedHops-th from the right, the one the outermost trusted
+// proxy appended: addresses left of it are set by the client and can be spoofed.
+func newIPAllowlist(params Params, logger *zap.Logger) (Middleware, error) {
+	entries, err := params.Strings("cidrs")
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("%w: cidrs cannot be empty", ErrInvalidParams)
+	}
+	trustForwarded, err := params.Bool("trustForwardedFor", false)
+	if err != nil {
+		return nil, err
+	}
+	hops, err := params.Int("trustedHops", 1)
+	if err != nil {
+		return nil, err
+	}
+	if hops < 1 {
+		return nil, fmt.Errorf("%w: trustedHops must be at least 1", ErrInvalidParams)
+	}
+	if !trustForwarded {
+		hops = 0
+	}
+
+	prefixes := make([]netip.Prefix, 0, len(entries))
+	for _, entry := range entries {
+		prefix, err := parsePrefix(entry)
+		if err != nil {
+			return nil, fmt.Errorf("%w: cidr %q: %w", ErrInvalidParams, entry, err)
+		}
+		prefixes = append(prefixes, prefix)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			addr, ok := clientAddr(r, hops)
+			if ok {
+				for _, prefix := range prefixes {
+					if prefix.Contains(addr) {
+						next.ServeHTTP(w, r)
+						return
+					}
+				}
+			}
+			logger.Warn("Rejected request from address outside allowlist",
+				zap.String("remote_addr", r.RemoteAddr),
+				zap.String("path", r.URL.Path),
+			)
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		})
+	}, nil
+}
+
+// parsePrefix accepts a CIDR or a single address.
+func parsePrefix(entry string) (netip.Prefix, error) {
+	if strings.Contains(entry, "/") {
+		return netip.ParsePrefix(entry)
+	}
+	addr, err := netip.ParseAddr(entry)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// clientAddr returns the address of the client of a request behind hops trusted proxies:
+// the remote address without proxies, or the hops-th X-Forwarded-For address from the
+// right, across every X-Forwarded-For line. Requests with fewer addresses did not come
+// through the proxies and have none.
+func clientAddr(r *http.Request, hops int) (netip.Addr, bool) {
+	host := r.RemoteAddr
+	if hops > 0 {
+		var forwarded []string
+		for _, line := range r.Header.Values("X-Forwarded-For") {
+			for _, entry := range strings.Split(line, ",") {
+				forwarded = append(forwarded, strings.TrimSpace(entry))
+			}
+		}
+		if len(forwarded) < hops {
+			return netip.Addr{}, false
+		}
+		host = forwarded[len(forwarded)-hops]
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+// TestClientAddr checks that behind trusted proxies the client address is the one the
+// outermost of them appended to X-Forwarded-For, whatever the client sent left of it.
+func TestClientAddr(t *testing.T) {
+	tests := []struct {
+		name      string
+		forwarded []string // X-Forwarded-For lines
+		hops      int
+		want      string // Empty when the request has no client address
+	}{
+		{name: "no proxy", forwarded: []string{"10.0.0.1"}, want: "192.0.2.1"},
+		{name: "one proxy", forwarded: []string{"203.0.113.7"}, hops: 1, want: "203.0.113.7"},
+		{name: "spoofed entry", forwarded: []string{"10.0.0.1, 203.0.113.7"}, hops: 1, want: "203.0.113.7"},
+		{name: "spoofed line", forwarded: []string{"10.0.0.1", "203.0.113.7"}, hops: 1, want: "203.0.113.7"},
+		{name: "two proxies", forwarded: []string{"10.0.0.1, 203.0.113.7", "198.51.100.2"}, hops: 2, want: "203.0.113.7"},
+		{name: "bypassed proxy", forwarded: []string{"203.0.113.7"}, hops: 2},
+		{name: "no header", hops: 1},
+		{name: "port and mapped address", forwarded: []string{"[::ffff:203.0.113.7]:4711"}, hops: 1, want: "203.0.113.7"},
+		{name: "garbage", forwarded: []string{"unknown"}, hops: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil) // RemoteAddr 192.0.2.1:1234
+			for _, line := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", line)
+			}
+			got := ""
+			if addr, ok := clientAddr(r, tt.hops); ok {
+				got = addr.String()
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
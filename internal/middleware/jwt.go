@@ -0,0 +1,294 @@
+package middleware
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Claims are the validated claims of a JWT, available to handlers via ClaimsFromContext.
+type Claims map[string]interface{}
+
+// Subject returns the "sub" claim.
+func (c Claims) Subject() string {
+	sub, _ := c["sub"].(string)
+	return sub
+}
+
+type claimsKey struct{}
+
+// ClaimsFromContext returns the JWT claims of an authenticated request, if any.
+func ClaimsFromContext(ctx context.Context) (Claims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(Claims)
+	return claims, ok
+}
+
+// keyResolver returns the verification key for a token's algorithm and key ID.
+type keyResolver interface {
+	key(ctx context.Context, alg, kid string) (interface{}, error)
+}
+
+// jwtValidator validates compact JWS tokens signed with HS256, RS256 or ES256.
+type jwtValidator struct {
+	keys     keyResolver
+	issuer   string
+	audience string
+	leeway   time.Duration
+	now      func() time.Time
+
+	role       Role            // Granted to tokens without a role in rolesClaim, read-only by default
+	rolesClaim string          // Claim listing the caller's roles, e.g. roles or groups; empty grants role to all
+	roleValues map[string]Role // rolesClaim values to the role they grant
+}
+
+// newJWT validates bearer JWTs, e.g. OIDC access tokens.
+//
+// Params: secretFile (HS256 shared secret) or jwksURL (RS256/ES256 keys, e.g. the OIDC
+// provider's jwks_uri), issuer and audience (checked when set), leeway (clock skew,
+// default 1m), jwksRefresh (key cache lifetime, default 10m), role (granted to valid
+// tokens, default read-only), rolesClaim (claim listing the caller's roles, e.g. roles or
+// groups), operatorValues and readOnlyValues (rolesClaim values granting operator,
+// default ["operator"], and read-only, default ["read-only"]; operator wins when both
+// are present, role applies when neither is). Any holder of a valid token from the
+// issuer is trusted with role, so operators are best granted through rolesClaim.
+func newJWT(params Params, logger *zap.Logger) (Middleware, error) {
+	secretFile, err := params.String("secretFile", "")
+	if err != nil {
+		return nil, err
+	}
+	jwksURL, err := params.String("jwksURL", "")
+	if err != nil {
+		return nil, err
+	}
+	if (secretFile == "") == (jwksURL == "") {
+		return nil, fmt.Errorf("%w: exactly one of secretFile or jwksURL is required", ErrInvalidParams)
+	}
+
+	v := &jwtValidator{now: time.Now}
+	if v.issuer, err = params.String("issuer", ""); err != nil {
+		return nil, err
+	}
+	if v.audience, err = params.String("audience", ""); err != nil {
+		return nil, err
+	}
+	if v.leeway, err = params.Duration("leeway", time.Minute); err != nil {
+		return nil, err
+	}
+	if v.role, err = roleParam(params, RoleReadOnly); err != nil {
+		return nil, err
+	}
+	if v.rolesClaim, err = params.String("rolesClaim", ""); err != nil {
+		return nil, err
+	}
+	v.roleValues = make(map[string]Role)
+	for _, r := range []struct {
+		key  string
+		def  string
+		role Role
+	}{{"readOnlyValues", string(RoleReadOnly), RoleReadOnly}, {"operatorValues", string(RoleOperator), RoleOperator}} {
+		values, err := params.Strings(r.key)
+		if err != nil {
+			return nil, err
+		}
+		if len(values) == 0 {
+			values = []string{r.def}
+		}
+		for _, value := range values {
+			v.roleValues[value] = r.role
+		}
+	}
+
+	if secretFile != "" {
+		secret, err := os.ReadFile(secretFile)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidParams, err)
+		}
+		v.keys = hmacKey(strings.TrimSpace(string(secret)))
+	} else {
+		refresh, err := params.Duration("jwksRefresh", 10*time.Minute)
+		if err != nil {
+			return nil, err
+		}
+		v.keys = newJWKSCache(jwksURL, refresh, logger)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, ok := bearerToken(r)
+			if !ok {
+				unauthorized(w, "Bearer")
+				return
+			}
+			claims, err := v.validate(r.Context(), token)
+			if err != nil {
+				logger.Warn("Rejected request with invalid JWT",
+					zap.String("path", r.URL.Path),
+					zap.Error(err),
+				)
+				unauthorized(w, `Bearer error="invalid_token"`)
+				return
+			}
+			ctx := context.WithValue(r.Context(), claimsKey{}, claims)
+			ctx = withPrincipal(ctx, Principal{Name: claims.Subject(), Role: v.roleOf(claims)})
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}, nil
+}
+
+// validate verifies the token signature and standard claims.
+func (v *jwtValidator) validate(ctx context.Context, token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed token", ErrInvalidToken)
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: signature: %w", ErrInvalidToken, err)
+	}
+	key, err := v.keys.key(ctx, header.Alg, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifySignature(header.Alg, key, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return nil, err
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	return claims, v.checkClaims(claims)
+}
+
+func (v *jwtValidator) checkClaims(claims Claims) error {
+	now := v.now()
+	if exp, ok := claims["exp"].(float64); ok && now.After(time.Unix(int64(exp), 0).Add(v.leeway)) {
+		return ErrTokenExpired
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Before(time.Unix(int64(nbf), 0).Add(-v.leeway)) {
+		return fmt.Errorf("%w: token not valid yet", ErrInvalidToken)
+	}
+	if v.issuer != "" && claims["iss"] != v.issuer {
+		return fmt.Errorf("%w: unexpected issuer", ErrInvalidToken)
+	}
+	if v.audience != "" && !hasAudience(claims["aud"], v.audience) {
+		return fmt.Errorf("%w: unexpected audience", ErrInvalidToken)
+	}
+	return nil
+}
+
+// roleOf returns the role a token's claims grant.
+func (v *jwtValidator) roleOf(claims Claims) Role {
+	if v.rolesClaim == "" {
+		return v.role
+	}
+	var values []interface{}
+	switch c := claims[v.rolesClaim].(type) {
+	case string:
+		for _, value := range strings.Fields(c) { // e.g. a space-separated scope claim
+			values = append(values, value)
+		}
+	case []interface{}:
+		values = c
+	}
+	var granted Role
+	for _, value := range values {
+		s, _ := value.(string)
+		if role, ok := v.roleValues[s]; ok && (granted == "" || role == RoleOperator) {
+			granted = role
+		}
+	}
+	if granted == "" {
+		return v.role
+	}
+	return granted
+}
+
+// hasAudience handles "aud" given as a string or a list of strings.
+func hasAudience(aud interface{}, want string) bool {
+	switch a := aud.(type) {
+	case string:
+		return a == want
+	case []interface{}:
+		for _, item := range a {
+			if item == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+	return nil
+}
+
+// verifySignature checks a JWS signature for the supported algorithms.
+func verifySignature(alg string, key interface{}, signingInput, signature []byte) error {
+	digest := sha256.Sum256(signingInput)
+	switch k := key.(type) {
+	case hmacKey:
+		if alg != "HS256" {
+			break
+		}
+		mac := hmac.New(sha256.New, []byte(k))
+		mac.Write(signingInput)
+		if hmac.Equal(mac.Sum(nil), signature) {
+			return nil
+		}
+		return fmt.Errorf("%w: bad signature", ErrInvalidToken)
+	case *rsa.PublicKey:
+		if alg != "RS256" {
+			break
+		}
+		if err := rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], signature); err != nil {
+			return fmt.Errorf("%w: bad signature", ErrInvalidToken)
+		}
+		return nil
+	case *ecdsa.PublicKey:
+		if alg != "ES256" || len(signature) != 64 {
+			break
+		}
+		r, s := new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])
+		if ecdsa.Verify(k, digest[:], r, s) {
+			return nil
+		}
+		return fmt.Errorf("%w: bad signature", ErrInvalidToken)
+	}
+	return fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidToken, alg)
+}
+
+// hmacKey is a shared HS256 secret; it resolves to itself for every token.
+type hmacKey string
+
+func (k hmacKey) key(context.Context, string, string) (interface{}, error) {
+	return k, nil
+}
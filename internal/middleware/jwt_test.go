@@ -0,0 +1,296 @@
+package middleware
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const testSecret = "s3cr3t"
+
+var testNow = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+// staticKey resolves every token to the same key, like a JWKS holding a single key.
+type staticKey struct{ k interface{} }
+
+func (s staticKey) key(context.Context, string, string) (interface{}, error) { return s.k, nil }
+
+// signedToken returns a compact JWS of claims with header, signed by sign.
+func signedToken(t *testing.T, header, claims map[string]interface{}, sign func(input []byte) []byte) string {
+	t.Helper()
+	segment := func(v interface{}) string {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	input := segment(header) + "." + segment(claims)
+	return input + "." + base64.RawURLEncoding.EncodeToString(sign([]byte(input)))
+}
+
+func hs256(secret string) func([]byte) []byte {
+	return func(input []byte) []byte {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(input)
+		return mac.Sum(nil)
+	}
+}
+
+// hs256Token returns an HS256 token of claims signed with testSecret.
+func hs256Token(t *testing.T, claims map[string]interface{}) string {
+	return signedToken(t, map[string]interface{}{"alg": "HS256", "typ": "JWT"}, claims, hs256(testSecret))
+}
+
+func unix(t time.Time) float64 { return float64(t.Unix()) }
+
+// TestJWTValidate checks that tokens are rejected on a bad signature, an algorithm
+// other than the key's, expiry and not-before beyond the leeway, and an unexpected
+// issuer or audience.
+func TestJWTValidate(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaPublic, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs256 := func(input []byte) []byte {
+		digest := sha256.Sum256(input)
+		sig, err := rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sig
+	}
+	es256 := func(input []byte) []byte {
+		digest := sha256.Sum256(input)
+		r, s, err := ecdsa.Sign(rand.Reader, ecKey, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+	valid := map[string]interface{}{"sub": "alice", "iss": "https://issuer.example.com/", "aud": "featurelens", "exp": unix(testNow.Add(time.Hour))}
+	with := func(changes map[string]interface{}) map[string]interface{} {
+		claims := make(map[string]interface{}, len(valid))
+		for k, v := range valid {
+			claims[k] = v
+		}
+		for k, v := range changes {
+			if v == nil {
+				delete(claims, k)
+			} else {
+				claims[k] = v
+			}
+		}
+		return claims
+	}
+	forged := hs256Token(t, with(map[string]interface{}{"sub": "mallory"}))
+
+	tests := []struct {
+		name  string
+		keys  keyResolver
+		token string
+		want  error // nil when the token is valid
+	}{
+		{"valid HS256", hmacKey(testSecret), hs256Token(t, valid), nil},
+		{"valid RS256", staticKey{&rsaKey.PublicKey}, signedToken(t, map[string]interface{}{"alg": "RS256"}, valid, rs256), nil},
+		{"valid ES256", staticKey{&ecKey.PublicKey}, signedToken(t, map[string]interface{}{"alg": "ES256"}, valid, es256), nil},
+		{"audience in a list", hmacKey(testSecret), hs256Token(t, with(map[string]interface{}{"aud": []interface{}{"other", "featurelens"}})), nil},
+		{"no exp", hmacKey(testSecret), hs256Token(t, with(map[string]interface{}{"exp": nil})), nil},
+
+		{"signed with another secret", hmacKey(testSecret), signedToken(t, map[string]interface{}{"alg": "HS256"}, valid, hs256("other")), ErrInvalidToken},
+		{"claims changed after signing", hmacKey(testSecret), swapClaims(hs256Token(t, valid), forged), ErrInvalidToken},
+		{"signature stripped", hmacKey(testSecret), stripSignature(hs256Token(t, valid)), ErrInvalidToken},
+		{"RS256 signed by another key", staticKey{&rsaKey.PublicKey}, signedToken(t, map[string]interface{}{"alg": "RS256"}, valid, func(input []byte) []byte {
+			other, err := rsa.GenerateKey(rand.Reader, 2048)
+			if err != nil {
+				t.Fatal(err)
+			}
+			digest := sha256.Sum256(input)
+			sig, _ := rsa.SignPKCS1v15(rand.Reader, other, crypto.SHA256, digest[:])
+			return sig
+		}), ErrInvalidToken},
+		{"malformed", hmacKey(testSecret), "not.a-token", ErrInvalidToken},
+		{"payload not JSON", hmacKey(testSecret), signedRaw(t, `{"alg":"HS256"}`, `not json`), ErrInvalidToken},
+
+		{"alg none", hmacKey(testSecret), signedToken(t, map[string]interface{}{"alg": "none"}, valid, func([]byte) []byte { return nil }), ErrInvalidToken},
+		{"alg none with an HMAC", hmacKey(testSecret), signedToken(t, map[string]interface{}{"alg": "none"}, valid, hs256(testSecret)), ErrInvalidToken},
+		{"alg none against a public key", staticKey{&rsaKey.PublicKey}, signedToken(t, map[string]interface{}{"alg": "none"}, valid, func([]byte) []byte { return nil }), ErrInvalidToken},
+		// The classic confusion: HMAC with the public key, which the attacker knows, as secret
+		{"HS256 with the RSA public key", staticKey{&rsaKey.PublicKey}, signedToken(t, map[string]interface{}{"alg": "HS256"}, valid, hs256(string(rsaPublic))), ErrInvalidToken},
+		{"RS256 against an HMAC secret", hmacKey(testSecret), signedToken(t, map[string]interface{}{"alg": "RS256"}, valid, rs256), ErrInvalidToken},
+		{"ES256 against an RSA key", staticKey{&rsaKey.PublicKey}, signedToken(t, map[string]interface{}{"alg": "ES256"}, valid, es256), ErrInvalidToken},
+		{"HS512", hmacKey(testSecret), signedToken(t, map[string]interface{}{"alg": "HS512"}, valid, hs256(testSecret)), ErrInvalidToken},
+
+		{"expired", hmacKey(testSecret), hs256Token(t, with(map[string]interface{}{"exp": unix(testNow.Add(-2 * time.Minute))})), ErrTokenExpired},
+		{"expired within leeway", hmacKey(testSecret), hs256Token(t, with(map[string]interface{}{"exp": unix(testNow.Add(-30 * time.Second))})), nil},
+		{"not valid yet", hmacKey(testSecret), hs256Token(t, with(map[string]interface{}{"nbf": unix(testNow.Add(2 * time.Minute))})), ErrInvalidToken},
+		{"not valid yet within leeway", hmacKey(testSecret), hs256Token(t, with(map[string]interface{}{"nbf": unix(testNow.Add(30 * time.Second))})), nil},
+		{"valid since", hmacKey(testSecret), hs256Token(t, with(map[string]interface{}{"nbf": unix(testNow.Add(-time.Hour))})), nil},
+
+		{"other issuer", hmacKey(testSecret), hs256Token(t, with(map[string]interface{}{"iss": "https://evil.example.com/"})), ErrInvalidToken},
+		{"no issuer", hmacKey(testSecret), hs256Token(t, with(map[string]interface{}{"iss": nil})), ErrInvalidToken},
+		{"other audience", hmacKey(testSecret), hs256Token(t, with(map[string]interface{}{"aud": "other"})), ErrInvalidToken},
+		{"audience list without it", hmacKey(testSecret), hs256Token(t, with(map[string]interface{}{"aud": []interface{}{"a", "b"}})), ErrInvalidToken},
+		{"no audience", hmacKey(testSecret), hs256Token(t, with(map[string]interface{}{"aud": nil})), ErrInvalidToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := &jwtValidator{
+				keys:     tt.keys,
+				issuer:   "https://issuer.example.com/",
+				audience: "featurelens",
+				leeway:   time.Minute,
+				now:      func() time.Time { return testNow },
+			}
+			claims, err := v.validate(context.Background(), tt.token)
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("got %v, want a valid token", err)
+				}
+				if claims.Subject() != "alice" {
+					t.Errorf("got subject %q, want alice", claims.Subject())
+				}
+				return
+			}
+			if !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+// swapClaims returns token with the claims of other, keeping token's signature.
+func swapClaims(token, other string) string {
+	h, _, sig := splitToken(token)
+	_, claims, _ := splitToken(other)
+	return h + "." + claims + "." + sig
+}
+
+// stripSignature returns token with an empty signature.
+func stripSignature(token string) string {
+	h, claims, _ := splitToken(token)
+	return h + "." + claims + "."
+}
+
+func splitToken(token string) (header, claims, signature string) {
+	parts := strings.SplitN(token, ".", 3)
+	return parts[0], parts[1], parts[2]
+}
+
+// signedRaw returns an HS256 token of raw header and payload segments.
+func signedRaw(t *testing.T, header, payload string) string {
+	t.Helper()
+	input := base64.RawURLEncoding.EncodeToString([]byte(header)) + "." + base64.RawURLEncoding.EncodeToString([]byte(payload))
+	return input + "." + base64.RawURLEncoding.EncodeToString(hs256(testSecret)([]byte(input)))
+}
+
+// TestJWTRoles checks the role granted to valid tokens: read-only unless the roles
+// claim or the role param grants operator.
+func TestJWTRoles(t *testing.T) {
+	secretFile := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(secretFile, []byte(testSecret+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	exp := unix(time.Now().Add(time.Hour))
+	tests := []struct {
+		name   string
+		params Params
+		claims map[string]interface{}
+		want   Role
+	}{
+		{"no roles claim configured", Params{}, map[string]interface{}{"sub": "alice", "exp": exp}, RoleReadOnly},
+		{"role param", Params{"role": "operator"}, map[string]interface{}{"sub": "alice", "exp": exp}, RoleOperator},
+		{"claim missing", Params{"rolesClaim": "groups"}, map[string]interface{}{"sub": "alice", "exp": exp}, RoleReadOnly},
+		{"claim without a known value", Params{"rolesClaim": "groups"}, map[string]interface{}{"sub": "alice", "groups": []interface{}{"admins"}, "exp": exp}, RoleReadOnly},
+		{"claim not a list", Params{"rolesClaim": "groups"}, map[string]interface{}{"sub": "alice", "groups": map[string]interface{}{"operator": true}, "exp": exp}, RoleReadOnly},
+		{"operator value", Params{"rolesClaim": "groups"}, map[string]interface{}{"sub": "alice", "groups": []interface{}{"operator"}, "exp": exp}, RoleOperator},
+		{"space-separated scopes", Params{"rolesClaim": "scope", "operatorValues": []interface{}{"featurelens:write"}}, map[string]interface{}{"sub": "alice", "scope": "openid featurelens:write", "exp": exp}, RoleOperator},
+		{"operator wins over read-only", Params{"rolesClaim": "groups"}, map[string]interface{}{"sub": "alice", "groups": []interface{}{"read-only", "operator"}, "exp": exp}, RoleOperator},
+		{"read-only value despite role param", Params{"rolesClaim": "groups", "role": "operator"}, map[string]interface{}{"sub": "alice", "groups": []interface{}{"read-only"}, "exp": exp}, RoleReadOnly},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := Params{"secretFile": secretFile}
+			for k, v := range tt.params {
+				params[k] = v
+			}
+			mw, err := newJWT(params, zap.NewNop())
+			if err != nil {
+				t.Fatalf("newJWT: %v", err)
+			}
+			var got Principal
+			handler := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got, _ = PrincipalFromContext(r.Context())
+			}))
+			req := httptest.NewRequest(http.MethodGet, "/admin/v1/status", nil)
+			req.Header.Set("Authorization", "Bearer "+hs256Token(t, tt.claims))
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("got status %d, want %d", rec.Code, http.StatusOK)
+			}
+			if got.Role != tt.want || got.Name != "alice" {
+				t.Errorf("got %+v, want alice with role %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestJWTRejects checks that requests without a valid token are answered 401 and never
+// reach the handler.
+func TestJWTRejects(t *testing.T) {
+	secretFile := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(secretFile, []byte(testSecret), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	mw, err := newJWT(Params{"secretFile": secretFile}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("newJWT: %v", err)
+	}
+	handler := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("handler reached")
+	}))
+	expired := hs256Token(t, map[string]interface{}{"sub": "alice", "exp": unix(time.Now().Add(-time.Hour))})
+	for name, header := range map[string]string{
+		"no header":     "",
+		"basic auth":    "Basic YWxpY2U6cHc=",
+		"bad signature": "Bearer " + signedToken(t, map[string]interface{}{"alg": "HS256"}, map[string]interface{}{"sub": "alice"}, hs256("other")),
+		"expired":       "Bearer " + expired,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/admin/v1/status", nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("%s: got status %d, want %d", name, rec.Code, http.StatusUnauthorized)
+		}
+	}
+}
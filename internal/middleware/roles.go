@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+)
+
+// Role separates the callers of an API: read-only callers may only read, operators may
+// also change state, e.g. silence features or seek the consumer group.
+type Role string
+
+// Roles, from least to most privileged.
+const (
+	RoleReadOnly Role = "read-only"
+	RoleOperator Role = "operator"
+)
+
+// Allows reports whether the role grants the privileges of required.
+func (r Role) Allows(required Role) bool {
+	return r == RoleOperator || r == required
+}
+
+// parseRole parses a role name; empty is def.
+func parseRole(s string, def Role) (Role, error) {
+	switch Role(s) {
+	case "":
+		return def, nil
+	case RoleReadOnly, RoleOperator:
+		return Role(s), nil
+	default:
+		return "", fmt.Errorf("%w: unknown role %q, expected %s or %s", ErrInvalidParams, s, RoleReadOnly, RoleOperator)
+	}
+}
+
+// roleParam reads the role param: the role granted to the callers a middleware
+// authenticates, def when unset.
+func roleParam(params Params, def Role) (Role, error) {
+	s, err := params.String("role", "")
+	if err != nil {
+		return "", err
+	}
+	return parseRole(s, def)
+}
+
+// Principal is the caller of an authenticated request, available to handlers via
+// PrincipalFromContext.
+type Principal struct {
+	Name string // e.g. the JWT subject or the client certificate's common name
+	Role Role
+}
+
+type principalKey struct{}
+
+// PrincipalFromContext returns the caller of a request authenticated by a bearerToken,
+// jwt or clientCert middleware, if any.
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
+
+// withPrincipal records the caller of a request. A caller authenticated by several
+// middleware, e.g. a client certificate and a token, has the least privileged of their
+// roles, and the name of the first.
+func withPrincipal(ctx context.Context, p Principal) context.Context {
+	if prev, ok := PrincipalFromContext(ctx); ok {
+		if prev.Name != "" {
+			p.Name = prev.Name
+		}
+		if !prev.Role.Allows(p.Role) {
+			p.Role = prev.Role
+		}
+	}
+	return context.WithValue(ctx, principalKey{}, p)
+}
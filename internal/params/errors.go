@@ -0,0 +1,7 @@
+package params
+
+import "errors"
+
+var (
+	ErrInvalid = errors.New("invalid parameter")
+)
@@ -0,0 +1,146 @@
+// Package params provides typed access to the free-form parameters of pluggable
+// components (HTTP middleware, sinks, actions) configured as {type: ..., params: {...}}.
+package params
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Params holds a component's configuration parameters. Lookups ignore key case
+// because configuration keys are case-insensitive.
+type Params map[string]interface{}
+
+func (p Params) lookup(key string) (interface{}, bool) {
+	if v, ok := p[key]; ok {
+		return v, true
+	}
+	for k, v := range p {
+		if strings.EqualFold(k, key) {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// String returns a string parameter, or def when absent.
+func (p Params) String(key, def string) (string, error) {
+	v, ok := p.lookup(key)
+	if !ok || v == nil {
+		return def, nil
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("%w: %q must be a string", ErrInvalid, key)
+	}
+	return s, nil
+}
+
+// Strings returns a list of strings parameter; a single string is accepted as a one-element list.
+func (p Params) Strings(key string) ([]string, error) {
+	v, ok := p.lookup(key)
+	if !ok || v == nil {
+		return nil, nil
+	}
+	switch list := v.(type) {
+	case string:
+		return []string{list}, nil
+	case []string:
+		return list, nil
+	case []interface{}:
+		out := make([]string, 0, len(list))
+		for _, item := range list {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("%w: %q must be a list of strings", ErrInvalid, key)
+			}
+			out = append(out, s)
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("%w: %q must be a list of strings", ErrInvalid, key)
+}
+
+// Duration returns a duration parameter written as a Go duration string, or def when absent.
+func (p Params) Duration(key string, def time.Duration) (time.Duration, error) {
+	s, err := p.String(key, "")
+	if err != nil || s == "" {
+		return def, err
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q: %w", ErrInvalid, key, err)
+	}
+	return d, nil
+}
+
+// Bool returns a boolean parameter, or def when absent.
+func (p Params) Bool(key string, def bool) (bool, error) {
+	v, ok := p.lookup(key)
+	if !ok || v == nil {
+		return def, nil
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("%w: %q must be a boolean", ErrInvalid, key)
+	}
+	return b, nil
+}
+
+// Int returns an integer parameter, or def when absent.
+func (p Params) Int(key string, def int) (int, error) {
+	v, ok := p.lookup(key)
+	if !ok || v == nil {
+		return def, nil
+	}
+	switch n := v.(type) {
+	case int:
+		return n, nil
+	case int64:
+		return int(n), nil
+	case float64:
+		if n == float64(int(n)) {
+			return int(n), nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %q must be an integer", ErrInvalid, key)
+}
+
+// Float64 returns a numeric parameter, or def when absent.
+func (p Params) Float64(key string, def float64) (float64, error) {
+	v, ok := p.lookup(key)
+	if !ok || v == nil {
+		return def, nil
+	}
+	switch n := v.(type) {
+	case float64:
+		return n, nil
+	case int:
+		return float64(n), nil
+	case int64:
+		return float64(n), nil
+	}
+	return 0, fmt.Errorf("%w: %q must be a number", ErrInvalid, key)
+}
+
+// StringMap returns a map of string parameters, e.g. extra HTTP headers.
+func (p Params) StringMap(key string) (map[string]string, error) {
+	v, ok := p.lookup(key)
+	if !ok || v == nil {
+		return nil, nil
+	}
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%w: %q must be a map of strings", ErrInvalid, key)
+	}
+	out := make(map[string]string, len(m))
+	for k, item := range m {
+		s, ok := item.(string)
+		if !ok {
+			return nil, fmt.Errorf("%w: %q must be a map of strings", ErrInvalid, key)
+		}
+		out[k] = s
+	}
+	return out, nil
+}
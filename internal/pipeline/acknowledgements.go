@@ -0,0 +1,136 @@
+package pipeline
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/sanspareilsmyn/featurelens/internal/logging"
+	"github.com/sanspareilsmyn/featurelens/internal/schema"
+)
+
+// Acknowledgement records that an operator took ownership of a firing alert, e.g. during
+// a known incident. Further violations of the alert are annotated with it and no longer
+// page. It lasts until the alert resolves or expires, or, for a snooze, until Until.
+type Acknowledgement struct {
+	ID          string     `json:"id"`
+	FeatureName string     `json:"featureName"`
+	CheckType   string     `json:"checkType"`
+	Comparison  string     `json:"comparison"`
+	By          string     `json:"by"`
+	Comment     string     `json:"comment,omitempty"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	Until       *time.Time `json:"until,omitempty"`
+}
+
+// expired reports whether a snooze ended at now; nil never expires.
+func (a *Acknowledgement) expired(now time.Time) bool {
+	return a != nil && a.Until != nil && !now.Before(*a.Until)
+}
+
+// payload converts the acknowledgement into its public representation, nil for none.
+func (a *Acknowledgement) payload() *schema.Acknowledgement {
+	if a == nil {
+		return nil
+	}
+	return &schema.Acknowledgement{By: a.By, Comment: a.Comment, At: a.CreatedAt, Until: a.Until}
+}
+
+// Acknowledge acknowledges the feature's firing alerts of checkType, or of every check
+// when it is empty, and with comparison, or any when it is empty. A positive duration
+// snoozes them: paging resumes after it if they still fire. Alerts already acknowledged
+// are acknowledged again.
+func (c *Controls) Acknowledge(featureName, checkType, comparison, by, comment string, duration time.Duration) ([]Acknowledgement, error) {
+	if by == "" {
+		return nil, ErrEmptyAcknowledger
+	}
+	if duration < 0 {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidDuration, duration)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.clock.Now()
+	c.pruneLocked(now)
+
+	var acks []Acknowledgement
+	for key, alert := range c.alerts {
+		if alert.FeatureName != featureName || (checkType != "" && alert.CheckType != checkType) ||
+			(comparison != "" && alert.Comparison != comparison) {
+			continue
+		}
+		ack := &Acknowledgement{
+			ID:          c.newID("ack"),
+			FeatureName: alert.FeatureName,
+			CheckType:   alert.CheckType,
+			Comparison:  alert.Comparison,
+			By:          by,
+			Comment:     comment,
+			CreatedAt:   now,
+		}
+		if duration > 0 {
+			until := now.Add(duration)
+			ack.Until = &until
+		}
+		alert.Acknowledgement = ack
+		c.alerts[key] = alert
+		acks = append(acks, *ack)
+		c.logger.Info("Alert acknowledged",
+			zap.String("ack_id", ack.ID),
+			logging.Feature(alert.FeatureName),
+			logging.Check(alert.CheckType),
+			zap.String("comparison", alert.Comparison),
+			zap.String("by", by),
+			zap.Timep("until", ack.Until),
+		)
+	}
+	if len(acks) == 0 {
+		return nil, fmt.Errorf("%w: feature %q, check %q", ErrAlertNotFiring, featureName, checkType)
+	}
+	sort.Slice(acks, func(i, j int) bool {
+		return acks[i].CheckType+acks[i].Comparison < acks[j].CheckType+acks[j].Comparison
+	})
+	return acks, nil
+}
+
+// RemoveAcknowledgement withdraws an acknowledgement, reporting whether it existed, so
+// the alert pages again.
+func (c *Controls) RemoveAcknowledgement(id string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, alert := range c.alerts {
+		if alert.Acknowledgement != nil && alert.Acknowledgement.ID == id {
+			alert.Acknowledgement = nil
+			c.alerts[key] = alert
+			c.logger.Info("Acknowledgement removed", zap.String("ack_id", id))
+			return true
+		}
+	}
+	return false
+}
+
+// Acknowledgements returns the acknowledgements of firing alerts ordered by creation time.
+func (c *Controls) Acknowledgements() []Acknowledgement {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pruneLocked(c.clock.Now())
+
+	acks := make([]Acknowledgement, 0)
+	for _, alert := range c.alerts {
+		if alert.Acknowledgement != nil {
+			acks = append(acks, *alert.Acknowledgement)
+		}
+	}
+	sort.Slice(acks, func(i, j int) bool { return acks[i].CreatedAt.Before(acks[j].CreatedAt) })
+	return acks
+}
+
+// acknowledgementFor returns the acknowledgement of the violation's firing alert, if any.
+func (c *Controls) acknowledgementFor(v Violation) *Acknowledgement {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pruneLocked(c.clock.Now())
+	return c.alerts[alertKey(v.FeatureName, v.CheckType, v.Comparison)].Acknowledgement
+}
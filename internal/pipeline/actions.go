@@ -0,0 +1,183 @@
+package pipeline
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/sanspareilsmyn/featurelens/internal/action"
+	"github.com/sanspareilsmyn/featurelens/internal/config"
+	"github.com/sanspareilsmyn/featurelens/internal/logging"
+	"github.com/sanspareilsmyn/featurelens/internal/schema"
+)
+
+// actionRun is a queued run of an action for a violation.
+type actionRun struct {
+	trigger   action.Trigger
+	violation schema.Violation
+}
+
+// ActionDispatcher runs the configured actions for the paging violations they match,
+// at most once per action and firing alert within the action's cooldown. Runs are queued
+// and performed one at a time, so a slow action delays the others but never the alerter.
+// Failed runs are logged and counted, not retried: the alert's next violation after the
+// cooldown runs the action again.
+type ActionDispatcher struct {
+	cfg       config.ActionsConfig
+	triggers  []action.Trigger
+	input     chan actionRun
+	lastRuns  map[string]time.Time // Last run of each action for an alert, by action name and alert key
+	retention time.Duration        // Longest cooldown, after which last runs are forgotten
+	metrics   *Metrics
+	logger    *zap.Logger
+	reporter  *ErrorReporter // Reports failed runs; nil discards them
+}
+
+// NewActionDispatcher builds the configured actions.
+func NewActionDispatcher(cfg config.ActionsConfig, metrics *Metrics, logger *zap.Logger) (*ActionDispatcher, error) {
+	triggers, err := action.Build(cfg.Triggers, logger)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrActionCreationFailed, err)
+	}
+	names := make([]string, len(triggers))
+	retention := cfg.Cooldown
+	for i, t := range triggers {
+		names[i] = t.Name
+		retention = max(retention, t.Config.Cooldown)
+	}
+	logger.Info("Action dispatcher initialized",
+		zap.Strings("actions", names),
+		zap.Duration("timeout", cfg.Timeout),
+		zap.Duration("cooldown", cfg.Cooldown),
+	)
+	return &ActionDispatcher{
+		cfg:       cfg,
+		triggers:  triggers,
+		input:     make(chan actionRun, cfg.QueueSize),
+		lastRuns:  make(map[string]time.Time),
+		retention: retention,
+		metrics:   metrics,
+		logger:    logger,
+	}, nil
+}
+
+// Trigger queues, without blocking, the runs of the actions matching a violation of the
+// feature that are not cooling down for its alert. Only called by the alerter's loop.
+func (d *ActionDispatcher) Trigger(featureCfg config.FeatureConfig, v Violation) {
+	key := alertKey(v.FeatureName, v.CheckType, v.Comparison)
+	var payload *schema.Violation
+	for _, t := range d.triggers {
+		if !actionMatches(t.Config, featureCfg, v) {
+			continue
+		}
+		runKey := t.Name + "\x00" + key
+		cooldown := cmp.Or(t.Config.Cooldown, d.cfg.Cooldown)
+		if last, ok := d.lastRuns[runKey]; ok && v.DetectedAt.Sub(last) < cooldown {
+			d.metrics.actionRuns.WithLabelValues(t.Name, "cooling_down").Inc()
+			continue
+		}
+		if payload == nil {
+			p := v.Payload()
+			payload = &p
+		}
+		select {
+		case d.input <- actionRun{trigger: t, violation: *payload}:
+			d.lastRuns[runKey] = v.DetectedAt
+		default:
+			d.metrics.actionRuns.WithLabelValues(t.Name, "dropped").Inc()
+			d.logger.Warn("Action queue full, dropping run", zap.String("action", t.Name), logging.Feature(v.FeatureName))
+		}
+	}
+	d.expire(v.DetectedAt)
+}
+
+// expire forgets the last runs whose cooldowns elapsed, so resolved alerts do not
+// accumulate.
+func (d *ActionDispatcher) expire(now time.Time) {
+	for key, last := range d.lastRuns {
+		if now.Sub(last) >= d.retention {
+			delete(d.lastRuns, key)
+		}
+	}
+}
+
+// actionMatches reports whether every matcher set on the action matches the violation
+// of the feature.
+func actionMatches(cfg config.ActionConfig, f config.FeatureConfig, v Violation) bool {
+	if len(cfg.Severities) > 0 && !slices.Contains(cfg.Severities, v.Severity) {
+		return false
+	}
+	if len(cfg.Tenants) > 0 && !slices.Contains(cfg.Tenants, f.Tenant) {
+		return false
+	}
+	if len(cfg.Features) > 0 && !matchesAny(cfg.Features, f.Name) {
+		return false
+	}
+	if len(cfg.Checks) > 0 && !matchesAny(cfg.Checks, v.CheckType) {
+		return false
+	}
+	return Selector(cfg.Tags).Matches(f.Tags)
+}
+
+// Close stops accepting runs; Run performs what is queued, closes the actions and returns.
+func (d *ActionDispatcher) Close() {
+	close(d.input)
+}
+
+// Run performs queued runs until Close is called. Runs still queued when ctx is cancelled
+// are performed too, each bounded by actions.timeout, so the remediation of the final
+// windows of a run is not lost.
+func (d *ActionDispatcher) Run(ctx context.Context) error {
+	sugar := d.logger.Sugar()
+	sugar.Info("Starting action dispatcher loop...")
+	defer sugar.Info("Action dispatcher loop stopped.")
+	defer d.closeActions()
+
+	for run := range d.input {
+		d.run(run)
+	}
+	return nil
+}
+
+// run performs one run, or logs it for dry-run actions.
+func (d *ActionDispatcher) run(r actionRun) {
+	v := r.violation
+	fields := []zap.Field{
+		zap.String("action", r.trigger.Name),
+		logging.Feature(v.FeatureName),
+		logging.Check(v.CheckType),
+		zap.String("comparison", v.Comparison),
+		logging.WindowEnd(v.WindowEnd),
+	}
+	if r.trigger.Config.DryRun {
+		d.metrics.actionRuns.WithLabelValues(r.trigger.Name, "dry_run").Inc()
+		d.logger.Info("Action triggered (dry run)", fields...)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), d.cfg.Timeout)
+	start := time.Now()
+	err := r.trigger.Action.Run(ctx, v)
+	cancel()
+	fields = append(fields, zap.Duration("duration", time.Since(start)))
+	if err != nil {
+		d.metrics.actionRuns.WithLabelValues(r.trigger.Name, "failed").Inc()
+		d.logger.Error("Action failed", append(fields, zap.Error(err))...)
+		d.reporter.Report(&OpError{Component: ComponentAction, Op: "run:" + r.trigger.Name, Severity: ErrorSeverityError, Err: err})
+		return
+	}
+	d.metrics.actionRuns.WithLabelValues(r.trigger.Name, "succeeded").Inc()
+	d.logger.Info("Action succeeded", fields...)
+}
+
+func (d *ActionDispatcher) closeActions() {
+	for _, t := range d.triggers {
+		if err := t.Action.Close(); err != nil {
+			d.logger.Warn("Failed to close action", zap.String("action", t.Name), zap.Error(err))
+		}
+	}
+}
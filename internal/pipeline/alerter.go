@@ -2,83 +2,201 @@ package pipeline
 
 import (
 	"context"
+	"fmt"
 	"math"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 
+	"github.com/sanspareilsmyn/featurelens/internal/audit"
 	"github.com/sanspareilsmyn/featurelens/internal/config"
+	"github.com/sanspareilsmyn/featurelens/internal/logging"
+	"github.com/sanspareilsmyn/featurelens/internal/schema"
+	"github.com/sanspareilsmyn/featurelens/internal/signing"
+	"github.com/sanspareilsmyn/featurelens/internal/store"
 )
 
-// Prometheus Metrics Definition
-var (
-	featureCount = promauto.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "featurelens_feature_window_count_total", // Follow Prometheus naming conventions
-			Help: "Total number of messages processed for a feature in the last window.",
-		},
-		[]string{"feature_name"}, // Label: feature_name
-	)
-	featureNullCount = promauto.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "featurelens_feature_window_null_count_total",
-			Help: "Total number of null values encountered for a feature in the last window.",
-		},
-		[]string{"feature_name"},
-	)
-	featureNullRate = promauto.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "featurelens_feature_window_null_rate",
-			Help: "Null rate for a feature in the last window (NullCount / Count).",
-		},
-		[]string{"feature_name"},
-	)
-	featureMean = promauto.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "featurelens_feature_window_mean_value",
-			Help: "Mean value for a feature in the last window.",
-		},
-		[]string{"feature_name"},
-	)
-	featureStdDev = promauto.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "featurelens_feature_window_stddev_value",
-			Help: "Standard deviation for a feature in the last window.",
-		},
-		[]string{"feature_name"},
-	)
-	// Optional: Track violations
-	featureThresholdViolations = promauto.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "featurelens_feature_threshold_violations_total",
-			Help: "Total number of threshold violations detected for a feature and specific check.",
-		},
-		[]string{"feature_name", "check_type", "comparison"}, // Labels: feature_name, check_type (e.g., mean, null_rate), comparison (<, >)
-	)
-)
+// logTopCategories is the number of most frequent categories included in stats logs.
+const logTopCategories = 5
 
 // Alerter receives aggregation results and checks them against configured thresholds.
 type Alerter struct {
-	features map[string]config.FeatureConfig
-	input    <-chan AggregationResult
-	logger   *zap.Logger
+	registry   *FeatureRegistry
+	conditions map[string][]compiledCondition // Compiled lazily per feature
+	extensions *extensions                    // Custom metrics and checks, built lazily per feature
+	composites []compiledComposite
+	// compositeWindows buffers recent windows' statistics by window end (Unix nanoseconds)
+	// until every feature a composite metric references has reported.
+	compositeWindows  map[int64]*compositeWindow
+	input             <-chan AggregationResult
+	skew              <-chan SkewResult // nil when skew comparison is disabled
+	lag               <-chan LagResult
+	latencyResults    <-chan LatencyResult     // nil unless end-to-end latency is measured
+	correlations      <-chan CorrelationResult // nil unless correlations are configured
+	latencyCfg        config.LatencyConfig
+	throughput        <-chan ThroughputResult // nil unless throughput is checked
+	throughputCfg     config.ThroughputConfig
+	topic             string  // Source topic, which throughput violations are reported against
+	recentCounts      []int64 // Message counts of the recent windows, oldest first
+	completeCounts    []int64 // Message counts of the recent complete windows, oldest first, the learned expected volume
+	schemaCfg         config.SchemaTrackingConfig
+	schema            messageSchema // Of the last window with messages, nil until one completed
+	schemaFingerprint string
+	partitionCfg      config.PartitionStatsConfig
+	partitionSeries   map[[2]string]bool // Feature label and partition of the partition gauges set by the last window
+	// lagThreshold is the per-partition consumer lag reported as a violation, 0 to disable.
+	lagThreshold int64
+	signer       signing.Signer // Optional; signs the violation log records when set
+	remote       *RemoteWriter  // Optional; pushes aggregates to a remote-write endpoint
+	results      *store.Store   // Optional; keeps results and violations for the time-travel view
+	recent       *RecentWindows
+	sinks        *SinkDispatcher // Optional; delivers results and violations to external systems
+	actions      *ActionDispatcher
+	router       alertRouter
+	trail        *audit.Trail // Optional; records violations and alert resolutions for audits
+	sampler      *AdaptiveSampler
+	controls     *Controls
+	series       *seriesLimiter
+	rollups      *rollups
+	metrics      *Metrics
+	reporter     *ErrorReporter // Optional; reports failed writes of results and audit records
+	withSamples  bool           // Violations carry the value samples of their window
+	maxNotifyAge time.Duration  // Violations of older windows are recorded but never notified, 0 to notify all
+	graph        *dependencyGraph
+	summary      *RunSummary       // Windows and violations since start, for batch runs
+	stats        *processingStats  // Windows and violations since the last processing summary, nil unless enabled
+	learner      *ThresholdLearner // Records window statistics for featurelens tune, nil otherwise
+	// lastViolationWindow maps a feature to the end of its most recent violating window,
+	// used to group derived-feature violations under their upstream cause.
+	lastViolationWindow map[string]time.Time
+	// lastHealthy holds each feature's most recent window without violations, the
+	// baseline that explanations compare violating windows against.
+	lastHealthy map[string]AggregationResult
+	// constantRuns counts each feature's consecutive windows holding a single value.
+	constantRuns map[string]int
+	// lastData maps a feature to the end of its most recent window with observations, and
+	// noDataReported to the windows without any it was last reported for; see checkNoData.
+	lastData       map[string]time.Time
+	noDataReported map[string]int
+	noDataSince    time.Time // End of the first window checked for missing data
+	emptyWindows   int       // Consecutive windows without any message
+	// exportedInfo maps a feature_name label to the owner and team exported for it on
+	// featurelens_feature_info.
+	exportedInfo map[string][2]string
+	// pendingRuns counts, per feature and check, the consecutive violating windows of
+	// checks withheld until their thresholds' forWindows.
+	pendingRuns map[string]map[string]int
+	logger      *zap.Logger
+
+	clock Clock // When violations are detected and alerts resolved
 }
 
-// NewAlerter creates a new Alerter instance.
-func NewAlerter(features []config.FeatureConfig, input <-chan AggregationResult, logger *zap.Logger) *Alerter {
-	featureMap := make(map[string]config.FeatureConfig)
-	for _, f := range features {
-		featureMap[f.Name] = f
-	}
+// AlerterOptions are the optional inputs and outputs of an Alerter. Nil channels and
+// components disable what they feed or serve.
+type AlerterOptions struct {
+	Skew          <-chan SkewResult        // Training/serving skew results
+	Lag           <-chan LagResult         // Consumer lag polls
+	Latency       <-chan LatencyResult     // End-to-end latency per window
+	Correlations  <-chan CorrelationResult // Feature pair correlations per window
+	LatencyCfg    config.LatencyConfig
+	Throughput    <-chan ThroughputResult // Message count of every completed window
+	ThroughputCfg config.ThroughputConfig
+	SchemaCfg     config.SchemaTrackingConfig // Fingerprints the fields of every completed window, see Throughput
+	PartitionCfg  config.PartitionStatsConfig // Compares the partitions of every completed window, see Throughput
+	Topic         string                      // Source topic, names throughput violations
+	LagThreshold  int64                       // Per-partition consumer lag reported as a violation, 0 to disable
+	Composites    []config.CompositeMetricConfig
+	Signer        signing.Signer       // Signs violation audit records
+	Remote        *RemoteWriter        // Pushes aggregates to a remote-write endpoint
+	Results       *store.Store         // Keeps results and violations for the time-travel view
+	Recent        *RecentWindows       // Keeps recent windows for the history API
+	Sinks         *SinkDispatcher      // Delivers results and violations to external systems
+	Routes        []config.RouteConfig // Send matching violations and alert resolutions to specific sinks
+	Actions       *ActionDispatcher    // Runs remediation for paging violations
+	Trail         *audit.Trail         // Records violations and alert resolutions for audits
+	Sampler       *AdaptiveSampler
+	Controls      *Controls
+	Series        *seriesLimiter // Caps exported label values; unlimited when nil
+	Rollups       *rollups       // Coarser resolutions feature windows are exported at
+	Metrics       *Metrics       // Exported Prometheus metrics; unregistered when nil
+	Errors        *ErrorReporter // Reports operational failures, such as failed store writes
+	Samples       bool           // Include the value samples of their window in violations
+	MaxNotifyAge  time.Duration  // Age of a window when detected past which its violations are stale; 0 disables
+	Clock         Clock          // When violations are detected and alerts resolved; the system clock when nil
+}
 
-	logger.Debug("Alerter initialized", zap.Int("feature_count", len(featureMap)))
+// NewAlerter creates a new Alerter instance checking the results read from input.
+func NewAlerter(registry *FeatureRegistry, input <-chan AggregationResult, opts AlerterOptions, logger *zap.Logger) *Alerter {
+	features := registry.Features()
+	logger.Debug("Alerter initialized",
+		zap.Int("feature_count", len(features)),
+		zap.Bool("signing_enabled", opts.Signer != nil),
+		zap.Int("composite_metric_count", len(opts.Composites)),
+	)
+	if opts.Metrics == nil {
+		opts.Metrics = unregisteredMetrics()
+	}
+	if opts.Series == nil {
+		opts.Series = newSeriesLimiter(0, 0, opts.Metrics, logger)
+	}
+	if opts.Clock == nil {
+		opts.Clock = SystemClock
+	}
 
 	return &Alerter{
-		features: featureMap,
-		input:    input,
-		logger:   logger,
+		registry:       registry,
+		conditions:     make(map[string][]compiledCondition),
+		extensions:     newExtensions(logger.Named("extensions")),
+		composites:     compileComposites(opts.Composites, logger),
+		input:          input,
+		skew:           opts.Skew,
+		lag:            opts.Lag,
+		latencyResults: opts.Latency,
+		correlations:   opts.Correlations,
+		latencyCfg:     opts.LatencyCfg,
+		throughput:     opts.Throughput,
+		throughputCfg:  opts.ThroughputCfg,
+		schemaCfg:      opts.SchemaCfg,
+		partitionCfg:   opts.PartitionCfg,
+		topic:          opts.Topic,
+
+		compositeWindows: make(map[int64]*compositeWindow),
+
+		lagThreshold: opts.LagThreshold,
+		signer:       opts.Signer,
+		remote:       opts.Remote,
+		results:      opts.Results,
+		recent:       opts.Recent,
+		sinks:        opts.Sinks,
+		actions:      opts.Actions,
+		router:       alertRouter{routes: opts.Routes, metrics: opts.Metrics},
+		trail:        opts.Trail,
+		sampler:      opts.Sampler,
+		controls:     opts.Controls,
+		series:       opts.Series,
+		rollups:      opts.Rollups,
+		metrics:      opts.Metrics,
+		reporter:     opts.Errors,
+		withSamples:  opts.Samples,
+		maxNotifyAge: opts.MaxNotifyAge,
+		graph:        newDependencyGraph(features),
+		summary:      newRunSummary(),
+
+		lastViolationWindow: make(map[string]time.Time),
+		lastHealthy:         make(map[string]AggregationResult),
+		constantRuns:        make(map[string]int),
+		lastData:            make(map[string]time.Time),
+		noDataReported:      make(map[string]int),
+		exportedInfo:        make(map[string][2]string),
+		pendingRuns:         make(map[string]map[string]int),
+		logger:              logger,
+		clock:               opts.Clock,
 	}
 }
 
@@ -88,15 +206,71 @@ func (a *Alerter) Run(ctx context.Context) error {
 	sugar.Info("Starting alerter loop...")
 	defer sugar.Info("Alerter loop stopped.")
 
+	skew, lag, latency, throughput, correlations := a.skew, a.lag, a.latencyResults, a.throughput, a.correlations
 	for {
 		select {
 		case result, ok := <-a.input:
 			if !ok {
 				sugar.Info("Alerter input channel closed.")
+				if skew != nil {
+					for result := range skew { // Closed once the skew monitor flushed its remaining windows
+						a.processSkew(sugar, result)
+					}
+				}
+				if latency != nil {
+					for result := range latency { // Closed right after the input; holds the final windows' latency
+						a.processLatency(sugar, result)
+					}
+				}
+				if throughput != nil {
+					for result := range throughput {
+						a.processThroughput(sugar, result)
+					}
+				}
+				if correlations != nil {
+					for result := range correlations {
+						a.processCorrelation(sugar, result)
+					}
+				}
 				return nil
 			}
 			a.processResult(ctx, result)
 
+		case result, ok := <-skew:
+			if !ok {
+				skew = nil
+				continue
+			}
+			a.processSkew(sugar, result)
+
+		case result, ok := <-lag:
+			if !ok {
+				lag = nil
+				continue
+			}
+			a.processLag(sugar, result)
+
+		case result, ok := <-latency:
+			if !ok {
+				latency = nil
+				continue
+			}
+			a.processLatency(sugar, result)
+
+		case result, ok := <-throughput:
+			if !ok {
+				throughput = nil
+				continue
+			}
+			a.processThroughput(sugar, result)
+
+		case result, ok := <-correlations:
+			if !ok {
+				correlations = nil
+				continue
+			}
+			a.processCorrelation(sugar, result)
+
 		case <-ctx.Done():
 			sugar.Info("Context cancelled, stopping alerter.")
 			return ctx.Err()
@@ -109,145 +283,911 @@ func (a *Alerter) processResult(ctx context.Context, result AggregationResult) {
 	sugar := a.logger.Sugar()
 	featureName := result.FeatureName
 
-	featureCfg, exists := a.features[featureName]
+	ctx, span := tracer.Start(ctx, "alert.evaluate", trace.WithAttributes(attribute.String("feature_name", featureName)))
+	defer span.End()
+	defer observeSeconds(ctx, telemetry.evalDuration, time.Now())
+	if !result.flushed.IsZero() {
+		defer a.metrics.observeStage(stageAlert, result.flushed)
+	}
+
+	configName := result.configName()
+	featureCfg, exists := a.registry.Lookup(configName)
 	if !exists {
 		sugar.Warnw("Received result for unconfigured feature, skipping metric update",
-			zap.String("feature_name", featureName),
-			zap.Time("window_start", result.WindowStart),
-			zap.Time("window_end", result.WindowEnd),
+			logging.Feature(featureName),
+			logging.WindowStart(result.WindowStart),
+			logging.WindowEnd(result.WindowEnd),
 		)
 		return
 	}
+	a.extensions.computeMetrics(featureCfg, &result)
+	if result.Revision > 0 || result.Late {
+		a.processLateResult(sugar, result)
+		return
+	}
+	a.observeData(result)
 
 	// Calculate Metrics
-	nullRateVal := math.NaN()
-	if result.Count > 0 {
-		nullRateVal = float64(result.NullCount) / float64(result.Count)
-	}
+	nullRateVal := result.rate(result.NullCount)
+	missingRateVal := result.rate(result.MissingCount)
 
 	stdDevVal := math.NaN()
 	if !math.IsNaN(result.Variance) && result.Variance >= 0 {
 		stdDevVal = math.Sqrt(result.Variance)
 	}
 
-	// Update Prometheus Gauges
-	// Use .WithLabelValues(featureName) to get the specific gauge for this feature
-	featureCount.WithLabelValues(featureName).Set(float64(result.Count))
-	featureNullCount.WithLabelValues(featureName).Set(float64(result.NullCount))
+	if result.Segment != nil {
+		featureCfg = segmentConfig(featureCfg, result)
+	}
+	featureCfg.Thresholds = featureCfg.Thresholds.Effective()
+	a.series.export(result, nullRateVal, missingRateVal, stdDevVal, a.clock.Now())
+	if result.Segment == nil && result.ModelVersion == "" {
+		a.exportFeatureInfo(featureCfg)
+	}
+	for _, rollup := range a.rollups.add(result) {
+		a.series.exportRollup(rollup)
+	}
+	if a.remote != nil {
+		a.remote.Enqueue(result)
+	}
+	if a.sinks != nil {
+		a.sinks.EnqueueResult(result)
+	}
+
+	// Perform Threshold Checks & Log
+	// minCount gates rate checks on total messages and value checks on non-null observations,
+	// so a window that turns entirely null or missing still trips the rate thresholds.
+	// Checks whose alert fires are held to their resolve bound, if any.
+	thresholds := featureCfg.Thresholds.Resolving(func(key string) bool {
+		return a.firingBound(result.FeatureName, key)
+	})
+	minCount := int64(featureCfg.MinCount)
+	env := resultEnv(result, nullRateVal, missingRateVal, stdDevVal)
+	var violations []Violation
+	if featureCfg.Strict && result.TypeMismatchCount > 0 { // Every mismatch counts, however few messages
+		violations = append(violations, newViolation(result, "type_mismatch", ">", float64(result.TypeMismatchCount), 0))
+	}
+	if result.Count >= minCount {
+		violations = append(violations, checkNullRate(result, nullRateVal, thresholds.NullRate)...)
+		violations = append(violations, checkMissingRate(result, missingRateVal, thresholds.MissingRate)...)
+		violations = append(violations, checkRange(result, "type_mismatch_rate", result.rate(result.TypeMismatchCount), nil, thresholds.TypeMismatchRate)...)
+		violations = append(violations, a.checkConditions(sugar, featureCfg, result, env)...)
+		violations = append(violations, a.checkSeasonal(result, nullRateVal, featureCfg.Seasonal)...)
+		violations = append(violations, a.extensions.evaluateChecks(featureCfg, result)...)
+	}
+	if result.ValidCount() >= minCount {
+		violations = append(violations, checkMean(result, thresholds.MeanMin, thresholds.MeanMax)...)
+		violations = append(violations, checkStdDev(result, stdDevVal, thresholds.StdDevMin, thresholds.StdDevMax)...)
+		violations = append(violations, checkText(result, thresholds)...)
+		violations = append(violations, checkVector(result, thresholds)...)
+		violations = append(violations, checkPercentiles(result, thresholds)...)
+		violations = append(violations, checkZeroRate(result, thresholds.ZeroRateMax)...)
+		violations = append(violations, checkRange(result, "outlier_rate", result.outlierRate(), nil, thresholds.OutlierRateMax)...)
+		violations = append(violations, checkRange(result, "distinct", result.DistinctEstimate, thresholds.DistinctMin, thresholds.DistinctMax)...)
+		violations = append(violations, checkRange(result, "true_rate", result.booleanRate(result.TrueCount), thresholds.TrueRateMin, thresholds.TrueRateMax)...)
+		violations = append(violations, a.checkConstant(result, thresholds.ConstantWindows)...)
+		if result.Segment == nil { // Sampling is per feature, driven by its overall results
+			a.sampler.Observe(configName, approachingThresholds(featureCfg, nullRateVal, missingRateVal, result.rate(result.TypeMismatchCount), result.Mean, stdDevVal) ||
+				approachingUpper(result.zeroRate(), thresholds.ZeroRateMax, featureCfg.Sampling.ApproachMargin) ||
+				approachingUpper(result.outlierRate(), thresholds.OutlierRateMax, featureCfg.Sampling.ApproachMargin) ||
+				approachingLower(result.DistinctEstimate, thresholds.DistinctMin, featureCfg.Sampling.ApproachMargin) ||
+				approachingUpper(result.DistinctEstimate, thresholds.DistinctMax, featureCfg.Sampling.ApproachMargin) ||
+				approachingLower(result.booleanRate(result.TrueCount), thresholds.TrueRateMin, featureCfg.Sampling.ApproachMargin) ||
+				approachingUpper(result.booleanRate(result.TrueCount), thresholds.TrueRateMax, featureCfg.Sampling.ApproachMargin) ||
+				approachingTextThresholds(featureCfg, result.Text) || approachingVectorThresholds(featureCfg, result.Vector) ||
+				approachingPercentileThresholds(featureCfg, result.Percentiles))
+		}
+	} else {
+		sugar.Debugw("Too few observations, suppressing value checks",
+			logging.Feature(featureName),
+			logging.WindowEnd(result.WindowEnd),
+			zap.Int64("valid_count", result.ValidCount()),
+			zap.Int64("min_count", minCount),
+		)
+		a.metrics.featureChecksSuppressed.WithLabelValues(a.series.featureLabel(configName), "min_count", result.ModelVersion).Inc()
+	}
+
+	escalateCritical(violations, featureCfg.Thresholds.Critical)
+	violations = a.holdPending(sugar, result.FeatureName, violations, featureCfg.Thresholds.ForWindows)
+	reported := a.reportViolations(sugar, featureCfg, result, violations)
+	a.storeResult(sugar, result, reported)
+	// Composite metrics reference features, not their segments or model versions
+	if result.Segment == nil && result.ModelVersion == "" {
+		a.observeComposites(sugar, result, env)
+	}
+
+	// Log Statistics
+	a.logStats(sugar, result, nullRateVal, missingRateVal, stdDevVal)
+}
+
+// exportFeatureInfo exports a feature's owner and team on featurelens_feature_info,
+// replacing the series of its previous values after a reload. Features folded into
+// OtherGroup are left out, having no single owner.
+func (a *Alerter) exportFeatureInfo(f config.FeatureConfig) {
+	info := [2]string{f.Owner, f.Team}
+	label := a.series.featureLabel(f.Name)
+	if label == OtherGroup || a.exportedInfo[label] == info {
+		return
+	}
+	if prev, ok := a.exportedInfo[label]; ok {
+		a.metrics.featureInfo.DeleteLabelValues(label, prev[0], prev[1])
+	}
+	a.exportedInfo[label] = info
+	if info != ([2]string{}) {
+		a.metrics.featureInfo.WithLabelValues(label, info[0], info[1]).Set(1)
+	}
+}
+
+// setFeatureGauges exports a feature's window statistics on the per-feature gauges, under
+// the feature_name label value given by the series limiter, as updated at now.
+func (m *Metrics) setFeatureGauges(featureName string, result AggregationResult, nullRateVal, missingRateVal, stdDevVal float64, now time.Time) {
+	version := result.ModelVersion
+	// Use .WithLabelValues(featureName, version) to get the specific gauge for this feature
+	m.featureCount.WithLabelValues(featureName, version).Set(float64(result.Count))
+	m.featureNullCount.WithLabelValues(featureName, version).Set(float64(result.NullCount))
 	if !math.IsNaN(nullRateVal) {
-		featureNullRate.WithLabelValues(featureName).Set(nullRateVal)
+		m.featureNullRate.WithLabelValues(featureName, version).Set(nullRateVal)
+	} else {
+		m.featureNullRate.WithLabelValues(featureName, version).Set(0)
+	}
+	m.featureMissingCount.WithLabelValues(featureName, version).Set(float64(result.MissingCount))
+	if !math.IsNaN(missingRateVal) {
+		m.featureMissingRate.WithLabelValues(featureName, version).Set(missingRateVal)
 	} else {
-		featureNullRate.WithLabelValues(featureName).Set(0)
+		m.featureMissingRate.WithLabelValues(featureName, version).Set(0)
+	}
+	if typeMismatchRate := result.rate(result.TypeMismatchCount); !math.IsNaN(typeMismatchRate) {
+		m.featureTypeMismatchRate.WithLabelValues(featureName, version).Set(typeMismatchRate)
 	}
 	if !math.IsNaN(result.Mean) {
-		featureMean.WithLabelValues(featureName).Set(result.Mean)
+		m.featureMean.WithLabelValues(featureName, version).Set(result.Mean)
 	} else {
-		featureMean.WithLabelValues(featureName).Set(0)
+		m.featureMean.WithLabelValues(featureName, version).Set(0)
 	}
 	if !math.IsNaN(stdDevVal) {
-		featureStdDev.WithLabelValues(featureName).Set(stdDevVal)
+		m.featureStdDev.WithLabelValues(featureName, version).Set(stdDevVal)
 	} else {
-		featureStdDev.WithLabelValues(featureName).Set(0)
+		m.featureStdDev.WithLabelValues(featureName, version).Set(0)
 	}
+	if result.Categories != nil {
+		m.featureDistinctValues.WithLabelValues(featureName, version).Set(float64(len(result.Categories)))
+	}
+	if !math.IsNaN(result.DistinctEstimate) {
+		m.featureDistinctEstimate.WithLabelValues(featureName, version).Set(result.DistinctEstimate)
+	}
+	if zeroRate := result.zeroRate(); !math.IsNaN(zeroRate) {
+		m.featureZeroRate.WithLabelValues(featureName, version).Set(zeroRate)
+	}
+	if outlierRate := result.outlierRate(); !math.IsNaN(outlierRate) {
+		m.featureOutlierRate.WithLabelValues(featureName, version).Set(outlierRate)
+	}
+	if trueRate := result.booleanRate(result.TrueCount); !math.IsNaN(trueRate) {
+		m.featureTrueRate.WithLabelValues(featureName, version).Set(trueRate)
+	}
+	if text := result.Text; text != nil {
+		m.featureAvgLength.WithLabelValues(featureName, version).Set(text.AvgLength)
+		m.featureMaxLength.WithLabelValues(featureName, version).Set(float64(text.MaxLength))
+		if !math.IsNaN(text.PatternMatchRate) {
+			m.featurePatternMatchRate.WithLabelValues(featureName, version).Set(text.PatternMatchRate)
+		}
+	}
+	if p := result.Percentiles; p != nil {
+		m.featurePercentile.WithLabelValues(featureName, version, "0.5").Set(p.P50)
+		m.featurePercentile.WithLabelValues(featureName, version, "0.95").Set(p.P95)
+		m.featurePercentile.WithLabelValues(featureName, version, "0.99").Set(p.P99)
+	}
+	if vec := result.Vector; vec != nil {
+		m.featureDimensionMismatchRate.WithLabelValues(featureName, version).Set(vec.dimensionMismatchRate())
+		if !math.IsNaN(vec.NonFiniteRate) {
+			m.featureNonFiniteRate.WithLabelValues(featureName, version).Set(vec.NonFiniteRate)
+		}
+		if !math.IsNaN(vec.NormMean) {
+			m.featureNormMean.WithLabelValues(featureName, version).Set(vec.NormMean)
+		}
+		if !math.IsNaN(vec.CentroidDistance) {
+			m.featureCentroidDistance.WithLabelValues(featureName, version).Set(vec.CentroidDistance)
+		}
+	}
+	for name, v := range result.Custom {
+		m.featureCustomMetric.WithLabelValues(featureName, version, name).Set(v)
+	}
+	m.featureLastUpdate.WithLabelValues(featureName, version).Set(float64(now.Unix()))
+}
 
-	// Perform Threshold Checks & Log
-	thresholds := featureCfg.Thresholds
-	a.checkNullRate(sugar, featureName, result.WindowEnd, nullRateVal, thresholds.NullRate)
-	a.checkMean(sugar, featureName, result.WindowEnd, result.Mean, thresholds.MeanMin, thresholds.MeanMax)
-	a.checkStdDev(sugar, featureName, result.WindowEnd, stdDevVal, thresholds.StdDevMin, thresholds.StdDevMax)
-
-	// Log Statistics
-	a.logStats(sugar, result, nullRateVal, stdDevVal)
+// initFeatureGauges exports a feature's main statistics as NaN and its last update as 0,
+// so that its series exist without a value from startup until its first window rather
+// than being absent, e.g. to tell a restarted instance from a feature gone silent.
+func (m *Metrics) initFeatureGauges(featureName string, numerical bool) {
+	gauges := []*prometheus.GaugeVec{m.featureCount, m.featureNullCount, m.featureNullRate, m.featureMissingCount, m.featureMissingRate}
+	if numerical {
+		gauges = append(gauges, m.featureMean, m.featureStdDev)
+	}
+	for _, g := range gauges {
+		g.WithLabelValues(featureName, "").Set(math.NaN())
+	}
+	m.featureLastUpdate.WithLabelValues(featureName, "").Set(0)
 }
 
 // Helper function to check Null Rate threshold
-func (a *Alerter) checkNullRate(sugar *zap.SugaredLogger, featureName string, windowEnd time.Time, actualRate float64, threshold *float64) {
+func checkNullRate(result AggregationResult, actualRate float64, threshold *float64) []Violation {
 	if threshold == nil || math.IsNaN(actualRate) {
-		return
+		return nil
 	}
 	if actualRate > *threshold {
-		sugar.Warnw("Null Rate violation",
-			zap.String("feature_name", featureName),
-			zap.Time("window_end", windowEnd),
-			zap.Float64("actual", actualRate),
-			zap.Float64("threshold", *threshold),
-			zap.String("comparison", ">"),
-		)
-		// Increment violation counter
-		featureThresholdViolations.WithLabelValues(featureName, "null_rate", ">").Inc()
+		return []Violation{newViolation(result, "null_rate", ">", actualRate, *threshold)}
+	}
+	return nil
+}
+
+// Helper function to check Missing Rate threshold
+func checkMissingRate(result AggregationResult, actualRate float64, threshold *float64) []Violation {
+	if threshold == nil || math.IsNaN(actualRate) {
+		return nil
 	}
+	if actualRate > *threshold {
+		return []Violation{newViolation(result, "missing_rate", ">", actualRate, *threshold)}
+	}
+	return nil
 }
 
 // Helper function to check Mean thresholds
-func (a *Alerter) checkMean(sugar *zap.SugaredLogger, featureName string, windowEnd time.Time, actualMean float64, minThreshold, maxThreshold *float64) {
-	if math.IsNaN(actualMean) {
-		return
+func checkMean(result AggregationResult, minThreshold, maxThreshold *float64) []Violation {
+	return checkRange(result, "mean", result.Mean, minThreshold, maxThreshold)
+}
+
+// Helper function to check Standard Deviation thresholds
+func checkStdDev(result AggregationResult, actualStdDev float64, minThreshold, maxThreshold *float64) []Violation {
+	return checkRange(result, "stddev", actualStdDev, minThreshold, maxThreshold)
+}
+
+// Helper function to check Zero Rate threshold
+func checkZeroRate(result AggregationResult, threshold *float64) []Violation {
+	return checkRange(result, "zero_rate", result.zeroRate(), nil, threshold)
+}
+
+// checkConstant tracks the feature's run of constant windows and reports it once it
+// reaches the configured length. Windows too sparse for value checks leave the run as is.
+func (a *Alerter) checkConstant(result AggregationResult, windows int) []Violation {
+	run := 0
+	if result.Constant {
+		run = a.constantRuns[result.FeatureName] + 1
+	}
+	a.constantRuns[result.FeatureName] = run
+	if name := result.configName(); result.Segment == nil && a.series.featureLabel(name) == name { // Runs do not aggregate
+		a.metrics.featureConstantWindows.WithLabelValues(name, result.ModelVersion).Set(float64(run))
+	}
+	if windows == 0 || run < windows {
+		return nil
+	}
+	return []Violation{newViolation(result, "constant", ">=", float64(run), float64(windows))}
+}
+
+// checkText checks the length and pattern thresholds of a feature's string values.
+func checkText(result AggregationResult, thresholds config.Thresholds) []Violation {
+	text := result.Text
+	if text == nil {
+		return nil
 	}
-	if minThreshold != nil && actualMean < *minThreshold {
-		sugar.Warnw("Mean violation (Min)",
-			zap.String("feature_name", featureName),
-			zap.Time("window_end", windowEnd),
-			zap.Float64("actual", actualMean),
-			zap.Float64("threshold", *minThreshold),
-			zap.String("comparison", "<"),
+	violations := checkRange(result, "avg_length", text.AvgLength, thresholds.AvgLengthMin, thresholds.AvgLengthMax)
+	violations = append(violations, checkRange(result, "max_length", float64(text.MaxLength), nil, thresholds.MaxLength)...)
+	return append(violations, checkRange(result, "pattern_match_rate", text.PatternMatchRate, thresholds.PatternMatchRateMin, nil)...)
+}
+
+// checkVector checks the norm, dimension, finiteness and centroid distance thresholds of
+// a vector feature's values.
+func checkVector(result AggregationResult, thresholds config.Thresholds) []Violation {
+	vec := result.Vector
+	if vec == nil {
+		return nil
+	}
+	violations := checkRange(result, "norm_mean", vec.NormMean, thresholds.NormMin, thresholds.NormMax)
+	violations = append(violations, checkRange(result, "dimension_mismatch_rate", vec.dimensionMismatchRate(), nil, thresholds.DimensionMismatchRateMax)...)
+	violations = append(violations, checkRange(result, "non_finite_rate", vec.NonFiniteRate, nil, thresholds.NonFiniteRateMax)...)
+	return append(violations, checkRange(result, "centroid_distance", vec.CentroidDistance, nil, thresholds.CentroidDistanceMax)...)
+}
+
+// checkPercentiles checks the percentile thresholds of a latency feature.
+func checkPercentiles(result AggregationResult, thresholds config.Thresholds) []Violation {
+	p := result.Percentiles
+	if p == nil {
+		return nil
+	}
+	violations := checkRange(result, "p50", p.P50, nil, thresholds.P50Max)
+	violations = append(violations, checkRange(result, "p95", p.P95, nil, thresholds.P95Max)...)
+	return append(violations, checkRange(result, "p99", p.P99, nil, thresholds.P99Max)...)
+}
+
+// checkRange returns violations for a value outside optional min/max bounds.
+func checkRange(result AggregationResult, checkType string, actual float64, minThreshold, maxThreshold *float64) []Violation {
+	if math.IsNaN(actual) {
+		return nil
+	}
+	var violations []Violation
+	if minThreshold != nil && actual < *minThreshold {
+		violations = append(violations, newViolation(result, checkType, "<", actual, *minThreshold))
+	}
+	if maxThreshold != nil && actual > *maxThreshold {
+		violations = append(violations, newViolation(result, checkType, ">", actual, *maxThreshold))
+	}
+	return violations
+}
+
+// newViolation builds a Violation for the given result and check outcome.
+func newViolation(result AggregationResult, checkType, comparison string, actual, threshold float64) Violation {
+	return Violation{
+		FeatureName:  result.FeatureName,
+		CheckType:    checkType,
+		Comparison:   comparison,
+		Actual:       actual,
+		Threshold:    threshold,
+		WindowStart:  result.WindowStart,
+		WindowEnd:    result.WindowEnd,
+		Segment:      result.Segment,
+		ModelVersion: result.ModelVersion,
+		Tenant:       result.Tenant,
+	}
+}
+
+// reportViolations reports every violation of a window, explaining each against the
+// feature's previous healthy window, and remembers the window as healthy if none fired.
+// It returns the violations as reported.
+func (a *Alerter) reportViolations(sugar *zap.SugaredLogger, featureCfg config.FeatureConfig, result AggregationResult, violations []Violation) []Violation {
+	if len(violations) == 0 {
+		if len(a.pendingRuns[result.FeatureName]) == 0 {
+			a.lastHealthy[result.FeatureName] = result
+		}
+		for _, alert := range a.controls.resolveAlerts(result.FeatureName) {
+			sugar.Infow("Alert resolved",
+				logging.Feature(alert.FeatureName),
+				logging.Check(alert.CheckType),
+				zap.Time("firing_since", alert.Since),
+				logging.WindowEnd(result.WindowEnd),
+				zap.Duration("duration", alert.duration(result.WindowEnd)),
+			)
+			a.metrics.alertTransitions.WithLabelValues("resolved", alert.Severity).Inc()
+			a.metrics.alertDuration.WithLabelValues(alert.Severity).Observe(alert.duration(result.WindowEnd).Seconds())
+			payload := alert.Payload(result.WindowEnd, a.clock.Now())
+			if a.sinks != nil {
+				a.sinks.EnqueueResolved(payload, a.router.route(featureCfg, alert.Severity), a.alertContext(featureCfg, alert.FeatureName, &result))
+			}
+			a.recordAudit(sugar, alert.FeatureName, payload)
+		}
+		return nil
+	}
+
+	explanation := explain(a.lastHealthy, result)
+	for i := range violations {
+		violations[i].Explanation = explanation
+		violations[i].window = &result
+		if a.withSamples {
+			violations[i].Samples = result.Samples
+		}
+		violations[i].Exemplars = violationExemplars(result.Exemplars, violations[i].CheckType, violations[i].Comparison)
+		violations[i] = a.reportViolation(sugar, featureCfg, violations[i])
+	}
+	return violations
+}
+
+// holdPending returns the violations of checks that violated at least forWindows
+// consecutive windows of the feature, counting this one. The others are pending: only
+// logged at debug level, and forgotten once their check stops violating.
+func (a *Alerter) holdPending(sugar *zap.SugaredLogger, featureName string, violations []Violation, forWindows int) []Violation {
+	if forWindows <= 1 {
+		delete(a.pendingRuns, featureName)
+		return violations
+	}
+	previous := a.pendingRuns[featureName]
+	runs := make(map[string]int, len(violations))
+	var firing []Violation
+	for _, v := range violations {
+		check := v.CheckType + v.Comparison
+		runs[check] = previous[check] + 1
+		if runs[check] >= forWindows {
+			firing = append(firing, v)
+			continue
+		}
+		sugar.Debugw("Violation pending",
+			logging.Feature(featureName),
+			logging.Check(v.CheckType),
+			logging.WindowEnd(v.WindowEnd),
+			zap.Int("violating_windows", runs[check]),
+			zap.Int("for_windows", forWindows),
 		)
-		featureThresholdViolations.WithLabelValues(featureName, "mean", "<").Inc()
-	}
-	if maxThreshold != nil && actualMean > *maxThreshold {
-		sugar.Warnw("Mean violation (Max)",
-			zap.String("feature_name", featureName),
-			zap.Time("window_end", windowEnd),
-			zap.Float64("actual", actualMean),
-			zap.Float64("threshold", *maxThreshold),
-			zap.String("comparison", ">"),
+	}
+	if len(runs) == 0 {
+		delete(a.pendingRuns, featureName)
+	} else {
+		a.pendingRuns[featureName] = runs
+	}
+	return firing
+}
+
+// storeResult records the window and its violations among the feature's recent windows,
+// and in the results store if enabled.
+func (a *Alerter) storeResult(sugar *zap.SugaredLogger, result AggregationResult, violations []Violation) {
+	record := store.Record{Result: result.Payload()}
+	record.Result.Sketches = nil // Exported to sinks only; the UI doesn't need them
+	if len(violations) > 0 {
+		record.Violations = make([]schema.Violation, len(violations))
+		for i, v := range violations {
+			record.Violations[i] = v.Payload()
+		}
+	}
+	a.recent.add(record)
+	a.summary.addWindow(result)
+	a.stats.addWindow(result.FeatureName)
+	if a.learner != nil {
+		a.learner.addWindow(result)
+	}
+	if a.results != nil {
+		if err := a.results.Append(record); err != nil {
+			sugar.Warnw("Failed to store window result",
+				logging.Feature(result.FeatureName),
+				logging.WindowEnd(result.WindowEnd),
+				zap.Error(err),
+			)
+			a.reporter.Report(&OpError{Component: ComponentStore, Op: "store", Severity: ErrorSeverityError, Err: err})
+		}
+	}
+}
+
+// reportViolation logs a detected violation at its severity's level and increments the
+// violation counter. Violations of derived features whose upstream features violated in the
+// same window are grouped under that cause, and violations of silenced features and
+// acknowledged alerts are kept quiet; all are logged at info level instead of paging
+// separately. Violations of canary features are only logged, counted and audited.
+// When a signer is configured, the signed audit record is attached to the log entry.
+// It returns the violation with its cause and severity filled in.
+func (a *Alerter) reportViolation(sugar *zap.SugaredLogger, featureCfg config.FeatureConfig, v Violation) Violation {
+	msg := violationMessage(v)
+	if v.DetectedAt.IsZero() {
+		v.DetectedAt = a.clock.Now()
+	}
+	v.CausedBy = a.violatingAncestors(v)
+	v.Severity = a.controls.severityFor(featureCfg, v.Severity)
+	silence, silenced := a.controls.silenceFor(featureCfg, v.CheckType)
+	v.Silenced = silenced
+	v.Acknowledgement = a.controls.acknowledgementFor(v)
+	v.Tenant = featureCfg.Tenant
+	v.Canary = featureCfg.Canary()
+	v.Stale = a.maxNotifyAge > 0 && v.DetectedAt.Sub(v.WindowEnd) > a.maxNotifyAge
+	v.Metadata = featureMetadata(featureCfg)
+	if !v.Canary {
+		a.lastViolationWindow[v.FeatureName] = v.WindowEnd // Canary violations are not upstream causes
+	}
+
+	fields := []interface{}{
+		logging.Feature(v.FeatureName),
+		logging.Check(v.CheckType),
+		logging.WindowStart(v.WindowStart),
+		logging.WindowEnd(v.WindowEnd),
+		zap.Float64("actual", v.Actual),
+		zap.Float64("threshold", v.Threshold),
+		zap.String("comparison", v.Comparison),
+		zap.String("severity", v.Severity),
+	}
+	if v.ModelVersion != "" {
+		fields = append(fields, zap.String("model_version", v.ModelVersion))
+	}
+	if v.Tenant != "" {
+		fields = append(fields, zap.String("tenant", v.Tenant))
+	}
+	if v.Expression != "" {
+		fields = append(fields, zap.String("expression", v.Expression))
+	}
+	if v.Explanation != nil {
+		fields = append(fields,
+			zap.Time("baseline_window_end", v.Explanation.BaselineWindowEnd),
+			zap.String("explanation", v.Explanation.Summary()),
 		)
-		featureThresholdViolations.WithLabelValues(featureName, "mean", ">").Inc()
 	}
+	fields = append(fields, a.auditFields(sugar, v)...)
+
+	switch {
+	case v.Canary:
+		sugar.Infow(msg+" (canary)", fields...)
+	case v.Stale:
+		fields = append(fields, zap.Duration("window_age", v.DetectedAt.Sub(v.WindowEnd)))
+		sugar.Infow(msg+" (stale window)", fields...)
+	case len(v.CausedBy) > 0:
+		fields = append(fields, zap.Strings("caused_by", v.CausedBy))
+		sugar.Infow(msg+" (grouped under upstream alert)", fields...)
+	case silenced:
+		fields = append(fields, zap.String("silence_id", silence.ID))
+		sugar.Infow(msg+" (silenced)", fields...)
+	case v.Acknowledgement != nil:
+		fields = append(fields, zap.String("acknowledged_by", v.Acknowledgement.By), zap.String("ack_id", v.Acknowledgement.ID))
+		sugar.Infow(msg+" (acknowledged)", fields...)
+	case v.Severity == SeverityCritical:
+		sugar.Errorw(msg, fields...)
+	case v.Severity == SeverityInfo:
+		sugar.Infow(msg, fields...)
+	default:
+		sugar.Warnw(msg, fields...)
+	}
+	if v.Canary {
+		// Recorded only: canary features never fire alerts nor notify sinks or actions
+		a.metrics.featureCanaryViolations.WithLabelValues(a.series.violationLabel(v), v.CheckType, v.Comparison, v.ModelVersion, v.Severity).Inc()
+		a.recordAudit(sugar, v.FeatureName, v.Payload())
+		a.summary.addViolation(v)
+		return v
+	}
+	if v.Stale {
+		// Recorded only: replayed and backfilled windows must not page for violations
+		// long past, nor open alerts that live windows would then have to resolve
+		a.metrics.featureStaleViolations.WithLabelValues(a.series.violationLabel(v), v.CheckType, v.Comparison, v.ModelVersion, v.Severity).Inc()
+		a.recordAudit(sugar, v.FeatureName, v.Payload())
+		a.summary.addViolation(v)
+		return v
+	}
+	counter := a.metrics.featureThresholdViolations.WithLabelValues(a.series.violationLabel(v), v.CheckType, v.Comparison, v.ModelVersion, v.Severity)
+	if labels := exemplarLabels(v); labels != nil {
+		counter.(prometheus.ExemplarAdder).AddWithExemplar(1, labels)
+	} else {
+		counter.Inc()
+	}
+	telemetry.violations.Add(exemplarContext(context.Background(), v), 1, metric.WithAttributes(attribute.String("check_type", v.CheckType), attribute.String("severity", v.Severity)))
+	a.stats.addViolation(v.FeatureName)
+	alert, started := a.controls.recordAlert(v, silenced)
+	if started {
+		a.metrics.alertTransitions.WithLabelValues("firing", v.Severity).Inc()
+		a.recordAudit(sugar, v.FeatureName, alert.FiringPayload(v.DetectedAt))
+	}
+	if a.sinks != nil {
+		routes := a.router.route(featureCfg, v.Severity)
+		alertContext := a.alertContext(featureCfg, v.FeatureName, v.window)
+		if started {
+			a.sinks.EnqueueFiring(alert.FiringPayload(v.DetectedAt), routes, alertContext)
+		}
+		a.sinks.EnqueueViolation(v, routes, alertContext)
+	}
+	if a.actions != nil && !silenced && v.Acknowledgement == nil && len(v.CausedBy) == 0 {
+		a.actions.Trigger(featureCfg, v)
+	}
+	a.recordAudit(sugar, v.FeatureName, v.Payload())
+	a.summary.addViolation(v)
+	return v
 }
 
-// Helper function to check Standard Deviation thresholds
-func (a *Alerter) checkStdDev(sugar *zap.SugaredLogger, featureName string, windowEnd time.Time, actualStdDev float64, minThreshold, maxThreshold *float64) {
-	if math.IsNaN(actualStdDev) {
+// thresholdKeys maps the check type and comparison of threshold violations to the
+// configuration key of their bound.
+var thresholdKeys = map[string]string{
+	"null_rate>":          "nullRateMax",
+	"missing_rate>":       "missingRateMax",
+	"type_mismatch_rate>": "typeMismatchRateMax",
+	"mean<":               "meanMin",
+	"mean>":               "meanMax",
+	"stddev<":             "stdDevMin",
+	"stddev>":             "stdDevMax",
+	"zero_rate>":          "zeroRateMax",
+	"outlier_rate>":       "outlierRateMax",
+	"distinct<":           "distinctMin",
+	"distinct>":           "distinctMax",
+	"true_rate<":          "trueRateMin",
+	"true_rate>":          "trueRateMax",
+
+	"avg_length<":         "avgLengthMin",
+	"avg_length>":         "avgLengthMax",
+	"max_length>":         "maxLength",
+	"pattern_match_rate<": "patternMatchRateMin",
+
+	"p50>": "p50Max",
+	"p95>": "p95Max",
+	"p99>": "p99Max",
+
+	"norm_mean<":               "normMin",
+	"norm_mean>":               "normMax",
+	"dimension_mismatch_rate>": "dimensionMismatchRateMax",
+	"non_finite_rate>":         "nonFiniteRateMax",
+	"centroid_distance>":       "centroidDistanceMax",
+}
+
+// firingBound reports whether the check bounded by a threshold key has a firing alert for
+// the feature.
+func (a *Alerter) firingBound(featureName, key string) bool {
+	for check, k := range thresholdKeys {
+		if k == key {
+			n := len(check) - 1 // Threshold checks compare with a single character
+			return a.controls.firing(featureName, check[:n], check[n:])
+		}
+	}
+	return false
+}
+
+// escalateCritical makes the threshold violations beyond their critical bound critical,
+// reporting that bound as their threshold.
+func escalateCritical(violations []Violation, critical *config.Thresholds) {
+	if critical == nil {
 		return
 	}
-	if minThreshold != nil && actualStdDev < *minThreshold {
-		sugar.Warnw("StdDev violation (Min)",
-			zap.String("feature_name", featureName),
-			zap.Time("window_end", windowEnd),
-			zap.Float64("actual", actualStdDev),
-			zap.Float64("threshold", *minThreshold),
-			zap.String("comparison", "<"),
+	for i, v := range violations {
+		var bound float64
+		switch key, ok := thresholdKeys[v.CheckType+v.Comparison]; {
+		case v.CheckType == "constant" && critical.ConstantWindows > 0:
+			bound = float64(critical.ConstantWindows)
+		case ok && critical.Bound(key) != nil:
+			bound = *critical.Bound(key)
+		default:
+			continue
+		}
+		breached := v.Actual > bound
+		switch v.Comparison {
+		case "<":
+			breached = v.Actual < bound
+		case ">=":
+			breached = v.Actual >= bound
+		}
+		if breached {
+			violations[i].Severity = SeverityCritical
+			violations[i].Threshold = bound
+		}
+	}
+}
+
+// violationMessages maps check type and comparison to the log message of a violation.
+var violationMessages = map[string]string{
+	"null_rate>":          "Null Rate violation",
+	"missing_rate>":       "Missing Rate violation",
+	"type_mismatch_rate>": "Type mismatch rate violation",
+	"type_mismatch>":      "Type mismatch violation",
+	"mean<":               "Mean violation (Min)",
+	"mean>":               "Mean violation (Max)",
+	"stddev<":             "StdDev violation (Min)",
+	"stddev>":             "StdDev violation (Max)",
+	"zero_rate>":          "Zero Rate violation",
+	"outlier_rate>":       "Outlier rate violation",
+	"constant>=":          "Constant feature violation",
+	"distinct<":           "Distinct values violation (Min)",
+	"distinct>":           "Distinct values violation (Max)",
+	"true_rate<":          "True rate violation (Min)",
+	"true_rate>":          "True rate violation (Max)",
+
+	"avg_length<":         "Average length violation (Min)",
+	"avg_length>":         "Average length violation (Max)",
+	"max_length>":         "Maximum length violation",
+	"pattern_match_rate<": "Pattern match rate violation",
+
+	"p50>": "Latency percentile violation (p50)",
+	"p95>": "Latency percentile violation (p95)",
+	"p99>": "Latency percentile violation (p99)",
+
+	"norm_mean<":               "Vector norm violation (Min)",
+	"norm_mean>":               "Vector norm violation (Max)",
+	"dimension_mismatch_rate>": "Vector dimension mismatch rate violation",
+	"non_finite_rate>":         "Vector non-finite element rate violation",
+	"centroid_distance>":       "Vector centroid distance violation",
+
+	"composite<": "Composite metric violation (Min)",
+	"composite>": "Composite metric violation (Max)",
+
+	"correlation<": "Correlation violation (Min)",
+	"correlation>": "Correlation violation (Max)",
+
+	"latency_mean>": "End-to-end latency violation (mean)",
+	"latency_p95>":  "End-to-end latency violation (p95)",
+
+	"timestamp_future_rate>":       "Future-dated event timestamp rate violation",
+	"timestamp_out_of_order_rate>": "Out-of-order event timestamp rate violation",
+
+	"throughput<":        "Throughput violation (Min)",
+	"throughput>":        "Throughput violation (Max)",
+	"throughput_change<": "Throughput drop violation",
+	"throughput_change>": "Throughput spike violation",
+	"completeness<":      "Partially missing window violation",
+	"window_empty<":      "Empty window violation",
+	"no_data>=":          "No data violation",
+	"schema_change>":     "Message schema change violation",
+
+	"partition_null_rate>":      "Partition null rate imbalance violation",
+	"partition_mean_deviation>": "Partition mean imbalance violation",
+
+	"seasonal_count<":     "Seasonal count drop violation",
+	"seasonal_count>":     "Seasonal count spike violation",
+	"seasonal_null_rate<": "Seasonal null rate drop violation",
+	"seasonal_null_rate>": "Seasonal null rate spike violation",
+	"seasonal_mean<":      "Seasonal mean drop violation",
+	"seasonal_mean>":      "Seasonal mean spike violation",
+
+	"skew_psi>":                "Training/serving skew violation (PSI)",
+	"skew_js_divergence>":      "Training/serving skew violation (JS divergence)",
+	"skew_chi_square_p_value<": "Training/serving skew violation (chi-squared p-value)",
+	"skew_mean_delta>":         "Training/serving skew violation (mean delta)",
+}
+
+// violationMessage returns the log message for a violation.
+func violationMessage(v Violation) string {
+	if strings.HasPrefix(v.CheckType, conditionCheckPrefix) {
+		return "Condition violation"
+	}
+	if strings.HasPrefix(v.CheckType, consumerLagCheckPrefix) {
+		return "Consumer lag violation"
+	}
+	if strings.HasPrefix(v.CheckType, customCheckPrefix) {
+		return "Custom check violation"
+	}
+	if msg, ok := violationMessages[v.CheckType+v.Comparison]; ok {
+		return msg
+	}
+	return fmt.Sprintf("%s violation (%s)", v.CheckType, v.Comparison)
+}
+
+// violatingAncestors returns the upstream features that violated in the violation's window.
+func (a *Alerter) violatingAncestors(v Violation) []string {
+	var causes []string
+	for _, ancestor := range a.graph.ancestors(unversionedName(v.FeatureName, v.ModelVersion)) {
+		ancestor = versionedName(ancestor, v.ModelVersion) // Only the same model version's upstream violations count
+		if last, ok := a.lastViolationWindow[ancestor]; ok && last.Equal(v.WindowEnd) {
+			causes = append(causes, ancestor)
+		}
+	}
+	return causes
+}
+
+// auditFields returns the signed audit record fields for a violation, or nothing if signing is disabled.
+func (a *Alerter) auditFields(sugar *zap.SugaredLogger, v Violation) []interface{} {
+	if a.signer == nil {
+		return nil
+	}
+	envelope, err := signing.Seal(a.signer, v.Payload())
+	if err != nil {
+		sugar.Errorw("Failed to sign violation audit record",
+			logging.Feature(v.FeatureName),
+			zap.Error(err),
 		)
-		featureThresholdViolations.WithLabelValues(featureName, "stddev", "<").Inc()
-	}
-	if maxThreshold != nil && actualStdDev > *maxThreshold {
-		sugar.Warnw("StdDev violation (Max)",
-			zap.String("feature_name", featureName),
-			zap.Time("window_end", windowEnd),
-			zap.Float64("actual", actualStdDev),
-			zap.Float64("threshold", *maxThreshold),
-			zap.String("comparison", ">"),
+		a.reporter.Report(&OpError{Component: ComponentAudit, Op: "sign", Severity: ErrorSeverityError, Err: err})
+		return nil
+	}
+	return []interface{}{
+		zap.ByteString("audit_record", envelope.Payload),
+		zap.String("signature", envelope.Signature.Value),
+		zap.String("signature_algorithm", envelope.Signature.Algorithm),
+		zap.String("signature_key_id", envelope.Signature.KeyID),
+	}
+}
+
+// recordAudit appends a violation or alert resolution payload to the audit trail, if enabled.
+func (a *Alerter) recordAudit(sugar *zap.SugaredLogger, featureName string, payload interface{}) {
+	if a.trail == nil {
+		return
+	}
+	if err := a.trail.Record(payload); err != nil {
+		a.metrics.auditWriteFailures.Inc()
+		sugar.Errorw("Failed to write audit record",
+			logging.Feature(featureName),
+			zap.Error(err),
 		)
-		featureThresholdViolations.WithLabelValues(featureName, "stddev", ">").Inc()
+		a.reporter.Report(&OpError{Component: ComponentAudit, Op: "write", Severity: ErrorSeverityError, Err: err})
 	}
 }
 
+// approachingThresholds reports whether any statistic is beyond or within the feature's
+// sampling approach margin of a configured threshold.
+func approachingThresholds(featureCfg config.FeatureConfig, nullRate, missingRate, typeMismatchRate, mean, stdDev float64) bool {
+	t := featureCfg.Thresholds
+	margin := featureCfg.Sampling.ApproachMargin
+	return approachingUpper(nullRate, t.NullRate, margin) || approachingUpper(missingRate, t.MissingRate, margin) ||
+		approachingUpper(typeMismatchRate, t.TypeMismatchRate, margin) ||
+		approachingLower(mean, t.MeanMin, margin) || approachingUpper(mean, t.MeanMax, margin) ||
+		approachingLower(stdDev, t.StdDevMin, margin) || approachingUpper(stdDev, t.StdDevMax, margin)
+}
+
+// approachingTextThresholds is approachingThresholds for string value statistics.
+func approachingTextThresholds(featureCfg config.FeatureConfig, text *TextStats) bool {
+	if text == nil {
+		return false
+	}
+	t := featureCfg.Thresholds
+	margin := featureCfg.Sampling.ApproachMargin
+	return approachingLower(text.AvgLength, t.AvgLengthMin, margin) || approachingUpper(text.AvgLength, t.AvgLengthMax, margin) ||
+		approachingUpper(float64(text.MaxLength), t.MaxLength, margin) ||
+		approachingLower(text.PatternMatchRate, t.PatternMatchRateMin, margin)
+}
+
+// approachingVectorThresholds is approachingThresholds for vector statistics.
+func approachingVectorThresholds(featureCfg config.FeatureConfig, vec *VectorStats) bool {
+	if vec == nil {
+		return false
+	}
+	t := featureCfg.Thresholds
+	margin := featureCfg.Sampling.ApproachMargin
+	return approachingLower(vec.NormMean, t.NormMin, margin) || approachingUpper(vec.NormMean, t.NormMax, margin) ||
+		approachingUpper(vec.dimensionMismatchRate(), t.DimensionMismatchRateMax, margin) ||
+		approachingUpper(vec.NonFiniteRate, t.NonFiniteRateMax, margin) ||
+		approachingUpper(vec.CentroidDistance, t.CentroidDistanceMax, margin)
+}
+
+// approachingPercentileThresholds is approachingThresholds for latency percentiles.
+func approachingPercentileThresholds(featureCfg config.FeatureConfig, p *Percentiles) bool {
+	if p == nil {
+		return false
+	}
+	t := featureCfg.Thresholds
+	margin := featureCfg.Sampling.ApproachMargin
+	return approachingUpper(p.P50, t.P50Max, margin) || approachingUpper(p.P95, t.P95Max, margin) ||
+		approachingUpper(p.P99, t.P99Max, margin)
+}
+
 // Helper function to log calculated statistics
-func (a *Alerter) logStats(sugar *zap.SugaredLogger, result AggregationResult, nullRate, stdDev float64) {
+func (a *Alerter) logStats(sugar *zap.SugaredLogger, result AggregationResult, nullRate, missingRate, stdDev float64) {
 	fields := []interface{}{
-		zap.String("feature_name", result.FeatureName),
-		zap.Time("window_end", result.WindowEnd),
+		logging.Feature(result.FeatureName),
+		logging.WindowEnd(result.WindowEnd),
 		zap.Int64("count", result.Count),
 	}
+	if result.SampledOut > 0 {
+		fields = append(fields, zap.Int64("sampled_out", result.SampledOut))
+	}
 	if !math.IsNaN(nullRate) {
 		fields = append(fields, zap.Float64("null_rate", nullRate))
 	}
+	if !math.IsNaN(missingRate) {
+		fields = append(fields, zap.Float64("missing_rate", missingRate))
+	}
+	if result.TypeMismatchCount > 0 {
+		fields = append(fields, zap.Int64("type_mismatch_count", result.TypeMismatchCount))
+	}
 	if !math.IsNaN(result.Mean) {
 		fields = append(fields, zap.Float64("mean", result.Mean))
 	}
 	if !math.IsNaN(stdDev) {
 		fields = append(fields, zap.Float64("stddev", stdDev))
 	}
+	if zeroRate := result.zeroRate(); !math.IsNaN(zeroRate) {
+		fields = append(fields, zap.Float64("zero_rate", zeroRate))
+	}
+	if outliers := result.Outliers; outliers != nil {
+		fields = append(fields, zap.Int64("outlier_count", outliers.Count), zap.Float64("outlier_rate", outliers.Rate))
+	}
+	if trueRate := result.booleanRate(result.TrueCount); !math.IsNaN(trueRate) {
+		fields = append(fields, zap.Float64("true_rate", trueRate), zap.Float64("false_rate", result.booleanRate(result.FalseCount)))
+	}
+	if !math.IsNaN(result.DistinctEstimate) {
+		fields = append(fields, zap.Float64("distinct_estimate", result.DistinctEstimate))
+	}
+	if result.Categories != nil {
+		fields = append(fields,
+			zap.Int("distinct_values", len(result.Categories)),
+			zap.Strings("top_categories", topCategories(result.Categories, logTopCategories)),
+		)
+	}
+	if text := result.Text; text != nil {
+		fields = append(fields, zap.Float64("avg_length", text.AvgLength), zap.Int64("max_length", text.MaxLength))
+		if !math.IsNaN(text.PatternMatchRate) {
+			fields = append(fields, zap.Float64("pattern_match_rate", text.PatternMatchRate))
+		}
+	}
+	if p := result.Percentiles; p != nil {
+		fields = append(fields, zap.Float64("p50", p.P50), zap.Float64("p95", p.P95), zap.Float64("p99", p.P99))
+	}
+	if vec := result.Vector; vec != nil {
+		fields = append(fields, zap.Int("dimensions", vec.Dimensions), zap.Float64("dimension_mismatch_rate", vec.dimensionMismatchRate()))
+		for _, f := range []struct {
+			key   string
+			value float64
+		}{{"non_finite_rate", vec.NonFiniteRate}, {"norm_mean", vec.NormMean}, {"norm_stddev", vec.NormStdDev}, {"centroid_distance", vec.CentroidDistance}} {
+			if !math.IsNaN(f.value) {
+				fields = append(fields, zap.Float64(f.key, f.value))
+			}
+		}
+	}
 
 	sugar.Infow("Feature stats processed", fields...)
 }
+
+// topCategories returns up to k category values ordered by descending frequency.
+func topCategories(categories map[string]int64, k int) []string {
+	values := make([]string, 0, len(categories))
+	for value := range categories {
+		values = append(values, value)
+	}
+	sort.Slice(values, func(i, j int) bool {
+		if categories[values[i]] != categories[values[j]] {
+			return categories[values[i]] > categories[values[j]]
+		}
+		return values[i] < values[j]
+	})
+	if len(values) > k {
+		values = values[:k]
+	}
+	return values
+}
@@ -0,0 +1,194 @@
+package pipeline
+
+import (
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/sanspareilsmyn/featurelens/internal/config"
+	"github.com/sanspareilsmyn/featurelens/internal/expr"
+	"github.com/sanspareilsmyn/featurelens/internal/logging"
+)
+
+// compositeCheckType is the check type of composite metric violations, which are
+// reported against the metric's name.
+const compositeCheckType = "composite"
+
+// compositeWindowsKept is the number of recent windows buffered while waiting for the
+// results of every feature a composite metric references.
+const compositeWindowsKept = 2
+
+type compiledComposite struct {
+	cfg      config.CompositeMetricConfig
+	expr     *expr.Expr
+	features []string // Features referenced by the expression
+}
+
+// compositeWindow collects the statistics of one window's features.
+type compositeWindow struct {
+	start     time.Time
+	end       time.Time
+	envs      compositeEnv
+	evaluated []bool // Indexed like Alerter.composites
+}
+
+// compositeEnv resolves <feature>.<variable> identifiers against per-feature window statistics.
+type compositeEnv map[string]expr.MapEnv
+
+func (e compositeEnv) Lookup(name string) (any, bool) {
+	feature, variable, ok := splitCompositeIdent(name)
+	if !ok {
+		return nil, false
+	}
+	env, ok := e[feature]
+	if !ok {
+		return nil, false
+	}
+	return env.Lookup(variable)
+}
+
+// splitCompositeIdent splits at the last dot, so feature names may contain dots.
+func splitCompositeIdent(ident string) (feature, variable string, ok bool) {
+	i := strings.LastIndexByte(ident, '.')
+	if i <= 0 || i == len(ident)-1 {
+		return "", "", false
+	}
+	return ident[:i], ident[i+1:], true
+}
+
+// compileComposites compiles the configured composite metrics.
+// Expressions are validated at config load, so compile errors here are only logged.
+func compileComposites(metrics []config.CompositeMetricConfig, logger *zap.Logger) []compiledComposite {
+	compiled := make([]compiledComposite, 0, len(metrics))
+	for _, m := range metrics {
+		e, err := expr.Compile(m.Expr)
+		if err != nil {
+			logger.Error("Skipping invalid composite metric", zap.String("metric", m.Name), zap.Error(err))
+			continue
+		}
+		var features []string
+		for _, ident := range e.Identifiers() {
+			feature, variable, ok := splitCompositeIdent(ident)
+			if !ok {
+				logger.Warn("Composite metric references a malformed variable, it will evaluate to null",
+					zap.String("metric", m.Name),
+					zap.String("variable", ident),
+				)
+				continue
+			}
+			if !slices.Contains(conditionVariables, variable) {
+				logger.Warn("Composite metric references unknown variable, it will evaluate to null",
+					zap.String("metric", m.Name),
+					zap.String("variable", ident),
+					zap.Strings("known_variables", conditionVariables),
+				)
+			}
+			if !slices.Contains(features, feature) {
+				features = append(features, feature)
+			}
+		}
+		compiled = append(compiled, compiledComposite{cfg: m, expr: e, features: features})
+	}
+	return compiled
+}
+
+// observeComposites records a feature's window statistics and evaluates every composite
+// metric whose referenced features have all reported for that window.
+func (a *Alerter) observeComposites(sugar *zap.SugaredLogger, result AggregationResult, env expr.MapEnv) {
+	if len(a.composites) == 0 {
+		return
+	}
+	key := result.WindowEnd.UnixNano()
+	w, ok := a.compositeWindows[key]
+	if !ok {
+		w = &compositeWindow{
+			start:     result.WindowStart,
+			end:       result.WindowEnd,
+			envs:      make(compositeEnv),
+			evaluated: make([]bool, len(a.composites)),
+		}
+		a.compositeWindows[key] = w
+		a.evictCompositeWindows(sugar)
+	}
+	w.envs[result.FeatureName] = env
+
+	for i, c := range a.composites {
+		if w.evaluated[i] {
+			continue
+		}
+		complete := true
+		for _, f := range c.features {
+			if _, ok := w.envs[f]; !ok {
+				complete = false
+				break
+			}
+		}
+		if !complete {
+			continue
+		}
+		w.evaluated[i] = true
+		a.evaluateComposite(sugar, c, w)
+	}
+}
+
+// evictCompositeWindows drops the oldest buffered windows beyond compositeWindowsKept.
+// Metrics never evaluated in a dropped window had a referenced feature without data.
+func (a *Alerter) evictCompositeWindows(sugar *zap.SugaredLogger) {
+	for len(a.compositeWindows) > compositeWindowsKept {
+		var oldest int64 = math.MaxInt64
+		for key := range a.compositeWindows {
+			oldest = min(oldest, key)
+		}
+		w := a.compositeWindows[oldest]
+		delete(a.compositeWindows, oldest)
+		for i, c := range a.composites {
+			if !w.evaluated[i] {
+				sugar.Debugw("Composite metric not evaluated, a referenced feature reported no window",
+					zap.String("metric", c.cfg.Name),
+					logging.WindowEnd(w.end),
+				)
+			}
+		}
+	}
+}
+
+// evaluateComposite computes a composite metric for a window, exports it and reports
+// violations of its bounds against the metric's name.
+func (a *Alerter) evaluateComposite(sugar *zap.SugaredLogger, c compiledComposite, w *compositeWindow) {
+	value, ok, err := c.expr.EvalFloat(w.envs)
+	if err != nil {
+		sugar.Warnw("Failed to evaluate composite metric",
+			zap.String("metric", c.cfg.Name),
+			logging.WindowEnd(w.end),
+			zap.Error(err),
+		)
+		return
+	}
+	if !ok || math.IsNaN(value) || math.IsInf(value, 0) {
+		sugar.Debugw("Composite metric is undefined for window",
+			zap.String("metric", c.cfg.Name),
+			logging.WindowEnd(w.end),
+		)
+		return
+	}
+	a.metrics.compositeMetricValue.WithLabelValues(c.cfg.Name).Set(value)
+
+	metric := AggregationResult{FeatureName: c.cfg.Name, WindowStart: w.start, WindowEnd: w.end}
+	metricCfg := config.FeatureConfig{
+		Name: c.cfg.Name,
+		Tags: map[string]string{"source": "composite"},
+	}
+	for _, v := range checkRange(metric, compositeCheckType, value, c.cfg.Min, c.cfg.Max) {
+		v.Expression = c.expr.String()
+		a.reportViolation(sugar, metricCfg, v)
+	}
+
+	sugar.Debugw("Composite metric evaluated",
+		zap.String("metric", c.cfg.Name),
+		logging.WindowEnd(w.end),
+		zap.Float64("value", value),
+	)
+}
@@ -0,0 +1,251 @@
+package pipeline
+
+import (
+	"math"
+	"slices"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/sanspareilsmyn/featurelens/internal/config"
+	"github.com/sanspareilsmyn/featurelens/internal/expr"
+	"github.com/sanspareilsmyn/featurelens/internal/logging"
+	"github.com/sanspareilsmyn/featurelens/internal/schema"
+)
+
+// conditionCheckPrefix prefixes the check type of violations raised by composite conditions.
+const conditionCheckPrefix = "condition:"
+
+// Prefixes of the past window statistics condition expressions may reference, e.g.
+// prev_mean or `abs(mean - seasonal_mean) > 0.1 * seasonal_mean`.
+const (
+	prevPrefix     = "prev_"     // The feature's previous window
+	baselinePrefix = "baseline_" // Its last window without violations, the baseline of explanations
+	seasonalPrefix = "seasonal_" // Its windows seasonal.periods earlier, averaged over the periods
+)
+
+// pastVariables lists the statistics of past windows conditions may reference, prefixed
+// with the window they come from.
+var pastVariables = []string{"count", "null_rate", "missing_rate", "type_mismatch_rate", "zero_rate", "true_rate",
+	"mean", "variance", "stddev", "distinct_estimate", "p50", "p95", "p99"}
+
+// conditionVariables lists the window statistics that condition expressions may reference.
+var conditionVariables = append([]string{"count", "null_count", "missing_count", "valid_count", "null_rate", "missing_rate", "mean", "variance", "stddev",
+	"type_mismatch_count", "type_mismatch_rate", "distinct_estimate",
+	"zero_count", "zero_rate", "outlier_count", "outlier_rate", "avg_length", "max_length", "pattern_match_rate",
+	"true_count", "false_count", "true_rate", "false_rate",
+	"norm_mean", "norm_stddev", "dimension_mismatch_rate", "non_finite_rate", "centroid_distance", "p50", "p95", "p99"},
+	prefixedVariables(prevPrefix, baselinePrefix, seasonalPrefix)...)
+
+func prefixedVariables(prefixes ...string) []string {
+	var names []string
+	for _, prefix := range prefixes {
+		for _, name := range pastVariables {
+			names = append(names, prefix+name)
+		}
+	}
+	return names
+}
+
+type compiledCondition struct {
+	name string
+	expr *expr.Expr
+	past []string // Prefixes of the past windows it references
+}
+
+// compileConditions compiles the composite conditions of a feature.
+// Expressions are validated at config load, so compile errors here are only logged.
+func compileConditions(f config.FeatureConfig, logger *zap.Logger) []compiledCondition {
+	compiled := make([]compiledCondition, 0, len(f.Conditions))
+	for _, cond := range f.Conditions {
+		e, err := expr.Compile(cond.Expr)
+		if err != nil {
+			logger.Error("Skipping invalid condition",
+				logging.Feature(f.Name),
+				zap.String("condition", cond.Name),
+				zap.Error(err),
+			)
+			continue
+		}
+		idents := e.Identifiers()
+		for _, ident := range idents {
+			if !slices.Contains(conditionVariables, ident) && !slices.ContainsFunc(f.CustomMetrics, func(m config.ExtensionConfig) bool { return m.ExtensionName() == ident }) {
+				logger.Warn("Condition references unknown variable, it will evaluate to null",
+					logging.Feature(f.Name),
+					zap.String("condition", cond.Name),
+					zap.String("variable", ident),
+					zap.Strings("known_variables", conditionVariables),
+				)
+			}
+		}
+		c := compiledCondition{name: cond.Name, expr: e}
+		for _, prefix := range []string{prevPrefix, baselinePrefix, seasonalPrefix} {
+			if slices.ContainsFunc(idents, func(ident string) bool { return strings.HasPrefix(ident, prefix) }) {
+				c.past = append(c.past, prefix)
+			}
+		}
+		compiled = append(compiled, c)
+	}
+	return compiled
+}
+
+// resultEnv exposes a window's statistics to condition expressions. NaN values become null.
+func resultEnv(result AggregationResult, nullRate, missingRate, stdDev float64) expr.MapEnv {
+	env := expr.MapEnv{
+		"count":         float64(result.Count),
+		"null_count":    float64(result.NullCount),
+		"missing_count": float64(result.MissingCount),
+		"valid_count":   float64(result.ValidCount()),
+
+		"type_mismatch_count": float64(result.TypeMismatchCount),
+	}
+	setIfNumber(env, "type_mismatch_rate", result.rate(result.TypeMismatchCount))
+	setIfNumber(env, "null_rate", nullRate)
+	setIfNumber(env, "missing_rate", missingRate)
+	setIfNumber(env, "mean", result.Mean)
+	setIfNumber(env, "variance", result.Variance)
+	setIfNumber(env, "stddev", stdDev)
+	setIfNumber(env, "distinct_estimate", result.DistinctEstimate)
+	if result.ValueCount > 0 {
+		env["zero_count"] = float64(result.ZeroCount)
+		env["zero_rate"] = result.zeroRate()
+	}
+	if n := result.TrueCount + result.FalseCount; n > 0 {
+		env["true_count"], env["false_count"] = float64(result.TrueCount), float64(result.FalseCount)
+		env["true_rate"], env["false_rate"] = result.booleanRate(result.TrueCount), result.booleanRate(result.FalseCount)
+	}
+	if outliers := result.Outliers; outliers != nil {
+		env["outlier_count"] = float64(outliers.Count)
+		env["outlier_rate"] = outliers.Rate
+	}
+	if text := result.Text; text != nil {
+		env["avg_length"] = text.AvgLength
+		env["max_length"] = float64(text.MaxLength)
+		setIfNumber(env, "pattern_match_rate", text.PatternMatchRate)
+	}
+	if p := result.Percentiles; p != nil {
+		env["p50"], env["p95"], env["p99"] = p.P50, p.P95, p.P99
+	}
+	if vec := result.Vector; vec != nil {
+		env["dimension_mismatch_rate"] = vec.dimensionMismatchRate()
+		setIfNumber(env, "non_finite_rate", vec.NonFiniteRate)
+		setIfNumber(env, "norm_mean", vec.NormMean)
+		setIfNumber(env, "norm_stddev", vec.NormStdDev)
+		setIfNumber(env, "centroid_distance", vec.CentroidDistance)
+	}
+	for name, v := range result.Custom {
+		env[name] = v
+	}
+	return env
+}
+
+func setIfNumber(env expr.MapEnv, name string, v float64) {
+	if !math.IsNaN(v) {
+		env[name] = v
+	}
+}
+
+// setPastWindows exposes the statistics of a window's past windows referenced by its
+// conditions, under the prefixes of pastVariables. Statistics of windows the feature
+// does not have yet are left unset, so they evaluate to null and conditions on them do
+// not hold.
+func (a *Alerter) setPastWindows(env expr.MapEnv, featureCfg config.FeatureConfig, result AggregationResult, conditions []compiledCondition) {
+	var prefixes []string
+	for _, c := range conditions {
+		for _, prefix := range c.past {
+			if !slices.Contains(prefixes, prefix) {
+				prefixes = append(prefixes, prefix)
+			}
+		}
+	}
+	for _, prefix := range prefixes {
+		var windows []schema.AggregationResult
+		switch prefix {
+		case prevPrefix: // Not yet holding this window, stored once checked
+			if records, _ := a.recent.History(result.FeatureName, 1); len(records) > 0 {
+				windows = append(windows, records[0].Result)
+			}
+		case baselinePrefix:
+			if baseline, ok := a.lastHealthy[result.FeatureName]; ok {
+				windows = append(windows, baseline.Payload())
+			}
+		case seasonalPrefix:
+			for _, period := range featureCfg.Seasonal.Periods {
+				if past, ok := a.pastWindow(result.FeatureName, result.WindowEnd.Add(-period)); ok {
+					windows = append(windows, past)
+				}
+			}
+		}
+		for name, v := range averageStatistics(windows) {
+			env[prefix+name] = v
+		}
+	}
+}
+
+// averageStatistics returns the pastVariables of windows, each averaged over the windows
+// that have it.
+func averageStatistics(windows []schema.AggregationResult) map[string]float64 {
+	sums := make(map[string]float64, len(pastVariables))
+	counts := make(map[string]int, len(pastVariables))
+	add := func(name string, v *float64) {
+		if v != nil && !math.IsNaN(*v) {
+			sums[name] += *v
+			counts[name]++
+		}
+	}
+	for _, w := range windows {
+		count := float64(w.Count)
+		add("count", &count)
+		add("null_rate", w.NullRate)
+		add("missing_rate", w.MissingRate)
+		add("type_mismatch_rate", w.TypeMismatchRate)
+		add("zero_rate", w.ZeroRate)
+		add("true_rate", w.TrueRate)
+		add("mean", w.Mean)
+		add("variance", w.Variance)
+		add("stddev", w.StdDev)
+		if w.DistinctEstimate != nil {
+			distinct := float64(*w.DistinctEstimate)
+			add("distinct_estimate", &distinct)
+		}
+		if p := w.Percentiles; p != nil {
+			add("p50", &p.P50)
+			add("p95", &p.P95)
+			add("p99", &p.P99)
+		}
+	}
+	for name, sum := range sums {
+		sums[name] = sum / float64(counts[name])
+	}
+	return sums
+}
+
+// checkConditions evaluates the feature's composite conditions and returns violations for those that hold.
+func (a *Alerter) checkConditions(sugar *zap.SugaredLogger, featureCfg config.FeatureConfig, result AggregationResult, env expr.MapEnv) []Violation {
+	conditions, compiled := a.conditions[featureCfg.Name]
+	if !compiled {
+		conditions = compileConditions(featureCfg, a.logger)
+		a.conditions[featureCfg.Name] = conditions
+	}
+	a.setPastWindows(env, featureCfg, result, conditions)
+	var violations []Violation
+	for _, cond := range conditions {
+		matched, err := cond.expr.EvalBool(env)
+		if err != nil {
+			sugar.Warnw("Failed to evaluate condition",
+				logging.Feature(result.FeatureName),
+				zap.String("condition", cond.name),
+				zap.Error(err),
+			)
+			continue
+		}
+		if !matched {
+			continue
+		}
+		// Conditions have no single actual/threshold pair: actual is 1 when the expression held.
+		v := newViolation(result, conditionCheckPrefix+cond.name, "expr", 1, 0)
+		v.Expression = cond.expr.String()
+		violations = append(violations, v)
+	}
+	return violations
+}
@@ -0,0 +1,45 @@
+package pipeline
+
+import (
+	"math"
+
+	"go.uber.org/zap"
+
+	"github.com/sanspareilsmyn/featurelens/internal/config"
+	"github.com/sanspareilsmyn/featurelens/internal/logging"
+)
+
+// processCorrelation exports a window's correlation and reports it when it leaves its
+// bounds. Violations are reported against the correlation's name, tagged
+// source=correlation, like composite metrics.
+func (a *Alerter) processCorrelation(sugar *zap.SugaredLogger, result CorrelationResult) {
+	cfg := result.Config
+	if math.IsNaN(result.Coefficient) {
+		sugar.Debugw("Correlation is undefined for window",
+			zap.String("correlation", cfg.Name),
+			logging.WindowEnd(result.WindowEnd),
+			zap.Int64("count", result.Count),
+		)
+		return
+	}
+	a.metrics.correlationCoefficient.WithLabelValues(cfg.Name).Set(result.Coefficient)
+
+	if result.Count >= int64(cfg.MinCount) {
+		metricCfg := config.FeatureConfig{
+			Name: cfg.Name,
+			Tags: map[string]string{"source": "correlation"},
+		}
+		window := AggregationResult{FeatureName: cfg.Name, WindowStart: result.WindowStart, WindowEnd: result.WindowEnd}
+		for _, v := range checkRange(window, "correlation", result.Coefficient, cfg.Min, cfg.Max) {
+			a.reportViolation(sugar, metricCfg, v)
+		}
+	}
+
+	sugar.Debugw("Correlation observed",
+		zap.String("correlation", cfg.Name),
+		zap.Strings("features", cfg.Features),
+		logging.WindowEnd(result.WindowEnd),
+		zap.Int64("count", result.Count),
+		zap.Float64("coefficient", result.Coefficient),
+	)
+}
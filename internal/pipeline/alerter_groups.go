@@ -0,0 +1,39 @@
+package pipeline
+
+import (
+	"math"
+	"strings"
+
+	"github.com/sanspareilsmyn/featurelens/internal/config"
+)
+
+// segmentConfig returns the configuration a segment's result is checked against: the
+// feature's, named after the result, with the group's thresholds if it has its own.
+// Group names are matched case-insensitively, as config map keys are lowercased.
+func segmentConfig(featureCfg config.FeatureConfig, result AggregationResult) config.FeatureConfig {
+	segment := result.Segment
+	featureCfg.Name = result.FeatureName
+	if thresholds, ok := featureCfg.GroupThresholds[strings.ToLower(segment.Group)]; ok {
+		featureCfg.Thresholds = thresholds
+	}
+	return featureCfg
+}
+
+// setSegmentGauges exports a segment's window statistics on the per-group gauges, under
+// the feature and group label values given by the series limiter.
+func (m *Metrics) setSegmentGauges(feature, group string, result AggregationResult, nullRate, missingRate, stdDev float64) {
+	labels := []string{feature, result.Segment.GroupBy, group, result.ModelVersion}
+	m.groupCount.WithLabelValues(labels...).Set(float64(result.Count))
+	m.groupNullRate.WithLabelValues(labels...).Set(zeroIfNaN(nullRate))
+	m.groupMissingRate.WithLabelValues(labels...).Set(zeroIfNaN(missingRate))
+	m.groupMean.WithLabelValues(labels...).Set(zeroIfNaN(result.Mean))
+	m.groupStdDev.WithLabelValues(labels...).Set(zeroIfNaN(stdDev))
+}
+
+// zeroIfNaN reports undefined statistics as 0, like the per-feature gauges.
+func zeroIfNaN(v float64) float64 {
+	if math.IsNaN(v) {
+		return 0
+	}
+	return v
+}
@@ -0,0 +1,51 @@
+package pipeline
+
+import (
+	"strconv"
+
+	"go.uber.org/zap"
+
+	"github.com/sanspareilsmyn/featurelens/internal/config"
+)
+
+// consumerLagCheckPrefix prefixes the check type of lag violations, followed by the partition.
+const consumerLagCheckPrefix = "consumer_lag:"
+
+// processLag exports per-partition lag gauges and reports partitions beyond the lag threshold.
+// Lag violations are reported against the topic, tagged source=kafka and topic=<topic>
+// so they can be silenced or re-prioritized through the admin API like features.
+func (a *Alerter) processLag(sugar *zap.SugaredLogger, result LagResult) {
+	var total int64
+	for _, p := range result.Partitions {
+		a.metrics.consumerPartitionLag.WithLabelValues(result.Topic, strconv.Itoa(p.Partition)).Set(float64(p.Lag))
+		total += p.Lag
+	}
+
+	if a.lagThreshold > 0 {
+		topicCfg := config.FeatureConfig{
+			Name: result.Topic,
+			Tags: map[string]string{"source": "kafka", "topic": result.Topic},
+		}
+		for _, p := range result.Partitions {
+			if p.Lag <= a.lagThreshold {
+				continue
+			}
+			a.reportViolation(sugar, topicCfg, Violation{
+				FeatureName: result.Topic,
+				CheckType:   consumerLagCheckPrefix + strconv.Itoa(p.Partition),
+				Comparison:  ">",
+				Actual:      float64(p.Lag),
+				Threshold:   float64(a.lagThreshold),
+				WindowStart: result.Since,
+				WindowEnd:   result.ObservedAt,
+				DetectedAt:  result.ObservedAt,
+			})
+		}
+	}
+
+	sugar.Debugw("Consumer lag observed",
+		zap.String("topic", result.Topic),
+		zap.Int("partitions", len(result.Partitions)),
+		zap.Int64("total_lag", total),
+	)
+}
@@ -0,0 +1,23 @@
+package pipeline
+
+import (
+	"go.uber.org/zap"
+
+	"github.com/sanspareilsmyn/featurelens/internal/logging"
+)
+
+// processLateResult delivers a re-emitted window, or a window's late bucket, to the sinks
+// only. Checks, gauges, history and remote write keep the window's first emission: its
+// alerts already fired or resolved, and a series sample cannot be rewritten in place.
+func (a *Alerter) processLateResult(sugar *zap.SugaredLogger, result AggregationResult) {
+	if a.sinks != nil {
+		a.sinks.EnqueueResult(result)
+	}
+	sugar.Infow("Late messages aggregated",
+		logging.Feature(result.FeatureName),
+		logging.WindowEnd(result.WindowEnd),
+		zap.Int("revision", result.Revision),
+		zap.Bool("late", result.Late),
+		zap.Int64("count", result.Count),
+	)
+}
@@ -0,0 +1,44 @@
+package pipeline
+
+import (
+	"go.uber.org/zap"
+
+	"github.com/sanspareilsmyn/featurelens/internal/config"
+	"github.com/sanspareilsmyn/featurelens/internal/logging"
+)
+
+// processLatency exports a window's end-to-end latency and reports it when the mean or
+// p95 exceeds its threshold, or when too many event timestamps are future-dated or out
+// of order (upstream clock skew, which breaks point-in-time joins). Latency violations are reported against the timestamp
+// field, tagged source=latency, so stale data alerts even when feature values look fine.
+func (a *Alerter) processLatency(sugar *zap.SugaredLogger, result LatencyResult) {
+	a.metrics.eventLatency.WithLabelValues("mean").Set(result.Mean)
+	a.metrics.eventLatency.WithLabelValues("p95").Set(result.P95)
+	a.metrics.eventLatency.WithLabelValues("max").Set(result.Max)
+	a.metrics.eventTimestampRate.WithLabelValues("future").Set(result.rate(result.Future))
+	a.metrics.eventTimestampRate.WithLabelValues("out_of_order").Set(result.rate(result.OutOfOrder))
+
+	fieldCfg := config.FeatureConfig{
+		Name: result.TimestampField,
+		Tags: map[string]string{"source": "latency"},
+	}
+	window := AggregationResult{FeatureName: result.TimestampField, WindowStart: result.WindowStart, WindowEnd: result.WindowEnd}
+	violations := checkRange(window, "latency_mean", result.Mean, nil, a.latencyCfg.MeanMax)
+	violations = append(violations, checkRange(window, "latency_p95", result.P95, nil, a.latencyCfg.P95Max)...)
+	violations = append(violations, checkRange(window, "timestamp_future_rate", result.rate(result.Future), nil, a.latencyCfg.FutureRateMax)...)
+	violations = append(violations, checkRange(window, "timestamp_out_of_order_rate", result.rate(result.OutOfOrder), nil, a.latencyCfg.OutOfOrderRateMax)...)
+	for _, v := range violations {
+		a.reportViolation(sugar, fieldCfg, v)
+	}
+
+	sugar.Debugw("End-to-end latency observed",
+		zap.String("timestamp_field", result.TimestampField),
+		logging.WindowEnd(result.WindowEnd),
+		zap.Int64("count", result.Count),
+		zap.Float64("mean_seconds", result.Mean),
+		zap.Float64("p95_seconds", result.P95),
+		zap.Float64("max_seconds", result.Max),
+		zap.Int64("future", result.Future),
+		zap.Int64("out_of_order", result.OutOfOrder),
+	)
+}
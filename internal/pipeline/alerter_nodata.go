@@ -0,0 +1,86 @@
+package pipeline
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/sanspareilsmyn/featurelens/internal/config"
+)
+
+// noDataChecked reports whether any feature, or the pipeline, alerts on missing data,
+// which is checked on every completed window like throughput.
+func noDataChecked(cfg *config.Config) bool {
+	if cfg.Pipeline.Throughput.NoDataWindows > 0 {
+		return true
+	}
+	for _, f := range cfg.Features {
+		if f.NoDataWindows > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// observeData records that a feature's window held non-null observations, ending its
+// run of windows without data. Segments and model versions count for their feature.
+func (a *Alerter) observeData(result AggregationResult) {
+	if result.ValidCount() == 0 {
+		return
+	}
+	name := result.configName()
+	if result.WindowEnd.After(a.lastData[name]) {
+		a.lastData[name] = result.WindowEnd
+	}
+	delete(a.noDataReported, name)
+}
+
+// processNoData checks a completed window for missing data: the pipeline's run of
+// windows without any message, and each feature's windows without observations.
+func (a *Alerter) processNoData(sugar *zap.SugaredLogger, result ThroughputResult) {
+	if result.Count == 0 {
+		a.emptyWindows++
+	} else {
+		a.emptyWindows = 0
+	}
+	a.metrics.noDataWindows.Set(float64(a.emptyWindows))
+	if n := a.throughputCfg.NoDataWindows; n > 0 && a.emptyWindows >= n {
+		window := AggregationResult{FeatureName: a.topic, WindowStart: result.WindowStart, WindowEnd: result.WindowEnd}
+		topicCfg := config.FeatureConfig{
+			Name: a.topic,
+			Tags: map[string]string{"source": "throughput", "topic": a.topic},
+		}
+		a.reportViolation(sugar, topicCfg, newViolation(window, "no_data", ">=", float64(a.emptyWindows), float64(n)))
+	}
+	// The window's feature results travel on their own channel and may not have been
+	// processed yet, so features are checked as of the previous window.
+	a.checkNoData(sugar, result.WindowStart, result.WindowEnd.Sub(result.WindowStart))
+}
+
+// checkNoData reports the features without any observation for at least their
+// noDataWindows windows as of asOf, each of their own size or else windowSize. Features
+// never observed count from the first window checked. A feature is reported again only
+// once its run grows by a whole window of its own, which may span several pipeline
+// windows.
+func (a *Alerter) checkNoData(sugar *zap.SugaredLogger, asOf time.Time, windowSize time.Duration) {
+	if a.noDataSince.IsZero() {
+		a.noDataSince = asOf
+	}
+	for _, f := range a.registry.Features() {
+		if f.NoDataWindows <= 0 {
+			continue
+		}
+		since, ok := a.lastData[f.Name]
+		if !ok || since.Before(a.noDataSince) {
+			since = a.noDataSince
+		}
+		windows := int(asOf.Sub(since) / f.Window(windowSize))
+		a.metrics.featureNoDataWindows.WithLabelValues(a.series.featureLabel(f.Name)).Set(float64(windows))
+		if windows < f.NoDataWindows || windows <= a.noDataReported[f.Name] {
+			continue
+		}
+		a.noDataReported[f.Name] = windows
+		window := AggregationResult{FeatureName: f.Name, Tenant: f.Tenant, WindowStart: since, WindowEnd: asOf}
+		a.reportViolation(sugar, f, newViolation(window, "no_data", ">=", float64(windows), float64(f.NoDataWindows)))
+	}
+}
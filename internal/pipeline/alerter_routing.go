@@ -0,0 +1,53 @@
+package pipeline
+
+import (
+	"path"
+	"slices"
+	"strconv"
+
+	"github.com/sanspareilsmyn/featurelens/internal/config"
+)
+
+// alertRouter evaluates the sinks routes of violations and alert resolutions.
+type alertRouter struct {
+	routes  []config.RouteConfig
+	metrics *Metrics
+}
+
+// route returns the names of the sinks an alert of the feature with the given severity
+// is routed to, or nil if no route matched.
+func (r alertRouter) route(featureCfg config.FeatureConfig, severity string) []string {
+	var sinks []string
+	for i, route := range r.routes {
+		if !routeMatches(route, featureCfg, severity) {
+			continue
+		}
+		name := route.Name
+		if name == "" {
+			name = strconv.Itoa(i)
+		}
+		r.metrics.alertsRouted.WithLabelValues(name).Inc()
+		sinks = append(sinks, route.Sinks...)
+		if !route.Continue {
+			break
+		}
+	}
+	return sinks
+}
+
+// routeMatches reports whether every matcher set on the route matches the alert.
+func routeMatches(route config.RouteConfig, f config.FeatureConfig, severity string) bool {
+	if len(route.Severities) > 0 && !slices.Contains(route.Severities, severity) {
+		return false
+	}
+	if len(route.Tenants) > 0 && !slices.Contains(route.Tenants, f.Tenant) {
+		return false
+	}
+	if len(route.Features) > 0 && !slices.ContainsFunc(route.Features, func(pattern string) bool {
+		matched, _ := path.Match(pattern, f.Name) // Validated at config load
+		return matched
+	}) {
+		return false
+	}
+	return Selector(route.Tags).Matches(f.Tags)
+}
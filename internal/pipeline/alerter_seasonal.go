@@ -0,0 +1,89 @@
+package pipeline
+
+import (
+	"math"
+	"time"
+
+	"github.com/sanspareilsmyn/featurelens/internal/config"
+	"github.com/sanspareilsmyn/featurelens/internal/schema"
+)
+
+// seasonalStatistic is a window statistic with a seasonal tolerance.
+type seasonalStatistic struct {
+	checkType string
+	tolerance *float64
+	actual    float64
+	past      func(schema.AggregationResult) float64
+}
+
+// checkSeasonal compares a window with the same window each configured period earlier,
+// reporting the relative change from the closest past window when it exceeds the
+// tolerance in either direction. Statistics without a past window, or whose past value
+// is zero, are not checked.
+func (a *Alerter) checkSeasonal(result AggregationResult, nullRate float64, s config.SeasonalThresholds) []Violation {
+	if len(s.Periods) == 0 {
+		return nil
+	}
+	var pastWindows []schema.AggregationResult
+	for _, period := range s.Periods {
+		if past, ok := a.pastWindow(result.FeatureName, result.WindowEnd.Add(-period)); ok {
+			pastWindows = append(pastWindows, past)
+		}
+	}
+	if len(pastWindows) == 0 {
+		return nil
+	}
+
+	statistics := []seasonalStatistic{
+		{"seasonal_count", s.CountChange, float64(result.Count), func(r schema.AggregationResult) float64 { return float64(r.Count) }},
+		{"seasonal_null_rate", s.NullRateChange, nullRate, func(r schema.AggregationResult) float64 { return valueOrNaN(r.NullRate) }},
+		{"seasonal_mean", s.MeanChange, result.Mean, func(r schema.AggregationResult) float64 { return valueOrNaN(r.Mean) }},
+	}
+	var violations []Violation
+	for _, stat := range statistics {
+		if stat.tolerance == nil {
+			continue
+		}
+		change := math.NaN()
+		for _, past := range pastWindows {
+			if c := seasonalChange(stat.actual, stat.past(past)); math.IsNaN(change) || math.Abs(c) < math.Abs(change) {
+				change = c
+			}
+		}
+		dropMax := -*stat.tolerance
+		violations = append(violations, checkRange(result, stat.checkType, change, &dropMax, stat.tolerance)...)
+	}
+	return violations
+}
+
+// pastWindow returns a feature's window that ended at windowEnd, from the results store
+// when it is enabled, else from the recent windows.
+func (a *Alerter) pastWindow(featureName string, windowEnd time.Time) (schema.AggregationResult, bool) {
+	if a.results != nil {
+		for _, r := range a.results.History(featureName, windowEnd, windowEnd) {
+			if r.Archived == nil {
+				return r.Result, true
+			}
+		}
+		return schema.AggregationResult{}, false
+	}
+	r, ok := a.recent.At(featureName, windowEnd)
+	return r.Result, ok
+}
+
+// seasonalChange returns the change from past to actual relative to past, or NaN when
+// either is unknown or past is zero.
+func seasonalChange(actual, past float64) float64 {
+	if math.IsNaN(actual) || math.IsNaN(past) || past == 0 {
+		return math.NaN()
+	}
+	return (actual - past) / math.Abs(past)
+}
+
+// valueOrNaN returns the value of an optional payload statistic, or NaN if it is unset.
+func valueOrNaN(v *float64) float64 {
+	if v == nil {
+		return math.NaN()
+	}
+	return *v
+}
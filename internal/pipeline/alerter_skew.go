@@ -0,0 +1,80 @@
+package pipeline
+
+import (
+	"math"
+
+	"go.uber.org/zap"
+
+	"github.com/sanspareilsmyn/featurelens/internal/config"
+	"github.com/sanspareilsmyn/featurelens/internal/logging"
+)
+
+// processSkew exports skew gauges and reports skew threshold violations.
+func (a *Alerter) processSkew(sugar *zap.SugaredLogger, result SkewResult) {
+	featureCfg, exists := a.registry.Lookup(result.FeatureName)
+	if !exists {
+		return
+	}
+
+	if a.series.featureLabel(result.FeatureName) == result.FeatureName { // Divergences do not aggregate
+		a.metrics.featureSkewPSI.WithLabelValues(result.FeatureName).Set(result.PSI)
+		a.metrics.featureSkewJSDivergence.WithLabelValues(result.FeatureName).Set(result.JSDivergence)
+		if !math.IsNaN(result.MeanDelta) {
+			a.metrics.featureSkewMeanDelta.WithLabelValues(result.FeatureName).Set(result.MeanDelta)
+		}
+		if !math.IsNaN(result.ChiSquarePValue) {
+			a.metrics.featureSkewChiSquarePValue.WithLabelValues(result.FeatureName).Set(result.ChiSquarePValue)
+		}
+	}
+
+	for _, check := range exceededSkew(result, featureCfg.Skew) {
+		a.reportViolation(sugar, featureCfg, Violation{
+			FeatureName: result.FeatureName,
+			CheckType:   check.checkType,
+			Comparison:  check.comparison,
+			Actual:      check.actual,
+			Threshold:   *check.threshold,
+			WindowStart: result.WindowStart,
+			WindowEnd:   result.WindowEnd,
+		})
+	}
+
+	sugar.Debugw("Feature skew computed",
+		logging.Feature(result.FeatureName),
+		logging.WindowEnd(result.WindowEnd),
+		zap.Int64("serving_count", result.ServingCount),
+		zap.Int64("reference_count", result.ReferenceCount),
+		zap.Float64("psi", result.PSI),
+		zap.Float64("js_divergence", result.JSDivergence),
+		zap.Float64("mean_delta", result.MeanDelta),
+		zap.Float64("chi_square", result.ChiSquare),
+		zap.Float64("chi_square_p_value", result.ChiSquarePValue),
+	)
+}
+
+// skewCheck is a skew threshold and the value checked against it.
+type skewCheck struct {
+	checkType  string
+	comparison string // ">" for upper bounds, "<" for lower bounds
+	actual     float64
+	threshold  *float64
+}
+
+// exceededSkew returns the skew thresholds a result exceeds.
+func exceededSkew(result SkewResult, t config.SkewThresholds) []skewCheck {
+	var exceeded []skewCheck
+	for _, check := range []skewCheck{
+		{"skew_psi", ">", result.PSI, t.PSIMax},
+		{"skew_js_divergence", ">", result.JSDivergence, t.JSDivergenceMax},
+		{"skew_mean_delta", ">", result.MeanDelta, t.MeanDeltaMax},
+		{"skew_chi_square_p_value", "<", result.ChiSquarePValue, t.ChiSquarePValueMin},
+	} {
+		if check.threshold == nil || math.IsNaN(check.actual) {
+			continue
+		}
+		if check.comparison == ">" && check.actual > *check.threshold || check.comparison == "<" && check.actual < *check.threshold {
+			exceeded = append(exceeded, check)
+		}
+	}
+	return exceeded
+}
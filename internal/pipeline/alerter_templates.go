@@ -0,0 +1,37 @@
+package pipeline
+
+import (
+	"github.com/sanspareilsmyn/featurelens/internal/config"
+	"github.com/sanspareilsmyn/featurelens/internal/schema"
+	"github.com/sanspareilsmyn/featurelens/internal/sink"
+)
+
+// alertContext returns what sink templates know of a violation or alert transition of a
+// feature beyond its payload: the feature's configuration, the window checked (nil for
+// pipeline-level checks), its last healthy window and its recent windows. It returns nil
+// unless some sink has a template, sparing the copies.
+func (a *Alerter) alertContext(featureCfg config.FeatureConfig, featureName string, window *AggregationResult) *sink.Context {
+	if a.sinks == nil || !a.sinks.templated {
+		return nil
+	}
+	c := &sink.Context{Feature: featureCfg}
+	if window != nil {
+		c.Window = templatePayload(*window)
+	}
+	if baseline, ok := a.lastHealthy[featureName]; ok {
+		c.Baseline = templatePayload(baseline)
+	}
+	records, _ := a.recent.History(featureName, a.recent.size)
+	for _, r := range records {
+		c.History = append(c.History, r.Result)
+	}
+	return c
+}
+
+// templatePayload returns a window's payload without its sketches, which templates have
+// no use for.
+func templatePayload(result AggregationResult) *schema.AggregationResult {
+	payload := result.Payload()
+	payload.Sketches = nil
+	return &payload
+}
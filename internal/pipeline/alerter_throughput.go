@@ -0,0 +1,114 @@
+package pipeline
+
+import (
+	"math"
+	"slices"
+
+	"go.uber.org/zap"
+
+	"github.com/sanspareilsmyn/featurelens/internal/config"
+	"github.com/sanspareilsmyn/featurelens/internal/logging"
+)
+
+// processThroughput exports a window's message count and reports it when it is outside
+// the configured bounds, changed by more than changeMax from the mean of the recent
+// windows, or falls short of the expected volume. Throughput violations are reported
+// against the topic, tagged source=throughput.
+func (a *Alerter) processThroughput(sugar *zap.SugaredLogger, result ThroughputResult) {
+	a.metrics.windowMessages.Set(float64(result.Count))
+	a.processNoData(sugar, result)
+	a.processSchema(sugar, result)
+	a.processPartitions(sugar, result)
+
+	cfg := a.throughputCfg
+	change := math.NaN()
+	if len(a.recentCounts) > 0 {
+		var sum int64
+		for _, n := range a.recentCounts {
+			sum += n
+		}
+		if mean := float64(sum) / float64(len(a.recentCounts)); mean > 0 {
+			change = (float64(result.Count) - mean) / mean
+		}
+	}
+	a.recentCounts = append(a.recentCounts, result.Count)
+	if len(a.recentCounts) > cfg.RecentWindows {
+		a.recentCounts = a.recentCounts[1:]
+	}
+
+	window := AggregationResult{FeatureName: a.topic, WindowStart: result.WindowStart, WindowEnd: result.WindowEnd}
+	violations := checkRange(window, "throughput", float64(result.Count), cfg.Min, cfg.Max)
+	if cfg.ChangeMax != nil {
+		dropMax := -*cfg.ChangeMax
+		violations = append(violations, checkRange(window, "throughput_change", change, &dropMax, cfg.ChangeMax)...)
+	}
+	expected, completeness := a.completeness(result.Count)
+	violations = append(violations, checkCompleteness(window, result.Count, completeness, cfg.Completeness.Min)...)
+	topicCfg := config.FeatureConfig{
+		Name: a.topic,
+		Tags: map[string]string{"source": "throughput", "topic": a.topic},
+	}
+	for _, v := range violations {
+		a.reportViolation(sugar, topicCfg, v)
+	}
+
+	fields := []interface{}{
+		logging.WindowEnd(result.WindowEnd),
+		zap.Int64("count", result.Count),
+	}
+	if !math.IsNaN(change) {
+		fields = append(fields, zap.Float64("change", change))
+	}
+	if !math.IsNaN(completeness) {
+		fields = append(fields, zap.Float64("expected", expected), zap.Float64("completeness", completeness))
+	}
+	sugar.Debugw("Window throughput observed", fields...)
+}
+
+// completeness returns the messages expected of a window and its count relative to them,
+// exporting both, or NaNs when completeness is disabled or the expectation is still being
+// learned. The learned expectation is the median count of the last learnWindows complete
+// windows: empty windows and, once learned, windows below min are left out, so an outage
+// does not lower the volume it is measured against.
+func (a *Alerter) completeness(count int64) (expected, completeness float64) {
+	cfg := a.throughputCfg.Completeness
+	if !cfg.Enabled() {
+		return math.NaN(), math.NaN()
+	}
+	expected, completeness = math.NaN(), math.NaN()
+	if cfg.Expected != nil {
+		expected = *cfg.Expected
+	} else if len(a.completeCounts) >= cfg.LearnWindows {
+		sorted := slices.Clone(a.completeCounts)
+		slices.Sort(sorted)
+		expected = float64(sorted[len(sorted)/2])
+	}
+	if expected > 0 {
+		completeness = float64(count) / expected
+		a.metrics.windowExpectedMessages.Set(expected)
+		a.metrics.windowCompleteness.Set(completeness)
+	}
+
+	if cfg.Expected == nil && count > 0 && (math.IsNaN(completeness) || cfg.Min == nil || completeness >= *cfg.Min) {
+		a.completeCounts = append(a.completeCounts, count)
+		if len(a.completeCounts) > cfg.LearnWindows {
+			a.completeCounts = a.completeCounts[1:]
+		}
+	}
+	return expected, completeness
+}
+
+// checkCompleteness reports a window whose completeness is below min: as a critical
+// window_empty violation when no message arrived at all, the topic or its producers being
+// down, and as a completeness violation when only part of the expected volume did.
+func checkCompleteness(window AggregationResult, count int64, completeness float64, minCompleteness *float64) []Violation {
+	if minCompleteness == nil || math.IsNaN(completeness) || completeness >= *minCompleteness {
+		return nil
+	}
+	if count == 0 {
+		v := newViolation(window, "window_empty", "<", completeness, *minCompleteness)
+		v.Severity = SeverityCritical
+		return []Violation{v}
+	}
+	return []Violation{newViolation(window, "completeness", "<", completeness, *minCompleteness)}
+}
@@ -0,0 +1,56 @@
+package pipeline
+
+import (
+	"time"
+
+	"github.com/sanspareilsmyn/featurelens/internal/config"
+	"github.com/sanspareilsmyn/featurelens/internal/schema"
+)
+
+// Violation describes a single threshold breach detected by the Alerter.
+type Violation struct {
+	FeatureName  string
+	CheckType    string // e.g., "null_rate", "mean", "stddev", "condition:<name>"
+	Comparison   string // "<", ">", ">=" for run-length checks, or "expr" for composite conditions
+	Actual       float64
+	Threshold    float64
+	WindowStart  time.Time
+	WindowEnd    time.Time
+	DetectedAt   time.Time
+	Expression   string            // Source of the composite condition, empty for threshold checks
+	CausedBy     []string          // Upstream features that violated in the same window
+	Explanation  *Explanation      // Comparison with the previous healthy window, nil if none was seen
+	Severity     string            // "info", "warning" or "critical"
+	Segment      *Segment          // Group of messages covered, nil for a feature's overall result
+	ModelVersion string            // Model version of the violating result, empty without pipeline.versionField
+	Tenant       string            // Tenant of the feature, empty for features without one and pipeline-level checks
+	Silenced     bool              // Reported while a silence matched the feature
+	Canary       bool              // Of a feature in canary mode, recorded but never notified
+	Stale        bool              // Of a window older than sinks.maxNotifyAge when detected, recorded but never notified
+	Samples      []string          // Example values of the violating window, with pipeline.valueSamples inViolations
+	Exemplars    []schema.Exemplar // Trace IDs of the violating window's messages relevant to the check, with pipeline.exemplars
+	Metadata     *FeatureMetadata  // Ownership of the feature, nil when none is configured
+	SchemaChange *SchemaChange     // Fields changed, of schema_change violations
+
+	Acknowledgement *Acknowledgement // Of the firing alert by an operator, nil if unacknowledged
+
+	window *AggregationResult // Violating window, for sink templates; nil for pipeline-level checks
+}
+
+// FeatureMetadata is the ownership and context of a feature, carried by its violations
+// and alerts so notifications reach the people responsible.
+type FeatureMetadata struct {
+	Owner       string `json:"owner,omitempty"`
+	Team        string `json:"team,omitempty"`
+	RunbookURL  string `json:"runbookUrl,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// featureMetadata returns the metadata of a feature, or nil if it has none.
+func featureMetadata(f config.FeatureConfig) *FeatureMetadata {
+	m := FeatureMetadata{Owner: f.Owner, Team: f.Team, RunbookURL: f.RunbookURL, Description: f.Description}
+	if m == (FeatureMetadata{}) {
+		return nil
+	}
+	return &m
+}
@@ -0,0 +1,67 @@
+package pipeline
+
+import (
+	"time"
+
+	"github.com/sanspareilsmyn/featurelens/internal/config"
+)
+
+// alignedWindowEnd returns the end of the window holding t, for windows of size starting
+// at multiples of it shifted by the alignment's offset. Multiples are counted on the wall
+// clock of the alignment's time zone, so that e.g. daily windows start at its midnight;
+// across a daylight saving time change, windows end at the first aligned wall clock time
+// after it.
+func alignedWindowEnd(t time.Time, size time.Duration, a config.WindowAlignmentConfig) time.Time {
+	if a.Location == nil {
+		return t.Add(-a.Offset).Truncate(size).Add(size + a.Offset)
+	}
+	local := t.In(a.Location)
+	_, zoneOffset := local.Zone()
+	_, zoneEnd := local.ZoneBounds()
+	shift := time.Duration(zoneOffset) * time.Second
+	end := t.Add(shift).Add(-a.Offset).Truncate(size).Add(size + a.Offset).Add(-shift)
+	if zoneEnd.IsZero() || !end.After(zoneEnd) {
+		return end
+	}
+	// The zone's offset changes first: the window ends at the first aligned wall clock
+	// time from the change on
+	_, zoneOffset = zoneEnd.In(a.Location).Zone()
+	shift = time.Duration(zoneOffset) * time.Second
+	wall := zoneEnd.Add(shift)
+	aligned := wall.Add(-a.Offset).Truncate(size).Add(a.Offset)
+	if aligned.Before(wall) {
+		aligned = aligned.Add(size)
+	}
+	return aligned.Add(-shift)
+}
+
+// windowEnd returns the end of the configured window holding t.
+func windowEnd(cfg config.PipelineConfig, t time.Time) time.Time {
+	return alignedWindowEnd(t, cfg.WindowSize, cfg.WindowAlignment)
+}
+
+// featureWindowEnd returns the end of the feature's window holding the pipeline window
+// ending at end. Feature windows are multiples of the pipeline window sharing its
+// boundaries, so every pipeline window lies within one of them.
+func featureWindowEnd(cfg config.PipelineConfig, featureCfg config.FeatureConfig, end time.Time) time.Time {
+	size := featureCfg.Window(cfg.WindowSize)
+	if size == cfg.WindowSize {
+		return end
+	}
+	return alignedWindowEnd(end.Add(-cfg.WindowSize), size, cfg.WindowAlignment)
+}
+
+// longestWindow returns the size of the longest window of the pipeline and features.
+func longestWindow(cfg config.PipelineConfig, features []config.FeatureConfig) time.Duration {
+	longest := cfg.WindowSize
+	for _, f := range features {
+		longest = max(longest, f.Window(cfg.WindowSize))
+	}
+	return longest
+}
+
+// nextFlush returns the first flush after now: the end of a window plus the flush grace.
+func nextFlush(cfg config.PipelineConfig, now time.Time) time.Time {
+	grace := cfg.WindowAlignment.FlushGrace
+	return windowEnd(cfg, now.Add(-grace)).Add(grace)
+}
@@ -0,0 +1,61 @@
+package pipeline
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/sanspareilsmyn/featurelens/internal/logging"
+	"github.com/sanspareilsmyn/featurelens/internal/schema"
+)
+
+// archiveReason explains, in archive payloads, why a feature's monitoring stopped.
+const archiveReason = "removed from configuration"
+
+// archiveRemovedFeatures archives the features that have stored results but are no
+// longer configured: an archive record ends their history in the results store and a
+// "monitoring stopped" event is sent to sinks, so dashboards show why their data ends
+// instead of an unexplained gap. Features archived by an earlier run are only exported.
+func (p *Pipeline) archiveRemovedFeatures(registry *FeatureRegistry) {
+	sugar := p.logger.Sugar()
+	now := time.Now()
+	for _, record := range p.results.Snapshot(now) {
+		name := record.Result.FeatureName
+		if record.Archived != nil {
+			p.metrics.featureArchived.WithLabelValues(name).Set(float64(record.Archived.ArchivedAt.Unix()))
+			continue
+		}
+		configName := unversionedName(name, record.Result.ModelVersion)
+		if segment := record.Result.Segment; segment != nil {
+			configName = segment.Feature // Segments end with their feature
+		}
+		if registry.Configured(configName) {
+			continue
+		}
+
+		archived := schema.FeatureArchived{
+			SchemaVersion: schema.Version,
+			Kind:          schema.KindFeatureArchived,
+			EventID:       eventID(schema.KindFeatureArchived, name, record.Result.WindowEnd),
+			FeatureName:   name,
+			ArchivedAt:    now,
+			LastWindowEnd: record.Result.WindowEnd,
+			Reason:        archiveReason,
+		}
+		if err := p.results.Archive(archived); err != nil {
+			sugar.Warnw("Failed to store feature archive record",
+				logging.Feature(name),
+				zap.Error(err),
+			)
+			continue
+		}
+		if p.sinks != nil {
+			p.sinks.EnqueueArchived(archived)
+		}
+		p.metrics.featureArchived.WithLabelValues(name).Set(float64(now.Unix()))
+		sugar.Infow("Feature removed from configuration, monitoring stopped",
+			logging.Feature(name),
+			zap.Time("last_window_end", record.Result.WindowEnd),
+		)
+	}
+}
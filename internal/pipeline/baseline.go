@@ -0,0 +1,172 @@
+package pipeline
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"sort"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/sanspareilsmyn/featurelens/internal/config"
+	"github.com/sanspareilsmyn/featurelens/internal/message"
+)
+
+// baselineKind marks the lines of a baseline snapshot holding a feature's distribution,
+// as opposed to the raw reference messages of an imported snapshot.
+const baselineKind = "feature_baseline"
+
+// baselineGroupSuffix keeps baseline capture from joining the monitoring consumer group.
+const baselineGroupSuffix = "-baseline"
+
+// BaselineProfile is the value distribution of one feature captured from the stream, one
+// line of a baseline snapshot. Snapshots of profiles can be used as skew.baselineFile in
+// place of raw reference messages.
+type BaselineProfile struct {
+	Kind        string           `json:"kind"`
+	FeatureName string           `json:"featureName"`
+	MetricType  string           `json:"metricType"`
+	CapturedAt  time.Time        `json:"capturedAt"`
+	Count       int64            `json:"count"`                // Non-null values observed
+	Sum         float64          `json:"sum,omitempty"`        // Of the numerical values
+	Samples     []float64        `json:"samples,omitempty"`    // Uniform sample of the numerical values
+	Categories  map[string]int64 `json:"categories,omitempty"` // Categorical features only
+}
+
+// BaselineDiff compares a feature's current distribution with its baseline profile.
+type BaselineDiff struct {
+	SkewResult
+	MetricType string
+	Exceeded   []string // Skew checks of the feature exceeded, e.g. "skew_psi"
+}
+
+// CaptureBaseline consumes the configured topic for the given duration and returns the
+// value distribution of every configured numerical and categorical feature, ordered by
+// name. Numerical values are sampled down to skew.maxSamples per feature.
+func CaptureBaseline(ctx context.Context, cfg *config.Config, duration time.Duration, logger *zap.Logger) ([]BaselineProfile, error) {
+	logger = logger.Named("baseline")
+	registry := NewFeatureRegistry(cfg.Features, cfg.Pipeline.MaxDiscoveredFeatures, logger.Named("registry"))
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+	dists := make(map[string]*distribution)
+	var messages int64
+	observe := func(msg message.DynamicMessage) {
+		messages++
+		registry.Discover(msg)
+		observeDistributions(dists, registry.Features(), msg, cfg.Pipeline.TenantField, fixedSamples(cfg.Skew.MaxSamples), rng)
+	}
+	if err := sampleStream(ctx, cfg, baselineGroupSuffix, duration, cfg.Pipeline.PartialParsing, observe, logger); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	var profiles []BaselineProfile
+	for _, f := range registry.Features() {
+		d, ok := dists[f.Name]
+		if !ok {
+			continue
+		}
+		profiles = append(profiles, BaselineProfile{
+			Kind:        baselineKind,
+			FeatureName: f.Name,
+			MetricType:  f.MetricType,
+			CapturedAt:  now,
+			Count:       d.count(),
+			Sum:         d.sum,
+			Samples:     d.samples,
+			Categories:  d.categories,
+		})
+	}
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].FeatureName < profiles[j].FeatureName })
+	logger.Info("Baseline captured", zap.Int64("messages", messages), zap.Int("features", len(profiles)))
+	return profiles, nil
+}
+
+// WriteBaseline writes profiles as a JSON lines baseline snapshot.
+func WriteBaseline(w io.Writer, profiles []BaselineProfile) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	for _, p := range profiles {
+		if err := enc.Encode(p); err != nil {
+			return fmt.Errorf("%w: %w", ErrBaselineWriteFailed, err)
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("%w: %w", ErrBaselineWriteFailed, err)
+	}
+	return nil
+}
+
+// ReadBaseline reads the profiles of a baseline snapshot written by WriteBaseline.
+func ReadBaseline(path string) ([]BaselineProfile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrSkewBaselineLoadFailed, err)
+	}
+	defer f.Close()
+
+	var profiles []BaselineProfile
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), maxReplayLineBytes)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var p BaselineProfile
+		if err := json.Unmarshal(scanner.Bytes(), &p); err != nil || p.Kind != baselineKind {
+			return nil, fmt.Errorf("%w: %s:%d is not a captured feature profile", ErrSkewBaselineLoadFailed, path, line)
+		}
+		profiles = append(profiles, p)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrSkewBaselineLoadFailed, err)
+	}
+	return profiles, nil
+}
+
+// DiffBaseline compares current distributions with baseline profiles, feature by
+// feature, and flags the skew thresholds each configured feature exceeds. Features
+// missing from either side are left out.
+func DiffBaseline(cfg *config.Config, baseline, current []BaselineProfile) []BaselineDiff {
+	features := make(map[string]config.FeatureConfig, len(cfg.Features))
+	for _, f := range cfg.Features {
+		features[f.Name] = f
+	}
+	reference := make(map[string]BaselineProfile, len(baseline))
+	for _, p := range baseline {
+		reference[p.FeatureName] = p
+	}
+
+	var diffs []BaselineDiff
+	for _, p := range current {
+		ref, ok := reference[p.FeatureName]
+		if !ok || ref.MetricType != p.MetricType {
+			continue
+		}
+		f := features[p.FeatureName]
+		f.Name, f.MetricType = p.FeatureName, p.MetricType // Discovered features are not in cfg
+		result, ok := compareDistributions(f, p.distribution(), ref.distribution(), cfg.Skew.Bins)
+		if !ok {
+			continue
+		}
+		diff := BaselineDiff{SkewResult: result, MetricType: p.MetricType}
+		for _, check := range exceededSkew(result, f.Skew) {
+			diff.Exceeded = append(diff.Exceeded, check.checkType)
+		}
+		diffs = append(diffs, diff)
+	}
+	return diffs
+}
+
+// distribution returns the profile as a distribution for comparisons.
+func (p BaselineProfile) distribution() *distribution {
+	d := &distribution{samples: p.Samples, sum: p.Sum, categories: p.Categories}
+	if p.Categories == nil {
+		d.seen = p.Count
+	}
+	return d
+}
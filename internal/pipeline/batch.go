@@ -0,0 +1,107 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"go.uber.org/zap"
+
+	"github.com/sanspareilsmyn/featurelens/internal/config"
+)
+
+// stopAtEnd makes Run return once every partition is consumed up to its end offset,
+// resolved when Run starts: the high watermark, or with a non-zero until the offset of
+// the first message at or after it. Messages past the end are left for the next run.
+// It must be called before Run.
+func (c *Consumer) stopAtEnd(until time.Time) {
+	c.bounded, c.until = true, until
+}
+
+// minStallTimeout is the shortest a consumer stopping at the end offsets waits for the
+// next message before it stops short of them, allowing for the group to rebalance.
+const minStallTimeout = 30 * time.Second
+
+// stallTimeout returns how long a consumer stopping at the end offsets waits for the next
+// message before it stops short of them. Partitions may never reach their end offset:
+// transaction markers, and with read_committed the messages of aborted transactions,
+// take up offsets but are never fetched.
+func (c *Consumer) stallTimeout() time.Duration {
+	return max(2*c.cfg.Reader.MaxWait, minStallTimeout)
+}
+
+// resolveEnds looks up the end offset of every partition consumed, and which partitions
+// have messages left before it from the group's committed offsets.
+func (c *Consumer) resolveEnds(ctx context.Context) error {
+	target := config.SeekTarget{Latest: true}
+	if !c.until.IsZero() {
+		target = config.SeekTarget{Time: c.until}
+	}
+	ends, err := c.resolveOffsets(ctx, target)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrSubscriptionFailed, err)
+	}
+	earliest, err := c.resolveOffsets(ctx, config.SeekTarget{Earliest: true})
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrSubscriptionFailed, err)
+	}
+	partitions := make(map[string][]int, len(ends))
+	for topic, offsets := range ends {
+		for partition := range offsets {
+			partitions[topic] = append(partitions[topic], partition)
+		}
+	}
+	committed, err := c.committedOffsets(ctx, partitions)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrSubscriptionFailed, err)
+	}
+
+	remaining := make(Offsets)
+	for topic, offsets := range ends {
+		for partition, end := range offsets {
+			start, ok := committed[topic][partition]
+			if !ok || start < 0 {
+				start = earliest[topic][partition] // Like a consumer group without committed offsets
+			}
+			if start < end {
+				remaining.set(topic, partition, end)
+			}
+		}
+	}
+	c.mu.Lock()
+	c.ends, c.remaining = ends, remaining
+	c.mu.Unlock()
+	c.logger.Info("Consuming up to the end offsets",
+		zap.Time("until", c.until),
+		zap.Any("ends", ends),
+		zap.Any("remaining", remaining),
+	)
+	return nil
+}
+
+// pastEnd reports whether m is at or after its partition's end offset. Partitions created
+// after the end offsets were resolved have no message before their end.
+func (c *Consumer) pastEnd(m kafka.Message) bool {
+	if !c.bounded {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	end, ok := c.ends[m.Topic][m.Partition]
+	return !ok || m.Offset >= end
+}
+
+// caughtUp reports whether every partition was handed downstream up to its end offset.
+func (c *Consumer) caughtUp() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for topic, offsets := range c.remaining {
+		for partition, end := range offsets {
+			if c.positions[topic][partition] < end {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -2,145 +2,535 @@ package pipeline
 
 import (
 	"context"
+	"regexp"
+	"sort"
 	"sync"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 
 	"github.com/sanspareilsmyn/featurelens/internal/config"
+	"github.com/sanspareilsmyn/featurelens/internal/logging"
 	"github.com/sanspareilsmyn/featurelens/internal/message"
+	"github.com/sanspareilsmyn/featurelens/internal/schema"
 )
 
 // Calculator processes messages and calculates statistics based on configuration.
 // It uses windowInfo to manage state.
 type Calculator struct {
-	config        config.PipelineConfig
-	featuresToRun []config.FeatureConfig
-	input         <-chan message.DynamicMessage
-	output        chan<- AggregationResult
-	logger        *zap.Logger
+	config   config.PipelineConfig
+	registry *FeatureRegistry
+	input    <-chan []message.DynamicMessage
+	output   chan<- AggregationResult
+	latency  chan<- LatencyResult // nil unless end-to-end latency is measured
+	// throughput receives every completed window's message count, nil unless throughput is checked
+	throughput    chan<- ThroughputResult
+	throughputEnd time.Time // End of the last window whose throughput was sent, only used by the processing loop
+	latestEvent   time.Time // Latest event timestamp seen, only used by the processing loop
+	// correlations receives the configured correlations' results, nil when none are configured
+	correlations chan<- CorrelationResult
+	logger       *zap.Logger
+	metrics      *Metrics
+	sampler      *AdaptiveSampler
+	patterns     map[string]*regexp.Regexp      // Compiled value patterns, only used by the processing loop
+	groups       map[string]map[string]struct{} // Groups tracked per feature with a groupBy field, guarded by mu
+
+	// Vector features, only used by the processing loop
+	dimensions map[string]int       // Expected dimensions by feature, when learned from the first vector
+	centroids  map[string][]float64 // Baseline centroids by feature
+	vectorBuf  []float64            // Reused to decode array values
+
+	// outlierBaselines holds the outlier bounds of each result's last window within
+	// outlierRateMax, by result name, for features with the baseline reference; only used
+	// when flushing
+	outlierBaselines map[string]outlierBounds
+
+	// Features computed with a pipeline graph: those of a calculator stage, or for the main
+	// calculator those no stage claims. nil to compute every feature.
+	owns      func(config.FeatureConfig) bool
+	owned     []config.FeatureConfig // Features owns is true for, in registry order; only used by the processing loop
+	ownedSeen int                    // Registry features checked so far; the registry only grows
+
+	sessions *sessionTracker // Open entity sessions, nil unless sessions are configured; only used by the processing loop
+	recycle  bool            // Release processed messages to the message pool
+	batches  *batchTimes     // When the parser sent the batches of input, nil unless timed
+
+	// Feature stats are updated by shards on goroutines of their own with
+	// pipeline.calculatorWorkers above 1, nil otherwise
+	shards []*calculatorShard
+	routed []routedMessage // Messages of the batch in progress, only used by the processing loop
+
+	partitionFeatures []partitionFeature // Features compared across partitions, nil unless partition statistics are enabled
+
+	stats *processingStats // Counts dropped results for the processing summary, nil unless enabled
+
+	// Event time, only used by the processing loop
+	watermark time.Time                 // Windows ending at or before it were flushed
+	sinceTick int64                     // Messages processed since the last tick
+	retained  map[time.Time]*windowInfo // Flushed windows late messages can reopen, with latePolicy reemit
+
+	// Horizontal scaling: completed windows are published to partials instead of being
+	// evaluated, and the merger's windows received from merged are evaluated instead
+	instance   string
+	partials   chan<- []byte      // nil unless scaled out
+	partialEnd time.Time          // End of the last window published, only used by the processing loop
+	merged     <-chan *windowInfo // nil unless this instance merges partials
 
 	mu           sync.Mutex
 	windowStates map[time.Time]*windowInfo
+	spill        *stateSpiller // Keeps windowStates within the memory budget, nil without one
+
+	clock Clock // Processing time and window ticks
 }
 
 // NewCalculator creates a new Calculator instance.
-func NewCalculator(cfg config.PipelineConfig, features []config.FeatureConfig, input <-chan message.DynamicMessage, output chan<- AggregationResult, logger *zap.Logger) *Calculator {
+// latency, throughput and correlations may be nil when end-to-end latency is not
+// measured, throughput is not checked and no correlations are configured.
+func NewCalculator(cfg config.PipelineConfig, registry *FeatureRegistry, input <-chan []message.DynamicMessage, output chan<- AggregationResult, latency chan<- LatencyResult, throughput chan<- ThroughputResult, correlations chan<- CorrelationResult, sampler *AdaptiveSampler, metrics *Metrics, logger *zap.Logger) *Calculator {
 	c := &Calculator{
-		config:        cfg,
-		featuresToRun: features,
-		input:         input,
-		output:        output,
-		logger:        logger,
-		windowStates:  make(map[time.Time]*windowInfo),
+		config:            cfg,
+		registry:          registry,
+		input:             input,
+		output:            output,
+		latency:           latency,
+		throughput:        throughput,
+		correlations:      correlations,
+		logger:            logger,
+		metrics:           metrics,
+		sampler:           sampler,
+		patterns:          make(map[string]*regexp.Regexp),
+		groups:            make(map[string]map[string]struct{}),
+		dimensions:        make(map[string]int),
+		centroids:         make(map[string][]float64),
+		outlierBaselines:  make(map[string]outlierBounds),
+		windowStates:      make(map[time.Time]*windowInfo),
+		sessions:          newSessionTracker(cfg, registry.Features(), metrics),
+		partitionFeatures: partitionFeatures(cfg.PartitionStats, registry.Features()),
+		retained:          make(map[time.Time]*windowInfo),
+		clock:             SystemClock,
 	}
 	logger.Info("Calculator initialized",
 		zap.Duration("window_size", cfg.WindowSize),
-		zap.Int("configured_features", len(features)),
+		zap.Int("configured_features", len(registry.Features())),
 	)
 	return c
 }
 
+// scaleOut makes the calculator publish its completed windows, encoded as the partials of
+// instance, instead of evaluating them, and evaluate the windows received from merged.
+// merged is nil on instances that do not merge partials.
+func (c *Calculator) scaleOut(instance string, partials chan<- []byte, merged <-chan *windowInfo) {
+	c.instance = instance
+	c.partials = partials
+	c.merged = merged
+}
+
+// recycleMessages makes the calculator release the messages it processed to the message
+// pool. It must only be called when the calculator is the only reader of its input.
+func (c *Calculator) recycleMessages() {
+	c.recycle = true
+}
+
+// restrict makes the calculator compute only the features owns is true for.
+func (c *Calculator) restrict(owns func(config.FeatureConfig) bool) {
+	c.owns = owns
+}
+
+// features returns the known features the calculator computes, in registry order.
+func (c *Calculator) features() []config.FeatureConfig {
+	features := c.registry.Features()
+	if c.owns == nil {
+		return features
+	}
+	for _, f := range features[c.ownedSeen:] {
+		if c.owns(f) {
+			c.owned = append(c.owned, f)
+		}
+	}
+	c.ownedSeen = len(features)
+	return c.owned
+}
+
+// boundState keeps the stats of open windows within the spiller's memory budget.
+func (c *Calculator) boundState(spill *stateSpiller) {
+	c.spill = spill
+}
+
 // Run starts the calculator's processing loop.
 func (c *Calculator) Run(ctx context.Context) error {
 	sugar := c.logger.Sugar() // Use sugared logger for convenience
 	sugar.Info("Starting calculator loop...")
 	defer sugar.Info("Calculator loop stopped.")
 
-	ticker := time.NewTicker(c.config.WindowSize) // Ticker to trigger window processing based on config.WindowSize
-	defer ticker.Stop()
+	// Windows are flushed at their end plus the flush grace, aligned to the window boundaries
+	now := c.clock.Now()
+	flushes := newFlushScheduler(c.config, c.clock, c.metrics)
+	flushes.schedule(now)
+	// The window in progress at startup is partial, so throughput is reported from the next one
+	c.throughputEnd = windowEnd(c.config, now)
+	c.partialEnd = c.throughputEnd
+	var updated sync.WaitGroup
+	c.startShards(&updated)
+	defer c.stopShards()
 
 	for {
 		select {
-		case msg, ok := <-c.input:
+		case batch, ok := <-c.input:
 			if !ok {
-				sugar.Info("Calculator input channel closed. Processing final windows...")
-				c.flushWindows(time.Now())
+				sugar.Info("Calculator input channel closed. Flushing all open windows...")
+				c.drainWindows(ctx)
+				c.drainMerged(ctx)
 				return nil
 			}
-			c.processMessage(msg)
+			if flushes.sleeping() {
+				if tickTime, ok := flushes.wake(c.clock.Now()); ok {
+					c.flush(tickTime)
+				}
+			}
+			for _, msg := range batch {
+				c.processMessage(msg)
+			}
+			c.updateShards(&updated)
+			if sent, ok := c.batches.received(batch); ok {
+				c.metrics.observeStage(stageAggregate, sent)
+			}
+			if c.recycle {
+				for _, msg := range batch {
+					message.Release(msg)
+				}
+			}
+
+		case w, ok := <-c.merged:
+			if !ok {
+				c.merged = nil // Receiving from a nil channel blocks, disabling the case
+				continue
+			}
+			c.evaluateMerged(context.Background(), w, false)
 
-		case tickTime := <-ticker.C:
-			// Time to process completed windows based on the ticker fire time
+		case <-flushes.timer:
+			// Time to process completed windows based on the scheduled flush time
+			tickTime := flushes.fire(c.clock.Now())
 			sugar.Debugw("Ticker fired, processing completed windows", zap.Time("tick_time", tickTime))
-			c.flushWindows(tickTime)
+			c.flush(tickTime)
+			if !c.idle() {
+				flushes.schedule(c.clock.Now())
+			}
 
 		case <-ctx.Done():
-			sugar.Info("Context cancelled, stopping calculator. Processing final windows...")
-			c.flushWindows(time.Now())
+			// Cancelled before the input drained: the shutdown deadline has passed, so open
+			// windows are dropped rather than emitted to an alerter that may be gone.
+			sugar.Info("Context cancelled, stopping calculator without flushing open windows.")
 			return ctx.Err()
 		}
 	}
 }
 
+// flush expires the sessions and flushes the windows completed by the flush due at
+// tickTime.
+func (c *Calculator) flush(tickTime time.Time) {
+	c.expireSessions(tickTime)
+	c.flushWindows(c.advanceWatermark(tickTime))
+}
+
+// idle reports whether nothing is left to flush until a message arrives: no window or
+// session is open, and no output is reported for every window whether it had messages
+// or not.
+func (c *Calculator) idle() bool {
+	if c.throughput != nil || c.partials != nil || c.sessions.len() > 0 {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.windowStates) == 0 && c.shardsIdle()
+}
+
 // processMessage determines the window and delegates feature processing.
 func (c *Calculator) processMessage(msg message.DynamicMessage) {
-	now := time.Now() // Determine window end time based on processing time
-	windowDuration := c.config.WindowSize
-	windowEnd := now.Truncate(windowDuration).Add(windowDuration)
+	now := c.clock.Now() // Determine window end time based on processing time
+	window := windowKey{end: windowEnd(c.config, now)}
+	c.sinceTick++
+
+	if capacity := cap(c.input); capacity > 0 {
+		c.sampler.ObserveLoad(float64(len(c.input)) / float64(capacity))
+	}
+
+	if c.latency != nil {
+		if eventAt, ok := eventTime(msg, c.config.Latency); ok {
+			if c.config.EventTime.Enabled {
+				if window, ok = c.eventWindow(eventAt, now); !ok {
+					c.observeEventTime(c.openWindowEnd(), now, eventAt)
+					return // Late and dropped
+				}
+			}
+			c.observeEventTime(window.end, now, eventAt)
+		}
+	}
+	// Window-level statistics of late messages were emitted with their window
+	if c.correlations != nil && !window.late {
+		c.observeCorrelations(msg, window.end)
+	}
+	if c.throughput != nil && !window.late {
+		c.countMessage(window.end)
+		if c.config.SchemaTracking.Enabled {
+			c.observeSchema(msg, window.end)
+		}
+		if c.partitionFeatures != nil {
+			c.observePartition(msg, window.end)
+		}
+	}
+
+	for _, discovered := range c.registry.Discover(msg) {
+		c.sampler.Register(discovered)
+	}
+
+	topic, _ := msg[message.TopicKey].(string)
+	routed := routedMessage{
+		msg:     msg,
+		window:  window,
+		version: messageVersion(msg, c.config.VersionField),
+		tenant:  messageTenant(msg, c.config.TenantField),
+		topic:   topic,
+	}
+	if c.shards != nil {
+		c.routed = append(c.routed, routed) // Updated by the shards once the batch is processed
+	} else {
+		c.updateFeatures(c.features(), routed)
+	}
+	for _, s := range c.sessions.observe(msg, now) {
+		c.closeSession(s, windowEnd(c.config, now))
+	}
+	if c.spill != nil {
+		c.mu.Lock()
+		c.spill.enforce(c.windowStates)
+		c.mu.Unlock()
+	}
+}
 
-	for _, featureCfg := range c.featuresToRun {
-		c.updateFeatureStats(msg, featureCfg, windowEnd)
+// updateFeatures updates the stats of the features a message is routed to.
+func (c *Calculator) updateFeatures(features []config.FeatureConfig, m routedMessage) {
+	for _, featureCfg := range features {
+		if featureCfg.Scope == config.ScopeSession || !inTenant(featureCfg, c.config.TenantField, m.tenant) || !inTopics(featureCfg, m.topic) {
+			continue
+		}
+		c.updateFeatureStats(m.msg, featureCfg, m.window, m.version)
 	}
 }
 
 // updateFeatureStats handles stats update for a single feature within its window.
 // It gets the stats struct, updates basic counts, and delegates specific processing.
-func (c *Calculator) updateFeatureStats(msg message.DynamicMessage, featureCfg config.FeatureConfig, windowEnd time.Time) {
+func (c *Calculator) updateFeatureStats(msg message.DynamicMessage, featureCfg config.FeatureConfig, window windowKey, version string) {
 	featureName := featureCfg.Name
+	window, ok := c.featureWindow(featureCfg, window)
+	if !ok {
+		return // Late for a flushed window of the feature's own that is no longer retained
+	}
 
 	// Check if the feature is present in the message
-	stats := c.getOrCreateFeatureStats(windowEnd, featureName)
+	stats := c.getOrCreateFeatureStats(window, featureName, version)
+
+	if !c.sampler.Sample(featureName) {
+		stats.sampledOut++
+		return
+	}
+
+	processed := c.accumulate(stats, msg, featureCfg)
+	if featureCfg.GroupBy != "" {
+		c.accumulate(c.getOrCreateGroupStats(window, featureCfg, version, msg), msg, featureCfg)
+	}
+
+	// Type mismatches are counted per window and alerted on through typeMismatchRate, or
+	// a type_mismatch violation for strict features, so each one is only logged at debug level
+	if !processed {
+		c.logger.Sugar().Debugw("Non-null value could not be processed for feature",
+			logging.Feature(featureName),
+			zap.String("metric_type", featureCfg.MetricType),
+			zap.Any("value_snippet", msg.GetFieldSnippet(featureCfg.FieldName(), 50)),
+			logging.WindowEnd(window.end),
+		)
+	}
+}
+
+// featureWindow returns the window of the feature the message of the pipeline window
+// belongs to. With latePolicy reemit, a reopened pipeline window may lie in a feature
+// window already flushed, which is reopened too; ok is false if it is no longer retained.
+func (c *Calculator) featureWindow(featureCfg config.FeatureConfig, window windowKey) (windowKey, bool) {
+	end := featureWindowEnd(c.config, featureCfg, window.end)
+	if end.Equal(window.end) {
+		return window, true
+	}
+	if !window.late && c.config.EventTime.Enabled && !end.After(c.watermark) && !c.reopen(end) {
+		c.metrics.lateMessages.WithLabelValues("expired").Inc()
+		return windowKey{}, false
+	}
+	return windowKey{end: end, late: window.late}, true
+}
+
+// accumulate adds the message's value of the feature to stats. It returns false if a
+// non-null value could not be processed according to the feature's metric type.
+func (c *Calculator) accumulate(stats *FeatureStats, msg message.DynamicMessage, featureCfg config.FeatureConfig) bool {
+	field := featureCfg.FieldName()
 
 	// Update basic stats
 	stats.count++
 
-	// Check for null value first
-	if !msg.HasNonNull(featureName) {
+	// Absent keys and explicit nulls have different root causes, so count them apart
+	if !msg.Has(field) {
+		stats.missingCount++
+		if c.config.Exemplars.TraceField != "" {
+			c.observeExemplar(stats, msg, false, 0, 0, 0)
+		}
+		return true
+	}
+	if !msg.HasNonNull(field) {
 		stats.nullCount++
-		return
+		if c.config.Exemplars.TraceField != "" {
+			c.observeExemplar(stats, msg, false, 0, 0, 0)
+		}
+		return true
 	}
 
-	// Process non-null value based on metric type
-	processed := c.processNonNullValue(stats, msg, featureCfg)
+	if c.config.ValueSamples.Size > 0 {
+		c.sampleValue(stats, msg, field)
+	}
 
-	// Log a warning if a non-null value couldn't be processed according to its type
+	// Process non-null value based on metric type
+	prevCount, prevMin, prevMax := stats.valueCount, stats.min, stats.max
+	processed := (featureCfg.ExpectedType == "" || msg.JSONType(field) == featureCfg.ExpectedType) &&
+		c.processNonNullValue(stats, msg, featureCfg)
+	if c.config.Exemplars.TraceField != "" {
+		c.observeExemplar(stats, msg, true, prevCount, prevMin, prevMax)
+	}
 	if !processed {
-		c.logger.Sugar().Warnw("Non-null value could not be processed for feature",
-			zap.String("feature_name", featureName),
-			zap.String("metric_type", featureCfg.MetricType),
-			zap.Any("value_snippet", msg.GetFieldSnippet(featureName, 50)),
-			zap.Time("window_end", windowEnd),
-		)
+		stats.typeMismatchCount++
+		return false
+	}
+	if featureCfg.MetricType != config.MetricTypeVector && featureCfg.TracksDistinct() {
+		c.observeDistinct(stats, msg, field)
+	}
+	return true
+}
+
+// sampleValue offers the message's non-null value of the field to the reservoir of
+// stats, rendering it only when it is sampled.
+func (c *Calculator) sampleValue(stats *FeatureStats, msg message.DynamicMessage, field string) {
+	if stats.samples == nil {
+		stats.samples = &valueSamples{}
+	}
+	if i := stats.samples.slot(c.config.ValueSamples.Size); i >= 0 {
+		stats.samples.values[i] = msg.GetFieldSnippet(field, c.config.ValueSamples.MaxLength)
+	}
+}
+
+// getOrCreateFeatureStats retrieves or initializes the stats struct for a given
+// window/feature/model version. It acquires and releases the lock internally.
+func (c *Calculator) getOrCreateFeatureStats(window windowKey, featureName, version string) *FeatureStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	windowState := c.getOrCreateState(window)
+	name := versionedName(featureName, version)
+	key := stateKey{windowEnd: window.end, name: name, late: window.late}
+	stats, exists := windowState.features[name]
+	if !exists {
+		stats = c.spill.take(key)
+		windowState.features[name] = stats
+		windowState.versions[version] = struct{}{}
+	}
+	c.spill.touch(key, stats)
+	return stats
+}
+
+// observeEventTime records a message's end-to-end latency in its window, and whether its
+// event timestamp is future-dated or out of order. Future-dated timestamps do not advance
+// the latest timestamp seen, so a single bad clock does not flag every later message.
+func (c *Calculator) observeEventTime(windowEnd, now, eventAt time.Time) {
+	future := eventAt.Sub(now) > c.config.Latency.FutureTolerance
+	outOfOrder := c.latestEvent.Sub(eventAt) > c.config.Latency.OutOfOrderTolerance
+	if !future && eventAt.After(c.latestEvent) {
+		c.latestEvent = eventAt
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	windowState := c.getOrCreateWindow(windowEnd)
+	if windowState.latency == nil {
+		windowState.latency = newLatencyStats()
+	}
+	windowState.latency.add(now.Sub(eventAt).Seconds())
+	if future {
+		windowState.latency.future++
+	}
+	if outOfOrder {
+		windowState.latency.outOfOrder++
 	}
 }
 
-// getOrCreateFeatureStats retrieves or initializes the stats struct for a given window/feature.
-// It acquires and releases the lock internally.
-func (c *Calculator) getOrCreateFeatureStats(windowEnd time.Time, featureName string) *FeatureStats {
+// observeCorrelations adds the message's value pairs to its window's correlations.
+// Messages lacking a numerical value for either field of a pair are ignored for that pair.
+func (c *Calculator) observeCorrelations(msg message.DynamicMessage, windowEnd time.Time) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	windowState := c.getOrCreateWindow(windowEnd)
+	for i, corr := range c.config.Correlations {
+		x, ok := msg.GetFloat64(corr.Features[0])
+		if !ok {
+			continue
+		}
+		y, ok := msg.GetFloat64(corr.Features[1])
+		if !ok {
+			continue
+		}
+		if windowState.correlations == nil {
+			windowState.correlations = make([]*coMoments, len(c.config.Correlations))
+		}
+		if windowState.correlations[i] == nil {
+			windowState.correlations[i] = &coMoments{}
+		}
+		windowState.correlations[i].add(*x, *y)
+	}
+}
+
+// getOrCreateState returns the state of a window or its late bucket, creating them if
+// needed. MUST be called with the mutex held.
+func (c *Calculator) getOrCreateState(window windowKey) *windowInfo {
+	windowState := c.getOrCreateWindow(window.end)
+	if !window.late {
+		return windowState
+	}
+	if windowState.late == nil {
+		windowState.late = newWindowInfo(windowState.windowStart, windowState.windowEnd)
+		windowState.late.lateBucket = true
+	}
+	return windowState.late
+}
+
+// getOrCreateWindow returns the state of a window, creating it if needed. MUST be called with the mutex held.
+func (c *Calculator) getOrCreateWindow(windowEnd time.Time) *windowInfo {
 	windowState, exists := c.windowStates[windowEnd]
 	if !exists {
 		windowStart := windowEnd.Add(-c.config.WindowSize)
 		windowState = newWindowInfo(windowStart, windowEnd)
 		c.windowStates[windowEnd] = windowState
-		c.logger.Debug("Created new state for window", zap.Time("window_end", windowEnd))
-	}
-
-	stats, exists := windowState.features[featureName]
-	if !exists {
-		stats = &FeatureStats{}
-		windowState.features[featureName] = stats
+		c.logger.Debug("Created new state for window", logging.WindowEnd(windowEnd))
 	}
-	return stats
+	return windowState
 }
 
 // flushWindows finds windows completed by 'cutoffTime', calculates their stats,
 // sends results downstream, and removes them from the state.
 func (c *Calculator) flushWindows(cutoffTime time.Time) {
 	completedWindows := c.collectAndRemoveCompletedWindows(cutoffTime)
+	if c.partials != nil {
+		c.addEmptyPartials(cutoffTime, completedWindows)
+	}
+	if c.throughput != nil && c.partials == nil {
+		// Windows without messages have no state, so throughput is reported up to the cutoff
+		defer c.emitThroughput(context.Background(), cutoffTime, completedWindows, false)
+	}
 
 	if len(completedWindows) == 0 {
 		return
@@ -153,7 +543,102 @@ func (c *Calculator) flushWindows(cutoffTime time.Time) {
 
 	// Process each completed window outside the main lock for calculations/sending
 	for windowEnd, windowState := range completedWindows {
-		c.processAndSendWindowResults(windowEnd, windowState)
+		c.completeWindow(context.Background(), windowEnd, windowState, false)
+	}
+	if c.config.EventTime.Enabled && c.config.EventTime.LatePolicy == config.LatePolicyReemit {
+		c.retain(cutoffTime, completedWindows)
+	}
+}
+
+// drainWindows emits every open window, including the current partial one, oldest first.
+// Results wait for room downstream until ctx is done instead of being dropped.
+func (c *Calculator) drainWindows(ctx context.Context) {
+	// No open window ends later than the longest window size from now
+	now := c.clock.Now()
+	c.closeOpenSessions(now)
+	windows := c.collectAndRemoveCompletedWindows(now.Add(longestWindow(c.config, c.registry.Features())))
+	if c.throughput != nil && c.partials == nil {
+		// The window in progress is partial, so its throughput is not reported
+		defer c.emitThroughput(ctx, now, windows, true)
+	}
+	ends := make([]time.Time, 0, len(windows))
+	for windowEnd := range windows {
+		ends = append(ends, windowEnd)
+	}
+	sort.Slice(ends, func(i, j int) bool { return ends[i].Before(ends[j]) })
+
+	c.logger.Info("Draining open windows", zap.Int("window_count", len(ends)))
+	for _, windowEnd := range ends {
+		if ctx.Err() != nil {
+			return
+		}
+		c.completeWindow(ctx, windowEnd, windows[windowEnd], true)
+	}
+}
+
+// completeWindow evaluates a completed window, or publishes it as a partial when the
+// calculator is scaled out.
+func (c *Calculator) completeWindow(ctx context.Context, windowEnd time.Time, windowState *windowInfo, block bool) {
+	if c.partials == nil {
+		c.processAndSendWindowResults(ctx, windowEnd, windowState, block)
+		return
+	}
+	raw, err := c.encodePartial(windowState)
+	if err != nil {
+		c.logger.Error("Failed to encode partial window", logging.WindowEnd(windowEnd), zap.Error(err))
+		return
+	}
+	if block {
+		select {
+		case c.partials <- raw:
+		case <-ctx.Done():
+		}
+		return
+	}
+	select {
+	case c.partials <- raw:
+	default:
+		c.metrics.partialsPublished.WithLabelValues("dropped").Inc()
+		c.stats.addDropped(channelPartialWindows)
+		c.logger.Warn("Partial window channel full, dropping partial", logging.WindowEnd(windowEnd))
+	}
+}
+
+// addEmptyPartials adds an empty window to windows for every window completed by cutoff
+// since the last one published that had no message, so the merger hears from every
+// instance even when its partitions are idle.
+func (c *Calculator) addEmptyPartials(cutoff time.Time, windows map[time.Time]*windowInfo) {
+	size := c.config.WindowSize
+	for end := c.partialEnd.Add(size); !end.After(cutoff); end = end.Add(size) {
+		if _, ok := windows[end]; !ok {
+			windows[end] = newWindowInfo(end.Add(-size), end)
+		}
+		c.partialEnd = end
+	}
+}
+
+// evaluateMerged evaluates a window merged from the instances' partials, reporting its
+// throughput like a window of the instance's own.
+func (c *Calculator) evaluateMerged(ctx context.Context, w *windowInfo, block bool) {
+	c.processAndSendWindowResults(ctx, w.windowEnd, w, block)
+	if c.throughput != nil {
+		c.emitThroughput(ctx, w.windowEnd, map[time.Time]*windowInfo{w.windowEnd: w}, block)
+	}
+}
+
+// drainMerged evaluates the merger's remaining windows until it closes their channel or
+// ctx is done.
+func (c *Calculator) drainMerged(ctx context.Context) {
+	for c.merged != nil {
+		select {
+		case w, ok := <-c.merged:
+			if !ok {
+				return
+			}
+			c.evaluateMerged(ctx, w, true)
+		case <-ctx.Done():
+			return
+		}
 	}
 }
 
@@ -167,47 +652,188 @@ func (c *Calculator) collectAndRemoveCompletedWindows(cutoffTime time.Time) map[
 	for windowEnd, windowState := range c.windowStates {
 		// A window is complete if its end time is less than or equal to the cutoff
 		if !windowEnd.After(cutoffTime) {
+			c.spill.release(windowState)
 			windowsToProcess[windowEnd] = windowState
 			delete(c.windowStates, windowEnd)
 		}
 	}
+	c.mergeShards(cutoffTime, windowsToProcess)
 	return windowsToProcess
 }
 
 // processAndSendWindowResults calculates final stats and sends them downstream.
-// Accepts windowInfo struct.
-func (c *Calculator) processAndSendWindowResults(windowEnd time.Time, windowState *windowInfo) {
+// Accepts windowInfo struct. With block set, sends wait for room until ctx is done;
+// otherwise results are dropped when the output channel is full.
+func (c *Calculator) processAndSendWindowResults(ctx context.Context, windowEnd time.Time, windowState *windowInfo, block bool) {
+	ctx, span := tracer.Start(ctx, "window.flush", trace.WithAttributes(
+		attribute.String("window_end", windowEnd.Format(time.RFC3339)),
+		attribute.Int("feature_count", len(windowState.features)),
+	))
+	defer span.End()
+	defer observeSeconds(ctx, telemetry.flushDuration, time.Now())
+
 	sugar := c.logger.Sugar()
 	sugar.Debugw("Flushing window",
-		zap.Time("window_end", windowEnd),
+		logging.WindowEnd(windowEnd),
 		zap.Int("feature_count", len(windowState.features)), // Use features map from windowInfo
 	)
 
-	for featureName, stats := range windowState.features {
-		if stats.count == 0 {
+	if !c.sendFeatureResults(ctx, sugar, windowState, windowEnd, block) {
+		return
+	}
+	if late := windowState.late; late != nil && !c.sendFeatureResults(ctx, sugar, late, windowEnd, block) {
+		return
+	}
+	if windowState.revision > 0 {
+		return // Window-level results were emitted with the window's first emission
+	}
+
+	if c.latency != nil && windowState.latency != nil {
+		c.sendLatency(ctx, windowState.latency.result(c.config.Latency.TimestampField, windowState.windowStart, windowEnd), block)
+	}
+	for i, moments := range windowState.correlations {
+		if moments == nil {
 			continue
 		}
-
-		mean, variance := c.calculateMeanVariance(stats, featureName, windowState.windowStart)
-
-		result := AggregationResult{
-			FeatureName: featureName,
+		c.sendCorrelation(ctx, CorrelationResult{
+			Config:      c.config.Correlations[i],
 			WindowStart: windowState.windowStart,
 			WindowEnd:   windowEnd,
-			Count:       stats.count,
-			NullCount:   stats.nullCount,
-			Mean:        mean,
-			Variance:    variance,
+			Count:       moments.count,
+			Coefficient: moments.coefficient(),
+		}, block)
+	}
+}
+
+// sendFeatureResults sends the results of a window's features and their segments, in
+// dependency order so the alerter sees upstream violations before derived ones. It
+// returns false if ctx is done.
+func (c *Calculator) sendFeatureResults(ctx context.Context, sugar *zap.SugaredLogger, windowState *windowInfo, windowEnd time.Time, block bool) bool {
+	versions := windowState.sortedVersions()
+	for _, featureCfg := range c.registry.Features() {
+		for _, version := range versions {
+			name := versionedName(featureCfg.Name, version)
+			stats, exists := windowState.features[name]
+			if !exists || stats.count == 0 {
+				continue // Nothing processed (e.g., every message was sampled out)
+			}
+
+			results := []AggregationResult{c.newResult(featureCfg, name, version, stats, windowState, windowEnd)}
+			if featureCfg.GroupBy != "" {
+				results = append(results, c.segmentResults(featureCfg, version, windowState, windowEnd)...)
+			}
+			for _, result := range results {
+				if !c.sendResult(ctx, sugar, result, block) {
+					return false
+				}
+			}
 		}
+	}
+	return true
+}
 
+// sendCorrelation sends a window's correlation downstream, like a feature result.
+func (c *Calculator) sendCorrelation(ctx context.Context, result CorrelationResult, block bool) {
+	if block {
+		select {
+		case c.correlations <- result:
+		case <-ctx.Done():
+		}
+		return
+	}
+	select {
+	case c.correlations <- result:
+	default:
+		c.stats.addDropped(channelCorrelationResults)
+		c.logger.Warn("Correlation output channel full, dropping result",
+			zap.String("correlation", result.Config.Name),
+			logging.WindowEnd(result.WindowEnd),
+		)
+	}
+}
+
+// newResult computes the final statistics of a feature, or one of its segments, for a
+// model version in a window.
+func (c *Calculator) newResult(featureCfg config.FeatureConfig, name, version string, stats *FeatureStats, windowState *windowInfo, windowEnd time.Time) AggregationResult {
+	mean, variance := c.calculateMeanVariance(stats)
+	var sketches *schema.Sketches
+	if c.config.Sketches.Enabled {
+		sketches = stats.sketchPayload() // Not the cardinality kept only for distinct thresholds
+	}
+	return AggregationResult{
+		FeatureName:       name,
+		ModelVersion:      version,
+		Tenant:            featureCfg.Tenant,
+		WindowStart:       windowEnd.Add(-featureCfg.Window(c.config.WindowSize)),
+		WindowEnd:         windowEnd,
+		Count:             stats.count,
+		NullCount:         stats.nullCount,
+		MissingCount:      stats.missingCount,
+		TypeMismatchCount: stats.typeMismatchCount,
+		ValueCount:        stats.valueCount,
+		ZeroCount:         stats.zeroCount,
+		TrueCount:         stats.trueCount,
+		FalseCount:        stats.falseCount,
+		Mean:              mean,
+		Variance:          variance,
+		Constant:          stats.constant(),
+		Categories:        stats.categories,
+		DistinctEstimate:  stats.distinctEstimate(),
+		SampledOut:        stats.sampledOut,
+		Sketches:          sketches,
+		Text:              stats.textStats(featureCfg.ValuePattern != ""),
+		Vector:            c.vectorResult(featureCfg, stats.vector),
+		Percentiles:       stats.percentileStats(),
+		Outliers:          c.outlierStats(featureCfg, name, stats, mean, variance),
+		Revision:          windowState.revision,
+		Late:              windowState.lateBucket,
+		Samples:           stats.samples.samples(),
+		Exemplars:         stats.exemplars.exemplars(),
+	}
+}
+
+// sendResult sends a result downstream. With block set, it waits for room until ctx is
+// done and returns false if it is; otherwise the result is dropped when the channel is full.
+func (c *Calculator) sendResult(ctx context.Context, sugar *zap.SugaredLogger, result AggregationResult, block bool) bool {
+	result.flushed = time.Now()
+	if block {
 		select {
 		case c.output <- result:
-			sugar.Debugw("Sent aggregation result", zap.String("feature_name", featureName), zap.Time("window_end", windowEnd))
-		default:
-			sugar.Warnw("Calculator output channel full, dropping result",
-				zap.String("feature_name", featureName),
-				zap.Time("window_end", windowEnd),
+			sugar.Debugw("Sent aggregation result", logging.Feature(result.FeatureName), logging.WindowEnd(result.WindowEnd))
+			return true
+		case <-ctx.Done():
+			sugar.Warnw("Shutdown deadline reached, dropping remaining results",
+				logging.WindowEnd(result.WindowEnd),
 			)
+			return false
+		}
+	}
+	select {
+	case c.output <- result:
+		sugar.Debugw("Sent aggregation result", logging.Feature(result.FeatureName), logging.WindowEnd(result.WindowEnd))
+	default:
+		c.stats.addDropped(channelAggregationResults)
+		sugar.Warnw("Calculator output channel full, dropping result",
+			logging.Feature(result.FeatureName),
+			logging.WindowEnd(result.WindowEnd),
+		)
+	}
+	return true
+}
+
+// sendLatency sends a window's latency summary downstream, like a feature result.
+func (c *Calculator) sendLatency(ctx context.Context, result LatencyResult, block bool) {
+	if block {
+		select {
+		case c.latency <- result:
+		case <-ctx.Done():
 		}
+		return
+	}
+	select {
+	case c.latency <- result:
+	default:
+		c.stats.addDropped(channelLatencyResults)
+		c.logger.Warn("Latency output channel full, dropping result", logging.WindowEnd(result.WindowEnd))
 	}
 }
@@ -0,0 +1,118 @@
+package pipeline
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/sanspareilsmyn/featurelens/internal/config"
+	"github.com/sanspareilsmyn/featurelens/internal/logging"
+	"github.com/sanspareilsmyn/featurelens/internal/message"
+)
+
+// Groups of messages that have no value of their own.
+const (
+	NoGroup    = "__none__"  // The groupBy field is absent or null
+	OtherGroup = "__other__" // Values seen after a feature's maxGroups distinct groups
+)
+
+// Segment identifies the group of messages a per-group result covers.
+type Segment struct {
+	Feature string // Feature the segment belongs to
+	GroupBy string // Message field the feature is grouped by
+	Group   string // Value of the groupBy field
+}
+
+// segmentName is the feature name of a segment's results, e.g. "feature_a[country=US]".
+func segmentName(s Segment) string {
+	return s.Feature + "[" + s.GroupBy + "=" + s.Group + "]"
+}
+
+// groupValue formats a message's value of the groupBy field as a group name.
+func groupValue(msg message.DynamicMessage, field string) string {
+	switch v := msg[field].(type) {
+	case nil:
+		return NoGroup
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// getOrCreateGroupStats retrieves or initializes the stats of the message's group for a
+// feature with a groupBy field. The first maxGroups distinct groups are tracked for the
+// lifetime of the calculator; later ones share OtherGroup, which bounds per-segment state
+// here and in the alerter. It acquires and releases the lock internally.
+func (c *Calculator) getOrCreateGroupStats(window windowKey, featureCfg config.FeatureConfig, version string, msg message.DynamicMessage) *FeatureStats {
+	group := groupValue(msg, featureCfg.GroupBy)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	known := c.groups[featureCfg.Name]
+	if known == nil {
+		known = make(map[string]struct{})
+		c.groups[featureCfg.Name] = known
+	}
+	if _, ok := known[group]; !ok {
+		if len(known) < featureCfg.MaxGroups {
+			known[group] = struct{}{}
+		} else {
+			if _, warned := known[OtherGroup]; !warned {
+				known[OtherGroup] = struct{}{} // Also marks the limit as logged
+				c.logger.Warn("Group limit reached, further groups share the other segment",
+					logging.Feature(featureCfg.Name),
+					zap.String("group_by", featureCfg.GroupBy),
+					zap.Int("max_groups", featureCfg.MaxGroups),
+				)
+			}
+			group = OtherGroup
+		}
+	}
+
+	windowState := c.getOrCreateState(window)
+	if windowState.groups == nil {
+		windowState.groups = make(map[string]map[string]*FeatureStats)
+	}
+	name := versionedName(featureCfg.Name, version)
+	groups := windowState.groups[name]
+	if groups == nil {
+		groups = make(map[string]*FeatureStats)
+		windowState.groups[name] = groups
+	}
+	key := stateKey{windowEnd: window.end, name: name, group: group, segment: true, late: window.late}
+	stats, exists := groups[group]
+	if !exists {
+		stats = c.spill.take(key)
+		groups[group] = stats
+	}
+	c.spill.touch(key, stats)
+	return stats
+}
+
+// segmentResults builds the results of a feature's segments for a model version in a
+// window, ordered by group.
+func (c *Calculator) segmentResults(featureCfg config.FeatureConfig, version string, windowState *windowInfo, windowEnd time.Time) []AggregationResult {
+	groups := windowState.groups[versionedName(featureCfg.Name, version)]
+	names := make([]string, 0, len(groups))
+	for group := range groups {
+		names = append(names, group)
+	}
+	sort.Strings(names)
+
+	results := make([]AggregationResult, 0, len(groups))
+	for _, group := range names {
+		segment := &Segment{Feature: featureCfg.Name, GroupBy: featureCfg.GroupBy, Group: group}
+		name := versionedName(segmentName(*segment), version)
+		result := c.newResult(featureCfg, name, version, groups[group], windowState, windowEnd)
+		result.Segment = segment
+		results = append(results, result)
+	}
+	return results
+}
@@ -2,10 +2,14 @@ package pipeline
 
 import (
 	"github.com/sanspareilsmyn/featurelens/internal/config"
+	"github.com/sanspareilsmyn/featurelens/internal/logging"
 	"github.com/sanspareilsmyn/featurelens/internal/message"
+	"github.com/sanspareilsmyn/featurelens/internal/sketch"
 	"go.uber.org/zap"
 	"math"
-	"time"
+	"regexp"
+	"strconv"
+	"unicode/utf8"
 )
 
 // processNonNullValue attempts to process a non-null value based on the feature's metric type.
@@ -13,62 +17,194 @@ import (
 func (c *Calculator) processNonNullValue(stats *FeatureStats, msg message.DynamicMessage, featureCfg config.FeatureConfig) bool {
 	switch featureCfg.MetricType {
 	case "numerical":
-		return c.processNumericalValue(stats, msg, featureCfg.Name)
+		return c.processNumericalValue(stats, msg, featureCfg)
+
+	case "categorical":
+		return c.processCategoricalValue(stats, msg, featureCfg)
+
+	case "text":
+		return c.processTextValue(stats, msg, featureCfg)
+
+	case "vector":
+		return c.processVectorValue(stats, msg, featureCfg)
+
+	case "latency":
+		return c.processLatencyValue(stats, msg, featureCfg)
+
+	case "boolean":
+		return c.processBooleanValue(stats, msg, featureCfg)
 
-	// TODO: add categorical!
-	// case "categorical": // Future extension point
-	//     return c.processCategoricalValue(stats, msg, featureCfg.Name)
 	default:
 		c.logger.Debug("Skipping feature update due to unsupported metric type",
-			zap.String("feature_name", featureCfg.Name),
+			logging.Feature(featureCfg.Name),
 			zap.String("metric_type", featureCfg.MetricType),
 		)
 		return false
 	}
 }
 
+// observeDistinct adds a value to the feature's distinct value estimate. Numbers are
+// counted by their shortest representation, so 1 and 1.0 are the same value.
+func (c *Calculator) observeDistinct(stats *FeatureStats, msg message.DynamicMessage, field string) {
+	var value string
+	if s, ok := msg.GetString(field); ok {
+		value = s
+	} else if v, ok := msg.GetFloat64(field); ok {
+		value = strconv.FormatFloat(*v, 'g', -1, 64)
+	} else {
+		return
+	}
+	if stats.cardinality == nil {
+		stats.cardinality, _ = sketch.NewCardinality(c.config.Sketches.Precision) // Validated at config load
+	}
+	stats.cardinality.Add(value)
+}
+
 // processNumericalValue attempts to parse a float64 value and update numerical stats.
+// Values are added to the quantile sketch when sketches are exported or the feature's
+// outliers are counted.
 // Returns true on success, false on failure (e.g., parsing error).
-func (c *Calculator) processNumericalValue(stats *FeatureStats, msg message.DynamicMessage, featureName string) bool {
-	floatValPtr, ok := msg.GetFloat64(featureName)
+func (c *Calculator) processNumericalValue(stats *FeatureStats, msg message.DynamicMessage, featureCfg config.FeatureConfig) bool {
+	floatValPtr, ok := msg.GetFloat64(featureCfg.FieldName())
 	if !ok {
 		// GetFloat64 failed to parse the value as a number (value exists, is not null)
 		return false
 	}
 	floatVal := *floatValPtr
-	stats.sum += floatVal
-	stats.sumSq += floatVal * floatVal
+	if stats.valueCount == 0 {
+		stats.min, stats.max = floatVal, floatVal
+	} else {
+		stats.min, stats.max = min(stats.min, floatVal), max(stats.max, floatVal)
+	}
+	if floatVal == 0 {
+		stats.zeroCount++
+	}
+	stats.valueCount++
+	delta := floatVal - stats.mean // Deviation from the previous mean
+	stats.mean += delta / float64(stats.valueCount)
+	stats.m2 += delta * (floatVal - stats.mean)
+	if sketches := c.config.Sketches; sketches.Enabled || featureCfg.Outliers != nil {
+		if stats.quantile == nil {
+			accuracy := sketches.RelativeAccuracy // Validated at config load
+			if !sketches.Enabled {
+				accuracy = latencyAccuracy
+			}
+			stats.quantile, _ = sketch.NewQuantile(accuracy)
+		}
+		stats.quantile.Add(floatVal)
+	}
 	return true
 }
 
-// calculateMeanVariance computes mean and variance from FeatureStats.
-// Added featureName and windowStart for better context in logs.
-func (c *Calculator) calculateMeanVariance(stats *FeatureStats, featureName string, windowStart time.Time) (mean, variance float64) {
-	validCount := stats.count - stats.nullCount
-	if validCount <= 0 {
-		return math.NaN(), math.NaN()
+// processLatencyValue aggregates a duration in milliseconds like a numerical value, and
+// into the feature's percentile sketch.
+// Returns false if the value is not a number.
+func (c *Calculator) processLatencyValue(stats *FeatureStats, msg message.DynamicMessage, featureCfg config.FeatureConfig) bool {
+	if !c.processNumericalValue(stats, msg, featureCfg) {
+		return false
+	}
+	if stats.percentiles == nil {
+		stats.percentiles, _ = sketch.NewQuantile(latencyAccuracy) // Constant accuracy, always valid
 	}
+	v, _ := msg.GetFloat64(featureCfg.FieldName())
+	stats.percentiles.Add(*v)
+	return true
+}
 
-	mean = stats.sum / float64(validCount)
-
-	// Variance = E[X^2] - (E[X])^2 = (SumSq / N) - Mean^2
-	meanSq := mean * mean
-	sumSqAvg := stats.sumSq / float64(validCount)
-	variance = sumSqAvg - meanSq
-
-	// Correct for potential floating point inaccuracies yielding small negative variance
-	if variance < 0 && variance > -1e-9 { // Allow for tiny floating point errors
-		variance = 0
-	} else if variance < 0 {
-		c.logger.Warn("Negative variance calculated, setting to 0",
-			zap.String("feature_name", featureName),
-			zap.Time("window_start", windowStart),
-			zap.Float64("calculated_variance", variance),
-			zap.Int64("valid_count", validCount),
-			zap.Float64("sum_sq", stats.sumSq),
-			zap.Float64("mean", mean),
-		)
-		variance = 0
+// processCategoricalValue counts occurrences of a string value, or of a bool or number
+// value by its JSON text when the feature expects one.
+// Returns false if the value is not of the expected type, a string by default.
+func (c *Calculator) processCategoricalValue(stats *FeatureStats, msg message.DynamicMessage, featureCfg config.FeatureConfig) bool {
+	strVal, ok := categoryValue(msg, featureCfg)
+	if !ok {
+		return false
+	}
+	c.observeString(stats, strVal, featureCfg.ValuePattern)
+	if stats.categories == nil {
+		stats.categories = make(map[string]int64)
+	}
+	stats.categories[strVal]++
+	if sketches := c.config.Sketches; sketches.Enabled {
+		if stats.cardinality == nil {
+			// Parameters are validated at config load
+			stats.cardinality, _ = sketch.NewCardinality(sketches.Precision)
+			stats.frequency, _ = sketch.NewFrequency(sketches.FrequencyWidth, sketches.FrequencyDepth)
+		}
+		stats.cardinality.Add(strVal)
+		stats.frequency.Add(strVal, 1)
+	}
+	return true
+}
+
+// processBooleanValue counts true and false values.
+// Returns false if the value is not a boolean.
+func (c *Calculator) processBooleanValue(stats *FeatureStats, msg message.DynamicMessage, featureCfg config.FeatureConfig) bool {
+	b, ok := msg[featureCfg.FieldName()].(bool)
+	if !ok {
+		return false
+	}
+	if b {
+		stats.trueCount++
+	} else {
+		stats.falseCount++
+	}
+	return true
+}
+
+// categoryValue returns the category of the message's value of a categorical feature.
+func categoryValue(msg message.DynamicMessage, featureCfg config.FeatureConfig) (string, bool) {
+	field := featureCfg.FieldName()
+	switch featureCfg.ExpectedType {
+	case config.ExpectedTypeBool:
+		b, ok := msg[field].(bool)
+		return strconv.FormatBool(b), ok
+	case config.ExpectedTypeNumber:
+		if v, ok := msg.GetFloat64(field); ok {
+			return strconv.FormatFloat(*v, 'g', -1, 64), true
+		}
+		return "", false
+	default:
+		return msg.GetString(field)
+	}
+}
+
+// processTextValue measures a free-form string value. Unlike categorical values, text
+// values are not counted individually, so high-cardinality fields (IDs, free text) stay cheap.
+// Returns false if the value is not a string.
+func (c *Calculator) processTextValue(stats *FeatureStats, msg message.DynamicMessage, featureCfg config.FeatureConfig) bool {
+	strVal, ok := msg.GetString(featureCfg.FieldName())
+	if !ok {
+		return false
+	}
+	c.observeString(stats, strVal, featureCfg.ValuePattern)
+	return true
+}
+
+// observeString updates the length and pattern statistics of a string value.
+func (c *Calculator) observeString(stats *FeatureStats, value, pattern string) {
+	length := int64(utf8.RuneCountInString(value))
+	stats.stringCount++
+	stats.lengthSum += length
+	stats.lengthMax = max(stats.lengthMax, length)
+	if pattern == "" {
+		return
+	}
+	re, ok := c.patterns[pattern]
+	if !ok {
+		re = regexp.MustCompile(pattern) // Validated at config load
+		c.patterns[pattern] = re
+	}
+	if re.MatchString(value) {
+		stats.patternMatches++
+	}
+}
+
+// calculateMeanVariance computes the mean and (population) variance from FeatureStats.
+// Each term of the sum of squared deviations is non-negative, so unlike the variance of
+// a sum of squares it cannot come out negative.
+func (c *Calculator) calculateMeanVariance(stats *FeatureStats) (mean, variance float64) {
+	if stats.valueCount <= 0 {
+		return math.NaN(), math.NaN()
 	}
-	return mean, variance
+	return stats.mean, max(stats.m2, 0) / float64(stats.valueCount)
 }
@@ -0,0 +1,153 @@
+package pipeline
+
+import (
+	"hash/fnv"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/sanspareilsmyn/featurelens/internal/config"
+	"github.com/sanspareilsmyn/featurelens/internal/message"
+)
+
+// calculatorShard updates the stats of a subset of the features on a goroutine of its own,
+// with pipeline.calculatorWorkers above 1. Its calculator holds the window state of its
+// features only, along with their per-feature state (value patterns, vector centroids,
+// tracked groups), so shards share nothing but the configuration and thread-safe
+// components, and each takes only its own, uncontended mutex.
+type calculatorShard struct {
+	calc  *Calculator
+	index int
+	count int
+	owned []config.FeatureConfig // Features of the shard, in registry order
+	seen  int                    // Registry features assigned so far; the registry only grows
+	jobs  chan []routedMessage
+}
+
+// routedMessage is a message with the window, model version, tenant and topic its feature
+// stats are updated for, as determined by the processing loop.
+type routedMessage struct {
+	msg     message.DynamicMessage
+	window  windowKey
+	version string
+	tenant  string
+	topic   string
+}
+
+// shardOf returns the shard holding a feature's stats.
+func shardOf(featureName string, shards int) int {
+	h := fnv.New32a()
+	h.Write([]byte(featureName))
+	return int(h.Sum32() % uint32(shards))
+}
+
+// shard splits the calculator's feature stats across n shards. It must be called after
+// restrict.
+func (c *Calculator) shard(n int) {
+	for i := range n {
+		c.shards = append(c.shards, &calculatorShard{
+			calc: &Calculator{
+				config:       c.config,
+				registry:     c.registry,
+				logger:       c.logger,
+				metrics:      c.metrics,
+				sampler:      c.sampler,
+				patterns:     make(map[string]*regexp.Regexp),
+				groups:       make(map[string]map[string]struct{}),
+				dimensions:   make(map[string]int),
+				centroids:    make(map[string][]float64),
+				windowStates: make(map[time.Time]*windowInfo),
+				owns:         c.owns,
+				clock:        c.clock,
+			},
+			index: i,
+			count: n,
+		})
+	}
+}
+
+// startShards starts a goroutine per shard, stopped by stopShards.
+func (c *Calculator) startShards(done *sync.WaitGroup) {
+	for _, s := range c.shards {
+		s.jobs = make(chan []routedMessage)
+		go func() {
+			for batch := range s.jobs {
+				s.update(batch)
+				done.Done()
+			}
+		}()
+	}
+}
+
+func (c *Calculator) stopShards() {
+	for _, s := range c.shards {
+		close(s.jobs)
+	}
+}
+
+// updateShards hands the messages routed since the last call to every shard and waits
+// until all updated their features' stats, so that window state is never read while a
+// shard is writing it and messages can be released afterwards.
+func (c *Calculator) updateShards(done *sync.WaitGroup) {
+	if len(c.routed) == 0 {
+		return
+	}
+	done.Add(len(c.shards))
+	for _, s := range c.shards {
+		s.jobs <- c.routed
+	}
+	done.Wait()
+	clear(c.routed) // Drop the references to the messages
+	c.routed = c.routed[:0]
+}
+
+// update updates the stats of the shard's features with a batch of messages.
+func (s *calculatorShard) update(batch []routedMessage) {
+	features := s.calc.registry.Features()
+	for _, f := range features[s.seen:] {
+		if shardOf(f.Name, s.count) == s.index && (s.calc.owns == nil || s.calc.owns(f)) {
+			s.owned = append(s.owned, f)
+		}
+	}
+	s.seen = len(features)
+	for _, m := range batch {
+		s.calc.updateFeatures(s.owned, m)
+	}
+}
+
+// mergeShards moves the shards' windows completed by cutoff into windows, combining them
+// with the processing loop's windows of the same end. Shards hold distinct features, so
+// their stats are moved as they are. Shards must be idle.
+func (c *Calculator) mergeShards(cutoff time.Time, windows map[time.Time]*windowInfo) {
+	for _, s := range c.shards {
+		for end, state := range s.calc.collectAndRemoveCompletedWindows(cutoff) {
+			w, ok := windows[end]
+			if !ok {
+				windows[end] = state
+				continue
+			}
+			for name, stats := range state.features {
+				w.features[name] = stats
+			}
+			for name, groups := range state.groups {
+				if w.groups == nil {
+					w.groups = make(map[string]map[string]*FeatureStats)
+				}
+				w.groups[name] = groups
+			}
+			for version := range state.versions {
+				w.versions[version] = struct{}{}
+			}
+		}
+	}
+}
+
+// shardsIdle reports whether no shard has an open window.
+func (c *Calculator) shardsIdle() bool {
+	for _, s := range c.shards {
+		if !s.calc.idle() {
+			return false
+		}
+	}
+	return true
+}
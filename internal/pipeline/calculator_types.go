@@ -1,31 +1,262 @@
 package pipeline
 
-import "time"
+import (
+	"math"
+	"time"
+
+	"github.com/sanspareilsmyn/featurelens/internal/schema"
+	"github.com/sanspareilsmyn/featurelens/internal/sketch"
+)
 
 // AggregationResult holds the calculated statistics for a feature in a window.
 type AggregationResult struct {
-	FeatureName string
-	WindowStart time.Time
-	WindowEnd   time.Time
-	Count       int64
-	NullCount   int64
-	Mean        float64
-	Variance    float64
+	FeatureName       string // Qualified with the segment and model version, if any
+	ModelVersion      string // Model version of the messages covered, empty without pipeline.versionField
+	Tenant            string // Tenant of the feature, empty for features without one
+	WindowStart       time.Time
+	WindowEnd         time.Time
+	Count             int64
+	NullCount         int64 // Messages where the feature's value is explicitly null
+	MissingCount      int64 // Messages without the feature's key
+	TypeMismatchCount int64 // Non-null values that are not of the feature's metric type, e.g. numbers sent as strings
+	ValueCount        int64 // Numerical values aggregated into Mean and Variance
+	ZeroCount         int64 // Numerical values that are exactly zero
+	TrueCount         int64 // Boolean values that are true, boolean features only
+	FalseCount        int64
+	Mean              float64
+	Variance          float64
+	Constant          bool              // At least two values were observed and all were identical
+	Categories        map[string]int64  // Value frequencies, categorical features only
+	DistinctEstimate  float64           // Approximate number of distinct values, NaN unless estimated
+	SampledOut        int64             // Messages skipped by sampling; Count excludes them
+	Sketches          *schema.Sketches  // Mergeable sketches of the window's values, nil unless enabled
+	Text              *TextStats        // String value statistics, nil unless string values were observed
+	Vector            *VectorStats      // Array value statistics of vector features, nil unless arrays were observed
+	Percentiles       *Percentiles      // Of latency features, nil unless values were observed
+	Outliers          *OutlierStats     // Of features with outliers, nil unless values were observed
+	Segment           *Segment          // Group of messages covered, nil for a feature's overall result
+	Revision          int               // Times the window was re-emitted with late messages, 0 for its first emission
+	Late              bool              // Covers only late messages of already flushed windows, received during the window
+	Samples           []string          // Uniform sample of the window's non-null values, nil unless pipeline.valueSamples is enabled
+	Exemplars         []schema.Exemplar // Trace IDs of the window's messages, nil unless pipeline.exemplars is enabled
+
+	// Custom holds the window's custom metrics by name, set by the alerter before checks
+	// run; nil unless one of the feature's custom metrics is defined for the window.
+	Custom map[string]float64
+
+	flushed time.Time // When the calculator sent the result, zero for results of other origins
+}
+
+// TextStats describes the string values of a categorical or text feature in a window.
+type TextStats struct {
+	Values           int64   // String values measured
+	AvgLength        float64 // In characters
+	MaxLength        int64
+	PatternMatchRate float64 // Share of values matching the feature's valuePattern, NaN without one
+}
+
+// Percentiles summarizes the values of a latency feature in a window, within the relative
+// accuracy of a quantile sketch.
+type Percentiles struct {
+	P50 float64
+	P95 float64
+	P99 float64
+}
+
+// OutlierStats counts the numerical values of a window outside the feature's outlier
+// bounds.
+type OutlierStats struct {
+	Count int64
+	Rate  float64 // Share of the numerical values
+	Lower float64 // Bounds the values were compared with
+	Upper float64
+}
+
+// VectorStats describes the array values of a vector feature in a window. Well-formed
+// vectors have the expected dimensions and only finite elements.
+type VectorStats struct {
+	Values              int64   // Array values observed
+	Dimensions          int     // Expected length of the vectors
+	DimensionMismatches int64   // Values of another length
+	NonFiniteRate       float64 // Share of elements that are NaN, infinite or null
+	NormMean            float64 // Euclidean norm of the well-formed vectors, NaN without any
+	NormStdDev          float64
+	CentroidDistance    float64 // Mean cosine distance of the well-formed vectors to the baseline centroid, NaN without one
+}
+
+// dimensionMismatchRate returns the share of array values without the expected dimensions.
+func (v *VectorStats) dimensionMismatchRate() float64 {
+	return float64(v.DimensionMismatches) / float64(v.Values)
+}
+
+// ValidCount returns the number of messages with a non-null value for the feature.
+func (r AggregationResult) ValidCount() int64 {
+	return r.Count - r.NullCount - r.MissingCount
+}
+
+// rate returns n as a fraction of the window's messages, or NaN for an empty window.
+func (r AggregationResult) rate(n int64) float64 {
+	if r.Count == 0 {
+		return math.NaN()
+	}
+	return float64(n) / float64(r.Count)
+}
+
+// configName returns the name of the configured feature the result belongs to.
+func (r AggregationResult) configName() string {
+	if r.Segment != nil {
+		return r.Segment.Feature
+	}
+	return unversionedName(r.FeatureName, r.ModelVersion)
+}
+
+// outlierRate returns the share of numerical values that are outliers, or NaN unless
+// outliers were counted.
+func (r AggregationResult) outlierRate() float64 {
+	if r.Outliers == nil {
+		return math.NaN()
+	}
+	return r.Outliers.Rate
+}
+
+// zeroRate returns the share of numerical values that are exactly zero, or NaN without values.
+func (r AggregationResult) zeroRate() float64 {
+	if r.ValueCount == 0 {
+		return math.NaN()
+	}
+	return float64(r.ZeroCount) / float64(r.ValueCount)
+}
+
+// booleanRate returns n as a fraction of the window's boolean values, or NaN without any.
+func (r AggregationResult) booleanRate(n int64) float64 {
+	if r.TrueCount+r.FalseCount == 0 {
+		return math.NaN()
+	}
+	return float64(n) / float64(r.TrueCount+r.FalseCount)
 }
 
 // FeatureStats holds the running aggregates for a single feature within a window.
 type FeatureStats struct {
-	count     int64
-	nullCount int64
-	sum       float64
-	sumSq     float64
+	count             int64
+	nullCount         int64
+	missingCount      int64
+	typeMismatchCount int64
+	valueCount        int64 // Number of values aggregated into mean/m2
+	zeroCount         int64
+	trueCount         int64 // Boolean values
+	falseCount        int64
+	mean              float64          // Running mean of the values (Welford's algorithm)
+	m2                float64          // Running sum of their squared deviations from the mean
+	min, max          float64          // Of the aggregated values, valid when valueCount > 0
+	categories        map[string]int64 // Lazily allocated for categorical features
+	sampledOut        int64
+
+	// String values of categorical and text features
+	stringCount    int64
+	lengthSum      int64
+	lengthMax      int64
+	patternMatches int64
+
+	vector      *vectorStats     // Array values of vector features, lazily allocated
+	percentiles *sketch.Quantile // Values of latency features, lazily allocated
+	samples     *valueSamples    // Non-null values, lazily allocated when value samples are enabled
+	exemplars   *exemplarSet     // Trace IDs of the messages, lazily allocated when exemplars are enabled
+
+	// Sketches, lazily allocated when sketch export is enabled, or for cardinality when
+	// the feature has distinct value thresholds
+	quantile    *sketch.Quantile
+	cardinality *sketch.Cardinality
+	frequency   *sketch.Frequency
+}
+
+// distinctEstimate returns the approximate number of distinct values, or NaN if they
+// were not estimated.
+func (s *FeatureStats) distinctEstimate() float64 {
+	if s.cardinality == nil {
+		return math.NaN()
+	}
+	return float64(s.cardinality.Estimate())
+}
+
+// sketchPayload serializes the feature's sketches, or returns nil if none were kept.
+func (s *FeatureStats) sketchPayload() *schema.Sketches {
+	if s.quantile == nil && s.cardinality == nil && s.frequency == nil {
+		return nil
+	}
+	p := &schema.Sketches{}
+	if s.quantile != nil {
+		p.Quantile = s.quantile.Payload()
+	}
+	if s.cardinality != nil {
+		p.Cardinality = s.cardinality.Payload()
+	}
+	if s.frequency != nil {
+		p.Frequency = s.frequency.Payload()
+	}
+	return p
+}
+
+// percentileStats summarizes the values of a latency feature, or returns nil if none were
+// observed.
+func (s *FeatureStats) percentileStats() *Percentiles {
+	if s.percentiles == nil {
+		return nil
+	}
+	return &Percentiles{
+		P50: s.percentiles.Quantile(0.50),
+		P95: s.percentiles.Quantile(0.95),
+		P99: s.percentiles.Quantile(0.99),
+	}
+}
+
+// constant reports whether at least two values were observed and all were identical.
+// Comparing extremes avoids the rounding error of a variance that should be zero.
+func (s *FeatureStats) constant() bool {
+	if s.categories != nil {
+		return len(s.categories) == 1 && s.stringCount > 1
+	}
+	return s.valueCount > 1 && s.min == s.max
+}
+
+// textStats summarizes the feature's string values, or returns nil if none were measured.
+func (s *FeatureStats) textStats(hasPattern bool) *TextStats {
+	if s.stringCount == 0 {
+		return nil
+	}
+	t := &TextStats{
+		Values:           s.stringCount,
+		AvgLength:        float64(s.lengthSum) / float64(s.stringCount),
+		MaxLength:        s.lengthMax,
+		PatternMatchRate: math.NaN(),
+	}
+	if hasPattern {
+		t.PatternMatchRate = float64(s.patternMatches) / float64(s.stringCount)
+	}
+	return t
 }
 
 // windowInfo holds information about a single time window and the state of all features within it.
 type windowInfo struct {
-	windowStart time.Time
-	windowEnd   time.Time
-	features    map[string]*FeatureStats // Map FeatureName to its stats within this window
+	windowStart  time.Time
+	windowEnd    time.Time
+	features     map[string]*FeatureStats               // Map FeatureName to its stats within this window
+	latency      *latencyStats                          // nil until a message with an event timestamp is processed
+	correlations []*coMoments                           // Indexed like the configured correlations, nil until a pair is observed
+	groups       map[string]map[string]*FeatureStats    // Feature name to its segments' stats by group
+	versions     map[string]struct{}                    // Model versions observed, "" for messages without one
+	messages     int64                                  // Messages processed, counted only when throughput is checked
+	fields       map[string]*fieldTypeCounts            // Value types of message fields, counted only when schema tracking is enabled
+	partitions   map[string]map[string]*partitionCounts // Feature name to its stats by partition, with partition statistics
+	revision     int                                    // Times the window was reopened by late messages
+	late         *windowInfo                            // Late messages received while the window was open, nil until one is
+	lateBucket   bool                                   // The window is another window's late bucket
+}
+
+// windowKey identifies the state a message is aggregated into: a window, or the late
+// bucket of a window.
+type windowKey struct {
+	end  time.Time
+	late bool
 }
 
 // newWindowInfo creates a new windowInfo instance.
@@ -34,5 +265,6 @@ func newWindowInfo(start, end time.Time) *windowInfo {
 		windowStart: start,
 		windowEnd:   end,
 		features:    make(map[string]*FeatureStats),
+		versions:    make(map[string]struct{}),
 	}
 }
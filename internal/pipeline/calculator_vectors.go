@@ -0,0 +1,153 @@
+package pipeline
+
+import (
+	"math"
+
+	"github.com/sanspareilsmyn/featurelens/internal/config"
+	"github.com/sanspareilsmyn/featurelens/internal/message"
+)
+
+// vectorStats holds the running aggregates of a vector feature's array values in a window.
+// Only well-formed vectors, those with the expected dimensions and finite elements, feed
+// the norm and centroid aggregates.
+type vectorStats struct {
+	values              int64 // Array values observed
+	dimensions          int   // Expected length of the vectors
+	dimensionMismatches int64
+	elements            int64
+	nonFinite           int64
+	wellFormed          int64
+	normSum             float64
+	normSumSq           float64
+	sum                 []float64 // Element-wise sum of well-formed vectors
+	unitSum             []float64 // Element-wise sum of well-formed, non-zero vectors scaled to unit length
+	unitCount           int64
+}
+
+// processVectorValue measures an array value. The expected dimensions default to the
+// length of the first vector the feature has.
+// Returns false if the value is not an array of numbers.
+func (c *Calculator) processVectorValue(stats *FeatureStats, msg message.DynamicMessage, featureCfg config.FeatureConfig) bool {
+	values, ok := msg.AppendFloat64s(c.vectorBuf[:0], featureCfg.FieldName())
+	c.vectorBuf = values
+	if !ok {
+		return false
+	}
+	if stats.vector == nil {
+		stats.vector = &vectorStats{}
+	}
+	v := stats.vector
+	v.values++
+	v.elements += int64(len(values))
+
+	dims := c.vectorDimensions(featureCfg, len(values))
+	v.dimensions = dims
+	finite := true
+	var sumSq float64
+	for _, x := range values {
+		if math.IsNaN(x) || math.IsInf(x, 0) {
+			v.nonFinite++
+			finite = false
+			continue
+		}
+		sumSq += x * x
+	}
+	if len(values) != dims {
+		v.dimensionMismatches++
+		return true
+	}
+	if !finite {
+		return true
+	}
+
+	norm := math.Sqrt(sumSq)
+	v.wellFormed++
+	v.normSum += norm
+	v.normSumSq += norm * norm
+	if v.sum == nil {
+		v.sum = make([]float64, dims)
+		v.unitSum = make([]float64, dims)
+	}
+	for i, x := range values {
+		v.sum[i] += x
+	}
+	if norm > 0 {
+		v.unitCount++
+		for i, x := range values {
+			v.unitSum[i] += x / norm
+		}
+	}
+	return true
+}
+
+// vectorDimensions returns the expected dimensions of a feature's vectors, learning them
+// from n, the length of the first vector observed, unless they are configured.
+func (c *Calculator) vectorDimensions(featureCfg config.FeatureConfig, n int) int {
+	if featureCfg.Dimensions > 0 {
+		return featureCfg.Dimensions
+	}
+	dims, ok := c.dimensions[featureCfg.Name]
+	if !ok {
+		dims = n
+		c.dimensions[featureCfg.Name] = dims
+	}
+	return dims
+}
+
+// vectorResult summarizes a window's vectors, or returns nil if none were observed.
+// Centroid distances are measured from the feature's baseline centroid, which defaults to
+// the mean vector of the first window with well-formed vectors. Segments and model
+// versions share their feature's baseline.
+func (c *Calculator) vectorResult(featureCfg config.FeatureConfig, stats *vectorStats) *VectorStats {
+	if stats == nil {
+		return nil
+	}
+	r := &VectorStats{
+		Values:              stats.values,
+		Dimensions:          stats.dimensions,
+		DimensionMismatches: stats.dimensionMismatches,
+		NonFiniteRate:       math.NaN(),
+		NormMean:            math.NaN(),
+		NormStdDev:          math.NaN(),
+		CentroidDistance:    math.NaN(),
+	}
+	if stats.elements > 0 {
+		r.NonFiniteRate = float64(stats.nonFinite) / float64(stats.elements)
+	}
+	if stats.wellFormed == 0 {
+		return r
+	}
+	n := float64(stats.wellFormed)
+	r.NormMean = stats.normSum / n
+	r.NormStdDev = math.Sqrt(max(stats.normSumSq/n-r.NormMean*r.NormMean, 0))
+
+	centroid, ok := c.centroids[featureCfg.Name]
+	if !ok {
+		centroid = featureCfg.BaselineCentroid
+		if len(centroid) == 0 {
+			centroid = make([]float64, len(stats.sum))
+			for i, s := range stats.sum {
+				centroid[i] = s / n
+			}
+		}
+		c.centroids[featureCfg.Name] = centroid
+	}
+	// The mean cosine similarity to the centroid is the unit vectors' sum projected on its
+	// direction, divided by their count, so it needs no per-vector pass.
+	if norm := euclideanNorm(centroid); norm > 0 && stats.unitCount > 0 && len(centroid) == len(stats.unitSum) {
+		var dot float64
+		for i, u := range stats.unitSum {
+			dot += u * centroid[i]
+		}
+		r.CentroidDistance = 1 - dot/norm/float64(stats.unitCount)
+	}
+	return r
+}
+
+func euclideanNorm(v []float64) float64 {
+	var sumSq float64
+	for _, x := range v {
+		sumSq += x * x
+	}
+	return math.Sqrt(sumSq)
+}
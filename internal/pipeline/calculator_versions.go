@@ -0,0 +1,48 @@
+package pipeline
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/sanspareilsmyn/featurelens/internal/message"
+)
+
+// versionSeparator joins a feature's name and a model version in the names results are
+// tracked under, e.g. "feature_a@v2".
+const versionSeparator = "@"
+
+// versionedName is the name a result of the given model version is tracked under. Results
+// of messages without a version keep the plain name.
+func versionedName(name, version string) string {
+	if version == "" {
+		return name
+	}
+	return name + versionSeparator + version
+}
+
+// unversionedName reverses versionedName.
+func unversionedName(name, version string) string {
+	if version == "" {
+		return name
+	}
+	return strings.TrimSuffix(name, versionSeparator+version)
+}
+
+// messageVersion returns the model version a message was produced by, or "" if the
+// version field is not configured or the message has no value for it.
+func messageVersion(msg message.DynamicMessage, field string) string {
+	if field == "" || !msg.HasNonNull(field) {
+		return ""
+	}
+	return groupValue(msg, field)
+}
+
+// sortedVersions returns the model versions observed in a window, in lexical order.
+func (w *windowInfo) sortedVersions() []string {
+	versions := make([]string, 0, len(w.versions))
+	for v := range w.versions {
+		versions = append(versions, v)
+	}
+	sort.Strings(versions)
+	return versions
+}
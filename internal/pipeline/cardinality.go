@@ -0,0 +1,240 @@
+package pipeline
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/sanspareilsmyn/featurelens/internal/config"
+)
+
+// Labels whose values the series limits cap.
+const (
+	labelFeature = "feature_name"
+	labelGroup   = "group"
+)
+
+// seriesLimiter caps the distinct feature and group label values of the Prometheus
+// gauges, which wildcard features and group-by can otherwise multiply without bound.
+// Values seen after a limit is reached are exported as OtherGroup, whose series
+// aggregate the statistics of every value folded into them. It is shared by the
+// alerter and the sampler, which exports per-feature sample rates.
+type seriesLimiter struct {
+	mu          sync.Mutex
+	maxFeatures int // 0 for no limit
+	maxGroups   int // 0 for no limit
+	features    map[string]bool
+	groups      map[Segment]bool
+	folded      map[[2]string]bool // Label and value of every folded value, counted once
+	others      map[string]*otherSeries
+	metrics     *Metrics
+	logger      *zap.Logger
+}
+
+// newSeriesLimiter creates a limiter admitting up to maxFeatures feature names and
+// maxGroups feature groups, exporting to metrics; 0 disables a limit.
+func newSeriesLimiter(maxFeatures, maxGroups int, metrics *Metrics, logger *zap.Logger) *seriesLimiter {
+	return &seriesLimiter{
+		maxFeatures: maxFeatures,
+		maxGroups:   maxGroups,
+		features:    make(map[string]bool),
+		groups:      make(map[Segment]bool),
+		folded:      make(map[[2]string]bool),
+		others:      make(map[string]*otherSeries),
+		metrics:     metrics,
+		logger:      logger,
+	}
+}
+
+// featureLabel returns the feature_name label value of a feature: its name, or
+// OtherGroup once maxFeatures other names were exported.
+func (l *seriesLimiter) featureLabel(name string) string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.feature(name)
+}
+
+// feature is featureLabel for callers holding l.mu.
+func (l *seriesLimiter) feature(name string) string {
+	if l.maxFeatures == 0 || l.features[name] {
+		return name
+	}
+	if len(l.features) < l.maxFeatures {
+		l.features[name] = true
+		return name
+	}
+	l.fold(labelFeature, name, l.maxFeatures)
+	return OtherGroup
+}
+
+// segmentLabels returns the feature and group label values of a segment. Segments of
+// folded features, and groups seen after maxGroups others, are folded into the
+// feature's (or OtherGroup's) OtherGroup group.
+func (l *seriesLimiter) segmentLabels(s Segment) (feature, group string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.segment(s)
+}
+
+// segment is segmentLabels for callers holding l.mu.
+func (l *seriesLimiter) segment(s Segment) (feature, group string) {
+	feature = l.feature(s.Feature)
+	switch {
+	case feature == OtherGroup || s.Group == OtherGroup:
+		return feature, OtherGroup
+	case l.maxGroups == 0 || l.groups[s]:
+		return feature, s.Group
+	case len(l.groups) < l.maxGroups:
+		l.groups[s] = true
+		return feature, s.Group
+	}
+	l.fold(labelGroup, segmentName(s), l.maxGroups)
+	return feature, OtherGroup
+}
+
+// violationLabel returns the feature_name label value of a violation's counter.
+func (l *seriesLimiter) violationLabel(v Violation) string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if v.Segment == nil {
+		return l.feature(unversionedName(v.FeatureName, v.ModelVersion))
+	}
+	feature, group := l.segment(*v.Segment)
+	return segmentName(Segment{Feature: feature, GroupBy: v.Segment.GroupBy, Group: group})
+}
+
+// fold counts a label value folded into OtherGroup, the first time it is seen.
+func (l *seriesLimiter) fold(label, value string, limit int) {
+	key := [2]string{label, value}
+	if l.folded[key] {
+		return
+	}
+	if len(l.folded) == 0 {
+		l.logger.Warn("Metric series limit reached, folding further label values into "+OtherGroup,
+			zap.String("label", label),
+			zap.Int("limit", limit),
+		)
+	}
+	l.folded[key] = true
+	l.metrics.seriesSuppressed.WithLabelValues(label).Inc()
+}
+
+// export sets the gauges of a result evaluated at now, aggregating it into its OtherGroup
+// series when its labels were folded.
+func (l *seriesLimiter) export(result AggregationResult, nullRate, missingRate, stdDev float64, now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if s := result.Segment; s != nil {
+		feature, group := l.segment(*s)
+		if group == OtherGroup {
+			result = l.aggregate(feature+"\x00"+s.GroupBy+"\x00"+result.ModelVersion, result)
+			nullRate, missingRate, stdDev = resultRates(result)
+		}
+		l.metrics.setSegmentGauges(feature, group, result, nullRate, missingRate, stdDev)
+		return
+	}
+	feature := l.feature(result.configName())
+	if feature == OtherGroup {
+		result = l.aggregate(result.ModelVersion, result)
+		nullRate, missingRate, stdDev = resultRates(result)
+	}
+	l.metrics.setFeatureGauges(feature, result, nullRate, missingRate, stdDev, now)
+}
+
+// initialize exports the series of configured features before their first window, see
+// Metrics.initFeatureGauges. Features beyond maxFeatures are left to OtherGroup.
+func (l *seriesLimiter) initialize(features []config.FeatureConfig) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, f := range features {
+		if feature := l.feature(f.Name); feature != OtherGroup {
+			numerical := f.MetricType == config.MetricTypeNumerical || f.MetricType == config.MetricTypeLatency
+			l.metrics.initFeatureGauges(feature, numerical)
+		}
+	}
+}
+
+// exportRollup sets the gauges of a completed rollup. Rollups of features folded into
+// OtherGroup are not exported, as their windows are not rolled up together.
+func (l *seriesLimiter) exportRollup(rollup rollupResult) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if feature := l.feature(rollup.result.configName()); feature != OtherGroup {
+		l.metrics.setRollupGauges(feature, rollup)
+	}
+}
+
+// aggregate merges a result into the window of the OtherGroup series identified by key.
+func (l *seriesLimiter) aggregate(key string, result AggregationResult) AggregationResult {
+	other, ok := l.others[key]
+	if !ok {
+		other = &otherSeries{}
+		l.others[key] = other
+	}
+	return other.merge(result)
+}
+
+// resultRates returns the null rate, missing rate and standard deviation of a result.
+func resultRates(result AggregationResult) (nullRate, missingRate, stdDev float64) {
+	stdDev = math.NaN()
+	if !math.IsNaN(result.Variance) && result.Variance >= 0 {
+		stdDev = math.Sqrt(result.Variance)
+	}
+	return result.rate(result.NullCount), result.rate(result.MissingCount), stdDev
+}
+
+// otherSeries aggregates the window results folded into an OtherGroup series. Only the
+// counts, mean, variance and zero rate are aggregated; statistics that do not combine
+// across features (categories, text lengths) are left out.
+type otherSeries struct {
+	windowEnd time.Time
+	result    AggregationResult
+	mean      float64 // Of the numerical values
+	m2        float64 // Sum of their squared deviations from the mean
+}
+
+// merge adds a result to the current window, starting a new one for a later window, and
+// returns the aggregate so far.
+func (o *otherSeries) merge(r AggregationResult) AggregationResult {
+	if r.WindowEnd.Before(o.windowEnd) {
+		return r // A late result of a past window; report it on its own
+	}
+	if !r.WindowEnd.Equal(o.windowEnd) {
+		*o = otherSeries{windowEnd: r.WindowEnd}
+		o.result = AggregationResult{
+			FeatureName:      OtherGroup,
+			WindowStart:      r.WindowStart,
+			WindowEnd:        r.WindowEnd,
+			Segment:          r.Segment, // For its groupBy
+			ModelVersion:     r.ModelVersion,
+			DistinctEstimate: math.NaN(), // Estimates of distinct series do not add up
+		}
+	}
+	agg := &o.result
+	agg.Count += r.Count
+	agg.NullCount += r.NullCount
+	agg.MissingCount += r.MissingCount
+	agg.TypeMismatchCount += r.TypeMismatchCount
+	agg.TrueCount += r.TrueCount
+	agg.FalseCount += r.FalseCount
+	if r.ValueCount > 0 && !math.IsNaN(r.Mean) {
+		n, variance := float64(r.ValueCount), r.Variance
+		if math.IsNaN(variance) {
+			variance = 0
+		}
+		na := float64(agg.ValueCount)
+		d := r.Mean - o.mean
+		o.mean += d * n / (na + n)
+		o.m2 += n*variance + d*d*na*n/(na+n)
+		agg.ValueCount += r.ValueCount
+		agg.ZeroCount += r.ZeroCount
+	}
+	agg.Mean, agg.Variance = math.NaN(), math.NaN()
+	if agg.ValueCount > 0 {
+		agg.Mean = o.mean
+		agg.Variance = max(o.m2, 0) / float64(agg.ValueCount)
+	}
+	return *agg
+}
@@ -0,0 +1,91 @@
+package pipeline
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is the source of time for windowing and alerting: the window a message lands in
+// by processing time, when windows are flushed, and when violations are detected, alerts
+// expire and silences end. The system clock is used unless another is set with
+// Pipeline.UseClock, e.g. a ManualClock in tests.
+type Clock interface {
+	Now() time.Time
+	// After sends the clock's time on the returned channel once d has elapsed, like
+	// time.After.
+	After(d time.Duration) <-chan time.Time
+}
+
+// SystemClock is the wall clock.
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// ManualClock is a Clock that only moves when told to, so tests and simulations control
+// exactly when windows are flushed. Moving it past the time a channel returned by After
+// is due sends that time on the channel.
+type ManualClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []manualWaiter
+}
+
+type manualWaiter struct {
+	at time.Time
+	c  chan time.Time
+}
+
+// NewManualClock creates a ManualClock reading now.
+func NewManualClock(now time.Time) *ManualClock {
+	return &ManualClock{now: now}
+}
+
+// Now returns the clock's current time.
+func (c *ManualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// After returns a channel receiving the clock's time d from now once the clock reaches
+// it, at once if d is not positive.
+func (c *ManualClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	w := manualWaiter{at: c.now.Add(d), c: make(chan time.Time, 1)}
+	if d <= 0 {
+		w.c <- c.now
+		return w.c
+	}
+	c.waiters = append(c.waiters, w)
+	return w.c
+}
+
+// Advance moves the clock forward by d, firing the channels due on the way.
+func (c *ManualClock) Advance(d time.Duration) {
+	c.Set(c.Now().Add(d))
+}
+
+// Set moves the clock to now, firing the channels due on the way. The clock never goes
+// back: an earlier time is ignored.
+func (c *ManualClock) Set(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if now.Before(c.now) {
+		return
+	}
+	c.now = now
+	pending := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.at.After(now) {
+			pending = append(pending, w)
+			continue
+		}
+		w.c <- w.at
+	}
+	c.waiters = pending
+}
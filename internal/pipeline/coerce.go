@@ -0,0 +1,123 @@
+package pipeline
+
+import (
+	"time"
+
+	"github.com/sanspareilsmyn/featurelens/internal/config"
+	"github.com/sanspareilsmyn/featurelens/internal/message"
+)
+
+// coercion converts the values of decoded messages that producers send with another type
+// than the pipeline reads them as: numeric strings in the fields read as numbers, and
+// timestamps in other formats in the event timestamp field.
+type coercion struct {
+	cfg            config.CoercionConfig
+	decimalComma   bool
+	numeric        map[string]struct{} // Fields read as numbers
+	patterns       []func(string) bool // Group patterns of numerical features, matching further fields
+	timestampField string              // Event timestamp field, empty without one
+	metrics        *Metrics
+}
+
+// withCoercion converts the values of the messages parse returns, see
+// config.CoercionConfig. Decoded numbers and RFC 3339 timestamps are left as they are.
+func withCoercion(parse parseFunc, cfg *config.Config, metrics *Metrics) parseFunc {
+	if !cfg.Pipeline.Coercion.Enabled() {
+		return parse
+	}
+	c := newCoercion(cfg, metrics)
+	return func(raw rawMessage) ([]message.DynamicMessage, error) {
+		msgs, err := parse(raw)
+		for _, msg := range msgs {
+			c.apply(msg)
+		}
+		return msgs, err
+	}
+}
+
+func newCoercion(cfg *config.Config, metrics *Metrics) *coercion {
+	c := &coercion{
+		cfg:            cfg.Pipeline.Coercion,
+		decimalComma:   cfg.Pipeline.Coercion.DecimalSeparator == ",",
+		numeric:        make(map[string]struct{}),
+		timestampField: cfg.Pipeline.Latency.TimestampField,
+		metrics:        metrics,
+	}
+	if c.cfg.NumericStrings {
+		for _, f := range cfg.Features {
+			if (f.MetricType != config.MetricTypeNumerical && f.MetricType != config.MetricTypeLatency) || f.Scope == config.ScopeSession {
+				continue
+			}
+			if f.Pattern != "" {
+				c.patterns = append(c.patterns, compilePattern(f.Pattern))
+				continue
+			}
+			c.numeric[f.FieldName()] = struct{}{}
+		}
+		for _, corr := range cfg.Pipeline.Correlations {
+			for _, field := range corr.Features {
+				c.numeric[field] = struct{}{}
+			}
+		}
+		for _, field := range cfg.Pipeline.Sessions.Fields {
+			c.numeric[field] = struct{}{}
+		}
+	}
+	return c
+}
+
+// apply converts a message's values in place.
+func (c *coercion) apply(msg message.DynamicMessage) {
+	if len(c.patterns) > 0 {
+		for field, v := range msg {
+			if s, ok := v.(string); ok && c.matchesPattern(field) {
+				c.number(msg, field, s)
+			}
+		}
+	}
+	for field := range c.numeric {
+		if s, ok := msg[field].(string); ok {
+			c.number(msg, field, s)
+		}
+	}
+	if s, ok := msg[c.timestampField].(string); ok && c.timestampField != "" {
+		c.timestamp(msg, c.timestampField, s)
+	}
+}
+
+func (c *coercion) matchesPattern(field string) bool {
+	for _, match := range c.patterns {
+		if match(field) {
+			return true
+		}
+	}
+	return false
+}
+
+// number replaces a numeric string with its number; other strings are left to be
+// counted as type mismatches.
+func (c *coercion) number(msg message.DynamicMessage, field, s string) {
+	if f, ok := message.ParseNumber(s, c.decimalComma); ok {
+		msg[field] = f
+		c.metrics.valuesCoerced.WithLabelValues("number").Inc()
+	}
+}
+
+// timestamp rewrites a timestamp in one of the configured formats as RFC 3339, and a
+// numeric string as the number of units since the Unix epoch it holds.
+func (c *coercion) timestamp(msg message.DynamicMessage, field, s string) {
+	if _, ok := message.ParseTime(s, nil); ok {
+		return
+	}
+	if t, ok := message.ParseTime(s, c.cfg.TimeFormats); ok {
+		msg[field] = t.UTC().Format(time.RFC3339Nano)
+		c.metrics.valuesCoerced.WithLabelValues("timestamp").Inc()
+		return
+	}
+	if c.cfg.NumericStrings {
+		if f, ok := message.ParseNumber(s, c.decimalComma); ok {
+			msg[field] = f
+			c.metrics.valuesCoerced.WithLabelValues("timestamp").Inc()
+		}
+	}
+}
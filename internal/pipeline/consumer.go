@@ -5,7 +5,14 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"regexp"
+	"slices"
+	"sync"
+	"time"
+
 	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 	"go.uber.org/zap"
 
 	"github.com/sanspareilsmyn/featurelens/internal/config"
@@ -27,94 +34,740 @@ func (l kafkaZapErrorLogger) Printf(msg string, args ...interface{}) {
 	l.log.Error(fmt.Sprintf(msg, args...))
 }
 
-// Consumer reads messages from a Kafka topic using kafka-go library.
+// seekTimeout bounds the broker requests of a seek, and of resolving the subscription.
+const seekTimeout = 10 * time.Second
+
+// isolationLevel returns the Kafka isolation level of the configured one. Offset lookups
+// use it too, so the end of a partition read committed is its last stable offset.
+func isolationLevel(cfg config.KafkaConfig) kafka.IsolationLevel {
+	if cfg.ReadCommitted() {
+		return kafka.ReadCommitted
+	}
+	return kafka.ReadUncommitted
+}
+
+// rawMessage is a consumed payload with the topic and partition it was consumed from, its
+// key and its headers; replayed messages have none of them.
+type rawMessage struct {
+	topic     string
+	partition int
+	key       []byte // nil for messages without a key
+	headers   []kafka.Header
+	value     []byte
+	buf       *[]byte   // Pooled buffer holding value, released once it is decoded; nil for other values
+	handedOff time.Time // When the source handed the message downstream, for stage latencies
+}
+
+// Offsets are offsets by topic and partition.
+type Offsets map[string]map[int]int64
+
+func (o Offsets) set(topic string, partition int, offset int64) {
+	if o[topic] == nil {
+		o[topic] = make(map[int]int64)
+	}
+	o[topic][partition] = offset
+}
+
+// errReadersReplaced stops fetching from readers a seek has replaced.
+var errReadersReplaced = errors.New("readers replaced by a seek")
+
+// Consumer reads messages from Kafka topics using kafka-go library. It subscribes to the
+// configured topic, or the topics matching the topic pattern, through the consumer group;
+// with partitions configured, it reads those partitions of every topic directly and only
+// commits offsets for the group.
 type Consumer struct {
-	reader *kafka.Reader
-	output chan<- []byte
-	cfg    config.KafkaConfig
-	logger *zap.Logger
+	readerCfg kafka.ReaderConfig // Template of the readers, per topic and partition when assigned
+	client    *kafka.Client      // Subscription, seek and assigned partition offset requests
+	output    chan<- []rawMessage
+	cfg       config.KafkaConfig
+	batch     config.BatchConfig
+	logger    *zap.Logger
+	limiter   *tokenBucket // Paces handoffs to kafka.rateLimit; nil when unbounded
+
+	seekMu    sync.Mutex // Serializes seeks
+	mu        sync.Mutex
+	topics    []string        // Subscribed topics, resolved by Run
+	readers   []*kafka.Reader // Created by Run, so standbys don't join the group; replaced by seeks
+	positions Offsets         // Next offset to fetch, per partition fetched from
+
+	// Batch runs stop at the end offsets resolved at startup, the high watermarks or the
+	// offsets of the until time, instead of consuming until cancelled.
+	bounded   bool
+	until     time.Time // Zero to stop at the high watermarks
+	ends      Offsets   // Offset to stop at, per partition; resolved by Run
+	remaining Offsets   // Ends of the partitions with messages left to consume
+
+	pauseMu sync.Mutex
+	resumed chan struct{} // Closed on resume; nil unless paused
 }
 
-// NewConsumer creates and configures a new Kafka consumer instance.
-func NewConsumer(cfg config.KafkaConfig, output chan<- []byte, logger *zap.Logger) (*Consumer, error) {
-	if len(cfg.Brokers) == 0 || cfg.Topic == "" || cfg.GroupID == "" {
+// NewConsumer creates and configures a new Kafka consumer instance, handing fetched
+// messages downstream in batches.
+func NewConsumer(cfg config.KafkaConfig, batch config.BatchConfig, output chan<- []rawMessage, logger *zap.Logger) (*Consumer, error) {
+	if len(cfg.Brokers) == 0 || cfg.Subscription() == "" || cfg.GroupID == "" {
 		logger.Error("Kafka configuration validation failed",
 			zap.Strings("brokers", cfg.Brokers),
-			zap.String("topic", cfg.Topic),
+			zap.String("topic", cfg.Subscription()),
 			zap.String("group_id", cfg.GroupID),
 		)
 		return nil, ErrInvalidKafkaConfig
 	}
 
 	readerCfg := kafka.ReaderConfig{
-		Brokers:     cfg.Brokers,
-		GroupID:     cfg.GroupID,
-		Topic:       cfg.Topic,
-		Logger:      kafkaZapLogger{logger.Named("kafka-reader").WithOptions(zap.AddCallerSkip(1))},
-		ErrorLogger: kafkaZapErrorLogger{logger.Named("kafka-reader-error").WithOptions(zap.AddCallerSkip(1))},
+		Brokers:        cfg.Brokers,
+		GroupID:        cfg.GroupID,
+		Topic:          cfg.Topic,
+		MinBytes:       cfg.Reader.MinBytes,
+		MaxBytes:       cfg.Reader.MaxBytes,
+		MaxWait:        cfg.Reader.MaxWait,
+		CommitInterval: cfg.Reader.CommitInterval,
+		IsolationLevel: isolationLevel(cfg),
+		Logger:         kafkaZapLogger{logger.Named("kafka-reader").WithOptions(zap.AddCallerSkip(1))},
+		ErrorLogger:    kafkaZapErrorLogger{logger.Named("kafka-reader-error").WithOptions(zap.AddCallerSkip(1))},
 	}
-	r := kafka.NewReader(readerCfg)
 
 	logger.Info("Kafka consumer created",
 		zap.String("topic", cfg.Topic),
+		zap.String("topic_pattern", cfg.TopicPattern),
+		zap.Ints("partitions", cfg.Partitions),
 		zap.String("group_id", cfg.GroupID),
 		zap.Strings("brokers", cfg.Brokers),
 		zap.Duration("commit_interval", readerCfg.CommitInterval),
 		zap.Duration("max_wait", readerCfg.MaxWait),
 		zap.Int("min_bytes", readerCfg.MinBytes),
 		zap.Int("max_bytes", readerCfg.MaxBytes),
+		zap.String("isolation_level", cfg.IsolationLevel),
+		zap.Int("batch_size", batch.Size),
+		zap.Duration("batch_linger", batch.Linger),
+		zap.Float64("rate_limit", cfg.RateLimit.MessagesPerSecond),
 	)
 
 	return &Consumer{
-		reader: r,
-		output: output,
-		cfg:    cfg,
-		logger: logger,
+		readerCfg: readerCfg,
+		client:    &kafka.Client{Addr: kafka.TCP(cfg.Brokers...), Timeout: seekTimeout},
+		output:    output,
+		cfg:       cfg,
+		batch:     batch,
+		logger:    logger,
+		limiter:   newTokenBucket(cfg.RateLimit),
+		positions: make(Offsets),
 	}, nil
 }
 
 // Run starts the consumer message reading loop.
-// It blocks until the context is cancelled or an unrecoverable error occurs.
+// It blocks until the context is cancelled or an unrecoverable error occurs, or, for a
+// consumer stopping at the end of the topic, returns nil once it has caught up. The readers
+// stay open so offsets can be committed once the pipeline has drained; call Close after.
+// Topics matching the topic pattern are resolved once, at startup. With kafka.startOffset
+// set, the consumer group is first moved there.
 func (c *Consumer) Run(ctx context.Context) error {
 	sugar := c.logger.Sugar()
 	sugar.Info("Starting Kafka consumer loop...")
+	defer sugar.Info("Kafka consumer loop stopped.")
 
-	defer func() {
-		sugar.Info("Closing Kafka consumer reader...")
-		if err := c.reader.Close(); err != nil {
-			sugar.Errorw("Failed to close Kafka reader cleanly", zap.Error(err))
-		} else {
-			sugar.Info("Kafka consumer reader closed successfully.")
+	topics, err := c.resolveTopics(ctx)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.topics = topics
+	c.mu.Unlock()
+	sugar.Infow("Subscribed to topics", zap.Strings("topics", topics))
+
+	if c.cfg.StartOffset != "" {
+		target, err := config.ParseSeekTarget(c.cfg.StartOffset)
+		if err == nil {
+			_, err = c.Seek(ctx, target)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err := c.open(ctx); err != nil {
+		return err
+	}
+	if c.bounded {
+		if err := c.resolveEnds(ctx); err != nil {
+			return err
+		}
+		if c.caughtUp() {
+			sugar.Info("Nothing to consume before the end offsets.")
+			return nil
 		}
-		sugar.Info("Kafka consumer loop stopped.")
-	}()
+	}
 
+	for {
+		err := c.consume(ctx, c.currentReaders())
+		if !errors.Is(err, errReadersReplaced) {
+			return err
+		}
+	}
+}
+
+// fetchedMessage is a message with the reader it was fetched by.
+type fetchedMessage struct {
+	kafka.Message
+	reader *kafka.Reader
+}
+
+// consume hands the messages of readers downstream until ctx is done, a fetch fails or a
+// seek replaces the readers. Messages are handed off in batches, once a batch is full or
+// its first message has waited for the linger time.
+func (c *Consumer) consume(ctx context.Context, readers []*kafka.Reader) error {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	fetchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	fetched := make(chan fetchedMessage)
+	fetchErr := make(chan error, len(readers))
+	for _, reader := range readers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fetchErr <- c.fetch(fetchCtx, reader, fetched)
+		}()
+	}
+
+	linger := time.NewTimer(c.batch.Linger)
+	linger.Stop()
+	defer linger.Stop()
+	var stallCheck <-chan time.Time // Ticks while consuming up to the end offsets
+	if c.bounded {
+		ticker := time.NewTicker(c.stallTimeout() / 4)
+		defer ticker.Stop()
+		stallCheck = ticker.C
+	}
+	lastFetched := time.Now()
+	pending := make([]fetchedMessage, 0, c.batch.Size)
+	for {
+		select {
+		case m := <-fetched:
+			lastFetched = time.Now()
+			if c.pastEnd(m.Message) {
+				continue // Left for the next run
+			}
+			telemetry.messagesConsumed.Add(ctx, 1)
+			pending = append(pending, m)
+			if len(pending) == 1 {
+				linger.Reset(c.batch.Linger)
+			}
+			if len(pending) < c.batch.Size {
+				continue
+			}
+
+		case <-linger.C:
+			if len(pending) == 0 {
+				continue // Fired as a full batch was handed off
+			}
+
+		case <-stallCheck:
+			if time.Since(lastFetched) < c.stallTimeout() {
+				continue
+			}
+			if err := c.handOff(ctx, pending); err != nil {
+				return err
+			}
+			c.logger.Warn("Nothing fetched short of the end offsets, e.g. transaction markers or aborted messages, stopping",
+				zap.Duration("stall_timeout", c.stallTimeout()),
+				zap.Any("ends", c.ends),
+				zap.Any("positions", c.Positions()),
+			)
+			return nil
+
+		case err := <-fetchErr:
+			// Messages fetched before a seek are still processed
+			if handOffErr := c.handOff(ctx, pending); handOffErr != nil {
+				return handOffErr
+			}
+			return err
+
+		case <-ctx.Done():
+			c.logger.Debug("Context cancelled, stopping consumer fetch loop.", zap.Error(ctx.Err()))
+			return context.Canceled
+		}
+
+		if err := c.handOff(ctx, pending); err != nil {
+			return err
+		}
+		pending = pending[:0]
+		linger.Stop()
+		if c.bounded && c.caughtUp() {
+			c.logger.Info("Consumed up to the end offsets", zap.Any("ends", c.ends))
+			return nil
+		}
+	}
+}
+
+// handOff sends a batch of fetched messages downstream, waiting for room until ctx is done.
+// While paused, it first waits for the consumer to resume. With a rate limit, it first waits until the batch fits in it; fetching stalls meanwhile,
+// leaving the backlog in Kafka.
+func (c *Consumer) handOff(ctx context.Context, pending []fetchedMessage) error {
+	if len(pending) == 0 {
+		return nil
+	}
+	if err := c.waitResumed(ctx); err != nil {
+		c.logger.Debug("Context cancelled while the consumer was paused.", zap.Error(ctx.Err()))
+		return err
+	}
+	if c.limiter != nil {
+		waited, err := c.limiter.take(ctx, len(pending))
+		if waited > 0 {
+			telemetry.throttleTime.Add(ctx, waited.Seconds())
+		}
+		if err != nil {
+			c.logger.Debug("Context cancelled while rate limiting the consumer.", zap.Error(ctx.Err()))
+			return err
+		}
+	}
+	batch := make([]rawMessage, len(pending))
+	now := time.Now()
+	for i, m := range pending {
+		batch[i] = rawMessage{topic: m.Topic, partition: m.Partition, key: m.Key, headers: m.Headers, value: m.Value, handedOff: now}
+	}
+	select {
+	case c.output <- batch:
+		// Only messages handed downstream count as consumed, so a drained shutdown never
+		// commits past a message that was dropped here.
+		c.recordPositions(pending)
+		return nil
+	case <-ctx.Done():
+		c.logger.Debug("Context cancelled while sending messages downstream.", zap.Error(ctx.Err()))
+		return context.Canceled
+	}
+}
+
+// fetch sends the messages of one reader to fetched until ctx is done or a fetch fails.
+func (c *Consumer) fetch(ctx context.Context, reader *kafka.Reader, fetched chan<- fetchedMessage) error {
 	for {
 		// FetchMessage blocks until a message is available or context is cancelled/deadline exceeded.
-		m, err := c.reader.FetchMessage(ctx)
+		fetchCtx, span := tracer.Start(ctx, "kafka.fetch")
+		m, err := reader.FetchMessage(fetchCtx)
 		if err != nil {
+			span.End()
 			if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
-				c.logger.Debug("Context cancelled or deadline exceeded, stopping consumer fetch loop.", zap.Error(err))
 				return context.Canceled
 			}
+			if !slices.Contains(c.currentReaders(), reader) {
+				return errReadersReplaced // Closed by a seek, fetch from its new readers
+			}
 			c.logger.Error("Error fetching message from Kafka", zap.Error(err))
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "fetch failed")
 			return fmt.Errorf("%w: %w", ErrKafkaFetchFailed, err)
 		}
+		span.SetAttributes(
+			attribute.String("messaging.destination.name", m.Topic),
+			attribute.Int("messaging.kafka.destination.partition", m.Partition),
+			attribute.Int64("messaging.kafka.message.offset", m.Offset),
+		)
+		span.End()
 
 		select {
-		case c.output <- m.Value:
-			continue
-
+		case fetched <- fetchedMessage{Message: m, reader: reader}:
 		case <-ctx.Done():
-			c.logger.Debug("Context cancelled while sending message downstream.", zap.Error(ctx.Err()))
 			return context.Canceled
 		}
 	}
 }
 
-// Close cleans up the consumer resources. Provided for potential explicit cleanup needs,
-// although Run()'s defer handles the primary reader closing.
+// resolveTopics returns the configured topic, or the topics matching the topic pattern.
+func (c *Consumer) resolveTopics(ctx context.Context) ([]string, error) {
+	if c.cfg.TopicPattern == "" {
+		return []string{c.cfg.Topic}, nil
+	}
+	pattern, err := regexp.Compile(c.cfg.TopicPattern)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidKafkaConfig, err)
+	}
+	meta, err := c.client.Metadata(ctx, &kafka.MetadataRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrSubscriptionFailed, err)
+	}
+	var topics []string
+	for _, t := range meta.Topics {
+		if !t.Internal && pattern.MatchString(t.Name) {
+			topics = append(topics, t.Name)
+		}
+	}
+	if len(topics) == 0 {
+		return nil, fmt.Errorf("%w: no topic matches %q", ErrSubscriptionFailed, c.cfg.TopicPattern)
+	}
+	slices.Sort(topics)
+	return topics, nil
+}
+
+// recordPositions remembers the next offset to fetch from the partitions of messages
+// handed downstream, except those fetched by readers a seek has since replaced.
+func (c *Consumer) recordPositions(handedOff []fetchedMessage) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, m := range handedOff {
+		if slices.Contains(c.readers, m.reader) {
+			c.positions.set(m.Topic, m.Partition, m.Offset+1)
+		}
+	}
+}
+
+// open creates the readers unless a seek already did: one joining the consumer group, or
+// one per assigned partition of every topic, starting from the group's committed offsets.
+func (c *Consumer) open(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.readers != nil {
+		return nil
+	}
+	readers, err := c.newReaders(ctx)
+	if err != nil {
+		return err
+	}
+	c.readers = readers
+	return nil
+}
+
+// newReaders creates the readers of the subscription. MUST be called with the mutex held.
+func (c *Consumer) newReaders(ctx context.Context) ([]*kafka.Reader, error) {
+	if len(c.cfg.Partitions) == 0 {
+		readerCfg := c.readerCfg
+		if len(c.topics) > 1 || c.cfg.TopicPattern != "" {
+			readerCfg.Topic, readerCfg.GroupTopics = "", c.topics
+		}
+		return []*kafka.Reader{kafka.NewReader(readerCfg)}, nil
+	}
+
+	request := make(map[string][]int, len(c.topics))
+	for _, topic := range c.topics {
+		request[topic] = c.cfg.Partitions
+	}
+	committed, err := c.committedOffsets(ctx, request)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrSubscriptionFailed, err)
+	}
+	var readers []*kafka.Reader
+	for _, topic := range c.topics {
+		for _, partition := range c.cfg.Partitions {
+			readerCfg := c.readerCfg
+			readerCfg.GroupID, readerCfg.Topic, readerCfg.Partition = "", topic, partition
+			reader := kafka.NewReader(readerCfg)
+			offset, ok := committed[topic][partition]
+			if !ok || offset < 0 {
+				offset = kafka.FirstOffset // Like a consumer group without committed offsets
+			}
+			if err := reader.SetOffset(offset); err != nil {
+				return nil, fmt.Errorf("%w: %w", ErrSubscriptionFailed, err)
+			}
+			readers = append(readers, reader)
+		}
+	}
+	return readers, nil
+}
+
+// committedOffsets returns the group's committed offsets of partitions, by topic.
+func (c *Consumer) committedOffsets(ctx context.Context, partitions map[string][]int) (Offsets, error) {
+	resp, err := c.client.OffsetFetch(ctx, &kafka.OffsetFetchRequest{GroupID: c.cfg.GroupID, Topics: partitions})
+	if err != nil {
+		return nil, err
+	}
+	if resp.Error != nil {
+		return nil, resp.Error
+	}
+	offsets := make(Offsets)
+	for topic, partitions := range resp.Topics {
+		for _, p := range partitions {
+			if p.Error != nil {
+				return nil, fmt.Errorf("topic %q partition %d: %w", topic, p.Partition, p.Error)
+			}
+			offsets.set(topic, p.Partition, p.CommittedOffset)
+		}
+	}
+	return offsets, nil
+}
+
+func (c *Consumer) currentReaders() []*kafka.Reader {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.readers
+}
+
+// Positions returns the next offset to fetch for every partition this consumer has
+// fetched from. Partitions not fetched from yet are absent.
+func (c *Consumer) Positions() Offsets {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	positions := make(Offsets, len(c.positions))
+	for topic, partitions := range c.positions {
+		for partition, next := range partitions {
+			positions.set(topic, partition, next)
+		}
+	}
+	return positions
+}
+
+// Lag returns the number of messages between the last fetched offsets and the high
+// watermarks, summed over the readers.
+func (c *Consumer) Lag() int64 {
+	var lag int64
+	for _, reader := range c.currentReaders() {
+		lag += reader.Stats().Lag
+	}
+	return lag
+}
+
+// Pause stops handing messages downstream until Resume. The readers stay in the consumer
+// group, and messages already handed off are still processed; windows keep closing,
+// empty of the messages held back.
+func (c *Consumer) Pause() {
+	c.pauseMu.Lock()
+	defer c.pauseMu.Unlock()
+	if c.resumed == nil {
+		c.resumed = make(chan struct{})
+		c.logger.Info("Consumer paused")
+	}
+}
+
+// Resume hands messages downstream again after Pause.
+func (c *Consumer) Resume() {
+	c.pauseMu.Lock()
+	defer c.pauseMu.Unlock()
+	if c.resumed != nil {
+		close(c.resumed)
+		c.resumed = nil
+		c.logger.Info("Consumer resumed")
+	}
+}
+
+// Paused reports whether the consumer is paused.
+func (c *Consumer) Paused() bool {
+	c.pauseMu.Lock()
+	defer c.pauseMu.Unlock()
+	return c.resumed != nil
+}
+
+// waitResumed waits until the consumer is not paused or ctx is done.
+func (c *Consumer) waitResumed(ctx context.Context) error {
+	c.pauseMu.Lock()
+	resumed := c.resumed
+	c.pauseMu.Unlock()
+	if resumed == nil {
+		return nil
+	}
+	select {
+	case <-resumed:
+		return nil
+	case <-ctx.Done():
+		return context.Canceled
+	}
+}
+
+// Commit commits the next offset to fetch for every partition handed downstream, so a
+// restarted consumer group resumes after the last message the pipeline processed.
+// Call it after Run has returned and downstream stages have drained.
+func (c *Consumer) Commit(ctx context.Context) error {
+	positions := c.Positions()
+	if len(positions) == 0 {
+		return nil
+	}
+	var err error
+	if len(c.cfg.Partitions) > 0 {
+		err = c.commitOffsets(ctx, positions) // Assigned partitions are read outside of the group
+	} else {
+		var msgs []kafka.Message
+		for topic, partitions := range positions {
+			for partition, next := range partitions {
+				msgs = append(msgs, kafka.Message{Topic: topic, Partition: partition, Offset: next - 1})
+			}
+		}
+		err = c.currentReaders()[0].CommitMessages(ctx, msgs...)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrOffsetCommitFailed, err)
+	}
+	c.logger.Info("Committed consumer offsets",
+		zap.String("topic", c.cfg.Subscription()),
+		zap.String("group_id", c.cfg.GroupID),
+		zap.Any("positions", positions),
+	)
+	return nil
+}
+
+// Close closes the Kafka readers, leaving the consumer group.
 func (c *Consumer) Close() error {
-	c.logger.Info("Explicit Close() called on Kafka consumer...")
+	readers := c.currentReaders()
+	if readers == nil {
+		return nil // Never ran
+	}
+	c.logger.Info("Closing Kafka consumer readers...")
+	var errs []error
+	for _, reader := range readers {
+		errs = append(errs, reader.Close())
+	}
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+	c.logger.Info("Kafka consumer readers closed successfully.")
+	return nil
+}
+
+// Seek moves the consumer group to target in every partition of the subscribed topics
+// (the assigned partitions, when configured) and returns the offsets consumption resumes
+// from. Messages already fetched are still processed.
+//
+// Kafka only accepts offsets committed outside of a group generation while the group has
+// no members, so a running consumer's readers leave the group for the commit and new ones
+// rejoin after; the seek fails if other consumers remain in the group.
+func (c *Consumer) Seek(ctx context.Context, target config.SeekTarget) (Offsets, error) {
+	c.seekMu.Lock()
+	defer c.seekMu.Unlock()
+
+	offsets, err := c.resolveOffsets(ctx, target)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrSeekFailed, err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	running := c.readers != nil
+	for _, reader := range c.readers {
+		if err := reader.Close(); err != nil {
+			c.logger.Warn("Failed to close Kafka reader for seek", zap.Error(err))
+		}
+	}
+	err = c.commitOffsets(ctx, offsets)
+	if running {
+		// Resume from the committed offsets, sought or not
+		readers, openErr := c.newReaders(ctx)
+		if openErr != nil {
+			return nil, fmt.Errorf("%w: %w", ErrSeekFailed, openErr)
+		}
+		c.readers = readers
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrSeekFailed, err)
+	}
+	c.positions = make(Offsets)
+
+	c.logger.Info("Moved consumer group to seek target",
+		zap.Strings("topics", c.topics),
+		zap.String("group_id", c.cfg.GroupID),
+		zap.Stringer("target", target),
+		zap.Any("offsets", offsets),
+	)
+	return offsets, nil
+}
+
+// resolveOffsets looks up the offset of target in every partition consumed. Partitions
+// without a message at or after a target time resume from their end.
+func (c *Consumer) resolveOffsets(ctx context.Context, target config.SeekTarget) (Offsets, error) {
+	c.mu.Lock()
+	topics := c.topics
+	c.mu.Unlock()
+	partitions := make(map[string][]int, len(topics))
+	if len(c.cfg.Partitions) > 0 {
+		for _, topic := range topics {
+			partitions[topic] = c.cfg.Partitions
+		}
+	} else {
+		meta, err := c.client.Metadata(ctx, &kafka.MetadataRequest{Topics: topics})
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range meta.Topics {
+			if t.Error != nil {
+				return nil, fmt.Errorf("topic %q: %w", t.Name, t.Error)
+			}
+			for _, p := range t.Partitions {
+				partitions[t.Name] = append(partitions[t.Name], p.ID)
+			}
+		}
+	}
+
+	listOffsets := func(request func(partition int) kafka.OffsetRequest) (map[string][]kafka.PartitionOffsets, error) {
+		requests := make(map[string][]kafka.OffsetRequest, len(partitions))
+		for topic, ids := range partitions {
+			for _, id := range ids {
+				requests[topic] = append(requests[topic], request(id))
+			}
+		}
+		resp, err := c.client.ListOffsets(ctx, &kafka.ListOffsetsRequest{Topics: requests, IsolationLevel: isolationLevel(c.cfg)})
+		if err != nil {
+			return nil, err
+		}
+		for topic, offsets := range resp.Topics {
+			for _, p := range offsets {
+				if p.Error != nil {
+					return nil, fmt.Errorf("topic %q partition %d: %w", topic, p.Partition, p.Error)
+				}
+			}
+		}
+		return resp.Topics, nil
+	}
+
+	offsets := make(Offsets)
+	if target.Earliest {
+		resp, err := listOffsets(kafka.FirstOffsetOf)
+		if err != nil {
+			return nil, err
+		}
+		for topic, ps := range resp {
+			for _, p := range ps {
+				offsets.set(topic, p.Partition, p.FirstOffset)
+			}
+		}
+		return offsets, nil
+	}
+
+	resp, err := listOffsets(kafka.LastOffsetOf)
+	if err != nil {
+		return nil, err
+	}
+	for topic, ps := range resp {
+		for _, p := range ps {
+			offsets.set(topic, p.Partition, p.LastOffset)
+		}
+	}
+	if target.Latest {
+		return offsets, nil
+	}
+	resp, err = listOffsets(func(partition int) kafka.OffsetRequest {
+		return kafka.TimeOffsetOf(partition, target.Time)
+	})
+	if err != nil {
+		return nil, err
+	}
+	for topic, ps := range resp {
+		for _, p := range ps {
+			for offset := range p.Offsets {
+				if offset >= 0 {
+					offsets.set(topic, p.Partition, offset)
+				}
+			}
+		}
+	}
+	return offsets, nil
+}
+
+// commitOffsets commits offsets for the consumer group outside of a group generation.
+func (c *Consumer) commitOffsets(ctx context.Context, offsets Offsets) error {
+	commits := make(map[string][]kafka.OffsetCommit, len(offsets))
+	for topic, partitions := range offsets {
+		for partition, offset := range partitions {
+			commits[topic] = append(commits[topic], kafka.OffsetCommit{Partition: partition, Offset: offset})
+		}
+	}
+	resp, err := c.client.OffsetCommit(ctx, &kafka.OffsetCommitRequest{
+		GroupID:      c.cfg.GroupID,
+		GenerationID: -1,
+		Topics:       commits,
+	})
+	if err != nil {
+		return err
+	}
+	for topic, partitions := range resp.Topics {
+		for _, p := range partitions {
+			if p.Error != nil {
+				return fmt.Errorf("topic %q partition %d: %w", topic, p.Partition, p.Error)
+			}
+		}
+	}
 	return nil
 }
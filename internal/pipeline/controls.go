@@ -0,0 +1,469 @@
+package pipeline
+
+import (
+	"cmp"
+	"fmt"
+	"path"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/sanspareilsmyn/featurelens/internal/config"
+	"github.com/sanspareilsmyn/featurelens/internal/cron"
+)
+
+// Violation severities. Features default to SeverityWarning.
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+// defaultSeverity is assigned to violations without a severity override.
+const defaultSeverity = SeverityWarning
+
+// Selector matches features whose tags contain every key/value pair.
+type Selector map[string]string
+
+// Matches reports whether the tags satisfy the selector.
+func (s Selector) Matches(tags map[string]string) bool {
+	for key, value := range s {
+		if tags[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// SilenceMatcher selects the alerts a silence suppresses: those of the checks matching
+// Checks, of features matching both the selector and Features. Unset matchers match
+// every alert.
+type SilenceMatcher struct {
+	Selector Selector `json:"selector,omitempty"`
+	Features []string `json:"features,omitempty"` // Globs matched against feature names
+	Checks   []string `json:"checks,omitempty"`   // Globs matched against check types, e.g. "null_rate" or "condition:*"
+}
+
+func (m SilenceMatcher) empty() bool {
+	return len(m.Selector) == 0 && len(m.Features) == 0 && len(m.Checks) == 0
+}
+
+// matchesFeature reports whether the feature is selected, whatever the check.
+func (m SilenceMatcher) matchesFeature(f config.FeatureConfig) bool {
+	return m.Selector.Matches(f.Tags) && (len(m.Features) == 0 || matchesAny(m.Features, f.Name))
+}
+
+// matches reports whether an alert of the feature's check is selected.
+func (m SilenceMatcher) matches(f config.FeatureConfig, checkType string) bool {
+	return m.matchesFeature(f) && (len(m.Checks) == 0 || matchesAny(m.Checks, checkType))
+}
+
+// validate checks that the matcher selects something with valid globs.
+func (m SilenceMatcher) validate() error {
+	if m.empty() {
+		return ErrEmptySilence
+	}
+	for _, pattern := range slices.Concat(m.Features, m.Checks) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("%w: %q: %w", ErrInvalidPattern, pattern, err)
+		}
+	}
+	return nil
+}
+
+func matchesAny(patterns []string, name string) bool {
+	return slices.ContainsFunc(patterns, func(pattern string) bool {
+		matched, _ := path.Match(pattern, name)
+		return matched
+	})
+}
+
+// Silence suppresses the alerts it matches from StartsAt until it expires. Silenced
+// violations are still counted and recorded, but do not notify sinks.
+type Silence struct {
+	ID string `json:"id"`
+	SilenceMatcher
+	Reason    string    `json:"reason,omitempty"`
+	Schedule  string    `json:"schedule,omitempty"` // Cron schedule of a configured maintenance window
+	CreatedAt time.Time `json:"createdAt"`
+	StartsAt  time.Time `json:"startsAt"`
+	Until     time.Time `json:"until"`
+}
+
+// active reports whether the silence is in effect at now.
+func (s Silence) active(now time.Time) bool {
+	return !now.Before(s.StartsAt) && now.Before(s.Until)
+}
+
+// maintenanceWindow is a silence from the configuration, in effect once between fixed
+// times or for a duration from every time its cron schedule fires.
+type maintenanceWindow struct {
+	id       string
+	cfg      config.MaintenanceWindowConfig
+	start    time.Time
+	end      time.Time
+	schedule *cron.Schedule
+	location *time.Location
+}
+
+func newMaintenanceWindow(id string, cfg config.MaintenanceWindowConfig) (maintenanceWindow, error) {
+	w := maintenanceWindow{id: id, cfg: cfg}
+	var err error
+	if cfg.Schedule == "" {
+		w.start, w.end, err = cfg.Period()
+		return w, err
+	}
+	if w.schedule, err = cron.Parse(cfg.Schedule); err != nil {
+		return w, err
+	}
+	w.location, err = time.LoadLocation(cfg.Timezone)
+	return w, err
+}
+
+// occurrence returns the window's silence in effect at now, if any.
+func (w maintenanceWindow) occurrence(now time.Time) (Silence, bool) {
+	start, end := w.start, w.end
+	if w.schedule != nil {
+		var ok bool
+		if start, ok = w.schedule.Prev(now.In(w.location), w.cfg.Duration); !ok {
+			return Silence{}, false
+		}
+		end = start.Add(w.cfg.Duration)
+	}
+	s := Silence{
+		ID: w.id,
+		SilenceMatcher: SilenceMatcher{
+			Selector: w.cfg.Selector,
+			Features: w.cfg.Features,
+			Checks:   w.cfg.Checks,
+		},
+		Reason:    w.cfg.Reason,
+		Schedule:  w.cfg.Schedule,
+		CreatedAt: start,
+		StartsAt:  start,
+		Until:     end,
+	}
+	return s, s.active(now)
+}
+
+// SeverityOverride changes the severity of violations for all features matching its
+// selector. A nil Until never expires.
+type SeverityOverride struct {
+	ID        string     `json:"id"`
+	Selector  Selector   `json:"selector"`
+	Severity  string     `json:"severity"`
+	CreatedAt time.Time  `json:"createdAt"`
+	Until     *time.Time `json:"until,omitempty"`
+}
+
+func (o SeverityOverride) expired(now time.Time) bool {
+	return o.Until != nil && !now.Before(*o.Until)
+}
+
+// Controls holds runtime alerting controls applied in bulk to features selected by tags.
+// It is shared by the Alerter and the admin API and is safe for concurrent use.
+type Controls struct {
+	registry *FeatureRegistry
+	logger   *zap.Logger
+
+	startedAt   time.Time
+	alertTTL    time.Duration // Firing alerts not raised again within this long are dropped
+	maintenance []maintenanceWindow
+
+	mu        sync.Mutex
+	nextID    int
+	silences  map[string]Silence
+	overrides map[string]SeverityOverride
+	alerts    map[string]Alert
+
+	clock Clock // When silences and overrides start and end, and firing alerts expire
+}
+
+// NewControls creates the controls over the registry's features, silencing alerts
+// during the configured maintenance windows. Firing alerts that are neither raised again
+// nor resolved within alertTTL are forgotten.
+func NewControls(registry *FeatureRegistry, maintenance []config.MaintenanceWindowConfig, alertTTL time.Duration, logger *zap.Logger) *Controls {
+	c := &Controls{
+		registry:  registry,
+		logger:    logger,
+		startedAt: time.Now(),
+		alertTTL:  alertTTL,
+		silences:  make(map[string]Silence),
+		overrides: make(map[string]SeverityOverride),
+		alerts:    make(map[string]Alert),
+		clock:     SystemClock,
+	}
+	for i, cfg := range maintenance {
+		w, err := newMaintenanceWindow("maintenance-"+cmp.Or(cfg.Name, strconv.Itoa(i)), cfg)
+		if err != nil {
+			logger.Error("Skipping invalid maintenance window", zap.String("silence_id", w.id), zap.Error(err)) // Validated at config load
+			continue
+		}
+		c.maintenance = append(c.maintenance, w)
+	}
+	return c
+}
+
+// useClock makes the controls tell time by clock, from the time they started.
+func (c *Controls) useClock(clock Clock) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.clock = clock
+	c.startedAt = clock.Now()
+}
+
+// MatchingFeatures returns the names of known features matching the selector.
+func (c *Controls) MatchingFeatures(selector Selector) []string {
+	var names []string
+	for _, f := range c.registry.Features() {
+		if selector.Matches(f.Tags) {
+			names = append(names, f.Name)
+		}
+	}
+	return names
+}
+
+// Feature returns the configuration of a known feature.
+func (c *Controls) Feature(name string) (config.FeatureConfig, bool) {
+	return c.registry.Lookup(name)
+}
+
+// SilencedFeatures returns the names of known features with alerts the matcher selects.
+func (c *Controls) SilencedFeatures(matcher SilenceMatcher) []string {
+	var names []string
+	for _, f := range c.registry.Features() {
+		if matcher.matchesFeature(f) {
+			names = append(names, f.Name)
+		}
+	}
+	return names
+}
+
+// AddSilence silences the alerts the matcher selects for the given duration from
+// startsAt, or from now when startsAt is zero.
+func (c *Controls) AddSilence(matcher SilenceMatcher, startsAt time.Time, duration time.Duration, reason string) (Silence, error) {
+	if err := matcher.validate(); err != nil {
+		return Silence{}, err
+	}
+	if duration <= 0 {
+		return Silence{}, fmt.Errorf("%w: %s", ErrInvalidDuration, duration)
+	}
+	now := c.clock.Now()
+	if startsAt.IsZero() {
+		startsAt = now
+	}
+	if !startsAt.Add(duration).After(now) {
+		return Silence{}, fmt.Errorf("%w: silence would have ended at %s", ErrInvalidDuration, startsAt.Add(duration).Format(time.RFC3339))
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := Silence{
+		ID:             c.newID("silence"),
+		SilenceMatcher: matcher,
+		Reason:         reason,
+		CreatedAt:      now,
+		StartsAt:       startsAt,
+		Until:          startsAt.Add(duration),
+	}
+	c.silences[s.ID] = s
+	c.logger.Info("Silence created",
+		zap.String("silence_id", s.ID),
+		zap.Any("selector", matcher.Selector),
+		zap.Strings("features", matcher.Features),
+		zap.Strings("checks", matcher.Checks),
+		zap.Time("starts_at", s.StartsAt),
+		zap.Time("until", s.Until),
+		zap.String("reason", reason),
+	)
+	return s, nil
+}
+
+// RemoveSilence deletes a silence, reporting whether it existed.
+func (c *Controls) RemoveSilence(id string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.silences[id]; !ok {
+		return false
+	}
+	delete(c.silences, id)
+	c.logger.Info("Silence removed", zap.String("silence_id", id))
+	return true
+}
+
+// Silences returns the silences that are in effect or pending, including the current
+// occurrences of maintenance windows, ordered by creation time.
+func (c *Controls) Silences() []Silence {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.clock.Now()
+	c.pruneLocked(now)
+
+	silences := make([]Silence, 0, len(c.silences))
+	for _, s := range c.silences {
+		silences = append(silences, s)
+	}
+	for _, w := range c.maintenance {
+		if s, ok := w.occurrence(now); ok {
+			silences = append(silences, s)
+		}
+	}
+	sort.Slice(silences, func(i, j int) bool { return silences[i].CreatedAt.Before(silences[j].CreatedAt) })
+	return silences
+}
+
+// SetSeverity overrides the severity of every feature matching the selector. A zero
+// duration keeps the override until it is removed.
+func (c *Controls) SetSeverity(selector Selector, severity string, duration time.Duration) (SeverityOverride, error) {
+	if len(selector) == 0 {
+		return SeverityOverride{}, ErrEmptySelector
+	}
+	switch severity {
+	case SeverityInfo, SeverityWarning, SeverityCritical:
+	default:
+		return SeverityOverride{}, fmt.Errorf("%w: %q", ErrUnknownSeverity, severity)
+	}
+	if duration < 0 {
+		return SeverityOverride{}, fmt.Errorf("%w: %s", ErrInvalidDuration, duration)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.clock.Now()
+	o := SeverityOverride{
+		ID:        c.newID("severity"),
+		Selector:  selector,
+		Severity:  severity,
+		CreatedAt: now,
+	}
+	if duration > 0 {
+		until := now.Add(duration)
+		o.Until = &until
+	}
+	c.overrides[o.ID] = o
+	c.logger.Info("Severity override created",
+		zap.String("override_id", o.ID),
+		zap.Any("selector", selector),
+		zap.String("severity", severity),
+		zap.Timep("until", o.Until),
+	)
+	return o, nil
+}
+
+// RemoveSeverityOverride deletes a severity override, reporting whether it existed.
+func (c *Controls) RemoveSeverityOverride(id string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.overrides[id]; !ok {
+		return false
+	}
+	delete(c.overrides, id)
+	c.logger.Info("Severity override removed", zap.String("override_id", id))
+	return true
+}
+
+// SeverityOverrides returns the active severity overrides ordered by creation time.
+func (c *Controls) SeverityOverrides() []SeverityOverride {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pruneLocked(c.clock.Now())
+
+	overrides := make([]SeverityOverride, 0, len(c.overrides))
+	for _, o := range c.overrides {
+		overrides = append(overrides, o)
+	}
+	sort.Slice(overrides, func(i, j int) bool { return overrides[i].CreatedAt.Before(overrides[j].CreatedAt) })
+	return overrides
+}
+
+// silenceFor returns a silence in effect for the feature's check, if any.
+func (c *Controls) silenceFor(f config.FeatureConfig, checkType string) (Silence, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.clock.Now()
+	c.pruneLocked(now)
+
+	for _, s := range c.silences {
+		if s.active(now) && s.matches(f, checkType) {
+			return s, true
+		}
+	}
+	for _, w := range c.maintenance {
+		if s, ok := w.occurrence(now); ok && s.matches(f, checkType) {
+			return s, true
+		}
+	}
+	return Silence{}, false
+}
+
+// activeSilencesLocked counts the silences in effect at now. MUST be called with the
+// mutex held.
+func (c *Controls) activeSilencesLocked(now time.Time) int {
+	var n int
+	for _, s := range c.silences {
+		if s.active(now) {
+			n++
+		}
+	}
+	for _, w := range c.maintenance {
+		if _, ok := w.occurrence(now); ok {
+			n++
+		}
+	}
+	return n
+}
+
+// severityFor returns the severity of a feature's violation: the most recent matching
+// override, or else the violation's own severity, if any.
+func (c *Controls) severityFor(f config.FeatureConfig, severity string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pruneLocked(c.clock.Now())
+
+	severity = cmp.Or(severity, defaultSeverity)
+	var newest time.Time
+	for _, o := range c.overrides {
+		if o.Selector.Matches(f.Tags) && o.CreatedAt.After(newest) {
+			severity, newest = o.Severity, o.CreatedAt
+		}
+	}
+	return severity
+}
+
+// pruneLocked drops expired silences, overrides, acknowledgements and stale alerts. MUST
+// be called with the mutex held.
+func (c *Controls) pruneLocked(now time.Time) {
+	for id, s := range c.silences {
+		if !now.Before(s.Until) {
+			delete(c.silences, id)
+			c.logger.Info("Silence expired", zap.String("silence_id", id))
+		}
+	}
+	for id, o := range c.overrides {
+		if o.expired(now) {
+			delete(c.overrides, id)
+			c.logger.Info("Severity override expired", zap.String("override_id", id))
+		}
+	}
+	for key, alert := range c.alerts {
+		if now.Sub(alert.lastSeen) > c.alertTTL {
+			delete(c.alerts, key)
+			continue
+		}
+		if alert.Acknowledgement.expired(now) {
+			c.logger.Info("Acknowledgement expired", zap.String("ack_id", alert.Acknowledgement.ID))
+			alert.Acknowledgement = nil
+			c.alerts[key] = alert
+		}
+	}
+}
+
+// newID returns a process-unique identifier. MUST be called with the mutex held.
+func (c *Controls) newID(kind string) string {
+	c.nextID++
+	return fmt.Sprintf("%s-%d", kind, c.nextID)
+}
@@ -0,0 +1,46 @@
+package pipeline
+
+import (
+	"math"
+	"time"
+
+	"github.com/sanspareilsmyn/featurelens/internal/config"
+)
+
+// CorrelationResult holds the Pearson correlation of a pair of fields over a window.
+type CorrelationResult struct {
+	Config      config.CorrelationConfig
+	WindowStart time.Time
+	WindowEnd   time.Time
+	Count       int64   // Messages holding numerical values for both fields
+	Coefficient float64 // NaN with fewer than two pairs or when either field is constant
+}
+
+// coMoments accumulates the means and centered second moments of a window's value pairs,
+// updated incrementally (Welford) to stay accurate for large, offset values.
+type coMoments struct {
+	count        int64
+	meanX, meanY float64
+	m2X, m2Y     float64 // Sums of squared deviations
+	cXY          float64 // Sum of co-deviations
+}
+
+func (m *coMoments) add(x, y float64) {
+	m.count++
+	n := float64(m.count)
+	dx, dy := x-m.meanX, y-m.meanY // Deviations from the previous means
+	m.meanX += dx / n
+	m.meanY += dy / n
+	m.m2X += dx * (x - m.meanX)
+	m.m2Y += dy * (y - m.meanY)
+	m.cXY += dx * (y - m.meanY)
+}
+
+// coefficient returns the Pearson correlation coefficient of the pairs added so far.
+func (m *coMoments) coefficient() float64 {
+	if m.count < 2 || m.m2X <= 0 || m.m2Y <= 0 {
+		return math.NaN()
+	}
+	r := m.cXY / math.Sqrt(m.m2X*m.m2Y)
+	return max(-1, min(1, r)) // Clamp rounding error
+}
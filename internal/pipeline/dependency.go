@@ -0,0 +1,74 @@
+package pipeline
+
+import (
+	"sort"
+
+	"github.com/sanspareilsmyn/featurelens/internal/config"
+)
+
+// dependencyGraph records which features are derived from which upstream features.
+type dependencyGraph struct {
+	upstream map[string][]string // Feature name to the features it is derived from
+}
+
+func newDependencyGraph(features []config.FeatureConfig) *dependencyGraph {
+	g := &dependencyGraph{upstream: make(map[string][]string)}
+	for _, f := range features {
+		if len(f.DependsOn) > 0 {
+			g.upstream[f.Name] = f.DependsOn
+		}
+	}
+	return g
+}
+
+// ancestors returns every feature the given feature transitively depends on, sorted by name.
+func (g *dependencyGraph) ancestors(featureName string) []string {
+	seen := make(map[string]struct{})
+	var visit func(string)
+	visit = func(name string) {
+		for _, parent := range g.upstream[name] {
+			if _, ok := seen[parent]; ok {
+				continue
+			}
+			seen[parent] = struct{}{}
+			visit(parent)
+		}
+	}
+	visit(featureName)
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// sortByDependency orders features so every feature comes after the features it depends on,
+// keeping the configured order otherwise. Cycles are rejected at config validation.
+func sortByDependency(features []config.FeatureConfig) []config.FeatureConfig {
+	byName := make(map[string]config.FeatureConfig, len(features))
+	for _, f := range features {
+		byName[f.Name] = f
+	}
+
+	sorted := make([]config.FeatureConfig, 0, len(features))
+	placed := make(map[string]bool, len(features))
+	var place func(config.FeatureConfig)
+	place = func(f config.FeatureConfig) {
+		if placed[f.Name] {
+			return
+		}
+		placed[f.Name] = true
+		for _, parent := range f.DependsOn {
+			if parentCfg, ok := byName[parent]; ok {
+				place(parentCfg)
+			}
+		}
+		sorted = append(sorted, f)
+	}
+	for _, f := range features {
+		place(f)
+	}
+	return sorted
+}
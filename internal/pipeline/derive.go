@@ -0,0 +1,48 @@
+package pipeline
+
+import (
+	"math"
+
+	"github.com/sanspareilsmyn/featurelens/internal/config"
+	"github.com/sanspareilsmyn/featurelens/internal/expr"
+	"github.com/sanspareilsmyn/featurelens/internal/message"
+)
+
+// derivedField is a derived field with its compiled expression.
+type derivedField struct {
+	name string
+	expr *expr.Expr
+}
+
+// withDerivedFields wraps parse so every decoded message also holds the derived fields,
+// computed in order. Null results, e.g. from a missing input, and non-finite ones, e.g. of
+// a division by zero, set the field to null; a field whose expression fails on the
+// message's values is left absent.
+func withDerivedFields(parse parseFunc, fields []config.DerivedFieldConfig, metrics *Metrics) parseFunc {
+	if len(fields) == 0 {
+		return parse
+	}
+	derived := make([]derivedField, len(fields))
+	for i, f := range fields {
+		e, _ := expr.Compile(f.Expr) // Validated at config load
+		derived[i] = derivedField{name: f.Name, expr: e}
+	}
+
+	return func(raw rawMessage) ([]message.DynamicMessage, error) {
+		msgs, err := parse(raw)
+		for _, msg := range msgs {
+			for _, d := range derived {
+				v, evalErr := d.expr.Eval(expr.MapEnv(msg))
+				if evalErr != nil {
+					metrics.derivedFieldErrors.WithLabelValues(d.name).Inc()
+					continue
+				}
+				if f, ok := v.(float64); ok && (math.IsNaN(f) || math.IsInf(f, 0)) {
+					v = nil
+				}
+				msg[d.name] = v
+			}
+		}
+		return msgs, err
+	}
+}
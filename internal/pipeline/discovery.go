@@ -0,0 +1,84 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/sanspareilsmyn/featurelens/internal/config"
+	"github.com/sanspareilsmyn/featurelens/internal/discovery"
+	"github.com/sanspareilsmyn/featurelens/internal/message"
+)
+
+// discoveryGroupSuffix keeps discovery from joining, and rebalancing, the monitoring consumer group.
+const discoveryGroupSuffix = "-discovery"
+
+// Discover consumes the configured topic for the given duration and profiles every message field.
+// Only the consumer and parser stages run; nothing is calculated or alerted.
+func Discover(ctx context.Context, cfg *config.Config, duration time.Duration, profiler *discovery.Profiler, logger *zap.Logger) error {
+	logger = logger.Named("discovery")
+	if err := sampleStream(ctx, cfg, discoveryGroupSuffix, duration, false, profiler.Observe, logger); err != nil { // Discovery profiles every field
+		return err
+	}
+	logger.Info("Schema discovery finished", zap.Int64("messages", profiler.Messages()))
+	return nil
+}
+
+// sampleStream consumes the configured topic for the given duration under its own
+// consumer group (the monitoring group ID plus groupSuffix), handing every parsed message
+// to observe. partial decodes only the monitored fields.
+func sampleStream(ctx context.Context, cfg *config.Config, groupSuffix string, duration time.Duration, partial bool, observe func(message.DynamicMessage), logger *zap.Logger) error {
+	kafkaCfg := cfg.Kafka
+	kafkaCfg.GroupID += groupSuffix
+
+	rawMessages := make(chan []rawMessage, batchBufferSize(cfg.Pipeline.Batch))
+	consumer, err := NewConsumer(kafkaCfg, cfg.Pipeline.Batch, rawMessages, logger.Named("consumer"))
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrConsumerCreationFailed, err)
+	}
+
+	p := &Pipeline{
+		cfg:            cfg,
+		consumer:       consumer,
+		logger:         logger,
+		parse:          newParseFunc(cfg, partial, unregisteredMetrics(), logger.Named("parser")),
+		rawMessages:    rawMessages,
+		parsedMessages: make(chan []message.DynamicMessage, batchBufferSize(cfg.Pipeline.Batch)),
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, duration)
+	defer cancel()
+
+	p.logger.Info("Sampling stream",
+		zap.String("topic", kafkaCfg.Subscription()),
+		zap.String("group_id", kafkaCfg.GroupID),
+		zap.Duration("duration", duration),
+	)
+
+	var wg sync.WaitGroup
+	errCh := make(chan error, 1)
+	wg.Add(2)
+	go p.runConsumer(ctx, &wg, errCh, p.consumer, p.rawMessages, nil)
+	go p.runParser(ctx, &wg, p.rawMessages, p.parsedMessages)
+
+	for batch := range p.parsedMessages {
+		for _, msg := range batch {
+			observe(msg)
+		}
+	}
+	wg.Wait()
+
+	select {
+	case err := <-errCh:
+		return err
+	default:
+	}
+	if err := ctx.Err(); err != nil && !errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package pipeline
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/sanspareilsmyn/featurelens/internal/config"
+	"github.com/sanspareilsmyn/featurelens/internal/message"
+)
+
+// dryRunGroupSuffix keeps dry runs from joining the monitoring consumer group.
+const dryRunGroupSuffix = "-dryrun"
+
+// DryRunReport describes how the configured features are covered by a sample of the stream.
+type DryRunReport struct {
+	Messages  int64             // Messages sampled
+	Features  []FeatureCoverage // Ordered by feature name
+	Unmatched []string          // Group patterns no sampled field matched
+}
+
+// FeatureCoverage counts a feature's values in the messages sampled, as the calculator
+// would aggregate them.
+type FeatureCoverage struct {
+	FeatureName  string
+	MetricType   string
+	Group        string // Group the feature belongs to, empty for individually named features
+	Messages     int64  // Messages in the feature's topics and tenant
+	Present      int64  // Messages holding the feature's key, including explicit nulls
+	Null         int64
+	TypeMismatch int64 // Non-null values that are not of the feature's metric type
+}
+
+// Problem describes why the sample does not match the feature's configuration, or is
+// empty if it does.
+func (c FeatureCoverage) Problem() string {
+	switch {
+	case c.Messages == 0:
+		return "no sampled message in the feature's topics or tenant"
+	case c.Present == 0:
+		return fmt.Sprintf("field absent from all %d messages", c.Messages)
+	case c.Present == c.Null:
+		return fmt.Sprintf("only null values in %d messages", c.Present)
+	case c.TypeMismatch > 0:
+		return fmt.Sprintf("%d of %d values are not %s", c.TypeMismatch, c.Present-c.Null, c.MetricType)
+	}
+	return ""
+}
+
+// OK reports whether the sample matched the configuration: messages were sampled, every
+// feature had values of its metric type and every group pattern matched a field.
+func (r DryRunReport) OK() bool {
+	if r.Messages == 0 || len(r.Unmatched) > 0 {
+		return false
+	}
+	for _, c := range r.Features {
+		if c.Problem() != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// DryRun consumes up to maxMessages messages of the configured topic, or as many as
+// arrive within timeout, and checks every configured feature against them. Messages go
+// through the configured parsing, script, filter and derived fields; session features,
+// which aggregate session summaries, are not checked.
+func DryRun(ctx context.Context, cfg *config.Config, maxMessages int64, timeout time.Duration, logger *zap.Logger) (DryRunReport, error) {
+	logger = logger.Named("dryrun")
+	registry := NewFeatureRegistry(cfg.Features, cfg.Pipeline.MaxDiscoveredFeatures, logger.Named("registry"))
+	calc := NewCalculator(cfg.Pipeline, registry, nil, nil, nil, nil, nil, nil, unregisteredMetrics(), logger.Named("calculator"))
+	stats := make(map[string]*FeatureStats)
+	messages := make(map[string]int64)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var report DryRunReport
+	observe := func(msg message.DynamicMessage) {
+		if report.Messages >= maxMessages {
+			return // Parsed before the cancellation took effect
+		}
+		report.Messages++
+		registry.Discover(msg)
+		tenant := messageTenant(msg, cfg.Pipeline.TenantField)
+		topic, _ := msg[message.TopicKey].(string)
+		for _, f := range registry.Features() {
+			if f.Scope == config.ScopeSession || !inTenant(f, cfg.Pipeline.TenantField, tenant) || !inTopics(f, topic) {
+				continue
+			}
+			messages[f.Name]++
+			s, ok := stats[f.Name]
+			if !ok {
+				s = &FeatureStats{}
+				stats[f.Name] = s
+			}
+			calc.accumulate(s, msg, f)
+		}
+		if report.Messages == maxMessages {
+			cancel()
+		}
+	}
+	err := sampleStream(ctx, cfg, dryRunGroupSuffix, timeout, cfg.Pipeline.PartialParsing, observe, logger)
+	if err != nil && !(errors.Is(err, context.Canceled) && report.Messages >= maxMessages) {
+		return DryRunReport{}, err
+	}
+
+	matched := make(map[string]bool)
+	for _, f := range registry.Features() {
+		if f.Scope == config.ScopeSession {
+			continue
+		}
+		matched[f.Group] = true
+		c := FeatureCoverage{FeatureName: f.Name, MetricType: f.MetricType, Group: f.Group, Messages: messages[f.Name]}
+		if s, ok := stats[f.Name]; ok {
+			c.Present = s.count - s.missingCount
+			c.Null = s.nullCount
+			c.TypeMismatch = s.typeMismatchCount
+		}
+		report.Features = append(report.Features, c)
+	}
+	sort.Slice(report.Features, func(i, j int) bool { return report.Features[i].FeatureName < report.Features[j].FeatureName })
+	for _, f := range cfg.Features {
+		if f.Pattern != "" && !matched[cmp.Or(f.Name, f.Pattern)] {
+			report.Unmatched = append(report.Unmatched, f.Pattern)
+		}
+	}
+	logger.Info("Dry run finished", zap.Int64("messages", report.Messages), zap.Int("features", len(report.Features)))
+	return report, nil
+}
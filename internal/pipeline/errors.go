@@ -3,10 +3,101 @@ package pipeline
 import "errors"
 
 var (
-	ErrInvalidKafkaConfig     = errors.New("invalid Kafka configuration provided")
-	ErrKafkaFetchFailed       = errors.New("failed to fetch message from Kafka")
-	ErrConsumerCreationFailed = errors.New("failed to create consumer")
-	ErrConsumerRunFailed      = errors.New("consumer component failed")
-	ErrCalculatorRunFailed    = errors.New("calculator component failed")
-	ErrAlerterRunFailed       = errors.New("alerter component failed")
+	ErrInvalidKafkaConfig         = errors.New("invalid Kafka configuration provided")
+	ErrKafkaFetchFailed           = errors.New("failed to fetch message from Kafka")
+	ErrOffsetCommitFailed         = errors.New("failed to commit consumer offsets")
+	ErrSpillFailed                = errors.New("failed to prepare window state spill directory")
+	ErrSubscriptionFailed         = errors.New("failed to resolve kafka subscription")
+	ErrSeekFailed                 = errors.New("failed to seek consumer group")
+	ErrSeekUnavailable            = errors.New("no consumer group to seek: replaying a file")
+	ErrPauseUnavailable           = errors.New("no consumer to pause: replaying a file")
+	ErrDrainTimeout               = errors.New("pipeline did not drain before the shutdown timeout")
+	ErrConsumerCreationFailed     = errors.New("failed to create consumer")
+	ErrSignerCreationFailed       = errors.New("failed to create signer")
+	ErrRemoteWriterCreationFailed = errors.New("failed to create remote writer")
+	ErrLedgerOpenFailed           = errors.New("failed to open sink delivery ledger")
+	ErrLedgerWriteFailed          = errors.New("failed to write sink delivery ledger")
+	ErrSinkCreationFailed         = errors.New("failed to create sinks")
+	ErrActionCreationFailed       = errors.New("failed to create actions")
+	ErrConsumerRunFailed          = errors.New("consumer component failed")
+	ErrReplayFailed               = errors.New("failed to replay messages")
+	ErrCalculatorRunFailed        = errors.New("calculator component failed")
+	ErrAlerterRunFailed           = errors.New("alerter component failed")
+	ErrSkewRunFailed              = errors.New("skew monitor component failed")
+	ErrSkewBaselineLoadFailed     = errors.New("failed to load skew baseline snapshot")
+	ErrBaselineWriteFailed        = errors.New("failed to write baseline snapshot")
+	ErrEmptySelector              = errors.New("tag selector cannot be empty")
+	ErrEmptySilence               = errors.New("silence needs a tag selector, features or checks")
+	ErrInvalidPattern             = errors.New("invalid glob pattern")
+	ErrUnknownSeverity            = errors.New("unknown severity")
+	ErrInvalidDuration            = errors.New("invalid duration")
+	ErrEmptyAcknowledger          = errors.New("acknowledgement needs the name of the acknowledger")
+	ErrAlertNotFiring             = errors.New("no matching firing alert")
+	ErrInvalidPartial             = errors.New("invalid partial window")
+	ErrMergerRunFailed            = errors.New("window merger component failed")
+	ErrSecretsRotated             = errors.New("secrets referenced by the configuration were rotated")
+	ErrStatsMergeFailed           = errors.New("failed to merge feature stats")
+	ErrMetricsRegistration        = errors.New("failed to register pipeline metrics")
+	ErrUnpackFailed               = errors.New("failed to unpack encoded object")
+	ErrUnknownPayloadFormat       = errors.New("unknown payload format")
+	ErrNoSchemaRegistry           = errors.New("payload in the schema registry wire format, but no schema registry is configured")
+	ErrUnknownExtension           = errors.New("unknown custom metric or check type")
+	ErrInvalidExtension           = errors.New("invalid custom metric or check")
 )
+
+// Component is the part of the pipeline an operational error occurred in.
+type Component string
+
+const (
+	ComponentConsumer    Component = "consumer"
+	ComponentParser      Component = "parser"
+	ComponentCalculator  Component = "calculator"
+	ComponentAlerter     Component = "alerter"
+	ComponentSink        Component = "sink"
+	ComponentStore       Component = "store" // Results store
+	ComponentAudit       Component = "audit"
+	ComponentRemoteWrite Component = "remote_write"
+	ComponentAction      Component = "action"
+	ComponentScaling     Component = "scaling"
+	ComponentSecrets     Component = "secrets"
+	ComponentPipeline    Component = "pipeline" // Draining and offset commits
+)
+
+// ErrorSeverity grades the impact of an operational error, unlike the severity of the
+// data-quality alerts raised on features.
+type ErrorSeverity string
+
+const (
+	// ErrorSeverityWarning is a degradation nothing was lost to yet, e.g. a delivery that
+	// will be retried.
+	ErrorSeverityWarning ErrorSeverity = "warning"
+	// ErrorSeverityError lost data or an output, e.g. dropped messages or events.
+	ErrorSeverityError ErrorSeverity = "error"
+	// ErrorSeverityCritical stops the pipeline.
+	ErrorSeverityCritical ErrorSeverity = "critical"
+)
+
+// errorSeverityRank orders severities, so notifications can require a minimum.
+var errorSeverityRank = map[ErrorSeverity]int{
+	ErrorSeverityWarning:  1,
+	ErrorSeverityError:    2,
+	ErrorSeverityCritical: 3,
+}
+
+// OpError is an operational failure of FeatureLens itself, such as a sink that is down or
+// a storm of unparseable messages, as opposed to a data-quality violation of a feature.
+type OpError struct {
+	Component Component
+	Op        string // What failed, of low cardinality, e.g. "deliver:chat" or "parse"
+	Severity  ErrorSeverity
+	Retryable bool // The operation is retried, or would likely succeed if it were
+	Err       error
+}
+
+func (e *OpError) Error() string {
+	return string(e.Component) + " " + e.Op + ": " + e.Err.Error()
+}
+
+func (e *OpError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,114 @@
+package pipeline
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sanspareilsmyn/featurelens/internal/config"
+	"github.com/sanspareilsmyn/featurelens/internal/schema"
+	"github.com/sanspareilsmyn/featurelens/internal/sink"
+)
+
+// errorNotificationBuffer is how many internal error notifications wait for the sink
+// dispatcher before further ones are dropped.
+const errorNotificationBuffer = 100
+
+// ErrorReporter counts the operational failures of every pipeline component by
+// component, severity and retryability, and notifies those of at least errors.notifySeverity
+// to the sinks named by errors.notifySinks. Notifications of one operation are sent at
+// most once per errors.notifyInterval, so a storm of failures, e.g. every message of a
+// topic failing to parse, yields one event carrying the count of those suppressed. Report
+// never blocks; a nil ErrorReporter discards reports.
+type ErrorReporter struct {
+	cfg           config.ErrorsConfig
+	minSeverity   int
+	notifications chan sink.Event // Read by the sink dispatcher; nil without notification
+	metrics       *Metrics
+
+	mu      sync.Mutex
+	pending map[string]*errorNotification // By component and operation
+}
+
+// errorNotification is the notification state of one operation's failures.
+type errorNotification struct {
+	lastSent   time.Time // Zero before the first notification
+	suppressed int64
+}
+
+// NewErrorReporter creates the reporter of the pipeline's operational failures.
+func NewErrorReporter(cfg config.ErrorsConfig, metrics *Metrics) *ErrorReporter {
+	r := &ErrorReporter{
+		cfg:         cfg,
+		minSeverity: errorSeverityRank[ErrorSeverity(cfg.NotifySeverity)],
+		metrics:     metrics,
+		pending:     make(map[string]*errorNotification),
+	}
+	if len(cfg.NotifySinks) > 0 {
+		r.notifications = make(chan sink.Event, errorNotificationBuffer)
+	}
+	return r
+}
+
+// Notifications returns the channel of internal_error events for the sinks, nil when
+// notification is disabled.
+func (r *ErrorReporter) Notifications() <-chan sink.Event {
+	if r == nil {
+		return nil
+	}
+	return r.notifications
+}
+
+// Report records an operational failure. Callers still log it with its context.
+func (r *ErrorReporter) Report(e *OpError) {
+	if r == nil || e == nil {
+		return
+	}
+	r.metrics.internalErrors.WithLabelValues(string(e.Component), string(e.Severity), strconv.FormatBool(e.Retryable)).Inc()
+	if r.notifications == nil || errorSeverityRank[e.Severity] < r.minSeverity {
+		return
+	}
+
+	now := time.Now()
+	key := string(e.Component) + "|" + e.Op
+	r.mu.Lock()
+	state, ok := r.pending[key]
+	if !ok {
+		state = &errorNotification{}
+		r.pending[key] = state
+	}
+	if !state.lastSent.IsZero() && now.Sub(state.lastSent) < r.cfg.NotifyInterval {
+		state.suppressed++
+		r.mu.Unlock()
+		r.metrics.internalNotifications.WithLabelValues("suppressed").Inc()
+		return
+	}
+	suppressed := state.suppressed
+	state.lastSent, state.suppressed = now, 0
+	r.mu.Unlock()
+
+	payload := schema.InternalError{
+		SchemaVersion: schema.Version,
+		Kind:          schema.KindInternalError,
+		EventID:       eventID(schema.KindInternalError, string(e.Component), now, e.Op),
+		Component:     string(e.Component),
+		Operation:     e.Op,
+		Severity:      string(e.Severity),
+		Retryable:     e.Retryable,
+		Message:       e.Err.Error(),
+		Suppressed:    suppressed,
+		DetectedAt:    now,
+	}
+	select {
+	case r.notifications <- sink.Event{
+		Kind:      schema.KindInternalError,
+		ID:        payload.EventID,
+		Sinks:     r.cfg.NotifySinks,
+		WindowEnd: now,
+		Payload:   payload,
+	}:
+		r.metrics.internalNotifications.WithLabelValues("queued").Inc()
+	default:
+		r.metrics.internalNotifications.WithLabelValues("dropped").Inc()
+	}
+}
@@ -0,0 +1,156 @@
+package pipeline
+
+import (
+	"context"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/sanspareilsmyn/featurelens/internal/message"
+	"github.com/sanspareilsmyn/featurelens/internal/schema"
+)
+
+// maxTraceIDLength bounds the trace IDs kept as exemplars. Prometheus limits the labels
+// of an exemplar to 128 characters in total, so longer IDs are ignored.
+const maxTraceIDLength = 64
+
+// exemplarSet holds the trace IDs of a feature's messages in a window, with
+// pipeline.exemplars.
+type exemplarSet struct {
+	values   valueSamples    // Of messages with a value
+	nulls    valueSamples    // Of messages with a null or missing value
+	min, max schema.Exemplar // Messages with the smallest and largest numerical value, zero until one carried an ID
+}
+
+// traceID returns the message's trace ID, "" if it carries none.
+func traceID(msg message.DynamicMessage, field string) string {
+	id, ok := msg.GetString(field)
+	if !ok || len(id) > maxTraceIDLength {
+		return ""
+	}
+	return id
+}
+
+// observeExemplar offers the message's trace ID to the exemplars of stats. prevCount,
+// prevMin and prevMax are the stats' numerical values before the message was
+// accumulated, so the message is the new smallest or largest value's if they moved.
+func (c *Calculator) observeExemplar(stats *FeatureStats, msg message.DynamicMessage, hasValue bool, prevCount int64, prevMin, prevMax float64) {
+	id := traceID(msg, c.config.Exemplars.TraceField)
+	if id == "" {
+		return
+	}
+	if stats.exemplars == nil {
+		stats.exemplars = &exemplarSet{}
+	}
+	e := stats.exemplars
+	size := c.config.Exemplars.Size
+	if !hasValue {
+		if i := e.nulls.slot(size); i >= 0 {
+			e.nulls.values[i] = id
+		}
+		return
+	}
+	if i := e.values.slot(size); i >= 0 {
+		e.values.values[i] = id
+	}
+	if stats.valueCount > prevCount {
+		if prevCount == 0 || stats.min < prevMin {
+			e.min = schema.Exemplar{TraceID: id, Kind: schema.ExemplarMin, Value: schema.OptionalFloat(stats.min)}
+		}
+		if prevCount == 0 || stats.max > prevMax {
+			e.max = schema.Exemplar{TraceID: id, Kind: schema.ExemplarMax, Value: schema.OptionalFloat(stats.max)}
+		}
+	}
+}
+
+// merge combines other into e, keeping the more extreme of their smallest and largest
+// values' exemplars.
+func (e *exemplarSet) merge(other *exemplarSet) {
+	e.values.merge(&other.values)
+	e.nulls.merge(&other.nulls)
+	if other.min.Value != nil && (e.min.Value == nil || *other.min.Value < *e.min.Value) {
+		e.min = other.min
+	}
+	if other.max.Value != nil && (e.max.Value == nil || *other.max.Value > *e.max.Value) {
+		e.max = other.max
+	}
+}
+
+// exemplars returns the set's exemplars: the smallest and largest values' first, then the
+// sampled ones. It returns nil for a nil set.
+func (e *exemplarSet) exemplars() []schema.Exemplar {
+	if e == nil {
+		return nil
+	}
+	var exemplars []schema.Exemplar
+	for _, extreme := range []schema.Exemplar{e.min, e.max} {
+		if extreme.TraceID != "" {
+			exemplars = append(exemplars, extreme)
+		}
+	}
+	for _, id := range e.values.values {
+		exemplars = append(exemplars, schema.Exemplar{TraceID: id, Kind: schema.ExemplarValue})
+	}
+	for _, id := range e.nulls.values {
+		exemplars = append(exemplars, schema.Exemplar{TraceID: id, Kind: schema.ExemplarNull})
+	}
+	return exemplars
+}
+
+// violationExemplars returns the exemplars of a window relevant to a violation of it: the
+// messages without a value for null and missing rates, otherwise those with a value, the
+// smallest one's first for lower bounds and the largest one's for upper bounds.
+func violationExemplars(exemplars []schema.Exemplar, checkType, comparison string) []schema.Exemplar {
+	var kinds []string
+	switch {
+	case checkType == "null_rate" || checkType == "missing_rate":
+		kinds = []string{schema.ExemplarNull}
+	case strings.HasPrefix(comparison, "<"):
+		kinds = []string{schema.ExemplarMin, schema.ExemplarValue}
+	case strings.HasPrefix(comparison, ">"):
+		kinds = []string{schema.ExemplarMax, schema.ExemplarValue}
+	default:
+		kinds = []string{schema.ExemplarMin, schema.ExemplarMax, schema.ExemplarValue}
+	}
+	var relevant []schema.Exemplar
+	for _, kind := range kinds {
+		for _, e := range exemplars {
+			if e.Kind == kind {
+				relevant = append(relevant, e)
+			}
+		}
+	}
+	return relevant
+}
+
+// exemplarLabels returns the labels of the Prometheus exemplar of a violation, nil if
+// it has no exemplar.
+func exemplarLabels(v Violation) prometheus.Labels {
+	if len(v.Exemplars) == 0 {
+		return nil
+	}
+	return prometheus.Labels{"trace_id": v.Exemplars[0].TraceID}
+}
+
+// exemplarContext returns ctx carrying the trace of a violation's first exemplar as a
+// sampled remote span context, so measurements recorded with it get an OpenTelemetry
+// exemplar. IDs are read as W3C traceparent headers or 32-digit hexadecimal trace IDs;
+// ctx is returned as is for other IDs.
+func exemplarContext(ctx context.Context, v Violation) context.Context {
+	if len(v.Exemplars) == 0 {
+		return ctx
+	}
+	id := v.Exemplars[0].TraceID
+	var spanID trace.SpanID
+	if parts := strings.Split(id, "-"); len(parts) == 4 { // version-traceid-parentid-flags
+		id = parts[1]
+		spanID, _ = trace.SpanIDFromHex(parts[2])
+	}
+	traceID, err := trace.TraceIDFromHex(id)
+	if err != nil {
+		return ctx
+	}
+	sc := trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: spanID, TraceFlags: trace.FlagsSampled, Remote: true})
+	return trace.ContextWithRemoteSpanContext(ctx, sc)
+}
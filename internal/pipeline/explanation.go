@@ -0,0 +1,144 @@
+package pipeline
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxCategoryChanges bounds the number of category share changes attached to an explanation.
+const maxCategoryChanges = 5
+
+// Explanation compares a violating window with the feature's previous healthy window.
+type Explanation struct {
+	BaselineWindowStart time.Time
+	BaselineWindowEnd   time.Time
+	Deltas              []StatDelta
+	CategoryChanges     []CategoryChange // Largest share changes first, categorical features only
+}
+
+// StatDelta is the change of one statistic between the baseline and violating windows.
+type StatDelta struct {
+	Stat   string
+	Before float64
+	After  float64
+}
+
+// CategoryChange is the change of one category's share of values between windows.
+type CategoryChange struct {
+	Value       string
+	BeforeShare float64
+	AfterShare  float64
+}
+
+// explain builds the comparison between the current result and the last healthy window of
+// its feature in lastHealthy, or returns nil when the feature had none yet.
+func explain(lastHealthy map[string]AggregationResult, current AggregationResult) *Explanation {
+	baseline, ok := lastHealthy[current.FeatureName]
+	if !ok {
+		return nil
+	}
+	e := &Explanation{
+		BaselineWindowStart: baseline.WindowStart,
+		BaselineWindowEnd:   baseline.WindowEnd,
+	}
+
+	before, after := windowStats(baseline), windowStats(current)
+	for _, stat := range []string{"count", "null_rate", "missing_rate", "type_mismatch_rate", "mean", "stddev"} {
+		b, a := before[stat], after[stat]
+		if math.IsNaN(b) || math.IsNaN(a) {
+			continue
+		}
+		e.Deltas = append(e.Deltas, StatDelta{Stat: stat, Before: b, After: a})
+	}
+
+	if baseline.Categories != nil || current.Categories != nil {
+		e.CategoryChanges = categoryChanges(baseline.Categories, current.Categories, maxCategoryChanges)
+	}
+	return e
+}
+
+// windowStats returns the comparable statistics of a result; unavailable ones are NaN.
+func windowStats(r AggregationResult) map[string]float64 {
+	stdDev := math.NaN()
+	if !math.IsNaN(r.Variance) && r.Variance >= 0 {
+		stdDev = math.Sqrt(r.Variance)
+	}
+	return map[string]float64{
+		"count":              float64(r.Count),
+		"null_rate":          r.rate(r.NullCount),
+		"missing_rate":       r.rate(r.MissingCount),
+		"type_mismatch_rate": r.rate(r.TypeMismatchCount),
+		"mean":               r.Mean,
+		"stddev":             stdDev,
+	}
+}
+
+// categoryChanges returns the k categories whose share of values changed the most.
+func categoryChanges(before, after map[string]int64, k int) []CategoryChange {
+	beforeTotal, afterTotal := sumCounts(before), sumCounts(after)
+	share := func(counts map[string]int64, total int64, value string) float64 {
+		if total == 0 {
+			return 0
+		}
+		return float64(counts[value]) / float64(total)
+	}
+
+	seen := make(map[string]struct{}, len(before)+len(after))
+	var changes []CategoryChange
+	for _, counts := range []map[string]int64{before, after} {
+		for value := range counts {
+			if _, dup := seen[value]; dup {
+				continue
+			}
+			seen[value] = struct{}{}
+			changes = append(changes, CategoryChange{
+				Value:       value,
+				BeforeShare: share(before, beforeTotal, value),
+				AfterShare:  share(after, afterTotal, value),
+			})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		di := math.Abs(changes[i].AfterShare - changes[i].BeforeShare)
+		dj := math.Abs(changes[j].AfterShare - changes[j].BeforeShare)
+		if di != dj {
+			return di > dj
+		}
+		return changes[i].Value < changes[j].Value
+	})
+	if len(changes) > k {
+		changes = changes[:k]
+	}
+	return changes
+}
+
+func sumCounts(counts map[string]int64) int64 {
+	var total int64
+	for _, c := range counts {
+		total += c
+	}
+	return total
+}
+
+// Summary renders the explanation compactly for logs, e.g. "mean 10.1→14.3 (+41.6%)".
+func (e *Explanation) Summary() string {
+	parts := make([]string, 0, len(e.Deltas)+len(e.CategoryChanges))
+	for _, d := range e.Deltas {
+		parts = append(parts, fmt.Sprintf("%s %.4g→%.4g (%s)", d.Stat, d.Before, d.After, relativeChange(d.Before, d.After)))
+	}
+	for _, c := range e.CategoryChanges {
+		parts = append(parts, fmt.Sprintf("category %q %.1f%%→%.1f%%", c.Value, c.BeforeShare*100, c.AfterShare*100))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func relativeChange(before, after float64) string {
+	if before == 0 {
+		return fmt.Sprintf("%+.4g", after-before)
+	}
+	return fmt.Sprintf("%+.1f%%", (after-before)/math.Abs(before)*100)
+}
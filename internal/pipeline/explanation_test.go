@@ -0,0 +1,150 @@
+package pipeline
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestExplainWithoutBaseline(t *testing.T) {
+	lastHealthy := map[string]AggregationResult{"other": {FeatureName: "other", Count: 10}}
+	if e := explain(lastHealthy, AggregationResult{FeatureName: "amount", Count: 10}); e != nil {
+		t.Errorf("got %+v, want no explanation", e)
+	}
+	if e := explain(nil, AggregationResult{FeatureName: "amount", Count: 10}); e != nil {
+		t.Errorf("without healthy windows: got %+v, want no explanation", e)
+	}
+}
+
+// TestExplainSkipsUnavailableStats checks that statistics either window lacks, like the
+// mean of a categorical feature or the rates of an empty window, are left out.
+func TestExplainSkipsUnavailableStats(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	baseline := AggregationResult{
+		FeatureName: "amount",
+		WindowStart: start,
+		WindowEnd:   start.Add(time.Minute),
+		Count:       0,
+		Mean:        math.NaN(),
+		Variance:    math.NaN(),
+	}
+	current := AggregationResult{
+		FeatureName: "amount",
+		WindowStart: start.Add(time.Minute),
+		WindowEnd:   start.Add(2 * time.Minute),
+		Count:       4,
+		NullCount:   1,
+		Mean:        12,
+		Variance:    4,
+	}
+	e := explain(map[string]AggregationResult{"amount": baseline}, current)
+	if e == nil {
+		t.Fatal("got no explanation")
+	}
+	if !e.BaselineWindowStart.Equal(baseline.WindowStart) || !e.BaselineWindowEnd.Equal(baseline.WindowEnd) {
+		t.Errorf("got baseline window %s-%s, want %s-%s", e.BaselineWindowStart, e.BaselineWindowEnd, baseline.WindowStart, baseline.WindowEnd)
+	}
+	if want := []StatDelta{{Stat: "count", Before: 0, After: 4}}; !reflect.DeepEqual(e.Deltas, want) {
+		t.Errorf("got deltas %+v, want %+v", e.Deltas, want)
+	}
+	if e.CategoryChanges != nil {
+		t.Errorf("got category changes %+v of a numerical feature, want none", e.CategoryChanges)
+	}
+
+	// With both windows populated, every statistic is compared
+	baseline.Count, baseline.Mean, baseline.Variance = 4, 10, 1
+	e = explain(map[string]AggregationResult{"amount": baseline}, current)
+	want := []StatDelta{
+		{Stat: "count", Before: 4, After: 4},
+		{Stat: "null_rate", Before: 0, After: 0.25},
+		{Stat: "missing_rate", Before: 0, After: 0},
+		{Stat: "type_mismatch_rate", Before: 0, After: 0},
+		{Stat: "mean", Before: 10, After: 12},
+		{Stat: "stddev", Before: 1, After: 2},
+	}
+	if !reflect.DeepEqual(e.Deltas, want) {
+		t.Errorf("got deltas %+v, want %+v", e.Deltas, want)
+	}
+}
+
+// TestCategoryChanges checks that the categories whose share changed most come first,
+// ties broken by value, and that only k are kept.
+func TestCategoryChanges(t *testing.T) {
+	before := map[string]int64{"KR": 50, "US": 30, "JP": 10, "DE": 10}
+	after := map[string]int64{"KR": 20, "US": 30, "JP": 20, "FR": 20, "DE": 10}
+	tests := []struct {
+		k    int
+		want []CategoryChange
+	}{
+		{k: 5, want: []CategoryChange{
+			{Value: "KR", BeforeShare: 0.5, AfterShare: 0.2},
+			{Value: "FR", BeforeShare: 0, AfterShare: 0.2},
+			{Value: "JP", BeforeShare: 0.1, AfterShare: 0.2},
+			{Value: "DE", BeforeShare: 0.1, AfterShare: 0.1},
+			{Value: "US", BeforeShare: 0.3, AfterShare: 0.3},
+		}},
+		{k: 2, want: []CategoryChange{
+			{Value: "KR", BeforeShare: 0.5, AfterShare: 0.2},
+			{Value: "FR", BeforeShare: 0, AfterShare: 0.2},
+		}},
+	}
+	for _, tt := range tests {
+		got := categoryChanges(before, after, tt.k)
+		if len(got) != len(tt.want) {
+			t.Errorf("k=%d: got %+v, want %+v", tt.k, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i].Value != tt.want[i].Value ||
+				math.Abs(got[i].BeforeShare-tt.want[i].BeforeShare) > 1e-12 ||
+				math.Abs(got[i].AfterShare-tt.want[i].AfterShare) > 1e-12 {
+				t.Errorf("k=%d, change %d: got %+v, want %+v", tt.k, i, got[i], tt.want[i])
+			}
+		}
+	}
+
+	// A window without values has no shares rather than dividing by zero
+	got := categoryChanges(nil, map[string]int64{"KR": 1}, 5)
+	if want := []CategoryChange{{Value: "KR", BeforeShare: 0, AfterShare: 1}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("empty baseline: got %+v, want %+v", got, want)
+	}
+}
+
+func TestExplanationSummary(t *testing.T) {
+	e := &Explanation{
+		Deltas: []StatDelta{
+			{Stat: "mean", Before: 10.1, After: 14.3},
+			{Stat: "stddev", Before: 2, After: 1},
+			{Stat: "null_rate", Before: 0, After: 0.25}, // No relative change from zero
+			{Stat: "count", Before: 0, After: 0},
+		},
+		CategoryChanges: []CategoryChange{{Value: "KR", BeforeShare: 0.5, AfterShare: 0.2}},
+	}
+	want := `mean 10.1→14.3 (+41.6%), stddev 2→1 (-50.0%), null_rate 0→0.25 (+0.25), count 0→0 (+0), category "KR" 50.0%→20.0%`
+	if got := e.Summary(); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	if got := (&Explanation{}).Summary(); got != "" {
+		t.Errorf("empty explanation: got %q, want \"\"", got)
+	}
+}
+
+func TestRelativeChange(t *testing.T) {
+	tests := []struct {
+		before, after float64
+		want          string
+	}{
+		{before: 10, after: 15, want: "+50.0%"},
+		{before: -10, after: -15, want: "-50.0%"}, // Relative to the magnitude, so signs follow the change
+		{before: -10, after: 5, want: "+150.0%"},
+		{before: 0, after: 0.5, want: "+0.5"},
+		{before: 0, after: -3, want: "-3"},
+		{before: 0, after: 0, want: "+0"},
+	}
+	for _, tt := range tests {
+		if got := relativeChange(tt.before, tt.after); got != tt.want {
+			t.Errorf("relativeChange(%v, %v): got %s, want %s", tt.before, tt.after, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package pipeline
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"sync"
+
+	"go.uber.org/zap"
+
+	"github.com/sanspareilsmyn/featurelens/internal/config"
+	"github.com/sanspareilsmyn/featurelens/internal/logging"
+	"github.com/sanspareilsmyn/featurelens/internal/params"
+)
+
+// Metric computes a custom statistic of a feature's window from its result. Compute
+// returns NaN when the statistic is undefined for the window.
+type Metric interface {
+	Compute(result AggregationResult) float64
+}
+
+// Check evaluates a custom check on a feature's window. Its result carries the window's
+// custom metrics. A check is instantiated per feature and only called from the alerter,
+// so it may keep state across windows.
+type Check interface {
+	Evaluate(result AggregationResult) []Finding
+}
+
+// Finding is a breach reported by a custom check, raised as a violation of type
+// custom:<name>.
+type Finding struct {
+	Comparison string // e.g. "<", ">"
+	Actual     float64
+	Threshold  float64
+}
+
+// MetricFactory builds a custom metric from its configuration parameters.
+type MetricFactory func(params params.Params, logger *zap.Logger) (Metric, error)
+
+// CheckFactory builds a custom check from its configuration parameters.
+type CheckFactory func(params params.Params, logger *zap.Logger) (Check, error)
+
+// customCheckPrefix prefixes the check type of violations raised by custom checks.
+const customCheckPrefix = "custom:"
+
+var (
+	extensionsMu    sync.RWMutex
+	metricFactories = map[string]MetricFactory{}
+	checkFactories  = map[string]CheckFactory{}
+)
+
+// RegisterMetric makes a custom metric type available to features' customMetrics. It is
+// typically called from an init function; registering an existing name replaces it.
+func RegisterMetric(name string, factory MetricFactory) {
+	extensionsMu.Lock()
+	defer extensionsMu.Unlock()
+	metricFactories[name] = factory
+}
+
+// RegisterCheck makes a custom check type available to features' customChecks. It is
+// typically called from an init function; registering an existing name replaces it.
+func RegisterCheck(name string, factory CheckFactory) {
+	extensionsMu.Lock()
+	defer extensionsMu.Unlock()
+	checkFactories[name] = factory
+}
+
+// MetricTypes returns the registered custom metric type names.
+func MetricTypes() []string {
+	extensionsMu.RLock()
+	defer extensionsMu.RUnlock()
+	return sortedKeys(metricFactories)
+}
+
+// CheckTypes returns the registered custom check type names.
+func CheckTypes() []string {
+	extensionsMu.RLock()
+	defer extensionsMu.RUnlock()
+	return sortedKeys(checkFactories)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+type namedMetric struct {
+	name   string
+	metric Metric
+}
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// extensions holds the custom metrics and checks of each feature, segment and model
+// version, instantiated on its first window. It is only used by the alerter.
+type extensions struct {
+	logger  *zap.Logger
+	metrics map[string][]namedMetric // By result feature name
+	checks  map[string][]namedCheck
+}
+
+func newExtensions(logger *zap.Logger) *extensions {
+	return &extensions{
+		logger:  logger,
+		metrics: make(map[string][]namedMetric),
+		checks:  make(map[string][]namedCheck),
+	}
+}
+
+// validateExtensions builds the custom metrics and checks of the configured features once,
+// so unknown types and invalid parameters fail at startup rather than on a first window.
+func validateExtensions(features []config.FeatureConfig, logger *zap.Logger) error {
+	for _, f := range features {
+		if _, err := buildMetrics(f, logger); err != nil {
+			return err
+		}
+		if _, err := buildChecks(f, logger); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func buildMetrics(f config.FeatureConfig, logger *zap.Logger) ([]namedMetric, error) {
+	extensionsMu.RLock()
+	defer extensionsMu.RUnlock()
+
+	metrics := make([]namedMetric, 0, len(f.CustomMetrics))
+	for _, cfg := range f.CustomMetrics {
+		name := cfg.ExtensionName()
+		if slices.Contains(conditionVariables, name) {
+			return nil, fmt.Errorf("%w: feature %q custom metric %q shadows a built-in variable", ErrInvalidExtension, f.Name, name)
+		}
+		factory, ok := metricFactories[cfg.Type]
+		if !ok {
+			return nil, fmt.Errorf("%w: feature %q custom metric type %q, registered: %v", ErrUnknownExtension, f.Name, cfg.Type, sortedKeys(metricFactories))
+		}
+		metric, err := factory(params.Params(cfg.Params), logger.Named(cfg.Type))
+		if err != nil {
+			return nil, fmt.Errorf("%w: feature %q custom metric %q: %w", ErrInvalidExtension, f.Name, name, err)
+		}
+		metrics = append(metrics, namedMetric{name: name, metric: metric})
+	}
+	return metrics, nil
+}
+
+func buildChecks(f config.FeatureConfig, logger *zap.Logger) ([]namedCheck, error) {
+	extensionsMu.RLock()
+	defer extensionsMu.RUnlock()
+
+	checks := make([]namedCheck, 0, len(f.CustomChecks))
+	for _, cfg := range f.CustomChecks {
+		name := cfg.ExtensionName()
+		factory, ok := checkFactories[cfg.Type]
+		if !ok {
+			return nil, fmt.Errorf("%w: feature %q custom check type %q, registered: %v", ErrUnknownExtension, f.Name, cfg.Type, sortedKeys(checkFactories))
+		}
+		check, err := factory(params.Params(cfg.Params), logger.Named(cfg.Type))
+		if err != nil {
+			return nil, fmt.Errorf("%w: feature %q custom check %q: %w", ErrInvalidExtension, f.Name, name, err)
+		}
+		checks = append(checks, namedCheck{name: name, check: check})
+	}
+	return checks, nil
+}
+
+// computeMetrics sets the result's custom metrics, leaving out those undefined for the
+// window. Features whose extensions cannot be built, e.g. discovered ones with a type
+// registered after startup was validated, are logged once and get no custom metrics.
+func (e *extensions) computeMetrics(f config.FeatureConfig, result *AggregationResult) {
+	metrics, ok := e.metrics[result.FeatureName]
+	if !ok {
+		var err error
+		if metrics, err = buildMetrics(f, e.logger); err != nil {
+			e.logger.Error("Skipping custom metrics", logging.Feature(result.FeatureName), zap.Error(err))
+		}
+		e.metrics[result.FeatureName] = metrics
+	}
+	for _, m := range metrics {
+		v := m.metric.Compute(*result)
+		if math.IsNaN(v) {
+			continue
+		}
+		if result.Custom == nil {
+			result.Custom = make(map[string]float64, len(metrics))
+		}
+		result.Custom[m.name] = v
+	}
+}
+
+// evaluateChecks runs the feature's custom checks on a window.
+func (e *extensions) evaluateChecks(f config.FeatureConfig, result AggregationResult) []Violation {
+	checks, ok := e.checks[result.FeatureName]
+	if !ok {
+		var err error
+		if checks, err = buildChecks(f, e.logger); err != nil {
+			e.logger.Error("Skipping custom checks", logging.Feature(result.FeatureName), zap.Error(err))
+		}
+		e.checks[result.FeatureName] = checks
+	}
+	var violations []Violation
+	for _, c := range checks {
+		for _, finding := range c.check.Evaluate(result) {
+			violations = append(violations, newViolation(result, customCheckPrefix+c.name, finding.Comparison, finding.Actual, finding.Threshold))
+		}
+	}
+	return violations
+}
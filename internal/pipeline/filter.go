@@ -0,0 +1,30 @@
+package pipeline
+
+import (
+	"github.com/sanspareilsmyn/featurelens/internal/expr"
+	"github.com/sanspareilsmyn/featurelens/internal/message"
+)
+
+// withFilter wraps parse so only the decoded messages the filter is true for are
+// returned. Like conditions, a filter that is null or fails on a message's values, e.g. a
+// comparison of a string with a number, is not true.
+func withFilter(parse parseFunc, filter string, metrics *Metrics) parseFunc {
+	if filter == "" {
+		return parse
+	}
+	e, _ := expr.Compile(filter) // Validated at config load
+
+	return func(raw rawMessage) ([]message.DynamicMessage, error) {
+		msgs, err := parse(raw)
+		kept := msgs[:0]
+		for _, msg := range msgs {
+			if match, evalErr := e.EvalBool(expr.MapEnv(msg)); evalErr == nil && match {
+				kept = append(kept, msg)
+				continue
+			}
+			metrics.messagesFiltered.Inc()
+			message.Release(msg)
+		}
+		return kept, err
+	}
+}
@@ -0,0 +1,138 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/sanspareilsmyn/featurelens/internal/config"
+	"github.com/sanspareilsmyn/featurelens/internal/intern"
+	"github.com/sanspareilsmyn/featurelens/internal/message"
+	"github.com/sanspareilsmyn/featurelens/internal/schemaregistry"
+)
+
+// Detected formats of the auto format that are not configurable formats.
+const (
+	formatSchemaRegistry = "schema_registry" // Confluent wire format, Avro, Protobuf or JSON
+	formatUnknown        = "unknown"
+)
+
+// contentTypes maps values of the format header, media types or format names, to the
+// format of the payload.
+var contentTypes = map[string]string{
+	"application/json":      config.FormatJSON,
+	"json":                  config.FormatJSON,
+	"application/x-ndjson":  config.FormatJSONLines,
+	"application/jsonl":     config.FormatJSONLines,
+	"jsonl":                 config.FormatJSONLines,
+	"application/msgpack":   config.FormatMsgPack,
+	"application/x-msgpack": config.FormatMsgPack,
+	"msgpack":               config.FormatMsgPack,
+	"application/cbor":      config.FormatCBOR,
+	"cbor":                  config.FormatCBOR,
+
+	// Avro and Protobuf payloads are only decoded in the wire format, with their schema
+	"application/avro":                   formatSchemaRegistry,
+	"application/vnd.apache.avro+binary": formatSchemaRegistry,
+	"avro/binary":                        formatSchemaRegistry,
+	"avro":                               formatSchemaRegistry,
+	"application/protobuf":               formatSchemaRegistry,
+	"application/x-protobuf":             formatSchemaRegistry,
+	"application/vnd.google.protobuf":    formatSchemaRegistry,
+	"protobuf":                           formatSchemaRegistry,
+}
+
+// formatDetector decodes the payloads of the auto format, for topics carrying several
+// encodings at once: each message with the decoder of the format its format header
+// names or, without a known one, of the format its leading bytes reveal.
+type formatDetector struct {
+	header   string
+	decoders map[string]decodeFunc
+	registry *schemaregistry.Client // nil without pipeline.schemaRegistry.url
+	metrics  *Metrics
+}
+
+func newFormatDetector(cfg *config.Config, partial bool, values *intern.Pool, metrics *Metrics, logger *zap.Logger) *formatDetector {
+	d := &formatDetector{
+		header:   cfg.Pipeline.FormatHeader,
+		decoders: make(map[string]decodeFunc),
+		metrics:  metrics,
+	}
+	for _, format := range []string{config.FormatJSON, config.FormatJSONLines, config.FormatMsgPack, config.FormatCBOR} {
+		d.decoders[format] = newDecoder(cfg, format, partial, values, logger)
+	}
+	if registry := cfg.Pipeline.SchemaRegistry; registry.URL != "" {
+		d.registry, _ = schemaregistry.New(schemaregistry.Options{ // URL validated at config load
+			URL:      registry.URL,
+			Username: registry.Username,
+			Password: registry.Password,
+			Timeout:  registry.Timeout,
+		})
+	}
+	return d
+}
+
+// decode decodes a raw message with the decoder of its detected format.
+func (d *formatDetector) decode(raw rawMessage) ([]message.DynamicMessage, error) {
+	format := d.format(raw)
+	d.metrics.payloadFormats.WithLabelValues(format).Inc()
+	switch format {
+	case formatUnknown:
+		return nil, fmt.Errorf("%w: neither a known %s header nor leading bytes of a supported format", ErrUnknownPayloadFormat, d.header)
+	case formatSchemaRegistry:
+		if d.registry == nil {
+			return nil, ErrNoSchemaRegistry
+		}
+		msg, err := d.registry.Decode(context.Background(), raw.value) // The client's timeout bounds lookups
+		if err != nil {
+			return nil, err
+		}
+		return []message.DynamicMessage{msg}, nil
+	default:
+		return d.decoders[format](raw.value)
+	}
+}
+
+// format returns the format the message's format header names, or else the one its
+// payload's leading bytes reveal.
+func (d *formatDetector) format(raw rawMessage) string {
+	if value, ok := header(raw.headers, d.header); ok {
+		mediaType, _, _ := strings.Cut(string(value), ";") // Parameters such as charset do not matter
+		if format, ok := contentTypes[strings.ToLower(strings.TrimSpace(mediaType))]; ok {
+			return format
+		}
+	}
+	return sniffFormat(raw.value)
+}
+
+// sniffFormat returns the format of a payload from its leading bytes: the zero magic
+// byte of the wire format, an opening brace or bracket of JSON, or the map header of
+// MessagePack or CBOR. JSON objects on several lines are read as JSON Lines.
+func sniffFormat(data []byte) string {
+	if schemaregistry.IsFramed(data) {
+		return formatSchemaRegistry
+	}
+	if len(data) == 0 {
+		return formatUnknown
+	}
+	switch b := data[0]; {
+	case b >= 0x80 && b <= 0x8f || b == 0xde || b == 0xdf: // fixmap, map 16, map 32
+		return config.FormatMsgPack
+	case b >= 0xa0 && b <= 0xbb || b == 0xbf: // Maps of major type 5, definite or not
+		return config.FormatCBOR
+	}
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case len(trimmed) == 0:
+		return formatUnknown
+	case trimmed[0] == '{' && bytes.Contains(trimmed, []byte("}\n{")):
+		return config.FormatJSONLines
+	case trimmed[0] == '{' || trimmed[0] == '[' || bytes.Equal(trimmed, []byte("null")):
+		return config.FormatJSON
+	default:
+		return formatUnknown
+	}
+}
@@ -0,0 +1,177 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"sync"
+
+	"go.uber.org/zap"
+
+	"github.com/sanspareilsmyn/featurelens/internal/config"
+	"github.com/sanspareilsmyn/featurelens/internal/expr"
+	"github.com/sanspareilsmyn/featurelens/internal/message"
+)
+
+// graphStage is a stage of the pipeline graph with the channels connecting it.
+type graphStage struct {
+	cfg        config.GraphStageConfig
+	input      chan []message.DynamicMessage
+	outputs    []chan []message.DynamicMessage                               // Inputs of the stages reading this one
+	process    func(batch []message.DynamicMessage) []message.DynamicMessage // Filter and script stages, nil for calculators
+	calculator *Calculator                                                   // Calculator stages, nil for the others
+}
+
+// stageGraph runs the stages configured in pipeline.graph. A batch is shared by every
+// stage reading the same input, so stages never modify the messages they receive:
+// script stages transform copies, and no stage releases messages to the pool.
+type stageGraph struct {
+	stages  []*graphStage
+	sources []chan []message.DynamicMessage // Inputs of the stages reading the parser's output
+}
+
+// newStageGraph creates the configured stages and connects them, nil without stages.
+// Calculator stages send their results to output, like the main calculator.
+func newStageGraph(cfg *config.Config, registry *FeatureRegistry, output chan<- AggregationResult, sampler *AdaptiveSampler, metrics *Metrics, logger *zap.Logger) *stageGraph {
+	if len(cfg.Pipeline.Graph.Stages) == 0 {
+		return nil
+	}
+	g := &stageGraph{}
+	byName := make(map[string]*graphStage, len(cfg.Pipeline.Graph.Stages))
+	for _, stageCfg := range cfg.Pipeline.Graph.Stages {
+		s := &graphStage{cfg: stageCfg, input: make(chan []message.DynamicMessage, batchBufferSize(cfg.Pipeline.Batch))}
+		switch stageCfg.Type {
+		case config.StageFilter:
+			s.process = filterStage(stageCfg, metrics)
+		case config.StageScript:
+			s.process = scriptStage(stageCfg, metrics)
+		case config.StageCalculator:
+			// Latency, throughput and correlations are the main calculator's
+			s.calculator = NewCalculator(cfg.Pipeline, registry, s.input, output, nil, nil, nil, sampler, metrics, logger.Named(stageCfg.Name))
+			s.calculator.restrict(stageCfg.Claims)
+			if cfg.Pipeline.CalculatorWorkers > 1 {
+				s.calculator.shard(cfg.Pipeline.CalculatorWorkers)
+			}
+		}
+		g.stages = append(g.stages, s)
+		byName[stageCfg.Name] = s
+	}
+	for _, s := range g.stages {
+		if s.cfg.Input == config.GraphSource {
+			g.sources = append(g.sources, s.input)
+			continue
+		}
+		input := byName[s.cfg.Input] // Validated at config load
+		input.outputs = append(input.outputs, s.input)
+	}
+	logger.Info("Pipeline graph created",
+		zap.Int("stages", len(g.stages)),
+		zap.Int("calculators", len(g.calculators())),
+	)
+	return g
+}
+
+// filterStage returns the processing of a filter stage: the messages its condition is true
+// for. Like the pipeline filter, a condition that is null or fails on a message is not true.
+func filterStage(cfg config.GraphStageConfig, metrics *Metrics) func([]message.DynamicMessage) []message.DynamicMessage {
+	e, _ := expr.Compile(cfg.Filter) // Validated at config load
+	filtered := metrics.stageFiltered.WithLabelValues(cfg.Name)
+	return func(batch []message.DynamicMessage) []message.DynamicMessage {
+		var kept []message.DynamicMessage
+		for _, msg := range batch {
+			if match, err := e.EvalBool(expr.MapEnv(msg)); err == nil && match {
+				kept = append(kept, msg)
+				continue
+			}
+			filtered.Inc()
+		}
+		return kept
+	}
+}
+
+// scriptStage returns the processing of a script stage: copies of the messages transformed
+// by its steps, like the pipeline script transforms decoded messages.
+func scriptStage(cfg config.GraphStageConfig, metrics *Metrics) func([]message.DynamicMessage) []message.DynamicMessage {
+	script := compileScript(cfg.Script, cfg.Name+"/", metrics)
+	return func(batch []message.DynamicMessage) []message.DynamicMessage {
+		transformed := make([]message.DynamicMessage, len(batch))
+		for i, msg := range batch {
+			transformed[i] = maps.Clone(msg)
+			script(transformed[i])
+		}
+		return transformed
+	}
+}
+
+// claims reports whether a calculator stage computes a feature, which the main calculator
+// then leaves to it.
+func (g *stageGraph) claims(f config.FeatureConfig) bool {
+	for _, s := range g.stages {
+		if s.cfg.Claims(f) {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *stageGraph) calculators() []*graphStage {
+	var calculators []*graphStage
+	for _, s := range g.stages {
+		if s.calculator != nil {
+			calculators = append(calculators, s)
+		}
+	}
+	return calculators
+}
+
+// runGraphStage runs a filter or script stage until its input is closed, then closes the
+// inputs of the stages reading it.
+func (p *Pipeline) runGraphStage(ctx context.Context, wg *sync.WaitGroup, s *graphStage) {
+	defer wg.Done()
+	defer func() {
+		for _, output := range s.outputs {
+			close(output)
+		}
+	}()
+
+	for {
+		select {
+		case batch, ok := <-s.input:
+			if !ok {
+				return
+			}
+			batch = s.process(batch)
+			if len(batch) == 0 {
+				continue
+			}
+			for _, output := range s.outputs {
+				select {
+				case output <- batch:
+				case <-ctx.Done():
+					return
+				}
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// runStageCalculators runs the graph's calculator stages until their inputs are closed.
+// Failures are reported like the main calculator's.
+func (p *Pipeline) runStageCalculators(ctx context.Context, errCh chan<- error) {
+	var wg sync.WaitGroup
+	for _, s := range p.graph.calculators() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := s.calculator.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
+				p.logger.Error("Calculator stage exited with error", zap.String("stage", s.cfg.Name), zap.Error(err))
+				p.reportFailure(ComponentCalculator, err)
+				errCh <- fmt.Errorf("%w: stage %q: %w", ErrCalculatorRunFailed, s.cfg.Name, err)
+			}
+		}()
+	}
+	wg.Wait()
+}
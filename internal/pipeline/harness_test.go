@@ -0,0 +1,470 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest"
+
+	"github.com/sanspareilsmyn/featurelens/internal/config"
+	"github.com/sanspareilsmyn/featurelens/internal/message"
+	"github.com/sanspareilsmyn/featurelens/internal/params"
+	"github.com/sanspareilsmyn/featurelens/internal/schema"
+	"github.com/sanspareilsmyn/featurelens/internal/sink"
+)
+
+// memorySinkType is the sink type harness pipelines deliver their events to.
+const memorySinkType = "memory"
+
+// memorySinks holds the memory sink of each harness, by its "id" parameter.
+var memorySinks sync.Map
+
+func init() {
+	sink.Register(memorySinkType, func(p params.Params, _ *zap.Logger) (sink.Sink, error) {
+		id, err := p.String("id", "")
+		if err != nil {
+			return nil, err
+		}
+		s, _ := memorySinks.LoadOrStore(id, &memorySink{})
+		return s.(*memorySink), nil
+	})
+}
+
+// memorySink collects the events delivered to it.
+type memorySink struct {
+	mu     sync.Mutex
+	events []sink.Event
+}
+
+func (s *memorySink) Send(_ context.Context, events []sink.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, events...)
+	return nil
+}
+
+func (s *memorySink) Close() error { return nil }
+
+// results returns the window results delivered so far, by feature name and window end.
+func (s *memorySink) results() map[string]map[time.Time]schema.AggregationResult {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	results := make(map[string]map[time.Time]schema.AggregationResult)
+	for _, e := range s.events {
+		if r, ok := e.Payload.(schema.AggregationResult); ok {
+			if results[r.FeatureName] == nil {
+				results[r.FeatureName] = make(map[time.Time]schema.AggregationResult)
+			}
+			results[r.FeatureName][r.WindowEnd] = r
+		}
+	}
+	return results
+}
+
+// violations returns the check types of the violations delivered so far, by feature name
+// and window end.
+func (s *memorySink) violations() map[string]map[time.Time][]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	violations := make(map[string]map[time.Time][]string)
+	for _, e := range s.events {
+		if v, ok := e.Payload.(schema.Violation); ok {
+			if violations[v.FeatureName] == nil {
+				violations[v.FeatureName] = make(map[time.Time][]string)
+			}
+			violations[v.FeatureName][v.WindowEnd] = append(violations[v.FeatureName][v.WindowEnd], v.CheckType)
+		}
+	}
+	return violations
+}
+
+// harnessConfig is the base of harness configurations: one-minute windows assigned by
+// the messages' "ts" field, so results only depend on the messages replayed.
+const harnessConfig = `
+kafka:
+  brokers: ["localhost:9092"]
+  topic: "features"
+  groupID: "featurelens-harness"
+pipeline:
+  windowSize: "1m"
+  latency:
+    timestampField: "ts"
+  eventTime:
+    enabled: true
+sinks:
+  flushInterval: "10ms"
+`
+
+// loadHarnessConfig loads harnessConfig followed by extra YAML, e.g. the features, with
+// every event delivered to a memory sink of the test.
+func loadHarnessConfig(t *testing.T, extra string) (*config.Config, *memorySink) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(harnessConfig+extra), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.Load(path)
+	if err != nil {
+		t.Fatalf("loading harness config: %v", err)
+	}
+	memory := &memorySink{}
+	memorySinks.Store(t.Name(), memory)
+	t.Cleanup(func() { memorySinks.Delete(t.Name()) })
+	cfg.Sinks.Outputs = []config.SinkConfig{{Name: memorySinkType, Type: memorySinkType, Params: map[string]interface{}{"id": t.Name()}}}
+	return cfg, memory
+}
+
+// harnessStart is the event time of the first harness message.
+var harnessStart = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// harnessMessages encodes one JSON message per field map, stamping the i-th with event
+// time harnessStart + i*step in its "ts" field.
+func harnessMessages(t *testing.T, step time.Duration, fields ...map[string]interface{}) [][]byte {
+	t.Helper()
+	messages := make([][]byte, len(fields))
+	for i, f := range fields {
+		msg := map[string]interface{}{"ts": harnessStart.Add(time.Duration(i) * step).Format(time.RFC3339Nano)}
+		for k, v := range f {
+			msg[k] = v
+		}
+		data, err := json.Marshal(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		messages[i] = data
+	}
+	return messages
+}
+
+// replay runs the messages through a memory replay pipeline until it drained, telling
+// time by clock, or the system clock when nil.
+func replay(t *testing.T, cfg *config.Config, messages [][]byte, clock Clock) {
+	t.Helper()
+	p, err := NewMemoryReplay(cfg, messages, prometheus.NewRegistry(), zaptest.NewLogger(t, zaptest.Level(zap.WarnLevel)))
+	if err != nil {
+		t.Fatalf("creating pipeline: %v", err)
+	}
+	if clock != nil {
+		p.UseClock(clock)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := p.Run(ctx); err != nil {
+		t.Fatalf("running pipeline: %v", err)
+	}
+}
+
+func TestReplayWindowsAndAlerts(t *testing.T) {
+	cfg, memory := loadHarnessConfig(t, `
+features:
+  - name: "amount"
+    metricType: "numerical"
+    thresholds:
+      meanMax: 10
+  - name: "country"
+    metricType: "categorical"
+    thresholds:
+      missingRateMax: 0.5
+`)
+	// Ten messages per window: amounts jump in the second window, countries go missing in the third
+	var fields []map[string]interface{}
+	for i := range 30 {
+		f := map[string]interface{}{"amount": 5.0, "country": "KR"}
+		if i >= 10 {
+			f["amount"] = 50.0
+		}
+		if i >= 20 {
+			delete(f, "country")
+		}
+		fields = append(fields, f)
+	}
+	replay(t, cfg, harnessMessages(t, 6*time.Second, fields...), nil)
+
+	first, second, third := harnessStart.Add(time.Minute), harnessStart.Add(2*time.Minute), harnessStart.Add(3*time.Minute)
+	results := memory.results()
+	for _, end := range []time.Time{first, second, third} {
+		for _, name := range []string{"amount", "country"} {
+			if r, ok := results[name][end]; !ok || r.Count != 10 {
+				t.Errorf("%s window ending %s: got %+v, want 10 messages", name, end.Format(time.TimeOnly), r)
+			}
+		}
+	}
+	if mean := results["amount"][second].Mean; mean == nil || *mean != 50 {
+		t.Errorf("amount mean of the second window: got %v, want 50", mean)
+	}
+
+	violations := memory.violations()
+	want := map[string]map[time.Time][]string{
+		"amount":  {second: {"mean"}, third: {"mean"}},
+		"country": {third: {"missing_rate"}},
+	}
+	for name, windows := range want {
+		if len(violations[name]) != len(windows) {
+			t.Errorf("%s violations: got %v, want %v", name, violations[name], windows)
+			continue
+		}
+		for end, checks := range windows {
+			if got := violations[name][end]; len(got) != len(checks) || got[0] != checks[0] {
+				t.Errorf("%s violations of the window ending %s: got %v, want %v", name, end.Format(time.TimeOnly), got, checks)
+			}
+		}
+	}
+}
+
+func TestReplayEventTimeWindows(t *testing.T) {
+	cfg, memory := loadHarnessConfig(t, `
+features:
+  - name: "amount"
+    metricType: "numerical"
+`)
+	messages := harnessMessages(t, 30*time.Second,
+		map[string]interface{}{"amount": 1.0},
+		map[string]interface{}{"amount": 2.0},
+		map[string]interface{}{"amount": 3.0},
+	)
+	replay(t, cfg, messages, nil)
+
+	results := memory.results()["amount"]
+	if len(results) != 2 {
+		t.Fatalf("got results of %d windows, want 2: %v", len(results), results)
+	}
+	if r := results[harnessStart.Add(time.Minute)]; r.Count != 2 {
+		t.Errorf("first window: got %d messages, want 2", r.Count)
+	}
+	if r := results[harnessStart.Add(2*time.Minute)]; r.Count != 1 {
+		t.Errorf("second window: got %d messages, want 1", r.Count)
+	}
+}
+
+func TestReplayManualClock(t *testing.T) {
+	cfg, memory := loadHarnessConfig(t, `
+features:
+  - name: "amount"
+    metricType: "numerical"
+    thresholds:
+      meanMax: 10
+`)
+	cfg.Pipeline.EventTime.Enabled = false // Processing-time windows, by the manual clock
+	clock := NewManualClock(harnessStart.Add(10 * time.Second))
+	replay(t, cfg, harnessMessages(t, time.Hour, map[string]interface{}{"amount": 50.0}), clock)
+
+	if r, ok := memory.results()["amount"][harnessStart.Add(time.Minute)]; !ok || r.Count != 1 {
+		t.Errorf("got results %v, want one message in the window ending at 00:01", memory.results())
+	}
+	var detected []time.Time
+	for _, e := range memory.events {
+		if v, ok := e.Payload.(schema.Violation); ok {
+			detected = append(detected, v.DetectedAt)
+		}
+	}
+	if len(detected) != 1 || !detected[0].Equal(clock.Now()) {
+		t.Errorf("got violations detected at %v, want one at %s", detected, clock.Now())
+	}
+}
+
+// runCalculator runs a calculator over cfg's features, telling time by clock, until its
+// input is closed. It returns the input, the output, and next, which waits for the next
+// window result.
+func runCalculator(t *testing.T, cfg *config.Config, clock Clock) (input chan<- []message.DynamicMessage, output <-chan AggregationResult, next func() AggregationResult) {
+	t.Helper()
+	logger := zaptest.NewLogger(t, zaptest.Level(zap.WarnLevel))
+	metrics := unregisteredMetrics()
+	registry := NewFeatureRegistry(cfg.Features, cfg.Pipeline.MaxDiscoveredFeatures, logger)
+	sampler := NewAdaptiveSampler(cfg.Features, cfg.Pipeline.LoadShedding, newSeriesLimiter(0, 0, metrics, logger), logger)
+	messages := make(chan []message.DynamicMessage)
+	results := make(chan AggregationResult, 10)
+	calc := NewCalculator(cfg.Pipeline, registry, messages, results, nil, nil, nil, sampler, metrics, logger)
+	calc.clock = clock
+	done := make(chan error, 1)
+	go func() { done <- calc.Run(context.Background()) }()
+	t.Cleanup(func() {
+		if err := <-done; err != nil {
+			t.Errorf("calculator: %v", err)
+		}
+	})
+
+	return messages, results, func() AggregationResult {
+		t.Helper()
+		select {
+		case r := <-results:
+			return r
+		case <-time.After(5 * time.Second):
+			t.Fatal("no window result")
+			return AggregationResult{}
+		}
+	}
+}
+
+func TestCalculatorManualClock(t *testing.T) {
+	cfg, _ := loadHarnessConfig(t, `
+features:
+  - name: "amount"
+    metricType: "numerical"
+`)
+	cfg.Pipeline.EventTime.Enabled = false
+	clock := NewManualClock(harnessStart.Add(10 * time.Second))
+	input, _, next := runCalculator(t, cfg, clock)
+
+	// The first window is flushed when it ends, while the calculator runs
+	input <- []message.DynamicMessage{{"amount": 1.0}, {"amount": 3.0}}
+	clock.Advance(time.Minute)
+	if r := next(); !r.WindowEnd.Equal(harnessStart.Add(time.Minute)) || r.Count != 2 || r.Mean != 2 {
+		t.Errorf("first window: got end %s, %d messages, mean %v; want 00:01, 2 messages, mean 2", r.WindowEnd.Format(time.TimeOnly), r.Count, r.Mean)
+	}
+
+	// The second is flushed by the drain
+	input <- []message.DynamicMessage{{"amount": 10.0}}
+	close(input)
+	if r := next(); !r.WindowEnd.Equal(harnessStart.Add(2*time.Minute)) || r.Count != 1 {
+		t.Errorf("second window: got end %s, %d messages; want 00:02, 1 message", r.WindowEnd.Format(time.TimeOnly), r.Count)
+	}
+}
+
+func TestCalculatorWindowAlignment(t *testing.T) {
+	cfg, _ := loadHarnessConfig(t, `
+features:
+  - name: "amount"
+    metricType: "numerical"
+`)
+	cfg.Pipeline.EventTime.Enabled = false
+	cfg.Pipeline.WindowAlignment.Offset = 30 * time.Second
+	cfg.Pipeline.WindowAlignment.FlushGrace = 5 * time.Second
+	clock := NewManualClock(harnessStart.Add(40 * time.Second))
+	input, output, next := runCalculator(t, cfg, clock)
+
+	// Windows run from :30 to :30, so the message lands in the one ending at 00:01:30,
+	// which is only flushed 5s later
+	input <- []message.DynamicMessage{{"amount": 1.0}}
+	clock.Set(harnessStart.Add(90 * time.Second))
+	select {
+	case r := <-output:
+		t.Fatalf("window ending %s flushed within the grace period", r.WindowEnd.Format(time.TimeOnly))
+	case <-time.After(50 * time.Millisecond):
+	}
+	clock.Set(harnessStart.Add(95 * time.Second))
+	r := next()
+	if !r.WindowStart.Equal(harnessStart.Add(30*time.Second)) || !r.WindowEnd.Equal(harnessStart.Add(90*time.Second)) || r.Count != 1 {
+		t.Errorf("got window %s-%s with %d messages, want 00:00:30-00:01:30 with 1", r.WindowStart.Format(time.TimeOnly), r.WindowEnd.Format(time.TimeOnly), r.Count)
+	}
+	close(input)
+}
+
+func TestReplayPastWindowConditions(t *testing.T) {
+	cfg, memory := loadHarnessConfig(t, `
+features:
+  - name: "amount"
+    metricType: "numerical"
+    seasonal:
+      periods: ["2m"]
+    conditions:
+      - name: "jump"
+        expr: "abs(mean - prev_mean) > 0.1 * prev_mean"
+      - name: "off_baseline"
+        expr: "abs(mean - baseline_mean) > 0.1 * baseline_mean"
+      - name: "off_season"
+        expr: "abs(mean - seasonal_mean) > 0.1 * seasonal_mean"
+`)
+	// Ten messages per window: amounts rise 20% in the second window and stay there
+	var fields []map[string]interface{}
+	for i := range 30 {
+		amount := 5.0
+		if i >= 10 {
+			amount = 6.0
+		}
+		fields = append(fields, map[string]interface{}{"amount": amount})
+	}
+	replay(t, cfg, harnessMessages(t, 6*time.Second, fields...), nil)
+
+	// The first window has no past windows, so conditions on them evaluate to null and do
+	// not hold. The third has the second as previous window, but the first as its baseline,
+	// the last window without violations, and as the window one season earlier.
+	second, third := harnessStart.Add(2*time.Minute), harnessStart.Add(3*time.Minute)
+	want := map[time.Time][]string{
+		second: {"condition:jump", "condition:off_baseline"},
+		third:  {"condition:off_baseline", "condition:off_season"},
+	}
+	got := memory.violations()["amount"]
+	if len(got) != len(want) {
+		t.Fatalf("got violations %v, want %v", got, want)
+	}
+	for end, checks := range want {
+		if !slices.Equal(got[end], checks) {
+			t.Errorf("violations of the window ending %s: got %v, want %v", end.Format(time.TimeOnly), got[end], checks)
+		}
+	}
+}
+
+// TestReplaySealedPayloads checks that with signing enabled, window results and
+// violations reach sinks sealed: signed over the exact bytes of their payload.
+func TestReplaySealedPayloads(t *testing.T) {
+	cfg, memory := loadHarnessConfig(t, `
+features:
+  - name: "amount"
+    metricType: "numerical"
+    thresholds:
+      meanMax: 10
+`)
+	key := []byte("0123456789abcdef0123456789abcdef")
+	cfg.Signing = config.SigningConfig{
+		Enabled:   true,
+		Algorithm: config.SigningAlgorithmHMACSHA256,
+		KeyFile:   filepath.Join(t.TempDir(), "signing.key"),
+		KeyID:     "harness",
+	}
+	if err := os.WriteFile(cfg.Signing.KeyFile, key, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	var fields []map[string]interface{}
+	for i := range 20 {
+		amount := 5.0
+		if i >= 10 {
+			amount = 50.0
+		}
+		fields = append(fields, map[string]interface{}{"amount": amount})
+	}
+	replay(t, cfg, harnessMessages(t, 6*time.Second, fields...), nil)
+
+	sealed := make(map[string]int)
+	memory.mu.Lock()
+	defer memory.mu.Unlock()
+	for _, e := range memory.events {
+		if e.Kind != schema.KindAggregationResult && e.Kind != schema.KindViolation {
+			continue
+		}
+		if e.Sealed == nil {
+			t.Errorf("%s of the window ending %s not sealed", e.Kind, e.WindowEnd.Format(time.TimeOnly))
+			continue
+		}
+		sealed[e.Kind]++
+		payload, err := json.Marshal(e.Payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(e.Sealed.Payload, payload) {
+			t.Errorf("sealed payload %s, want %s", e.Sealed.Payload, payload)
+		}
+		mac := hmac.New(sha256.New, key)
+		mac.Write(e.Sealed.Payload)
+		if want := base64.StdEncoding.EncodeToString(mac.Sum(nil)); e.Sealed.Signature.Value != want {
+			t.Errorf("%s signature: got %s, want %s", e.Kind, e.Sealed.Signature.Value, want)
+		}
+		if e.Sealed.Signature.Algorithm != config.SigningAlgorithmHMACSHA256 || e.Sealed.Signature.KeyID != "harness" {
+			t.Errorf("got signature %+v, want hmac-sha256 by key harness", e.Sealed.Signature)
+		}
+	}
+	if sealed[schema.KindAggregationResult] != 2 || sealed[schema.KindViolation] != 1 {
+		t.Errorf("got %v sealed, want 2 results and 1 violation", sealed)
+	}
+}
@@ -0,0 +1,220 @@
+//go:build integration
+
+// Integration tests run the pipeline against a real broker. Without
+// FEATURELENS_TEST_BROKERS, each test starts a single-node Kafka container of its own
+// with the docker CLI and removes it when done:
+//
+//	go test -tags integration ./internal/pipeline/
+//
+// With it, they use the given brokers instead, e.g. the docker-compose Kafka:
+//
+//	FEATURELENS_TEST_BROKERS=localhost:9092 go test -tags integration ./internal/pipeline/
+//
+// They create a topic of their own, and are skipped when neither the variable nor docker
+// is available.
+
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/segmentio/kafka-go"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest"
+)
+
+// testKafkaImage is the broker started by startBroker, a KRaft single node without
+// ZooKeeper.
+const testKafkaImage = "apache/kafka:3.7.0"
+
+// testBrokers returns the brokers of FEATURELENS_TEST_BROKERS, or those of a broker
+// started for the test, skipping the test when neither is available.
+func testBrokers(t *testing.T) []string {
+	t.Helper()
+	if brokers := os.Getenv("FEATURELENS_TEST_BROKERS"); brokers != "" {
+		return strings.Split(brokers, ",")
+	}
+	if _, err := exec.LookPath("docker"); err != nil {
+		t.Skip("FEATURELENS_TEST_BROKERS is not set and docker is not available")
+	}
+	return []string{startBroker(t)}
+}
+
+// startBroker runs a Kafka container listening on a free local port until the test
+// ends, and returns its address once it serves metadata.
+func startBroker(t *testing.T) string {
+	t.Helper()
+	// The broker advertises the address clients reach it at, so the host port is chosen
+	// up front rather than left to docker
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("finding a free port: %v", err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	_, port, _ := net.SplitHostPort(addr)
+
+	args := []string{"run", "--detach", "--rm", "--publish", addr + ":9092"}
+	for _, env := range []string{
+		"KAFKA_NODE_ID=1",
+		"KAFKA_PROCESS_ROLES=broker,controller",
+		"KAFKA_LISTENERS=PLAINTEXT://:9092,CONTROLLER://:9093",
+		"KAFKA_ADVERTISED_LISTENERS=PLAINTEXT://127.0.0.1:" + port,
+		"KAFKA_CONTROLLER_LISTENER_NAMES=CONTROLLER",
+		"KAFKA_LISTENER_SECURITY_PROTOCOL_MAP=CONTROLLER:PLAINTEXT,PLAINTEXT:PLAINTEXT",
+		"KAFKA_CONTROLLER_QUORUM_VOTERS=1@localhost:9093",
+		"KAFKA_OFFSETS_TOPIC_REPLICATION_FACTOR=1",
+		"KAFKA_TRANSACTION_STATE_LOG_REPLICATION_FACTOR=1",
+		"KAFKA_TRANSACTION_STATE_LOG_MIN_ISR=1",
+		"KAFKA_GROUP_INITIAL_REBALANCE_DELAY_MS=0",
+	} {
+		args = append(args, "--env", env)
+	}
+	out, err := exec.Command("docker", append(args, testKafkaImage)...).Output()
+	if err != nil {
+		t.Fatalf("starting %s: %v", testKafkaImage, commandError(err))
+	}
+	id := strings.TrimSpace(string(out))
+	t.Cleanup(func() {
+		if err := exec.Command("docker", "rm", "--force", id).Run(); err != nil {
+			t.Logf("removing broker container %s: %v", id, commandError(err))
+		}
+	})
+
+	deadline := time.Now().Add(2 * time.Minute)
+	for {
+		conn, err := kafka.Dial("tcp", addr)
+		if err == nil {
+			_, err = conn.Brokers()
+			conn.Close()
+		}
+		if err == nil {
+			return addr
+		}
+		if time.Now().After(deadline) {
+			logs, _ := exec.Command("docker", "logs", "--tail", "50", id).CombinedOutput()
+			t.Fatalf("broker not ready at %s: %v\n%s", addr, err, logs)
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+
+// commandError adds the output a failed command wrote to stderr to its error.
+func commandError(err error) error {
+	var exit *exec.ExitError
+	if errors.As(err, &exit) && len(exit.Stderr) > 0 {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(exit.Stderr)))
+	}
+	return err
+}
+
+// createTopic creates a single-partition topic through the cluster's controller.
+func createTopic(t *testing.T, brokers []string, topic string) {
+	t.Helper()
+	conn, err := kafka.Dial("tcp", brokers[0])
+	if err != nil {
+		t.Fatalf("dialing %s: %v", brokers[0], err)
+	}
+	defer conn.Close()
+	controller, err := conn.Controller()
+	if err != nil {
+		t.Fatalf("finding the controller: %v", err)
+	}
+	controllerConn, err := kafka.Dial("tcp", net.JoinHostPort(controller.Host, strconv.Itoa(controller.Port)))
+	if err != nil {
+		t.Fatalf("dialing the controller: %v", err)
+	}
+	defer controllerConn.Close()
+	if err := controllerConn.CreateTopics(kafka.TopicConfig{Topic: topic, NumPartitions: 1, ReplicationFactor: 1}); err != nil {
+		t.Fatalf("creating topic %s: %v", topic, err)
+	}
+}
+
+func TestKafkaWindowsAndAlerts(t *testing.T) {
+	brokers := testBrokers(t)
+	topic := fmt.Sprintf("featurelens-it-%d", time.Now().UnixNano())
+	createTopic(t, brokers, topic)
+
+	cfg, memory := loadHarnessConfig(t, `
+features:
+  - name: "amount"
+    metricType: "numerical"
+    thresholds:
+      meanMax: 10
+`)
+	cfg.Kafka.Brokers = brokers
+	cfg.Kafka.Topic = topic
+	cfg.Kafka.GroupID = topic
+	cfg.Kafka.StartOffset = "earliest"
+	// Second-long windows flushed as soon as the watermark passes them, so the windows
+	// before the last message are emitted while the pipeline runs
+	cfg.Pipeline.WindowSize = time.Second
+	cfg.Pipeline.EventTime.AllowedLateness = 0
+
+	// Ten messages per window, amounts jumping in the second, then one closing the second
+	var fields []map[string]interface{}
+	for i := range 21 {
+		amount := 5.0
+		if i >= 10 {
+			amount = 50.0
+		}
+		fields = append(fields, map[string]interface{}{"amount": amount})
+	}
+	writer := &kafka.Writer{Addr: kafka.TCP(brokers...), Topic: topic, BatchTimeout: 10 * time.Millisecond}
+	defer writer.Close()
+	var messages []kafka.Message
+	for _, value := range harnessMessages(t, 100*time.Millisecond, fields...) {
+		messages = append(messages, kafka.Message{Value: value})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if err := writer.WriteMessages(ctx, messages...); err != nil {
+		t.Fatalf("producing: %v", err)
+	}
+
+	p, err := New(cfg, prometheus.NewRegistry(), zaptest.NewLogger(t, zaptest.Level(zap.WarnLevel)))
+	if err != nil {
+		t.Fatalf("creating pipeline: %v", err)
+	}
+	runCtx, stop := context.WithCancel(ctx)
+	done := make(chan error, 1)
+	go func() { done <- p.Run(runCtx) }()
+
+	first, second := harnessStart.Add(time.Second), harnessStart.Add(2*time.Second)
+	for {
+		if _, ok := memory.results()["amount"][second]; ok {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			stop()
+			t.Fatalf("no result of the second window before the deadline, got %v", memory.results())
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+	stop()
+	if err := <-done; err != nil {
+		t.Fatalf("running pipeline: %v", err)
+	}
+
+	results := memory.results()["amount"]
+	for _, end := range []time.Time{first, second} {
+		if r := results[end]; r.Count != 10 {
+			t.Errorf("window ending %s: got %d messages, want 10", end.Format(time.TimeOnly), r.Count)
+		}
+	}
+	violations := memory.violations()["amount"]
+	if len(violations[first]) != 0 || len(violations[second]) != 1 || violations[second][0] != "mean" {
+		t.Errorf("got violations %v, want one mean violation of the second window", violations)
+	}
+}
@@ -0,0 +1,140 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"go.uber.org/zap"
+
+	"github.com/sanspareilsmyn/featurelens/internal/config"
+)
+
+// PartitionLag is how far the consumer is behind on one partition.
+type PartitionLag struct {
+	Partition     int
+	Position      int64 // Next offset the consumer will fetch
+	HighWatermark int64 // Offset of the next message produced to the partition
+	Lag           int64
+}
+
+// LagResult holds the lag of every partition the consumer fetched from, observed at one poll.
+type LagResult struct {
+	Topic      string
+	Partitions []PartitionLag
+	Since      time.Time // Previous poll
+	ObservedAt time.Time
+}
+
+// LagMonitor periodically compares the consumer's positions with partition high
+// watermarks. Polling the brokers, rather than relying on fetched messages, keeps lag
+// growing while the consumer is stalled.
+type LagMonitor struct {
+	cfg      config.KafkaConfig
+	consumer *Consumer
+	client   *kafka.Client
+	output   chan<- LagResult
+	logger   *zap.Logger
+}
+
+// NewLagMonitor creates a LagMonitor for the consumer's topics.
+func NewLagMonitor(cfg config.KafkaConfig, consumer *Consumer, output chan<- LagResult, logger *zap.Logger) *LagMonitor {
+	logger.Info("Lag monitor initialized",
+		zap.String("topic", cfg.Subscription()),
+		zap.Duration("interval", cfg.Lag.Interval),
+		zap.Int64("threshold", cfg.Lag.Threshold),
+	)
+	return &LagMonitor{
+		cfg:      cfg,
+		consumer: consumer,
+		client:   &kafka.Client{Addr: kafka.TCP(cfg.Brokers...), Timeout: cfg.Lag.Interval},
+		output:   output,
+		logger:   logger,
+	}
+}
+
+// Run polls partition lag until ctx is cancelled, sending one result per topic.
+func (m *LagMonitor) Run(ctx context.Context) error {
+	sugar := m.logger.Sugar()
+	sugar.Info("Starting lag monitor loop...")
+	defer sugar.Info("Lag monitor loop stopped.")
+
+	ticker := time.NewTicker(m.cfg.Lag.Interval)
+	defer ticker.Stop()
+
+	since := time.Now()
+	for {
+		select {
+		case now := <-ticker.C:
+			topics, err := m.poll(ctx)
+			if err != nil {
+				sugar.Warnw("Failed to poll partition high watermarks", zap.Error(err))
+				continue
+			}
+			if len(topics) == 0 {
+				continue // Nothing fetched yet
+			}
+			names := make([]string, 0, len(topics))
+			for topic := range topics {
+				names = append(names, topic)
+			}
+			sort.Strings(names)
+			for _, topic := range names {
+				result := LagResult{Topic: topic, Partitions: topics[topic], Since: since, ObservedAt: now}
+				select {
+				case m.output <- result:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+			since = now
+
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// poll fetches the high watermark of every partition the consumer has fetched from,
+// returning their lag by topic.
+func (m *LagMonitor) poll(ctx context.Context) (map[string][]PartitionLag, error) {
+	positions := m.consumer.Positions()
+	if len(positions) == 0 {
+		return nil, nil
+	}
+
+	requests := make(map[string][]kafka.OffsetRequest, len(positions))
+	for topic, partitions := range positions {
+		for partition := range partitions {
+			requests[topic] = append(requests[topic], kafka.LastOffsetOf(partition))
+		}
+	}
+	resp, err := m.client.ListOffsets(ctx, &kafka.ListOffsetsRequest{Topics: requests, IsolationLevel: isolationLevel(m.cfg)})
+	if err != nil {
+		return nil, err
+	}
+
+	topics := make(map[string][]PartitionLag, len(resp.Topics))
+	for topic, offsets := range resp.Topics {
+		partitions := make([]PartitionLag, 0, len(offsets))
+		for _, o := range offsets {
+			if o.Error != nil {
+				return nil, fmt.Errorf("topic %q partition %d: %w", topic, o.Partition, o.Error)
+			}
+			position := positions[topic][o.Partition]
+			partitions = append(partitions, PartitionLag{
+				Partition:     o.Partition,
+				Position:      position,
+				HighWatermark: o.LastOffset,
+				Lag:           max(o.LastOffset-position, 0),
+			})
+		}
+		sort.Slice(partitions, func(i, j int) bool {
+			return partitions[i].Partition < partitions[j].Partition
+		})
+		topics[topic] = partitions
+	}
+	return topics, nil
+}
@@ -0,0 +1,115 @@
+package pipeline
+
+import (
+	"math"
+	"time"
+
+	"github.com/sanspareilsmyn/featurelens/internal/config"
+	"github.com/sanspareilsmyn/featurelens/internal/message"
+	"github.com/sanspareilsmyn/featurelens/internal/sketch"
+)
+
+// latencyAccuracy is the relative accuracy of the latency quantile sketch.
+const latencyAccuracy = 0.01
+
+// LatencyResult holds the end-to-end latency of the messages processed in a window:
+// the delay, in seconds, between each message's event timestamp and its processing.
+type LatencyResult struct {
+	TimestampField string
+	WindowStart    time.Time
+	WindowEnd      time.Time
+	Count          int64 // Messages with a parsable event timestamp
+	Mean           float64
+	P95            float64
+	Max            float64
+	Future         int64 // Timestamps ahead of the processing time by more than the future tolerance
+	OutOfOrder     int64 // Timestamps behind the latest one seen by more than the out-of-order tolerance
+}
+
+// latencyStats accumulates a window's end-to-end latencies.
+type latencyStats struct {
+	count      int64
+	sum        float64
+	max        float64
+	quantile   *sketch.Quantile
+	future     int64
+	outOfOrder int64
+}
+
+func newLatencyStats() *latencyStats {
+	q, _ := sketch.NewQuantile(latencyAccuracy) // Constant accuracy, always valid
+	return &latencyStats{quantile: q}
+}
+
+// add records one latency. Event times in the future (producer clock skew) count as zero.
+func (l *latencyStats) add(seconds float64) {
+	seconds = max(seconds, 0)
+	l.count++
+	l.sum += seconds
+	l.max = max(l.max, seconds)
+	l.quantile.Add(seconds)
+}
+
+// result summarizes the window's latencies.
+func (l *latencyStats) result(field string, start, end time.Time) LatencyResult {
+	return LatencyResult{
+		TimestampField: field,
+		WindowStart:    start,
+		WindowEnd:      end,
+		Count:          l.count,
+		Mean:           l.sum / float64(l.count),
+		P95:            l.quantile.Quantile(0.95),
+		Max:            l.max,
+		Future:         l.future,
+		OutOfOrder:     l.outOfOrder,
+	}
+}
+
+// rate returns n as a fraction of the window's timestamped messages.
+func (r LatencyResult) rate(n int64) float64 {
+	if r.Count == 0 {
+		return math.NaN()
+	}
+	return float64(n) / float64(r.Count)
+}
+
+// eventTime reads a message's event timestamp: an RFC 3339 string, or a number of
+// units since the Unix epoch.
+func eventTime(msg message.DynamicMessage, cfg config.LatencyConfig) (time.Time, bool) {
+	if t, ok := msg.GetTime(cfg.TimestampField); ok {
+		return *t, true
+	}
+	v, ok := msg.GetFloat64(cfg.TimestampField)
+	if !ok || math.IsNaN(*v) || math.IsInf(*v, 0) {
+		return time.Time{}, false
+	}
+	var unit time.Duration
+	switch cfg.TimestampUnit {
+	case config.TimestampUnitAuto:
+		unit = epochUnit(*v)
+	case config.TimestampUnitSeconds:
+		unit = time.Second
+	case config.TimestampUnitMicroseconds:
+		unit = time.Microsecond
+	case config.TimestampUnitNanoseconds:
+		unit = time.Nanosecond
+	default:
+		unit = time.Millisecond
+	}
+	return time.Unix(0, 0).Add(time.Duration(*v * float64(unit))), true
+}
+
+// epochUnit tells the unit of a timestamp since the Unix epoch by its magnitude, for
+// timestampUnit auto. Timestamps of every unit are told apart from 1973 to 5138.
+func epochUnit(v float64) time.Duration {
+	switch v = math.Abs(v); {
+	case v < 1e11:
+		return time.Second
+	case v < 1e14:
+		return time.Millisecond
+	case v < 1e17:
+		return time.Microsecond
+	default:
+		return time.Nanosecond
+	}
+}
@@ -0,0 +1,98 @@
+package pipeline
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/sanspareilsmyn/featurelens/internal/config"
+	"github.com/sanspareilsmyn/featurelens/internal/logging"
+)
+
+// advanceWatermark returns the cutoff of the windows to flush at a tick: the tick time,
+// or in event time the watermark, which trails the latest event timestamp by the allowed
+// lateness. When no message arrived since the previous tick the watermark follows the
+// tick time instead, so the last windows of an idle stream are flushed.
+func (c *Calculator) advanceWatermark(tickTime time.Time) time.Time {
+	if !c.config.EventTime.Enabled {
+		return tickTime
+	}
+	watermark := c.latestEvent.Add(-c.config.EventTime.AllowedLateness)
+	if c.sinceTick == 0 {
+		watermark = tickTime.Add(-c.config.EventTime.AllowedLateness)
+	}
+	c.sinceTick = 0
+	if watermark.After(c.watermark) {
+		c.watermark = watermark
+	}
+	return c.watermark
+}
+
+// openWindowEnd returns the end of the earliest window the watermark has not flushed.
+func (c *Calculator) openWindowEnd() time.Time {
+	return windowEnd(c.config, c.watermark)
+}
+
+// eventWindow returns the window of a message by its event timestamp. Future-dated
+// messages fall in their processing-time window, as they would otherwise hold windows
+// open far ahead. Messages of windows the watermark already flushed are handled by the
+// late policy; ok is false if the message is dropped.
+func (c *Calculator) eventWindow(eventAt, now time.Time) (window windowKey, ok bool) {
+	if eventAt.Sub(now) > c.config.Latency.FutureTolerance {
+		return windowKey{end: windowEnd(c.config, now)}, true
+	}
+	end := windowEnd(c.config, eventAt)
+	if end.After(c.watermark) {
+		return windowKey{end: end}, true
+	}
+
+	switch c.config.EventTime.LatePolicy {
+	case config.LatePolicyAccumulate:
+		c.metrics.lateMessages.WithLabelValues("accumulated").Inc()
+		return windowKey{end: c.openWindowEnd(), late: true}, true
+	case config.LatePolicyReemit:
+		if c.reopen(end) {
+			c.metrics.lateMessages.WithLabelValues("reemitted").Inc()
+			return windowKey{end: end}, true
+		}
+		c.metrics.lateMessages.WithLabelValues("expired").Inc()
+	default:
+		c.metrics.lateMessages.WithLabelValues("dropped").Inc()
+	}
+	return windowKey{}, false
+}
+
+// reopen makes a retained window open again, to be re-emitted as its next revision at the
+// next tick. It returns false if the window is no longer retained.
+func (c *Calculator) reopen(windowEnd time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, open := c.windowStates[windowEnd]; open {
+		return true // Reopened by an earlier late message
+	}
+	windowState, ok := c.retained[windowEnd]
+	if !ok {
+		return false
+	}
+	delete(c.retained, windowEnd)
+	windowState.revision++
+	c.windowStates[windowEnd] = windowState
+	c.logger.Debug("Reopened window for late messages",
+		logging.WindowEnd(windowEnd), zap.Int("revision", windowState.revision))
+	return true
+}
+
+// retain keeps flushed windows to be reopened by late messages, and forgets those which
+// ended more than the retention before the watermark.
+func (c *Calculator) retain(watermark time.Time, flushed map[time.Time]*windowInfo) {
+	for windowEnd, windowState := range flushed {
+		c.retained[windowEnd] = windowState
+	}
+	oldest := watermark.Add(-c.config.EventTime.Retention)
+	for windowEnd := range c.retained {
+		if windowEnd.Before(oldest) {
+			delete(c.retained, windowEnd)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package pipeline
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/sanspareilsmyn/featurelens/internal/sink"
+)
+
+// ledgerCompactThreshold is the number of expired entries after which the ledger file
+// is rewritten without them.
+const ledgerCompactThreshold = 10000
+
+// ledgerEntry records that an event was delivered to a sink.
+type ledgerEntry struct {
+	Sink        string    `json:"sink"`
+	ID          string    `json:"id"`
+	WindowEnd   time.Time `json:"windowEnd"`
+	DeliveredAt time.Time `json:"deliveredAt,omitempty"` // Unset in ledgers written before it was recorded
+}
+
+// retainedFrom returns when the entry's retention starts: the later of its window end and
+// delivery, so that the events of windows replayed long after they ended are remembered
+// for the retention too.
+func (e ledgerEntry) retainedFrom() time.Time {
+	if e.DeliveredAt.After(e.WindowEnd) {
+		return e.DeliveredAt
+	}
+	return e.WindowEnd
+}
+
+// deliveryLedger remembers which events each sink received, by idempotency key, for
+// a retention measured from the events' window ends or delivery if later, optionally
+// persisting them to a JSON lines file so that events emitted again after a restart are
+// not redelivered. It is safe for concurrent use by the sinks' workers.
+type deliveryLedger struct {
+	mu        sync.Mutex
+	retention time.Duration
+	delivered map[string]map[string]ledgerEntry // Sink -> event ID -> entry
+	live      int
+	expired   int // Entries dropped since the file was last compacted
+	path      string
+	file      *os.File // nil for in-memory ledgers
+}
+
+// openDeliveryLedger loads the entries of path still within retention and keeps
+// appending to it. An empty path creates an in-memory ledger.
+func openDeliveryLedger(path string, retention time.Duration) (*deliveryLedger, error) {
+	l := &deliveryLedger{
+		retention: retention,
+		delivered: make(map[string]map[string]ledgerEntry),
+		path:      path,
+	}
+	if path == "" {
+		return l, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrLedgerOpenFailed, err)
+	}
+	if err := l.load(); err != nil {
+		return nil, err
+	}
+	if err := l.compact(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// load reads the existing file, skipping expired and malformed entries.
+func (l *deliveryLedger) load() error {
+	f, err := os.Open(l.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrLedgerOpenFailed, err)
+	}
+	defer f.Close()
+
+	cutoff := time.Now().Add(-l.retention)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e ledgerEntry
+		if json.Unmarshal(scanner.Bytes(), &e) != nil || e.retainedFrom().Before(cutoff) {
+			continue
+		}
+		l.add(e)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("%w: %w", ErrLedgerOpenFailed, err)
+	}
+	return nil
+}
+
+// compact rewrites the file with the live entries only and reopens it for appending.
+func (l *deliveryLedger) compact() error {
+	if l.file != nil {
+		_ = l.file.Close()
+	}
+	tmp := l.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrLedgerWriteFailed, err)
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, ids := range l.delivered {
+		for _, e := range ids {
+			if err := enc.Encode(e); err != nil {
+				_ = f.Close()
+				return fmt.Errorf("%w: %w", ErrLedgerWriteFailed, err)
+			}
+		}
+	}
+	if err := w.Flush(); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("%w: %w", ErrLedgerWriteFailed, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("%w: %w", ErrLedgerWriteFailed, err)
+	}
+	if err := os.Rename(tmp, l.path); err != nil {
+		return fmt.Errorf("%w: %w", ErrLedgerWriteFailed, err)
+	}
+	l.file, err = os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrLedgerOpenFailed, err)
+	}
+	l.expired = 0
+	return nil
+}
+
+func (l *deliveryLedger) add(e ledgerEntry) {
+	ids, ok := l.delivered[e.Sink]
+	if !ok {
+		ids = make(map[string]ledgerEntry)
+		l.delivered[e.Sink] = ids
+	}
+	if _, ok := ids[e.ID]; !ok {
+		l.live++
+	}
+	ids[e.ID] = e
+}
+
+// undelivered returns the events the sink has not received yet, once each.
+func (l *deliveryLedger) undelivered(sinkName string, events []sink.Event) []sink.Event {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	ids := l.delivered[sinkName]
+	pending := make([]sink.Event, 0, len(events))
+	seen := make(map[string]bool, len(events))
+	for _, e := range events {
+		if _, ok := ids[e.ID]; ok || seen[e.ID] {
+			continue
+		}
+		seen[e.ID] = true
+		pending = append(pending, e)
+	}
+	return pending
+}
+
+// record remembers that the sink received the events. The entries are kept in memory
+// even if persisting them fails.
+func (l *deliveryLedger) record(sinkName string, events []sink.Event) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var w *bufio.Writer
+	if l.file != nil {
+		w = bufio.NewWriter(l.file)
+	}
+	var writeErr error
+	now := time.Now()
+	for _, e := range events {
+		entry := ledgerEntry{Sink: sinkName, ID: e.ID, WindowEnd: e.WindowEnd, DeliveredAt: now}
+		l.add(entry)
+		if w != nil && writeErr == nil {
+			writeErr = json.NewEncoder(w).Encode(entry)
+		}
+	}
+	if w != nil && writeErr == nil {
+		writeErr = w.Flush()
+	}
+	if writeErr != nil {
+		return fmt.Errorf("%w: %w", ErrLedgerWriteFailed, writeErr)
+	}
+	return nil
+}
+
+// expire forgets entries past retention, compacting the file once enough accumulated.
+func (l *deliveryLedger) expire(now time.Time) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	cutoff := now.Add(-l.retention)
+	for sinkName, ids := range l.delivered {
+		for id, e := range ids {
+			if e.retainedFrom().Before(cutoff) {
+				delete(ids, id)
+				l.live--
+				l.expired++
+			}
+		}
+		if len(ids) == 0 {
+			delete(l.delivered, sinkName)
+		}
+	}
+	if l.file != nil && l.expired >= ledgerCompactThreshold && l.expired > l.live {
+		return l.compact()
+	}
+	return nil
+}
+
+func (l *deliveryLedger) close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	return l.file.Close()
+}
@@ -0,0 +1,255 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/sanspareilsmyn/featurelens/internal/sketch"
+)
+
+// merge adds the aggregates of another instance's window to w, so the merged window
+// holds the statistics of both instances' messages. other is left unchanged and shares no
+// state with w. Stats whose sketches cannot be combined keep w's sketches; the error
+// reports them.
+func (w *windowInfo) merge(other *windowInfo) error {
+	var errs []error
+	for name, stats := range other.features {
+		own, ok := w.features[name]
+		if !ok {
+			own = &FeatureStats{}
+			w.features[name] = own
+		}
+		if err := own.Merge(stats); err != nil {
+			errs = append(errs, fmt.Errorf("feature %q: %w", name, err))
+		}
+	}
+	for name, groups := range other.groups {
+		if w.groups == nil {
+			w.groups = make(map[string]map[string]*FeatureStats)
+		}
+		own := w.groups[name]
+		if own == nil {
+			own = make(map[string]*FeatureStats, len(groups))
+			w.groups[name] = own
+		}
+		for group, stats := range groups {
+			s, ok := own[group]
+			if !ok {
+				s = &FeatureStats{}
+				own[group] = s
+			}
+			if err := s.Merge(stats); err != nil {
+				errs = append(errs, fmt.Errorf("feature %q, group %q: %w", name, group, err))
+			}
+		}
+	}
+	for version := range other.versions {
+		w.versions[version] = struct{}{}
+	}
+	w.messages += other.messages
+	for field, counts := range other.fields {
+		if w.fields == nil {
+			w.fields = make(map[string]*fieldTypeCounts)
+		}
+		own, ok := w.fields[field]
+		if !ok {
+			own = &fieldTypeCounts{}
+			w.fields[field] = own
+		}
+		for t, n := range counts {
+			own[t] += n
+		}
+	}
+	for name, byPartition := range other.partitions {
+		if w.partitions == nil {
+			w.partitions = make(map[string]map[string]*partitionCounts)
+		}
+		own := w.partitions[name]
+		if own == nil {
+			own = make(map[string]*partitionCounts)
+			w.partitions[name] = own
+		}
+		for partition, counts := range byPartition {
+			if own[partition] == nil {
+				own[partition] = &partitionCounts{}
+			}
+			own[partition].merge(counts)
+		}
+	}
+
+	if other.latency != nil {
+		if w.latency == nil {
+			w.latency = newLatencyStats()
+		}
+		w.latency.merge(other.latency)
+	}
+	for i, m := range other.correlations {
+		if m == nil {
+			continue
+		}
+		if i >= len(w.correlations) {
+			w.correlations = append(w.correlations, make([]*coMoments, i+1-len(w.correlations))...)
+		}
+		if w.correlations[i] == nil {
+			w.correlations[i] = &coMoments{}
+		}
+		w.correlations[i].merge(m)
+	}
+	return errors.Join(errs...)
+}
+
+// Merge adds the aggregates of other to s, so s holds the statistics of the values
+// aggregated into either. Counts add up, moments combine exactly (Chan et al.'s parallel
+// algorithm) and sketches merge, so stats kept apart (by calculator shards, scaled
+// instances, or before and after a restore) can be combined in any order. other is left
+// unchanged and shares no state with s. If the sketches of s and other were created with
+// different parameters, s keeps its own sketches and the error wraps ErrStatsMergeFailed;
+// every other aggregate is merged regardless.
+func (s *FeatureStats) Merge(other *FeatureStats) error {
+	if other.valueCount > 0 {
+		if s.valueCount == 0 {
+			s.min, s.max = other.min, other.max
+			s.mean, s.m2 = other.mean, other.m2
+		} else {
+			s.min, s.max = min(s.min, other.min), max(s.max, other.max)
+			n, na, nb := float64(s.valueCount+other.valueCount), float64(s.valueCount), float64(other.valueCount)
+			d := other.mean - s.mean
+			s.mean += d * nb / n
+			s.m2 += other.m2 + d*d*na*nb/n
+		}
+	}
+	s.count += other.count
+	s.nullCount += other.nullCount
+	s.missingCount += other.missingCount
+	s.typeMismatchCount += other.typeMismatchCount
+	s.valueCount += other.valueCount
+	s.zeroCount += other.zeroCount
+	s.trueCount += other.trueCount
+	s.falseCount += other.falseCount
+	s.sampledOut += other.sampledOut
+	for value, n := range other.categories {
+		if s.categories == nil {
+			s.categories = make(map[string]int64, len(other.categories))
+		}
+		s.categories[value] += n
+	}
+
+	s.stringCount += other.stringCount
+	s.lengthSum += other.lengthSum
+	s.lengthMax = max(s.lengthMax, other.lengthMax)
+	s.patternMatches += other.patternMatches
+
+	if other.samples != nil {
+		if s.samples == nil {
+			s.samples = &valueSamples{}
+		}
+		s.samples.merge(other.samples)
+	}
+
+	if other.exemplars != nil {
+		if s.exemplars == nil {
+			s.exemplars = &exemplarSet{}
+		}
+		s.exemplars.merge(other.exemplars)
+	}
+
+	if other.vector != nil {
+		if s.vector == nil {
+			s.vector = &vectorStats{dimensions: other.vector.dimensions}
+		}
+		s.vector.merge(other.vector)
+	}
+
+	var errs []error
+	s.percentiles, errs = mergeQuantiles(s.percentiles, other.percentiles, errs)
+	s.quantile, errs = mergeQuantiles(s.quantile, other.quantile, errs)
+	if other.cardinality != nil {
+		if s.cardinality == nil {
+			s.cardinality = other.cardinality.Clone()
+		} else if err := s.cardinality.Merge(other.cardinality); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if other.frequency != nil {
+		if s.frequency == nil {
+			s.frequency = other.frequency.Clone()
+		} else if err := s.frequency.Merge(other.frequency); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("%w: %w", ErrStatsMergeFailed, err)
+	}
+	return nil
+}
+
+// mergeQuantiles returns the merge of two sketches, either of which may be nil, without
+// modifying or retaining other. A merge error is appended to errs.
+func mergeQuantiles(q, other *sketch.Quantile, errs []error) (*sketch.Quantile, []error) {
+	switch {
+	case other == nil:
+	case q == nil:
+		q = other.Clone()
+	default:
+		if err := q.Merge(other); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return q, errs
+}
+
+// merge adds the aggregates of other to v. Instances learn the expected dimensions
+// independently; if they disagree, the other instance's well-formed vectors count as
+// dimension mismatches.
+func (v *vectorStats) merge(other *vectorStats) {
+	v.values += other.values
+	v.dimensionMismatches += other.dimensionMismatches
+	v.elements += other.elements
+	v.nonFinite += other.nonFinite
+	if other.dimensions != v.dimensions {
+		v.dimensionMismatches += other.wellFormed
+		return
+	}
+	v.wellFormed += other.wellFormed
+	v.normSum += other.normSum
+	v.normSumSq += other.normSumSq
+	v.unitCount += other.unitCount
+	if v.sum == nil {
+		v.sum, v.unitSum = slices.Clone(other.sum), slices.Clone(other.unitSum)
+		return
+	}
+	for i := range other.sum {
+		v.sum[i] += other.sum[i]
+		v.unitSum[i] += other.unitSum[i]
+	}
+}
+
+// merge adds the aggregates of other to l.
+func (l *latencyStats) merge(other *latencyStats) {
+	l.count += other.count
+	l.sum += other.sum
+	l.max = max(l.max, other.max)
+	l.future += other.future
+	l.outOfOrder += other.outOfOrder
+	_ = l.quantile.Merge(other.quantile) // Constant accuracy
+}
+
+// merge combines the moments of two sets of pairs (Chan et al.'s parallel algorithm).
+func (m *coMoments) merge(other *coMoments) {
+	if other.count == 0 {
+		return
+	}
+	if m.count == 0 {
+		*m = *other
+		return
+	}
+	n, na, nb := float64(m.count+other.count), float64(m.count), float64(other.count)
+	dx, dy := other.meanX-m.meanX, other.meanY-m.meanY
+	m.meanX += dx * nb / n
+	m.meanY += dy * nb / n
+	m.m2X += other.m2X + dx*dx*na*nb/n
+	m.m2Y += other.m2Y + dy*dy*na*nb/n
+	m.cXY += other.cXY + dx*dy*na*nb/n
+	m.count += other.count
+}
@@ -0,0 +1,54 @@
+package pipeline
+
+import (
+	"github.com/segmentio/kafka-go"
+
+	"github.com/sanspareilsmyn/featurelens/internal/config"
+	"github.com/sanspareilsmyn/featurelens/internal/message"
+)
+
+// withMetadata wraps parse so the configured fields are set from each raw message's key
+// and headers on the messages decoded from its payload, replacing payload fields of the
+// same name. Fields whose key or header is absent are left as decoded.
+func withMetadata(parse parseFunc, cfg config.MetadataConfig) parseFunc {
+	if cfg.Key.Field == "" && len(cfg.Headers) == 0 {
+		return parse
+	}
+
+	return func(raw rawMessage) ([]message.DynamicMessage, error) {
+		msgs, err := parse(raw)
+		if len(msgs) == 0 {
+			return msgs, err
+		}
+		if cfg.Key.Field != "" && raw.key != nil {
+			setMetadata(msgs, cfg.Key, raw.key)
+		}
+		for _, h := range cfg.Headers {
+			if value, ok := header(raw.headers, h.Header); ok {
+				setMetadata(msgs, h, value)
+			}
+		}
+		return msgs, err
+	}
+}
+
+// setMetadata sets the field f sources to value on every message.
+func setMetadata(msgs []message.DynamicMessage, f config.MetadataFieldConfig, value []byte) {
+	var v interface{} = string(value)
+	if f.Type == config.MetadataAuto {
+		v = message.CSVValue(string(value))
+	}
+	for _, msg := range msgs {
+		msg[f.Field] = v
+	}
+}
+
+// header returns the value of the first header named name.
+func header(headers []kafka.Header, name string) ([]byte, bool) {
+	for _, h := range headers {
+		if h.Key == name {
+			return h.Value, true
+		}
+	}
+	return nil, false
+}
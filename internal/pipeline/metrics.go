@@ -0,0 +1,843 @@
+package pipeline
+
+import (
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Metrics holds the Prometheus metrics of a pipeline. Every component of the pipeline
+// exports to the same Metrics, so that embedders and tests can run several pipelines or
+// alerters side by side, each registered on its own registry, or on none.
+type Metrics struct {
+	// Window statistics, checks and violations, exported by the alerter
+	featureCount                 *prometheus.GaugeVec
+	featureNullCount             *prometheus.GaugeVec
+	featureNullRate              *prometheus.GaugeVec
+	featureMissingCount          *prometheus.GaugeVec
+	featureMissingRate           *prometheus.GaugeVec
+	featureTypeMismatchRate      *prometheus.GaugeVec
+	featureMean                  *prometheus.GaugeVec
+	featureStdDev                *prometheus.GaugeVec
+	featureDistinctValues        *prometheus.GaugeVec
+	featureDistinctEstimate      *prometheus.GaugeVec
+	featureZeroRate              *prometheus.GaugeVec
+	featureOutlierRate           *prometheus.GaugeVec
+	featureTrueRate              *prometheus.GaugeVec
+	featureConstantWindows       *prometheus.GaugeVec
+	featureNoDataWindows         *prometheus.GaugeVec
+	featureInfo                  *prometheus.GaugeVec
+	featureLastUpdate            *prometheus.GaugeVec
+	noDataWindows                prometheus.Gauge
+	featureAvgLength             *prometheus.GaugeVec
+	featureMaxLength             *prometheus.GaugeVec
+	featurePatternMatchRate      *prometheus.GaugeVec
+	featurePercentile            *prometheus.GaugeVec
+	featureNormMean              *prometheus.GaugeVec
+	featureDimensionMismatchRate *prometheus.GaugeVec
+	featureNonFiniteRate         *prometheus.GaugeVec
+	featureCentroidDistance      *prometheus.GaugeVec
+	featureCustomMetric          *prometheus.GaugeVec
+	featureSkewPSI               *prometheus.GaugeVec
+	featureSkewJSDivergence      *prometheus.GaugeVec
+	featureSkewChiSquarePValue   *prometheus.GaugeVec
+	featureSkewMeanDelta         *prometheus.GaugeVec
+	consumerPartitionLag         *prometheus.GaugeVec
+	correlationCoefficient       *prometheus.GaugeVec
+	compositeMetricValue         *prometheus.GaugeVec
+	eventTimestampRate           *prometheus.GaugeVec
+	windowMessages               prometheus.Gauge
+	windowExpectedMessages       prometheus.Gauge
+	windowCompleteness           prometheus.Gauge
+	schemaFields                 prometheus.Gauge
+	schemaInfo                   *prometheus.GaugeVec
+	schemaChanges                *prometheus.CounterVec
+	partitionNullRate            *prometheus.GaugeVec
+	partitionMean                *prometheus.GaugeVec
+	eventLatency                 *prometheus.GaugeVec
+	featureChecksSuppressed      *prometheus.CounterVec
+	auditWriteFailures           prometheus.Counter
+	featureThresholdViolations   *prometheus.CounterVec
+	featureCanaryViolations      *prometheus.CounterVec
+	featureStaleViolations       *prometheus.CounterVec
+	featureArchived              *prometheus.GaugeVec
+	alertsRouted                 *prometheus.CounterVec
+	alertTransitions             *prometheus.CounterVec
+	alertDuration                *prometheus.HistogramVec
+	seriesSuppressed             *prometheus.CounterVec
+
+	// Per-group segment statistics
+	groupCount       *prometheus.GaugeVec
+	groupNullRate    *prometheus.GaugeVec
+	groupMissingRate *prometheus.GaugeVec
+	groupMean        *prometheus.GaugeVec
+	groupStdDev      *prometheus.GaugeVec
+
+	// Rollups of feature windows into coarser resolutions
+	rollupCount       *prometheus.GaugeVec
+	rollupNullRate    *prometheus.GaugeVec
+	rollupMissingRate *prometheus.GaugeVec
+	rollupMean        *prometheus.GaugeVec
+	rollupStdDev      *prometheus.GaugeVec
+
+	// Sampling and load shedding
+	featureSampleRate    *prometheus.GaugeVec
+	loadSheddingActive   prometheus.Gauge
+	loadShedObservations *prometheus.CounterVec
+
+	// Resource usage of the monitor itself
+	heapBytes    prometheus.Gauge
+	goroutines   prometheus.Gauge
+	channelDepth *prometheus.GaugeVec
+	stageLatency *prometheus.HistogramVec
+
+	// Calculator state: sessions, late messages, window state and flushes
+	sessionsOpen      prometheus.Gauge
+	sessionsClosed    *prometheus.CounterVec
+	lateMessages      *prometheus.CounterVec
+	windowStateBytes  *prometheus.GaugeVec
+	windowStateSpills *prometheus.CounterVec
+	flushes           *prometheus.CounterVec
+
+	// Parsing
+	messagesFiltered   prometheus.Counter
+	valuesCoerced      *prometheus.CounterVec
+	derivedFieldErrors *prometheus.CounterVec
+	scriptErrors       *prometheus.CounterVec
+	stageFiltered      *prometheus.CounterVec
+	payloadFormats     *prometheus.CounterVec
+
+	// Horizontal scaling
+	partialsPublished *prometheus.CounterVec
+	windowsMerged     *prometheus.CounterVec
+	partialsRejected  *prometheus.CounterVec
+
+	// Outputs
+	remoteWriteSeries *prometheus.CounterVec
+	sinkEvents        *prometheus.CounterVec
+	sinkOverflow      *prometheus.GaugeVec
+	sinkQueue         *prometheus.GaugeVec
+	sinkCircuit       *prometheus.GaugeVec
+
+	actionRuns *prometheus.CounterVec
+
+	secretRefreshes *prometheus.CounterVec
+
+	// Operational failures, apart from data-quality violations
+	internalErrors        *prometheus.CounterVec
+	internalNotifications *prometheus.CounterVec
+}
+
+// NewMetrics creates the pipeline metrics and registers them on reg. A nil reg leaves
+// them unregistered: they are updated as usual but never collected.
+func NewMetrics(reg prometheus.Registerer) (*Metrics, error) {
+	if reg == nil {
+		return unregisteredMetrics(), nil
+	}
+	var created collectors
+	m := newMetrics(promauto.With(&created))
+	for i, c := range created {
+		if err := reg.Register(c); err != nil {
+			for _, registered := range created[:i] {
+				reg.Unregister(registered)
+			}
+			return nil, fmt.Errorf("%w: %w", ErrMetricsRegistration, err)
+		}
+	}
+	return m, nil
+}
+
+// Per-group gauges carry the feature and group as separate labels, so segments neither
+// mix with the feature's own series nor need their qualified names parsed.
+var groupLabels = []string{"feature_name", "group_by", "group", "model_version"}
+
+// Rollup gauges carry the resolution as a label, e.g. "1h", rather than a metric per
+// resolution.
+var rollupLabels = []string{"feature_name", "model_version", "resolution"}
+
+// unregisteredMetrics creates metrics that are never collected, for components running
+// outside a pipeline.
+func unregisteredMetrics() *Metrics {
+	return newMetrics(promauto.With(nil))
+}
+
+// newMetrics creates the pipeline metrics with the given factory.
+func newMetrics(f promauto.Factory) *Metrics {
+	return &Metrics{
+		featureCount: f.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "featurelens_feature_window_count_total", // Follow Prometheus naming conventions
+				Help: "Total number of messages processed for a feature in the last window.",
+			},
+			[]string{"feature_name", "model_version"}, // Label: feature_name
+		),
+		featureNullCount: f.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "featurelens_feature_window_null_count_total",
+				Help: "Total number of explicit null values encountered for a feature in the last window.",
+			},
+			[]string{"feature_name", "model_version"},
+		),
+		featureNullRate: f.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "featurelens_feature_window_null_rate",
+				Help: "Null rate for a feature in the last window (NullCount / Count).",
+			},
+			[]string{"feature_name", "model_version"},
+		),
+		featureMissingCount: f.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "featurelens_feature_window_missing_count_total",
+				Help: "Total number of messages without the feature's key in the last window.",
+			},
+			[]string{"feature_name", "model_version"},
+		),
+		featureMissingRate: f.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "featurelens_feature_window_missing_rate",
+				Help: "Missing rate for a feature in the last window (MissingCount / Count).",
+			},
+			[]string{"feature_name", "model_version"},
+		),
+		featureTypeMismatchRate: f.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "featurelens_feature_window_type_mismatch_rate",
+				Help: "Share of messages whose value for a feature is not of its metric type in the last window (TypeMismatchCount / Count).",
+			},
+			[]string{"feature_name", "model_version"},
+		),
+		featureMean: f.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "featurelens_feature_window_mean_value",
+				Help: "Mean value for a feature in the last window.",
+			},
+			[]string{"feature_name", "model_version"},
+		),
+		featureStdDev: f.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "featurelens_feature_window_stddev_value",
+				Help: "Standard deviation for a feature in the last window.",
+			},
+			[]string{"feature_name", "model_version"},
+		),
+		featureDistinctValues: f.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "featurelens_feature_window_distinct_values",
+				Help: "Number of distinct values observed for a categorical feature in the last window.",
+			},
+			[]string{"feature_name", "model_version"},
+		),
+		featureDistinctEstimate: f.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "featurelens_feature_window_distinct_estimate",
+				Help: "Approximate number of distinct values of a feature in the last window (HyperLogLog), for features with distinct value thresholds.",
+			},
+			[]string{"feature_name", "model_version"},
+		),
+		featureZeroRate: f.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "featurelens_feature_window_zero_rate",
+				Help: "Share of a numerical feature's values that were exactly zero in the last window.",
+			},
+			[]string{"feature_name", "model_version"},
+		),
+		featureTrueRate: f.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "featurelens_feature_window_true_rate",
+				Help: "Share of a boolean feature's values that were true in the last window.",
+			},
+			[]string{"feature_name", "model_version"},
+		),
+		featureOutlierRate: f.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "featurelens_feature_window_outlier_rate",
+				Help: "Share of a feature's numerical values outside its outlier bounds in the last window, for features with outliers.",
+			},
+			[]string{"feature_name", "model_version"},
+		),
+		featureConstantWindows: f.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "featurelens_feature_constant_windows",
+				Help: "Consecutive windows in which a feature held a single value.",
+			},
+			[]string{"feature_name", "model_version"},
+		),
+		featureInfo: f.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "featurelens_feature_info",
+				Help: "Always 1, labelled with the owner and team of features that configure them, for joining onto other series.",
+			},
+			[]string{"feature_name", "owner", "team"},
+		),
+		featureLastUpdate: f.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "featurelens_feature_last_update_timestamp_seconds",
+				Help: "Unix time a feature's window statistics were last exported, 0 until its first window with pipeline.initializeSeries, so staleness can be told from steady values.",
+			},
+			[]string{"feature_name", "model_version"},
+		),
+		featureNoDataWindows: f.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "featurelens_feature_no_data_windows",
+				Help: "Consecutive windows without any non-null observation of a feature, for features with noDataWindows.",
+			},
+			[]string{"feature_name"},
+		),
+		featureAvgLength: f.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "featurelens_feature_window_avg_length",
+				Help: "Average length in characters of a feature's string values in the last window.",
+			},
+			[]string{"feature_name", "model_version"},
+		),
+		featureMaxLength: f.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "featurelens_feature_window_max_length",
+				Help: "Length in characters of a feature's longest string value in the last window.",
+			},
+			[]string{"feature_name", "model_version"},
+		),
+		featurePatternMatchRate: f.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "featurelens_feature_window_pattern_match_rate",
+				Help: "Share of a feature's string values matching its valuePattern in the last window.",
+			},
+			[]string{"feature_name", "model_version"},
+		),
+		featurePercentile: f.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "featurelens_feature_window_percentile",
+				Help: "Percentile of a latency feature's values in milliseconds in the last window, by quantile (0.5, 0.95, 0.99).",
+			},
+			[]string{"feature_name", "model_version", "quantile"},
+		),
+		featureNormMean: f.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "featurelens_feature_window_norm_mean",
+				Help: "Mean Euclidean norm of a vector feature's well-formed vectors in the last window.",
+			},
+			[]string{"feature_name", "model_version"},
+		),
+		featureDimensionMismatchRate: f.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "featurelens_feature_window_dimension_mismatch_rate",
+				Help: "Share of a vector feature's values without the expected dimensions in the last window.",
+			},
+			[]string{"feature_name", "model_version"},
+		),
+		featureNonFiniteRate: f.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "featurelens_feature_window_non_finite_rate",
+				Help: "Share of a vector feature's elements that are NaN, infinite or null in the last window.",
+			},
+			[]string{"feature_name", "model_version"},
+		),
+		featureCentroidDistance: f.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "featurelens_feature_window_centroid_distance",
+				Help: "Mean cosine distance of a vector feature's vectors to its baseline centroid in the last window.",
+			},
+			[]string{"feature_name", "model_version"},
+		),
+		featureCustomMetric: f.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "featurelens_feature_window_custom_metric",
+				Help: "Custom metric of a feature in the last window, computed by a registered extension, by metric name.",
+			},
+			[]string{"feature_name", "model_version", "metric"},
+		),
+		featureSkewPSI: f.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "featurelens_feature_skew_psi",
+				Help: "Population stability index between serving and reference data for a feature in the last window.",
+			},
+			[]string{"feature_name"},
+		),
+		featureSkewJSDivergence: f.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "featurelens_feature_skew_js_divergence",
+				Help: "Jensen-Shannon divergence between serving and reference data for a feature in the last window.",
+			},
+			[]string{"feature_name"},
+		),
+		featureSkewChiSquarePValue: f.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "featurelens_feature_skew_chi_square_p_value",
+				Help: "P-value of the chi-squared goodness-of-fit test of a categorical feature's serving values against the reference distribution in the last window.",
+			},
+			[]string{"feature_name"},
+		),
+		featureSkewMeanDelta: f.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "featurelens_feature_skew_mean_delta",
+				Help: "Absolute difference between serving and reference means for a feature in the last window.",
+			},
+			[]string{"feature_name"},
+		),
+		consumerPartitionLag: f.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "featurelens_consumer_partition_lag",
+				Help: "Messages between the consumer's position and the high watermark of a partition.",
+			},
+			[]string{"topic", "partition"},
+		),
+		correlationCoefficient: f.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "featurelens_correlation_coefficient",
+				Help: "Pearson correlation between a configured pair of features in the last window.",
+			},
+			[]string{"correlation"},
+		),
+		compositeMetricValue: f.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "featurelens_composite_metric_value",
+				Help: "Value of a composite metric derived from several features' statistics in the last window.",
+			},
+			[]string{"metric"},
+		),
+		eventTimestampRate: f.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "featurelens_event_timestamp_anomaly_rate",
+				Help: "Share of messages in the last window whose event timestamp is future-dated or out of order, by kind (future, out_of_order).",
+			},
+			[]string{"kind"},
+		),
+		windowMessages: f.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "featurelens_window_messages",
+				Help: "Messages processed in the last completed window, zero when none arrived.",
+			},
+		),
+		noDataWindows: f.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "featurelens_no_data_windows",
+				Help: "Consecutive completed windows in which no message arrived.",
+			},
+		),
+		windowExpectedMessages: f.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "featurelens_window_expected_messages",
+				Help: "Messages expected per window, configured or learned from the recent complete windows.",
+			},
+		),
+		windowCompleteness: f.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "featurelens_window_completeness",
+				Help: "Messages processed in the last completed window relative to the volume expected of it.",
+			},
+		),
+		schemaFields: f.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "featurelens_schema_fields",
+				Help: "Fields of the message schema as of the last completed window with messages.",
+			},
+		),
+		schemaInfo: f.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "featurelens_schema_info",
+				Help: "Always 1, labelled with the fingerprint of the current message schema.",
+			},
+			[]string{"fingerprint"},
+		),
+		schemaChanges: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "featurelens_schema_changes_total",
+				Help: "Total number of message schema field changes, by change: added, removed or type_changed.",
+			},
+			[]string{"change"},
+		),
+		partitionNullRate: f.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "featurelens_partition_null_rate",
+				Help: "Null rate of a feature over one Kafka partition's messages in the last completed window, with partition statistics.",
+			},
+			[]string{"feature_name", "partition"},
+		),
+		partitionMean: f.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "featurelens_partition_mean",
+				Help: "Mean of a numerical feature over one Kafka partition's messages in the last completed window, with partition statistics.",
+			},
+			[]string{"feature_name", "partition"},
+		),
+		eventLatency: f.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "featurelens_event_latency_seconds",
+				Help: "End-to-end latency between message event time and processing in the last window, by statistic (mean, p95, max).",
+			},
+			[]string{"stat"},
+		),
+		featureChecksSuppressed: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "featurelens_feature_checks_suppressed_total",
+				Help: "Total number of windows whose threshold checks were suppressed, by reason.",
+			},
+			[]string{"feature_name", "reason", "model_version"},
+		),
+		auditWriteFailures: f.NewCounter(
+			prometheus.CounterOpts{
+				Name: "featurelens_audit_write_failures_total",
+				Help: "Total number of violations and alert resolutions that could not be written to the audit trail.",
+			},
+		),
+		// Optional: Track violations
+		featureThresholdViolations: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "featurelens_feature_threshold_violations_total",
+				Help: "Total number of threshold violations detected for a feature and specific check.",
+			},
+			[]string{"feature_name", "check_type", "comparison", "model_version", "severity"}, // Labels: feature_name, check_type (e.g., mean, null_rate), comparison (<, >), model_version, severity
+		),
+		featureCanaryViolations: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "featurelens_feature_canary_violations_total",
+				Help: "Total number of violations detected for a feature in canary mode, which are recorded but never notified.",
+			},
+			[]string{"feature_name", "check_type", "comparison", "model_version", "severity"},
+		),
+		featureStaleViolations: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "featurelens_feature_stale_violations_total",
+				Help: "Total number of violations detected in windows older than sinks.maxNotifyAge, e.g. replayed ones, which are recorded but never notified.",
+			},
+			[]string{"feature_name", "check_type", "comparison", "model_version", "severity"},
+		),
+		featureArchived: f.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "featurelens_feature_archived_timestamp_seconds",
+				Help: "Unix time at which monitoring of a feature removed from the configuration stopped.",
+			},
+			[]string{"feature_name"},
+		),
+		alertsRouted: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "featurelens_alert_routes_total",
+				Help: "Total number of violations and alert resolutions matched by each sinks route.",
+			},
+			[]string{"route"},
+		),
+		alertTransitions: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "featurelens_alert_transitions_total",
+				Help: "Total number of alerts that started firing (OK to FIRING) or resolved (FIRING to RESOLVED), by severity.",
+			},
+			[]string{"transition", "severity"},
+		),
+		alertDuration: f.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "featurelens_alert_duration_seconds",
+				Help:    "Duration of resolved alerts, from the window end of their first violation to that of the healthy window resolving them.",
+				Buckets: []float64{60, 300, 900, 1800, 3600, 3 * 3600, 6 * 3600, 12 * 3600, 24 * 3600, 72 * 3600},
+			},
+			[]string{"severity"},
+		),
+		seriesSuppressed: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "featurelens_metric_series_suppressed_total",
+				Help: "Total number of distinct label values folded into the __other__ series once the series limits were reached, by label.",
+			},
+			[]string{"label"},
+		),
+		groupCount: f.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "featurelens_feature_group_window_count_total",
+				Help: "Total messages processed for a feature's group in the last window.",
+			},
+			groupLabels,
+		),
+		groupNullRate: f.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "featurelens_feature_group_window_null_rate",
+				Help: "Null rate for a feature's group in the last window (NullCount / Count).",
+			},
+			groupLabels,
+		),
+		groupMissingRate: f.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "featurelens_feature_group_window_missing_rate",
+				Help: "Missing rate for a feature's group in the last window (MissingCount / Count).",
+			},
+			groupLabels,
+		),
+		groupMean: f.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "featurelens_feature_group_window_mean_value",
+				Help: "Mean value for a feature's group in the last window.",
+			},
+			groupLabels,
+		),
+		groupStdDev: f.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "featurelens_feature_group_window_stddev_value",
+				Help: "Standard deviation for a feature's group in the last window.",
+			},
+			groupLabels,
+		),
+		rollupCount: f.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "featurelens_feature_rollup_count_total",
+				Help: "Total messages processed for a feature in the last completed rollup of its windows, by resolution.",
+			},
+			rollupLabels,
+		),
+		rollupNullRate: f.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "featurelens_feature_rollup_null_rate",
+				Help: "Null rate for a feature in the last completed rollup of its windows, by resolution.",
+			},
+			rollupLabels,
+		),
+		rollupMissingRate: f.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "featurelens_feature_rollup_missing_rate",
+				Help: "Missing rate for a feature in the last completed rollup of its windows, by resolution.",
+			},
+			rollupLabels,
+		),
+		rollupMean: f.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "featurelens_feature_rollup_mean_value",
+				Help: "Mean value for a feature in the last completed rollup of its windows, by resolution.",
+			},
+			rollupLabels,
+		),
+		rollupStdDev: f.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "featurelens_feature_rollup_stddev_value",
+				Help: "Standard deviation for a feature in the last completed rollup of its windows, by resolution.",
+			},
+			rollupLabels,
+		),
+		featureSampleRate: f.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "featurelens_feature_sample_rate",
+				Help: "Fraction of messages currently processed for a feature (1 = every message).",
+			},
+			[]string{"feature_name"},
+		),
+		loadSheddingActive: f.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "featurelens_load_shedding_active",
+				Help: "Whether load shedding is currently active (1) or not (0).",
+			},
+		),
+		loadShedObservations: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "featurelens_load_shed_observations_total",
+				Help: "Total number of feature observations skipped by load shedding, by feature priority.",
+			},
+			[]string{"priority"},
+		),
+		heapBytes: f.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "featurelens_heap_bytes",
+				Help: "Heap memory occupied by live and not yet swept objects, as sampled by the resource monitor.",
+			},
+		),
+		goroutines: f.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "featurelens_goroutines",
+				Help: "Goroutines running in the process, as sampled by the resource monitor.",
+			},
+		),
+		channelDepth: f.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "featurelens_channel_depth",
+				Help: "Items buffered between pipeline stages, by channel.",
+			},
+			[]string{"channel"},
+		),
+		stageLatency: f.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "featurelens_stage_latency_seconds",
+				Help:    "Time batches and results spend between pipeline stages, by stage: parse (consumer hand-off to parsed), aggregate (parsed to aggregated) and alert (window flush to evaluated result).",
+				Buckets: prometheus.ExponentialBuckets(0.0005, 2.5, 12), // 0.5ms to about 30s
+			},
+			[]string{"stage"},
+		),
+		sessionsOpen: f.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "featurelens_sessions_open",
+				Help: "Entity sessions currently open.",
+			},
+		),
+		sessionsClosed: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "featurelens_sessions_closed_total",
+				Help: "Entity sessions closed, by reason: gap (inactivity), evicted (closed early to stay within maxOpen) or drained (open at shutdown or the end of a replay).",
+			},
+			[]string{"reason"},
+		),
+		lateMessages: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "featurelens_late_messages_total",
+				Help: "Messages whose event-time window was already flushed, by outcome: dropped, reemitted (their window was reopened), accumulated (into a late bucket) or expired (their window is no longer retained to be reopened).",
+			},
+			[]string{"outcome"},
+		),
+		windowStateBytes: f.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "featurelens_window_state_bytes",
+				Help: "Estimated size of the open windows' feature and segment stats, by location: memory or disk (spilled).",
+			},
+			[]string{"location"},
+		),
+		windowStateSpills: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "featurelens_window_state_spills_total",
+				Help: "Feature and segment stats moved out of memory by the window state budget, by operation: spill, restore, or failed (a spill file could not be written or read).",
+			},
+			[]string{"operation"},
+		),
+		flushes: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "featurelens_calculator_flushes_total",
+				Help: "Window flushes of the calculator, by outcome: run, coalesced (fell due while the calculator was busy or suspended, merged into a later one) or idle (not run, nothing was open).",
+			},
+			[]string{"outcome"},
+		),
+		messagesFiltered: f.NewCounter(
+			prometheus.CounterOpts{
+				Name: "featurelens_messages_filtered_total",
+				Help: "Total number of parsed messages dropped by the pipeline filter.",
+			},
+		),
+		valuesCoerced: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "featurelens_values_coerced_total",
+				Help: "Total number of message values converted by pipeline.coercion, by kind: number or timestamp.",
+			},
+			[]string{"kind"},
+		),
+		derivedFieldErrors: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "featurelens_derived_field_errors_total",
+				Help: "Total number of messages a derived field could not be computed for, e.g. a string divided by a number, by field.",
+			},
+			[]string{"field"},
+		),
+		scriptErrors: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "featurelens_script_errors_total",
+				Help: "Total number of messages a pipeline script step failed on, e.g. an unpack of a malformed payload, by step (<index>:<op>, or <stage>/<index>:<op> for graph script stages).",
+			},
+			[]string{"step"},
+		),
+		stageFiltered: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "featurelens_graph_messages_filtered_total",
+				Help: "Total number of messages a pipeline graph filter stage did not forward, by stage.",
+			},
+			[]string{"stage"},
+		),
+		payloadFormats: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "featurelens_payload_formats_total",
+				Help: "Total number of messages decoded with the auto format, by detected format: json, jsonl, msgpack, cbor, schema_registry (the Confluent wire format) or unknown.",
+			},
+			[]string{"format"},
+		),
+		partialsPublished: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "featurelens_partial_windows_published_total",
+				Help: "Partial windows of this instance, by result: published, failed to write to the coordination topic, or dropped before publication.",
+			},
+			[]string{"result"},
+		),
+		windowsMerged: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "featurelens_merged_windows_total",
+				Help: "Windows merged from the instances' partials, by whether every instance reported (complete) or the merge timed out (timeout).",
+			},
+			[]string{"outcome"},
+		),
+		partialsRejected: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "featurelens_partial_windows_rejected_total",
+				Help: "Partial windows the merger did not merge, by reason: invalid, late (its window was already merged) or duplicate.",
+			},
+			[]string{"reason"},
+		),
+		remoteWriteSeries: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "featurelens_remote_write_series_total",
+				Help: "Total number of series handled by the remote-write exporter, by result (sent, failed, dropped).",
+			},
+			[]string{"result"},
+		),
+		sinkEvents: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "featurelens_sink_events_total",
+				Help: "Total number of events handled by each sink, by result (sent, retried, buffered, failed, dropped, deduplicated).",
+			},
+			[]string{"sink", "result"},
+		),
+		sinkOverflow: f.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "featurelens_sink_overflow_events",
+				Help: "Failed events buffered for redelivery, per sink.",
+			},
+			[]string{"sink"},
+		),
+		sinkQueue: f.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "featurelens_sink_queue_events",
+				Help: "Events queued for delivery or being delivered, per sink.",
+			},
+			[]string{"sink"},
+		),
+		sinkCircuit: f.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "featurelens_sink_circuit_state",
+				Help: "State of each sink's circuit breaker: 0 closed, 1 half-open, 2 open.",
+			},
+			[]string{"sink"},
+		),
+		actionRuns: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "featurelens_action_runs_total",
+				Help: "Total number of triggered runs of each action, by result (succeeded, failed, dry_run, cooling_down, dropped).",
+			},
+			[]string{"action", "result"},
+		),
+		secretRefreshes: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "featurelens_secret_refreshes_total",
+				Help: "Total number of refreshes of the secrets referenced by the configuration, by result (unchanged, rotated, failed).",
+			},
+			[]string{"result"},
+		),
+		internalErrors: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "featurelens_internal_errors_total",
+				Help: "Total number of operational failures of FeatureLens itself, such as failed sink deliveries or unparseable messages, by component, severity (warning, error, critical) and whether they are retryable.",
+			},
+			[]string{"component", "severity", "retryable"},
+		),
+		internalNotifications: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "featurelens_internal_error_notifications_total",
+				Help: "Total number of internal errors considered for sink notification, by result (queued, suppressed, dropped).",
+			},
+			[]string{"result"},
+		),
+	}
+}
+
+// collectors records the collectors a promauto factory creates instead of registering
+// them, so that NewMetrics can register them all or none.
+type collectors []prometheus.Collector
+
+func (c *collectors) Register(collector prometheus.Collector) error {
+	*c = append(*c, collector)
+	return nil
+}
+
+func (c *collectors) MustRegister(cs ...prometheus.Collector) {
+	*c = append(*c, cs...)
+}
+
+func (c *collectors) Unregister(prometheus.Collector) bool {
+	return false
+}
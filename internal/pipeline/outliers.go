@@ -0,0 +1,57 @@
+package pipeline
+
+import (
+	"math"
+
+	"github.com/sanspareilsmyn/featurelens/internal/config"
+	"github.com/sanspareilsmyn/featurelens/internal/sketch"
+)
+
+// outlierBounds are the bounds outside of which values are outliers.
+type outlierBounds struct {
+	lower, upper float64
+}
+
+// outlierStats counts the values of a feature, or one of its segments, outside its
+// outlier bounds, or returns nil if the feature has no outlier rule or no values were
+// observed. With the baseline reference, the bounds are those of the result's last window
+// within outlierRateMax, and the window's own until there is one.
+func (c *Calculator) outlierStats(featureCfg config.FeatureConfig, name string, stats *FeatureStats, mean, variance float64) *OutlierStats {
+	rule := featureCfg.Outliers
+	if rule == nil || stats.quantile == nil || stats.quantile.Count() == 0 {
+		return nil
+	}
+	own := windowOutlierBounds(*rule, stats.quantile, mean, variance)
+	bounds := own
+	if rule.Reference == config.OutlierReferenceBaseline {
+		if baseline, ok := c.outlierBaselines[name]; ok {
+			bounds = baseline
+		}
+	}
+
+	count := int64(stats.quantile.CountOutside(bounds.lower, bounds.upper))
+	result := &OutlierStats{
+		Count: count,
+		Rate:  float64(count) / float64(stats.quantile.Count()),
+		Lower: bounds.lower,
+		Upper: bounds.upper,
+	}
+	if rule.Reference == config.OutlierReferenceBaseline {
+		if limit := featureCfg.Thresholds.OutlierRateMax; limit == nil || result.Rate <= *limit {
+			c.outlierBaselines[name] = own
+		}
+	}
+	return result
+}
+
+// windowOutlierBounds returns the outlier bounds of a window's values: k interquartile
+// ranges beyond the quartiles, or k standard deviations around the mean.
+func windowOutlierBounds(rule config.OutlierConfig, q *sketch.Quantile, mean, variance float64) outlierBounds {
+	k := rule.Factor()
+	if rule.Method == config.OutlierZScore {
+		stdDev := math.Sqrt(variance)
+		return outlierBounds{lower: mean - k*stdDev, upper: mean + k*stdDev}
+	}
+	q1, q3 := q.Quantile(0.25), q.Quantile(0.75)
+	return outlierBounds{lower: q1 - k*(q3-q1), upper: q3 + k*(q3-q1)}
+}
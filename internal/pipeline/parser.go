@@ -0,0 +1,232 @@
+package pipeline
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
+
+	"github.com/sanspareilsmyn/featurelens/internal/config"
+	"github.com/sanspareilsmyn/featurelens/internal/expr"
+	"github.com/sanspareilsmyn/featurelens/internal/intern"
+	"github.com/sanspareilsmyn/featurelens/internal/message"
+)
+
+// decodeFunc decodes a payload into the messages it carries: one for JSON, MessagePack
+// and CBOR payloads, one per line for JSON lines and CSV. Messages decoded before an error
+// are returned along with it.
+type decodeFunc func(data []byte) ([]message.DynamicMessage, error)
+
+// parseFunc decodes a raw message like a decodeFunc decodes its payload, with the
+// message's key and headers at hand.
+type parseFunc func(raw rawMessage) ([]message.DynamicMessage, error)
+
+// newParseFunc returns the parser for the configured payload format. The configured key
+// and header fields are set on decoded messages, their values are coerced to the types
+// the pipeline reads, and the script then transforms them; messages the filter excludes
+// are dropped, and the configured derived fields are added to the others.
+func newParseFunc(cfg *config.Config, partial bool, metrics *Metrics, logger *zap.Logger) parseFunc {
+	values := intern.New(cfg.Pipeline.InternMaxEntries)
+	var parse parseFunc
+	if cfg.Pipeline.Format == config.FormatAuto {
+		parse = newFormatDetector(cfg, partial, values, metrics, logger).decode
+	} else {
+		parse = payload(newDecoder(cfg, cfg.Pipeline.Format, partial, values, logger))
+	}
+	parse = withMetadata(parse, cfg.Pipeline.Metadata)
+	parse = withCoercion(parse, cfg, metrics)
+	parse = withScript(parse, cfg.Pipeline.Script, metrics)
+	parse = withFilter(parse, cfg.Pipeline.Filter, metrics)
+	return withDerivedFields(parse, cfg.Pipeline.DerivedFields, metrics)
+}
+
+// newDecoder returns the decoder for a payload format other than auto. With partial,
+// JSON objects are decoded with only the fields the pipeline reads (configured features
+// and their groupBy fields, the event timestamp, the trace ID, correlated fields, session
+// fields and the inputs of the script, derived fields, the filter and graph stages); group
+// patterns can match any field, so they require decoding every field. The values of
+// categorical features and groupBy fields are then interned in values.
+func newDecoder(cfg *config.Config, format string, partial bool, values *intern.Pool, logger *zap.Logger) decodeFunc {
+	switch format {
+	case config.FormatCSV:
+		csvCfg := cfg.Pipeline.CSV
+		comma := []rune(csvCfg.Delimiter)[0] // Validated at config load
+		return message.NewCSVParser(csvCfg.Columns, comma, csvCfg.Header).Parse
+	case config.FormatMsgPack:
+		return single(message.ParseMsgPack)
+	case config.FormatCBOR:
+		return single(message.ParseCBOR)
+	case config.FormatJSONLines:
+		decode := newObjectDecoder(cfg, partial, values, logger)
+		return func(data []byte) ([]message.DynamicMessage, error) {
+			return message.ParseLines(data, decode)
+		}
+	default:
+		return single(newObjectDecoder(cfg, partial, values, logger))
+	}
+}
+
+// payload adapts a decoder of payloads to raw messages.
+func payload(decode decodeFunc) parseFunc {
+	return func(raw rawMessage) ([]message.DynamicMessage, error) {
+		return decode(raw.value)
+	}
+}
+
+// single adapts a decoder of one message per payload.
+func single(decode func([]byte) (message.DynamicMessage, error)) decodeFunc {
+	return func(data []byte) ([]message.DynamicMessage, error) {
+		msg, err := decode(data)
+		if err != nil {
+			return nil, err
+		}
+		return []message.DynamicMessage{msg}, nil
+	}
+}
+
+// newObjectDecoder returns the decoder for a single JSON object.
+func newObjectDecoder(cfg *config.Config, partial bool, values *intern.Pool, logger *zap.Logger) func([]byte) (message.DynamicMessage, error) {
+	if !partial {
+		return message.ParseDynamicJSON
+	}
+	var fields, repeated []string // repeated holds the fields whose values are interned
+	for _, f := range cfg.Features {
+		if f.Pattern != "" {
+			logger.Info("Group patterns configured, decoding every message field",
+				zap.String("pattern", f.Pattern),
+			)
+			return message.ParseDynamicJSON
+		}
+		if f.Scope != config.ScopeSession { // Session features read session summaries
+			fields = append(fields, f.FieldName())
+			if f.MetricType == config.MetricTypeCategorical {
+				repeated = append(repeated, f.FieldName())
+			}
+		}
+		if f.GroupBy != "" {
+			fields = append(fields, f.GroupBy)
+			repeated = append(repeated, f.GroupBy)
+		}
+	}
+	if ts := cfg.Pipeline.Latency.TimestampField; ts != "" {
+		fields = append(fields, ts)
+	}
+	if v := cfg.Pipeline.VersionField; v != "" {
+		fields = append(fields, v)
+	}
+	if t := cfg.Pipeline.TenantField; t != "" {
+		fields = append(fields, t)
+	}
+	if t := cfg.Pipeline.Exemplars.TraceField; t != "" {
+		fields = append(fields, t)
+	}
+	if s := cfg.Pipeline.Sessions; s.EntityField != "" {
+		fields = append(fields, s.EntityField)
+		fields = append(fields, s.Fields...)
+	}
+	for _, c := range cfg.Pipeline.Correlations {
+		fields = append(fields, c.Features...)
+	}
+	for _, d := range cfg.Pipeline.DerivedFields {
+		e, _ := expr.Compile(d.Expr) // Validated at config load
+		fields = append(fields, e.Identifiers()...)
+	}
+	if f := cfg.Pipeline.Filter; f != "" {
+		e, _ := expr.Compile(f) // Validated at config load
+		fields = append(fields, e.Identifiers()...)
+	}
+	steps := cfg.Pipeline.Script
+	for _, stage := range cfg.Pipeline.Graph.Stages {
+		if stage.Filter != "" {
+			e, _ := expr.Compile(stage.Filter) // Validated at config load
+			fields = append(fields, e.Identifiers()...)
+		}
+		steps = append(steps[:len(steps):len(steps)], stage.Script...)
+	}
+	for _, s := range steps {
+		fields = append(fields, s.Field)
+		for _, src := range []string{s.Expr, s.When} {
+			if src != "" {
+				e, _ := expr.Compile(src) // Validated at config load
+				fields = append(fields, e.Identifiers()...)
+			}
+		}
+	}
+	logger.Debug("Partial parsing enabled", zap.Strings("fields", fields), zap.Strings("interned", repeated))
+	parser := message.NewFieldParser(fields)
+	parser.InternValues(values, repeated)
+	return parser.Parse
+}
+
+// parseResult is the outcome of decoding one raw message.
+type parseResult struct {
+	topic     string // Topic the message was consumed from, "" when replayed
+	partition int
+	handedOff time.Time
+	msgs      []message.DynamicMessage
+	err       error
+}
+
+// parseJob is a batch of raw messages handed to a parser worker, with the slot its
+// results are delivered to.
+type parseJob struct {
+	batch []rawMessage
+	slot  chan<- []parseResult
+}
+
+// startParsers decodes batches of raw messages on a pool of workers. It returns, in input
+// order, one slot per batch that receives the batch's parse results once a worker is
+// done, so a slow batch delays the ones behind it but never reorders them. At most workers
+// batches are in flight. The returned channel is closed when input is closed or ctx is
+// done.
+func startParsers(ctx context.Context, input <-chan []rawMessage, parse parseFunc, workers int) <-chan chan []parseResult {
+	jobs := make(chan parseJob)
+	slots := make(chan chan []parseResult, workers)
+
+	go func() {
+		defer close(slots)
+		defer close(jobs)
+		for {
+			select {
+			case batch, ok := <-input:
+				if !ok {
+					return
+				}
+				slot := make(chan []parseResult, 1)
+				select {
+				case slots <- slot:
+				case <-ctx.Done():
+					return
+				}
+				select {
+				case jobs <- parseJob{batch: batch, slot: slot}:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	for range workers {
+		go func() {
+			for job := range jobs {
+				_, span := tracer.Start(ctx, "message.parse")
+				results := make([]parseResult, len(job.batch))
+				for i, raw := range job.batch {
+					msgs, err := parse(raw)
+					results[i] = parseResult{topic: raw.topic, partition: raw.partition, handedOff: raw.handedOff, msgs: msgs, err: err}
+					if raw.buf != nil {
+						message.ReleaseBuffer(raw.buf)
+					}
+				}
+				span.SetAttributes(attribute.Int("messaging.batch.message_count", len(job.batch)))
+				span.End()
+				job.slot <- results // Buffered, never blocks
+			}
+		}()
+	}
+	return slots
+}
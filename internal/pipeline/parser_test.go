@@ -0,0 +1,189 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+
+	"github.com/sanspareilsmyn/featurelens/internal/config"
+	"github.com/sanspareilsmyn/featurelens/internal/intern"
+	"github.com/sanspareilsmyn/featurelens/internal/message"
+)
+
+// benchmarkPayloads returns n JSON messages of a realistic size, numbered by "seq".
+func benchmarkPayloads(n int) [][]byte {
+	var fields strings.Builder
+	for i := range 40 {
+		fmt.Fprintf(&fields, `,"feature_%02d":%d.25,"label_%02d":"value_%d"`, i, i, i, i%7)
+	}
+	payloads := make([][]byte, n)
+	for i := range payloads {
+		payloads[i] = []byte(fmt.Sprintf(`{"seq":%d%s}`, i, fields.String()))
+	}
+	return payloads
+}
+
+// benchmarkFeatures returns 20 features of benchmarkPayloads, each message sampled.
+func benchmarkFeatures() []config.FeatureConfig {
+	sampling := config.SamplingConfig{Rate: 1}
+	var features []config.FeatureConfig
+	for i := range 10 {
+		features = append(features,
+			config.FeatureConfig{Name: fmt.Sprintf("feature_%02d", i), MetricType: config.MetricTypeNumerical, Sampling: sampling},
+			config.FeatureConfig{Name: fmt.Sprintf("label_%02d", i), MetricType: config.MetricTypeCategorical, Sampling: sampling},
+		)
+	}
+	return features
+}
+
+// parseAll runs payloads through startParsers in batches of batchSize and fails unless
+// results come back in input order.
+func parseAll(b *testing.B, payloads [][]byte, workers, batchSize int) {
+	input := make(chan []rawMessage, len(payloads))
+	for start := 0; start < len(payloads); start += batchSize {
+		batch := make([]rawMessage, 0, batchSize)
+		for _, p := range payloads[start:min(start+batchSize, len(payloads))] {
+			batch = append(batch, rawMessage{value: p})
+		}
+		input <- batch
+	}
+	close(input)
+
+	var next float64
+	for slot := range startParsers(context.Background(), input, withMetadata(payload(single(message.ParseDynamicJSON)), config.MetadataConfig{}), workers) {
+		for _, result := range <-slot {
+			if result.err != nil {
+				b.Fatalf("parse failed: %v", result.err)
+			}
+			seq, ok := result.msgs[0].GetFloat64("seq")
+			if !ok || *seq != next {
+				b.Fatalf("message out of order: got seq %v, want %v", seq, next)
+			}
+			next++
+		}
+	}
+	if int(next) != len(payloads) {
+		b.Fatalf("parsed %d messages, want %d", int(next), len(payloads))
+	}
+}
+
+// BenchmarkParsers compares a single parser worker with one per CPU (at least 4), handing
+// off every message on its own or in batches; the reported msgs/s shows the throughput
+// gain of the pool and of batching.
+func BenchmarkParsers(b *testing.B) {
+	payloads := benchmarkPayloads(2000)
+	for _, workers := range []int{1, max(runtime.GOMAXPROCS(0), 4)} {
+		for _, batchSize := range []int{1, 100} {
+			b.Run(fmt.Sprintf("workers=%d/batch=%d", workers, batchSize), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					parseAll(b, payloads, workers, batchSize)
+				}
+				b.ReportMetric(float64(b.N*len(payloads))/b.Elapsed().Seconds(), "msgs/s")
+			})
+		}
+	}
+}
+
+// BenchmarkParseAndAggregate decodes messages with the pipeline's JSON object decoder and
+// aggregates them into a window of 20 features, with and without the messages recycled to
+// the message pool. Messages are decoded in full, or partially with the categorical
+// values interned as in production, or with a full intern pool that retains nothing new;
+// allocs/op shows the GC pressure saved per message.
+func BenchmarkParseAndAggregate(b *testing.B) {
+	payloads := benchmarkPayloads(2000)
+	features := benchmarkFeatures()
+	parsers := []struct {
+		name       string
+		partial    bool
+		maxEntries int
+	}{
+		{name: "full"},
+		{name: "partial", partial: true, maxEntries: 1000},
+		{name: "partial-uninterned", partial: true},
+	}
+	for _, parser := range parsers {
+		for _, recycle := range []bool{false, true} {
+			b.Run(fmt.Sprintf("parser=%s/recycle=%t", parser.name, recycle), func(b *testing.B) {
+				cfg := &config.Config{
+					Pipeline: config.PipelineConfig{WindowSize: time.Hour, InternMaxEntries: parser.maxEntries},
+					Features: features,
+				}
+				decode := newObjectDecoder(cfg, parser.partial, intern.New(cfg.Pipeline.InternMaxEntries), zap.NewNop())
+				registry := NewFeatureRegistry(features, 0, zap.NewNop())
+				metrics, err := NewMetrics(prometheus.NewRegistry())
+				if err != nil {
+					b.Fatal(err)
+				}
+				sampler := NewAdaptiveSampler(features, config.LoadSheddingConfig{}, newSeriesLimiter(0, 0, metrics, zap.NewNop()), zap.NewNop())
+				c := NewCalculator(cfg.Pipeline, registry, nil, nil, nil, nil, nil, sampler, metrics, zap.NewNop())
+				c.recycle = recycle
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					msg, err := decode(payloads[i%len(payloads)])
+					if err != nil {
+						b.Fatal(err)
+					}
+					c.processMessage(msg)
+					if c.recycle {
+						message.Release(msg)
+					}
+				}
+				b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "msgs/s")
+			})
+		}
+	}
+}
+
+// BenchmarkCalculatorWorkers aggregates batches of decoded messages into a window of 20
+// features with their stats split across 1, 2 and 4 calculator workers.
+func BenchmarkCalculatorWorkers(b *testing.B) {
+	const batchSize = 500
+	payloads := benchmarkPayloads(2000)
+	features := benchmarkFeatures()
+	var batches [][]message.DynamicMessage
+	for i := 0; i < len(payloads); i += batchSize {
+		var batch []message.DynamicMessage
+		for _, payload := range payloads[i:min(i+batchSize, len(payloads))] {
+			msg, err := message.ParseDynamicJSON(payload)
+			if err != nil {
+				b.Fatal(err)
+			}
+			batch = append(batch, msg)
+		}
+		batches = append(batches, batch)
+	}
+	for _, workers := range []int{1, 2, 4} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			registry := NewFeatureRegistry(features, 0, zap.NewNop())
+			metrics, err := NewMetrics(prometheus.NewRegistry())
+			if err != nil {
+				b.Fatal(err)
+			}
+			cfg := config.PipelineConfig{WindowSize: time.Hour, InternMaxEntries: 1000, CalculatorWorkers: workers}
+			sampler := NewAdaptiveSampler(features, config.LoadSheddingConfig{}, newSeriesLimiter(0, 0, metrics, zap.NewNop()), zap.NewNop())
+			c := NewCalculator(cfg, registry, nil, nil, nil, nil, nil, sampler, metrics, zap.NewNop())
+			if workers > 1 {
+				c.shard(workers)
+			}
+			var updated sync.WaitGroup
+			c.startShards(&updated)
+			defer c.stopShards()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				for _, msg := range batches[i%len(batches)] {
+					c.processMessage(msg)
+				}
+				c.updateShards(&updated)
+			}
+			b.ReportMetric(float64(b.N*batchSize)/b.Elapsed().Seconds(), "msgs/s")
+		})
+	}
+}
@@ -0,0 +1,269 @@
+package pipeline
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"time"
+
+	"github.com/sanspareilsmyn/featurelens/internal/schema"
+	"github.com/sanspareilsmyn/featurelens/internal/sketch"
+)
+
+// partialFormat versions the wire form of partial windows; the merger drops partials of
+// other versions, published by instances running another release.
+const partialFormat = 2
+
+// partialWindow is the wire form of one instance's running aggregates of a window,
+// published for the merger of a horizontally scaled deployment. It is gob-encoded, which
+// unlike JSON keeps non-finite sums and extremes.
+type partialWindow struct {
+	Format       int
+	Instance     string
+	WindowStart  time.Time
+	WindowEnd    time.Time
+	Features     []partialFeature
+	Versions     []string
+	Messages     int64
+	Fields       map[string]*fieldTypeCounts            // Value types of message fields, with schema tracking
+	Partitions   map[string]map[string]*partitionCounts // Feature stats by partition, with partition statistics
+	Latency      *partialLatency
+	Correlations []*partialMoments // Indexed like the configured correlations
+}
+
+// partialFeature holds the stats of a feature, or one of its segments, for a model version.
+type partialFeature struct {
+	Name    string // Configured feature name
+	Version string
+	Group   string // Segment group, "" for the feature's overall stats
+	Segment bool
+	Stats   partialStats
+}
+
+type partialStats struct {
+	Count, NullCount, MissingCount, TypeMismatchCount int64
+	ValueCount, ZeroCount                             int64
+	TrueCount, FalseCount                             int64
+	Mean, M2, Min, Max                                float64
+	Categories                                        map[string]int64
+	SampledOut                                        int64
+	StringCount, LengthSum, LengthMax, PatternMatches int64
+	Vector                                            *partialVector
+	Percentiles, Quantile                             *schema.QuantileSketch
+	Cardinality                                       *schema.CardinalitySketch
+	Frequency                                         *schema.FrequencySketch
+	Samples                                           []string
+	SamplesSeen                                       int64
+	Exemplars                                         *partialExemplars
+}
+
+type partialExemplars struct {
+	Values, Nulls         []string
+	ValuesSeen, NullsSeen int64
+	Min, Max              schema.Exemplar
+}
+
+type partialVector struct {
+	Values, DimensionMismatches, Elements, NonFinite, WellFormed int64
+	Dimensions                                                   int
+	NormSum, NormSumSq                                           float64
+	Sum, UnitSum                                                 []float64
+	UnitCount                                                    int64
+}
+
+type partialLatency struct {
+	Count, Future, OutOfOrder int64
+	Sum, Max                  float64
+	Quantile                  *schema.QuantileSketch
+}
+
+type partialMoments struct {
+	Count                       int64
+	MeanX, MeanY, M2X, M2Y, CXY float64
+}
+
+// encodePartial serializes a window's aggregates for publication by the instance.
+func (c *Calculator) encodePartial(w *windowInfo) ([]byte, error) {
+	p := partialWindow{
+		Format:      partialFormat,
+		Instance:    c.instance,
+		WindowStart: w.windowStart,
+		WindowEnd:   w.windowEnd,
+		Versions:    w.sortedVersions(),
+		Messages:    w.messages,
+		Fields:      w.fields,
+		Partitions:  w.partitions,
+	}
+	for _, featureCfg := range c.registry.Features() {
+		for _, version := range p.Versions {
+			name := versionedName(featureCfg.Name, version)
+			if stats, ok := w.features[name]; ok {
+				p.Features = append(p.Features, partialFeature{Name: featureCfg.Name, Version: version, Stats: stats.partial()})
+			}
+			for group, stats := range w.groups[name] {
+				p.Features = append(p.Features, partialFeature{Name: featureCfg.Name, Version: version, Group: group, Segment: true, Stats: stats.partial()})
+			}
+		}
+	}
+	if l := w.latency; l != nil {
+		p.Latency = &partialLatency{Count: l.count, Future: l.future, OutOfOrder: l.outOfOrder, Sum: l.sum, Max: l.max, Quantile: l.quantile.Payload()}
+	}
+	for _, m := range w.correlations {
+		var pm *partialMoments
+		if m != nil {
+			pm = &partialMoments{Count: m.count, MeanX: m.meanX, MeanY: m.meanY, M2X: m.m2X, M2Y: m.m2Y, CXY: m.cXY}
+		}
+		p.Correlations = append(p.Correlations, pm)
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&p); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decodePartial restores a published partial window, also returning its wire form for
+// the instance and the configured names of its features.
+func decodePartial(raw []byte) (*partialWindow, *windowInfo, error) {
+	var p partialWindow
+	if err := gob.NewDecoder(bytes.NewReader(raw)).Decode(&p); err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", ErrInvalidPartial, err)
+	}
+	if p.Format != partialFormat {
+		return nil, nil, fmt.Errorf("%w: format %d, expected %d", ErrInvalidPartial, p.Format, partialFormat)
+	}
+
+	// In the merger's time zone, so window ends of every instance compare equal as map keys
+	p.WindowStart, p.WindowEnd = p.WindowStart.Local(), p.WindowEnd.Local()
+	w := newWindowInfo(p.WindowStart, p.WindowEnd)
+	w.messages = p.Messages
+	w.fields = p.Fields
+	w.partitions = p.Partitions
+	for _, version := range p.Versions {
+		w.versions[version] = struct{}{}
+	}
+	for _, f := range p.Features {
+		stats, err := f.Stats.restore()
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: feature %q: %w", ErrInvalidPartial, f.Name, err)
+		}
+		name := versionedName(f.Name, f.Version)
+		if !f.Segment {
+			w.features[name] = stats
+			continue
+		}
+		if w.groups == nil {
+			w.groups = make(map[string]map[string]*FeatureStats)
+		}
+		if w.groups[name] == nil {
+			w.groups[name] = make(map[string]*FeatureStats)
+		}
+		w.groups[name][f.Group] = stats
+	}
+	if l := p.Latency; l != nil {
+		q, err := sketch.QuantileFromPayload(l.Quantile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: latency: %w", ErrInvalidPartial, err)
+		}
+		w.latency = &latencyStats{count: l.Count, sum: l.Sum, max: l.Max, quantile: q, future: l.Future, outOfOrder: l.OutOfOrder}
+	}
+	if len(p.Correlations) > 0 {
+		w.correlations = make([]*coMoments, len(p.Correlations))
+		for i, m := range p.Correlations {
+			if m != nil {
+				w.correlations[i] = &coMoments{count: m.Count, meanX: m.MeanX, meanY: m.MeanY, m2X: m.M2X, m2Y: m.M2Y, cXY: m.CXY}
+			}
+		}
+	}
+	return &p, w, nil
+}
+
+func (s *FeatureStats) partial() partialStats {
+	p := partialStats{
+		Count: s.count, NullCount: s.nullCount, MissingCount: s.missingCount, TypeMismatchCount: s.typeMismatchCount,
+		ValueCount: s.valueCount, ZeroCount: s.zeroCount,
+		TrueCount: s.trueCount, FalseCount: s.falseCount,
+		Mean: s.mean, M2: s.m2, Min: s.min, Max: s.max,
+		Categories:  s.categories,
+		SampledOut:  s.sampledOut,
+		StringCount: s.stringCount, LengthSum: s.lengthSum, LengthMax: s.lengthMax, PatternMatches: s.patternMatches,
+	}
+	if s.samples != nil {
+		p.Samples, p.SamplesSeen = s.samples.values, s.samples.seen
+	}
+	if e := s.exemplars; e != nil {
+		p.Exemplars = &partialExemplars{
+			Values: e.values.values, Nulls: e.nulls.values, ValuesSeen: e.values.seen, NullsSeen: e.nulls.seen,
+			Min: e.min, Max: e.max,
+		}
+	}
+	if v := s.vector; v != nil {
+		p.Vector = &partialVector{
+			Values: v.values, DimensionMismatches: v.dimensionMismatches, Elements: v.elements, NonFinite: v.nonFinite, WellFormed: v.wellFormed,
+			Dimensions: v.dimensions, NormSum: v.normSum, NormSumSq: v.normSumSq, Sum: v.sum, UnitSum: v.unitSum, UnitCount: v.unitCount,
+		}
+	}
+	if s.percentiles != nil {
+		p.Percentiles = s.percentiles.Payload()
+	}
+	if s.quantile != nil {
+		p.Quantile = s.quantile.Payload()
+	}
+	if s.cardinality != nil {
+		p.Cardinality = s.cardinality.Payload()
+	}
+	if s.frequency != nil {
+		p.Frequency = s.frequency.Payload()
+	}
+	return p
+}
+
+func (p partialStats) restore() (*FeatureStats, error) {
+	s := &FeatureStats{
+		count: p.Count, nullCount: p.NullCount, missingCount: p.MissingCount, typeMismatchCount: p.TypeMismatchCount,
+		valueCount: p.ValueCount, zeroCount: p.ZeroCount,
+		trueCount: p.TrueCount, falseCount: p.FalseCount,
+		mean: p.Mean, m2: p.M2, min: p.Min, max: p.Max,
+		categories:  p.Categories,
+		sampledOut:  p.SampledOut,
+		stringCount: p.StringCount, lengthSum: p.LengthSum, lengthMax: p.LengthMax, patternMatches: p.PatternMatches,
+	}
+	if p.SamplesSeen > 0 {
+		s.samples = &valueSamples{values: p.Samples, seen: p.SamplesSeen}
+	}
+	if e := p.Exemplars; e != nil {
+		s.exemplars = &exemplarSet{
+			values: valueSamples{values: e.Values, seen: e.ValuesSeen}, nulls: valueSamples{values: e.Nulls, seen: e.NullsSeen},
+			min: e.Min, max: e.Max,
+		}
+	}
+	if v := p.Vector; v != nil {
+		s.vector = &vectorStats{
+			values: v.Values, dimensionMismatches: v.DimensionMismatches, elements: v.Elements, nonFinite: v.NonFinite, wellFormed: v.WellFormed,
+			dimensions: v.Dimensions, normSum: v.NormSum, normSumSq: v.NormSumSq, sum: v.Sum, unitSum: v.UnitSum, unitCount: v.UnitCount,
+		}
+	}
+	var err error
+	if p.Percentiles != nil {
+		if s.percentiles, err = sketch.QuantileFromPayload(p.Percentiles); err != nil {
+			return nil, err
+		}
+	}
+	if p.Quantile != nil {
+		if s.quantile, err = sketch.QuantileFromPayload(p.Quantile); err != nil {
+			return nil, err
+		}
+	}
+	if p.Cardinality != nil {
+		if s.cardinality, err = sketch.CardinalityFromPayload(p.Cardinality); err != nil {
+			return nil, err
+		}
+	}
+	if p.Frequency != nil {
+		if s.frequency, err = sketch.FrequencyFromPayload(p.Frequency); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
@@ -0,0 +1,219 @@
+package pipeline
+
+import (
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/sanspareilsmyn/featurelens/internal/config"
+	"github.com/sanspareilsmyn/featurelens/internal/message"
+)
+
+// partitionFeature is a feature whose statistics are compared across partitions.
+type partitionFeature struct {
+	name      string
+	field     string
+	topics    []string // Topics the feature is bound to, empty for every topic
+	numerical bool     // Means are compared too
+}
+
+// partitionFeatures returns the features compared across partitions: the configured ones,
+// or by default every feature read from a single message field.
+func partitionFeatures(cfg config.PartitionStatsConfig, features []config.FeatureConfig) []partitionFeature {
+	if !cfg.Enabled {
+		return nil
+	}
+	var compared []partitionFeature
+	for _, f := range features {
+		if f.Pattern != "" || f.Scope == config.ScopeSession {
+			continue
+		}
+		if len(cfg.Features) > 0 && !slices.Contains(cfg.Features, f.Name) {
+			continue
+		}
+		compared = append(compared, partitionFeature{
+			name:      f.Name,
+			field:     f.FieldName(),
+			topics:    f.Topics,
+			numerical: f.MetricType == config.MetricTypeNumerical,
+		})
+	}
+	return compared
+}
+
+// partitionCounts are a feature's statistics over one partition's messages in a window.
+// Fields are exported to be encoded in partials.
+type partitionCounts struct {
+	Messages   int64
+	Nulls      int64 // Messages where the field is explicitly null, like a feature's null rate
+	Values     int64 // Finite numbers summed, for numerical features
+	Sum, SumSq float64
+}
+
+func (p *partitionCounts) nullRate() float64 {
+	return float64(p.Nulls) / float64(p.Messages)
+}
+
+func (p *partitionCounts) mean() float64 {
+	return p.Sum / float64(p.Values)
+}
+
+// stddev returns the population standard deviation of the values, 0 for fewer than two.
+func (p *partitionCounts) stddev() float64 {
+	if p.Values < 2 {
+		return 0
+	}
+	m := p.mean()
+	return math.Sqrt(max(p.SumSq/float64(p.Values)-m*m, 0))
+}
+
+func (p *partitionCounts) merge(other *partitionCounts) {
+	p.Messages += other.Messages
+	p.Nulls += other.Nulls
+	p.Values += other.Values
+	p.Sum += other.Sum
+	p.SumSq += other.SumSq
+}
+
+// observePartition counts a message in its partition's statistics of the compared
+// features. Replayed messages have no partition and are not counted.
+func (c *Calculator) observePartition(msg message.DynamicMessage, windowEnd time.Time) {
+	partition, ok := msg[message.PartitionKey].(string)
+	if !ok {
+		return
+	}
+	topic, _, _ := strings.Cut(partition, ":") // Topic names cannot contain ':'
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	windowState := c.getOrCreateWindow(windowEnd)
+	if windowState.partitions == nil {
+		windowState.partitions = make(map[string]map[string]*partitionCounts)
+	}
+	for _, f := range c.partitionFeatures {
+		if len(f.topics) > 0 && !slices.Contains(f.topics, topic) {
+			continue
+		}
+		byPartition := windowState.partitions[f.name]
+		if byPartition == nil {
+			byPartition = make(map[string]*partitionCounts)
+			windowState.partitions[f.name] = byPartition
+		}
+		counts := byPartition[partition]
+		if counts == nil {
+			counts = &partitionCounts{}
+			byPartition[partition] = counts
+		}
+		counts.Messages++
+		v, present := msg[f.field]
+		if v == nil {
+			if present {
+				counts.Nulls++
+			}
+			continue
+		}
+		if f.numerical {
+			if v, ok := msg.GetFloat64(f.field); ok && !math.IsNaN(*v) && !math.IsInf(*v, 0) {
+				counts.Values++
+				counts.Sum += *v
+				counts.SumSq += *v * *v
+			}
+		}
+	}
+}
+
+// median returns the median of values, sorting them in place.
+func median(values []float64) float64 {
+	slices.Sort(values)
+	n := len(values)
+	if n%2 == 1 {
+		return values[n/2]
+	}
+	return (values[n/2-1] + values[n/2]) / 2
+}
+
+// processPartitions compares the statistics of each feature's partitions in a completed
+// window. A partition with at least minMessages messages is reported as a segment of the
+// feature, grouped by partition, when its null rate exceeds nullRateRatio times the median
+// of the other partitions' (at least minNullRate), or its mean is further from the median
+// of theirs than meanDeviation times the median of their standard deviations.
+func (a *Alerter) processPartitions(sugar *zap.SugaredLogger, result ThroughputResult) {
+	cfg := a.partitionCfg
+	if !cfg.Enabled {
+		return
+	}
+	seen := make(map[[2]string]bool)
+	for _, name := range sortedKeys(result.partitions) {
+		f, ok := a.registry.Lookup(name)
+		if !ok {
+			continue
+		}
+		byPartition := result.partitions[name]
+		var compared []string
+		for partition, counts := range byPartition {
+			if counts.Messages >= cfg.MinMessages {
+				compared = append(compared, partition)
+			}
+		}
+		slices.Sort(compared)
+
+		label := a.series.featureLabel(name)
+		for _, partition := range compared {
+			counts := byPartition[partition]
+			a.metrics.partitionNullRate.WithLabelValues(label, partition).Set(counts.nullRate())
+			if counts.Values > 0 {
+				a.metrics.partitionMean.WithLabelValues(label, partition).Set(counts.mean())
+			}
+			seen[[2]string{label, partition}] = true
+		}
+		if len(compared) < 2 {
+			continue
+		}
+
+		for _, partition := range compared {
+			counts := byPartition[partition]
+			var nullRates, means, stddevs []float64
+			for _, other := range compared {
+				if other == partition {
+					continue
+				}
+				o := byPartition[other]
+				nullRates = append(nullRates, o.nullRate())
+				if o.Values > 1 {
+					means = append(means, o.mean())
+					stddevs = append(stddevs, o.stddev())
+				}
+			}
+			segment := Segment{Feature: name, GroupBy: "partition", Group: partition}
+			window := AggregationResult{
+				FeatureName: segmentName(segment),
+				Tenant:      f.Tenant,
+				WindowStart: result.WindowStart,
+				WindowEnd:   result.WindowEnd,
+				Segment:     &segment,
+			}
+			if ratio := counts.nullRate() / max(median(nullRates), cfg.MinNullRate); ratio > cfg.NullRateRatio {
+				a.reportViolation(sugar, f, newViolation(window, "partition_null_rate", ">", ratio, cfg.NullRateRatio))
+			}
+			if cfg.MeanDeviation == nil || counts.Values == 0 || len(means) == 0 {
+				continue
+			}
+			if spread := median(stddevs); spread > 0 {
+				if deviation := math.Abs(counts.mean()-median(means)) / spread; deviation > *cfg.MeanDeviation {
+					a.reportViolation(sugar, f, newViolation(window, "partition_mean_deviation", ">", deviation, *cfg.MeanDeviation))
+				}
+			}
+		}
+	}
+	// Partitions move between instances as the consumer group rebalances
+	for series := range a.partitionSeries {
+		if !seen[series] {
+			a.metrics.partitionNullRate.DeleteLabelValues(series[0], series[1])
+			a.metrics.partitionMean.DeleteLabelValues(series[0], series[1])
+		}
+	}
+	a.partitionSeries = seen
+}
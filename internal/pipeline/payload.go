@@ -0,0 +1,252 @@
+package pipeline
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sanspareilsmyn/featurelens/internal/schema"
+)
+
+// Payload converts the result into its versioned public representation.
+func (r AggregationResult) Payload() schema.AggregationResult {
+	stdDev := math.NaN()
+	if !math.IsNaN(r.Variance) && r.Variance >= 0 {
+		stdDev = math.Sqrt(r.Variance)
+	}
+
+	return schema.AggregationResult{
+		SchemaVersion:     schema.Version,
+		Kind:              schema.KindAggregationResult,
+		EventID:           eventID(schema.KindAggregationResult, r.FeatureName, r.WindowEnd, r.emission()...),
+		FeatureName:       r.FeatureName,
+		ModelVersion:      r.ModelVersion,
+		Tenant:            r.Tenant,
+		WindowStart:       r.WindowStart,
+		WindowEnd:         r.WindowEnd,
+		Count:             r.Count,
+		NullCount:         r.NullCount,
+		NullRate:          schema.OptionalFloat(r.rate(r.NullCount)),
+		MissingCount:      r.MissingCount,
+		MissingRate:       schema.OptionalFloat(r.rate(r.MissingCount)),
+		TypeMismatchCount: r.TypeMismatchCount,
+		TypeMismatchRate:  schema.OptionalFloat(r.rate(r.TypeMismatchCount)),
+		ZeroCount:         r.ZeroCount,
+		ZeroRate:          schema.OptionalFloat(r.zeroRate()),
+		TrueCount:         r.TrueCount,
+		TrueRate:          schema.OptionalFloat(r.booleanRate(r.TrueCount)),
+		FalseCount:        r.FalseCount,
+		FalseRate:         schema.OptionalFloat(r.booleanRate(r.FalseCount)),
+		Mean:              schema.OptionalFloat(r.Mean),
+		Variance:          schema.OptionalFloat(r.Variance),
+		StdDev:            schema.OptionalFloat(stdDev),
+		Categories:        r.Categories,
+		DistinctEstimate:  optionalCount(r.DistinctEstimate),
+		SampledOut:        r.SampledOut,
+		Sketches:          r.Sketches,
+		Text:              r.Text.payload(),
+		Vector:            r.Vector.payload(),
+		Percentiles:       r.Percentiles.payload(),
+		Outliers:          r.Outliers.payload(),
+		Segment:           r.Segment.payload(),
+		Revision:          r.Revision,
+		Late:              r.Late,
+		Custom:            r.Custom,
+		Samples:           r.Samples,
+		Exemplars:         r.Exemplars,
+	}
+}
+
+// optionalCount converts an estimated count, NaN if not estimated.
+func optionalCount(v float64) *uint64 {
+	if math.IsNaN(v) {
+		return nil
+	}
+	n := uint64(v)
+	return &n
+}
+
+// emission returns what tells a re-emitted window or a late bucket apart from the
+// window's first emission in the event ID.
+func (r AggregationResult) emission() []string {
+	switch {
+	case r.Late:
+		return []string{"late"}
+	case r.Revision > 0:
+		return []string{"revision=" + strconv.Itoa(r.Revision)}
+	}
+	return nil
+}
+
+func (s *Segment) payload() *schema.Segment {
+	if s == nil {
+		return nil
+	}
+	return &schema.Segment{Feature: s.Feature, GroupBy: s.GroupBy, Group: s.Group}
+}
+
+func (t *TextStats) payload() *schema.TextStats {
+	if t == nil {
+		return nil
+	}
+	return &schema.TextStats{
+		Values:           t.Values,
+		AvgLength:        t.AvgLength,
+		MaxLength:        t.MaxLength,
+		PatternMatchRate: schema.OptionalFloat(t.PatternMatchRate),
+	}
+}
+
+func (o *OutlierStats) payload() *schema.Outliers {
+	if o == nil {
+		return nil
+	}
+	return &schema.Outliers{Count: o.Count, Rate: o.Rate, Lower: o.Lower, Upper: o.Upper}
+}
+
+func (p *Percentiles) payload() *schema.Percentiles {
+	if p == nil {
+		return nil
+	}
+	return &schema.Percentiles{P50: p.P50, P95: p.P95, P99: p.P99}
+}
+
+func (v *VectorStats) payload() *schema.VectorStats {
+	if v == nil {
+		return nil
+	}
+	return &schema.VectorStats{
+		Values:              v.Values,
+		Dimensions:          v.Dimensions,
+		DimensionMismatches: v.DimensionMismatches,
+		NonFiniteRate:       schema.OptionalFloat(v.NonFiniteRate),
+		NormMean:            schema.OptionalFloat(v.NormMean),
+		NormStdDev:          schema.OptionalFloat(v.NormStdDev),
+		CentroidDistance:    schema.OptionalFloat(v.CentroidDistance),
+	}
+}
+
+// Payload converts the violation into its versioned public representation.
+func (v Violation) Payload() schema.Violation {
+	return schema.Violation{
+		SchemaVersion: schema.Version,
+		Kind:          schema.KindViolation,
+		EventID:       eventID(schema.KindViolation, v.FeatureName, v.WindowEnd, v.CheckType+v.Comparison),
+		FeatureName:   v.FeatureName,
+		ModelVersion:  v.ModelVersion,
+		Tenant:        v.Tenant,
+		CheckType:     v.CheckType,
+		Comparison:    v.Comparison,
+		Actual:        v.Actual,
+		Threshold:     v.Threshold,
+		WindowStart:   v.WindowStart,
+		WindowEnd:     v.WindowEnd,
+		DetectedAt:    v.DetectedAt,
+		Expression:    v.Expression,
+		CausedBy:      v.CausedBy,
+		Explanation:   v.Explanation.payload(),
+		Severity:      v.Severity,
+		Segment:       v.Segment.payload(),
+		Silenced:      v.Silenced,
+		Canary:        v.Canary,
+		Stale:         v.Stale,
+		Samples:       v.Samples,
+		Exemplars:     v.Exemplars,
+		Metadata:      v.Metadata.payload(),
+		SchemaChange:  v.SchemaChange.payload(),
+
+		Acknowledgement: v.Acknowledgement.payload(),
+	}
+}
+
+func (m *FeatureMetadata) payload() *schema.FeatureMetadata {
+	if m == nil {
+		return nil
+	}
+	return &schema.FeatureMetadata{Owner: m.Owner, Team: m.Team, RunbookURL: m.RunbookURL, Description: m.Description}
+}
+
+// payload converts the change, keeping at most maxSchemaChangeFields fields of each list.
+func (c *SchemaChange) payload() *schema.SchemaChange {
+	if c == nil {
+		return nil
+	}
+	p := &schema.SchemaChange{Fingerprint: c.Fingerprint, PreviousFingerprint: c.PreviousFingerprint}
+	for _, f := range c.Added[:min(len(c.Added), maxSchemaChangeFields)] {
+		p.Added = append(p.Added, schema.SchemaField{Field: f.Field, Types: f.Types})
+	}
+	for _, f := range c.Removed[:min(len(c.Removed), maxSchemaChangeFields)] {
+		p.Removed = append(p.Removed, schema.SchemaField{Field: f.Field, Types: f.Types})
+	}
+	for _, f := range c.TypeChanged[:min(len(c.TypeChanged), maxSchemaChangeFields)] {
+		p.TypeChanged = append(p.TypeChanged, schema.SchemaTypeChange{Field: f.Field, From: f.From, To: f.To})
+	}
+	return p
+}
+
+// FiringPayload converts the alert into the public representation of its start, detected
+// at detectedAt.
+func (a Alert) FiringPayload(detectedAt time.Time) schema.AlertFiring {
+	return schema.AlertFiring{
+		SchemaVersion: schema.Version,
+		Kind:          schema.KindAlertFiring,
+		EventID:       eventID(schema.KindAlertFiring, a.FeatureName, a.Since, a.CheckType+a.Comparison),
+		FeatureName:   a.FeatureName,
+		ModelVersion:  a.ModelVersion,
+		Tenant:        a.Tenant,
+		CheckType:     a.CheckType,
+		Comparison:    a.Comparison,
+		Severity:      a.Severity,
+		Actual:        a.Actual,
+		Threshold:     a.Threshold,
+		Silenced:      a.Silenced,
+		FiringSince:   a.Since,
+		DetectedAt:    detectedAt,
+		Metadata:      a.Metadata.payload(),
+	}
+}
+
+// Payload converts the alert into the public representation of its resolution, at
+// resolvedAt, by the healthy window ending at windowEnd.
+func (a Alert) Payload(windowEnd, resolvedAt time.Time) schema.AlertResolved {
+	return schema.AlertResolved{
+		SchemaVersion: schema.Version,
+		Kind:          schema.KindAlertResolved,
+		EventID:       eventID(schema.KindAlertResolved, a.FeatureName, windowEnd, a.CheckType+a.Comparison),
+		FeatureName:   a.FeatureName,
+		ModelVersion:  a.ModelVersion,
+		Tenant:        a.Tenant,
+		CheckType:     a.CheckType,
+		Comparison:    a.Comparison,
+		Severity:      a.Severity,
+		FiringSince:   a.Since,
+		WindowEnd:     windowEnd,
+		ResolvedAt:    resolvedAt,
+		Duration:      a.duration(windowEnd).Seconds(),
+		Metadata:      a.Metadata.payload(),
+	}
+}
+
+// eventID derives a payload's idempotency key from what identifies the event, so that
+// emitting it again yields the same key.
+func eventID(kind, featureName string, windowEnd time.Time, check ...string) string {
+	return strings.Join(append([]string{kind, featureName, windowEnd.UTC().Format(time.RFC3339Nano)}, check...), "|")
+}
+
+func (e *Explanation) payload() *schema.Explanation {
+	if e == nil {
+		return nil
+	}
+	p := &schema.Explanation{
+		BaselineWindowStart: e.BaselineWindowStart,
+		BaselineWindowEnd:   e.BaselineWindowEnd,
+	}
+	for _, d := range e.Deltas {
+		p.Deltas = append(p.Deltas, schema.StatDelta{Stat: d.Stat, Before: d.Before, After: d.After, Delta: d.After - d.Before})
+	}
+	for _, c := range e.CategoryChanges {
+		p.CategoryChanges = append(p.CategoryChanges, schema.CategoryChange{Value: c.Value, BeforeShare: c.BeforeShare, AfterShare: c.AfterShare})
+	}
+	return p
+}
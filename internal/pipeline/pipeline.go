@@ -5,102 +5,615 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"os"
+	"slices"
+	"strconv"
 	"sync"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"go.uber.org/zap"
 
+	"github.com/sanspareilsmyn/featurelens/internal/audit"
 	"github.com/sanspareilsmyn/featurelens/internal/config"
 	"github.com/sanspareilsmyn/featurelens/internal/message"
+	"github.com/sanspareilsmyn/featurelens/internal/signing"
+	"github.com/sanspareilsmyn/featurelens/internal/store"
 )
 
 // Pipeline orchestrates the different stages: consumer, parsing, calculation, alerting.
 type Pipeline struct {
 	cfg        *config.Config
-	consumer   *Consumer
+	consumer   *Consumer // nil when replaying messages
+	replay     source    // nil unless replaying messages in place of the consumer
 	calculator *Calculator
+	sampler    *AdaptiveSampler
 	alerter    *Alerter
+	controls   *Controls
+	metrics    *Metrics
+	reporter   *ErrorReporter
 	logger     *zap.Logger
 
-	rawMessages    chan []byte
-	parsedMessages chan message.DynamicMessage
-	aggResults     chan AggregationResult
+	parse           parseFunc
+	stampTopics     bool        // Record the topic of consumed messages, for features bound to topics
+	stampPartitions bool        // Record the partition of consumed messages, for partition statistics
+	batches         *batchTimes // When parsed batches were sent to the calculator, nil unless timed
+	rawMessages     chan []rawMessage
+	parsedMessages  chan []message.DynamicMessage
+	aggResults      chan AggregationResult
+	graph           *stageGraph // Stages of pipeline.graph, nil without any
+
+	lag        *LagMonitor    // nil when replaying messages
+	lagResults chan LagResult // nil when replaying messages
+
+	latencyResults     chan LatencyResult     // nil unless end-to-end latency is measured
+	throughputResults  chan ThroughputResult  // nil unless throughput is checked
+	correlationResults chan CorrelationResult // nil unless correlations are configured
+
+	// Training/serving skew comparison, nil when disabled
+	skew              *SkewMonitor
+	referenceConsumer *Consumer // nil when comparing against a baseline snapshot
+	rawReference      chan []rawMessage
+	servingSamples    chan []message.DynamicMessage
+	referenceMessages chan []message.DynamicMessage
+	skewResults       chan SkewResult
+
+	// Horizontal scaling, nil unless scaled out
+	partials      chan []byte
+	publisher     *PartialPublisher
+	merger        *WindowMerger // nil unless this instance merges partials
+	mergedWindows chan *windowInfo
+
+	remote  *RemoteWriter   // nil when remote write is disabled
+	results *store.Store    // nil when the results store is disabled
+	recent  *RecentWindows  // Every feature's last windows
+	sinks   *SinkDispatcher // nil when no sinks are configured
+	trail   *audit.Trail    // nil when the audit trail is disabled
+
+	actions *ActionDispatcher // nil when no actions are configured
+
+	stats *processingStats // Counts for the processing summary, nil unless log.summaryInterval is set
 }
 
-// New creates and wires up a new monitoring pipeline.
-func New(cfg *config.Config, logger *zap.Logger) (*Pipeline, error) {
+// referenceGroupSuffix gives the reference topic consumer its own consumer group.
+const referenceGroupSuffix = "-reference"
+
+// New creates and wires up a new monitoring pipeline, registering its Prometheus metrics
+// on reg (prometheus.DefaultRegisterer for the /metrics endpoint); see NewMetrics.
+func New(cfg *config.Config, reg prometheus.Registerer, logger *zap.Logger) (*Pipeline, error) {
+	return newPipeline(cfg, nil, reg, logger)
+}
+
+// NewReplay creates a pipeline that reads the messages of a file instead of the
+// configured topic, then drains and stops. Windows are still processing-time aligned,
+// so the replayed messages land in the current windows.
+func NewReplay(cfg *config.Config, path string, reg prometheus.Registerer, logger *zap.Logger) (*Pipeline, error) {
+	return newPipeline(cfg, func(output chan<- []rawMessage) (source, error) {
+		return NewFileSource(cfg.Pipeline, path, output, logger.Named("replay"))
+	}, reg, logger)
+}
+
+// NewMemoryReplay creates a pipeline that processes the given messages, one payload each,
+// instead of the configured topic, then drains and stops. With pipeline.eventTime enabled
+// the messages' timestamps alone decide their windows, so results do not depend on when
+// the replay runs.
+func NewMemoryReplay(cfg *config.Config, messages [][]byte, reg prometheus.Registerer, logger *zap.Logger) (*Pipeline, error) {
+	return newPipeline(cfg, func(output chan<- []rawMessage) (source, error) {
+		return NewMemorySource(cfg.Pipeline, messages, output, logger.Named("replay")), nil
+	}, reg, logger)
+}
+
+// NewBatch creates a pipeline that consumes the configured topic up to its end, then
+// drains and stops: up to the high watermarks resolved when it starts or, with a non-zero
+// until, up to the first messages at or after it. Offsets are committed as in any drain,
+// so the next batch run starts where this one stopped. The consumer must be the only
+// member of its consumer group, or the partitions assigned to others are never caught up.
+func NewBatch(cfg *config.Config, until time.Time, reg prometheus.Registerer, logger *zap.Logger) (*Pipeline, error) {
+	p, err := newPipeline(cfg, nil, reg, logger)
+	if err != nil {
+		return nil, err
+	}
+	p.consumer.stopAtEnd(until)
+	return p, nil
+}
+
+// batchBufferSize returns the capacity of the channels carrying message batches: about
+// as many messages as the other channels hold, in at least a few batches so that stages
+// keep working while the next one fills.
+func batchBufferSize(cfg config.BatchConfig) int {
+	const channelBufferSize = 100
+	return max(channelBufferSize/cfg.Size, 4)
+}
+
+func newPipeline(cfg *config.Config, newSource newSourceFunc, reg prometheus.Registerer, logger *zap.Logger) (*Pipeline, error) {
 	initLogger := logger.Named("pipeline.init")
 	initLogger.Debug("Creating pipeline components...")
 
+	if err := validateExtensions(cfg.Features, logger.Named("extensions")); err != nil {
+		initLogger.Error("Invalid custom metrics or checks", zap.Error(err))
+		return nil, err
+	}
+
+	metrics, err := NewMetrics(reg)
+	if err != nil {
+		initLogger.Error("Failed to register metrics", zap.Error(err))
+		return nil, err
+	}
+
+	reporter := NewErrorReporter(cfg.Errors, metrics)
+
 	// Create Channels
 	const channelBufferSize = 100
-	rawMessages := make(chan []byte, channelBufferSize)
-	parsedMessages := make(chan message.DynamicMessage, channelBufferSize)
+	rawMessages := make(chan []rawMessage, batchBufferSize(cfg.Pipeline.Batch))
+	parsedMessages := make(chan []message.DynamicMessage, batchBufferSize(cfg.Pipeline.Batch))
 	aggResults := make(chan AggregationResult, channelBufferSize)
 	initLogger.Debug("Channels created", zap.Int("bufferSize", channelBufferSize))
 
 	// Initialize Components
-	consumerLogger := logger.Named("consumer")
-	consumerInstance, err := NewConsumer(cfg.Kafka, rawMessages, consumerLogger)
-	if err != nil {
-		initLogger.Error("Failed to create consumer", zap.Error(err))
-		return nil, fmt.Errorf("%w: %w", ErrConsumerCreationFailed, err) // Use specific error
+	var consumerInstance *Consumer
+	var replay source
+	if newSource != nil {
+		replay, err = newSource(rawMessages)
+		if err != nil {
+			initLogger.Error("Failed to create replay source", zap.Error(err))
+			return nil, err
+		}
+		initLogger.Debug("Replay source created")
+	} else {
+		consumerLogger := logger.Named("consumer")
+		consumerInstance, err = NewConsumer(cfg.Kafka, cfg.Pipeline.Batch, rawMessages, consumerLogger)
+		if err != nil {
+			initLogger.Error("Failed to create consumer", zap.Error(err))
+			return nil, fmt.Errorf("%w: %w", ErrConsumerCreationFailed, err) // Use specific error
+		}
+		initLogger.Debug("Consumer created")
+	}
+
+	registry := NewFeatureRegistry(cfg.Features, cfg.Pipeline.MaxDiscoveredFeatures, logger.Named("registry"))
+	series := newSeriesLimiter(cfg.Pipeline.MaxFeatureSeries, cfg.Pipeline.MaxGroupSeries, metrics, logger.Named("series"))
+	if cfg.Pipeline.InitializeSeries {
+		series.initialize(registry.Features())
+	}
+	sampler := NewAdaptiveSampler(cfg.Features, cfg.Pipeline.LoadShedding, series, logger.Named("sampler"))
+	// Alerts are re-raised every window (or lag poll) while they persist
+	alertTTL := 2 * max(longestWindow(cfg.Pipeline, cfg.Features), cfg.Kafka.Lag.Interval)
+	controls := NewControls(registry, cfg.MaintenanceWindows, alertTTL, logger.Named("controls"))
+
+	p := &Pipeline{
+		cfg:             cfg,
+		consumer:        consumerInstance,
+		replay:          replay,
+		controls:        controls,
+		sampler:         sampler,
+		metrics:         metrics,
+		reporter:        reporter,
+		recent:          NewRecentWindows(cfg.Pipeline.HistoryWindows),
+		logger:          logger.Named("pipeline"),
+		rawMessages:     rawMessages,
+		parsedMessages:  parsedMessages,
+		aggResults:      aggResults,
+		parse:           newParseFunc(cfg, cfg.Pipeline.PartialParsing, metrics, logger.Named("parser")),
+		stampTopics:     slices.ContainsFunc(cfg.Features, func(f config.FeatureConfig) bool { return len(f.Topics) > 0 }),
+		stampPartitions: cfg.Pipeline.PartitionStats.Enabled,
+		batches:         newBatchTimes(),
+	}
+	if cfg.Log.SummaryInterval > 0 {
+		p.stats = newProcessingStats()
+	}
+	if consumerInstance != nil {
+		p.lagResults = make(chan LagResult, channelBufferSize)
+		p.lag = NewLagMonitor(cfg.Kafka, consumerInstance, p.lagResults, logger.Named("lag"))
+	}
+	if cfg.Skew.Enabled {
+		if err := p.initSkew(registry, sampler, logger); err != nil {
+			initLogger.Error("Failed to create skew monitor", zap.Error(err))
+			return nil, err
+		}
+		initLogger.Debug("Skew monitor created")
 	}
-	initLogger.Debug("Consumer created")
 
 	calculatorLogger := logger.Named("calculator")
-	calculatorInstance := NewCalculator(cfg.Pipeline, cfg.Features, parsedMessages, aggResults, calculatorLogger)
+	if cfg.Pipeline.Latency.TimestampField != "" {
+		p.latencyResults = make(chan LatencyResult, channelBufferSize)
+	}
+	if throughputChecked(cfg.Pipeline.Throughput) || noDataChecked(cfg) || cfg.Pipeline.SchemaTracking.Enabled || cfg.Pipeline.PartitionStats.Enabled {
+		p.throughputResults = make(chan ThroughputResult, channelBufferSize)
+	}
+	if len(cfg.Pipeline.Correlations) > 0 {
+		p.correlationResults = make(chan CorrelationResult, channelBufferSize)
+	}
+	calculatorInstance := NewCalculator(cfg.Pipeline, registry, parsedMessages, aggResults, p.latencyResults, p.throughputResults, p.correlationResults, sampler, metrics, calculatorLogger)
+	calculatorInstance.batches = p.batches
+	calculatorInstance.stats = p.stats
+	p.graph = newStageGraph(cfg, registry, aggResults, sampler, metrics, logger.Named("graph"))
+	if p.graph != nil && len(p.graph.calculators()) > 0 {
+		calculatorInstance.restrict(func(f config.FeatureConfig) bool { return !p.graph.claims(f) })
+		for _, s := range p.graph.calculators() {
+			s.calculator.stats = p.stats
+		}
+	}
+	if cfg.Pipeline.CalculatorWorkers > 1 {
+		calculatorInstance.shard(cfg.Pipeline.CalculatorWorkers)
+	}
 	initLogger.Debug("Calculator created")
+	spill, err := newStateSpiller(cfg.Pipeline.WindowState, metrics, logger.Named("window-state"))
+	if err != nil {
+		initLogger.Error("Failed to prepare window state spilling", zap.Error(err))
+		return nil, err
+	}
+	if spill != nil {
+		spill.reporter = reporter
+		calculatorInstance.boundState(spill)
+	}
+	if p.servingSamples == nil && p.graph == nil {
+		// Parsed messages are shared with the skew monitor and graph stages, which may still be reading them
+		calculatorInstance.recycleMessages()
+	}
+	if cfg.Pipeline.Scaling.Enabled && consumerInstance != nil {
+		p.initScaling(calculatorInstance, registry, logger)
+		initLogger.Debug("Scaled out", zap.Bool("merger", p.merger != nil))
+	}
+
+	var signer signing.Signer
+	if cfg.Signing.Enabled {
+		signer, err = signing.NewSigner(cfg.Signing)
+		if err != nil {
+			initLogger.Error("Failed to create signer", zap.Error(err))
+			return nil, fmt.Errorf("%w: %w", ErrSignerCreationFailed, err)
+		}
+		initLogger.Debug("Signer created", zap.String("algorithm", signer.Algorithm()))
+	}
+
+	if cfg.RemoteWrite.Enabled {
+		p.remote, err = NewRemoteWriter(cfg.RemoteWrite, metrics, logger.Named("remote-write"))
+		if err != nil {
+			initLogger.Error("Failed to create remote writer", zap.Error(err))
+			return nil, err
+		}
+		p.remote.reporter = reporter
+		initLogger.Debug("Remote writer created")
+	}
+
+	if cfg.Store.Enabled {
+		p.results, err = store.Open(cfg.Store.Path, cfg.Store.Retention, logger.Named("store"))
+		if err != nil {
+			initLogger.Error("Failed to open results store", zap.Error(err))
+			return nil, err
+		}
+		initLogger.Debug("Results store opened")
+	}
+
+	if len(cfg.Sinks.Outputs) > 0 {
+		p.sinks, err = NewSinkDispatcher(cfg.Sinks, metrics, logger.Named("sinks"))
+		if err != nil {
+			initLogger.Error("Failed to create sinks", zap.Error(err))
+			return nil, err
+		}
+		p.sinks.reportErrors(reporter)
+		p.sinks.seal(signer)
+		initLogger.Debug("Sink dispatcher created")
+	}
+
+	if len(cfg.Actions.Triggers) > 0 {
+		p.actions, err = NewActionDispatcher(cfg.Actions, metrics, logger.Named("actions"))
+		if err != nil {
+			initLogger.Error("Failed to create actions", zap.Error(err))
+			return nil, err
+		}
+		p.actions.reporter = reporter
+		initLogger.Debug("Action dispatcher created")
+	}
+
+	if cfg.Audit.Enabled {
+		p.trail, err = audit.Open(cfg.Audit, signer, logger.Named("audit"))
+		if err != nil {
+			initLogger.Error("Failed to open audit trail", zap.Error(err))
+			return nil, err
+		}
+		initLogger.Debug("Audit trail opened")
+	}
+
+	if p.results != nil {
+		p.archiveRemovedFeatures(registry)
+	}
 
 	alerterLogger := logger.Named("alerter")
-	alerterInstance := NewAlerter(cfg.Features, aggResults, alerterLogger)
+	alerterInstance := NewAlerter(registry, aggResults, AlerterOptions{
+		Skew:          p.skewResults,
+		Lag:           p.lagResults,
+		Latency:       p.latencyResults,
+		Correlations:  p.correlationResults,
+		LatencyCfg:    cfg.Pipeline.Latency,
+		Throughput:    p.throughputResults,
+		ThroughputCfg: cfg.Pipeline.Throughput,
+		SchemaCfg:     cfg.Pipeline.SchemaTracking,
+		PartitionCfg:  cfg.Pipeline.PartitionStats,
+		Topic:         cfg.Kafka.Subscription(),
+		LagThreshold:  cfg.Kafka.Lag.Threshold,
+		Composites:    cfg.CompositeMetrics,
+		Signer:        signer,
+		Remote:        p.remote,
+		Results:       p.results,
+		Recent:        p.recent,
+		Sinks:         p.sinks,
+		Routes:        cfg.Sinks.Routes,
+		Actions:       p.actions,
+		Trail:         p.trail,
+		Sampler:       sampler,
+		Controls:      controls,
+		Series:        series,
+		Rollups:       newRollups(cfg.Pipeline.Rollups, cfg.Pipeline.WindowAlignment),
+		Metrics:       metrics,
+		Errors:        reporter,
+		Samples:       cfg.Pipeline.ValueSamples.InViolations,
+		MaxNotifyAge:  cfg.Sinks.MaxNotifyAge,
+	}, alerterLogger)
+	alerterInstance.stats = p.stats
 	initLogger.Debug("Alerter created")
 
-	// Create Pipeline
-	p := &Pipeline{
-		cfg:            cfg,
-		consumer:       consumerInstance,
-		calculator:     calculatorInstance,
-		alerter:        alerterInstance,
-		logger:         logger.Named("pipeline"),
-		rawMessages:    rawMessages,
-		parsedMessages: parsedMessages,
-		aggResults:     aggResults,
-	}
+	p.calculator = calculatorInstance
+	p.alerter = alerterInstance
+	p.registerPipelineGauges()
 
 	initLogger.Info("Pipeline instance created successfully")
 	return p, nil
 }
 
+// initSkew creates the skew monitor and, when comparing against a topic, the reference consumer.
+func (p *Pipeline) initSkew(registry *FeatureRegistry, sampler *AdaptiveSampler, logger *zap.Logger) error {
+	const channelBufferSize = 100
+	p.servingSamples = make(chan []message.DynamicMessage, batchBufferSize(p.cfg.Pipeline.Batch))
+	p.skewResults = make(chan SkewResult, channelBufferSize)
+
+	if topic := p.cfg.Skew.ReferenceTopic; topic != "" {
+		kafkaCfg := p.cfg.Kafka
+		kafkaCfg.Topic, kafkaCfg.TopicPattern, kafkaCfg.Partitions = topic, "", nil
+		kafkaCfg.GroupID += referenceGroupSuffix
+		kafkaCfg.StartOffset = "" // Seeks only apply to the monitored topics
+		p.rawReference = make(chan []rawMessage, batchBufferSize(p.cfg.Pipeline.Batch))
+		p.referenceMessages = make(chan []message.DynamicMessage, batchBufferSize(p.cfg.Pipeline.Batch))
+
+		consumer, err := NewConsumer(kafkaCfg, p.cfg.Pipeline.Batch, p.rawReference, logger.Named("reference-consumer"))
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrConsumerCreationFailed, err)
+		}
+		p.referenceConsumer = consumer
+	}
+
+	skew, err := NewSkewMonitor(p.cfg.Skew, p.cfg.Pipeline.WindowSize, p.cfg.Pipeline.WindowAlignment, p.cfg.Pipeline.TenantField, registry, p.servingSamples, p.referenceMessages, p.skewResults, sampler, logger.Named("skew"))
+	if err != nil {
+		return err
+	}
+	p.skew = skew
+	return nil
+}
+
+// initScaling makes the calculator publish partial windows and, on the merger, evaluate
+// the windows merged from every instance's partials.
+func (p *Pipeline) initScaling(calculator *Calculator, registry *FeatureRegistry, logger *zap.Logger) {
+	const channelBufferSize = 100
+	cfg := p.cfg.Pipeline.Scaling
+	instance := cfg.InstanceID
+	if instance == "" {
+		instance, _ = os.Hostname()
+	}
+	p.partials = make(chan []byte, channelBufferSize)
+	p.publisher = NewPartialPublisher(p.cfg.Kafka, cfg, p.partials, p.metrics, logger.Named("partials"))
+	p.publisher.reporter = p.reporter
+	if cfg.Merger {
+		p.mergedWindows = make(chan *windowInfo, channelBufferSize)
+		p.merger = NewWindowMerger(p.cfg.Kafka, cfg, p.cfg.Pipeline.WindowSize, registry, p.mergedWindows, p.metrics, logger.Named("merger"))
+	}
+	calculator.scaleOut(instance, p.partials, p.mergedWindows)
+}
+
+// Seek moves the consumer group of the monitored topics to target, returning the offsets
+// consumption resumes from by topic and partition. Messages already consumed are still processed,
+// and replayed ones land in the current windows.
+func (p *Pipeline) Seek(ctx context.Context, target config.SeekTarget) (Offsets, error) {
+	if p.consumer == nil {
+		return nil, ErrSeekUnavailable
+	}
+	return p.consumer.Seek(ctx, target)
+}
+
+// Pause stops the consumer of the monitored topics from handing messages downstream,
+// until Resume; see Consumer.Pause.
+func (p *Pipeline) Pause() error {
+	if p.consumer == nil {
+		return ErrPauseUnavailable
+	}
+	p.consumer.Pause()
+	return nil
+}
+
+// Resume resumes the consumer of the monitored topics after Pause.
+func (p *Pipeline) Resume() error {
+	if p.consumer == nil {
+		return ErrPauseUnavailable
+	}
+	p.consumer.Resume()
+	return nil
+}
+
+// Paused reports whether the consumer of the monitored topics is paused.
+func (p *Pipeline) Paused() bool {
+	return p.consumer != nil && p.consumer.Paused()
+}
+
+// Summary returns the windows evaluated and violations raised since the pipeline started.
+func (p *Pipeline) Summary() *RunSummary {
+	return p.alerter.summary
+}
+
+// Controls returns the runtime alerting controls shared with the admin API.
+func (p *Pipeline) Controls() *Controls {
+	return p.controls
+}
+
+// RecentWindows returns every feature's last windows.
+func (p *Pipeline) RecentWindows() *RecentWindows {
+	return p.recent
+}
+
+// Results returns the results store backing the time-travel view, or nil when disabled.
+func (p *Pipeline) Results() *store.Store {
+	return p.results
+}
+
+// UseClock makes windowing and alerting tell time by clock instead of the system clock:
+// the processing-time window of each message, the calculator's window ticks, and when
+// violations are detected, alerts resolve or expire and silences end. It must be called
+// before Run. Sinks, consumer lag and skew windows keep the system clock.
+func (p *Pipeline) UseClock(clock Clock) {
+	p.calculator.clock = clock
+	if p.graph != nil {
+		for _, s := range p.graph.calculators() {
+			s.calculator.clock = clock
+		}
+	}
+	p.alerter.clock = clock
+	p.controls.useClock(clock)
+}
+
 // Run starts all pipeline components and waits for them to complete or context cancellation.
+//
+// Cancelling ctx, a component failing, or all replayed messages being read (for a batch
+// run, the topic consumed up to its end) starts a drain: consumers stop fetching,
+// messages already fetched are parsed, every open window is flushed and its results
+// alerted on and delivered, and only then are consumer offsets committed. If the drain
+// exceeds the configured shutdown timeout, Run returns ErrDrainTimeout without
+// committing, so the next run re-reads the undrained messages.
 func (p *Pipeline) Run(ctx context.Context) error {
 	sugar := p.logger.Sugar()
 	var wg sync.WaitGroup
-	pipelineErr := make(chan error, 4) // consumer, parser, calculator, alerter
+	pipelineErr := make(chan error, 10) // consumers, parsers, calculator, alerter, skew monitor, remote writer, merger, secret refresher
+
+	// fetchCtx stops the consumers; drainCtx stops everything else at the drain deadline.
+	fetchCtx, stopFetching := context.WithCancel(ctx)
+	defer stopFetching()
+	drainCtx, abort := context.WithCancel(context.WithoutCancel(ctx))
+	defer abort()
 
 	sugar.Info("Pipeline Run: Starting components...")
 
 	// Start components as goroutines
+	var exhausted chan struct{} // Closed once the replayed messages were read or a batch run's topic consumed; nil otherwise
+	if p.replay != nil {
+		exhausted = make(chan struct{})
+		wg.Add(1)
+		go p.runReplay(fetchCtx, &wg, pipelineErr, exhausted)
+	} else {
+		if p.consumer.bounded {
+			exhausted = make(chan struct{})
+		}
+		wg.Add(2)
+		go p.runConsumer(fetchCtx, &wg, pipelineErr, p.consumer, p.rawMessages, exhausted)
+		go p.runLagMonitor(fetchCtx, &wg)
+	}
 	wg.Add(4)
-	go p.runConsumer(ctx, &wg, pipelineErr)
-	go p.runParser(ctx, &wg)
-	go p.runCalculator(ctx, &wg, pipelineErr)
-	go p.runAlerter(ctx, &wg, pipelineErr)
+	go p.runResourceMonitor(fetchCtx, &wg)
+	if p.stats != nil {
+		wg.Add(1)
+		go p.runProcessingSummary(fetchCtx, &wg)
+	}
+	parsed := []chan []message.DynamicMessage{p.parsedMessages, p.servingSamples}
+	if p.graph != nil {
+		parsed = append(parsed, p.graph.sources...)
+		for _, s := range p.graph.stages {
+			if s.process != nil {
+				wg.Add(1)
+				go p.runGraphStage(drainCtx, &wg, s)
+			}
+		}
+	}
+	go p.runParser(drainCtx, &wg, p.rawMessages, parsed...)
+	go p.runCalculator(drainCtx, &wg, pipelineErr)
+	go p.runAlerter(drainCtx, &wg, pipelineErr)
+
+	if p.skew != nil {
+		wg.Add(1)
+		go p.runSkewMonitor(drainCtx, &wg, pipelineErr)
+	}
+	if p.remote != nil {
+		wg.Add(1)
+		go p.runRemoteWriter(drainCtx, &wg)
+	}
+	if p.sinks != nil {
+		wg.Add(1)
+		go p.runSinkDispatcher(drainCtx, &wg)
+	}
+	if p.actions != nil {
+		wg.Add(1)
+		go p.runActionDispatcher(drainCtx, &wg)
+	}
+	if p.publisher != nil {
+		wg.Add(1)
+		go p.runPartialPublisher(drainCtx, &wg)
+	}
+	if p.merger != nil {
+		wg.Add(1)
+		go p.runWindowMerger(fetchCtx, drainCtx, &wg, pipelineErr)
+	}
+	if p.referenceConsumer != nil {
+		wg.Add(2)
+		go p.runConsumer(fetchCtx, &wg, pipelineErr, p.referenceConsumer, p.rawReference, nil)
+		go p.runParser(drainCtx, &wg, p.rawReference, p.referenceMessages)
+	}
+	if p.replay == nil && len(p.cfg.SecretReferences) > 0 && p.cfg.Secrets.RefreshInterval > 0 {
+		wg.Add(1)
+		go p.runSecretRefresher(fetchCtx, &wg, pipelineErr)
+	}
 
 	// Wait for context cancellation or the first error from any component
 	var firstErr error
 	select {
 	case <-ctx.Done():
-		sugar.Info("Pipeline Run: Context cancelled. Waiting for components to finish...")
+		sugar.Info("Pipeline Run: Context cancelled. Draining components...")
 		firstErr = ctx.Err()
 	case err := <-pipelineErr:
 		sugar.Errorw("Pipeline Run: Received error from a component, initiating shutdown...", zap.Error(err))
 		firstErr = err
+	case <-exhausted:
+		sugar.Info("Pipeline Run: All input consumed. Draining components...")
 	}
+	stopFetching()
+
+	timeout := p.cfg.Pipeline.ShutdownTimeout
+	deadline := time.AfterFunc(timeout, abort)
+	defer deadline.Stop()
+	defer p.closeConsumers()
 
 	// Wait for all component goroutines to complete their shutdown sequence
-	sugar.Debug("Pipeline Run: Waiting on WaitGroup...")
-	wg.Wait()
-	sugar.Info("Pipeline Run: All components finished.")
+	sugar.Debugw("Pipeline Run: Waiting on WaitGroup...", zap.Duration("shutdown_timeout", timeout))
+	drained := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+		sugar.Info("Pipeline Run: All components finished.")
+		if p.stats != nil {
+			p.logProcessingSummary() // What was processed since the last one, drain included
+		}
+	case <-drainCtx.Done():
+		sugar.Errorw("Pipeline Run: Shutdown timeout exceeded, exiting without committing offsets",
+			zap.Duration("shutdown_timeout", timeout),
+		)
+		p.reporter.Report(&OpError{Component: ComponentPipeline, Op: "drain", Severity: ErrorSeverityCritical, Retryable: true, Err: ErrDrainTimeout})
+		return ErrDrainTimeout
+	}
+
+	// Every message handed downstream has been processed and its windows emitted, so
+	// offsets are committed even when the drain was started by a component failure.
+	if err := p.commitOffsets(drainCtx); err != nil {
+		sugar.Errorw("Pipeline Run: Failed to commit consumer offsets", zap.Error(err))
+		p.reporter.Report(&OpError{Component: ComponentConsumer, Op: "commit", Severity: ErrorSeverityError, Retryable: true, Err: err})
+		if firstErr == nil || errors.Is(firstErr, context.Canceled) {
+			firstErr = err
+		}
+	}
 
 	if firstErr != nil && !errors.Is(firstErr, context.Canceled) {
 		return firstErr
@@ -108,58 +621,167 @@ func (p *Pipeline) Run(ctx context.Context) error {
 	return nil
 }
 
-// runConsumer executes the consumer component logic in a goroutine.
-func (p *Pipeline) runConsumer(ctx context.Context, wg *sync.WaitGroup, errCh chan<- error) {
+// commitOffsets commits the offsets of every consumer once the pipeline has drained.
+func (p *Pipeline) commitOffsets(ctx context.Context) error {
+	var consumers []*Consumer
+	if p.consumer != nil {
+		consumers = append(consumers, p.consumer)
+	}
+	if p.referenceConsumer != nil {
+		consumers = append(consumers, p.referenceConsumer)
+	}
+	var errs []error
+	for _, consumer := range consumers {
+		if err := consumer.Commit(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// closeConsumers closes the Kafka readers after offsets are committed.
+func (p *Pipeline) closeConsumers() {
+	if p.consumer != nil {
+		if err := p.consumer.Close(); err != nil {
+			p.logger.Error("Failed to close Kafka consumer cleanly", zap.Error(err))
+		}
+	}
+	if p.referenceConsumer != nil {
+		if err := p.referenceConsumer.Close(); err != nil {
+			p.logger.Error("Failed to close reference Kafka consumer cleanly", zap.Error(err))
+		}
+	}
+}
+
+// reportFailure reports the failure of a component, which stops the pipeline.
+func (p *Pipeline) reportFailure(component Component, err error) {
+	p.reporter.Report(&OpError{Component: component, Op: "run", Severity: ErrorSeverityCritical, Err: err})
+}
+
+// runConsumer executes a consumer's logic in a goroutine, closing its output when done
+// and, if not nil, done once a consumer stopping at the end of the topic caught up.
+func (p *Pipeline) runConsumer(ctx context.Context, wg *sync.WaitGroup, errCh chan<- error, consumer *Consumer, output chan []rawMessage, done chan<- struct{}) {
 	defer wg.Done()
 	defer func() {
-		close(p.rawMessages)
+		close(output)
 		p.logger.Debug("Raw messages channel closed")
 	}()
 
 	p.logger.Debug("Starting consumer goroutine...")
-	if err := p.consumer.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
+	if err := consumer.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
 		p.logger.Error("Consumer component exited with error", zap.Error(err))
+		p.reportFailure(ComponentConsumer, err)
 		errCh <- fmt.Errorf("%w: %w", ErrConsumerRunFailed, err)
 	} else if err == nil {
 		p.logger.Debug("Consumer goroutine finished normally")
+		if done != nil {
+			close(done)
+		}
 	} else {
 		p.logger.Debug("Consumer goroutine cancelled gracefully")
 	}
 }
 
-// runParser executes the parsing logic in a goroutine.
-func (p *Pipeline) runParser(ctx context.Context, wg *sync.WaitGroup) {
+// runReplay replays the messages in a goroutine, closing the raw messages channel and then
+// done once all were handed downstream.
+func (p *Pipeline) runReplay(ctx context.Context, wg *sync.WaitGroup, errCh chan<- error, done chan<- struct{}) {
+	defer wg.Done()
+	defer close(p.rawMessages)
+
+	p.logger.Debug("Starting replay goroutine...")
+	switch err := p.replay.Run(ctx); {
+	case err == nil:
+		p.logger.Debug("Replay goroutine finished normally")
+		close(done)
+	case errors.Is(err, context.Canceled):
+		p.logger.Debug("Replay goroutine cancelled gracefully")
+	default:
+		p.logger.Error("Replay component exited with error", zap.Error(err))
+		p.reportFailure(ComponentConsumer, err)
+		errCh <- err
+	}
+}
+
+// runParser executes the parsing logic in a goroutine, sending the parsed messages of
+// every raw batch to each non-nil output, as one batch, and closing them when done.
+// Batches are decoded by a pool of parser workers but leave in the order they were
+// consumed. Outputs share the batch, which receivers must not modify.
+func (p *Pipeline) runParser(ctx context.Context, wg *sync.WaitGroup, input <-chan []rawMessage, outputs ...chan []message.DynamicMessage) {
 	defer wg.Done()
 	defer func() {
-		close(p.parsedMessages)
+		for _, output := range outputs {
+			if output != nil {
+				close(output)
+			}
+		}
 		p.logger.Debug("Parsed messages channel closed")
 	}()
 
 	parserLogger := p.logger.Named("parser").Sugar()
-	parserLogger.Debug("Starting parser goroutine...")
+	parserLogger.Debugw("Starting parser goroutines...", zap.Int("workers", p.cfg.Pipeline.ParserWorkers))
+	results := startParsers(ctx, input, p.parse, p.cfg.Pipeline.ParserWorkers)
 
 	for {
 		select {
-		case rawMsg, ok := <-p.rawMessages:
+		case slot, ok := <-results:
 			if !ok {
 				parserLogger.Debug("Parser finished (raw message channel closed).")
 				return
 			}
 
-			parsedMsg, err := message.ParseDynamicJSON(rawMsg)
-			if err != nil {
-				parserLogger.Warnw("Failed to parse message, skipping", zap.Error(err))
-				continue
-			}
-
-			// Send parsed message downstream or handle context cancellation
+			var results []parseResult
 			select {
-			case p.parsedMessages <- parsedMsg:
-
+			case results = <-slot:
 			case <-ctx.Done():
-				parserLogger.Debug("Parser context cancelled during send.", zap.Error(ctx.Err()))
+				parserLogger.Debug("Parser context cancelled while waiting for a worker.", zap.Error(ctx.Err()))
 				return
 			}
+			var batch []message.DynamicMessage
+			failures := 0
+			for _, parsed := range results {
+				if parsed.err != nil {
+					failures++
+					telemetry.parseErrors.Add(ctx, 1)
+					parserLogger.Warnw("Failed to parse message, skipping malformed records",
+						zap.Int("decoded_records", len(parsed.msgs)),
+						zap.Error(parsed.err),
+					)
+					p.reporter.Report(&OpError{Component: ComponentParser, Op: "parse", Severity: ErrorSeverityError, Err: parsed.err})
+				}
+				for _, parsedMsg := range parsed.msgs {
+					if p.stampTopics && parsed.topic != "" {
+						parsedMsg[message.TopicKey] = parsed.topic
+					}
+					if p.stampPartitions && parsed.topic != "" {
+						parsedMsg[message.PartitionKey] = parsed.topic + ":" + strconv.Itoa(parsed.partition)
+					}
+					batch = append(batch, parsedMsg)
+				}
+			}
+			if input == p.rawMessages { // Not counting the messages of the skew reference topic
+				p.stats.addConsumed(len(results), failures)
+			}
+			if len(batch) == 0 {
+				continue
+			}
+			if p.metrics != nil && !results[0].handedOff.IsZero() {
+				p.metrics.observeStage(stageParse, results[0].handedOff)
+			}
+			p.batches.send(batch)
+
+			// Send parsed messages downstream or handle context cancellation
+			for _, output := range outputs {
+				if output == nil {
+					continue
+				}
+				select {
+				case output <- batch:
+
+				case <-ctx.Done():
+					parserLogger.Debug("Parser context cancelled during send.", zap.Error(ctx.Err()))
+					return
+				}
+			}
 
 		case <-ctx.Done():
 			parserLogger.Debug("Parser context cancelled while waiting for raw message.", zap.Error(ctx.Err()))
@@ -173,12 +795,35 @@ func (p *Pipeline) runCalculator(ctx context.Context, wg *sync.WaitGroup, errCh
 	defer wg.Done()
 	defer func() {
 		close(p.aggResults)
+		if p.latencyResults != nil {
+			close(p.latencyResults)
+		}
+		if p.throughputResults != nil {
+			close(p.throughputResults)
+		}
+		if p.correlationResults != nil {
+			close(p.correlationResults)
+		}
+		if p.partials != nil {
+			close(p.partials)
+		}
 		p.logger.Debug("Aggregation results channel closed")
 	}()
+	if p.graph != nil {
+		// Calculator stages send to the same aggregation results channel
+		var stages sync.WaitGroup
+		stages.Add(1)
+		go func() {
+			defer stages.Done()
+			p.runStageCalculators(ctx, errCh)
+		}()
+		defer stages.Wait()
+	}
 
 	p.logger.Debug("Starting calculator goroutine...")
 	if err := p.calculator.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
 		p.logger.Error("Calculator component exited with error", zap.Error(err))
+		p.reportFailure(ComponentCalculator, err)
 		errCh <- fmt.Errorf("%w: %w", ErrCalculatorRunFailed, err)
 	} else if err == nil {
 		p.logger.Debug("Calculator goroutine finished normally")
@@ -190,10 +835,32 @@ func (p *Pipeline) runCalculator(ctx context.Context, wg *sync.WaitGroup, errCh
 // runAlerter executes the alerter component logic in a goroutine.
 func (p *Pipeline) runAlerter(ctx context.Context, wg *sync.WaitGroup, errCh chan<- error) {
 	defer wg.Done()
+	defer func() {
+		if p.remote != nil {
+			p.remote.Close() // The alerter is the only producer of remote-write series
+		}
+		if p.sinks != nil {
+			p.sinks.Close() // ...and of sink events
+		}
+		if p.actions != nil {
+			p.actions.Close() // ...and of action runs
+		}
+		if p.trail != nil {
+			if err := p.trail.Close(); err != nil {
+				p.logger.Warn("Failed to close audit trail", zap.Error(err))
+			}
+		}
+		if p.results != nil {
+			if err := p.results.Close(); err != nil { // Stored results stay readable in memory
+				p.logger.Warn("Failed to close results store", zap.Error(err))
+			}
+		}
+	}()
 
 	p.logger.Debug("Starting alerter goroutine...")
 	if err := p.alerter.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
 		p.logger.Error("Alerter component exited with error", zap.Error(err))
+		p.reportFailure(ComponentAlerter, err)
 		errCh <- fmt.Errorf("%w: %w", ErrAlerterRunFailed, err)
 	} else if err == nil {
 		p.logger.Debug("Alerter goroutine finished normally")
@@ -202,6 +869,100 @@ func (p *Pipeline) runAlerter(ctx context.Context, wg *sync.WaitGroup, errCh cha
 	}
 }
 
+// runSkewMonitor executes the skew monitor component logic in a goroutine.
+func (p *Pipeline) runSkewMonitor(ctx context.Context, wg *sync.WaitGroup, errCh chan<- error) {
+	defer wg.Done()
+	defer func() {
+		close(p.skewResults)
+		p.logger.Debug("Skew results channel closed")
+	}()
+
+	p.logger.Debug("Starting skew monitor goroutine...")
+	if err := p.skew.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
+		p.logger.Error("Skew monitor component exited with error", zap.Error(err))
+		p.reportFailure(ComponentAlerter, err)
+		errCh <- fmt.Errorf("%w: %w", ErrSkewRunFailed, err)
+	} else if err == nil {
+		p.logger.Debug("Skew monitor goroutine finished normally")
+	} else {
+		p.logger.Debug("Skew monitor goroutine cancelled gracefully")
+	}
+}
+
+// runPartialPublisher executes the partial publisher logic in a goroutine. It returns once
+// the calculator has stopped and all its partials were published.
+func (p *Pipeline) runPartialPublisher(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	p.logger.Debug("Starting partial publisher goroutine...")
+	_ = p.publisher.Run(ctx)
+	p.logger.Debug("Partial publisher goroutine finished")
+}
+
+// runWindowMerger executes the window merger logic in a goroutine. Like the consumers, it
+// stops reading partials when fetchCtx is cancelled, then flushes the windows still
+// pending until drainCtx is done and closes the merged windows channel.
+func (p *Pipeline) runWindowMerger(fetchCtx, drainCtx context.Context, wg *sync.WaitGroup, errCh chan<- error) {
+	defer wg.Done()
+	defer func() {
+		close(p.mergedWindows)
+		p.logger.Debug("Merged windows channel closed")
+	}()
+
+	p.logger.Debug("Starting window merger goroutine...")
+	if err := p.merger.Run(fetchCtx); err != nil && !errors.Is(err, context.Canceled) {
+		p.logger.Error("Window merger component exited with error", zap.Error(err))
+		p.reportFailure(ComponentScaling, err)
+		errCh <- fmt.Errorf("%w: %w", ErrMergerRunFailed, err)
+	} else {
+		p.logger.Debug("Window merger goroutine stopped reading partials")
+	}
+	p.merger.Flush(drainCtx)
+}
+
+// runLagMonitor executes the lag monitor logic in a goroutine.
+func (p *Pipeline) runLagMonitor(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+	defer func() {
+		close(p.lagResults)
+		p.logger.Debug("Lag results channel closed")
+	}()
+
+	p.logger.Debug("Starting lag monitor goroutine...")
+	_ = p.lag.Run(ctx) // Only returns on cancellation; poll failures are logged and retried
+	p.logger.Debug("Lag monitor goroutine finished")
+}
+
+// runRemoteWriter executes the remote writer logic in a goroutine. It returns once the
+// alerter has stopped and all queued series were sent.
+func (p *Pipeline) runRemoteWriter(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	p.logger.Debug("Starting remote writer goroutine...")
+	_ = p.remote.Run(ctx)
+	p.logger.Debug("Remote writer goroutine finished")
+}
+
+// runSinkDispatcher executes the sink dispatcher logic in a goroutine. It returns once
+// the alerter has stopped and all queued events were delivered.
+func (p *Pipeline) runSinkDispatcher(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	p.logger.Debug("Starting sink dispatcher goroutine...")
+	_ = p.sinks.Run(ctx)
+	p.logger.Debug("Sink dispatcher goroutine finished")
+}
+
+// runActionDispatcher executes the action dispatcher logic in a goroutine. It returns
+// once the alerter has stopped and all queued runs were performed.
+func (p *Pipeline) runActionDispatcher(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	p.logger.Debug("Starting action dispatcher goroutine...")
+	_ = p.actions.Run(ctx)
+	p.logger.Debug("Action dispatcher goroutine finished")
+}
+
 // Close is kept for potential future explicit cleanup needs outside the Run cycle.
 func (p *Pipeline) Close() error {
 	p.logger.Debug("Pipeline Close called (most cleanup handled by Run/context).")
@@ -0,0 +1,174 @@
+package pipeline
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Channels whose results are dropped when full, as counted by processingStats.
+const (
+	channelAggregationResults = "aggregation_results"
+	channelLatencyResults     = "latency_results"
+	channelThroughputResults  = "throughput_results"
+	channelCorrelationResults = "correlation_results"
+	channelPartialWindows     = "partial_windows"
+)
+
+// processingStats counts what the pipeline processed since the last processing summary,
+// overall and per feature. It is safe for concurrent use; a nil processingStats counts
+// nothing.
+type processingStats struct {
+	mu            sync.Mutex
+	since         time.Time // Start of the counts, when the last summary was taken
+	consumed      int64
+	parseFailures int64
+	windows       int64
+	violations    int64 // Not counting canary and stale ones, like featurelens_feature_threshold_violations_total
+	dropped       map[string]int64
+	features      featureActivities
+}
+
+// featureActivity is what a feature went through since the last processing summary.
+type featureActivity struct {
+	windows    int64
+	violations int64
+}
+
+func (f *featureActivity) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddInt64("windows_flushed", f.windows)
+	enc.AddInt64("violations", f.violations)
+	return nil
+}
+
+// featureActivities logs as an object keyed by feature name, in name order.
+type featureActivities map[string]*featureActivity
+
+func (a featureActivities) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	names := make([]string, 0, len(a))
+	for name := range a {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := enc.AddObject(name, a[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func newProcessingStats() *processingStats {
+	return &processingStats{since: time.Now(), dropped: make(map[string]int64), features: make(featureActivities)}
+}
+
+// addConsumed counts messages handed to the parser and those that failed to parse.
+func (s *processingStats) addConsumed(messages, failures int) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.consumed += int64(messages)
+	s.parseFailures += int64(failures)
+}
+
+// addWindow counts a window of a feature evaluated by the alerter.
+func (s *processingStats) addWindow(featureName string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.windows++
+	s.feature(featureName).windows++
+}
+
+// addViolation counts a violation of a feature fired by the alerter.
+func (s *processingStats) addViolation(featureName string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.violations++
+	s.feature(featureName).violations++
+}
+
+// addDropped counts a result dropped because the channel was full.
+func (s *processingStats) addDropped(channel string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dropped[channel]++
+}
+
+// feature returns the activity of a feature. MUST be called with the mutex held.
+func (s *processingStats) feature(name string) *featureActivity {
+	f, ok := s.features[name]
+	if !ok {
+		f = &featureActivity{}
+		s.features[name] = f
+	}
+	return f
+}
+
+// take returns the counts so far and starts counting from zero again.
+func (s *processingStats) take() *processingStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	taken := &processingStats{
+		since:         s.since,
+		consumed:      s.consumed,
+		parseFailures: s.parseFailures,
+		windows:       s.windows,
+		violations:    s.violations,
+		dropped:       s.dropped,
+		features:      s.features,
+	}
+	s.since = time.Now()
+	s.consumed, s.parseFailures, s.windows, s.violations = 0, 0, 0, 0
+	s.dropped = make(map[string]int64)
+	s.features = make(featureActivities)
+	return taken
+}
+
+// runProcessingSummary logs what the pipeline processed every log.summaryInterval until
+// ctx is cancelled, even when idle, so operators see a heartbeat of its health in the
+// logs alone. Run logs what remains once the pipeline drained.
+func (p *Pipeline) runProcessingSummary(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	ticker := time.NewTicker(p.cfg.Log.SummaryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			p.logProcessingSummary()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// logProcessingSummary logs the counts since the last summary and starts counting again.
+// Features are logged within the same entry, which log sampling cannot split.
+func (p *Pipeline) logProcessingSummary() {
+	stats := p.stats.take()
+	p.logger.Named("summary").Info("Processing summary",
+		zap.Duration("interval", time.Since(stats.since)),
+		zap.Int64("messages_consumed", stats.consumed),
+		zap.Int64("parse_failures", stats.parseFailures),
+		zap.Int64("windows_flushed", stats.windows),
+		zap.Int64("violations", stats.violations),
+		zap.Any("dropped", stats.dropped),
+		zap.Any("channel_depths", p.channelDepths()),
+		zap.Object("features", stats.features), // Those with windows or violations
+	)
+}
@@ -0,0 +1,107 @@
+package pipeline
+
+import (
+	"maps"
+	"sync"
+	"testing"
+
+	"go.uber.org/zap/zapcore"
+)
+
+func TestProcessingStatsTake(t *testing.T) {
+	stats := newProcessingStats()
+	start := stats.since
+
+	// Counted from concurrent stages, like the parser, the alerter and the result senders
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			stats.addConsumed(10, 1)
+			stats.addWindow("amount")
+			stats.addWindow("country")
+			stats.addViolation("amount")
+			stats.addDropped(channelAggregationResults)
+		}()
+	}
+	wg.Wait()
+	stats.addDropped(channelPartialWindows)
+
+	taken := stats.take()
+	if taken.consumed != 40 || taken.parseFailures != 4 || taken.windows != 8 || taken.violations != 4 {
+		t.Errorf("got consumed %d, parse failures %d, windows %d, violations %d, want 40, 4, 8 and 4",
+			taken.consumed, taken.parseFailures, taken.windows, taken.violations)
+	}
+	if want := map[string]int64{channelAggregationResults: 4, channelPartialWindows: 1}; !maps.Equal(taken.dropped, want) {
+		t.Errorf("dropped: got %v, want %v", taken.dropped, want)
+	}
+	want := featureActivities{"amount": {windows: 4, violations: 4}, "country": {windows: 4}}
+	if len(taken.features) != len(want) {
+		t.Errorf("features: got %d, want %d", len(taken.features), len(want))
+	}
+	for name, activity := range want {
+		if got := taken.features[name]; got == nil || *got != *activity {
+			t.Errorf("%s: got %+v, want %+v", name, got, activity)
+		}
+	}
+	if !taken.since.Equal(start) {
+		t.Errorf("taken counts start at %s, want %s", taken.since, start)
+	}
+	if stats.since.Before(start) {
+		t.Errorf("new counts start at %s, before the taken ones at %s", stats.since, start)
+	}
+
+	// Counting starts from zero again, without changing what was taken
+	stats.addWindow("amount")
+	stats.addDropped(channelAggregationResults)
+	next := stats.take()
+	if next.consumed != 0 || next.parseFailures != 0 || next.windows != 1 || next.violations != 0 {
+		t.Errorf("after reset: got consumed %d, parse failures %d, windows %d, violations %d, want only 1 window",
+			next.consumed, next.parseFailures, next.windows, next.violations)
+	}
+	if len(next.features) != 1 || *next.features["amount"] != (featureActivity{windows: 1}) {
+		t.Errorf("features after reset: got %v, want 1 window of amount", next.features)
+	}
+	if next.dropped[channelAggregationResults] != 1 || len(next.dropped) != 1 {
+		t.Errorf("dropped after reset: got %v, want 1 aggregation result", next.dropped)
+	}
+	if taken.windows != 8 || taken.features["amount"].windows != 4 || taken.dropped[channelAggregationResults] != 4 {
+		t.Errorf("counts taken before the reset changed: windows %d, amount %+v, dropped %v",
+			taken.windows, taken.features["amount"], taken.dropped)
+	}
+	if empty := stats.take(); empty.windows != 0 || len(empty.features) != 0 || len(empty.dropped) != 0 {
+		t.Errorf("idle interval: got %+v, want no counts", empty)
+	}
+}
+
+// TestProcessingStatsNil checks that a pipeline without stats counts nothing rather than
+// panicking.
+func TestProcessingStatsNil(t *testing.T) {
+	var stats *processingStats
+	stats.addConsumed(1, 1)
+	stats.addWindow("amount")
+	stats.addViolation("amount")
+	stats.addDropped(channelLatencyResults)
+}
+
+// TestFeatureActivitiesLog checks that features log under their names with their counts.
+func TestFeatureActivitiesLog(t *testing.T) {
+	enc := zapcore.NewMapObjectEncoder()
+	activities := featureActivities{"b": {windows: 2, violations: 1}, "a": {windows: 1}}
+	if err := activities.MarshalLogObject(enc); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"a": map[string]interface{}{"windows_flushed": int64(1), "violations": int64(0)},
+		"b": map[string]interface{}{"windows_flushed": int64(2), "violations": int64(1)},
+	}
+	if len(enc.Fields) != len(want) {
+		t.Fatalf("got %v, want %v", enc.Fields, want)
+	}
+	for name, fields := range want {
+		if got, _ := enc.Fields[name].(map[string]interface{}); !maps.Equal(got, fields.(map[string]interface{})) {
+			t.Errorf("%s: got %v, want %v", name, enc.Fields[name], fields)
+		}
+	}
+}
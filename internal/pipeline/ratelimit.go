@@ -0,0 +1,55 @@
+package pipeline
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/sanspareilsmyn/featurelens/internal/config"
+)
+
+// tokenBucket paces the consumer: tokens refill at rate per second up to burst, and
+// taking more tokens than are available waits until the deficit has refilled. Taking
+// goes into debt rather than waiting for the whole amount to be available at once, so
+// batches larger than the burst still pass at the configured rate. Not safe for
+// concurrent use.
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucket returns a full bucket for cfg, or nil when consumption is unbounded.
+func newTokenBucket(cfg config.RateLimitConfig) *tokenBucket {
+	if cfg.MessagesPerSecond <= 0 {
+		return nil
+	}
+	burst := float64(cfg.Burst)
+	if burst == 0 {
+		burst = math.Max(1, math.Ceil(cfg.MessagesPerSecond))
+	}
+	return &tokenBucket{rate: cfg.MessagesPerSecond, burst: burst, tokens: burst, last: time.Now()}
+}
+
+// take takes n tokens, returning how long it waited for them. It returns
+// context.Canceled if ctx is done first; the tokens are taken regardless.
+func (b *tokenBucket) take(ctx context.Context, n int) (time.Duration, error) {
+	now := time.Now()
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0, nil
+	}
+
+	delay := time.Duration(-b.tokens / b.rate * float64(time.Second))
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return delay, nil
+	case <-ctx.Done():
+		return time.Since(now), context.Canceled
+	}
+}
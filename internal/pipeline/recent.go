@@ -0,0 +1,117 @@
+package pipeline
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sanspareilsmyn/featurelens/internal/store"
+)
+
+// RecentWindows keeps the last windows of every feature in memory, with the violations
+// they raised, for clients polling the current state and recent trends. Unlike the
+// results store it holds a fixed number of windows per feature and is always enabled.
+type RecentWindows struct {
+	mu      sync.RWMutex
+	size    int                    // Windows kept per feature
+	windows map[string]*windowRing // By feature name, including segments and model versions
+}
+
+// windowRing holds a feature's last windows, overwriting the oldest once full.
+type windowRing struct {
+	records []store.Record
+	next    int // Index of the oldest record once full
+}
+
+// NewRecentWindows creates an empty RecentWindows keeping size windows per feature.
+func NewRecentWindows(size int) *RecentWindows {
+	return &RecentWindows{size: max(size, 1), windows: make(map[string]*windowRing)}
+}
+
+// add records a feature's window. Windows are flushed in order, so a window ending
+// before the feature's latest one is a late duplicate and is dropped.
+func (w *RecentWindows) add(r store.Record) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	ring, ok := w.windows[r.Result.FeatureName]
+	if !ok {
+		ring = &windowRing{records: make([]store.Record, 0, w.size)}
+		w.windows[r.Result.FeatureName] = ring
+	}
+	if latest, ok := ring.latest(); ok && latest.Result.WindowEnd.After(r.Result.WindowEnd) {
+		return
+	}
+	if len(ring.records) < w.size {
+		ring.records = append(ring.records, r)
+		return
+	}
+	ring.records[ring.next] = r
+	ring.next = (ring.next + 1) % w.size
+}
+
+// Latest returns every feature's latest window, ordered by feature name.
+func (w *RecentWindows) Latest() []store.Record {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	records := make([]store.Record, 0, len(w.windows))
+	for _, ring := range w.windows {
+		if r, ok := ring.latest(); ok {
+			records = append(records, r)
+		}
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Result.FeatureName < records[j].Result.FeatureName
+	})
+	return records
+}
+
+// History returns up to the last n windows of a feature, oldest first, and whether the
+// feature has any.
+func (w *RecentWindows) History(featureName string, n int) ([]store.Record, bool) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	ring, ok := w.windows[featureName]
+	if !ok {
+		return nil, false
+	}
+	ordered := append(append([]store.Record(nil), ring.records[ring.next:]...), ring.records[:ring.next]...)
+	if n < len(ordered) {
+		ordered = ordered[len(ordered)-n:]
+	}
+	return ordered, true
+}
+
+// At returns a feature's window that ended at windowEnd, if it is still kept.
+func (w *RecentWindows) At(featureName string, windowEnd time.Time) (store.Record, bool) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	ring, ok := w.windows[featureName]
+	if !ok {
+		return store.Record{}, false
+	}
+	n := len(ring.records)
+	i := sort.Search(n, func(i int) bool {
+		return !ring.records[(ring.next+i)%n].Result.WindowEnd.Before(windowEnd)
+	})
+	if i == n || !ring.records[(ring.next+i)%n].Result.WindowEnd.Equal(windowEnd) {
+		return store.Record{}, false
+	}
+	return ring.records[(ring.next+i)%n], true
+}
+
+// Size returns the number of windows kept per feature.
+func (w *RecentWindows) Size() int {
+	return w.size
+}
+
+// latest returns the ring's most recent record.
+func (r *windowRing) latest() (store.Record, bool) {
+	if len(r.records) == 0 {
+		return store.Record{}, false
+	}
+	return r.records[(r.next+len(r.records)-1)%len(r.records)], true
+}
@@ -0,0 +1,192 @@
+package pipeline
+
+import (
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+
+	"github.com/sanspareilsmyn/featurelens/internal/config"
+	"github.com/sanspareilsmyn/featurelens/internal/logging"
+	"github.com/sanspareilsmyn/featurelens/internal/message"
+)
+
+// FeatureRegistry resolves the feature configuration that applies to each message field.
+// It holds the explicitly named features and discovers new features at runtime for
+// message fields matching a group pattern. It is shared by the Calculator and Alerter.
+type FeatureRegistry struct {
+	patterns      []featurePattern
+	maxDiscovered int
+	logger        *zap.Logger
+
+	mu         sync.RWMutex
+	features   []config.FeatureConfig          // Static features in dependency order, then discovered ones
+	byName     map[string]config.FeatureConfig // All known features
+	unmatched  map[string]struct{}             // Fields known not to match any pattern
+	discovered int
+}
+
+type featurePattern struct {
+	template config.FeatureConfig
+	match    func(field string) bool
+}
+
+// maxUnmatchedCache bounds the negative lookup cache for fields that match no pattern.
+const maxUnmatchedCache = 10000
+
+// NewFeatureRegistry builds a registry from configured features. Entries with a pattern
+// become group templates; all others are registered immediately.
+func NewFeatureRegistry(features []config.FeatureConfig, maxDiscovered int, logger *zap.Logger) *FeatureRegistry {
+	r := &FeatureRegistry{
+		maxDiscovered: maxDiscovered,
+		logger:        logger,
+		byName:        make(map[string]config.FeatureConfig),
+		unmatched:     make(map[string]struct{}),
+	}
+
+	var static []config.FeatureConfig
+	for _, f := range features {
+		if f.Pattern == "" {
+			static = append(static, f)
+			continue
+		}
+		r.patterns = append(r.patterns, featurePattern{template: f, match: compilePattern(f.Pattern)})
+	}
+	r.features = sortByDependency(static)
+	for _, f := range r.features {
+		r.byName[f.Name] = f
+	}
+
+	logger.Debug("Feature registry initialized",
+		zap.Int("static_features", len(r.features)),
+		zap.Int("group_patterns", len(r.patterns)),
+		zap.Int("max_discovered", maxDiscovered),
+	)
+	return r
+}
+
+// compilePattern returns a matcher for a glob pattern, or a regular expression when prefixed
+// with "regex:". Patterns are validated at config load.
+func compilePattern(pattern string) func(string) bool {
+	if expression, ok := strings.CutPrefix(pattern, config.RegexPatternPrefix); ok {
+		re := regexp.MustCompile(expression)
+		return re.MatchString
+	}
+	return func(field string) bool {
+		matched, _ := path.Match(pattern, field)
+		return matched
+	}
+}
+
+// Lookup returns the configuration for a known feature.
+func (r *FeatureRegistry) Lookup(featureName string) (config.FeatureConfig, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	f, ok := r.byName[featureName]
+	return f, ok
+}
+
+// Configured reports whether the configuration still covers a feature: it is named
+// explicitly or matches a group pattern.
+func (r *FeatureRegistry) Configured(featureName string) bool {
+	if _, ok := r.Lookup(featureName); ok {
+		return true
+	}
+	for _, p := range r.patterns {
+		if p.match(featureName) {
+			return true
+		}
+	}
+	return false
+}
+
+// Features returns a snapshot of all known features, static ones in dependency order first.
+func (r *FeatureRegistry) Features() []config.FeatureConfig {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.features
+}
+
+// Discover registers message fields matching a group pattern and returns the newly
+// discovered features. The first matching pattern wins.
+func (r *FeatureRegistry) Discover(msg message.DynamicMessage) []config.FeatureConfig {
+	if len(r.patterns) == 0 {
+		return nil
+	}
+
+	var candidates []string
+	r.mu.RLock()
+	for field := range msg {
+		if _, known := r.byName[field]; known || field == message.TopicKey || field == message.PartitionKey {
+			continue
+		}
+		if _, skip := r.unmatched[field]; skip {
+			continue
+		}
+		candidates = append(candidates, field)
+	}
+	r.mu.RUnlock()
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var added []config.FeatureConfig
+	for _, field := range candidates {
+		if _, known := r.byName[field]; known {
+			continue
+		}
+		f, matched := r.matchTemplate(field)
+		if !matched {
+			if len(r.unmatched) < maxUnmatchedCache {
+				r.unmatched[field] = struct{}{}
+			}
+			continue
+		}
+		if r.discovered >= r.maxDiscovered {
+			r.logger.Warn("Discovered feature limit reached, ignoring matching field",
+				zap.String("field", field),
+				zap.Int("max_discovered", r.maxDiscovered),
+			)
+			if len(r.unmatched) < maxUnmatchedCache {
+				r.unmatched[field] = struct{}{}
+			}
+			continue
+		}
+
+		// Copy-on-write so snapshots returned by Features stay immutable
+		features := make([]config.FeatureConfig, len(r.features), len(r.features)+1)
+		copy(features, r.features)
+		r.features = append(features, f)
+		r.byName[field] = f
+		r.discovered++
+		added = append(added, f)
+		r.logger.Info("Discovered feature from group pattern",
+			logging.Feature(field),
+			zap.String("group", f.Group),
+		)
+	}
+	return added
+}
+
+// matchTemplate instantiates the first group template whose pattern matches the field.
+func (r *FeatureRegistry) matchTemplate(field string) (config.FeatureConfig, bool) {
+	for _, p := range r.patterns {
+		if !p.match(field) {
+			continue
+		}
+		f := p.template
+		f.Group = f.Name
+		if f.Group == "" {
+			f.Group = f.Pattern
+		}
+		f.Name = field
+		f.Pattern = ""
+		return f, true
+	}
+	return config.FeatureConfig{}, false
+}
@@ -0,0 +1,34 @@
+package pipeline
+
+import (
+	"fmt"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/sanspareilsmyn/featurelens/internal/config"
+	"github.com/sanspareilsmyn/featurelens/internal/message"
+)
+
+// TestDiscoverBoundsUnmatchedCache checks that neither fields matching no pattern nor
+// matching fields past the discovered feature limit grow the negative lookup cache beyond
+// maxUnmatchedCache.
+func TestDiscoverBoundsUnmatchedCache(t *testing.T) {
+	features := []config.FeatureConfig{{Name: "prices", Pattern: "price_*", MetricType: config.MetricTypeNumerical}}
+	r := NewFeatureRegistry(features, 1, zap.NewNop())
+	if added := r.Discover(message.DynamicMessage{"price_0": 1.0}); len(added) != 1 {
+		t.Fatalf("got %d discovered features, want 1", len(added))
+	}
+
+	for i := range maxUnmatchedCache {
+		r.Discover(message.DynamicMessage{fmt.Sprintf("other_%d", i): 1.0})
+	}
+	for i := range 10 {
+		if added := r.Discover(message.DynamicMessage{fmt.Sprintf("price_%d", i+1): 1.0}); len(added) != 0 {
+			t.Errorf("got %d discovered features past the limit, want none", len(added))
+		}
+	}
+	if got := len(r.unmatched); got != maxUnmatchedCache {
+		t.Errorf("got %d cached fields, want %d", got, maxUnmatchedCache)
+	}
+}
@@ -0,0 +1,279 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/sanspareilsmyn/featurelens/internal/config"
+	"github.com/sanspareilsmyn/featurelens/internal/remotewrite"
+)
+
+// remoteWriteMaxBackoff caps the delay between retries of a failed request.
+const remoteWriteMaxBackoff = 5 * time.Second
+
+// RemoteWriter pushes window aggregates to a Prometheus remote-write endpoint so
+// short-lived or batch runs don't lose data between scrapes.
+type RemoteWriter struct {
+	cfg     config.RemoteWriteConfig
+	client  *remotewrite.Client
+	input   chan remotewrite.TimeSeries
+	labels  []remotewrite.Label // External labels added to every series
+	metrics *Metrics
+	logger  *zap.Logger
+
+	reporter *ErrorReporter // Reports failed batches; nil discards them
+}
+
+// NewRemoteWriter creates a RemoteWriter from its configuration.
+func NewRemoteWriter(cfg config.RemoteWriteConfig, metrics *Metrics, logger *zap.Logger) (*RemoteWriter, error) {
+	headers := make(http.Header, len(cfg.Headers)+1)
+	for name, value := range cfg.Headers {
+		headers.Set(name, value)
+	}
+	if cfg.BearerTokenFile != "" {
+		token, err := os.ReadFile(cfg.BearerTokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrRemoteWriterCreationFailed, err)
+		}
+		headers.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+
+	labels := make([]remotewrite.Label, 0, len(cfg.ExternalLabels))
+	for name, value := range cfg.ExternalLabels {
+		labels = append(labels, remotewrite.Label{Name: name, Value: value})
+	}
+
+	logger.Info("Remote writer initialized",
+		zap.String("url", cfg.URL),
+		zap.Duration("flush_interval", cfg.FlushInterval),
+		zap.Int("max_batch_size", cfg.MaxBatchSize),
+	)
+	return &RemoteWriter{
+		cfg:     cfg,
+		client:  remotewrite.NewClient(cfg.URL, cfg.Timeout, headers),
+		input:   make(chan remotewrite.TimeSeries, cfg.QueueSize),
+		labels:  labels,
+		metrics: metrics,
+		logger:  logger,
+	}, nil
+}
+
+// Enqueue queues the result's statistics without blocking; series are dropped when the queue is full.
+func (w *RemoteWriter) Enqueue(result AggregationResult) {
+	for _, ts := range w.resultSeries(result) {
+		select {
+		case w.input <- ts:
+		default:
+			w.metrics.remoteWriteSeries.WithLabelValues("dropped").Inc()
+		}
+	}
+}
+
+// seriesValue is one statistic of a result, exported as a series sample.
+type seriesValue struct {
+	name  string
+	value float64
+}
+
+// resultSeries mirrors the per-window gauges exported on /metrics, timestamped at the window end.
+func (w *RemoteWriter) resultSeries(result AggregationResult) []remotewrite.TimeSeries {
+	if result.Segment != nil {
+		return w.segmentSeries(result)
+	}
+	values := []seriesValue{
+		{"featurelens_feature_window_count_total", float64(result.Count)},
+		{"featurelens_feature_window_null_count_total", float64(result.NullCount)},
+		{"featurelens_feature_window_missing_count_total", float64(result.MissingCount)},
+	}
+	if result.Count > 0 {
+		values = append(values,
+			seriesValue{"featurelens_feature_window_null_rate", result.rate(result.NullCount)},
+			seriesValue{"featurelens_feature_window_missing_rate", result.rate(result.MissingCount)},
+			seriesValue{"featurelens_feature_window_type_mismatch_rate", result.rate(result.TypeMismatchCount)},
+		)
+	}
+	if !math.IsNaN(result.Mean) {
+		values = append(values, seriesValue{"featurelens_feature_window_mean_value", result.Mean})
+	}
+	if !math.IsNaN(result.Variance) && result.Variance >= 0 {
+		values = append(values, seriesValue{"featurelens_feature_window_stddev_value", math.Sqrt(result.Variance)})
+	}
+	if zeroRate := result.zeroRate(); !math.IsNaN(zeroRate) {
+		values = append(values, seriesValue{"featurelens_feature_window_zero_rate", zeroRate})
+	}
+	if outlierRate := result.outlierRate(); !math.IsNaN(outlierRate) {
+		values = append(values, seriesValue{"featurelens_feature_window_outlier_rate", outlierRate})
+	}
+	if trueRate := result.booleanRate(result.TrueCount); !math.IsNaN(trueRate) {
+		values = append(values, seriesValue{"featurelens_feature_window_true_rate", trueRate})
+	}
+	if result.Categories != nil {
+		values = append(values, seriesValue{"featurelens_feature_window_distinct_values", float64(len(result.Categories))})
+	}
+	if !math.IsNaN(result.DistinctEstimate) {
+		values = append(values, seriesValue{"featurelens_feature_window_distinct_estimate", result.DistinctEstimate})
+	}
+	if text := result.Text; text != nil {
+		values = append(values,
+			seriesValue{"featurelens_feature_window_avg_length", text.AvgLength},
+			seriesValue{"featurelens_feature_window_max_length", float64(text.MaxLength)},
+		)
+		if !math.IsNaN(text.PatternMatchRate) {
+			values = append(values, seriesValue{"featurelens_feature_window_pattern_match_rate", text.PatternMatchRate})
+		}
+	}
+	if vec := result.Vector; vec != nil {
+		values = append(values, seriesValue{"featurelens_feature_window_dimension_mismatch_rate", vec.dimensionMismatchRate()})
+		for _, v := range []seriesValue{
+			{"featurelens_feature_window_non_finite_rate", vec.NonFiniteRate},
+			{"featurelens_feature_window_norm_mean", vec.NormMean},
+			{"featurelens_feature_window_centroid_distance", vec.CentroidDistance},
+		} {
+			if !math.IsNaN(v.value) {
+				values = append(values, v)
+			}
+		}
+	}
+
+	feature := remotewrite.Label{Name: "feature_name", Value: result.configName()}
+	series := w.series(result, values, feature)
+	if p := result.Percentiles; p != nil {
+		for _, q := range []struct {
+			quantile string
+			value    float64
+		}{{"0.5", p.P50}, {"0.95", p.P95}, {"0.99", p.P99}} {
+			series = append(series, w.series(result, []seriesValue{{"featurelens_feature_window_percentile", q.value}},
+				feature, remotewrite.Label{Name: "quantile", Value: q.quantile})...)
+		}
+	}
+	return series
+}
+
+// segmentSeries mirrors the per-group gauges for a segment's result.
+func (w *RemoteWriter) segmentSeries(result AggregationResult) []remotewrite.TimeSeries {
+	values := []seriesValue{{"featurelens_feature_group_window_count_total", float64(result.Count)}}
+	if result.Count > 0 {
+		values = append(values,
+			seriesValue{"featurelens_feature_group_window_null_rate", result.rate(result.NullCount)},
+			seriesValue{"featurelens_feature_group_window_missing_rate", result.rate(result.MissingCount)},
+		)
+	}
+	if !math.IsNaN(result.Mean) {
+		values = append(values, seriesValue{"featurelens_feature_group_window_mean_value", result.Mean})
+	}
+	if !math.IsNaN(result.Variance) && result.Variance >= 0 {
+		values = append(values, seriesValue{"featurelens_feature_group_window_stddev_value", math.Sqrt(result.Variance)})
+	}
+	s := result.Segment
+	return w.series(result, values,
+		remotewrite.Label{Name: "feature_name", Value: s.Feature},
+		remotewrite.Label{Name: "group_by", Value: s.GroupBy},
+		remotewrite.Label{Name: "group", Value: s.Group},
+	)
+}
+
+// series builds one time series per value, labelled with the writer's labels, extra and
+// the result's model version, if any.
+func (w *RemoteWriter) series(result AggregationResult, values []seriesValue, extra ...remotewrite.Label) []remotewrite.TimeSeries {
+	if result.ModelVersion != "" {
+		extra = append(extra, remotewrite.Label{Name: "model_version", Value: result.ModelVersion})
+	}
+	series := make([]remotewrite.TimeSeries, 0, len(values))
+	for _, v := range values {
+		labels := make([]remotewrite.Label, 0, len(w.labels)+1+len(extra))
+		labels = append(labels, w.labels...)
+		labels = append(labels, remotewrite.Label{Name: "__name__", Value: v.name})
+		labels = append(labels, extra...)
+		series = append(series, remotewrite.TimeSeries{
+			Labels:  labels,
+			Samples: []remotewrite.Sample{{Value: v.value, Timestamp: result.WindowEnd}},
+		})
+	}
+	return series
+}
+
+// Close stops accepting series; Run flushes what is queued and returns.
+func (w *RemoteWriter) Close() {
+	close(w.input)
+}
+
+// Run batches queued series and sends them until Close is called. It keeps running after
+// ctx is cancelled so the final windows of a run are still delivered.
+func (w *RemoteWriter) Run(ctx context.Context) error {
+	sugar := w.logger.Sugar()
+	sugar.Info("Starting remote writer loop...")
+	defer sugar.Info("Remote writer loop stopped.")
+
+	ticker := time.NewTicker(w.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]remotewrite.TimeSeries, 0, w.cfg.MaxBatchSize)
+	for {
+		select {
+		case ts, ok := <-w.input:
+			if !ok {
+				w.send(batch)
+				return nil
+			}
+			batch = append(batch, ts)
+			if len(batch) >= w.cfg.MaxBatchSize {
+				w.send(batch)
+				batch = batch[:0]
+			}
+
+		case <-ticker.C:
+			w.send(batch)
+			batch = batch[:0]
+		}
+	}
+}
+
+// send writes a batch, retrying recoverable failures with exponential backoff.
+func (w *RemoteWriter) send(batch []remotewrite.TimeSeries) {
+	if len(batch) == 0 {
+		return
+	}
+
+	backoff := 500 * time.Millisecond
+	for attempt := 0; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), w.cfg.Timeout)
+		err := w.client.Write(ctx, batch)
+		cancel()
+		if err == nil {
+			w.metrics.remoteWriteSeries.WithLabelValues("sent").Add(float64(len(batch)))
+			w.logger.Debug("Remote write batch sent", zap.Int("series", len(batch)))
+			return
+		}
+		if !errors.Is(err, remotewrite.ErrRecoverable) || attempt >= w.cfg.MaxRetries {
+			w.metrics.remoteWriteSeries.WithLabelValues("failed").Add(float64(len(batch)))
+			w.logger.Error("Remote write batch failed, dropping",
+				zap.Int("series", len(batch)),
+				zap.Int("attempts", attempt+1),
+				zap.Error(err),
+			)
+			w.reporter.Report(&OpError{
+				Component: ComponentRemoteWrite,
+				Op:        "write",
+				Severity:  ErrorSeverityError,
+				Retryable: errors.Is(err, remotewrite.ErrRecoverable),
+				Err:       err,
+			})
+			return
+		}
+		w.logger.Warn("Remote write batch failed, retrying",
+			zap.Int("attempt", attempt+1),
+			zap.Duration("backoff", backoff),
+			zap.Error(err),
+		)
+		time.Sleep(backoff)
+		backoff = min(backoff*2, remoteWriteMaxBackoff)
+	}
+}
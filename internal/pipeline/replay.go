@@ -0,0 +1,154 @@
+package pipeline
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/sanspareilsmyn/featurelens/internal/config"
+	"github.com/sanspareilsmyn/featurelens/internal/message"
+)
+
+// maxReplayLineBytes bounds the size of one replayed message.
+const maxReplayLineBytes = 16 << 20
+
+// source replays messages in place of the Kafka consumer. Run returns nil once every
+// message was handed downstream, or context.Canceled if ctx is cancelled first.
+type source interface {
+	Run(ctx context.Context) error
+}
+
+// newSourceFunc creates a replay source sending its batches to output.
+type newSourceFunc func(output chan<- []rawMessage) (source, error)
+
+// FileSource replays messages from a file in place of the Kafka consumer, one message
+// per line. For CSV payloads with a header row, the file's first line is the header and
+// is prepended to every other line.
+type FileSource struct {
+	path   string
+	header bool
+	batch  int
+	output chan<- []rawMessage
+	logger *zap.Logger
+}
+
+// NewFileSource creates a FileSource for the configured payload format. Binary formats
+// cannot be split into lines and are rejected.
+func NewFileSource(cfg config.PipelineConfig, path string, output chan<- []rawMessage, logger *zap.Logger) (*FileSource, error) {
+	switch cfg.Format {
+	case config.FormatJSON, config.FormatJSONLines, config.FormatCSV:
+	default:
+		return nil, fmt.Errorf("%w: format %q cannot be replayed from a file", ErrReplayFailed, cfg.Format)
+	}
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrReplayFailed, err)
+	}
+	return &FileSource{
+		path:   path,
+		header: cfg.Format == config.FormatCSV && cfg.CSV.Header,
+		batch:  cfg.Batch.Size,
+		output: output,
+		logger: logger,
+	}, nil
+}
+
+// Run sends every line of the file downstream, in batches of the configured size. It
+// returns nil once the whole file was handed downstream, or context.Canceled if ctx is
+// cancelled first.
+func (s *FileSource) Run(ctx context.Context) error {
+	f, err := os.Open(s.path)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrReplayFailed, err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxReplayLineBytes)
+	var header []byte
+	var lines int64
+	batch := make([]rawMessage, 0, s.batch)
+	handOff := func() error {
+		now := time.Now()
+		for i := range batch {
+			batch[i].handedOff = now
+		}
+		select {
+		case s.output <- batch:
+			lines += int64(len(batch))
+			telemetry.messagesConsumed.Add(ctx, int64(len(batch)))
+			batch = make([]rawMessage, 0, s.batch)
+			return nil
+		case <-ctx.Done():
+			return context.Canceled
+		}
+	}
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if s.header && header == nil {
+			header = append(append([]byte{}, line...), '\n')
+			continue
+		}
+		buf := message.NewBuffer() // The scanner reuses its buffer
+		*buf = append(append(*buf, header...), line...)
+
+		batch = append(batch, rawMessage{value: *buf, buf: buf})
+		if len(batch) < s.batch {
+			continue
+		}
+		if err := handOff(); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("%w: %w", ErrReplayFailed, err)
+	}
+	if len(batch) > 0 {
+		if err := handOff(); err != nil {
+			return err
+		}
+	}
+	s.logger.Info("Replay file read", zap.String("path", s.path), zap.Int64("messages", lines))
+	return nil
+}
+
+// MemorySource replays messages held in memory in place of the Kafka consumer, e.g. to
+// run the pipeline end to end without a broker.
+type MemorySource struct {
+	messages [][]byte
+	batch    int
+	output   chan<- []rawMessage
+	logger   *zap.Logger
+}
+
+// NewMemorySource creates a MemorySource sending messages downstream, in order.
+func NewMemorySource(cfg config.PipelineConfig, messages [][]byte, output chan<- []rawMessage, logger *zap.Logger) *MemorySource {
+	return &MemorySource{messages: messages, batch: cfg.Batch.Size, output: output, logger: logger}
+}
+
+// Run sends every message downstream, in batches of the configured size. It returns nil
+// once all were handed downstream, or context.Canceled if ctx is cancelled first.
+func (s *MemorySource) Run(ctx context.Context) error {
+	for start := 0; start < len(s.messages); start += s.batch {
+		batch := make([]rawMessage, 0, s.batch)
+		now := time.Now()
+		for _, msg := range s.messages[start:min(start+s.batch, len(s.messages))] {
+			batch = append(batch, rawMessage{value: msg, handedOff: now})
+		}
+		select {
+		case s.output <- batch:
+			telemetry.messagesConsumed.Add(ctx, int64(len(batch)))
+		case <-ctx.Done():
+			return context.Canceled
+		}
+	}
+	s.logger.Info("Memory source read", zap.Int("messages", len(s.messages)))
+	return nil
+}
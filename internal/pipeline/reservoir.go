@@ -0,0 +1,65 @@
+package pipeline
+
+import (
+	"math/rand/v2"
+	"slices"
+)
+
+// valueSamples is a uniform reservoir of a feature's raw values in a window, rendered as
+// truncated strings, so responders can see example values without reading the topic.
+type valueSamples struct {
+	values []string
+	seen   int64 // Values offered to the reservoir
+}
+
+// slot offers the reservoir a value, growing it up to size samples (reservoir sampling),
+// and returns the index the value is to be stored at, or -1 if it is not sampled. Callers
+// render the value only when it is.
+func (r *valueSamples) slot(size int) int {
+	r.seen++
+	if len(r.values) < size {
+		r.values = append(r.values, "")
+		return len(r.values) - 1
+	}
+	if i := rand.Int64N(r.seen); i < int64(len(r.values)) {
+		return int(i)
+	}
+	return -1
+}
+
+// samples returns a copy of the sampled values, nil for a nil reservoir.
+func (r *valueSamples) samples() []string {
+	if r == nil {
+		return nil
+	}
+	return slices.Clone(r.values)
+}
+
+// merge combines other into r, so r samples the values offered to either. Values are
+// drawn without replacement from each reservoir in proportion to the values it was
+// offered, up to the size of the larger one. other is left unchanged.
+func (r *valueSamples) merge(other *valueSamples) {
+	size := max(len(r.values), len(other.values))
+	a, b := slices.Clone(r.values), slices.Clone(other.values)
+	wa, wb := r.seen, other.seen
+	merged := make([]string, 0, size)
+	for len(merged) < size && (len(a) > 0 || len(b) > 0) {
+		if len(b) == 0 || (len(a) > 0 && rand.Int64N(wa+wb) < wa) {
+			merged, a = drawSample(merged, a)
+			wa--
+		} else {
+			merged, b = drawSample(merged, b)
+			wb--
+		}
+	}
+	r.values = merged
+	r.seen += other.seen
+}
+
+// drawSample moves a random value of from to to.
+func drawSample(to, from []string) ([]string, []string) {
+	i := rand.IntN(len(from))
+	to = append(to, from[i])
+	from[i] = from[len(from)-1]
+	return to, from[:len(from)-1]
+}
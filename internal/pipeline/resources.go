@@ -0,0 +1,66 @@
+package pipeline
+
+import (
+	"context"
+	runtimemetrics "runtime/metrics"
+	"sync"
+	"time"
+)
+
+// resourceInterval is how often the pipeline samples its own resource usage.
+const resourceInterval = 5 * time.Second
+
+// Runtime metrics read by the resource monitor, in the order of its samples.
+var resourceSamples = []string{
+	"/memory/classes/heap/objects:bytes",
+	"/sched/goroutines:goroutines",
+}
+
+// channelDepths returns the items buffered in the channels between the main pipeline
+// stages, by channel.
+func (p *Pipeline) channelDepths() map[string]int {
+	return map[string]int{
+		"raw_messages":        len(p.rawMessages),
+		"parsed_messages":     len(p.parsedMessages),
+		"aggregation_results": len(p.aggResults),
+	}
+}
+
+// runResourceMonitor exports the process's heap memory, goroutines and channel depths
+// until ctx is cancelled, and hands heap memory and consumer lag to load shedding so
+// the monitor sheds non-critical features before it runs out of memory.
+func (p *Pipeline) runResourceMonitor(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	samples := make([]runtimemetrics.Sample, len(resourceSamples))
+	for i, name := range resourceSamples {
+		samples[i].Name = name
+	}
+	ticker := time.NewTicker(resourceInterval)
+	defer ticker.Stop()
+	for {
+		p.observeResources(samples)
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// observeResources samples resource usage once.
+func (p *Pipeline) observeResources(samples []runtimemetrics.Sample) {
+	runtimemetrics.Read(samples)
+	heap := samples[0].Value.Uint64()
+	p.metrics.heapBytes.Set(float64(heap))
+	p.metrics.goroutines.Set(float64(samples[1].Value.Uint64()))
+	for channel, items := range p.channelDepths() {
+		p.metrics.channelDepth.WithLabelValues(channel).Set(float64(items))
+	}
+
+	var lag int64
+	if p.consumer != nil {
+		lag = p.consumer.Lag()
+	}
+	p.sampler.ObservePressure(heap, lag)
+}
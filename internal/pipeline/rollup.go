@@ -0,0 +1,108 @@
+package pipeline
+
+import (
+	"strings"
+	"time"
+
+	"github.com/sanspareilsmyn/featurelens/internal/config"
+)
+
+// rollups combine the evaluated windows of each feature into coarser resolutions, e.g.
+// 5m and 1h from 1m windows. Counts, means and variances combine exactly (see
+// otherSeries); statistics that do not, such as categories, are left out. A rollup is
+// complete once the window ending with it is evaluated, or, when the feature reported
+// no such window, once a window of the next rollup arrives. Only used by the alerter's
+// loop.
+type rollups struct {
+	sizes     []time.Duration
+	alignment config.WindowAlignmentConfig // Of the pipeline, shared with the rollups' boundaries
+	series    map[rollupKey]*otherSeries
+}
+
+// rollupKey identifies the rollup of a feature result series at one resolution.
+type rollupKey struct {
+	name string // Versioned feature name
+	size time.Duration
+}
+
+// rollupResult is a completed rollup of a feature's windows.
+type rollupResult struct {
+	resolution string // e.g. "5m"
+	result     AggregationResult
+}
+
+// newRollups returns the rollups of the sizes, nil without any.
+func newRollups(sizes []time.Duration, alignment config.WindowAlignmentConfig) *rollups {
+	if len(sizes) == 0 {
+		return nil
+	}
+	return &rollups{sizes: sizes, alignment: alignment, series: make(map[rollupKey]*otherSeries)}
+}
+
+// add rolls up a feature's window result, returning the rollups it completed. Rollups
+// no longer than the feature's windows, or not a multiple of them, are skipped.
+func (r *rollups) add(result AggregationResult) []rollupResult {
+	if r == nil || result.Segment != nil {
+		return nil
+	}
+	var completed []rollupResult
+	window := result.WindowEnd.Sub(result.WindowStart)
+	for _, size := range r.sizes {
+		if window <= 0 || size <= window || size%window != 0 {
+			continue
+		}
+		end := alignedWindowEnd(result.WindowStart, size, r.alignment)
+		key := rollupKey{name: result.FeatureName, size: size}
+		s, ok := r.series[key]
+		switch {
+		case !ok:
+			s = &otherSeries{}
+			r.series[key] = s
+		case end.Before(s.windowEnd):
+			continue // A window of a rollup already completed
+		case end.After(s.windowEnd):
+			completed = append(completed, s.complete(result.FeatureName, size)) // Its last windows had no messages
+		}
+
+		rolled := result
+		rolled.WindowStart, rolled.WindowEnd = end.Add(-size), end
+		s.merge(rolled)
+		if result.WindowEnd.Equal(end) {
+			completed = append(completed, s.complete(result.FeatureName, size))
+			delete(r.series, key)
+		}
+	}
+	return completed
+}
+
+// complete returns the rollup aggregated so far by s, of the feature name.
+func (s *otherSeries) complete(name string, size time.Duration) rollupResult {
+	result := s.result
+	result.FeatureName = name
+	return rollupResult{resolution: resolutionLabel(size), result: result}
+}
+
+// setRollupGauges exports a completed rollup on the rollup gauges, under the feature
+// label value given by the series limiter.
+func (m *Metrics) setRollupGauges(feature string, rollup rollupResult) {
+	result := rollup.result
+	labels := []string{feature, result.ModelVersion, rollup.resolution}
+	nullRate, missingRate, stdDev := resultRates(result)
+	m.rollupCount.WithLabelValues(labels...).Set(float64(result.Count))
+	m.rollupNullRate.WithLabelValues(labels...).Set(zeroIfNaN(nullRate))
+	m.rollupMissingRate.WithLabelValues(labels...).Set(zeroIfNaN(missingRate))
+	m.rollupMean.WithLabelValues(labels...).Set(zeroIfNaN(result.Mean))
+	m.rollupStdDev.WithLabelValues(labels...).Set(zeroIfNaN(stdDev))
+}
+
+// resolutionLabel formats a rollup size as a resolution label value, e.g. "5m" or "1h30m".
+func resolutionLabel(size time.Duration) string {
+	label := size.String()
+	if strings.HasSuffix(label, "m0s") {
+		label = strings.TrimSuffix(label, "0s")
+	}
+	if strings.HasSuffix(label, "h0m") {
+		label = strings.TrimSuffix(label, "0m")
+	}
+	return label
+}
@@ -0,0 +1,267 @@
+package pipeline
+
+import (
+	"math"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+
+	"github.com/sanspareilsmyn/featurelens/internal/config"
+	"github.com/sanspareilsmyn/featurelens/internal/logging"
+)
+
+// AdaptiveSampler decides per message whether a feature is processed.
+// Features with adaptive sampling enabled are switched to full resolution while
+// their metrics approach thresholds, with larger skew reservoirs (ReservoirSize), and
+// revert to their base rate once healthy.
+// While load shedding is active, normal- and low-priority features are additionally
+// sampled at the shedding rate of their priority; critical features are never shed.
+type AdaptiveSampler struct {
+	mu       sync.RWMutex
+	features map[string]*samplingState
+	shed     config.LoadSheddingConfig
+	backlog  atomic.Bool // The calculator's input buffer filled past the high watermark
+	pressure atomic.Bool // Heap memory or consumer lag exceeded their limit
+	series   *seriesLimiter
+	logger   *zap.Logger
+}
+
+// pressureRelease is the fraction of the heap and lag limits usage must fall back under
+// for shedding started by resource pressure to stop.
+const pressureRelease = 0.9
+
+type samplingState struct {
+	cfg      config.SamplingConfig
+	priority string
+	rateBits atomic.Uint64 // math.Float64bits of the effective rate, read on the hot path
+	grown    atomic.Bool   // Whether reservoirs are grown, read on the hot path
+
+	mu             sync.Mutex // Guards the fields below, updated once per window
+	boosted        bool
+	healthyWindows int
+}
+
+// NewAdaptiveSampler creates a sampler for the configured features, exporting to the
+// metrics of series. Sample rate gauges are only exported for features series admits.
+func NewAdaptiveSampler(features []config.FeatureConfig, shed config.LoadSheddingConfig, series *seriesLimiter, logger *zap.Logger) *AdaptiveSampler {
+	s := &AdaptiveSampler{
+		features: make(map[string]*samplingState, len(features)),
+		shed:     shed,
+		series:   series,
+		logger:   logger,
+	}
+	for _, f := range features {
+		if f.Pattern == "" {
+			s.Register(f)
+		}
+	}
+	return s
+}
+
+// Register starts tracking a feature, e.g. one discovered from a group pattern.
+func (s *AdaptiveSampler) Register(f config.FeatureConfig) {
+	state := &samplingState{cfg: f.Sampling, priority: f.Priority}
+	state.rateBits.Store(math.Float64bits(f.Sampling.Rate))
+
+	s.mu.Lock()
+	s.features[f.Name] = state
+	s.mu.Unlock()
+	s.exportRate(f.Name, f.Sampling.Rate)
+}
+
+func (s *AdaptiveSampler) state(featureName string) (*samplingState, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	state, ok := s.features[featureName]
+	return state, ok
+}
+
+// Sample reports whether the current message should be processed for the feature.
+func (s *AdaptiveSampler) Sample(featureName string) bool {
+	state, ok := s.state(featureName)
+	if !ok {
+		return true
+	}
+	rate := math.Float64frombits(state.rateBits.Load())
+	if rate < 1 && rand.Float64() >= rate {
+		return false
+	}
+	if s.shedding() {
+		if shedRate := s.shedRate(state.priority); shedRate < 1 && rand.Float64() >= shedRate {
+			s.series.metrics.loadShedObservations.WithLabelValues(state.priority).Inc()
+			return false
+		}
+	}
+	return true
+}
+
+// shedding reports whether load shedding is active, for either cause.
+func (s *AdaptiveSampler) shedding() bool {
+	return s.backlog.Load() || s.pressure.Load()
+}
+
+// exportShedding sets the shedding gauge after a change of either cause.
+func (s *AdaptiveSampler) exportShedding() {
+	active := 0.0
+	if s.shedding() {
+		active = 1
+	}
+	s.series.metrics.loadSheddingActive.Set(active)
+}
+
+// shedRate returns the fraction of sampled messages kept for a priority while shedding.
+func (s *AdaptiveSampler) shedRate(priority string) float64 {
+	switch priority {
+	case config.PriorityLow:
+		return s.shed.LowRate
+	case config.PriorityCritical:
+		return 1
+	default:
+		return s.shed.NormalRate
+	}
+}
+
+// ObserveLoad updates load shedding from how full the calculator's input buffer is,
+// starting at the high watermark and stopping at the low watermark.
+func (s *AdaptiveSampler) ObserveLoad(fill float64) {
+	if !s.shed.Enabled {
+		return
+	}
+	switch {
+	case fill >= s.shed.HighWatermark && !s.backlog.Load():
+		if s.backlog.CompareAndSwap(false, true) {
+			s.exportShedding()
+			s.logger.Warn("Calculator falling behind, shedding load from non-critical features",
+				zap.Float64("buffer_fill", fill),
+				zap.Float64("normal_rate", s.shed.NormalRate),
+				zap.Float64("low_rate", s.shed.LowRate),
+			)
+		}
+	case fill <= s.shed.LowWatermark && s.backlog.Load():
+		if s.backlog.CompareAndSwap(true, false) {
+			s.exportShedding()
+			s.logger.Info("Calculator caught up, load shedding stopped", zap.Float64("buffer_fill", fill))
+		}
+	}
+}
+
+// ObservePressure updates load shedding from the heap memory in use and the consumer lag:
+// it starts once either exceeds its limit and stops once both are back under
+// pressureRelease of theirs.
+func (s *AdaptiveSampler) ObservePressure(heapBytes uint64, lag int64) {
+	if !s.shed.Enabled || (s.shed.MaxHeapMB == 0 && s.shed.MaxLag == 0) {
+		return
+	}
+	heapMB := float64(heapBytes) / (1 << 20)
+	usage := 0.0 // Largest fraction of a limit in use
+	if s.shed.MaxHeapMB > 0 {
+		usage = heapMB / float64(s.shed.MaxHeapMB)
+	}
+	if s.shed.MaxLag > 0 {
+		usage = max(usage, float64(lag)/float64(s.shed.MaxLag))
+	}
+	switch {
+	case usage > 1 && !s.pressure.Load():
+		if s.pressure.CompareAndSwap(false, true) {
+			s.exportShedding()
+			s.logger.Warn("Resource limits exceeded, shedding load from non-critical features",
+				zap.Float64("heap_mb", heapMB),
+				zap.Int64("lag", lag),
+				zap.Float64("normal_rate", s.shed.NormalRate),
+				zap.Float64("low_rate", s.shed.LowRate),
+			)
+		}
+	case usage < pressureRelease && s.pressure.Load():
+		if s.pressure.CompareAndSwap(true, false) {
+			s.exportShedding()
+			s.logger.Info("Resource usage back under limits, load shedding stopped",
+				zap.Float64("heap_mb", heapMB),
+				zap.Int64("lag", lag),
+			)
+		}
+	}
+}
+
+// Rate returns the feature's current effective sampling rate.
+func (s *AdaptiveSampler) Rate(featureName string) float64 {
+	state, ok := s.state(featureName)
+	if !ok {
+		return 1
+	}
+	return math.Float64frombits(state.rateBits.Load())
+}
+
+// ReservoirSize returns the number of values a reservoir of the feature holds: base, or
+// base times the feature's reservoirBoost while it is boosted.
+func (s *AdaptiveSampler) ReservoirSize(featureName string, base int) int {
+	state, ok := s.state(featureName)
+	if !ok || !state.grown.Load() {
+		return base
+	}
+	return max(int(float64(base)*state.cfg.ReservoirBoost), base)
+}
+
+// Observe records whether a feature's latest window was near (or beyond) a threshold,
+// boosting it to full resolution or reverting it after enough healthy windows.
+func (s *AdaptiveSampler) Observe(featureName string, nearThreshold bool) {
+	state, ok := s.state(featureName)
+	if !ok || !state.cfg.Adaptive {
+		return
+	}
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	switch {
+	case nearThreshold:
+		state.healthyWindows = 0
+		if !state.boosted {
+			state.boosted = true
+			state.grown.Store(true)
+			s.setRate(featureName, state, 1)
+			s.logger.Info("Feature approaching thresholds, sampling at full resolution with larger reservoirs",
+				logging.Feature(featureName),
+				zap.Float64("base_rate", state.cfg.Rate),
+				zap.Float64("reservoir_boost", state.cfg.ReservoirBoost),
+			)
+		}
+	case state.boosted:
+		state.healthyWindows++
+		if state.healthyWindows >= state.cfg.CooldownWindows {
+			state.boosted = false
+			state.grown.Store(false)
+			s.setRate(featureName, state, state.cfg.Rate)
+			s.logger.Info("Feature healthy again, reverting to base sampling rate",
+				logging.Feature(featureName),
+				zap.Float64("base_rate", state.cfg.Rate),
+				zap.Int("healthy_windows", state.healthyWindows),
+			)
+		}
+	}
+}
+
+func (s *AdaptiveSampler) setRate(featureName string, state *samplingState, rate float64) {
+	state.rateBits.Store(math.Float64bits(rate))
+	s.exportRate(featureName, rate)
+}
+
+// exportRate sets a feature's sample rate gauge unless its label is folded; rates do
+// not aggregate.
+func (s *AdaptiveSampler) exportRate(featureName string, rate float64) {
+	if s.series.featureLabel(featureName) == featureName {
+		s.series.metrics.featureSampleRate.WithLabelValues(featureName).Set(rate)
+	}
+}
+
+// approachingUpper reports whether actual exceeds, or lies within margin of, an upper bound.
+// The margin is relative to the bound's magnitude.
+func approachingUpper(actual float64, bound *float64, margin float64) bool {
+	return bound != nil && !math.IsNaN(actual) && actual >= *bound-margin*math.Abs(*bound)
+}
+
+// approachingLower reports whether actual falls below, or lies within margin of, a lower bound.
+func approachingLower(actual float64, bound *float64, margin float64) bool {
+	return bound != nil && !math.IsNaN(actual) && actual <= *bound+margin*math.Abs(*bound)
+}
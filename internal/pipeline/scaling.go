@@ -0,0 +1,285 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"go.uber.org/zap"
+
+	"github.com/sanspareilsmyn/featurelens/internal/config"
+	"github.com/sanspareilsmyn/featurelens/internal/logging"
+	"github.com/sanspareilsmyn/featurelens/internal/message"
+)
+
+// mergerGroupSuffix gives the merger its own consumer group on the coordination topic.
+const mergerGroupSuffix = "-merger"
+
+// PartialPublisher writes a scaled-out instance's partial windows to the coordination topic.
+type PartialPublisher struct {
+	writer  *kafka.Writer
+	input   <-chan []byte
+	metrics *Metrics
+	logger  *zap.Logger
+
+	reporter *ErrorReporter // Reports failed publishes; nil discards them
+}
+
+// NewPartialPublisher creates a publisher writing the partials received from input to the
+// coordination topic on the consumed brokers.
+func NewPartialPublisher(kafkaCfg config.KafkaConfig, cfg config.ScalingConfig, input <-chan []byte, metrics *Metrics, logger *zap.Logger) *PartialPublisher {
+	return &PartialPublisher{
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(kafkaCfg.Brokers...),
+			Topic:        cfg.Topic,
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: kafka.RequireAll,
+			BatchTimeout: 10 * time.Millisecond, // Partials are few; don't hold them for a batch
+			ErrorLogger: kafka.LoggerFunc(func(msg string, args ...interface{}) {
+				logger.Error(fmt.Sprintf(msg, args...))
+			}),
+		},
+		input:   input,
+		metrics: metrics,
+		logger:  logger,
+	}
+}
+
+// Run publishes partials until the input channel is closed or ctx is done. Partials
+// that fail to be written are logged and dropped: the merger times the window out.
+func (p *PartialPublisher) Run(ctx context.Context) error {
+	defer func() {
+		if err := p.writer.Close(); err != nil {
+			p.logger.Warn("Failed to close coordination topic writer", zap.Error(err))
+		}
+	}()
+	for {
+		select {
+		case raw, ok := <-p.input:
+			if !ok {
+				return nil
+			}
+			if err := p.writer.WriteMessages(ctx, kafka.Message{Value: raw}); err != nil {
+				p.metrics.partialsPublished.WithLabelValues("failed").Inc()
+				p.logger.Error("Failed to publish partial window", zap.Error(err))
+				p.reporter.Report(&OpError{Component: ComponentScaling, Op: "publish", Severity: ErrorSeverityError, Retryable: true, Err: err})
+				continue
+			}
+			p.metrics.partialsPublished.WithLabelValues("published").Inc()
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// pendingWindow is a window whose partials are being merged.
+type pendingWindow struct {
+	window    *windowInfo
+	instances map[string]struct{} // Instances whose partial was merged
+	deadline  time.Time           // When the window is merged even if partials are missing
+}
+
+// WindowMerger combines the partial windows the instances publish to the coordination
+// topic. A window is emitted once every instance's partial was merged, or when the merge
+// timeout after its first partial passes; partials arriving later are dropped.
+type WindowMerger struct {
+	reader    *kafka.Reader
+	instances int
+	timeout   time.Duration
+	registry  *FeatureRegistry
+	output    chan<- *windowInfo
+	metrics   *Metrics
+	logger    *zap.Logger
+
+	pending map[time.Time]*pendingWindow
+	emitted map[time.Time]time.Time // When each recently merged window was emitted, to recognize late partials
+}
+
+// NewWindowMerger creates a merger reading the coordination topic in its own consumer
+// group, from the latest partials. The merge timeout defaults to one window size.
+func NewWindowMerger(kafkaCfg config.KafkaConfig, cfg config.ScalingConfig, windowSize time.Duration, registry *FeatureRegistry, output chan<- *windowInfo, metrics *Metrics, logger *zap.Logger) *WindowMerger {
+	timeout := cfg.MergeTimeout
+	if timeout == 0 {
+		timeout = windowSize
+	}
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:     kafkaCfg.Brokers,
+		GroupID:     kafkaCfg.GroupID + mergerGroupSuffix,
+		Topic:       cfg.Topic,
+		StartOffset: kafka.LastOffset,
+		Logger:      kafkaZapLogger{logger.Named("kafka-reader").WithOptions(zap.AddCallerSkip(1))},
+		ErrorLogger: kafkaZapErrorLogger{logger.Named("kafka-reader-error").WithOptions(zap.AddCallerSkip(1))},
+	})
+	logger.Info("Window merger created",
+		zap.String("topic", cfg.Topic),
+		zap.Int("instances", cfg.Instances),
+		zap.Duration("merge_timeout", timeout),
+	)
+	return &WindowMerger{
+		reader:    reader,
+		instances: cfg.Instances,
+		timeout:   timeout,
+		registry:  registry,
+		output:    output,
+		metrics:   metrics,
+		logger:    logger,
+		pending:   make(map[time.Time]*pendingWindow),
+		emitted:   make(map[time.Time]time.Time),
+	}
+}
+
+// Run merges partials until ctx is done or reading the coordination topic fails. Windows
+// still pending are left for Flush.
+func (m *WindowMerger) Run(ctx context.Context) error {
+	partials := make(chan kafka.Message)
+	fetchErr := make(chan error, 1)
+	go func() {
+		for {
+			msg, err := m.reader.ReadMessage(ctx)
+			if err != nil {
+				fetchErr <- err
+				return
+			}
+			select {
+			case partials <- msg:
+			case <-ctx.Done():
+				fetchErr <- ctx.Err()
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(min(m.timeout/4, time.Second))
+	defer ticker.Stop()
+	for {
+		select {
+		case msg := <-partials:
+			m.add(ctx, msg.Value, time.Now())
+		case now := <-ticker.C:
+			m.emitDue(ctx, now)
+		case err := <-fetchErr:
+			if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+				return context.Canceled
+			}
+			return fmt.Errorf("%w: %w", ErrKafkaFetchFailed, err)
+		}
+	}
+}
+
+// Flush emits every pending window, oldest first, with the partials merged so far, then
+// closes the merger's reader. Sends wait for room until ctx is done.
+func (m *WindowMerger) Flush(ctx context.Context) {
+	ends := make([]time.Time, 0, len(m.pending))
+	for end := range m.pending {
+		ends = append(ends, end)
+	}
+	sort.Slice(ends, func(i, j int) bool { return ends[i].Before(ends[j]) })
+	for _, end := range ends {
+		m.emit(ctx, end, "timeout")
+	}
+	if err := m.reader.Close(); err != nil {
+		m.logger.Warn("Failed to close coordination topic reader", zap.Error(err))
+	}
+}
+
+// add merges a partial into its pending window, emitting the window once every instance
+// has reported.
+func (m *WindowMerger) add(ctx context.Context, raw []byte, now time.Time) {
+	p, w, err := decodePartial(raw)
+	if err != nil {
+		m.metrics.partialsRejected.WithLabelValues("invalid").Inc()
+		m.logger.Warn("Dropping invalid partial window", zap.Error(err))
+		return
+	}
+	m.discover(p)
+
+	if _, ok := m.emitted[p.WindowEnd]; ok {
+		m.metrics.partialsRejected.WithLabelValues("late").Inc()
+		m.logger.Warn("Dropping partial of an already merged window",
+			zap.String("instance", p.Instance),
+			logging.WindowEnd(p.WindowEnd),
+		)
+		return
+	}
+	pending, ok := m.pending[p.WindowEnd]
+	switch {
+	case !ok:
+		pending = &pendingWindow{window: w, instances: make(map[string]struct{}), deadline: now.Add(m.timeout)}
+		m.pending[p.WindowEnd] = pending
+	case hasInstance(pending, p.Instance):
+		m.metrics.partialsRejected.WithLabelValues("duplicate").Inc()
+		m.logger.Warn("Dropping duplicate partial window",
+			zap.String("instance", p.Instance),
+			logging.WindowEnd(p.WindowEnd),
+		)
+		return
+	default:
+		if err := pending.window.merge(w); err != nil {
+			m.logger.Warn("Partial window sketches could not be merged, keeping those merged so far",
+				zap.String("instance", p.Instance),
+				logging.WindowEnd(p.WindowEnd),
+				zap.Error(err),
+			)
+		}
+	}
+	pending.instances[p.Instance] = struct{}{}
+	if len(pending.instances) >= m.instances {
+		m.emit(ctx, p.WindowEnd, "complete")
+	}
+}
+
+func hasInstance(pending *pendingWindow, instance string) bool {
+	_, ok := pending.instances[instance]
+	return ok
+}
+
+// discover registers the pattern-matched features an instance discovered, so the merged
+// window's stats are evaluated like the instance's own.
+func (m *WindowMerger) discover(p *partialWindow) {
+	fields := make(message.DynamicMessage, len(p.Features))
+	for _, f := range p.Features {
+		fields[f.Name] = nil
+	}
+	m.registry.Discover(fields)
+}
+
+// emitDue emits the pending windows whose merge timeout has passed, oldest first, and
+// forgets windows merged long enough ago that no partial of theirs can still arrive.
+func (m *WindowMerger) emitDue(ctx context.Context, now time.Time) {
+	var due []time.Time
+	for end, pending := range m.pending {
+		if !now.Before(pending.deadline) {
+			due = append(due, end)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].Before(due[j]) })
+	for _, end := range due {
+		m.logger.Warn("Merge timeout reached, evaluating window without every instance's partial",
+			logging.WindowEnd(end),
+			zap.Int("instances_reported", len(m.pending[end].instances)),
+			zap.Int("instances_expected", m.instances),
+		)
+		m.emit(ctx, end, "timeout")
+	}
+	for end, at := range m.emitted {
+		if now.Sub(at) > 10*m.timeout {
+			delete(m.emitted, end)
+		}
+	}
+}
+
+// emit sends a pending window downstream, waiting for room until ctx is done.
+func (m *WindowMerger) emit(ctx context.Context, end time.Time, outcome string) {
+	pending := m.pending[end]
+	delete(m.pending, end)
+	m.emitted[end] = time.Now()
+	m.metrics.windowsMerged.WithLabelValues(outcome).Inc()
+	select {
+	case m.output <- pending.window:
+	case <-ctx.Done():
+		m.logger.Warn("Dropping merged window on shutdown", logging.WindowEnd(end))
+	}
+}
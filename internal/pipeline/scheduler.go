@@ -0,0 +1,67 @@
+package pipeline
+
+import (
+	"time"
+
+	"github.com/sanspareilsmyn/featurelens/internal/config"
+)
+
+// flushScheduler times the calculator's flushes at the end of every window plus the flush
+// grace. Flushes that fell due while the processing loop was busy or the host suspended
+// are coalesced into the latest one, and while the calculator is idle no flush is
+// scheduled at all, so a pipeline without traffic does not wake up every window. It is
+// only used by the processing loop.
+type flushScheduler struct {
+	cfg     config.PipelineConfig
+	clock   Clock
+	due     time.Time        // Of the scheduled flush, or of the last one run while sleeping
+	timer   <-chan time.Time // Fires at due, nil while sleeping
+	metrics *Metrics
+}
+
+func newFlushScheduler(cfg config.PipelineConfig, clock Clock, metrics *Metrics) *flushScheduler {
+	return &flushScheduler{cfg: cfg, clock: clock, metrics: metrics}
+}
+
+// schedule arms the timer for the first flush after now.
+func (s *flushScheduler) schedule(now time.Time) {
+	s.due = nextFlush(s.cfg, now)
+	s.timer = s.clock.After(s.due.Sub(now))
+}
+
+// lastDue returns the latest flush at or before now.
+func (s *flushScheduler) lastDue(now time.Time) time.Time {
+	return nextFlush(s.cfg, now).Add(-s.cfg.WindowSize)
+}
+
+// fire returns the time of the flush to run as the timer fires at now: the latest one due,
+// which stands for those missed since the scheduled one. The timer must be scheduled again
+// or left asleep.
+func (s *flushScheduler) fire(now time.Time) time.Time {
+	tick := s.due
+	if last := s.lastDue(now); last.After(tick) {
+		s.metrics.flushes.WithLabelValues("coalesced").Add(float64(last.Sub(tick) / s.cfg.WindowSize))
+		tick = last
+	}
+	s.metrics.flushes.WithLabelValues("run").Inc()
+	s.due, s.timer = tick, nil
+	return tick
+}
+
+// sleeping reports whether no flush is scheduled.
+func (s *flushScheduler) sleeping() bool {
+	return s.timer == nil
+}
+
+// wake schedules flushes again as a message arrives at now. If flushes fell due while
+// sleeping, it returns the latest one to run first, so the watermark and sessions catch
+// up as if they had run.
+func (s *flushScheduler) wake(now time.Time) (tick time.Time, ok bool) {
+	last := s.lastDue(now)
+	if ok = last.After(s.due); ok {
+		s.metrics.flushes.WithLabelValues("idle").Add(float64(last.Sub(s.due)/s.cfg.WindowSize - 1))
+		s.metrics.flushes.WithLabelValues("run").Inc()
+	}
+	s.schedule(now)
+	return last, ok
+}
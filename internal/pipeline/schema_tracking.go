@@ -0,0 +1,240 @@
+package pipeline
+
+import (
+	"encoding/hex"
+	"hash/fnv"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/sanspareilsmyn/featurelens/internal/config"
+	"github.com/sanspareilsmyn/featurelens/internal/message"
+)
+
+// Value types of message fields, in the order schemas list them.
+const (
+	nullType = iota
+	booleanType
+	numberType
+	stringType
+	arrayType
+	objectType
+	otherType
+)
+
+var fieldTypeNames = [...]string{"null", "boolean", "number", "string", "array", "object", "other"}
+
+// maxSchemaChangeFields bounds the fields each list of a schema change payload holds, e.g.
+// when a producer starts sending an unrelated payload.
+const maxSchemaChangeFields = 50
+
+// fieldTypeCounts counts the values of a message field by type, indexed like
+// fieldTypeNames.
+type fieldTypeCounts [len(fieldTypeNames)]int64
+
+// valueType returns the index of a decoded value's type in fieldTypeNames.
+func valueType(v interface{}) int {
+	switch v.(type) {
+	case nil:
+		return nullType
+	case bool:
+		return booleanType
+	case float64, float32, int, int64, uint64:
+		return numberType
+	case string:
+		return stringType
+	case []interface{}:
+		return arrayType
+	case map[string]interface{}, message.DynamicMessage:
+		return objectType
+	default:
+		return otherType
+	}
+}
+
+// observeSchema counts the value types of a message's fields in its window. Fields past
+// maxFields and ignored ones are not counted.
+func (c *Calculator) observeSchema(msg message.DynamicMessage, windowEnd time.Time) {
+	cfg := c.config.SchemaTracking
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	windowState := c.getOrCreateWindow(windowEnd)
+	if windowState.fields == nil {
+		windowState.fields = make(map[string]*fieldTypeCounts)
+	}
+	for field, v := range msg {
+		counts, ok := windowState.fields[field]
+		if !ok {
+			if field == message.TopicKey || field == message.PartitionKey || len(windowState.fields) >= cfg.MaxFields || ignoredField(cfg.IgnoreFields, field) {
+				continue
+			}
+			counts = &fieldTypeCounts{}
+			windowState.fields[field] = counts
+		}
+		counts[valueType(v)]++
+	}
+}
+
+func ignoredField(patterns []string, field string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, field); matched { // Validated at config load
+			return true
+		}
+	}
+	return false
+}
+
+// messageSchema maps the fields of the messages to their value types, as bit sets of
+// fieldTypeNames indexes.
+type messageSchema map[string]uint8
+
+// nextSchema returns the schema of a window of messages given the previous window's. A
+// field or type is added once it appears in at least minShare of the messages and kept
+// as long as it appears at all. Null only counts as a field's type while it has no other.
+func nextSchema(previous messageSchema, fields map[string]fieldTypeCounts, messages int64, minShare float64) messageSchema {
+	next := make(messageSchema, len(fields))
+	for field, counts := range fields {
+		var seen, frequent uint8
+		for t, n := range counts {
+			if n == 0 {
+				continue
+			}
+			seen |= 1 << t
+			if float64(n) >= minShare*float64(messages) {
+				frequent |= 1 << t
+			}
+		}
+		_, known := previous[field]
+		if !known && frequent == 0 {
+			continue // A rare new field
+		}
+		nonNull := seen &^ (1 << nullType)
+		types := (previous[field] | frequent) & nonNull
+		if types == 0 {
+			types = nonNull
+		}
+		if types == 0 {
+			types = 1 << nullType
+		}
+		next[field] = types
+	}
+	return next
+}
+
+// typeNames lists the names of a bit set of types.
+func typeNames(types uint8) []string {
+	var names []string
+	for t, name := range fieldTypeNames {
+		if types&(1<<t) != 0 {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// fingerprint hashes the schema's fields and types, so equal schemas have equal
+// fingerprints whatever the order their fields were seen in.
+func (s messageSchema) fingerprint() string {
+	h := fnv.New64a()
+	for _, field := range sortedFields(s) {
+		h.Write([]byte(field + ":" + strings.Join(typeNames(s[field]), "|") + "\n"))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// SchemaChange is the difference between the message schemas of two windows, its lists
+// sorted by field name.
+type SchemaChange struct {
+	Fingerprint         string
+	PreviousFingerprint string
+	Added               []SchemaField
+	Removed             []SchemaField
+	TypeChanged         []SchemaTypeChange
+}
+
+// SchemaField is a field of a message schema and its value types.
+type SchemaField struct {
+	Field string
+	Types []string
+}
+
+// SchemaTypeChange is a field whose value types changed.
+type SchemaTypeChange struct {
+	Field string
+	From  []string
+	To    []string
+}
+
+// diffSchemas returns the fields added, removed and retyped from previous to next.
+func diffSchemas(previous, next messageSchema) *SchemaChange {
+	change := &SchemaChange{}
+	for _, field := range sortedFields(next) {
+		if from, known := previous[field]; !known {
+			change.Added = append(change.Added, SchemaField{Field: field, Types: typeNames(next[field])})
+		} else if from != next[field] {
+			change.TypeChanged = append(change.TypeChanged, SchemaTypeChange{Field: field, From: typeNames(from), To: typeNames(next[field])})
+		}
+	}
+	for _, field := range sortedFields(previous) {
+		if _, ok := next[field]; !ok {
+			change.Removed = append(change.Removed, SchemaField{Field: field, Types: typeNames(previous[field])})
+		}
+	}
+	return change
+}
+
+func sortedFields(s messageSchema) []string {
+	fields := make([]string, 0, len(s))
+	for field := range s {
+		fields = append(fields, field)
+	}
+	slices.Sort(fields)
+	return fields
+}
+
+// processSchema updates the message schema with a completed window's fields, raising a
+// schema_change violation against the topic when its fingerprint changed. The first
+// window with messages sets the schema changes are detected against.
+func (a *Alerter) processSchema(sugar *zap.SugaredLogger, result ThroughputResult) {
+	if !a.schemaCfg.Enabled || result.Count == 0 {
+		return
+	}
+	next := nextSchema(a.schema, result.fields, result.Count, a.schemaCfg.MinShare)
+	fingerprint := next.fingerprint()
+	a.metrics.schemaFields.Set(float64(len(next)))
+	if fingerprint == a.schemaFingerprint {
+		a.schema = next
+		return
+	}
+	if a.schemaFingerprint != "" {
+		a.metrics.schemaInfo.DeleteLabelValues(a.schemaFingerprint)
+	}
+	a.metrics.schemaInfo.WithLabelValues(fingerprint).Set(1)
+
+	if a.schema != nil {
+		change := diffSchemas(a.schema, next)
+		change.Fingerprint, change.PreviousFingerprint = fingerprint, a.schemaFingerprint
+		changed := len(change.Added) + len(change.Removed) + len(change.TypeChanged)
+		a.metrics.schemaChanges.WithLabelValues("added").Add(float64(len(change.Added)))
+		a.metrics.schemaChanges.WithLabelValues("removed").Add(float64(len(change.Removed)))
+		a.metrics.schemaChanges.WithLabelValues("type_changed").Add(float64(len(change.TypeChanged)))
+		window := AggregationResult{FeatureName: a.topic, WindowStart: result.WindowStart, WindowEnd: result.WindowEnd}
+		topicCfg := config.FeatureConfig{
+			Name: a.topic,
+			Tags: map[string]string{"source": "schema", "topic": a.topic},
+		}
+		v := newViolation(window, "schema_change", ">", float64(changed), 0)
+		v.SchemaChange = change
+		a.reportViolation(sugar, topicCfg, v)
+	} else {
+		sugar.Infow("Message schema observed",
+			zap.String("fingerprint", fingerprint),
+			zap.Int("fields", len(next)),
+		)
+	}
+	a.schema, a.schemaFingerprint = next, fingerprint
+}
@@ -0,0 +1,142 @@
+package pipeline
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math"
+
+	"github.com/sanspareilsmyn/featurelens/internal/config"
+	"github.com/sanspareilsmyn/featurelens/internal/expr"
+	"github.com/sanspareilsmyn/featurelens/internal/luascript"
+	"github.com/sanspareilsmyn/featurelens/internal/message"
+)
+
+// scriptStep is a script step with its compiled expressions and Lua script.
+type scriptStep struct {
+	config.ScriptStepConfig
+	expr   *expr.Expr        // set steps only
+	lua    *luascript.Script // lua steps only
+	luaErr error             // Why lua is nil, e.g. its file changed since the config was loaded
+	when   *expr.Expr        // nil to run on every message
+}
+
+// withScript wraps parse so every decoded message is transformed by the script's steps,
+// in order. A step that fails on a message, e.g. an unpack of a field that does not hold
+// an encoded object, leaves the message as it was and the following steps still run.
+func withScript(parse parseFunc, steps []config.ScriptStepConfig, metrics *Metrics) parseFunc {
+	if len(steps) == 0 {
+		return parse
+	}
+	script := compileScript(steps, "", metrics)
+
+	return func(raw rawMessage) ([]message.DynamicMessage, error) {
+		msgs, err := parse(raw)
+		for _, msg := range msgs {
+			script(msg)
+		}
+		return msgs, err
+	}
+}
+
+// compileScript returns a function running the script's steps on a message. Step failures
+// are counted with the step's label prefixed with prefix.
+func compileScript(steps []config.ScriptStepConfig, prefix string, metrics *Metrics) func(message.DynamicMessage) {
+	compiled := make([]scriptStep, len(steps))
+	labels := make([]string, len(steps))
+	for i, s := range steps {
+		compiled[i] = scriptStep{ScriptStepConfig: s}
+		switch s.Op {
+		case config.ScriptSet:
+			compiled[i].expr, _ = expr.Compile(s.Expr) // Validated at config load
+		case config.ScriptLua:
+			name, source, err := s.LuaSource()
+			if err == nil {
+				compiled[i].lua, err = luascript.Compile(name, source, s.Timeout)
+			}
+			compiled[i].luaErr = err
+		}
+		if s.When != "" {
+			compiled[i].when, _ = expr.Compile(s.When)
+		}
+		labels[i] = fmt.Sprintf("%s%d:%s", prefix, i, s.Op)
+	}
+
+	return func(msg message.DynamicMessage) {
+		for i, step := range compiled {
+			if step.when != nil {
+				if match, evalErr := step.when.EvalBool(expr.MapEnv(msg)); evalErr != nil || !match {
+					continue
+				}
+			}
+			if stepErr := step.apply(msg); stepErr != nil {
+				metrics.scriptErrors.WithLabelValues(labels[i]).Inc()
+			}
+		}
+	}
+}
+
+// apply runs the step on a message. Renames and deletes of absent fields do nothing.
+func (s scriptStep) apply(msg message.DynamicMessage) error {
+	switch s.Op {
+	case config.ScriptRename:
+		if v, ok := msg[s.Field]; ok {
+			msg[s.To] = v
+			delete(msg, s.Field)
+		}
+	case config.ScriptDelete:
+		delete(msg, s.Field)
+	case config.ScriptSet:
+		v, err := s.expr.Eval(expr.MapEnv(msg))
+		if err != nil {
+			return err
+		}
+		if f, ok := v.(float64); ok && (math.IsNaN(f) || math.IsInf(f, 0)) {
+			v = nil
+		}
+		msg[s.Field] = v
+	case config.ScriptUnpack:
+		if !msg.HasNonNull(s.Field) {
+			return nil
+		}
+		object, err := unpackObject(msg[s.Field], s.Encoding)
+		if err != nil {
+			return err
+		}
+		for k, v := range object {
+			msg[s.Prefix+k] = v
+		}
+	case config.ScriptLua:
+		if s.lua == nil {
+			return s.luaErr
+		}
+		return s.lua.Transform(msg)
+	}
+	return nil
+}
+
+// unpackObject decodes the object held by a field: an already decoded object, or a string
+// holding a JSON object, base64-encoded with the base64 encoding.
+func unpackObject(v interface{}, encoding string) (map[string]interface{}, error) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if encoding == config.EncodingBase64 {
+			return nil, fmt.Errorf("%w: expected a base64 string, got an object", ErrUnpackFailed)
+		}
+		return v, nil
+	case string:
+		raw := []byte(v)
+		if encoding == config.EncodingBase64 {
+			var err error
+			if raw, err = base64.StdEncoding.DecodeString(v); err != nil {
+				return nil, fmt.Errorf("%w: %w", ErrUnpackFailed, err)
+			}
+		}
+		object, err := message.ParseDynamicJSON(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrUnpackFailed, err)
+		}
+		return object, nil
+	default:
+		return nil, fmt.Errorf("%w: unsupported value of type %T", ErrUnpackFailed, v)
+	}
+}
@@ -0,0 +1,52 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/sanspareilsmyn/featurelens/internal/config"
+)
+
+// runSecretRefresher fetches the secrets the configuration references every
+// secrets.refreshInterval. Components keep the values they were built with, so a rotated
+// secret stops the pipeline with ErrSecretsRotated, for the restart of the process (e.g.
+// by its orchestrator) to apply it. Failed fetches are logged and retried at the next
+// refresh: the secrets fetched at startup stay valid until rotated.
+func (p *Pipeline) runSecretRefresher(ctx context.Context, wg *sync.WaitGroup, errChan chan<- error) {
+	defer wg.Done()
+
+	p.logger.Debug("Starting secret refresher goroutine...")
+	defer p.logger.Debug("Secret refresher goroutine finished")
+
+	ticker := time.NewTicker(p.cfg.Secrets.RefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		changed, err := config.RefreshSecrets(ctx, p.cfg)
+		switch {
+		case ctx.Err() != nil:
+			return
+		case err != nil:
+			p.metrics.secretRefreshes.WithLabelValues("failed").Inc()
+			p.logger.Warn("Failed to refresh secrets", zap.Error(err))
+			p.reporter.Report(&OpError{Component: ComponentSecrets, Op: "refresh", Severity: ErrorSeverityWarning, Retryable: true, Err: err})
+		case len(changed) > 0:
+			p.metrics.secretRefreshes.WithLabelValues("rotated").Inc()
+			p.logger.Warn("Secrets rotated, stopping to restart with them", zap.Strings("settings", changed))
+			errChan <- fmt.Errorf("%w: %s", ErrSecretsRotated, strings.Join(changed, ", "))
+			return
+		default:
+			p.metrics.secretRefreshes.WithLabelValues("unchanged").Inc()
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package pipeline
+
+import (
+	"container/list"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/sanspareilsmyn/featurelens/internal/config"
+	"github.com/sanspareilsmyn/featurelens/internal/message"
+)
+
+// session is the running summary of one entity's session.
+type session struct {
+	entity      string
+	first, last time.Time
+	events      int64
+	sums        []float64     // Of the configured fields, indexed like them
+	counts      []int64       // Numerical values of the configured fields
+	carried     []interface{} // Values of the carried fields in the session's latest message
+}
+
+// sessionTracker groups the messages of each entity into gap-based sessions. It is only
+// used by the calculator's processing loop. A nil tracker tracks no session.
+type sessionTracker struct {
+	cfg   config.SessionConfig
+	carry []string   // Message fields copied from the session's latest message into its summary
+	lru   *list.List // Of *session, most recently active first
+	open  map[string]*list.Element
+
+	metrics *Metrics
+}
+
+// newSessionTracker creates a tracker for the configured sessions, or returns nil without
+// them. The summaries carry the topic, tenant and model version of the session's latest
+// message, and the groupBy fields of the session features.
+func newSessionTracker(cfg config.PipelineConfig, features []config.FeatureConfig, metrics *Metrics) *sessionTracker {
+	if cfg.Sessions.EntityField == "" {
+		return nil
+	}
+	carry := []string{message.TopicKey}
+	for _, field := range []string{cfg.TenantField, cfg.VersionField} {
+		if field != "" {
+			carry = append(carry, field)
+		}
+	}
+	for _, f := range features {
+		if f.Scope == config.ScopeSession && f.GroupBy != "" {
+			carry = append(carry, f.GroupBy)
+		}
+	}
+	return &sessionTracker{
+		cfg:   cfg.Sessions,
+		carry: carry,
+		lru:   list.New(),
+		open:  make(map[string]*list.Element),
+
+		metrics: metrics,
+	}
+}
+
+// observe adds a message to its entity's session, opening one if needed. Messages without
+// the entity field are ignored. It returns the sessions closed early to stay within the
+// open session limit.
+func (t *sessionTracker) observe(msg message.DynamicMessage, now time.Time) []*session {
+	if t == nil || !msg.HasNonNull(t.cfg.EntityField) {
+		return nil
+	}
+	entity := groupValue(msg, t.cfg.EntityField)
+	e, ok := t.open[entity]
+	if !ok {
+		s := &session{
+			entity:  entity,
+			first:   now,
+			sums:    make([]float64, len(t.cfg.Fields)),
+			counts:  make([]int64, len(t.cfg.Fields)),
+			carried: make([]interface{}, len(t.carry)),
+		}
+		e = t.lru.PushFront(s)
+		t.open[entity] = e
+	} else {
+		t.lru.MoveToFront(e)
+	}
+	s := e.Value.(*session)
+	s.last = now
+	s.events++
+	for i, field := range t.cfg.Fields {
+		if v, ok := msg.GetFloat64(field); ok {
+			s.sums[i] += *v
+			s.counts[i]++
+		}
+	}
+	for i, field := range t.carry {
+		s.carried[i] = msg[field]
+	}
+
+	var evicted []*session
+	for t.lru.Len() > t.cfg.MaxOpen {
+		evicted = append(evicted, t.close(t.lru.Back()))
+	}
+	if len(evicted) > 0 {
+		t.metrics.sessionsClosed.WithLabelValues("evicted").Add(float64(len(evicted)))
+	}
+	t.metrics.sessionsOpen.Set(float64(t.lru.Len()))
+	return evicted
+}
+
+// expire closes the sessions whose gap elapsed by cutoff, least recently active first.
+func (t *sessionTracker) expire(cutoff time.Time) []*session {
+	if t == nil {
+		return nil
+	}
+	var expired []*session
+	for e := t.lru.Back(); e != nil && !t.expiry(e.Value.(*session)).After(cutoff); e = t.lru.Back() {
+		expired = append(expired, t.close(e))
+	}
+	t.metrics.sessionsClosed.WithLabelValues("gap").Add(float64(len(expired)))
+	t.metrics.sessionsOpen.Set(float64(t.lru.Len()))
+	return expired
+}
+
+// len returns the number of open sessions.
+func (t *sessionTracker) len() int {
+	if t == nil {
+		return 0
+	}
+	return t.lru.Len()
+}
+
+// expiry returns the time a session closes unless its entity is active again.
+func (t *sessionTracker) expiry(s *session) time.Time {
+	return s.last.Add(t.cfg.Gap)
+}
+
+// closeAll closes every open session.
+func (t *sessionTracker) closeAll() []*session {
+	if t == nil {
+		return nil
+	}
+	var closed []*session
+	for e := t.lru.Back(); e != nil; e = t.lru.Back() {
+		closed = append(closed, t.close(e))
+	}
+	t.metrics.sessionsClosed.WithLabelValues("drained").Add(float64(len(closed)))
+	t.metrics.sessionsOpen.Set(0)
+	return closed
+}
+
+func (t *sessionTracker) close(e *list.Element) *session {
+	s := t.lru.Remove(e).(*session)
+	delete(t.open, s.entity)
+	return s
+}
+
+// summary returns the record of a closed session aggregated by session features: its
+// entity, config.SessionEventsField, config.SessionDurationField, the sum and mean of the
+// configured fields (null without numerical values) and the carried fields.
+func (t *sessionTracker) summary(s *session) message.DynamicMessage {
+	msg := make(message.DynamicMessage, 3+2*len(t.cfg.Fields)+len(t.carry))
+	for i, field := range t.carry {
+		if s.carried[i] != nil {
+			msg[field] = s.carried[i]
+		}
+	}
+	msg[t.cfg.EntityField] = s.entity
+	msg[config.SessionEventsField] = float64(s.events)
+	msg[config.SessionDurationField] = s.last.Sub(s.first).Seconds()
+	for i, field := range t.cfg.Fields {
+		msg[field+".sum"], msg[field+".mean"] = nil, nil
+		if s.counts[i] > 0 {
+			msg[field+".sum"] = s.sums[i]
+			msg[field+".mean"] = s.sums[i] / float64(s.counts[i])
+		}
+	}
+	return msg
+}
+
+// expireSessions closes the sessions whose gap elapsed by cutoff, each in the window its
+// gap elapsed in.
+func (c *Calculator) expireSessions(cutoff time.Time) {
+	for _, s := range c.sessions.expire(cutoff) {
+		expiry := c.sessions.expiry(s)
+		c.closeSession(s, windowEnd(c.config, expiry))
+	}
+}
+
+// closeOpenSessions closes every open session in the window in progress at now, like the
+// partial window is flushed when the pipeline drains.
+func (c *Calculator) closeOpenSessions(now time.Time) {
+	closed := c.sessions.closeAll()
+	if len(closed) > 0 {
+		c.logger.Info("Closing open sessions", zap.Int("session_count", len(closed)))
+	}
+	for _, s := range closed {
+		c.closeSession(s, windowEnd(c.config, now))
+	}
+}
+
+// closeSession aggregates the summary of a closed session into the session features of
+// the window ending at windowEnd, or of the earliest window not flushed yet in event time.
+func (c *Calculator) closeSession(s *session, windowEnd time.Time) {
+	if !windowEnd.After(c.watermark) {
+		windowEnd = c.openWindowEnd()
+	}
+	summary := c.sessions.summary(s)
+	version := messageVersion(summary, c.config.VersionField)
+	tenant := messageTenant(summary, c.config.TenantField)
+	topic, _ := summary[message.TopicKey].(string)
+	for _, featureCfg := range c.features() {
+		if featureCfg.Scope != config.ScopeSession || !inTenant(featureCfg, c.config.TenantField, tenant) || !inTopics(featureCfg, topic) {
+			continue
+		}
+		c.updateFeatureStats(summary, featureCfg, windowKey{end: windowEnd}, version)
+	}
+}
@@ -0,0 +1,431 @@
+package pipeline
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/sanspareilsmyn/featurelens/internal/config"
+	"github.com/sanspareilsmyn/featurelens/internal/logging"
+	"github.com/sanspareilsmyn/featurelens/internal/schema"
+	"github.com/sanspareilsmyn/featurelens/internal/signing"
+	"github.com/sanspareilsmyn/featurelens/internal/sink"
+)
+
+// ledgerExpireInterval is how often delivered events past the dedup retention are forgotten.
+const ledgerExpireInterval = time.Minute
+
+// SinkDispatcher queues emitted payloads and delivers them in batches to every
+// configured sink that accepts their kind, tenant, feature and check, and for alerts,
+// that they were routed to if the sink is named by routes. Each sink is delivered to
+// concurrently from a queue of its own. Failed deliveries are retried with the same
+// events, and events a sink already received are not delivered to it again, so that
+// each event reaches each sink once unless it failed for good. A sink that keeps failing
+// has its circuit opened, and its undelivered events are buffered and redelivered once it
+// recovers. Internal errors are only delivered to the sinks they name.
+type SinkDispatcher struct {
+	cfg        config.SinksConfig
+	workers    []*sinkWorker   // One per output
+	routed     map[string]bool // Sinks named by routes
+	templated  bool            // Whether some sink has a template, so alerts need a context
+	input      chan sink.Event
+	ledger     *deliveryLedger // nil when deduplication is disabled
+	lastExpire time.Time
+	metrics    *Metrics
+	logger     *zap.Logger
+	signer     signing.Signer // Optional; seals window results and violations when set
+
+	// Operational failures are reported to reporter, and the internal_error events it
+	// queues on internalErrors are delivered to the sinks they name.
+	reporter       *ErrorReporter
+	internalErrors <-chan sink.Event
+}
+
+// NewSinkDispatcher builds the configured sinks and loads the delivery ledger.
+func NewSinkDispatcher(cfg config.SinksConfig, metrics *Metrics, logger *zap.Logger) (*SinkDispatcher, error) {
+	var ledger *deliveryLedger
+	if cfg.DedupRetention > 0 {
+		var err error
+		if ledger, err = openDeliveryLedger(cfg.LedgerPath, cfg.DedupRetention); err != nil {
+			return nil, err
+		}
+	}
+	outputs, err := sink.Build(cfg.Outputs, logger)
+	if err != nil {
+		if ledger != nil {
+			_ = ledger.close()
+		}
+		return nil, fmt.Errorf("%w: %w", ErrSinkCreationFailed, err)
+	}
+
+	names := make([]string, len(outputs))
+	workers := make([]*sinkWorker, len(outputs))
+	templated := false
+	for i, out := range outputs {
+		names[i] = out.Name
+		templated = templated || out.Templated()
+		retries, backoff := cfg.Outputs[i].Retries(cfg)
+		state := &sinkState{
+			retries: retries,
+			backoff: backoff,
+			breaker: circuitBreaker{threshold: cfg.CircuitBreaker.FailureThreshold, openFor: cfg.CircuitBreaker.OpenDuration},
+		}
+		workers[i] = newSinkWorker(out, state, cmp.Or(cfg.Outputs[i].QueueSize, cfg.QueueSize))
+		metrics.sinkCircuit.WithLabelValues(out.Name).Set(float64(circuitClosed))
+		metrics.sinkOverflow.WithLabelValues(out.Name).Set(0)
+		metrics.sinkQueue.WithLabelValues(out.Name).Set(0)
+	}
+	logger.Info("Sink dispatcher initialized",
+		zap.Strings("sinks", names),
+		zap.Duration("flush_interval", cfg.FlushInterval),
+		zap.Int("max_batch_size", cfg.MaxBatchSize),
+		zap.Int("max_retries", cfg.MaxRetries),
+		zap.Int("overflow_size", cfg.OverflowSize),
+		zap.Int("breaker_failure_threshold", cfg.CircuitBreaker.FailureThreshold),
+		zap.Duration("dedup_retention", cfg.DedupRetention),
+		zap.String("ledger_path", cfg.LedgerPath),
+	)
+	routed := make(map[string]bool)
+	for _, route := range cfg.Routes {
+		for _, name := range route.Sinks {
+			routed[name] = true
+		}
+	}
+	return &SinkDispatcher{
+		cfg:        cfg,
+		workers:    workers,
+		routed:     routed,
+		templated:  templated,
+		input:      make(chan sink.Event, cfg.QueueSize),
+		ledger:     ledger,
+		lastExpire: time.Now(),
+		metrics:    metrics,
+		logger:     logger,
+	}, nil
+}
+
+// reportErrors reports delivery failures to r and delivers the internal_error events it
+// queues.
+func (d *SinkDispatcher) reportErrors(r *ErrorReporter) {
+	d.reporter = r
+	d.internalErrors = r.Notifications()
+}
+
+// seal signs the window results and violations delivered to sinks with signer.
+func (d *SinkDispatcher) seal(signer signing.Signer) {
+	d.signer = signer
+}
+
+// sealed returns the envelope sealing a payload, or nil when signing is disabled or
+// failed, in which case the payload is delivered as is.
+func (d *SinkDispatcher) sealed(featureName string, payload interface{}) *signing.Envelope {
+	if d.signer == nil {
+		return nil
+	}
+	envelope, err := signing.Seal(d.signer, payload)
+	if err != nil {
+		d.logger.Error("Failed to sign payload for sinks", logging.Feature(featureName), zap.Error(err))
+		d.reporter.Report(&OpError{Component: ComponentSink, Op: "sign", Severity: ErrorSeverityError, Err: err})
+		return nil
+	}
+	return &envelope
+}
+
+// EnqueueResult queues a window result without blocking.
+func (d *SinkDispatcher) EnqueueResult(result AggregationResult) {
+	payload := result.Payload()
+	d.enqueue(sink.Event{
+		Kind:        schema.KindAggregationResult,
+		ID:          payload.EventID,
+		FeatureName: result.FeatureName,
+		Tenant:      result.Tenant,
+		WindowEnd:   result.WindowEnd,
+		Payload:     payload,
+		Sealed:      d.sealed(result.FeatureName, payload),
+	})
+}
+
+// EnqueueViolation queues a reported violation, routed to sinks, without blocking. The
+// alert context, which templates are rendered with, is nil unless some sink has a template.
+func (d *SinkDispatcher) EnqueueViolation(v Violation, sinks []string, alertContext *sink.Context) {
+	payload := v.Payload()
+	d.enqueue(sink.Event{
+		Kind:        schema.KindViolation,
+		ID:          payload.EventID,
+		FeatureName: v.FeatureName,
+		Tenant:      v.Tenant,
+		Sinks:       sinks,
+		CheckType:   v.CheckType,
+		WindowEnd:   v.WindowEnd,
+		Payload:     payload,
+		Sealed:      d.sealed(v.FeatureName, payload),
+		Context:     alertContext,
+	})
+}
+
+// EnqueueArchived queues the end of a feature's monitoring without blocking.
+func (d *SinkDispatcher) EnqueueArchived(a schema.FeatureArchived) {
+	d.enqueue(sink.Event{
+		Kind:        schema.KindFeatureArchived,
+		ID:          a.EventID,
+		FeatureName: a.FeatureName,
+		WindowEnd:   a.LastWindowEnd,
+		Payload:     a,
+	})
+}
+
+// EnqueueFiring queues the start of an alert, routed to sinks like its violation, without
+// blocking.
+func (d *SinkDispatcher) EnqueueFiring(payload schema.AlertFiring, sinks []string, alertContext *sink.Context) {
+	d.enqueue(sink.Event{
+		Kind:        schema.KindAlertFiring,
+		ID:          payload.EventID,
+		FeatureName: payload.FeatureName,
+		Tenant:      payload.Tenant,
+		Sinks:       sinks,
+		CheckType:   payload.CheckType,
+		WindowEnd:   payload.FiringSince,
+		Payload:     payload,
+		Context:     alertContext,
+	})
+}
+
+// EnqueueResolved queues the resolution of a firing alert by a healthy window, routed to
+// sinks, without blocking.
+func (d *SinkDispatcher) EnqueueResolved(payload schema.AlertResolved, sinks []string, alertContext *sink.Context) {
+	d.enqueue(sink.Event{
+		Kind:        schema.KindAlertResolved,
+		ID:          payload.EventID,
+		FeatureName: payload.FeatureName,
+		Tenant:      payload.Tenant,
+		Sinks:       sinks,
+		CheckType:   payload.CheckType,
+		WindowEnd:   payload.WindowEnd,
+		Payload:     payload,
+		Context:     alertContext,
+	})
+}
+
+// enqueue drops the event when the queue is full, counting it against every sink.
+func (d *SinkDispatcher) enqueue(e sink.Event) {
+	select {
+	case d.input <- e:
+	default:
+		for _, w := range d.workers {
+			if d.accepts(w.out, e) {
+				d.metrics.sinkEvents.WithLabelValues(w.out.Name, "dropped").Inc()
+			}
+		}
+	}
+}
+
+// Close stops accepting events; Run delivers what is queued, closes the sinks and returns.
+func (d *SinkDispatcher) Close() {
+	close(d.input)
+}
+
+// Run batches queued events and hands them to the sinks until Close is called. It keeps
+// running after ctx is cancelled so the final windows of a run are still delivered, but
+// sinks no longer retry failed deliveries. Events still buffered for a failing sink when
+// it returns are lost.
+func (d *SinkDispatcher) Run(ctx context.Context) error {
+	sugar := d.logger.Sugar()
+	sugar.Info("Starting sink dispatcher loop...")
+	defer sugar.Info("Sink dispatcher loop stopped.")
+	defer d.closeSinks()
+
+	var workers sync.WaitGroup
+	d.startWorkers(ctx, &workers)
+
+	ticker := time.NewTicker(d.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]sink.Event, 0, d.cfg.MaxBatchSize)
+	flush := func() {
+		d.dispatch(batch)
+		batch = make([]sink.Event, 0, d.cfg.MaxBatchSize) // Workers may still read the dispatched one
+	}
+	for {
+		select {
+		case e, ok := <-d.input:
+			if !ok {
+				flush()
+				d.stopWorkers(&workers)
+				return nil
+			}
+			batch = append(batch, e)
+			if len(batch) >= d.cfg.MaxBatchSize {
+				flush()
+			}
+
+		case e := <-d.internalErrors:
+			batch = append(batch, e)
+			if len(batch) >= d.cfg.MaxBatchSize {
+				flush()
+			}
+
+		case <-ticker.C:
+			flush()
+			d.expireLedger()
+		}
+	}
+}
+
+// accepts reports whether the output receives the event: it must accept the event's kind,
+// tenant, feature and check, and sinks named by routes only receive the alerts routed to them. Internal
+// errors only go to the sinks they name.
+func (d *SinkDispatcher) accepts(out sink.Output, e sink.Event) bool {
+	if e.Kind == schema.KindInternalError {
+		return slices.Contains(e.Sinks, out.Name)
+	}
+	if !out.Accepts(e) {
+		return false
+	}
+	if !d.routed[out.Name] || (e.Kind != schema.KindViolation && e.Kind != schema.KindAlertFiring && e.Kind != schema.KindAlertResolved) {
+		return true
+	}
+	return slices.Contains(e.Sinks, out.Name)
+}
+
+// recordDelivery feeds the outcome of a delivery to the sink's circuit breaker, logging
+// when the circuit opens or closes.
+func (d *SinkDispatcher) recordDelivery(out sink.Output, state *sinkState, ok bool) {
+	before := state.breaker.state
+	state.breaker.record(ok, time.Now())
+	after := state.breaker.state
+	d.metrics.sinkCircuit.WithLabelValues(out.Name).Set(float64(after))
+	switch {
+	case after == circuitOpen && before != circuitOpen:
+		d.logger.Warn("Sink circuit opened, buffering its events",
+			zap.String("sink", out.Name),
+			zap.Int("consecutive_failures", state.breaker.failures),
+			zap.Duration("open_duration", state.breaker.openFor),
+		)
+	case after == circuitClosed && before != circuitClosed:
+		d.logger.Info("Sink circuit closed, delivery recovered", zap.String("sink", out.Name))
+	}
+}
+
+// overflow buffers undelivered events for a later delivery, dropping the oldest beyond
+// sinks.overflowSize; without an overflow buffer they are all dropped. The first
+// redelivered events were already buffered before. err is the delivery failure, nil when
+// the delivery was skipped by an open circuit.
+func (d *SinkDispatcher) overflow(out sink.Output, state *sinkState, events []sink.Event, redelivered int, err error) {
+	if len(events) == 0 {
+		return
+	}
+	state.overflow = append(state.overflow, events...)
+	dropped := max(0, len(state.overflow)-d.cfg.OverflowSize)
+	if dropped > 0 {
+		state.overflow = slices.Clone(state.overflow[dropped:])
+		d.metrics.sinkEvents.WithLabelValues(out.Name, "failed").Add(float64(dropped))
+	}
+	if buffered := len(events) - redelivered - dropped; buffered > 0 {
+		d.metrics.sinkEvents.WithLabelValues(out.Name, "buffered").Add(float64(buffered))
+	}
+	d.metrics.sinkOverflow.WithLabelValues(out.Name).Set(float64(len(state.overflow)))
+	switch {
+	case err != nil && dropped == 0:
+		d.reporter.Report(&OpError{Component: ComponentSink, Op: "deliver:" + out.Name, Severity: ErrorSeverityWarning, Retryable: true, Err: err})
+	case err != nil:
+		d.reporter.Report(&OpError{Component: ComponentSink, Op: "deliver:" + out.Name, Severity: ErrorSeverityError, Retryable: true, Err: err})
+	case dropped > 0:
+		d.reporter.Report(&OpError{
+			Component: ComponentSink,
+			Op:        "deliver:" + out.Name,
+			Severity:  ErrorSeverityError,
+			Retryable: true,
+			Err:       fmt.Errorf("circuit open, %d events dropped", dropped),
+		})
+	}
+
+	switch {
+	case err == nil && d.cfg.OverflowSize == 0:
+		d.logger.Error("Sink circuit open, dropping batch",
+			zap.String("sink", out.Name),
+			zap.Int("events", len(events)),
+		)
+	case d.cfg.OverflowSize == 0:
+		d.logger.Error("Sink delivery failed, dropping batch",
+			zap.String("sink", out.Name),
+			zap.Int("events", len(events)),
+			zap.Error(err),
+		)
+	case err != nil:
+		d.logger.Warn("Sink delivery failed, buffering batch",
+			zap.String("sink", out.Name),
+			zap.Int("events", len(events)),
+			zap.Int("buffered", len(state.overflow)),
+			zap.Int("dropped", dropped),
+			zap.Error(err),
+		)
+	case dropped > 0:
+		d.logger.Error("Sink overflow buffer full, dropping oldest events",
+			zap.String("sink", out.Name),
+			zap.Int("dropped", dropped),
+		)
+	}
+}
+
+// deliver sends events to a sink, retrying with exponential backoff, capped at
+// sinks.maxRetryBackoff, until it succeeds, the retries are exhausted or ctx is cancelled.
+// Retries carry the same event IDs, so sinks and their consumers can discard what a
+// failed attempt already delivered.
+func (d *SinkDispatcher) deliver(ctx context.Context, out sink.Output, events []sink.Event, retries int, backoff time.Duration) error {
+	for attempt := 0; ; attempt++ {
+		sendCtx, cancel := context.WithTimeout(context.Background(), d.cfg.Timeout)
+		err := out.Sink.Send(sendCtx, events)
+		cancel()
+		if err == nil || attempt >= retries || ctx.Err() != nil {
+			return err
+		}
+
+		d.metrics.sinkEvents.WithLabelValues(out.Name, "retried").Add(float64(len(events)))
+		d.logger.Warn("Sink delivery failed, retrying",
+			zap.String("sink", out.Name),
+			zap.Int("events", len(events)),
+			zap.Int("attempt", attempt+1),
+			zap.Duration("backoff", backoff),
+			zap.Error(err),
+		)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return err
+		}
+		backoff *= 2
+		if d.cfg.MaxRetryBackoff > 0 {
+			backoff = min(backoff, d.cfg.MaxRetryBackoff)
+		}
+	}
+}
+
+// expireLedger forgets delivered events past the dedup retention, at most once per
+// ledgerExpireInterval.
+func (d *SinkDispatcher) expireLedger() {
+	if d.ledger == nil || time.Since(d.lastExpire) < ledgerExpireInterval {
+		return
+	}
+	d.lastExpire = time.Now()
+	if err := d.ledger.expire(d.lastExpire); err != nil {
+		d.logger.Warn("Failed to compact delivery ledger", zap.Error(err))
+	}
+}
+
+func (d *SinkDispatcher) closeSinks() {
+	for _, w := range d.workers {
+		if err := w.out.Sink.Close(); err != nil {
+			d.logger.Warn("Failed to close sink", zap.String("sink", w.out.Name), zap.Error(err))
+		}
+	}
+	if d.ledger != nil {
+		if err := d.ledger.close(); err != nil {
+			d.logger.Warn("Failed to close delivery ledger", zap.Error(err))
+		}
+	}
+}
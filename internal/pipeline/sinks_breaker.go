@@ -0,0 +1,73 @@
+package pipeline
+
+import (
+	"time"
+
+	"github.com/sanspareilsmyn/featurelens/internal/sink"
+)
+
+// circuitState is the state of a sink's circuit breaker, exported as its numeric value.
+type circuitState int
+
+const (
+	circuitClosed   circuitState = iota // Deliveries are tried
+	circuitHalfOpen                     // One trial delivery decides whether to close or reopen
+	circuitOpen                         // Deliveries are skipped until the open duration elapsed
+)
+
+func (s circuitState) String() string {
+	switch s {
+	case circuitHalfOpen:
+		return "half-open"
+	case circuitOpen:
+		return "open"
+	default:
+		return "closed"
+	}
+}
+
+// circuitBreaker opens after threshold consecutive failed deliveries, and lets one trial
+// delivery through once it has been open for openFor. A zero threshold never opens.
+type circuitBreaker struct {
+	threshold int
+	openFor   time.Duration
+	failures  int
+	state     circuitState
+	openedAt  time.Time
+}
+
+// allow reports whether a delivery may be tried at now, turning an open circuit half-open
+// once it has been open long enough.
+func (b *circuitBreaker) allow(now time.Time) bool {
+	if b.state == circuitOpen {
+		if now.Sub(b.openedAt) < b.openFor {
+			return false
+		}
+		b.state = circuitHalfOpen
+	}
+	return true
+}
+
+// record counts the outcome of a delivery at now. A success closes the circuit; a failed
+// trial, or the threshold-th consecutive failure, opens it.
+func (b *circuitBreaker) record(ok bool, now time.Time) {
+	if ok {
+		b.failures = 0
+		b.state = circuitClosed
+		return
+	}
+	b.failures++
+	if b.state == circuitHalfOpen || (b.threshold > 0 && b.failures >= b.threshold) {
+		b.state = circuitOpen
+		b.openedAt = now
+	}
+}
+
+// sinkState is the delivery state of one sink: its retry policy, circuit breaker and the
+// failed events awaiting redelivery, oldest first.
+type sinkState struct {
+	retries  int
+	backoff  time.Duration
+	breaker  circuitBreaker
+	overflow []sink.Event
+}
@@ -0,0 +1,178 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/sanspareilsmyn/featurelens/internal/sink"
+)
+
+// sinkWorker delivers the events accepted by one sink on a goroutine of its own, so that a
+// slow or failing sink delays neither the other sinks nor the dispatcher: once its queue
+// is full, further events are dropped for that sink alone.
+type sinkWorker struct {
+	out      sink.Output
+	state    *sinkState
+	queue    chan []sink.Event // Batches of accepted events; nil ones only trigger redelivery
+	queued   atomic.Int64      // Events queued or being delivered
+	capacity int64             // Events the queue holds at most
+}
+
+func newSinkWorker(out sink.Output, state *sinkState, capacity int) *sinkWorker {
+	return &sinkWorker{out: out, state: state, queue: make(chan []sink.Event, capacity), capacity: int64(capacity)}
+}
+
+// startWorkers starts a goroutine per sink, stopped by stopWorkers.
+func (d *SinkDispatcher) startWorkers(ctx context.Context, done *sync.WaitGroup) {
+	for _, w := range d.workers {
+		done.Add(1)
+		go func() {
+			defer done.Done()
+			for events := range w.queue {
+				d.deliverTo(ctx, w, d.render(w, events))
+				w.queued.Add(-int64(len(events)))
+				d.metrics.sinkQueue.WithLabelValues(w.out.Name).Sub(float64(len(events)))
+			}
+			d.dropOverflow(w)
+		}()
+	}
+}
+
+// stopWorkers waits until the sinks delivered their queued events.
+func (d *SinkDispatcher) stopWorkers(done *sync.WaitGroup) {
+	for _, w := range d.workers {
+		close(w.queue)
+	}
+	done.Wait()
+}
+
+// dispatch hands each sink the events of a batch it accepts. Sinks accepting none are
+// still woken up to redeliver the events buffered by failed deliveries. Workers share
+// the batch, which must not be modified afterwards.
+func (d *SinkDispatcher) dispatch(batch []sink.Event) {
+	for _, w := range d.workers {
+		events := batch
+		if !w.out.AcceptsAll() || d.routed[w.out.Name] || d.internalErrors != nil {
+			events = make([]sink.Event, 0, len(batch))
+			for _, e := range batch {
+				if d.accepts(w.out, e) {
+					events = append(events, e)
+				}
+			}
+		}
+		if len(events) == 0 {
+			if len(w.queue) == 0 {
+				select {
+				case w.queue <- nil:
+				default:
+				}
+			}
+			continue
+		}
+		d.offer(w, events)
+	}
+}
+
+// offer queues events for a sink without blocking, dropping them if it has no room.
+func (d *SinkDispatcher) offer(w *sinkWorker, events []sink.Event) {
+	n := int64(len(events))
+	if w.queued.Add(n) <= w.capacity {
+		select {
+		case w.queue <- events:
+			d.metrics.sinkQueue.WithLabelValues(w.out.Name).Add(float64(n))
+			return
+		default:
+		}
+	}
+	w.queued.Add(-n)
+	d.metrics.sinkEvents.WithLabelValues(w.out.Name, "dropped").Add(float64(n))
+}
+
+// render renders the events of a sink with a template. Events failing to render are
+// delivered as the sink renders them itself.
+func (d *SinkDispatcher) render(w *sinkWorker, events []sink.Event) []sink.Event {
+	if !w.out.Templated() || len(events) == 0 {
+		return events
+	}
+	rendered, err := w.out.Render(events)
+	if err != nil {
+		d.logger.Warn("Failed to render sink template", zap.String("sink", w.out.Name), zap.Error(err))
+	}
+	return rendered
+}
+
+// deliverTo delivers events to a sink, skipping those it already received, after the
+// events buffered for it by failed deliveries.
+func (d *SinkDispatcher) deliverTo(ctx context.Context, w *sinkWorker, events []sink.Event) {
+	out, state := w.out, w.state
+	if len(events) == 0 && len(state.overflow) == 0 {
+		return
+	}
+	if d.ledger != nil {
+		pending := d.ledger.undelivered(out.Name, events)
+		if skipped := len(events) - len(pending); skipped > 0 {
+			d.metrics.sinkEvents.WithLabelValues(out.Name, "deduplicated").Add(float64(skipped))
+		}
+		events = pending
+	}
+	if !state.breaker.allow(time.Now()) {
+		d.overflow(out, state, events, 0, nil)
+		return
+	}
+	redelivered := len(state.overflow)
+	if redelivered > 0 {
+		events = append(state.overflow, events...)
+		state.overflow = nil
+	}
+
+	// Redeliveries after outages are split into batches of the usual size
+	for len(events) > 0 {
+		chunk := events[:min(len(events), d.cfg.MaxBatchSize)]
+		retries := state.retries
+		if state.breaker.state == circuitHalfOpen {
+			retries = 0 // A single trial decides whether the sink recovered
+		}
+		err := d.deliver(ctx, out, chunk, retries, state.backoff)
+		d.recordDelivery(out, state, err == nil)
+		if err != nil {
+			d.overflow(out, state, events, redelivered, err)
+			return
+		}
+		d.metrics.sinkEvents.WithLabelValues(out.Name, "sent").Add(float64(len(chunk)))
+		if d.ledger != nil {
+			if err := d.ledger.record(out.Name, chunk); err != nil {
+				d.logger.Warn("Failed to persist delivered events", zap.String("sink", out.Name), zap.Error(err))
+				d.reporter.Report(&OpError{Component: ComponentSink, Op: "ledger", Severity: ErrorSeverityWarning, Retryable: true, Err: err})
+			}
+		}
+		events = events[len(chunk):]
+		redelivered = max(0, redelivered-len(chunk))
+	}
+}
+
+// dropOverflow gives up on the events still buffered for a sink when the dispatcher stops.
+func (d *SinkDispatcher) dropOverflow(w *sinkWorker) {
+	state := w.state
+	if len(state.overflow) == 0 {
+		return
+	}
+	name := w.out.Name
+	d.metrics.sinkEvents.WithLabelValues(name, "failed").Add(float64(len(state.overflow)))
+	d.metrics.sinkOverflow.WithLabelValues(name).Set(0)
+	d.reporter.Report(&OpError{
+		Component: ComponentSink,
+		Op:        "deliver:" + name,
+		Severity:  ErrorSeverityError,
+		Err:       fmt.Errorf("%d buffered events dropped on shutdown", len(state.overflow)),
+	})
+	d.logger.Error("Dropping events buffered for an unavailable sink on shutdown",
+		zap.String("sink", name),
+		zap.Int("events", len(state.overflow)),
+	)
+	state.overflow = nil
+}
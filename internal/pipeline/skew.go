@@ -0,0 +1,513 @@
+package pipeline
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/sanspareilsmyn/featurelens/internal/config"
+	"github.com/sanspareilsmyn/featurelens/internal/logging"
+	"github.com/sanspareilsmyn/featurelens/internal/message"
+)
+
+// skewMinProportion floors empty bins so PSI stays finite.
+const skewMinProportion = 1e-4
+
+// chiSquareMinExpected is the expected count below which categories are pooled for the
+// chi-squared test, whose approximation fails for rare categories.
+const chiSquareMinExpected = 5
+
+// SkewResult holds the distribution distance between serving and reference data
+// for a feature in a window.
+type SkewResult struct {
+	FeatureName    string
+	WindowStart    time.Time
+	WindowEnd      time.Time
+	ServingCount   int64
+	ReferenceCount int64
+	PSI            float64
+	JSDivergence   float64
+	MeanDelta      float64 // Absolute difference of means, NaN for categorical features
+
+	// Pearson's chi-squared goodness-of-fit statistic of the serving categories against
+	// the reference proportions, and its p-value; NaN for numerical features
+	ChiSquare       float64
+	ChiSquarePValue float64
+}
+
+// distribution is a bounded summary of one feature's values on one side of a window.
+type distribution struct {
+	samples    []float64 // Uniform reservoir of numerical values
+	seen       int64     // Numerical values offered to the reservoir
+	sum        float64
+	categories map[string]int64
+}
+
+// addValue adds a numerical value, growing the reservoir up to max samples (reservoir
+// sampling). A reservoir that grew beyond a since lowered max keeps its size.
+func (d *distribution) addValue(v float64, max int, rng *rand.Rand) {
+	d.seen++
+	d.sum += v
+	if len(d.samples) < max {
+		d.samples = append(d.samples, v)
+		return
+	}
+	if i := rng.Int63n(d.seen); i < int64(len(d.samples)) {
+		d.samples[i] = v
+	}
+}
+
+func (d *distribution) addCategory(value string) {
+	if d.categories == nil {
+		d.categories = make(map[string]int64)
+	}
+	d.categories[value]++
+}
+
+func (d *distribution) count() int64 {
+	return d.seen + sumCounts(d.categories)
+}
+
+// skewWindow holds serving and reference distributions of one aligned window.
+type skewWindow struct {
+	start     time.Time
+	serving   map[string]*distribution
+	reference map[string]*distribution
+}
+
+// SkewMonitor compares per-feature distributions of the serving stream with a reference
+// stream (or static baseline snapshot) over aligned windows and emits SkewResults.
+type SkewMonitor struct {
+	cfg         config.SkewConfig
+	windowSize  time.Duration
+	alignment   config.WindowAlignmentConfig // Window boundaries, as configured for the pipeline
+	tenantField string
+	registry    *FeatureRegistry
+	serving     <-chan []message.DynamicMessage
+	reference   <-chan []message.DynamicMessage // nil when comparing against a baseline snapshot
+	output      chan<- SkewResult
+	sampler     *AdaptiveSampler // Grows reservoirs of features approaching thresholds
+	baseline    map[string]*distribution
+	rng         *rand.Rand
+	windows     map[time.Time]*skewWindow
+	logger      *zap.Logger
+}
+
+// NewSkewMonitor creates a SkewMonitor. When cfg.BaselineFile is set the snapshot is loaded
+// immediately and reference may be nil.
+func NewSkewMonitor(cfg config.SkewConfig, windowSize time.Duration, alignment config.WindowAlignmentConfig, tenantField string, registry *FeatureRegistry, serving, reference <-chan []message.DynamicMessage, output chan<- SkewResult, sampler *AdaptiveSampler, logger *zap.Logger) (*SkewMonitor, error) {
+	s := &SkewMonitor{
+		cfg:         cfg,
+		windowSize:  windowSize,
+		alignment:   alignment,
+		tenantField: tenantField,
+		registry:    registry,
+		serving:     serving,
+		reference:   reference,
+		output:      output,
+		sampler:     sampler,
+		rng:         rand.New(rand.NewSource(time.Now().UnixNano())),
+		windows:     make(map[time.Time]*skewWindow),
+		logger:      logger,
+	}
+	if cfg.BaselineFile != "" {
+		baseline, err := s.loadBaseline(cfg.BaselineFile)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrSkewBaselineLoadFailed, err)
+		}
+		s.baseline = baseline
+	}
+
+	logger.Info("Skew monitor initialized",
+		zap.String("reference_topic", cfg.ReferenceTopic),
+		zap.String("baseline_file", cfg.BaselineFile),
+		zap.Int("bins", cfg.Bins),
+		zap.Int("max_samples", cfg.MaxSamples),
+	)
+	return s, nil
+}
+
+// loadBaseline reads a JSON lines snapshot into distributions: either reference messages
+// (baseline import) or captured feature profiles (baseline capture).
+func (s *SkewMonitor) loadBaseline(path string) (map[string]*distribution, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	baseline := make(map[string]*distribution)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), maxReplayLineBytes) // Profiles hold up to maxSamples values
+	var rows, skipped int
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		msg, err := message.ParseDynamicJSON(scanner.Bytes())
+		if err != nil {
+			skipped++
+			continue
+		}
+		rows++
+		if kind, _ := msg["kind"].(string); kind == baselineKind {
+			var p BaselineProfile
+			if err := json.Unmarshal(scanner.Bytes(), &p); err != nil {
+				return nil, err
+			}
+			baseline[p.FeatureName] = p.distribution()
+			continue
+		}
+		s.observeInto(baseline, msg)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("Loaded skew baseline snapshot",
+		zap.String("path", path),
+		zap.Int("rows", rows),
+		zap.Int("skipped_rows", skipped),
+		zap.Int("features", len(baseline)),
+	)
+	return baseline, nil
+}
+
+// Run consumes serving and reference messages until the serving input closes or the
+// context is cancelled, flushing completed windows on every tick and every remaining
+// window when the serving input closes.
+func (s *SkewMonitor) Run(ctx context.Context) error {
+	sugar := s.logger.Sugar()
+	sugar.Info("Starting skew monitor loop...")
+	defer sugar.Info("Skew monitor loop stopped.")
+
+	ticker := time.NewTicker(s.windowSize)
+	defer ticker.Stop()
+
+	serving, reference := s.serving, s.reference
+	for {
+		select {
+		case batch, ok := <-serving:
+			if !ok {
+				// Every open window ends by now+windowSize, so this also flushes the partial one
+				s.flush(ctx, time.Now().Add(s.windowSize))
+				return nil
+			}
+			for _, msg := range batch {
+				s.observe(msg, true)
+			}
+
+		case batch, ok := <-reference:
+			if !ok {
+				reference = nil // Keep comparing what was already received
+				continue
+			}
+			for _, msg := range batch {
+				s.observe(msg, false)
+			}
+
+		case tickTime := <-ticker.C:
+			s.flush(ctx, tickTime)
+
+		case <-ctx.Done():
+			return ctx.Err() // Aborted at the drain deadline; open windows are dropped
+		}
+	}
+}
+
+// observe adds a message to the serving or reference side of its processing-time window.
+func (s *SkewMonitor) observe(msg message.DynamicMessage, serving bool) {
+	windowEnd := alignedWindowEnd(time.Now(), s.windowSize, s.alignment)
+	w, ok := s.windows[windowEnd]
+	if !ok {
+		w = &skewWindow{
+			start:     windowEnd.Add(-s.windowSize),
+			serving:   make(map[string]*distribution),
+			reference: make(map[string]*distribution),
+		}
+		s.windows[windowEnd] = w
+	}
+	if serving {
+		s.observeInto(w.serving, msg)
+	} else {
+		s.observeInto(w.reference, msg)
+	}
+}
+
+func (s *SkewMonitor) observeInto(dists map[string]*distribution, msg message.DynamicMessage) {
+	maxSamples := func(feature string) int { return s.sampler.ReservoirSize(feature, s.cfg.MaxSamples) }
+	observeDistributions(dists, s.registry.Features(), msg, s.tenantField, maxSamples, s.rng)
+}
+
+// fixedSamples keeps n numerical values per feature.
+func fixedSamples(n int) func(string) int {
+	return func(string) int { return n }
+}
+
+// observeDistributions adds a message's values of the features to their distributions,
+// keeping at most maxSamples(feature) numerical values per feature. Tenant features only
+// observe the messages of their tenant, named by tenantField. Session features aggregate
+// session summaries rather than messages, so they are not compared.
+func observeDistributions(dists map[string]*distribution, features []config.FeatureConfig, msg message.DynamicMessage, tenantField string, maxSamples func(feature string) int, rng *rand.Rand) {
+	tenant := messageTenant(msg, tenantField)
+	for _, f := range features {
+		if f.Scope == config.ScopeSession || !inTenant(f, tenantField, tenant) || !msg.HasNonNull(f.FieldName()) {
+			continue
+		}
+		d, ok := dists[f.Name]
+		if !ok {
+			d = &distribution{}
+			dists[f.Name] = d
+		}
+		switch f.MetricType {
+		case config.MetricTypeNumerical, config.MetricTypeLatency:
+			if v, ok := msg.GetFloat64(f.FieldName()); ok {
+				d.addValue(*v, maxSamples(f.Name), rng)
+			}
+		case config.MetricTypeCategorical:
+			if v, ok := categoryValue(msg, f); ok {
+				d.addCategory(v)
+			}
+		}
+	}
+}
+
+// flush compares and emits every window completed by cutoff. Sends block until the
+// alerter takes the result or ctx is cancelled.
+func (s *SkewMonitor) flush(ctx context.Context, cutoff time.Time) {
+	for windowEnd, w := range s.windows {
+		if windowEnd.After(cutoff) {
+			continue
+		}
+		delete(s.windows, windowEnd)
+
+		reference := w.reference
+		if s.baseline != nil {
+			reference = s.baseline
+		}
+		for _, f := range s.registry.Features() {
+			result, ok := s.compare(f, w.serving[f.Name], reference[f.Name])
+			if !ok {
+				continue
+			}
+			result.WindowStart, result.WindowEnd = w.start, windowEnd
+
+			select {
+			case s.output <- result:
+			case <-ctx.Done():
+				s.logger.Warn("Skew monitor cancelled, dropping result",
+					logging.Feature(f.Name),
+					logging.WindowEnd(windowEnd),
+				)
+				return
+			}
+		}
+	}
+}
+
+// compare computes the distance between serving and reference distributions of a feature.
+// It reports false when either side has no observations.
+func (s *SkewMonitor) compare(f config.FeatureConfig, serving, reference *distribution) (SkewResult, bool) {
+	return compareDistributions(f, serving, reference, s.cfg.Bins)
+}
+
+// compareDistributions computes the distance between serving and reference
+// distributions of a feature, binning numerical values into up to bins quantile bins.
+// It reports false when either side has no observations.
+func compareDistributions(f config.FeatureConfig, serving, reference *distribution, bins int) (SkewResult, bool) {
+	if serving == nil || reference == nil || serving.count() == 0 || reference.count() == 0 {
+		return SkewResult{}, false
+	}
+	result := SkewResult{
+		FeatureName:     f.Name,
+		ServingCount:    serving.count(),
+		ReferenceCount:  reference.count(),
+		MeanDelta:       math.NaN(),
+		ChiSquare:       math.NaN(),
+		ChiSquarePValue: math.NaN(),
+	}
+
+	var servingP, referenceP []float64
+	switch f.MetricType {
+	case config.MetricTypeNumerical, config.MetricTypeLatency:
+		if len(serving.samples) == 0 || len(reference.samples) == 0 {
+			return SkewResult{}, false
+		}
+		edges := quantileEdges(reference.samples, bins)
+		servingP = histogram(serving.samples, edges)
+		referenceP = histogram(reference.samples, edges)
+		result.MeanDelta = math.Abs(serving.sum/float64(serving.seen) - reference.sum/float64(reference.seen))
+	case config.MetricTypeCategorical:
+		servingP, referenceP = categoryProportions(serving.categories, reference.categories)
+		result.ChiSquare, result.ChiSquarePValue = chiSquareTest(serving.categories, reference.categories)
+	default:
+		return SkewResult{}, false
+	}
+
+	result.PSI = populationStabilityIndex(referenceP, servingP)
+	result.JSDivergence = jensenShannon(referenceP, servingP)
+	return result, true
+}
+
+// quantileEdges returns up to bins-1 distinct interior bin edges at the quantiles of values.
+func quantileEdges(values []float64, bins int) []float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	edges := make([]float64, 0, bins-1)
+	for i := 1; i < bins; i++ {
+		edge := sorted[i*len(sorted)/bins]
+		if len(edges) == 0 || edge > edges[len(edges)-1] {
+			edges = append(edges, edge)
+		}
+	}
+	return edges
+}
+
+// histogram returns the proportion of values in each bin delimited by edges.
+func histogram(values []float64, edges []float64) []float64 {
+	proportions := make([]float64, len(edges)+1)
+	for _, v := range values {
+		proportions[sort.SearchFloat64s(edges, v)]++
+	}
+	for i := range proportions {
+		proportions[i] /= float64(len(values))
+	}
+	return proportions
+}
+
+// categoryProportions returns aligned value proportions over the union of categories.
+func categoryProportions(serving, reference map[string]int64) ([]float64, []float64) {
+	servingTotal, referenceTotal := float64(sumCounts(serving)), float64(sumCounts(reference))
+	values := make(map[string]struct{}, len(reference))
+	for v := range serving {
+		values[v] = struct{}{}
+	}
+	for v := range reference {
+		values[v] = struct{}{}
+	}
+
+	servingP := make([]float64, 0, len(values))
+	referenceP := make([]float64, 0, len(values))
+	for v := range values {
+		servingP = append(servingP, float64(serving[v])/servingTotal)
+		referenceP = append(referenceP, float64(reference[v])/referenceTotal)
+	}
+	return servingP, referenceP
+}
+
+// populationStabilityIndex computes PSI = Σ (a - e) ln(a / e), flooring empty bins.
+func populationStabilityIndex(expected, actual []float64) float64 {
+	var psi float64
+	for i := range expected {
+		e := math.Max(expected[i], skewMinProportion)
+		a := math.Max(actual[i], skewMinProportion)
+		psi += (a - e) * math.Log(a/e)
+	}
+	return psi
+}
+
+// jensenShannon computes the Jensen-Shannon divergence in bits, bounded to [0, 1].
+func jensenShannon(p, q []float64) float64 {
+	var js float64
+	for i := range p {
+		m := (p[i] + q[i]) / 2
+		if p[i] > 0 {
+			js += 0.5 * p[i] * math.Log2(p[i]/m)
+		}
+		if q[i] > 0 {
+			js += 0.5 * q[i] * math.Log2(q[i]/m)
+		}
+	}
+	return js
+}
+
+// chiSquareTest tests the serving category counts against the reference proportions
+// with Pearson's goodness-of-fit test, and returns the statistic and its p-value.
+// Categories expected fewer than chiSquareMinExpected times are pooled, along with those
+// missing from the reference, whose expected share is floored like empty PSI bins.
+// Both are NaN when fewer than two categories remain.
+func chiSquareTest(serving, reference map[string]int64) (float64, float64) {
+	n, referenceTotal := float64(sumCounts(serving)), float64(sumCounts(reference))
+	var stat float64
+	bins := 0
+	var pooledObserved, pooledExpected float64
+	for v, count := range reference {
+		observed, expected := float64(serving[v]), n*float64(count)/referenceTotal
+		if expected < chiSquareMinExpected {
+			pooledObserved += observed
+			pooledExpected += expected
+			continue
+		}
+		stat += (observed - expected) * (observed - expected) / expected
+		bins++
+	}
+	for v, count := range serving {
+		if _, ok := reference[v]; !ok {
+			pooledObserved += float64(count)
+			pooledExpected += n * skewMinProportion
+		}
+	}
+	if pooledObserved > 0 || pooledExpected > 0 {
+		stat += (pooledObserved - pooledExpected) * (pooledObserved - pooledExpected) / pooledExpected
+		bins++
+	}
+	if bins < 2 {
+		return math.NaN(), math.NaN()
+	}
+	return stat, chiSquareSurvival(stat, bins-1)
+}
+
+// chiSquareSurvival returns the probability that a chi-squared variable with df degrees
+// of freedom is at least x: the regularized upper incomplete gamma function Q(df/2, x/2),
+// computed by its series for small x and its continued fraction otherwise (Numerical
+// Recipes, gammq).
+func chiSquareSurvival(x float64, df int) float64 {
+	a, x := float64(df)/2, x/2
+	if x <= 0 {
+		return 1
+	}
+	lgamma, _ := math.Lgamma(a)
+	prefix := math.Exp(-x + a*math.Log(x) - lgamma)
+	if x < a+1 {
+		sum, term := 1/a, 1/a
+		for n := 1.0; n < 1000 && math.Abs(term) > math.Abs(sum)*1e-15; n++ {
+			term *= x / (a + n)
+			sum += term
+		}
+		return math.Max(0, 1-sum*prefix)
+	}
+
+	// Modified Lentz's method
+	const tiny = 1e-300
+	b := x + 1 - a
+	c, d := 1/tiny, 1/b
+	h := d
+	for i := 1.0; i < 1000; i++ {
+		an := -i * (i - a)
+		b += 2
+		d = an*d + b
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = b + an/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		delta := d * c
+		h *= delta
+		if math.Abs(delta-1) < 1e-15 {
+			break
+		}
+	}
+	return math.Min(1, prefix*h)
+}
@@ -0,0 +1,162 @@
+package pipeline
+
+import (
+	"math"
+	"slices"
+	"testing"
+)
+
+// TestChiSquareSurvival checks p-values against the critical values of chi-squared tables
+// at 0.95, 0.05 and 0.01, which cover both the series and the continued fraction.
+func TestChiSquareSurvival(t *testing.T) {
+	critical := map[float64][10]float64{
+		0.95: {0.003932, 0.102587, 0.351846, 0.710723, 1.145476, 1.635383, 2.167350, 2.732637, 3.325113, 3.940299},
+		0.05: {3.841459, 5.991465, 7.814728, 9.487729, 11.070498, 12.591587, 14.067140, 15.507313, 16.918978, 18.307038},
+		0.01: {6.634897, 9.210340, 11.344867, 13.276704, 15.086272, 16.811894, 18.475307, 20.090235, 21.665994, 23.209251},
+	}
+	for p, values := range critical {
+		for i, x := range values {
+			df := i + 1
+			// Table values have six decimals
+			if got := chiSquareSurvival(x, df); math.Abs(got-p) > 2e-6 {
+				t.Errorf("chiSquareSurvival(%v, %d): got %v, want %v", x, df, got, p)
+			}
+		}
+	}
+	for df := 1; df <= 10; df++ {
+		if got := chiSquareSurvival(0, df); got != 1 {
+			t.Errorf("chiSquareSurvival(0, %d): got %v, want 1", df, got)
+		}
+		if got := chiSquareSurvival(1000, df); got < 0 || got > 1e-100 {
+			t.Errorf("chiSquareSurvival(1000, %d): got %v, want about 0", df, got)
+		}
+	}
+}
+
+func TestChiSquareTest(t *testing.T) {
+	tests := []struct {
+		name               string
+		serving, reference map[string]int64
+		stat, p            float64 // NaN when the test does not apply
+	}{
+		{
+			name:      "same proportions",
+			serving:   map[string]int64{"a": 30, "b": 70},
+			reference: map[string]int64{"a": 300, "b": 700},
+			stat:      0,
+			p:         1,
+		},
+		{
+			name:      "shifted",
+			serving:   map[string]int64{"a": 60, "b": 40},
+			reference: map[string]int64{"a": 50, "b": 50},
+			stat:      4, // 2 * 10² / 50
+			p:         0.04550026389635842,
+		},
+		{
+			// c and d are expected twice each, so they are pooled into a third bin
+			name:      "rare categories pooled",
+			serving:   map[string]int64{"a": 50, "b": 40, "c": 5, "d": 5},
+			reference: map[string]int64{"a": 480, "b": 480, "c": 20, "d": 20},
+			stat:      4.0/48 + 64.0/48 + 36.0/4,
+			p:         math.Exp(-(4.0/48 + 64.0/48 + 36.0/4) / 2), // Closed form for 2 degrees of freedom
+		},
+		{
+			// z is missing from the reference: expected at the floored share, pooled
+			name:      "new category",
+			serving:   map[string]int64{"a": 45, "b": 45, "z": 10},
+			reference: map[string]int64{"a": 50, "b": 50},
+			stat:      25.0/50 + 25.0/50 + (10-100*skewMinProportion)*(10-100*skewMinProportion)/(100*skewMinProportion),
+			p:         0,
+		},
+		{
+			name:      "single category",
+			serving:   map[string]int64{"a": 10},
+			reference: map[string]int64{"a": 100},
+			stat:      math.NaN(),
+			p:         math.NaN(),
+		},
+		{
+			// Both categories are pooled into a single bin
+			name:      "only rare categories",
+			serving:   map[string]int64{"a": 3, "b": 3},
+			reference: map[string]int64{"a": 50, "b": 50},
+			stat:      math.NaN(),
+			p:         math.NaN(),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stat, p := chiSquareTest(tt.serving, tt.reference)
+			if !closeOrNaN(stat, tt.stat, 1e-9) || !closeOrNaN(p, tt.p, 1e-12) {
+				t.Errorf("got statistic %v and p-value %v, want %v and %v", stat, p, tt.stat, tt.p)
+			}
+		})
+	}
+}
+
+func TestDistributionDistances(t *testing.T) {
+	tests := []struct {
+		name    string
+		p, q    []float64
+		psi, js float64
+	}{
+		{name: "identical", p: []float64{0.2, 0.3, 0.5}, q: []float64{0.2, 0.3, 0.5}},
+		{
+			// Empty bins are floored, so PSI stays finite; JS divergence is at its bound
+			name: "disjoint",
+			p:    []float64{1, 0},
+			q:    []float64{0, 1},
+			psi:  2 * (1 - skewMinProportion) * math.Log(1/skewMinProportion),
+			js:   1,
+		},
+		{
+			name: "partly overlapping",
+			p:    []float64{0.5, 0.5, 0},
+			q:    []float64{0, 0.5, 0.5},
+			psi:  2 * (0.5 - skewMinProportion) * math.Log(0.5/skewMinProportion),
+			js:   0.5,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := populationStabilityIndex(tt.p, tt.q); math.Abs(got-tt.psi) > 1e-12 {
+				t.Errorf("PSI: got %v, want %v", got, tt.psi)
+			}
+			if got := jensenShannon(tt.p, tt.q); math.Abs(got-tt.js) > 1e-12 {
+				t.Errorf("JS divergence: got %v, want %v", got, tt.js)
+			}
+		})
+	}
+}
+
+// TestQuantileEdges checks that tied quantiles yield a single edge, so no bin is empty
+// by construction.
+func TestQuantileEdges(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []float64
+		bins   int
+		want   []float64
+	}{
+		{name: "distinct", values: []float64{8, 7, 6, 5, 4, 3, 2, 1}, bins: 4, want: []float64{3, 5, 7}},
+		{name: "ties", values: []float64{1, 1, 1, 1, 1, 1, 2, 3}, bins: 4, want: []float64{1, 2}},
+		{name: "constant", values: []float64{5, 5, 5, 5}, bins: 4, want: []float64{5}},
+		{name: "fewer values than bins", values: []float64{2, 1}, bins: 4, want: []float64{1, 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := quantileEdges(tt.values, tt.bins); !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// closeOrNaN reports whether got is within tolerance of want, or both are NaN.
+func closeOrNaN(got, want, tolerance float64) bool {
+	if math.IsNaN(want) {
+		return math.IsNaN(got)
+	}
+	return math.Abs(got-want) <= tolerance*math.Max(1, math.Abs(want))
+}
@@ -0,0 +1,317 @@
+package pipeline
+
+import (
+	"bytes"
+	"container/list"
+	"encoding/gob"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/sanspareilsmyn/featurelens/internal/config"
+	"github.com/sanspareilsmyn/featurelens/internal/logging"
+)
+
+// spillFilePattern matches the files holding spilled window state.
+const spillFilePattern = "window-*.spill"
+
+// stateKey identifies the stats of a feature, or of one of its segments, in a window.
+type stateKey struct {
+	windowEnd time.Time
+	name      string // Feature name, qualified with the model version
+	group     string
+	segment   bool
+	late      bool // Stats of the window's late bucket
+}
+
+// residentStats is stats held in memory, with their size when last updated.
+type residentStats struct {
+	key   stateKey
+	stats *FeatureStats
+	size  int
+}
+
+// spillRecord locates spilled stats in their window's spill file.
+type spillRecord struct {
+	offset, length int64
+}
+
+// spillFile holds the spilled stats of one window, each appended as a gob-encoded record.
+// Records read back are not reclaimed until the window closes and the file is removed.
+type spillFile struct {
+	file    *os.File
+	size    int64
+	records map[stateKey]spillRecord
+}
+
+// stateSpiller keeps the stats of open windows within a memory budget, spilling the least
+// recently updated ones to a file per window. Its methods MUST be called with the
+// calculator's mutex held. A nil spiller keeps every stats in memory.
+type stateSpiller struct {
+	budget   int64
+	dir      string
+	used     int64      // Estimated bytes of the stats in memory
+	lru      *list.List // Of *residentStats, most recently updated first
+	resident map[time.Time]map[stateKey]*list.Element
+	files    map[time.Time]*spillFile
+	spilled  int64 // Bytes in spill files
+	metrics  *Metrics
+	logger   *zap.Logger
+	reporter *ErrorReporter // Reports failed spills and read-backs; nil discards them
+}
+
+// newStateSpiller creates a spiller for the configured budget, or returns nil without
+// one. Spill files left in the directory by a previous run are removed.
+func newStateSpiller(cfg config.WindowStateConfig, metrics *Metrics, logger *zap.Logger) (*stateSpiller, error) {
+	if cfg.MaxMemoryMB == 0 {
+		return nil, nil
+	}
+	if err := os.MkdirAll(cfg.SpillDirectory, 0o755); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrSpillFailed, err)
+	}
+	stale, _ := filepath.Glob(filepath.Join(cfg.SpillDirectory, spillFilePattern))
+	for _, path := range stale {
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrSpillFailed, err)
+		}
+	}
+	logger.Info("Window state budget enabled",
+		zap.Int("max_memory_mb", cfg.MaxMemoryMB),
+		zap.String("spill_directory", cfg.SpillDirectory),
+		zap.Int("stale_files_removed", len(stale)),
+	)
+	return &stateSpiller{
+		budget:   int64(cfg.MaxMemoryMB) << 20,
+		dir:      cfg.SpillDirectory,
+		lru:      list.New(),
+		resident: make(map[time.Time]map[stateKey]*list.Element),
+		files:    make(map[time.Time]*spillFile),
+		metrics:  metrics,
+		logger:   logger,
+	}, nil
+}
+
+// touch marks stats in memory as the most recently updated and refreshes their size.
+func (s *stateSpiller) touch(key stateKey, stats *FeatureStats) {
+	if s == nil {
+		return
+	}
+	size := stats.footprint()
+	if e, ok := s.resident[key.windowEnd][key]; ok {
+		r := e.Value.(*residentStats)
+		s.used += int64(size - r.size)
+		r.size = size
+		s.lru.MoveToFront(e)
+		return
+	}
+	if s.resident[key.windowEnd] == nil {
+		s.resident[key.windowEnd] = make(map[stateKey]*list.Element)
+	}
+	s.resident[key.windowEnd][key] = s.lru.PushFront(&residentStats{key: key, stats: stats, size: size})
+	s.used += int64(size)
+}
+
+// take reads back spilled stats, or returns new stats if key was not spilled or cannot be
+// read back.
+func (s *stateSpiller) take(key stateKey) *FeatureStats {
+	if s == nil {
+		return &FeatureStats{}
+	}
+	f := s.files[key.windowEnd]
+	record, ok := f.lookup(key)
+	if !ok {
+		return &FeatureStats{}
+	}
+	delete(f.records, key)
+	return s.readBack(f, key, record)
+}
+
+// readBack reads spilled stats, or returns new stats if they cannot be read.
+func (s *stateSpiller) readBack(f *spillFile, key stateKey, record spillRecord) *FeatureStats {
+	stats, err := f.read(record)
+	if err != nil {
+		s.metrics.windowStateSpills.WithLabelValues("failed").Inc()
+		s.logger.Error("Failed to read back spilled window state, its aggregates are lost",
+			logging.WindowEnd(key.windowEnd),
+			logging.Feature(key.name),
+			zap.Error(err),
+		)
+		s.reporter.Report(&OpError{Component: ComponentCalculator, Op: "spill_read", Severity: ErrorSeverityError, Err: err})
+		return &FeatureStats{}
+	}
+	s.metrics.windowStateSpills.WithLabelValues("restore").Inc()
+	return stats
+}
+
+// enforce spills the least recently updated stats of windows until the stats in memory
+// fit the budget. The most recently updated stats always stay in memory.
+func (s *stateSpiller) enforce(windows map[time.Time]*windowInfo) {
+	if s == nil {
+		return
+	}
+	defer s.report()
+	for s.used > s.budget && s.lru.Len() > 1 {
+		e := s.lru.Back()
+		r := e.Value.(*residentStats)
+		if err := s.spill(r); err != nil {
+			s.metrics.windowStateSpills.WithLabelValues("failed").Inc()
+			s.logger.Error("Failed to spill window state, keeping it in memory", zap.Error(err))
+			s.reporter.Report(&OpError{Component: ComponentCalculator, Op: "spill", Severity: ErrorSeverityWarning, Retryable: true, Err: err})
+			return // Retried on the next message
+		}
+		s.metrics.windowStateSpills.WithLabelValues("spill").Inc()
+		s.forget(e)
+		w := windows[r.key.windowEnd]
+		if r.key.late {
+			w = w.late
+		}
+		if r.key.segment {
+			delete(w.groups[r.key.name], r.key.group)
+		} else {
+			delete(w.features, r.key.name)
+		}
+	}
+}
+
+// spill appends stats to their window's spill file.
+func (s *stateSpiller) spill(r *residentStats) error {
+	f, ok := s.files[r.key.windowEnd]
+	if !ok {
+		path := filepath.Join(s.dir, "window-"+strconv.FormatInt(r.key.windowEnd.UnixNano(), 10)+".spill")
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_RDWR, 0o644)
+		if err != nil {
+			return err
+		}
+		f = &spillFile{file: file, records: make(map[stateKey]spillRecord)}
+		s.files[r.key.windowEnd] = f
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(r.stats.partial()); err != nil {
+		return err
+	}
+	if _, err := f.file.WriteAt(buf.Bytes(), f.size); err != nil {
+		return err
+	}
+	f.records[r.key] = spillRecord{offset: f.size, length: int64(buf.Len())}
+	f.size += int64(buf.Len())
+	s.spilled += int64(buf.Len())
+	return nil
+}
+
+// forget stops tracking stats in memory.
+func (s *stateSpiller) forget(e *list.Element) {
+	r := s.lru.Remove(e).(*residentStats)
+	s.used -= int64(r.size)
+	delete(s.resident[r.key.windowEnd], r.key)
+	if len(s.resident[r.key.windowEnd]) == 0 {
+		delete(s.resident, r.key.windowEnd)
+	}
+}
+
+// release reads every spilled stats of a closing window back into it, then stops
+// tracking the window and removes its spill file.
+func (s *stateSpiller) release(w *windowInfo) {
+	if s == nil {
+		return
+	}
+	defer s.report()
+	for _, e := range s.resident[w.windowEnd] {
+		s.forget(e)
+	}
+	f, ok := s.files[w.windowEnd]
+	if !ok {
+		return
+	}
+	delete(s.files, w.windowEnd)
+	for key, record := range f.records {
+		stats := s.readBack(f, key, record)
+		target := w
+		if key.late {
+			target = w.late // Kept when its stats are spilled
+		}
+		if key.segment {
+			if target.groups == nil {
+				target.groups = make(map[string]map[string]*FeatureStats)
+			}
+			if target.groups[key.name] == nil {
+				target.groups[key.name] = make(map[string]*FeatureStats)
+			}
+			target.groups[key.name][key.group] = stats
+		} else {
+			target.features[key.name] = stats
+		}
+	}
+	s.spilled -= f.size
+	if err := f.file.Close(); err != nil {
+		s.logger.Warn("Failed to close window state spill file", zap.Error(err))
+	}
+	if err := os.Remove(f.file.Name()); err != nil {
+		s.logger.Warn("Failed to remove window state spill file", zap.Error(err))
+	}
+}
+
+func (s *stateSpiller) report() {
+	s.metrics.windowStateBytes.WithLabelValues("memory").Set(float64(s.used))
+	s.metrics.windowStateBytes.WithLabelValues("disk").Set(float64(s.spilled))
+}
+
+func (f *spillFile) lookup(key stateKey) (spillRecord, bool) {
+	if f == nil {
+		return spillRecord{}, false
+	}
+	record, ok := f.records[key]
+	return record, ok
+}
+
+func (f *spillFile) read(record spillRecord) (*FeatureStats, error) {
+	buf := make([]byte, record.length)
+	if _, err := f.file.ReadAt(buf, record.offset); err != nil {
+		return nil, err
+	}
+	var p partialStats
+	if err := gob.NewDecoder(bytes.NewReader(buf)).Decode(&p); err != nil {
+		return nil, err
+	}
+	return p.restore()
+}
+
+// footprint estimates the memory held by the stats, in bytes.
+func (s *FeatureStats) footprint() int {
+	const (
+		statsBytes    = 208 // The struct itself
+		categoryBytes = 64  // Map entry; category strings are interned
+	)
+	n := statsBytes + categoryBytes*len(s.categories)
+	if v := s.vector; v != nil {
+		n += 128 + 16*len(v.sum) // Element-wise sums and unit sums
+	}
+	if s.samples != nil {
+		for _, value := range s.samples.values {
+			n += 16 + len(value)
+		}
+	}
+	if e := s.exemplars; e != nil {
+		for _, ids := range [][]string{e.values.values, e.nulls.values} {
+			for _, id := range ids {
+				n += 16 + len(id)
+			}
+		}
+	}
+	if s.percentiles != nil {
+		n += s.percentiles.Size()
+	}
+	if s.quantile != nil {
+		n += s.quantile.Size()
+	}
+	if s.cardinality != nil {
+		n += s.cardinality.Size()
+	}
+	if s.frequency != nil {
+		n += s.frequency.Size()
+	}
+	return n
+}
@@ -0,0 +1,54 @@
+package pipeline
+
+import (
+	"sync"
+	"time"
+
+	"github.com/sanspareilsmyn/featurelens/internal/message"
+)
+
+// Stages timed by featurelens_stage_latency_seconds.
+const (
+	stageParse     = "parse"     // From the source handing a batch downstream to its messages being parsed
+	stageAggregate = "aggregate" // From the parser sending a batch to the calculator having aggregated it
+	stageAlert     = "alert"     // From the calculator flushing a window to the alerter having evaluated its result
+)
+
+// observeStage records the time elapsed since start in the latency histogram of stage.
+func (m *Metrics) observeStage(stage string, start time.Time) {
+	m.stageLatency.WithLabelValues(stage).Observe(time.Since(start).Seconds())
+}
+
+// batchTimes remembers when the parser sent batches to the calculator until it has
+// aggregated them. Batches are known by the address of their first message, which only
+// their own slice refers to while they are in flight. A nil batchTimes times nothing.
+type batchTimes struct {
+	mu   sync.Mutex
+	sent map[*message.DynamicMessage]time.Time
+}
+
+func newBatchTimes() *batchTimes {
+	return &batchTimes{sent: make(map[*message.DynamicMessage]time.Time)}
+}
+
+// send records that batch is being sent now.
+func (b *batchTimes) send(batch []message.DynamicMessage) {
+	if b == nil || len(batch) == 0 {
+		return
+	}
+	b.mu.Lock()
+	b.sent[&batch[0]] = time.Now()
+	b.mu.Unlock()
+}
+
+// received forgets batch, returning when it was sent; ok is false if that is unknown.
+func (b *batchTimes) received(batch []message.DynamicMessage) (sent time.Time, ok bool) {
+	if b == nil || len(batch) == 0 {
+		return time.Time{}, false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	sent, ok = b.sent[&batch[0]]
+	delete(b.sent, &batch[0])
+	return sent, ok
+}
@@ -0,0 +1,146 @@
+package pipeline
+
+import (
+	"sort"
+	"time"
+)
+
+// Alert is a violation that is currently firing: raised in a recent window and not yet
+// followed by a healthy window of the same feature.
+type Alert struct {
+	FeatureName  string    `json:"featureName"`
+	ModelVersion string    `json:"modelVersion,omitempty"`
+	Tenant       string    `json:"tenant,omitempty"`
+	CheckType    string    `json:"checkType"`
+	Comparison   string    `json:"comparison"`
+	Severity     string    `json:"severity"`
+	Silenced     bool      `json:"silenced"`
+	Actual       float64   `json:"actual"`
+	Threshold    float64   `json:"threshold"`
+	Since        time.Time `json:"since"`         // Window end of the first violation in the run
+	LastWindow   time.Time `json:"lastWindowEnd"` // Window end of the most recent violation
+
+	Acknowledgement *Acknowledgement `json:"acknowledgement,omitempty"` // nil unless acknowledged
+	Metadata        *FeatureMetadata `json:"metadata,omitempty"`        // Of the feature, nil when none is configured
+
+	lastSeen time.Time // Clock time of the most recent violation, for expiry
+}
+
+// duration returns how long the alert fired until the healthy window ending at windowEnd.
+func (a Alert) duration(windowEnd time.Time) time.Duration {
+	return max(windowEnd.Sub(a.Since), 0)
+}
+
+// Status summarizes an instance's health for operators: what it monitors and which
+// alerts are firing.
+type Status struct {
+	StartedAt         time.Time `json:"startedAt"`
+	Features          int       `json:"features"`
+	Silences          int       `json:"silences"`
+	SeverityOverrides int       `json:"severityOverrides"`
+	Alerts            []Alert   `json:"alerts"`
+}
+
+// alertKey identifies a firing alert by feature, check and comparison.
+func alertKey(featureName, checkType, comparison string) string {
+	return featureName + "\x00" + checkType + "\x00" + comparison
+}
+
+// recordAlert marks the violation's check as firing, keeping the start of the run and
+// its acknowledgement. It returns the alert and whether it started firing, the OK to
+// FIRING transition.
+func (c *Controls) recordAlert(v Violation, silenced bool) (Alert, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := alertKey(v.FeatureName, v.CheckType, v.Comparison)
+	since := v.WindowEnd
+	var ack *Acknowledgement
+	prev, firing := c.alerts[key]
+	if firing {
+		since, ack = prev.Since, prev.Acknowledgement
+	}
+	alert := Alert{
+		FeatureName:  v.FeatureName,
+		ModelVersion: v.ModelVersion,
+		Tenant:       v.Tenant,
+		CheckType:    v.CheckType,
+		Comparison:   v.Comparison,
+		Severity:     v.Severity,
+		Silenced:     silenced,
+		Actual:       v.Actual,
+		Threshold:    v.Threshold,
+		Since:        since,
+		LastWindow:   v.WindowEnd,
+
+		Acknowledgement: ack,
+		Metadata:        v.Metadata,
+
+		lastSeen: c.clock.Now(),
+	}
+	c.alerts[key] = alert
+	return alert, !firing
+}
+
+// firing reports whether the check of a feature has a firing alert.
+func (c *Controls) firing(featureName, checkType, comparison string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.alerts[alertKey(featureName, checkType, comparison)]
+	return ok
+}
+
+// resolveAlerts clears the feature's firing alerts, and their acknowledgements, after a
+// healthy window and returns them.
+func (c *Controls) resolveAlerts(featureName string) []Alert {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var resolved []Alert
+	for key, alert := range c.alerts {
+		if alert.FeatureName == featureName {
+			delete(c.alerts, key)
+			resolved = append(resolved, alert)
+		}
+	}
+	return resolved
+}
+
+// Status returns the instance's current health summary. Alerts are ordered by severity,
+// then by how long they have been firing.
+func (c *Controls) Status() Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.clock.Now()
+	c.pruneLocked(now)
+
+	alerts := make([]Alert, 0, len(c.alerts))
+	for _, alert := range c.alerts {
+		alerts = append(alerts, alert)
+	}
+	sort.Slice(alerts, func(i, j int) bool {
+		if ri, rj := severityRank(alerts[i].Severity), severityRank(alerts[j].Severity); ri != rj {
+			return ri > rj
+		}
+		return alerts[i].Since.Before(alerts[j].Since)
+	})
+	return Status{
+		StartedAt:         c.startedAt,
+		Features:          len(c.registry.Features()),
+		Silences:          c.activeSilencesLocked(now),
+		SeverityOverrides: len(c.overrides),
+		Alerts:            alerts,
+	}
+}
+
+// severityRank orders severities from least to most severe.
+func severityRank(severity string) int {
+	switch severity {
+	case SeverityCritical:
+		return 2
+	case SeverityWarning:
+		return 1
+	default:
+		return 0
+	}
+}
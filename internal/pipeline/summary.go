@@ -0,0 +1,158 @@
+package pipeline
+
+import (
+	"math"
+	"slices"
+	"sort"
+	"sync"
+
+	"github.com/sanspareilsmyn/featurelens/internal/discovery"
+	"github.com/sanspareilsmyn/featurelens/internal/schema"
+)
+
+// maxSummaryViolations bounds the violations a RunSummary keeps for its report; further
+// ones are only counted.
+const maxSummaryViolations = 10000
+
+// RunSummary tallies the windows evaluated and the violations raised since the pipeline
+// started, per feature, for the report of a batch run or replay.
+type RunSummary struct {
+	mu         sync.Mutex
+	features   map[string]*featureTally
+	violations []schema.Violation // Up to maxSummaryViolations, in the order detected
+	omitted    int64
+}
+
+// featureTally is one feature's statistics over every window, merged like FeatureStats,
+// and the violations it raised.
+type featureTally struct {
+	windows      int64
+	count        int64
+	nullCount    int64
+	missingCount int64
+	mismatches   int64
+	valueCount   int64
+	mean         float64
+	m2           float64
+	violations   int64 // Not counting silenced and canary ones
+	silenced     int64
+	canary       int64
+	checks       []string // Sorted
+}
+
+// newRunSummary creates an empty RunSummary.
+func newRunSummary() *RunSummary {
+	return &RunSummary{features: make(map[string]*featureTally)}
+}
+
+// feature returns the tally of a feature. MUST be called with the mutex held.
+func (s *RunSummary) feature(name string) *featureTally {
+	f, ok := s.features[name]
+	if !ok {
+		f = &featureTally{}
+		s.features[name] = f
+	}
+	return f
+}
+
+// addWindow counts an evaluated window of a feature.
+func (s *RunSummary) addWindow(result AggregationResult) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f := s.feature(result.FeatureName)
+	f.windows++
+	f.count += result.Count
+	f.nullCount += result.NullCount
+	f.missingCount += result.MissingCount
+	f.mismatches += result.TypeMismatchCount
+	if result.ValueCount > 0 && !math.IsNaN(result.Mean) {
+		// Parallel combination of the windows' means and sums of squared deviations
+		n := f.valueCount + result.ValueCount
+		m2 := result.Variance * float64(result.ValueCount)
+		d := result.Mean - f.mean
+		f.m2 += m2 + d*d*float64(f.valueCount)*float64(result.ValueCount)/float64(n)
+		f.mean += d * float64(result.ValueCount) / float64(n)
+		f.valueCount = n
+	}
+}
+
+// addViolation counts a reported violation.
+func (s *RunSummary) addViolation(v Violation) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.violations) < maxSummaryViolations {
+		s.violations = append(s.violations, v.Payload())
+	} else {
+		s.omitted++
+	}
+	f := s.feature(v.FeatureName)
+	switch {
+	case v.Canary:
+		f.canary++
+		return
+	case v.Silenced:
+		f.silenced++
+		return
+	}
+	f.violations++
+	if i, found := slices.BinarySearch(f.checks, v.CheckType); !found {
+		f.checks = slices.Insert(f.checks, i, v.CheckType)
+	}
+}
+
+// Report returns the summary as a run report, features ordered by name. The caller sets
+// the mode, status, exit code and times of the run.
+func (s *RunSummary) Report() schema.RunReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	report := schema.RunReport{
+		SchemaVersion:     schema.Version,
+		Kind:              schema.KindRunReport,
+		Features:          make([]schema.FeatureReport, 0, len(s.features)),
+		ViolationDetails:  append(make([]schema.Violation, 0, len(s.violations)), s.violations...),
+		ViolationsOmitted: s.omitted,
+	}
+	for name, f := range s.features {
+		report.Windows += f.windows
+		report.Violations += f.violations
+		report.Features = append(report.Features, f.report(name))
+	}
+	sort.Slice(report.Features, func(i, j int) bool {
+		return report.Features[i].FeatureName < report.Features[j].FeatureName
+	})
+	return report
+}
+
+// report returns the feature's tally as a feature report.
+func (f *featureTally) report(name string) schema.FeatureReport {
+	r := schema.FeatureReport{
+		FeatureName: name,
+		Windows:     f.windows,
+		Count:       f.count,
+		Violations:  f.violations,
+		Silenced:    f.silenced,
+		Canary:      f.canary,
+		Checks:      append(make([]string, 0, len(f.checks)), f.checks...),
+	}
+	if f.count == 0 {
+		return r
+	}
+	rate := func(n int64) *float64 { return schema.OptionalFloat(float64(n) / float64(f.count)) }
+	r.NullRate, r.MissingRate, r.TypeMismatchRate = rate(f.nullCount), rate(f.missingCount), rate(f.mismatches)
+
+	proposed := discovery.SuggestThresholds(f.count, f.nullCount, f.missingCount)
+	if f.valueCount > 0 {
+		stdDev := math.Sqrt(max(f.m2, 0) / float64(f.valueCount))
+		r.Mean, r.StdDev = schema.OptionalFloat(f.mean), schema.OptionalFloat(stdDev)
+		proposed = discovery.SuggestNumericalThresholds(f.count, f.nullCount, f.missingCount, f.mean, stdDev)
+	}
+	r.ProposedThresholds = &schema.ProposedThresholds{
+		NullRateMax:    proposed.NullRate,
+		MissingRateMax: proposed.MissingRate,
+		MeanMin:        proposed.MeanMin,
+		MeanMax:        proposed.MeanMax,
+		StdDevMin:      proposed.StdDevMin,
+		StdDevMax:      proposed.StdDevMax,
+	}
+	return r
+}
@@ -0,0 +1,86 @@
+package pipeline
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.uber.org/zap"
+)
+
+// instrumentationName identifies the pipeline's OpenTelemetry tracer and meter.
+const instrumentationName = "github.com/sanspareilsmyn/featurelens/internal/pipeline"
+
+// tracer resolves through the global provider, so spans are no-ops unless telemetry is enabled.
+var tracer = otel.Tracer(instrumentationName)
+
+// instruments holds the OpenTelemetry metrics describing the pipeline itself.
+type instruments struct {
+	messagesConsumed metric.Int64Counter
+	throttleTime     metric.Float64Counter
+	parseErrors      metric.Int64Counter
+	flushDuration    metric.Float64Histogram
+	evalDuration     metric.Float64Histogram
+	violations       metric.Int64Counter
+}
+
+// newInstruments creates the pipeline instruments. Creation only fails for invalid
+// instrument names, and a usable no-op instrument is returned even then.
+func newInstruments() *instruments {
+	meter := otel.Meter(instrumentationName)
+	var in instruments
+	in.messagesConsumed, _ = meter.Int64Counter("featurelens.consumer.messages",
+		metric.WithDescription("Messages fetched from Kafka."), metric.WithUnit("{message}"))
+	in.throttleTime, _ = meter.Float64Counter("featurelens.consumer.throttled",
+		metric.WithDescription("Time the consumer waited on kafka.rateLimit."), metric.WithUnit("s"))
+	in.parseErrors, _ = meter.Int64Counter("featurelens.parser.errors",
+		metric.WithDescription("Messages that could not be parsed."), metric.WithUnit("{message}"))
+	in.flushDuration, _ = meter.Float64Histogram("featurelens.window.flush.duration",
+		metric.WithDescription("Time to compute and emit the results of a completed window."), metric.WithUnit("s"))
+	in.evalDuration, _ = meter.Float64Histogram("featurelens.alert.evaluation.duration",
+		metric.WithDescription("Time to evaluate thresholds and conditions for one result."), metric.WithUnit("s"))
+	in.violations, _ = meter.Int64Counter("featurelens.alert.violations",
+		metric.WithDescription("Threshold violations notified, with exemplars of the requests traced by pipeline.exemplars."), metric.WithUnit("{violation}"))
+	return &in
+}
+
+// telemetry is shared by all components; instruments are safe for concurrent use and
+// bind to the global meter provider once telemetry is set up.
+var telemetry = newInstruments()
+
+// observeSeconds records the time elapsed since start on a duration histogram.
+func observeSeconds(ctx context.Context, h metric.Float64Histogram, start time.Time, attrs ...attribute.KeyValue) {
+	h.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(attrs...))
+}
+
+// registerPipelineGauges reports consumer lag and channel depths on every metric collection.
+func (p *Pipeline) registerPipelineGauges() {
+	meter := otel.Meter(instrumentationName)
+	lag, err := meter.Int64ObservableGauge("featurelens.consumer.lag",
+		metric.WithDescription("Messages between the last fetched offset and the partition high watermark."), metric.WithUnit("{message}"))
+	if err != nil {
+		p.logger.Warn("Failed to create telemetry instrument", zap.String("instrument", "featurelens.consumer.lag"), zap.Error(err))
+		return
+	}
+	depth, err := meter.Int64ObservableGauge("featurelens.channel.depth",
+		metric.WithDescription("Items buffered between pipeline stages."), metric.WithUnit("{item}"))
+	if err != nil {
+		p.logger.Warn("Failed to create telemetry instrument", zap.String("instrument", "featurelens.channel.depth"), zap.Error(err))
+		return
+	}
+
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		if p.consumer != nil {
+			o.ObserveInt64(lag, p.consumer.Lag(), metric.WithAttributes(attribute.String("topic", p.cfg.Kafka.Subscription())))
+		}
+		for channel, items := range p.channelDepths() {
+			o.ObserveInt64(depth, int64(items), metric.WithAttributes(attribute.String("channel", channel)))
+		}
+		return nil
+	}, lag, depth)
+	if err != nil {
+		p.logger.Warn("Failed to register telemetry callback", zap.Error(err))
+	}
+}
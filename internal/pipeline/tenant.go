@@ -0,0 +1,29 @@
+package pipeline
+
+import (
+	"github.com/sanspareilsmyn/featurelens/internal/config"
+	"github.com/sanspareilsmyn/featurelens/internal/message"
+)
+
+// messageTenant returns the tenant a message belongs to, or "" if the tenant field is not
+// configured or the message has no value for it.
+func messageTenant(msg message.DynamicMessage, field string) string {
+	if field == "" || !msg.HasNonNull(field) {
+		return ""
+	}
+	return groupValue(msg, field)
+}
+
+// inTenant reports whether a message of the tenant is aggregated into the feature.
+// Features without a tenant see every message, as do tenant features unless messages name
+// their tenant through pipeline.tenantField.
+func inTenant(f config.FeatureConfig, tenantField, tenant string) bool {
+	return f.Tenant == "" || tenantField == "" || f.Tenant == tenant
+}
+
+// inTopics reports whether a message consumed from the topic is aggregated into the
+// feature. Features without topics see every message, as do all features for messages
+// without a topic, e.g. replayed ones.
+func inTopics(f config.FeatureConfig, topic string) bool {
+	return len(f.Topics) == 0 || topic == "" || matchesAny(f.Topics, topic)
+}
@@ -0,0 +1,75 @@
+package pipeline
+
+import (
+	"context"
+	"time"
+
+	"github.com/sanspareilsmyn/featurelens/internal/config"
+)
+
+// ThroughputResult holds the number of messages processed in a window. Unlike feature
+// results, one is emitted for every completed window, including windows without messages.
+type ThroughputResult struct {
+	WindowStart time.Time
+	WindowEnd   time.Time
+	Count       int64 // Messages processed, including those sampled out for some features
+
+	fields     map[string]fieldTypeCounts            // Value types of the messages' fields, with schema tracking
+	partitions map[string]map[string]partitionCounts // Feature name to its stats by partition, with partition statistics
+}
+
+// throughputChecked reports whether any throughput bound is configured or completeness
+// is computed.
+func throughputChecked(cfg config.ThroughputConfig) bool {
+	return cfg.Min != nil || cfg.Max != nil || cfg.ChangeMax != nil || cfg.Completeness.Enabled()
+}
+
+// countMessage counts a message in its window's throughput.
+func (c *Calculator) countMessage(windowEnd time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.getOrCreateWindow(windowEnd).messages++
+}
+
+// emitThroughput sends the throughput of every window completed by cutoff since the last
+// one sent, taking counts from windows and zero for windows that had no message.
+func (c *Calculator) emitThroughput(ctx context.Context, cutoff time.Time, windows map[time.Time]*windowInfo, block bool) {
+	size := c.config.WindowSize
+	for end := c.throughputEnd.Add(size); !end.After(cutoff); end = end.Add(size) {
+		result := ThroughputResult{WindowStart: end.Add(-size), WindowEnd: end}
+		if w, ok := windows[end]; ok {
+			result.Count = w.messages
+			if w.fields != nil {
+				result.fields = make(map[string]fieldTypeCounts, len(w.fields))
+				for field, counts := range w.fields {
+					result.fields[field] = *counts
+				}
+			}
+			if w.partitions != nil {
+				result.partitions = make(map[string]map[string]partitionCounts, len(w.partitions))
+				for name, byPartition := range w.partitions {
+					copied := make(map[string]partitionCounts, len(byPartition))
+					for partition, counts := range byPartition {
+						copied[partition] = *counts
+					}
+					result.partitions[name] = copied
+				}
+			}
+		}
+		if block {
+			select {
+			case c.throughput <- result:
+			case <-ctx.Done():
+				return
+			}
+		} else {
+			select {
+			case c.throughput <- result:
+			default:
+				c.stats.addDropped(channelThroughputResults)
+				c.logger.Warn("Throughput output channel full, dropping result")
+			}
+		}
+		c.throughputEnd = end
+	}
+}
@@ -0,0 +1,103 @@
+package pipeline
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+
+	"github.com/sanspareilsmyn/featurelens/internal/config"
+	"github.com/sanspareilsmyn/featurelens/internal/discovery"
+)
+
+const (
+	// tuneGroupSuffix keeps threshold learning from joining the monitoring consumer group.
+	tuneGroupSuffix = "-tune"
+	// maxLearnedWindows bounds the windows a ThresholdLearner keeps per feature; later
+	// ones are ignored.
+	maxLearnedWindows = 100000
+)
+
+// ThresholdLearner records the statistics of every feature's windows, for thresholds
+// to be fitted to them once the learning period ends. Only the overall results of
+// features are recorded, not those of segments or model versions.
+type ThresholdLearner struct {
+	mu       sync.Mutex
+	features map[string]*discovery.WindowSamples
+}
+
+// LearnThresholds runs the pipeline over the configured topic for duration and returns
+// the statistics of the windows it closed. Nothing leaves the process while learning:
+// sinks, actions, remote write, the audit log and the result stores are disabled, and
+// the pipeline's metrics are not registered, so a tune run beside the monitoring one
+// neither alerts twice nor overwrites its series.
+func LearnThresholds(ctx context.Context, cfg *config.Config, duration time.Duration, logger *zap.Logger) (*ThresholdLearner, error) {
+	quiet := *cfg
+	quiet.Kafka.GroupID += tuneGroupSuffix
+	quiet.Sinks.Outputs, quiet.Sinks.Routes, quiet.Sinks.LedgerPath = nil, nil, ""
+	quiet.Errors.NotifySinks = nil
+	quiet.Actions.Triggers = nil
+	quiet.RemoteWrite.Enabled = false
+	quiet.Audit.Enabled = false
+	quiet.Store.Enabled = false
+	quiet.Skew.Enabled = false
+
+	logger = logger.Named("tune")
+	p, err := New(&quiet, prometheus.NewRegistry(), logger)
+	if err != nil {
+		return nil, err
+	}
+	l := &ThresholdLearner{features: make(map[string]*discovery.WindowSamples)}
+	p.alerter.learner = l
+
+	ctx, cancel := context.WithTimeout(ctx, duration)
+	defer cancel()
+	logger.Info("Learning thresholds",
+		zap.String("topic", quiet.Kafka.Subscription()),
+		zap.String("group_id", quiet.Kafka.GroupID),
+		zap.Duration("duration", duration),
+	)
+	if err := p.Run(ctx); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// addWindow records a window's statistics. Empty windows and late buckets carry none.
+func (l *ThresholdLearner) addWindow(result AggregationResult) {
+	if result.Segment != nil || result.ModelVersion != "" || result.Late || result.Count == 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	s, ok := l.features[result.FeatureName]
+	if !ok {
+		s = &discovery.WindowSamples{}
+		l.features[result.FeatureName] = s
+	}
+	if len(s.NullRates) >= maxLearnedWindows {
+		return
+	}
+	s.NullRates = append(s.NullRates, result.rate(result.NullCount))
+	s.MissingRates = append(s.MissingRates, result.rate(result.MissingCount))
+	if result.ValueCount > 0 && !math.IsNaN(result.Mean) {
+		s.Means = append(s.Means, result.Mean)
+		if !math.IsNaN(result.Variance) && result.Variance >= 0 {
+			s.StdDevs = append(s.StdDevs, math.Sqrt(result.Variance))
+		}
+	}
+}
+
+// Samples returns the statistics recorded for a feature.
+func (l *ThresholdLearner) Samples(featureName string) discovery.WindowSamples {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	s, ok := l.features[featureName]
+	if !ok {
+		return discovery.WindowSamples{}
+	}
+	return *s
+}
@@ -0,0 +1,7 @@
+package promrules
+
+import "errors"
+
+var (
+	ErrInvalidPattern = errors.New("feature pattern cannot be translated to a label matcher")
+)
@@ -0,0 +1,350 @@
+// Package promrules renders the configured feature thresholds as Prometheus alerting
+// rules over the gauges FeatureLens exports, so teams alerting through Alertmanager get
+// rules matching what FeatureLens checks.
+package promrules
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/sanspareilsmyn/featurelens/internal/config"
+)
+
+// DefaultAlertName is the alertname of generated rules, the same as the alertmanager
+// sink's default so Alertmanager routes treat both alike.
+const DefaultAlertName = "FeatureLensViolation"
+
+// check is a threshold check with its exported gauge. Value checks, unlike rate checks,
+// are gated by minCount on the non-null values of a window.
+type check struct {
+	key        string // Threshold key, e.g. nullRateMax
+	checkType  string
+	comparison string
+	metric     string
+	matchers   string // Extra label matchers of the metric, e.g. `quantile="0.5"`
+	value      bool
+	group      string // Metric of per-group results, empty when groups do not export it
+}
+
+// checks are the threshold checks rendered as rules, in output order.
+var checks = []check{
+	{"nullRateMax", "null_rate", ">", "featurelens_feature_window_null_rate", "", false, "featurelens_feature_group_window_null_rate"},
+	{"missingRateMax", "missing_rate", ">", "featurelens_feature_window_missing_rate", "", false, "featurelens_feature_group_window_missing_rate"},
+	{"typeMismatchRateMax", "type_mismatch_rate", ">", "featurelens_feature_window_type_mismatch_rate", "", false, ""},
+	{"meanMin", "mean", "<", "featurelens_feature_window_mean_value", "", true, "featurelens_feature_group_window_mean_value"},
+	{"meanMax", "mean", ">", "featurelens_feature_window_mean_value", "", true, "featurelens_feature_group_window_mean_value"},
+	{"stdDevMin", "stddev", "<", "featurelens_feature_window_stddev_value", "", true, "featurelens_feature_group_window_stddev_value"},
+	{"stdDevMax", "stddev", ">", "featurelens_feature_window_stddev_value", "", true, "featurelens_feature_group_window_stddev_value"},
+	{"zeroRateMax", "zero_rate", ">", "featurelens_feature_window_zero_rate", "", true, ""},
+	{"outlierRateMax", "outlier_rate", ">", "featurelens_feature_window_outlier_rate", "", true, ""},
+	{"distinctMin", "distinct", "<", "featurelens_feature_window_distinct_estimate", "", true, ""},
+	{"distinctMax", "distinct", ">", "featurelens_feature_window_distinct_estimate", "", true, ""},
+	{"avgLengthMin", "avg_length", "<", "featurelens_feature_window_avg_length", "", true, ""},
+	{"avgLengthMax", "avg_length", ">", "featurelens_feature_window_avg_length", "", true, ""},
+	{"maxLength", "max_length", ">", "featurelens_feature_window_max_length", "", true, ""},
+	{"patternMatchRateMin", "pattern_match_rate", "<", "featurelens_feature_window_pattern_match_rate", "", true, ""},
+	{"p50Max", "p50", ">", "featurelens_feature_window_percentile", `quantile="0.5"`, true, ""},
+	{"p95Max", "p95", ">", "featurelens_feature_window_percentile", `quantile="0.95"`, true, ""},
+	{"p99Max", "p99", ">", "featurelens_feature_window_percentile", `quantile="0.99"`, true, ""},
+	{"normMin", "norm_mean", "<", "featurelens_feature_window_norm_mean", "", true, ""},
+	{"normMax", "norm_mean", ">", "featurelens_feature_window_norm_mean", "", true, ""},
+	{"dimensionMismatchRateMax", "dimension_mismatch_rate", ">", "featurelens_feature_window_dimension_mismatch_rate", "", true, ""},
+	{"nonFiniteRateMax", "non_finite_rate", ">", "featurelens_feature_window_non_finite_rate", "", true, ""},
+	{"centroidDistanceMax", "centroid_distance", ">", "featurelens_feature_window_centroid_distance", "", true, ""},
+	{"trueRateMin", "true_rate", "<", "featurelens_feature_window_true_rate", "", true, ""},
+	{"trueRateMax", "true_rate", ">", "featurelens_feature_window_true_rate", "", true, ""},
+}
+
+// Options tune the generated rules.
+type Options struct {
+	Group     string // Rule group name
+	AlertName string // alertname of every rule
+}
+
+// ruleFile is the Prometheus rule file written by Write.
+type ruleFile struct {
+	Groups []ruleGroup `yaml:"groups"`
+}
+
+type ruleGroup struct {
+	Name  string `yaml:"name"`
+	Rules []rule `yaml:"rules"`
+}
+
+type rule struct {
+	Alert       string            `yaml:"alert"`
+	Expr        string            `yaml:"expr"`
+	For         string            `yaml:"for,omitempty"`
+	Labels      map[string]string `yaml:"labels"`
+	Annotations map[string]string `yaml:"annotations"`
+}
+
+// Write renders the thresholds of the configured features as a Prometheus rule file, one
+// rule per bound and severity. forWindows becomes the rule's for duration, and minCount a
+// condition on the window's message count, so rules fire on the windows FeatureLens
+// alerts on. Checks without a gauge (conditions, seasonal, custom and composite checks),
+// and features in canary mode, are listed in the header comment instead.
+func Write(w io.Writer, cfg *config.Config, opts Options) error {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "# Generated by `featurelens promrules`; regenerate instead of editing.\n")
+	fmt.Fprintf(&b, "# Features beyond pipeline.maxFeatureSeries share the __other__ series and are not covered.\n")
+
+	explicit := make([]string, 0, len(cfg.Features))
+	for _, f := range cfg.Features {
+		if f.Pattern == "" {
+			explicit = append(explicit, f.Name)
+		}
+	}
+	group := ruleGroup{Name: opts.Group, Rules: []rule{}}
+	for _, f := range cfg.Features {
+		if f.Canary() {
+			fmt.Fprintf(&b, "# %q: in canary mode, its thresholds are not alerted on\n", featureLabel(f))
+			continue
+		}
+		matcher, err := featureMatcher(f, explicit)
+		if err != nil {
+			return err
+		}
+		window := f.Window(cfg.Pipeline.WindowSize)
+		group.Rules = append(group.Rules, featureRules(f, f.Thresholds, matcher, "", window, opts)...)
+
+		groups := make([]string, 0, len(f.GroupThresholds))
+		for name := range f.GroupThresholds {
+			groups = append(groups, name)
+		}
+		sort.Strings(groups)
+		for _, name := range groups {
+			groupMatcher := matcher + `, group=~"(?i)` + quote(regexp.QuoteMeta(name)) + `"`
+			group.Rules = append(group.Rules, featureRules(f, f.GroupThresholds[name], groupMatcher, name, window, opts)...)
+		}
+
+		if f.Thresholds.Resolve != nil {
+			fmt.Fprintf(&b, "# %q: resolve bounds are only applied by FeatureLens, its rules resolve at the firing bounds\n", featureLabel(f))
+		}
+		if len(f.Conditions) > 0 || len(f.Seasonal.Periods) > 0 || len(f.CustomChecks) > 0 {
+			fmt.Fprintf(&b, "# %q: conditions, seasonal and custom checks are only evaluated by FeatureLens\n", featureLabel(f))
+		}
+	}
+	if len(cfg.CompositeMetrics) > 0 {
+		fmt.Fprintf(&b, "# Composite metrics are only evaluated by FeatureLens\n")
+	}
+
+	enc := yaml.NewEncoder(&b)
+	enc.SetIndent(2)
+	if err := enc.Encode(ruleFile{Groups: []ruleGroup{group}}); err != nil {
+		return err
+	}
+	if err := enc.Close(); err != nil {
+		return err
+	}
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// featureRules returns the rules of a feature's thresholds, or of one of its groups',
+// selecting the feature's series with matcher.
+func featureRules(f config.FeatureConfig, t config.Thresholds, matcher, group string, window time.Duration, opts Options) []rule {
+	var rules []rule
+	severities := []struct {
+		name       string
+		thresholds *config.Thresholds
+	}{{"warning", &t}, {"critical", t.Critical}}
+	for _, severity := range severities {
+		if severity.thresholds == nil {
+			continue
+		}
+		bounds := boundsOf(*severity.thresholds)
+		for _, c := range checks {
+			bound, ok := bounds[c.key]
+			if !ok {
+				continue
+			}
+			metric := c.metric
+			if group != "" {
+				if c.group == "" {
+					continue // Not exported per group
+				}
+				metric = c.group
+			}
+			rules = append(rules, newRule(f, c, metric, matcher, group, bound, severity.name, t.ForWindows, window, opts))
+		}
+		if n := severity.thresholds.ConstantWindows; n > 0 && group == "" {
+			c := check{checkType: "constant", comparison: ">=", metric: "featurelens_feature_constant_windows"}
+			rules = append(rules, newRule(f, c, c.metric, matcher, "", float64(n), severity.name, 0, window, opts))
+		}
+	}
+	return rules
+}
+
+// newRule returns the rule of one bound.
+func newRule(f config.FeatureConfig, c check, metric, matcher, group string, bound float64, severity string, forWindows int, window time.Duration, opts Options) rule {
+	selector := matcher
+	if c.matchers != "" {
+		selector += ", " + c.matchers
+	}
+	expr := fmt.Sprintf("%s{%s} %s %s", metric, selector, c.comparison, formatFloat(bound))
+	if f.MinCount > 0 && group == "" {
+		count := fmt.Sprintf("featurelens_feature_window_count_total{%s}", matcher)
+		if c.value {
+			count = fmt.Sprintf("(%s - featurelens_feature_window_null_count_total{%s})", count, matcher)
+		}
+		expr = fmt.Sprintf("%s\nand on (feature_name, model_version)\n%s >= %d", expr, count, f.MinCount)
+	}
+
+	labels := map[string]string{
+		"check_type": c.checkType,
+		"comparison": c.comparison,
+		"severity":   severity,
+	}
+	if f.Tenant != "" {
+		labels["tenant"] = f.Tenant
+	}
+	r := rule{
+		Alert:  opts.AlertName,
+		Expr:   expr,
+		Labels: labels,
+		Annotations: map[string]string{
+			"summary": fmt.Sprintf("{{ $labels.feature_name }}: %s {{ $value | printf %q }} %s %s", c.checkType, "%.4g", c.comparison, formatFloat(bound)),
+		},
+	}
+	if group != "" {
+		r.Annotations["summary"] = fmt.Sprintf("{{ $labels.feature_name }} [{{ $labels.group_by }}={{ $labels.group }}]: %s {{ $value | printf %q }} %s %s", c.checkType, "%.4g", c.comparison, formatFloat(bound))
+	}
+	if forWindows > 1 {
+		r.For = duration(time.Duration(forWindows-1) * window)
+	}
+	return r
+}
+
+// boundsOf returns the bounds set on thresholds by key.
+func boundsOf(t config.Thresholds) map[string]float64 {
+	bounds := make(map[string]float64)
+	for key, bound := range map[string]*float64{
+		"nullRateMax":              t.NullRate,
+		"missingRateMax":           t.MissingRate,
+		"typeMismatchRateMax":      t.TypeMismatchRate,
+		"meanMin":                  t.MeanMin,
+		"meanMax":                  t.MeanMax,
+		"stdDevMin":                t.StdDevMin,
+		"stdDevMax":                t.StdDevMax,
+		"zeroRateMax":              t.ZeroRateMax,
+		"outlierRateMax":           t.OutlierRateMax,
+		"distinctMin":              t.DistinctMin,
+		"distinctMax":              t.DistinctMax,
+		"avgLengthMin":             t.AvgLengthMin,
+		"avgLengthMax":             t.AvgLengthMax,
+		"maxLength":                t.MaxLength,
+		"patternMatchRateMin":      t.PatternMatchRateMin,
+		"normMin":                  t.NormMin,
+		"normMax":                  t.NormMax,
+		"dimensionMismatchRateMax": t.DimensionMismatchRateMax,
+		"nonFiniteRateMax":         t.NonFiniteRateMax,
+		"centroidDistanceMax":      t.CentroidDistanceMax,
+		"p50Max":                   t.P50Max,
+		"p95Max":                   t.P95Max,
+		"p99Max":                   t.P99Max,
+		"trueRateMin":              t.TrueRateMin,
+		"trueRateMax":              t.TrueRateMax,
+	} {
+		if bound != nil {
+			bounds[key] = *bound
+		}
+	}
+	return bounds
+}
+
+// featureMatcher returns the label matcher of a feature's series. Pattern features
+// match the fields of their pattern, except the features configured by name.
+func featureMatcher(f config.FeatureConfig, explicit []string) (string, error) {
+	if f.Pattern == "" {
+		return `feature_name="` + quote(f.Name) + `"`, nil
+	}
+	var re string
+	if expr, ok := strings.CutPrefix(f.Pattern, "regex:"); ok {
+		re = ".*(?:" + expr + ").*" // Prometheus anchors label regexes; the pattern is not
+	} else {
+		var err error
+		if re, err = globRegexp(f.Pattern); err != nil {
+			return "", fmt.Errorf("%w: %q: %w", ErrInvalidPattern, f.Pattern, err)
+		}
+	}
+	matcher := `feature_name=~"` + quote(re) + `"`
+	var excluded []string
+	compiled, err := regexp.Compile("^(?:" + re + ")$")
+	if err != nil {
+		return "", fmt.Errorf("%w: %q: %w", ErrInvalidPattern, f.Pattern, err)
+	}
+	for _, name := range explicit {
+		if compiled.MatchString(name) {
+			excluded = append(excluded, regexp.QuoteMeta(name))
+		}
+	}
+	if len(excluded) > 0 {
+		matcher += `, feature_name!~"` + quote(strings.Join(excluded, "|")) + `"`
+	}
+	return matcher, nil
+}
+
+// globRegexp translates a path.Match glob into a regular expression.
+func globRegexp(glob string) (string, error) {
+	if _, err := path.Match(glob, ""); err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			b.WriteString("[^/]*")
+		case '?':
+			b.WriteString("[^/]")
+		case '\\':
+			i++
+			b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']') + i + 1
+			b.WriteString(glob[i : end+1]) // path.Match classes are regular expression classes
+			i = end
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return b.String(), nil
+}
+
+// featureLabel names a feature in comments.
+func featureLabel(f config.FeatureConfig) string {
+	if f.Pattern != "" {
+		return f.Pattern
+	}
+	return f.Name
+}
+
+// quote escapes a label matcher value for a double-quoted PromQL string.
+func quote(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s)
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// duration formats a duration as a Prometheus duration, e.g. "5m" or "1h30m".
+func duration(d time.Duration) string {
+	label := d.String()
+	if strings.HasSuffix(label, "m0s") {
+		label = strings.TrimSuffix(label, "0s")
+	}
+	if strings.HasSuffix(label, "h0m") {
+		label = strings.TrimSuffix(label, "0m")
+	}
+	return label
+}
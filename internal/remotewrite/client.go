@@ -0,0 +1,126 @@
+// Package remotewrite implements a minimal Prometheus remote-write (v1) client.
+package remotewrite
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Label is a series label.
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Sample is a single value at a timestamp.
+type Sample struct {
+	Value     float64
+	Timestamp time.Time
+}
+
+// TimeSeries is a labelled series of samples. Labels must include __name__.
+type TimeSeries struct {
+	Labels  []Label
+	Samples []Sample
+}
+
+// Client sends write requests to a remote-write endpoint.
+type Client struct {
+	url     string
+	headers http.Header
+	http    *http.Client
+}
+
+// NewClient creates a client for the endpoint. headers are added to every request
+// (e.g. Authorization, X-Scope-OrgID).
+func NewClient(url string, timeout time.Duration, headers http.Header) *Client {
+	return &Client{
+		url:     url,
+		headers: headers,
+		http:    &http.Client{Timeout: timeout},
+	}
+}
+
+// Write sends the series in a single request. Errors wrapping ErrRecoverable may be retried.
+func (c *Client) Write(ctx context.Context, series []TimeSeries) error {
+	body := snappy.Encode(nil, marshalWriteRequest(series))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for name, values := range c.headers {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("User-Agent", "featurelens")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrRecoverable, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("%w: status %d: %s", ErrWriteRejected, resp.StatusCode, bytes.TrimSpace(msg))
+	if resp.StatusCode/100 == 5 || resp.StatusCode == http.StatusTooManyRequests {
+		return fmt.Errorf("%w: %w", ErrRecoverable, err)
+	}
+	return err
+}
+
+// marshalWriteRequest encodes prometheus.WriteRequest:
+//
+//	WriteRequest { repeated TimeSeries timeseries = 1; }
+//	TimeSeries   { repeated Label labels = 1; repeated Sample samples = 2; }
+//	Label        { string name = 1; string value = 2; }
+//	Sample       { double value = 1; int64 timestamp = 2; }
+func marshalWriteRequest(series []TimeSeries) []byte {
+	var buf []byte
+	for _, ts := range series {
+		buf = protowire.AppendTag(buf, 1, protowire.BytesType)
+		buf = protowire.AppendBytes(buf, marshalTimeSeries(ts))
+	}
+	return buf
+}
+
+func marshalTimeSeries(ts TimeSeries) []byte {
+	// Receivers require labels sorted by name
+	labels := append([]Label(nil), ts.Labels...)
+	sort.Slice(labels, func(i, j int) bool { return labels[i].Name < labels[j].Name })
+
+	var buf []byte
+	for _, l := range labels {
+		var label []byte
+		label = protowire.AppendTag(label, 1, protowire.BytesType)
+		label = protowire.AppendString(label, l.Name)
+		label = protowire.AppendTag(label, 2, protowire.BytesType)
+		label = protowire.AppendString(label, l.Value)
+		buf = protowire.AppendTag(buf, 1, protowire.BytesType)
+		buf = protowire.AppendBytes(buf, label)
+	}
+	for _, s := range ts.Samples {
+		var sample []byte
+		sample = protowire.AppendTag(sample, 1, protowire.Fixed64Type)
+		sample = protowire.AppendFixed64(sample, math.Float64bits(s.Value))
+		sample = protowire.AppendTag(sample, 2, protowire.VarintType)
+		sample = protowire.AppendVarint(sample, uint64(s.Timestamp.UnixMilli()))
+		buf = protowire.AppendTag(buf, 2, protowire.BytesType)
+		buf = protowire.AppendBytes(buf, sample)
+	}
+	return buf
+}
@@ -0,0 +1,203 @@
+package remotewrite
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// decodedSeries is a time series as read back from a write request, timestamps in
+// milliseconds and values as their bits, so that NaN compares equal.
+type decodedSeries struct {
+	Labels  []Label
+	Samples [][2]uint64 // Value bits and timestamp
+}
+
+// decodeWriteRequest decodes a prometheus.WriteRequest field by field, failing on any
+// field marshalWriteRequest does not write.
+func decodeWriteRequest(t *testing.T, data []byte) []decodedSeries {
+	t.Helper()
+	var series []decodedSeries
+	forEachField(t, data, func(num protowire.Number, typ protowire.Type, value []byte, _ uint64) {
+		if num != 1 || typ != protowire.BytesType {
+			t.Fatalf("WriteRequest: unexpected field %d of type %d", num, typ)
+		}
+		var ts decodedSeries
+		forEachField(t, value, func(num protowire.Number, typ protowire.Type, value []byte, _ uint64) {
+			switch {
+			case num == 1 && typ == protowire.BytesType:
+				var l Label
+				forEachField(t, value, func(num protowire.Number, typ protowire.Type, value []byte, _ uint64) {
+					switch {
+					case num == 1 && typ == protowire.BytesType:
+						l.Name = string(value)
+					case num == 2 && typ == protowire.BytesType:
+						l.Value = string(value)
+					default:
+						t.Fatalf("Label: unexpected field %d of type %d", num, typ)
+					}
+				})
+				ts.Labels = append(ts.Labels, l)
+			case num == 2 && typ == protowire.BytesType:
+				var s [2]uint64
+				forEachField(t, value, func(num protowire.Number, typ protowire.Type, _ []byte, n uint64) {
+					switch {
+					case num == 1 && typ == protowire.Fixed64Type:
+						s[0] = n
+					case num == 2 && typ == protowire.VarintType:
+						s[1] = n
+					default:
+						t.Fatalf("Sample: unexpected field %d of type %d", num, typ)
+					}
+				})
+				ts.Samples = append(ts.Samples, s)
+			default:
+				t.Fatalf("TimeSeries: unexpected field %d of type %d", num, typ)
+			}
+		})
+		series = append(series, ts)
+	})
+	return series
+}
+
+// forEachField calls fn with each field of a message: bytes fields with their contents,
+// varint and fixed64 fields with their value.
+func forEachField(t *testing.T, data []byte, fn func(num protowire.Number, typ protowire.Type, value []byte, n uint64)) {
+	t.Helper()
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			t.Fatalf("bad tag: %v", protowire.ParseError(n))
+		}
+		data = data[n:]
+		var value []byte
+		var v uint64
+		switch typ {
+		case protowire.BytesType:
+			value, n = protowire.ConsumeBytes(data)
+		case protowire.VarintType:
+			v, n = protowire.ConsumeVarint(data)
+		case protowire.Fixed64Type:
+			v, n = protowire.ConsumeFixed64(data)
+		default:
+			t.Fatalf("field %d: unexpected wire type %d", num, typ)
+		}
+		if n < 0 {
+			t.Fatalf("field %d: %v", num, protowire.ParseError(n))
+		}
+		data = data[n:]
+		fn(num, typ, value, v)
+	}
+}
+
+func TestMarshalWriteRequest(t *testing.T) {
+	at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	before1970 := time.UnixMilli(-1500) // Negative int64 varints are two's complement
+	series := []TimeSeries{
+		{
+			Labels: []Label{
+				{Name: "feature_name", Value: "amount"},
+				{Name: "__name__", Value: "featurelens_feature_window_mean"},
+				{Name: "check", Value: "mean"},
+			},
+			Samples: []Sample{
+				{Value: 12.5, Timestamp: at},
+				{Value: math.NaN(), Timestamp: at.Add(time.Minute)}, // Staleness markers are NaN
+			},
+		},
+		{
+			Labels:  []Label{{Name: "__name__", Value: "featurelens_feature_window_count"}, {Name: "empty", Value: ""}},
+			Samples: []Sample{{Value: -3, Timestamp: before1970}},
+		},
+	}
+	want := []decodedSeries{
+		{
+			Labels: []Label{
+				{Name: "__name__", Value: "featurelens_feature_window_mean"},
+				{Name: "check", Value: "mean"},
+				{Name: "feature_name", Value: "amount"},
+			},
+			Samples: [][2]uint64{
+				{math.Float64bits(12.5), uint64(at.UnixMilli())},
+				{math.Float64bits(math.NaN()), uint64(at.Add(time.Minute).UnixMilli())},
+			},
+		},
+		{
+			Labels:  []Label{{Name: "__name__", Value: "featurelens_feature_window_count"}, {Name: "empty", Value: ""}},
+			Samples: [][2]uint64{{math.Float64bits(-3), uint64(before1970.UnixMilli())}},
+		},
+	}
+
+	got := decodeWriteRequest(t, marshalWriteRequest(series))
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if series[0].Labels[0].Name != "feature_name" {
+		t.Error("marshalling sorted the caller's labels")
+	}
+	if got := marshalWriteRequest(nil); len(got) != 0 {
+		t.Errorf("empty request: got %x, want no bytes", got)
+	}
+}
+
+// TestWrite checks that requests carry the write request compressed with the snappy block
+// format, not the framed stream format, along with the remote-write headers.
+func TestWrite(t *testing.T) {
+	series := []TimeSeries{{
+		Labels:  []Label{{Name: "__name__", Value: "featurelens_feature_window_mean"}},
+		Samples: []Sample{{Value: 1, Timestamp: time.UnixMilli(1700000000000)}},
+	}}
+	var body []byte
+	var header http.Header
+	status := http.StatusNoContent
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		header = r.Header
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+	c := NewClient(srv.URL, time.Second, http.Header{"X-Scope-Orgid": {"tenant-a"}})
+
+	if err := c.Write(context.Background(), series); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.HasPrefix(body, []byte("\xff\x06\x00\x00sNaPpY")) {
+		t.Fatal("body uses the snappy stream format, want the block format")
+	}
+	decoded, err := snappy.Decode(nil, body)
+	if err != nil {
+		t.Fatalf("decoding the snappy block: %v", err)
+	}
+	if want := marshalWriteRequest(series); !bytes.Equal(decoded, want) {
+		t.Errorf("got body %x, want %x", decoded, want)
+	}
+	for name, want := range map[string]string{
+		"Content-Encoding":                  "snappy",
+		"Content-Type":                      "application/x-protobuf",
+		"X-Prometheus-Remote-Write-Version": "0.1.0",
+		"X-Scope-Orgid":                     "tenant-a",
+	} {
+		if got := header.Get(name); got != want {
+			t.Errorf("%s: got %q, want %q", name, got, want)
+		}
+	}
+
+	// Server errors and throttling are retried, other rejections are not
+	for code, recoverable := range map[int]bool{http.StatusInternalServerError: true, http.StatusTooManyRequests: true, http.StatusBadRequest: false} {
+		status = code
+		err := c.Write(context.Background(), series)
+		if !errors.Is(err, ErrWriteRejected) || errors.Is(err, ErrRecoverable) != recoverable {
+			t.Errorf("status %d: got %v, want a rejection, recoverable %t", code, err, recoverable)
+		}
+	}
+}
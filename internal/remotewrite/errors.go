@@ -0,0 +1,8 @@
+package remotewrite
+
+import "errors"
+
+var (
+	ErrRecoverable   = errors.New("recoverable remote write error")
+	ErrWriteRejected = errors.New("remote write rejected")
+)
@@ -0,0 +1,10 @@
+package rules
+
+import "errors"
+
+var (
+	ErrReadingRules      = errors.New("failed to read rules file")
+	ErrUnknownFormat     = errors.New("unknown rules format, expected auto, jsonschema or expectations")
+	ErrInvalidJSONSchema = errors.New("invalid JSON Schema")
+	ErrInvalidSuite      = errors.New("invalid Great Expectations suite")
+)
@@ -0,0 +1,156 @@
+package rules
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+
+	"github.com/sanspareilsmyn/featurelens/internal/config"
+)
+
+// suite is a Great Expectations expectation suite in JSON. Suites saved before GX 1.0
+// name the expectation in expectation_type, later ones in type.
+type suite struct {
+	Expectations []struct {
+		ExpectationType string          `json:"expectation_type"`
+		Type            string          `json:"type"`
+		Kwargs          json.RawMessage `json:"kwargs"`
+	} `json:"expectations"`
+}
+
+// expectationKwargs are the arguments of the translated expectations.
+type expectationKwargs struct {
+	Column   string        `json:"column"`
+	Mostly   *float64      `json:"mostly"`
+	MinValue *float64      `json:"min_value"`
+	MaxValue *float64      `json:"max_value"`
+	ValueSet []interface{} `json:"value_set"`
+	Regex    string        `json:"regex"`
+	Type     string        `json:"type_"`
+	TypeList []string      `json:"type_list"`
+}
+
+// share returns the fraction of values an expectation requires, 1 unless mostly is set.
+func (k expectationKwargs) share() float64 {
+	if k.Mostly != nil {
+		return *k.Mostly
+	}
+	return 1
+}
+
+// fromExpectations translates the column expectations of a suite:
+//
+//   - expect_column_to_exist: missingRateMax 0
+//   - expect_column_values_to_not_be_null: nullRateMax 1 - mostly
+//   - expect_column_values_to_be_of_type, _in_type_list: the metric type
+//   - expect_column_values_to_be_between, expect_column_mean_to_be_between:
+//     meanMin/meanMax (exact for the mean, implied for value ranges)
+//   - expect_column_stdev_to_be_between: stdDevMin/stdDevMax
+//   - expect_column_values_to_be_in_set, _to_match_regex: valuePattern with
+//     patternMatchRateMin mostly
+//   - expect_column_value_lengths_to_be_between: avgLengthMin/maxLength
+//
+// Without a type expectation, columns with numeric expectations are numerical and the
+// others categorical. Other expectations are noted as not translated.
+func fromExpectations(raw []byte) ([]*Definition, error) {
+	var s suite
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidSuite, err)
+	}
+
+	var defs []*Definition
+	inferred := make(map[*Definition]string) // Metric type implied by value expectations
+	for i, e := range s.Expectations {
+		name := e.Type
+		if name == "" {
+			name = e.ExpectationType
+		}
+		var k expectationKwargs
+		if len(e.Kwargs) > 0 {
+			if err := json.Unmarshal(e.Kwargs, &k); err != nil {
+				return nil, fmt.Errorf("%w: expectation %d (%s): %w", ErrInvalidSuite, i, name, err)
+			}
+		}
+		if k.Column == "" {
+			continue // Table-level expectations have no feature to attach to
+		}
+		d := definition(&defs, k.Column)
+
+		switch name {
+		case "expect_column_to_exist":
+			d.Thresholds["missingRateMax"] = 0
+		case "expect_column_values_to_not_be_null":
+			d.Thresholds["nullRateMax"] = math.Round((1-k.share())*1e9) / 1e9 // 1 - 0.95 is not 0.05 in floating point
+		case "expect_column_values_to_be_of_type":
+			setType(d, k.Type)
+		case "expect_column_values_to_be_in_type_list":
+			for _, t := range k.TypeList {
+				if setType(d, t) {
+					break
+				}
+			}
+		case "expect_column_values_to_be_between", "expect_column_mean_to_be_between":
+			setBounds(d, "meanMin", "meanMax", k)
+			inferred[d] = config.MetricTypeNumerical
+			if k.Mostly != nil {
+				d.note("%s mostly=%v is checked on the window mean only", name, *k.Mostly)
+			}
+		case "expect_column_stdev_to_be_between":
+			setBounds(d, "stdDevMin", "stdDevMax", k)
+			inferred[d] = config.MetricTypeNumerical
+		case "expect_column_values_to_be_in_set":
+			values := make([]string, 0, len(k.ValueSet))
+			for _, v := range k.ValueSet {
+				values = append(values, fmt.Sprint(v))
+			}
+			d.setPattern(enumPattern(values), k.share())
+			if inferred[d] == "" {
+				inferred[d] = config.MetricTypeCategorical
+			}
+		case "expect_column_values_to_match_regex":
+			d.setPattern(k.Regex, k.share())
+			if inferred[d] == "" {
+				inferred[d] = config.MetricTypeCategorical
+			}
+		case "expect_column_value_lengths_to_be_between":
+			if k.MinValue != nil {
+				d.Thresholds["avgLengthMin"] = *k.MinValue
+			}
+			if k.MaxValue != nil {
+				d.Thresholds["maxLength"] = *k.MaxValue
+			}
+			if inferred[d] == "" {
+				inferred[d] = config.MetricTypeCategorical
+			}
+		default:
+			d.note("%s is not translated", name)
+		}
+	}
+
+	for _, d := range defs {
+		if d.MetricType == "" && d.Skipped == "" {
+			d.MetricType = inferred[d]
+		}
+	}
+	return defs, nil
+}
+
+// setType sets the metric type from a type name, reporting whether it is monitored.
+func setType(d *Definition, name string) bool {
+	mt := metricType(name)
+	if mt == "" {
+		d.Skipped = fmt.Sprintf("type %s is not monitored", name)
+		return false
+	}
+	d.MetricType, d.Skipped = mt, ""
+	return true
+}
+
+func setBounds(d *Definition, minKey, maxKey string, k expectationKwargs) {
+	if k.MinValue != nil {
+		d.Thresholds[minKey] = *k.MinValue
+	}
+	if k.MaxValue != nil {
+		d.Thresholds[maxKey] = *k.MaxValue
+	}
+}
@@ -0,0 +1,148 @@
+package rules
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+
+	"github.com/sanspareilsmyn/featurelens/internal/config"
+)
+
+// jsonSchema is the part of a JSON Schema object describing a message that is translated.
+type jsonSchema struct {
+	Type       typeList               `json:"type"`
+	Properties map[string]*jsonSchema `json:"properties"`
+	Required   []string               `json:"required"`
+
+	Enum             []interface{} `json:"enum"`
+	Minimum          *float64      `json:"minimum"`
+	Maximum          *float64      `json:"maximum"`
+	ExclusiveMinimum *float64      `json:"exclusiveMinimum"`
+	ExclusiveMaximum *float64      `json:"exclusiveMaximum"`
+	MinLength        *float64      `json:"minLength"`
+	MaxLength        *float64      `json:"maxLength"`
+	Pattern          string        `json:"pattern"`
+}
+
+// typeList is a JSON Schema type, either one name or a list of names.
+type typeList []string
+
+func (t *typeList) UnmarshalJSON(data []byte) error {
+	var one string
+	if err := json.Unmarshal(data, &one); err == nil {
+		*t = typeList{one}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return err
+	}
+	*t = many
+	return nil
+}
+
+// fromJSONSchema translates the top-level properties of an object schema:
+//
+//   - type: number and integer become numerical features, string and boolean
+//     categorical ones; properties whose type does not allow null get nullRateMax 0
+//   - required: missingRateMax 0
+//   - minimum/maximum (and their exclusive forms): meanMin/meanMax, which every window
+//     mean of valid values stays within
+//   - enum and pattern: valuePattern with patternMatchRateMin 1
+//   - minLength/maxLength: avgLengthMin/maxLength
+//
+// Nested objects and arrays are skipped.
+func fromJSONSchema(raw []byte) ([]*Definition, error) {
+	var schema jsonSchema
+	if err := json.Unmarshal(raw, &schema); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidJSONSchema, err)
+	}
+	if len(schema.Properties) == 0 {
+		return nil, fmt.Errorf("%w: no top-level properties", ErrInvalidJSONSchema)
+	}
+
+	names := make([]string, 0, len(schema.Properties))
+	for name := range schema.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var defs []*Definition
+	for _, name := range names {
+		prop := schema.Properties[name]
+		d := definition(&defs, name)
+		if prop == nil {
+			d.Skipped = "empty schema"
+			continue
+		}
+		translateProperty(d, prop, slices.Contains(schema.Required, name))
+	}
+	return defs, nil
+}
+
+func translateProperty(d *Definition, prop *jsonSchema, required bool) {
+	nullable := len(prop.Type) == 0 // An untyped property accepts anything
+	for _, t := range prop.Type {
+		if t == "null" {
+			nullable = true
+			continue
+		}
+		switch mt := metricType(t); {
+		case mt != "" && d.MetricType == "":
+			d.MetricType = mt
+		case mt == "":
+			d.Skipped = fmt.Sprintf("type %s is not monitored", t)
+		}
+	}
+	if d.MetricType == "" && len(prop.Enum) > 0 {
+		d.MetricType = config.MetricTypeCategorical
+	}
+	if d.Skipped != "" {
+		return
+	}
+
+	if required {
+		d.Thresholds["missingRateMax"] = 0
+	}
+	if !nullable {
+		d.Thresholds["nullRateMax"] = 0
+	}
+	if v := firstOf(prop.Minimum, prop.ExclusiveMinimum); v != nil {
+		d.Thresholds["meanMin"] = *v
+	}
+	if v := firstOf(prop.Maximum, prop.ExclusiveMaximum); v != nil {
+		d.Thresholds["meanMax"] = *v
+	}
+	if prop.MinLength != nil {
+		d.Thresholds["avgLengthMin"] = *prop.MinLength
+	}
+	if prop.MaxLength != nil {
+		d.Thresholds["maxLength"] = *prop.MaxLength
+	}
+	if len(prop.Enum) > 0 {
+		values := make([]string, 0, len(prop.Enum))
+		for _, v := range prop.Enum {
+			if s, ok := v.(string); ok {
+				values = append(values, s)
+			}
+		}
+		if len(values) == len(prop.Enum) {
+			d.setPattern(enumPattern(values), 1)
+		} else {
+			d.note("enum with non-string values is not checked")
+		}
+	}
+	if prop.Pattern != "" {
+		d.setPattern(prop.Pattern, 1)
+	}
+}
+
+func firstOf(values ...*float64) *float64 {
+	for _, v := range values {
+		if v != nil {
+			return v
+		}
+	}
+	return nil
+}
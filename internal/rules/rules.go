@@ -0,0 +1,146 @@
+// Package rules translates existing data-quality definitions, JSON Schemas and Great
+// Expectations suites, into FeatureLens feature configs, so validation rules written for
+// batch pipelines are reused for stream monitoring.
+package rules
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/sanspareilsmyn/featurelens/internal/config"
+)
+
+// Source formats of rule files.
+const (
+	FormatAuto         = "auto"
+	FormatJSONSchema   = "jsonschema"
+	FormatExpectations = "expectations"
+)
+
+// Definition is a feature translated from the rules of one field.
+type Definition struct {
+	Name         string
+	MetricType   string
+	Thresholds   map[string]float64 // By threshold key, e.g. meanMin
+	ValuePattern string
+	Notes        []string // Rules that were not translated, or only approximately
+	Skipped      string   // Why the field is not monitored, empty if it is
+}
+
+// definition returns the definition of a field, adding it to defs in first-seen order.
+func definition(defs *[]*Definition, name string) *Definition {
+	for _, d := range *defs {
+		if d.Name == name {
+			return d
+		}
+	}
+	d := &Definition{Name: name, Thresholds: make(map[string]float64)}
+	*defs = append(*defs, d)
+	return d
+}
+
+// note records a rule that was not translated exactly.
+func (d *Definition) note(format string, args ...interface{}) {
+	d.Notes = append(d.Notes, fmt.Sprintf(format, args...))
+}
+
+// setPattern sets the value pattern all (or a share of) values must match.
+func (d *Definition) setPattern(pattern string, share float64) {
+	if d.ValuePattern != "" && d.ValuePattern != pattern {
+		d.note("value pattern %q replaced by %q; only one pattern per feature is checked", d.ValuePattern, pattern)
+	}
+	d.ValuePattern = pattern
+	d.Thresholds["patternMatchRateMin"] = share
+}
+
+// enumPattern returns a regular expression matching exactly the given values.
+func enumPattern(values []string) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = regexp.QuoteMeta(v)
+	}
+	sort.Strings(quoted)
+	return "^(?:" + strings.Join(quoted, "|") + ")$"
+}
+
+// Load reads a rule file and translates it into definitions. With FormatAuto the format
+// is detected from the document: a Great Expectations suite has an "expectations" list.
+func Load(path, format string) ([]Definition, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrReadingRules, err)
+	}
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrReadingRules, err)
+	}
+	if format == FormatAuto {
+		format = FormatJSONSchema
+		if _, ok := doc["expectations"]; ok {
+			format = FormatExpectations
+		}
+	}
+
+	var defs []*Definition
+	switch format {
+	case FormatJSONSchema:
+		defs, err = fromJSONSchema(raw)
+	case FormatExpectations:
+		defs, err = fromExpectations(raw)
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownFormat, format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]Definition, 0, len(defs))
+	for _, d := range defs {
+		if d.MetricType == "" && d.Skipped == "" {
+			d.Skipped = "no type could be inferred from its rules"
+		}
+		out = append(out, *d)
+	}
+	return out, nil
+}
+
+// WriteConfig writes the definitions as a `features:` config block, meant to be kept in
+// its own file and included from the main configuration. Skipped fields and rules that
+// were not translated are listed in the header comment.
+func WriteConfig(w io.Writer, defs []Definition, source string) error {
+	file := config.GeneratedFile{Command: "rules import", Source: source}
+	for _, d := range defs {
+		if d.Skipped != "" {
+			file.Comments = append(file.Comments, fmt.Sprintf("skipped %q: %s", d.Name, d.Skipped))
+			continue
+		}
+		for _, n := range d.Notes {
+			file.Comments = append(file.Comments, fmt.Sprintf("%q: %s", d.Name, n))
+		}
+		file.Features = append(file.Features, config.GeneratedFeature{
+			Name:         d.Name,
+			MetricType:   d.MetricType,
+			ValuePattern: d.ValuePattern,
+			Tags:         map[string]string{"source": "rules"},
+			Thresholds:   d.Thresholds,
+		})
+	}
+	return config.WriteGenerated(w, file)
+}
+
+// metricType returns the metric type monitoring a type name of either format, empty for
+// types FeatureLens does not monitor.
+func metricType(name string) string {
+	switch strings.ToLower(name) {
+	case "number", "integer", "int", "int32", "int64", "float", "float32", "float64", "double", "decimal", "long":
+		return config.MetricTypeNumerical
+	case "string", "str", "boolean", "bool", "category":
+		return config.MetricTypeCategorical
+	}
+	return ""
+}
@@ -0,0 +1,35 @@
+package schema
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+)
+
+//go:embed v1/*.json
+var schemaFS embed.FS
+
+// Lookup returns the JSON Schema document for a payload kind at the given major version (e.g. "v1").
+func Lookup(majorVersion, kind string) ([]byte, error) {
+	data, err := schemaFS.ReadFile(path.Join(majorVersion, kind+".schema.json"))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s/%s", ErrUnknownSchema, majorVersion, kind)
+	}
+	return data, nil
+}
+
+// Handler serves the embedded schema documents, e.g. GET <prefix>v1/violation.schema.json.
+func Handler(prefix string) http.Handler {
+	fileServer := http.FileServer(http.FS(schemaFS))
+	return http.StripPrefix(strings.TrimSuffix(prefix, "/"), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := fs.Stat(schemaFS, strings.TrimPrefix(r.URL.Path, "/")); err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/schema+json")
+		fileServer.ServeHTTP(w, r)
+	}))
+}
@@ -0,0 +1,7 @@
+package schema
+
+import "errors"
+
+var (
+	ErrUnknownSchema = errors.New("unknown payload schema")
+)
@@ -0,0 +1,483 @@
+// Package schema defines the versioned public contract for every payload
+// FeatureLens emits outside the process (result topics, webhooks, streams).
+//
+// Compatibility guarantees:
+//   - Minor version bumps (1.0 -> 1.1) only add optional fields or new enum
+//     values. Consumers must ignore fields and values they do not recognise.
+//   - Major version bumps (1.x -> 2.0) may rename, remove or retype fields and
+//     are published side by side under a new directory (e.g. v2/).
+package schema
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	// Version is stamped into the schemaVersion field of every emitted payload.
+	//
+	// History:
+	//   1.0 initial release
+	//   1.1 violation: optional "expression"; comparison may be "expr" for composite conditions
+	//   1.2 aggregation_result: optional "categories"
+	//   1.3 aggregation_result: optional "sampledOut"
+	//   1.4 violation: optional "causedBy"
+	//   1.5 violation: optional "explanation"
+	//   1.6 violation: optional "severity"
+	//   1.7 aggregation_result: optional "sketches"
+	//   1.8 new kind "feature_archived"
+	//   1.9 aggregation_result: optional "missingCount" and "missingRate", the part of
+	//       "nullCount" and "nullRate" due to messages without the feature's key
+	//   1.10 aggregation_result: optional "text"
+	//   1.11 aggregation_result: optional "zeroCount" and "zeroRate"; violation: comparison
+	//        may be ">=" for run-length checks such as "constant"
+	//   1.12 aggregation_result and violation: optional "segment" for per-group results,
+	//        whose featureName is qualified as "<feature>[<groupBy>=<group>]"
+	//   1.13 aggregation_result and violation: optional "modelVersion"; featureName is
+	//        qualified as "<name>@<modelVersion>" when it is set
+	//   1.14 new kind "alert_resolved"; violation: optional "silenced"
+	//   1.15 every kind: optional "eventId"
+	//   1.16 aggregation_result: optional "vector"
+	//   1.17 aggregation_result: optional "typeMismatchCount" and "typeMismatchRate"
+	//   1.18 aggregation_result: optional "percentiles"
+	//   1.19 aggregation_result, violation, alert_resolved: optional "tenant"
+	//   1.20 aggregation_result: optional "revision" for corrected windows and "late" for
+	//        late message buckets
+	//   1.21 aggregation_result: optional "distinctEstimate"
+	//   1.22 aggregation_result: optional "custom"
+	//   1.23 violation: optional "acknowledgement"
+	//   1.24 new kind "internal_error"
+	//   1.25 aggregation_result and violation: optional "samples" of the window's values
+	//   1.26 aggregation_result: optional "outliers"
+	//   1.27 new kind "alert_firing"; alert_resolved: "durationSeconds"
+	//   1.28 new kind "run_report"
+	//   1.29 violation: optional "canary"; run_report: feature "canary" counts
+	//   1.30 violation, alert_firing, alert_resolved: optional feature "metadata"
+	//   1.31 violation: optional "schemaChange", of the new check type "schema_change"
+	//   1.32 aggregation_result and violation: optional "exemplars"
+	//   1.33 aggregation_result: optional "trueCount", "trueRate", "falseCount" and
+	//        "falseRate" of boolean features
+	//   1.34 violation: optional "stale"
+	//   1.35 aggregation_result: "nullCount" and "nullRate" only count explicit null values,
+	//        no longer messages without the feature's key, which "missingCount" counts
+	//   1.36 new document "signed_envelope", sealing results and violations sent to the file
+	//        and kafka sinks, and audit trail lines, when signing is enabled
+	Version = "1.36"
+
+	KindAggregationResult = "aggregation_result"
+	KindViolation         = "violation"
+	KindFeatureArchived   = "feature_archived" // since 1.8
+	KindAlertResolved     = "alert_resolved"   // since 1.14
+	KindInternalError     = "internal_error"   // since 1.24
+	KindAlertFiring       = "alert_firing"     // since 1.27
+	KindRunReport         = "run_report"       // since 1.28
+)
+
+// Run report statuses, each with the exit code of the run.
+const (
+	RunStatusClean      = "clean"      // Exit code 0
+	RunStatusError      = "error"      // Exit code 1
+	RunStatusViolations = "violations" // Exit code 2
+)
+
+// AggregationResult is the public representation of a feature's statistics for one window.
+type AggregationResult struct {
+	SchemaVersion     string           `json:"schemaVersion"`
+	Kind              string           `json:"kind"`
+	EventID           string           `json:"eventId,omitempty"` // since 1.15, see Violation.EventID
+	FeatureName       string           `json:"featureName"`
+	ModelVersion      string           `json:"modelVersion,omitempty"` // since 1.13, with pipeline.versionField
+	Tenant            string           `json:"tenant,omitempty"`       // since 1.19, of tenant features
+	WindowStart       time.Time        `json:"windowStart"`
+	WindowEnd         time.Time        `json:"windowEnd"`
+	Count             int64            `json:"count"`
+	NullCount         int64            `json:"nullCount"`                   // Explicit null values; before 1.35, also messages without the feature's key
+	NullRate          *float64         `json:"nullRate"`                    // null when the window has no messages
+	MissingCount      int64            `json:"missingCount,omitempty"`      // since 1.9, messages without the feature's key
+	MissingRate       *float64         `json:"missingRate,omitempty"`       // since 1.9
+	TypeMismatchCount int64            `json:"typeMismatchCount,omitempty"` // since 1.17, non-null values not of the feature's metric type
+	TypeMismatchRate  *float64         `json:"typeMismatchRate,omitempty"`  // since 1.17
+	ZeroCount         int64            `json:"zeroCount,omitempty"`         // since 1.11, numerical values that are exactly zero
+	ZeroRate          *float64         `json:"zeroRate,omitempty"`          // since 1.11, zeroCount over numerical values
+	TrueCount         int64            `json:"trueCount,omitempty"`         // since 1.33, boolean values that are true
+	TrueRate          *float64         `json:"trueRate,omitempty"`          // since 1.33, trueCount over boolean values
+	FalseCount        int64            `json:"falseCount,omitempty"`        // since 1.33
+	FalseRate         *float64         `json:"falseRate,omitempty"`         // since 1.33, falseCount over boolean values
+	Mean              *float64         `json:"mean"`                        // null when no numeric values were observed
+	Variance          *float64         `json:"variance"`
+	StdDev            *float64         `json:"stdDev"`
+	Categories        map[string]int64 `json:"categories,omitempty"`  // since 1.2, categorical features only
+	SampledOut        int64            `json:"sampledOut,omitempty"`  // since 1.3, messages skipped by sampling
+	Sketches          *Sketches        `json:"sketches,omitempty"`    // since 1.7, when sketch export is enabled
+	Text              *TextStats       `json:"text,omitempty"`        // since 1.10, when string values were observed
+	Vector            *VectorStats     `json:"vector,omitempty"`      // since 1.16, vector features only
+	Percentiles       *Percentiles     `json:"percentiles,omitempty"` // since 1.18, latency features only
+	Outliers          *Outliers        `json:"outliers,omitempty"`    // since 1.26, features with outliers only
+	Segment           *Segment         `json:"segment,omitempty"`     // since 1.12, per-group results only
+	Revision          int              `json:"revision,omitempty"`    // since 1.20, corrections of a window emitted before
+	Late              bool             `json:"late,omitempty"`        // since 1.20, late messages of already flushed windows
+
+	// DistinctEstimate approximates the distinct values of the window with a HyperLogLog,
+	// for features with distinct value thresholds and, with sketch export, categorical
+	// features. Since 1.21.
+	DistinctEstimate *uint64 `json:"distinctEstimate,omitempty"`
+
+	// Custom holds the feature's custom metrics defined for the window, computed by
+	// extensions registered in the binary, by name. Since 1.22.
+	Custom map[string]float64 `json:"custom,omitempty"`
+
+	// Samples is a uniform sample of the window's non-null values, rendered as truncated
+	// strings, with pipeline.valueSamples. Since 1.25.
+	Samples []string `json:"samples,omitempty"`
+
+	// Exemplars are trace IDs of the window's messages, with pipeline.exemplars. Since
+	// 1.32.
+	Exemplars []Exemplar `json:"exemplars,omitempty"`
+}
+
+// Exemplar identifies a message of a window by the trace or correlation ID it carried,
+// so a result or violation can be traced back to the requests behind it. Since 1.32.
+type Exemplar struct {
+	TraceID string   `json:"traceId"`
+	Kind    string   `json:"kind"`            // ExemplarValue, ExemplarNull, ExemplarMin or ExemplarMax
+	Value   *float64 `json:"value,omitempty"` // The feature's value in the message, of min and max exemplars
+}
+
+// Kinds of exemplars.
+const (
+	ExemplarValue = "value" // Sampled among the messages with a value for the feature
+	ExemplarNull  = "null"  // Sampled among the messages with a null or missing value
+	ExemplarMin   = "min"   // The message with the smallest numerical value
+	ExemplarMax   = "max"   // The message with the largest numerical value
+)
+
+// Segment identifies the group of messages a per-group result covers: those whose
+// GroupBy field had the value Group. Group is "__none__" when the field was absent or
+// null and "__other__" for values beyond the feature's group limit.
+type Segment struct {
+	Feature string `json:"feature"`
+	GroupBy string `json:"groupBy"`
+	Group   string `json:"group"`
+}
+
+// TextStats describes the string values of a categorical or text feature in a window.
+// Lengths are in characters (Unicode code points).
+type TextStats struct {
+	Values           int64    `json:"values"`
+	AvgLength        float64  `json:"avgLength"`
+	MaxLength        int64    `json:"maxLength"`
+	PatternMatchRate *float64 `json:"patternMatchRate,omitempty"` // Share of values matching the feature's valuePattern, if set
+}
+
+// Percentiles of a latency feature's values in milliseconds, within 1% relative accuracy.
+type Percentiles struct {
+	P50 float64 `json:"p50"`
+	P95 float64 `json:"p95"`
+	P99 float64 `json:"p99"`
+}
+
+// Outliers counts a feature's numerical values outside the bounds of its outlier rule,
+// within the relative accuracy of a quantile sketch.
+type Outliers struct {
+	Count int64   `json:"count"`
+	Rate  float64 `json:"rate"` // Share of the numerical values
+	Lower float64 `json:"lower"`
+	Upper float64 `json:"upper"`
+}
+
+// VectorStats describes the array values of a vector feature in a window. Well-formed
+// vectors have the expected dimensions and only finite elements; norms are Euclidean.
+type VectorStats struct {
+	Values              int64    `json:"values"`
+	Dimensions          int      `json:"dimensions"` // Expected length of the vectors
+	DimensionMismatches int64    `json:"dimensionMismatches"`
+	NonFiniteRate       *float64 `json:"nonFiniteRate,omitempty"` // Share of elements that are NaN, infinite or null
+	NormMean            *float64 `json:"normMean,omitempty"`      // null without well-formed vectors
+	NormStdDev          *float64 `json:"normStdDev,omitempty"`
+	CentroidDistance    *float64 `json:"centroidDistance,omitempty"` // Mean cosine distance (0..2) to the feature's baseline centroid
+}
+
+// Sketches are mergeable summaries of a window's values. Sketches of the same feature
+// and parameters can be merged offline to answer queries over arbitrary time ranges.
+type Sketches struct {
+	Quantile    *QuantileSketch    `json:"quantile,omitempty"`    // Numerical features
+	Cardinality *CardinalitySketch `json:"cardinality,omitempty"` // Categorical features
+	Frequency   *FrequencySketch   `json:"frequency,omitempty"`   // Categorical features
+}
+
+// QuantileSketch is a DDSketch: values are counted in logarithmic bins so that any
+// quantile is returned within RelativeAccuracy of the true value. Bin i of a store
+// covers magnitudes in (gamma^(i-1), gamma^i] with gamma = (1+a)/(1-a). Merging adds
+// the counts of equal bin indexes.
+type QuantileSketch struct {
+	RelativeAccuracy float64    `json:"relativeAccuracy"`
+	ZeroCount        uint64     `json:"zeroCount"`
+	Positive         SketchBins `json:"positive"`
+	Negative         SketchBins `json:"negative"` // Indexed by magnitude
+	Min              float64    `json:"min"`
+	Max              float64    `json:"max"`
+}
+
+// SketchBins holds contiguous bin counts, Counts[k] being the count of bin Offset+k.
+type SketchBins struct {
+	Offset int      `json:"offset"`
+	Counts []uint64 `json:"counts"`
+}
+
+// CardinalitySketch is a HyperLogLog with 2^Precision registers, each the maximum
+// rank seen among values hashed to it. Merging takes the register-wise maximum.
+type CardinalitySketch struct {
+	Precision int    `json:"precision"`
+	Registers []byte `json:"registers"` // base64 in JSON
+	Estimate  uint64 `json:"estimate"`  // Distinct values in this window alone
+}
+
+// FrequencySketch is a count-min sketch of Depth rows of Width counters, stored row
+// by row. A value's frequency is the minimum of its counters; merging adds counters.
+type FrequencySketch struct {
+	Width    int      `json:"width"`
+	Depth    int      `json:"depth"`
+	Counters []uint64 `json:"counters"`
+	Total    uint64   `json:"total"`
+}
+
+// Violation is the public representation of a single threshold breach.
+type Violation struct {
+	SchemaVersion string `json:"schemaVersion"`
+	Kind          string `json:"kind"`
+	// EventID is the idempotency key of the event (since 1.15): the same event emitted
+	// again, e.g. by a retried delivery, has the same ID, so consumers can deduplicate.
+	EventID      string       `json:"eventId,omitempty"`
+	FeatureName  string       `json:"featureName"`
+	ModelVersion string       `json:"modelVersion,omitempty"` // since 1.13, with pipeline.versionField
+	Tenant       string       `json:"tenant,omitempty"`       // since 1.19, of tenant features
+	CheckType    string       `json:"checkType"`              // e.g. "null_rate", "mean", "stddev", "condition:<name>", "custom:<name>"
+	Comparison   string       `json:"comparison"`             // "<", ">", ">=" or "expr"
+	Actual       float64      `json:"actual"`
+	Threshold    float64      `json:"threshold"`
+	WindowStart  time.Time    `json:"windowStart"`
+	WindowEnd    time.Time    `json:"windowEnd"`
+	DetectedAt   time.Time    `json:"detectedAt"`
+	Expression   string       `json:"expression,omitempty"`  // since 1.1
+	CausedBy     []string     `json:"causedBy,omitempty"`    // since 1.4, upstream features that violated in the same window
+	Explanation  *Explanation `json:"explanation,omitempty"` // since 1.5
+	Severity     string       `json:"severity,omitempty"`    // since 1.6, "info", "warning" or "critical"
+	Segment      *Segment     `json:"segment,omitempty"`     // since 1.12, violations of per-group results
+	Silenced     bool         `json:"silenced,omitempty"`    // since 1.14, reported while a silence matched the feature
+	Canary       bool         `json:"canary,omitempty"`      // since 1.29, of a feature in canary mode, never notified
+	Stale        bool         `json:"stale,omitempty"`       // since 1.34, of a window older than sinks.maxNotifyAge when detected, never notified
+	// Acknowledgement of the firing alert by an operator, since 1.23. Paging integrations
+	// skip acknowledged violations.
+	Acknowledgement *Acknowledgement `json:"acknowledgement,omitempty"`
+	// Samples of the violating window's values, with pipeline.valueSamples inViolations,
+	// since 1.25.
+	Samples []string `json:"samples,omitempty"`
+	// Exemplars are trace IDs of the violating window's messages relevant to the check,
+	// with pipeline.exemplars, since 1.32.
+	Exemplars []Exemplar `json:"exemplars,omitempty"`
+	// Metadata of the feature, since 1.30, when its owner, team, runbook URL or
+	// description is configured.
+	Metadata *FeatureMetadata `json:"metadata,omitempty"`
+	// SchemaChange lists the message fields changed, of schema_change violations, since
+	// 1.31.
+	SchemaChange *SchemaChange `json:"schemaChange,omitempty"`
+}
+
+// SchemaChange is the difference between the message schemas of two windows: fields
+// added, removed and whose value types changed, each list holding at most 50 fields.
+// Since 1.31.
+type SchemaChange struct {
+	Fingerprint         string             `json:"fingerprint"`
+	PreviousFingerprint string             `json:"previousFingerprint"`
+	Added               []SchemaField      `json:"added,omitempty"`
+	Removed             []SchemaField      `json:"removed,omitempty"`
+	TypeChanged         []SchemaTypeChange `json:"typeChanged,omitempty"`
+}
+
+// SchemaField is a message field and its value types: "null", "boolean", "number",
+// "string", "array", "object" or "other".
+type SchemaField struct {
+	Field string   `json:"field"`
+	Types []string `json:"types"`
+}
+
+// SchemaTypeChange is a message field whose value types changed.
+type SchemaTypeChange struct {
+	Field string   `json:"field"`
+	From  []string `json:"from"`
+	To    []string `json:"to"`
+}
+
+// FeatureMetadata is the ownership and context of a feature. Since 1.30.
+type FeatureMetadata struct {
+	Owner       string `json:"owner,omitempty"`
+	Team        string `json:"team,omitempty"`
+	RunbookURL  string `json:"runbookUrl,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// Acknowledgement records that an operator took ownership of a firing alert.
+type Acknowledgement struct {
+	By      string     `json:"by"`
+	Comment string     `json:"comment,omitempty"`
+	At      time.Time  `json:"at"`
+	Until   *time.Time `json:"until,omitempty"` // End of a snooze; absent when it lasts until the alert resolves
+}
+
+// FeatureArchived marks the end of a feature's monitoring: the feature was removed from
+// the configuration, so no further windows will follow LastWindowEnd. Its earlier
+// results remain available.
+type FeatureArchived struct {
+	SchemaVersion string    `json:"schemaVersion"`
+	Kind          string    `json:"kind"`
+	EventID       string    `json:"eventId,omitempty"` // since 1.15, see Violation.EventID
+	FeatureName   string    `json:"featureName"`
+	ArchivedAt    time.Time `json:"archivedAt"`
+	LastWindowEnd time.Time `json:"lastWindowEnd"` // End of the last window monitored
+	Reason        string    `json:"reason"`
+}
+
+// AlertResolved marks the end of a firing alert: a later window of the feature passed
+// every check. An alert is identified by featureName, checkType and comparison, like the
+// violations that raised it.
+type AlertResolved struct {
+	SchemaVersion string    `json:"schemaVersion"`
+	Kind          string    `json:"kind"`
+	EventID       string    `json:"eventId,omitempty"` // since 1.15, see Violation.EventID
+	FeatureName   string    `json:"featureName"`
+	ModelVersion  string    `json:"modelVersion,omitempty"`
+	Tenant        string    `json:"tenant,omitempty"` // since 1.19
+	CheckType     string    `json:"checkType"`
+	Comparison    string    `json:"comparison"`
+	Severity      string    `json:"severity"`    // Severity of the alert's last violation
+	FiringSince   time.Time `json:"firingSince"` // Window end of the alert's first violation
+	WindowEnd     time.Time `json:"windowEnd"`   // End of the healthy window that resolved it
+	ResolvedAt    time.Time `json:"resolvedAt"`
+	// Duration of the incident in seconds, from firingSince to windowEnd. Since 1.27.
+	Duration float64 `json:"durationSeconds"`
+
+	Metadata *FeatureMetadata `json:"metadata,omitempty"` // since 1.30
+}
+
+// AlertFiring marks the start of an alert: a check of a feature violated while no alert
+// of it was firing. Later violations of the check keep the alert firing until an
+// AlertResolved ends it. Since 1.27.
+type AlertFiring struct {
+	SchemaVersion string    `json:"schemaVersion"`
+	Kind          string    `json:"kind"`
+	EventID       string    `json:"eventId"`
+	FeatureName   string    `json:"featureName"`
+	ModelVersion  string    `json:"modelVersion,omitempty"`
+	Tenant        string    `json:"tenant,omitempty"`
+	CheckType     string    `json:"checkType"`
+	Comparison    string    `json:"comparison"`
+	Severity      string    `json:"severity"`
+	Actual        float64   `json:"actual"`
+	Threshold     float64   `json:"threshold"`
+	Silenced      bool      `json:"silenced,omitempty"`
+	FiringSince   time.Time `json:"firingSince"` // Window end of the violation that started it
+	DetectedAt    time.Time `json:"detectedAt"`
+
+	Metadata *FeatureMetadata `json:"metadata,omitempty"` // since 1.30
+}
+
+// InternalError reports an operational failure of FeatureLens itself, such as a sink that
+// is down or a storm of unparseable messages, rather than a data-quality violation of a
+// feature. Repeated failures of one operation are notified at most once per interval,
+// the others counted in Suppressed. Since 1.24.
+type InternalError struct {
+	SchemaVersion string    `json:"schemaVersion"`
+	Kind          string    `json:"kind"`
+	EventID       string    `json:"eventId,omitempty"`
+	Component     string    `json:"component"` // e.g. "sink", "parser" or "consumer"
+	Operation     string    `json:"operation"` // e.g. "deliver:chat" or "parse"
+	Severity      string    `json:"severity"`  // "warning", "error" or "critical"
+	Retryable     bool      `json:"retryable"`
+	Message       string    `json:"message"`
+	Suppressed    int64     `json:"suppressed,omitempty"` // Failures of the operation since the previous notification
+	DetectedAt    time.Time `json:"detectedAt"`
+}
+
+// RunReport summarizes a one-shot run over a bounded input, a batch run up to the end
+// of the topic or a replay, for CI pipelines gating on feature quality. Status and
+// ExitCode are stable: clean runs exit 0, runs raising violations 2, and runs that
+// failed 1, whatever they found before failing. Since 1.28.
+type RunReport struct {
+	SchemaVersion string          `json:"schemaVersion"`
+	Kind          string          `json:"kind"`
+	Mode          string          `json:"mode"`   // "batch" or "replay"
+	Status        string          `json:"status"` // "clean", "violations" or "error"
+	ExitCode      int             `json:"exitCode"`
+	Error         string          `json:"error,omitempty"` // Why a run failed
+	StartedAt     time.Time       `json:"startedAt"`
+	FinishedAt    time.Time       `json:"finishedAt"`
+	Windows       int64           `json:"windows"`
+	Violations    int64           `json:"violations"` // Not counting those of silenced and canary features
+	Features      []FeatureReport `json:"features"`
+	// ViolationDetails lists the violations raised, silenced ones included, in the order
+	// they were detected, up to a limit; ViolationsOmitted counts those past it.
+	ViolationDetails  []Violation `json:"violationDetails"`
+	ViolationsOmitted int64       `json:"violationsOmitted,omitempty"`
+}
+
+// FeatureReport is one feature's statistics over every window of a run, the violations
+// it raised and thresholds proposed from its statistics.
+type FeatureReport struct {
+	FeatureName      string   `json:"featureName"`
+	Windows          int64    `json:"windows"`
+	Count            int64    `json:"count"`
+	NullRate         *float64 `json:"nullRate"` // null without messages
+	MissingRate      *float64 `json:"missingRate"`
+	TypeMismatchRate *float64 `json:"typeMismatchRate"`
+	Mean             *float64 `json:"mean"` // null without numerical values
+	StdDev           *float64 `json:"stdDev"`
+	Violations       int64    `json:"violations"` // Not counting silenced and canary ones
+	Silenced         int64    `json:"silenced"`
+	Canary           int64    `json:"canary,omitempty"` // since 1.29, violations while the feature was in canary mode
+	Checks           []string `json:"checks"`           // The checks violated, sorted
+
+	// ProposedThresholds are loose starting points derived from the run's statistics, as
+	// featurelens discover suggests them; null without messages.
+	ProposedThresholds *ProposedThresholds `json:"proposedThresholds"`
+}
+
+// ProposedThresholds are threshold settings under their configuration keys.
+type ProposedThresholds struct {
+	NullRateMax    float64  `json:"nullRateMax"`
+	MissingRateMax float64  `json:"missingRateMax"`
+	MeanMin        *float64 `json:"meanMin,omitempty"`
+	MeanMax        *float64 `json:"meanMax,omitempty"`
+	StdDevMin      *float64 `json:"stdDevMin,omitempty"`
+	StdDevMax      *float64 `json:"stdDevMax,omitempty"`
+}
+
+// Explanation compares a violating window with the feature's previous healthy window.
+type Explanation struct {
+	BaselineWindowStart time.Time        `json:"baselineWindowStart"`
+	BaselineWindowEnd   time.Time        `json:"baselineWindowEnd"`
+	Deltas              []StatDelta      `json:"deltas"`
+	CategoryChanges     []CategoryChange `json:"categoryChanges,omitempty"`
+}
+
+// StatDelta is the change of one statistic between the baseline and violating windows.
+type StatDelta struct {
+	Stat   string  `json:"stat"`
+	Before float64 `json:"before"`
+	After  float64 `json:"after"`
+	Delta  float64 `json:"delta"`
+}
+
+// CategoryChange is the change of one category's share of values between windows.
+type CategoryChange struct {
+	Value       string  `json:"value"`
+	BeforeShare float64 `json:"beforeShare"`
+	AfterShare  float64 `json:"afterShare"`
+}
+
+// OptionalFloat converts NaN or infinite values to nil so they encode as JSON null.
+func OptionalFloat(v float64) *float64 {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return nil
+	}
+	return &v
+}
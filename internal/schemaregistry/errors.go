@@ -0,0 +1,9 @@
+package schemaregistry
+
+import "errors"
+
+var (
+	ErrNotFramed         = errors.New("payload is not in the schema registry wire format")
+	ErrLookupFailed      = errors.New("failed to look up schema")
+	ErrUnsupportedSchema = errors.New("unsupported schema")
+)
@@ -0,0 +1,335 @@
+// Package schemaregistry decodes payloads in the Confluent Schema Registry wire format: a
+// zero magic byte and the big-endian ID of the payload's schema, looked up in the
+// registry, then for Protobuf the indexes of the payload's message type, then the
+// payload encoded with the schema (Avro, Protobuf or JSON).
+package schemaregistry
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	// Well-known types Protobuf schemas import without declaring references
+	_ "google.golang.org/protobuf/types/known/anypb"
+	_ "google.golang.org/protobuf/types/known/durationpb"
+	_ "google.golang.org/protobuf/types/known/emptypb"
+	_ "google.golang.org/protobuf/types/known/structpb"
+	_ "google.golang.org/protobuf/types/known/timestamppb"
+	_ "google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/sanspareilsmyn/featurelens/internal/message"
+)
+
+// headerSize is the size of the magic byte and schema ID framing payloads.
+const headerSize = 5
+
+// retryInterval is how long a failed lookup is remembered before the schema is looked up
+// again, so a registry outage does not cost a request per message.
+const retryInterval = 30 * time.Second
+
+// maxReferenceDepth bounds the chains of schema references followed.
+const maxReferenceDepth = 32
+
+// Options configure a Client.
+type Options struct {
+	URL      string // e.g. https://schema-registry.example.com:8081
+	Username string // Optional HTTP basic auth
+	Password string
+	Timeout  time.Duration // Per request
+}
+
+// Client decodes framed payloads, looking up and compiling each schema once. It is safe
+// for concurrent use.
+type Client struct {
+	url    *url.URL
+	opts   Options
+	client *http.Client
+
+	mu      sync.Mutex
+	schemas map[uint32]*entry // By schema ID
+}
+
+// entry is the outcome of a schema lookup.
+type entry struct {
+	ready  chan struct{} // Closed once the lookup finished
+	decode decodeFunc
+	err    error
+	at     time.Time
+}
+
+type decodeFunc func(payload []byte) (message.DynamicMessage, error)
+
+// schema is a schema as served by the registry.
+type schema struct {
+	Type       string      `json:"schemaType"` // "AVRO" (when empty), "PROTOBUF" or "JSON"
+	Schema     string      `json:"schema"`
+	References []reference `json:"references"`
+}
+
+// reference is a schema imported by another, by subject and version.
+type reference struct {
+	Name    string `json:"name"` // Avro type name, or Protobuf import path
+	Subject string `json:"subject"`
+	Version int    `json:"version"`
+}
+
+// New returns a client of the registry at opts.URL.
+func New(opts Options) (*Client, error) {
+	u, err := url.Parse(opts.URL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("%w: schema registry URL %q", ErrLookupFailed, opts.URL)
+	}
+	return &Client{
+		url:     u,
+		opts:    opts,
+		client:  &http.Client{Timeout: opts.Timeout},
+		schemas: make(map[uint32]*entry),
+	}, nil
+}
+
+// IsFramed reports whether data starts like a payload in the wire format.
+func IsFramed(data []byte) bool {
+	return len(data) >= headerSize && data[0] == 0
+}
+
+// Decode decodes a payload in the wire format into a DynamicMessage, with the types
+// of the message package's decoders. It returns ErrNotFramed for payloads not in the
+// wire format, and ErrLookupFailed or ErrUnsupportedSchema if their schema cannot be
+// used.
+func (c *Client) Decode(ctx context.Context, data []byte) (message.DynamicMessage, error) {
+	if !IsFramed(data) {
+		return nil, ErrNotFramed
+	}
+	decode, err := c.decoder(ctx, binary.BigEndian.Uint32(data[1:headerSize]))
+	if err != nil {
+		return nil, err
+	}
+	return decode(data[headerSize:])
+}
+
+// decoder returns the decoder of a schema, looking it up unless it already was. Lookups
+// of the same schema are shared; failed ones are retried after retryInterval.
+func (c *Client) decoder(ctx context.Context, id uint32) (decodeFunc, error) {
+	c.mu.Lock()
+	e, ok := c.schemas[id]
+	if !ok || e.failed() && time.Since(e.at) >= retryInterval {
+		e = &entry{ready: make(chan struct{})}
+		c.schemas[id] = e
+		c.mu.Unlock()
+		e.decode, e.err = c.lookup(ctx, id)
+		e.at = time.Now()
+		close(e.ready)
+		return e.decode, e.err
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-e.ready:
+		return e.decode, e.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// failed reports whether the lookup finished with an error.
+func (e *entry) failed() bool {
+	select {
+	case <-e.ready:
+		return e.err != nil
+	default:
+		return false
+	}
+}
+
+// lookup fetches a schema and compiles its decoder.
+func (c *Client) lookup(ctx context.Context, id uint32) (decodeFunc, error) {
+	path := []string{"schemas", "ids", strconv.FormatUint(uint64(id), 10)}
+	s, err := c.fetch(ctx, false, path...)
+	if err != nil {
+		return nil, err
+	}
+	switch s.Type {
+	case "", "AVRO":
+		var named []string
+		if err := c.avroReferences(ctx, s.References, map[string]bool{}, &named, 0); err != nil {
+			return nil, err
+		}
+		avro, err := message.ParseAvroSchema(s.Schema, named...)
+		if err != nil {
+			return nil, fmt.Errorf("%w: schema %d: %w", ErrUnsupportedSchema, id, err)
+		}
+		return avro.Parse, nil
+	case "PROTOBUF":
+		if s, err = c.fetch(ctx, true, path...); err != nil { // As a FileDescriptorProto
+			return nil, err
+		}
+		file, err := c.protoFile(ctx, s, fmt.Sprintf("schema-%d.proto", id), new(protoregistry.Files), 0)
+		if err != nil {
+			return nil, fmt.Errorf("%w: schema %d: %w", ErrUnsupportedSchema, id, err)
+		}
+		return func(payload []byte) (message.DynamicMessage, error) {
+			desc, payload, err := messageType(file, payload)
+			if err != nil {
+				return nil, err
+			}
+			return message.ParseProtobuf(desc, payload)
+		}, nil
+	case "JSON":
+		return message.ParseDynamicJSON, nil
+	default:
+		return nil, fmt.Errorf("%w: schema %d has type %q", ErrUnsupportedSchema, id, s.Type)
+	}
+}
+
+// avroReferences appends the Avro schemas referenced, and the schemas they reference
+// first, to named.
+func (c *Client) avroReferences(ctx context.Context, refs []reference, seen map[string]bool, named *[]string, depth int) error {
+	if depth > maxReferenceDepth {
+		return fmt.Errorf("%w: references nested deeper than %d", ErrUnsupportedSchema, maxReferenceDepth)
+	}
+	for _, ref := range refs {
+		if seen[ref.Name] {
+			continue
+		}
+		seen[ref.Name] = true
+		s, err := c.fetchReference(ctx, ref, false)
+		if err != nil {
+			return err
+		}
+		if err := c.avroReferences(ctx, s.References, seen, named, depth+1); err != nil {
+			return err
+		}
+		*named = append(*named, s.Schema)
+	}
+	return nil
+}
+
+// protoFile builds the file descriptor of a serialized Protobuf schema named name,
+// registering it and the files it imports in files. Imports are the schema's references
+// or, without one, well-known types.
+func (c *Client) protoFile(ctx context.Context, s schema, name string, files *protoregistry.Files, depth int) (protoreflect.FileDescriptor, error) {
+	if depth > maxReferenceDepth {
+		return nil, fmt.Errorf("references nested deeper than %d", maxReferenceDepth)
+	}
+	for _, ref := range s.References {
+		if _, err := files.FindFileByPath(ref.Name); err == nil {
+			continue
+		}
+		dep, err := c.fetchReference(ctx, ref, true)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := c.protoFile(ctx, dep, ref.Name, files, depth+1); err != nil {
+			return nil, err
+		}
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(s.Schema)
+	if err != nil {
+		return nil, err
+	}
+	fdp := &descriptorpb.FileDescriptorProto{}
+	if err := proto.Unmarshal(raw, fdp); err != nil {
+		return nil, err
+	}
+	fdp.Name = proto.String(name) // The import path its dependents know it by
+	for _, imported := range fdp.GetDependency() {
+		if _, err := files.FindFileByPath(imported); err == nil {
+			continue
+		}
+		if wellKnown, err := protoregistry.GlobalFiles.FindFileByPath(imported); err == nil {
+			if err := files.RegisterFile(wellKnown); err != nil {
+				return nil, err
+			}
+		}
+	}
+	file, err := protodesc.NewFile(fdp, files)
+	if err != nil {
+		return nil, err
+	}
+	return file, files.RegisterFile(file)
+}
+
+// messageType returns the message type designated by the message indexes starting a
+// Protobuf payload, and the payload after them: the index of a top-level message of the
+// file, then of a message nested in it, and so on.
+func messageType(file protoreflect.FileDescriptor, payload []byte) (protoreflect.MessageDescriptor, []byte, error) {
+	count, n := binary.Varint(payload)
+	if n <= 0 || count < 0 || count > int64(len(payload)) {
+		return nil, nil, fmt.Errorf("%w: malformed message indexes", ErrNotFramed)
+	}
+	payload = payload[n:]
+	indexes := []int64{0} // An empty list stands for the first message
+	if count > 0 {
+		indexes = make([]int64, count)
+		for i := range indexes {
+			if indexes[i], n = binary.Varint(payload); n <= 0 {
+				return nil, nil, fmt.Errorf("%w: malformed message indexes", ErrNotFramed)
+			}
+			payload = payload[n:]
+		}
+	}
+
+	messages := file.Messages()
+	var desc protoreflect.MessageDescriptor
+	for _, i := range indexes {
+		if i < 0 || i >= int64(messages.Len()) {
+			return nil, nil, fmt.Errorf("%w: no message at index %d of %s", ErrUnsupportedSchema, i, file.Path())
+		}
+		desc = messages.Get(int(i))
+		messages = desc.Messages()
+	}
+	return desc, payload, nil
+}
+
+// fetchReference fetches a referenced schema.
+func (c *Client) fetchReference(ctx context.Context, ref reference, serialized bool) (schema, error) {
+	return c.fetch(ctx, serialized, "subjects", url.PathEscape(ref.Subject), "versions", strconv.Itoa(ref.Version))
+}
+
+// fetch fetches the schema at path, with Protobuf schemas serialized as a
+// FileDescriptorProto rather than in the .proto language if serialized.
+func (c *Client) fetch(ctx context.Context, serialized bool, path ...string) (schema, error) {
+	u := c.url.JoinPath(path...)
+	if serialized {
+		u.RawQuery = url.Values{"format": {"serialized"}}.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return schema{}, fmt.Errorf("%w: %w", ErrLookupFailed, err)
+	}
+	req.Header.Set("Accept", "application/vnd.schemaregistry.v1+json")
+	req.Header.Set("User-Agent", "featurelens")
+	if c.opts.Username != "" {
+		req.SetBasicAuth(c.opts.Username, c.opts.Password)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return schema{}, fmt.Errorf("%w: %w", ErrLookupFailed, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return schema{}, fmt.Errorf("%w: %s: status %d: %s", ErrLookupFailed, u.Path, resp.StatusCode, bytes.TrimSpace(msg))
+	}
+	var s schema
+	if err := json.NewDecoder(resp.Body).Decode(&s); err != nil {
+		return schema{}, fmt.Errorf("%w: %s: %w", ErrLookupFailed, u.Path, err)
+	}
+	return s, nil
+}
@@ -0,0 +1,10 @@
+package secrets
+
+import "errors"
+
+var (
+	ErrInvalidReference      = errors.New("invalid secret reference")
+	ErrProviderNotConfigured = errors.New("secret provider not configured")
+	ErrFetchFailed           = errors.New("failed to fetch secret")
+	ErrKeyNotFound           = errors.New("secret has no such key")
+)
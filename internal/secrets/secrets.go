@@ -0,0 +1,131 @@
+// Package secrets fetches credentials from secret stores, HashiCorp Vault and AWS Secrets
+// Manager, for the configuration values referencing them, e.g.
+// `password: {secret: "vault:kv/featurelens/kafka#password"}`.
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Provider names of references.
+const (
+	ProviderVault = "vault"
+	ProviderAWS   = "aws"
+)
+
+// Provider fetches secrets from a secret store.
+type Provider interface {
+	// Fetch returns the secret at path: a JSON object of its fields, or any string for
+	// stores holding plain values.
+	Fetch(ctx context.Context, path string) (string, error)
+}
+
+// Reference addresses a secret: "<provider>:<path>", optionally followed by "#<key>"
+// selecting a field of a secret holding a JSON object.
+type Reference struct {
+	Provider string
+	Path     string
+	Key      string
+}
+
+// ParseReference parses a reference such as "vault:kv/featurelens/kafka#password" or
+// "aws:prod/featurelens/opsgenie".
+func ParseReference(s string) (Reference, error) {
+	provider, rest, ok := strings.Cut(s, ":")
+	if !ok || provider == "" {
+		return Reference{}, fmt.Errorf("%w: %q, expected <provider>:<path>[#<key>]", ErrInvalidReference, s)
+	}
+	path, key, _ := strings.Cut(rest, "#")
+	if path == "" {
+		return Reference{}, fmt.Errorf("%w: %q has no path", ErrInvalidReference, s)
+	}
+	return Reference{Provider: provider, Path: path, Key: key}, nil
+}
+
+func (r Reference) String() string {
+	s := r.Provider + ":" + r.Path
+	if r.Key != "" {
+		s += "#" + r.Key
+	}
+	return s
+}
+
+// Resolver resolves references with the configured providers, fetching each secret once
+// however many of its keys are referenced. Not safe for concurrent use.
+type Resolver struct {
+	providers map[string]Provider
+	fetched   map[string]string // Provider:path to secret
+}
+
+// NewResolver returns a resolver of the providers, by provider name.
+func NewResolver(providers map[string]Provider) *Resolver {
+	return &Resolver{providers: providers, fetched: make(map[string]string)}
+}
+
+// Resolve returns the value of the secret ref addresses. Without a key, secrets holding a
+// JSON object of a single field resolve to it, other secrets to their whole value.
+func (r *Resolver) Resolve(ctx context.Context, ref string) (string, error) {
+	parsed, err := ParseReference(ref)
+	if err != nil {
+		return "", err
+	}
+	provider, ok := r.providers[parsed.Provider]
+	if !ok {
+		return "", fmt.Errorf("%w: %q", ErrProviderNotConfigured, parsed.Provider)
+	}
+
+	id := parsed.Provider + ":" + parsed.Path
+	secret, ok := r.fetched[id]
+	if !ok {
+		if secret, err = provider.Fetch(ctx, parsed.Path); err != nil {
+			return "", fmt.Errorf("%s: %w", id, err)
+		}
+		r.fetched[id] = secret
+	}
+	value, err := field(secret, parsed.Key)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", id, err)
+	}
+	return value, nil
+}
+
+// field returns the field key of a secret, or the secret itself without a key.
+func field(secret, key string) (string, error) {
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(secret), &fields); err != nil || fields == nil {
+		if key != "" {
+			return "", fmt.Errorf("%w: %q, the secret is not a JSON object", ErrKeyNotFound, key)
+		}
+		return secret, nil
+	}
+	if key == "" {
+		if len(fields) != 1 {
+			keys := make([]string, 0, len(fields))
+			for k := range fields {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			return "", fmt.Errorf("%w: a key is required, one of %s", ErrKeyNotFound, strings.Join(keys, ", "))
+		}
+		for k := range fields {
+			key = k
+		}
+	}
+	switch v := fields[key].(type) {
+	case string:
+		return v, nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case nil:
+		return "", fmt.Errorf("%w: %q", ErrKeyNotFound, key)
+	default:
+		return "", fmt.Errorf("%w: %q is not a string", ErrKeyNotFound, key)
+	}
+}
@@ -0,0 +1,106 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// VaultOptions configure a Vault provider.
+type VaultOptions struct {
+	Address   string // e.g. https://vault.example.com:8200
+	Token     string
+	TokenFile string // Re-read for every fetch, as agents renew tokens in place; takes precedence over Token
+	Namespace string // Vault Enterprise namespace
+	KVVersion int    // Of the KV secrets engine: 1, or 2 (the default)
+	Timeout   time.Duration
+}
+
+// vault reads secrets from the KV secrets engine of HashiCorp Vault. Paths start with the
+// engine's mount, e.g. kv/featurelens/kafka, without the data/ segment of KV version 2.
+type vault struct {
+	address *url.URL
+	opts    VaultOptions
+	client  *http.Client
+}
+
+// NewVault returns a Vault provider.
+func NewVault(opts VaultOptions) (Provider, error) {
+	u, err := url.Parse(opts.Address)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("%w: vault address %q", ErrProviderNotConfigured, opts.Address)
+	}
+	if opts.Token == "" && opts.TokenFile == "" {
+		return nil, fmt.Errorf("%w: vault requires a token or token file", ErrProviderNotConfigured)
+	}
+	if opts.KVVersion == 0 {
+		opts.KVVersion = 2
+	}
+	return &vault{address: u, opts: opts, client: &http.Client{Timeout: opts.Timeout}}, nil
+}
+
+func (v *vault) Fetch(ctx context.Context, path string) (string, error) {
+	path = strings.Trim(path, "/")
+	if v.opts.KVVersion == 2 {
+		mount, rest, ok := strings.Cut(path, "/")
+		if !ok {
+			return "", fmt.Errorf("%w: %q, expected <mount>/<path>", ErrInvalidReference, path)
+		}
+		path = mount + "/data/" + rest
+	}
+	token := v.opts.Token
+	if v.opts.TokenFile != "" {
+		data, err := os.ReadFile(v.opts.TokenFile)
+		if err != nil {
+			return "", fmt.Errorf("%w: %w", ErrFetchFailed, err)
+		}
+		token = strings.TrimSpace(string(data))
+	}
+
+	u := v.address.JoinPath("v1", path)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrFetchFailed, err)
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if v.opts.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.opts.Namespace)
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrFetchFailed, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", fmt.Errorf("%w: vault status %d: %s", ErrFetchFailed, resp.StatusCode, bytes.TrimSpace(msg))
+	}
+
+	var body struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("%w: %w", ErrFetchFailed, err)
+	}
+	data := body.Data
+	if v.opts.KVVersion == 2 {
+		var versioned struct {
+			Data json.RawMessage `json:"data"`
+		}
+		if err := json.Unmarshal(data, &versioned); err != nil {
+			return "", fmt.Errorf("%w: %w", ErrFetchFailed, err)
+		}
+		data = versioned.Data
+	}
+	if len(data) == 0 || string(data) == "null" {
+		return "", fmt.Errorf("%w: vault secret %q has no data", ErrFetchFailed, path)
+	}
+	return string(data), nil
+}
@@ -0,0 +1,39 @@
+package signing
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+
+	"github.com/sanspareilsmyn/featurelens/internal/config"
+)
+
+type ed25519Signer struct {
+	key   ed25519.PrivateKey
+	keyID string
+}
+
+// newEd25519Signer parses a PEM-encoded PKCS#8 private key (as produced by `openssl genpkey -algorithm ed25519`).
+func newEd25519Signer(pemData []byte, keyID string) (*ed25519Signer, error) {
+	block, _ := pem.Decode(pemData)
+	if block == nil {
+		return nil, ErrInvalidPEM
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidPrivateKey, err)
+	}
+	key, ok := parsed.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%w: expected ed25519 key, got %T", ErrInvalidPrivateKey, parsed)
+	}
+	return &ed25519Signer{key: key, keyID: keyID}, nil
+}
+
+func (s *ed25519Signer) Algorithm() string { return config.SigningAlgorithmEd25519 }
+func (s *ed25519Signer) KeyID() string     { return s.keyID }
+
+func (s *ed25519Signer) Sign(payload []byte) ([]byte, error) {
+	return ed25519.Sign(s.key, payload), nil
+}
@@ -0,0 +1,12 @@
+package signing
+
+import "errors"
+
+var (
+	ErrReadingKeyFile       = errors.New("failed to read signing key file")
+	ErrUnsupportedAlgorithm = errors.New("unsupported signing algorithm")
+	ErrKeyTooShort          = errors.New("hmac signing key must be at least 32 bytes")
+	ErrInvalidPEM           = errors.New("signing key file does not contain a PEM block")
+	ErrInvalidPrivateKey    = errors.New("invalid signing private key")
+	ErrMarshallingPayload   = errors.New("failed to marshal payload for signing")
+)
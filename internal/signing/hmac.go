@@ -0,0 +1,34 @@
+package signing
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+
+	"github.com/sanspareilsmyn/featurelens/internal/config"
+)
+
+// minHMACKeyLength follows the RFC 2104 recommendation of at least the hash output size.
+const minHMACKeyLength = sha256.Size
+
+type hmacSigner struct {
+	key   []byte
+	keyID string
+}
+
+func newHMACSigner(key []byte, keyID string) (*hmacSigner, error) {
+	key = bytes.TrimSpace(key)
+	if len(key) < minHMACKeyLength {
+		return nil, ErrKeyTooShort
+	}
+	return &hmacSigner{key: key, keyID: keyID}, nil
+}
+
+func (s *hmacSigner) Algorithm() string { return config.SigningAlgorithmHMACSHA256 }
+func (s *hmacSigner) KeyID() string     { return s.keyID }
+
+func (s *hmacSigner) Sign(payload []byte) ([]byte, error) {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write(payload)
+	return mac.Sum(nil), nil
+}
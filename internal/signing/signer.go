@@ -0,0 +1,70 @@
+// Package signing produces tamper-evident signatures over emitted payloads
+// so downstream compliance systems can verify records were not modified.
+package signing
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/sanspareilsmyn/featurelens/internal/config"
+)
+
+// Signer signs arbitrary payload bytes.
+type Signer interface {
+	Algorithm() string
+	KeyID() string
+	Sign(payload []byte) ([]byte, error)
+}
+
+// Signature is the detached signature attached to a signed payload.
+type Signature struct {
+	Algorithm string `json:"algorithm"`
+	KeyID     string `json:"keyID,omitempty"`
+	Value     string `json:"value"` // base64 (standard encoding) of the raw signature bytes
+}
+
+// Envelope wraps the exact payload bytes that were signed together with their signature.
+// Verifiers must check the signature against Payload as-is, without re-encoding it.
+type Envelope struct {
+	Payload   json.RawMessage `json:"payload"`
+	Signature Signature       `json:"signature"`
+}
+
+// NewSigner creates a Signer from configuration, loading key material from cfg.KeyFile.
+func NewSigner(cfg config.SigningConfig) (Signer, error) {
+	key, err := os.ReadFile(cfg.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrReadingKeyFile, err)
+	}
+
+	switch cfg.Algorithm {
+	case config.SigningAlgorithmHMACSHA256:
+		return newHMACSigner(key, cfg.KeyID)
+	case config.SigningAlgorithmEd25519:
+		return newEd25519Signer(key, cfg.KeyID)
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedAlgorithm, cfg.Algorithm)
+	}
+}
+
+// Seal marshals v to JSON, signs the resulting bytes, and returns the envelope.
+func Seal(s Signer, v any) (Envelope, error) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return Envelope{}, fmt.Errorf("%w: %w", ErrMarshallingPayload, err)
+	}
+	sig, err := s.Sign(payload)
+	if err != nil {
+		return Envelope{}, err
+	}
+	return Envelope{
+		Payload: payload,
+		Signature: Signature{
+			Algorithm: s.Algorithm(),
+			KeyID:     s.KeyID(),
+			Value:     base64.StdEncoding.EncodeToString(sig),
+		},
+	}, nil
+}
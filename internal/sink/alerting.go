@@ -0,0 +1,185 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sanspareilsmyn/featurelens/internal/params"
+	"github.com/sanspareilsmyn/featurelens/internal/schema"
+)
+
+// alertSource identifies FeatureLens to incident management tools.
+const alertSource = "featurelens"
+
+// pages reports whether a violation should raise an incident. Silenced violations, those
+// of acknowledged alerts and those grouped under an upstream feature's alert are logged
+// by the alerter but not paged.
+func pages(v schema.Violation) bool {
+	return !v.Silenced && v.Acknowledgement == nil && len(v.CausedBy) == 0
+}
+
+// alertID identifies a firing alert across its violations and its resolution, so
+// incident tools deduplicate repeated windows and close the incident on recovery.
+func alertID(featureName, checkType, comparison string) string {
+	return alertSource + ":" + featureName + ":" + checkType + ":" + comparison
+}
+
+// alertSummary is a one-line description of a violation, e.g. "feature_a: mean 15.2 > 13".
+func alertSummary(v schema.Violation) string {
+	if v.Comparison == "expr" {
+		return fmt.Sprintf("%s: %s held (%s)", v.FeatureName, v.CheckType, v.Expression)
+	}
+	return fmt.Sprintf("%s: %s %.4g %s %.4g", v.FeatureName, v.CheckType, v.Actual, v.Comparison, v.Threshold)
+}
+
+// violationDescription is a multi-line description of a violation for incident bodies.
+func violationDescription(v schema.Violation) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Feature: %s\nCheck: %s (%s)\n", v.FeatureName, v.CheckType, v.Comparison)
+	if v.Comparison == "expr" {
+		fmt.Fprintf(&b, "Condition: %s\n", v.Expression)
+	} else {
+		fmt.Fprintf(&b, "Actual: %g\nThreshold: %g\n", v.Actual, v.Threshold)
+	}
+	fmt.Fprintf(&b, "Window: %s to %s\n", v.WindowStart.Format(time.RFC3339), v.WindowEnd.Format(time.RFC3339))
+	if v.ModelVersion != "" {
+		fmt.Fprintf(&b, "Model version: %s\n", v.ModelVersion)
+	}
+	if v.Explanation != nil {
+		for _, d := range v.Explanation.Deltas {
+			fmt.Fprintf(&b, "%s: %g -> %g\n", d.Stat, d.Before, d.After)
+		}
+	}
+	for _, f := range append(schemaChangeFacts(v.SchemaChange), metadataFacts(v.Metadata)...) {
+		fmt.Fprintf(&b, "%s: %s\n", f.Name, f.Value)
+	}
+	return b.String()
+}
+
+// violationDetails returns a violation's fields as string key/values for incident tools.
+func violationDetails(v schema.Violation) map[string]string {
+	details := map[string]string{
+		"feature_name": v.FeatureName,
+		"check_type":   v.CheckType,
+		"comparison":   v.Comparison,
+		"actual":       strconv.FormatFloat(v.Actual, 'g', -1, 64),
+		"threshold":    strconv.FormatFloat(v.Threshold, 'g', -1, 64),
+		"severity":     v.Severity,
+		"window_start": v.WindowStart.Format(time.RFC3339),
+		"window_end":   v.WindowEnd.Format(time.RFC3339),
+	}
+	if v.ModelVersion != "" {
+		details["model_version"] = v.ModelVersion
+	}
+	if v.Expression != "" {
+		details["expression"] = v.Expression
+	}
+	if m := v.Metadata; m != nil {
+		for key, value := range map[string]string{"owner": m.Owner, "team": m.Team, "runbook_url": m.RunbookURL} {
+			if value != "" {
+				details[key] = value
+			}
+		}
+	}
+	return details
+}
+
+// severityMap returns a map parameter keyed by violation severity ("critical", "warning",
+// "info"), with defaults for the severities it does not set.
+func severityMap(p params.Params, key string, defaults map[string]string) (map[string]string, error) {
+	overrides, err := p.StringMap(key)
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string]string, len(defaults))
+	for severity, value := range defaults {
+		m[severity] = value
+	}
+	for severity, value := range overrides {
+		severity = strings.ToLower(severity)
+		if _, ok := defaults[severity]; !ok {
+			return nil, fmt.Errorf("%w: %s: unknown severity %q", ErrInvalidParams, key, severity)
+		}
+		m[severity] = value
+	}
+	return m, nil
+}
+
+// readSecret reads a credential from the file named by the key parameter, or from the
+// parameter named without its File suffix (e.g. apiKey for apiKeyFile), typically
+// fetched from a secret store with a {secret: ref} config reference. Keeping
+// credentials out of the configuration lets it be committed and shared.
+func readSecret(p params.Params, key string) (string, error) {
+	inline := strings.TrimSuffix(key, "File")
+	if secret, err := p.String(inline, ""); err != nil || secret != "" {
+		return secret, err
+	}
+	path, err := p.String(key, "")
+	if err != nil {
+		return "", err
+	}
+	if path == "" {
+		return "", fmt.Errorf("%w: %s or %s cannot be empty", ErrInvalidParams, key, inline)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s: %w", ErrInvalidParams, key, err)
+	}
+	secret := strings.TrimSpace(string(data))
+	if secret == "" {
+		return "", fmt.Errorf("%w: %s %q is empty", ErrInvalidParams, key, path)
+	}
+	return secret, nil
+}
+
+// hasSecret reports whether an optional credential read by readSecret is set.
+func hasSecret(p params.Params, key string) (bool, error) {
+	for _, k := range []string{key, strings.TrimSuffix(key, "File")} {
+		if value, err := p.String(k, ""); err != nil || value != "" {
+			return value != "", err
+		}
+	}
+	return false, nil
+}
+
+// postJSON sends body as JSON and fails on any non-2xx response.
+func postJSON(ctx context.Context, client *http.Client, url string, header http.Header, body interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrSendFailed, err)
+	}
+	return postBody(ctx, client, url, header, data)
+}
+
+// postBody sends a JSON body, e.g. an event's Message, and fails on any non-2xx response.
+func postBody(ctx context.Context, client *http.Client, url string, header http.Header, data []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrSendFailed, err)
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", alertSource)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrSendFailed, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("%w: status %d: %s", ErrSendFailed, resp.StatusCode, bytes.TrimSpace(msg))
+}
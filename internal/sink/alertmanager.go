@@ -0,0 +1,219 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/sanspareilsmyn/featurelens/internal/params"
+	"github.com/sanspareilsmyn/featurelens/internal/schema"
+)
+
+const (
+	defaultAlertName      = "FeatureLensViolation"
+	defaultResolveTimeout = 15 * time.Minute
+)
+
+// alertmanagerSink pushes violations as alerts to Prometheus Alertmanager's v2 API, so
+// its routing, silencing and inhibition apply to FeatureLens alerts. A firing alert is
+// re-sent with every violating window and ends after resolveTimeout without one, or as
+// soon as it resolves.
+type alertmanagerSink struct {
+	urls           []string
+	header         http.Header
+	alertName      string
+	labels         map[string]string
+	generatorURL   string // May contain dashboardFeaturePlaceholder
+	resolveTimeout time.Duration
+	client         *http.Client
+}
+
+// newAlertmanager creates an Alertmanager sink.
+//
+// Params: urls (Alertmanager base URLs; every instance of an HA cluster should be listed),
+// alertName (default FeatureLensViolation), labels (added to every alert), generatorURL
+// (linked from alerts; "{feature}" is replaced with the feature name), resolveTimeout
+// (how long an alert fires after its last violation, default 15m; should exceed the
+// window size), bearerTokenFile (optional).
+func newAlertmanager(params params.Params, logger *zap.Logger) (Sink, error) {
+	bases, err := params.Strings("urls")
+	if err != nil {
+		return nil, err
+	}
+	if len(bases) == 0 {
+		return nil, fmt.Errorf("%w: urls cannot be empty", ErrInvalidParams)
+	}
+	urls := make([]string, len(bases))
+	for i, base := range bases {
+		if u, err := url.Parse(base); err != nil || u.Host == "" {
+			return nil, fmt.Errorf("%w: urls: %q is not an absolute URL", ErrInvalidParams, base)
+		}
+		urls[i] = strings.TrimSuffix(base, "/") + "/api/v2/alerts"
+	}
+	alertName, err := params.String("alertName", defaultAlertName)
+	if err != nil {
+		return nil, err
+	}
+	labels, err := params.StringMap("labels")
+	if err != nil {
+		return nil, err
+	}
+	generatorURL, err := params.String("generatorURL", "")
+	if err != nil {
+		return nil, err
+	}
+	resolveTimeout, err := params.Duration("resolveTimeout", defaultResolveTimeout)
+	if err != nil {
+		return nil, err
+	}
+	if resolveTimeout <= 0 {
+		return nil, fmt.Errorf("%w: resolveTimeout must be positive", ErrInvalidParams)
+	}
+	header := http.Header{}
+	if ok, err := hasSecret(params, "bearerTokenFile"); err != nil {
+		return nil, err
+	} else if ok {
+		token, err := readSecret(params, "bearerTokenFile")
+		if err != nil {
+			return nil, err
+		}
+		header.Set("Authorization", "Bearer "+token)
+	}
+
+	logger.Info("Alertmanager sink configured", zap.Strings("urls", bases), zap.Duration("resolve_timeout", resolveTimeout))
+	return &alertmanagerSink{
+		urls:           urls,
+		header:         header,
+		alertName:      alertName,
+		labels:         labels,
+		generatorURL:   generatorURL,
+		resolveTimeout: resolveTimeout,
+		client:         &http.Client{},
+	}, nil
+}
+
+// alertmanagerAlert is an alert of Alertmanager's v2 API. Alerts with identical labels
+// are the same alert.
+type alertmanagerAlert struct {
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+	StartsAt     time.Time         `json:"startsAt"`
+	EndsAt       time.Time         `json:"endsAt"`
+	GeneratorURL string            `json:"generatorURL,omitempty"`
+}
+
+func (s *alertmanagerSink) Send(ctx context.Context, events []Event) error {
+	alerts := make([]alertmanagerAlert, 0, len(events))
+	for _, e := range events {
+		switch p := e.Payload.(type) {
+		case schema.Violation:
+			// Grouped violations are sent too: inhibition rules take over grouping.
+			if !p.Silenced {
+				alerts = append(alerts, s.firing(p))
+			}
+		case schema.AlertResolved:
+			alerts = append(alerts, s.resolved(p))
+		}
+	}
+	if len(alerts) == 0 {
+		return nil
+	}
+	// Every instance of an HA cluster must receive the alerts; they deduplicate notifications.
+	var errs []error
+	for _, u := range s.urls {
+		errs = append(errs, postJSON(ctx, s.client, u, s.header, alerts))
+	}
+	return errors.Join(errs...)
+}
+
+func (s *alertmanagerSink) firing(v schema.Violation) alertmanagerAlert {
+	annotations := map[string]string{
+		"summary":     alertSummary(v),
+		"description": violationDescription(v),
+		"actual":      strconv.FormatFloat(v.Actual, 'g', -1, 64),
+		"threshold":   strconv.FormatFloat(v.Threshold, 'g', -1, 64),
+		"window_end":  v.WindowEnd.UTC().Format(time.RFC3339),
+	}
+	if v.Expression != "" {
+		annotations["expression"] = v.Expression
+	}
+	if len(v.CausedBy) > 0 {
+		annotations["caused_by"] = strings.Join(v.CausedBy, ",")
+	}
+	if ack := v.Acknowledgement; ack != nil {
+		annotations["acknowledged_by"] = ack.By
+		if ack.Comment != "" {
+			annotations["acknowledgement_comment"] = ack.Comment
+		}
+	}
+	if m := v.Metadata; m != nil {
+		for key, value := range map[string]string{"runbook_url": m.RunbookURL, "owner": m.Owner, "feature_description": m.Description} {
+			if value != "" {
+				annotations[key] = value
+			}
+		}
+	}
+	return alertmanagerAlert{
+		Labels:       s.alertLabels(v.FeatureName, v.ModelVersion, v.Tenant, v.CheckType, v.Comparison, v.Severity, v.Metadata),
+		Annotations:  annotations,
+		StartsAt:     v.WindowEnd,
+		EndsAt:       time.Now().Add(s.resolveTimeout),
+		GeneratorURL: featureLink(s.generatorURL, v.FeatureName),
+	}
+}
+
+func (s *alertmanagerSink) resolved(r schema.AlertResolved) alertmanagerAlert {
+	return alertmanagerAlert{
+		Labels:       s.alertLabels(r.FeatureName, r.ModelVersion, r.Tenant, r.CheckType, r.Comparison, r.Severity, r.Metadata),
+		StartsAt:     r.FiringSince,
+		EndsAt:       r.ResolvedAt,
+		GeneratorURL: featureLink(s.generatorURL, r.FeatureName),
+	}
+}
+
+// alertLabels identifies an alert. Violations and the resolution of the same alert must
+// produce identical labels. The tenant and team labels let Alertmanager route each
+// tenant's or team's alerts to its receiver.
+func (s *alertmanagerSink) alertLabels(featureName, modelVersion, tenant, checkType, comparison, severity string, metadata *schema.FeatureMetadata) map[string]string {
+	labels := make(map[string]string, len(s.labels)+8)
+	for name, value := range s.labels {
+		labels[name] = value
+	}
+	labels["alertname"] = s.alertName
+	labels["feature_name"] = featureName
+	labels["check_type"] = checkType
+	labels["comparison"] = comparison
+	labels["severity"] = severity
+	if modelVersion != "" {
+		labels["model_version"] = modelVersion
+	}
+	if tenant != "" {
+		labels["tenant"] = tenant
+	}
+	if metadata != nil && metadata.Team != "" {
+		labels["team"] = metadata.Team
+	}
+	return labels
+}
+
+func (s *alertmanagerSink) Probe(ctx context.Context) error {
+	var errs []error
+	for _, u := range s.urls {
+		if err := dialURL(ctx, u); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (s *alertmanagerSink) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
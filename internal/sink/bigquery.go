@@ -0,0 +1,368 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/sanspareilsmyn/featurelens/internal/params"
+	"github.com/sanspareilsmyn/featurelens/internal/schema"
+)
+
+const (
+	bigQueryEndpoint             = "https://bigquery.googleapis.com"
+	bigQueryScope                = "https://www.googleapis.com/auth/bigquery"
+	defaultBigQueryTable         = "featurelens_results"
+	defaultBigQueryPartitioning  = "DAY"
+	defaultBigQueryFlushInterval = 30 * time.Second
+	defaultBigQueryMaxRows       = 500
+	// bigQueryInsertRows is the most rows sent per insertAll request, as BigQuery
+	// recommends.
+	bigQueryInsertRows = 500
+	// bigQueryCloseTimeout bounds the insert of the rows still buffered on shutdown.
+	bigQueryCloseTimeout = 30 * time.Second
+)
+
+// bigQueryPartitionings are the time partitioning types of the results table, by window
+// end; "NONE" leaves it unpartitioned.
+var bigQueryPartitionings = map[string]bool{"HOUR": true, "DAY": true, "MONTH": true, "YEAR": true, "NONE": true}
+
+// bigQueryField is a column of the results table.
+type bigQueryField struct {
+	Name   string          `json:"name"`
+	Type   string          `json:"type"`
+	Mode   string          `json:"mode,omitempty"`
+	Fields []bigQueryField `json:"fields,omitempty"`
+}
+
+// bigQueryResultFields is the schema of the results table, the columns of resultRow.
+// Categories are a repeated key/value record, BigQuery having no map type.
+var bigQueryResultFields = func() []bigQueryField {
+	fields := []bigQueryField{
+		{Name: "event_id", Type: "STRING", Mode: "REQUIRED"},
+		{Name: "feature_name", Type: "STRING", Mode: "REQUIRED"},
+		{Name: "model_version", Type: "STRING"},
+		{Name: "tenant", Type: "STRING"},
+		{Name: "segment_group_by", Type: "STRING"},
+		{Name: "segment_group", Type: "STRING"},
+		{Name: "window_start", Type: "TIMESTAMP", Mode: "REQUIRED"},
+		{Name: "window_end", Type: "TIMESTAMP", Mode: "REQUIRED"},
+	}
+	for _, name := range []string{"count", "null_count", "missing_count", "type_mismatch_count", "zero_count", "sampled_out"} {
+		fields = append(fields, bigQueryField{Name: name, Type: "INTEGER", Mode: "REQUIRED"})
+	}
+	for _, name := range []string{"null_rate", "missing_rate", "type_mismatch_rate", "zero_rate", "mean", "variance", "std_dev",
+		"avg_length", "pattern_match_rate", "norm_mean", "non_finite_rate", "centroid_distance", "p50", "p95", "p99"} {
+		fields = append(fields, bigQueryField{Name: name, Type: "FLOAT"})
+	}
+	return append(fields,
+		bigQueryField{Name: "max_length", Type: "INTEGER"},
+		bigQueryField{Name: "categories", Type: "RECORD", Mode: "REPEATED", Fields: []bigQueryField{
+			{Name: "key", Type: "STRING"},
+			{Name: "value", Type: "INTEGER"},
+		}},
+	)
+}()
+
+// bigQueryRow is a window result as an insertAll row.
+type bigQueryRow struct {
+	resultRow
+	Categories []bigQueryCategory `json:"categories"` // Replaces resultRow's map
+}
+
+type bigQueryCategory struct {
+	Key   string `json:"key"`
+	Value int64  `json:"value"`
+}
+
+// bigQuerySink buffers window results and streams them into a BigQuery table with the
+// tabledata.insertAll API, so feature health history can be joined with training
+// datasets. Rows carry their event ID as insertId, so BigQuery drops the duplicates of a
+// retried request.
+type bigQuerySink struct {
+	endpoint            string
+	project             string
+	dataset             string
+	table               string
+	partitioning        string
+	partitionExpiration time.Duration
+	flushInterval       time.Duration
+	maxRows             int
+	tokens              *googleTokenSource
+	client              *http.Client
+	logger              *zap.Logger
+
+	created    bool // The table was created, or need not be
+	pending    []bigQueryRow
+	pendingIDs map[string]bool // Of pending rows, so retried batches are not buffered twice...
+	sent       *sentSet        // ...nor rows already inserted
+	since      time.Time       // When the oldest pending row was buffered
+}
+
+// newBigQuery creates a BigQuery sink. It only writes aggregation_result events.
+//
+// Params: project (default: the service account's project), dataset (required), table
+// (default featurelens_results), credentialsFile (service account JSON key; default
+// GOOGLE_APPLICATION_CREDENTIALS, then the GCE metadata server), createTable (create
+// the table if missing before the first insert, default true), partitioning (HOUR,
+// DAY, MONTH, YEAR or NONE, on window_end, default DAY), partitionExpiration (default
+// none), flushInterval (max time rows are buffered, default 30s; checked as results
+// arrive), maxRows (rows buffered before an early flush, default 500), endpoint.
+func newBigQuery(params params.Params, logger *zap.Logger) (Sink, error) {
+	s := &bigQuerySink{
+		client:     &http.Client{Timeout: 30 * time.Second},
+		pendingIDs: make(map[string]bool),
+		sent:       newSentSet(),
+		logger:     logger,
+	}
+	var err error
+	if s.tokens, err = newGoogleTokenSource(params, bigQueryScope, s.client); err != nil {
+		return nil, err
+	}
+	if s.project, err = params.String("project", s.tokens.projectID()); err != nil {
+		return nil, err
+	}
+	if s.dataset, err = params.String("dataset", ""); err != nil {
+		return nil, err
+	}
+	if s.table, err = params.String("table", defaultBigQueryTable); err != nil {
+		return nil, err
+	}
+	if s.project == "" || s.dataset == "" || s.table == "" {
+		return nil, fmt.Errorf("%w: project, dataset and table cannot be empty", ErrInvalidParams)
+	}
+	if s.endpoint, err = params.String("endpoint", bigQueryEndpoint); err != nil {
+		return nil, err
+	}
+	s.endpoint = strings.TrimSuffix(s.endpoint, "/")
+	createTable, err := params.Bool("createTable", true)
+	if err != nil {
+		return nil, err
+	}
+	s.created = !createTable
+	if s.partitioning, err = params.String("partitioning", defaultBigQueryPartitioning); err != nil {
+		return nil, err
+	}
+	s.partitioning = strings.ToUpper(s.partitioning)
+	if !bigQueryPartitionings[s.partitioning] {
+		return nil, fmt.Errorf("%w: partitioning must be HOUR, DAY, MONTH, YEAR or NONE, got %q", ErrInvalidParams, s.partitioning)
+	}
+	if s.partitionExpiration, err = params.Duration("partitionExpiration", 0); err != nil {
+		return nil, err
+	}
+	if s.flushInterval, err = params.Duration("flushInterval", defaultBigQueryFlushInterval); err != nil {
+		return nil, err
+	}
+	if s.maxRows, err = params.Int("maxRows", defaultBigQueryMaxRows); err != nil {
+		return nil, err
+	}
+	if s.flushInterval <= 0 || s.maxRows <= 0 || s.partitionExpiration < 0 {
+		return nil, fmt.Errorf("%w: flushInterval and maxRows must be positive and partitionExpiration cannot be negative", ErrInvalidParams)
+	}
+
+	logger.Info("BigQuery sink configured",
+		zap.String("table", s.project+"."+s.dataset+"."+s.table),
+		zap.String("partitioning", s.partitioning),
+		zap.Bool("service_account", s.tokens.account != nil),
+		zap.Duration("flush_interval", s.flushInterval),
+		zap.Int("max_rows", s.maxRows),
+	)
+	return s, nil
+}
+
+func (s *bigQuerySink) Send(ctx context.Context, events []Event) error {
+	for _, e := range events {
+		result, ok := e.Payload.(schema.AggregationResult)
+		if !ok || s.pendingIDs[e.ID] || s.sent.has(e.ID) {
+			continue
+		}
+		if len(s.pending) == 0 {
+			s.since = time.Now()
+		}
+		s.pending = append(s.pending, newBigQueryRow(result))
+		s.pendingIDs[e.ID] = true
+	}
+	if len(s.pending) == 0 || (len(s.pending) < s.maxRows && time.Since(s.since) < s.flushInterval) {
+		return nil
+	}
+
+	err := s.flush(ctx)
+	if err != nil && len(s.pending) >= s.maxRows {
+		s.logger.Error("BigQuery inserts keep failing, dropping buffered rows", zap.Int("rows", len(s.pending)), zap.Error(err))
+		s.pending = nil
+		s.pendingIDs = make(map[string]bool)
+	}
+	return err
+}
+
+// flush inserts the pending rows, bigQueryInsertRows per request. Rows of requests that
+// fail stay pending and are retried with the next batch.
+func (s *bigQuerySink) flush(ctx context.Context) error {
+	if !s.created {
+		if err := s.createTable(ctx); err != nil {
+			return err
+		}
+	}
+	var failed []bigQueryRow
+	var errs []error
+	for start := 0; start < len(s.pending); start += bigQueryInsertRows {
+		rows := s.pending[start:min(start+bigQueryInsertRows, len(s.pending))]
+		if err := s.insertAll(ctx, rows); err != nil {
+			failed = append(failed, rows...)
+			errs = append(errs, err)
+			continue
+		}
+		for _, row := range rows {
+			delete(s.pendingIDs, row.EventID)
+			s.sent.add(row.EventID)
+		}
+	}
+	s.pending = failed
+	return errors.Join(errs...)
+}
+
+// insertAll streams rows into the table. The request fails as a whole if any row is
+// invalid, so rows are never half inserted.
+func (s *bigQuerySink) insertAll(ctx context.Context, rows []bigQueryRow) error {
+	type insertRow struct {
+		InsertID string      `json:"insertId"`
+		JSON     bigQueryRow `json:"json"`
+	}
+	body := struct {
+		Rows []insertRow `json:"rows"`
+	}{Rows: make([]insertRow, len(rows))}
+	for i, row := range rows {
+		body.Rows[i] = insertRow{InsertID: row.EventID, JSON: row}
+	}
+	var resp struct {
+		InsertErrors []struct {
+			Index  int `json:"index"`
+			Errors []struct {
+				Reason  string `json:"reason"`
+				Message string `json:"message"`
+			} `json:"errors"`
+		} `json:"insertErrors"`
+	}
+	if err := s.call(ctx, s.tablePath()+"/insertAll", body, &resp); err != nil {
+		return err
+	}
+	for _, rowErr := range resp.InsertErrors {
+		for _, e := range rowErr.Errors {
+			if e.Reason != "stopped" { // Valid rows not inserted because of another row
+				return fmt.Errorf("%w: row %d: %s: %s", ErrSendFailed, rowErr.Index, e.Reason, e.Message)
+			}
+		}
+	}
+	if len(resp.InsertErrors) > 0 {
+		return fmt.Errorf("%w: %d rows rejected", ErrSendFailed, len(resp.InsertErrors))
+	}
+	return nil
+}
+
+// createTable creates the results table, partitioned by window end and clustered by
+// feature, unless it exists.
+func (s *bigQuerySink) createTable(ctx context.Context) error {
+	table := map[string]interface{}{
+		"tableReference": map[string]string{"projectId": s.project, "datasetId": s.dataset, "tableId": s.table},
+		"schema":         map[string]interface{}{"fields": bigQueryResultFields},
+		"clustering":     map[string]interface{}{"fields": []string{"feature_name"}},
+	}
+	if s.partitioning != "NONE" {
+		partitioning := map[string]interface{}{"type": s.partitioning, "field": "window_end"}
+		if s.partitionExpiration > 0 {
+			partitioning["expirationMs"] = fmt.Sprint(s.partitionExpiration.Milliseconds())
+		}
+		table["timePartitioning"] = partitioning
+	}
+	err := s.call(ctx, s.datasetPath()+"/tables", table, nil)
+	if err != nil && !errors.Is(err, errBigQueryConflict) {
+		return err
+	}
+	s.created = true
+	s.logger.Info("BigQuery table ready", zap.String("table", s.table), zap.Bool("created", err == nil))
+	return nil
+}
+
+// errBigQueryConflict is returned by call when the resource to create already exists.
+var errBigQueryConflict = fmt.Errorf("%w: already exists", ErrSendFailed)
+
+// call POSTs body as JSON to a BigQuery API path and decodes the response into out, if
+// not nil.
+func (s *bigQuerySink) call(ctx context.Context, path string, body, out interface{}) error {
+	token, err := s.tokens.Token(ctx)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrSendFailed, err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint+path, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrSendFailed, err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", alertSource)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrSendFailed, err)
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusConflict:
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return errBigQueryConflict
+	case resp.StatusCode/100 != 2:
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%w: status %d: %s", ErrSendFailed, resp.StatusCode, bytes.TrimSpace(msg))
+	case out == nil:
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("%w: %w", ErrSendFailed, err)
+	}
+	return nil
+}
+
+func (s *bigQuerySink) datasetPath() string {
+	return "/bigquery/v2/projects/" + url.PathEscape(s.project) + "/datasets/" + url.PathEscape(s.dataset)
+}
+
+func (s *bigQuerySink) tablePath() string {
+	return s.datasetPath() + "/tables/" + url.PathEscape(s.table)
+}
+
+// Probe checks the API endpoint accepts connections; credentials are only checked on
+// insert.
+func (s *bigQuerySink) Probe(ctx context.Context) error {
+	return dialURL(ctx, s.endpoint)
+}
+
+func (s *bigQuerySink) Close() error {
+	if len(s.pending) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), bigQueryCloseTimeout)
+	defer cancel()
+	return s.flush(ctx)
+}
+
+func newBigQueryRow(r schema.AggregationResult) bigQueryRow {
+	row := bigQueryRow{resultRow: newResultRow(r), Categories: make([]bigQueryCategory, 0, len(r.Categories))}
+	for key, value := range r.Categories {
+		row.Categories = append(row.Categories, bigQueryCategory{Key: key, Value: value})
+	}
+	return row
+}
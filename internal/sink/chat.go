@@ -0,0 +1,212 @@
+package sink
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sanspareilsmyn/featurelens/internal/params"
+	"github.com/sanspareilsmyn/featurelens/internal/schema"
+)
+
+// dashboardFeaturePlaceholder is replaced with the (URL-escaped) feature name in
+// dashboard links of chat notifications.
+const dashboardFeaturePlaceholder = "{feature}"
+
+// maxChatTraceIDs bounds the exemplar trace IDs listed in chat messages, most relevant first.
+const maxChatTraceIDs = 3
+
+// fact is a labelled value shown in a chat notification.
+type fact struct {
+	Name  string
+	Value string
+}
+
+// chatOptions are the parameters shared by chat webhook sinks.
+type chatOptions struct {
+	webhookURL     string
+	dashboardURL   string // May contain dashboardFeaturePlaceholder
+	notifyResolved bool
+}
+
+// chatParams reads the parameters shared by chat webhook sinks: webhookURLFile (file
+// holding the webhook URL, which embeds its credentials), dashboardURL (linked from each
+// notification; "{feature}" is replaced with the feature name) and notifyResolved (post
+// when an alert resolves, default true).
+func chatParams(p params.Params) (chatOptions, error) {
+	webhookURL, err := readSecret(p, "webhookURLFile")
+	if err != nil {
+		return chatOptions{}, err
+	}
+	if u, err := url.Parse(webhookURL); err != nil || (u.Scheme != "https" && u.Scheme != "http") {
+		return chatOptions{}, fmt.Errorf("%w: webhookURLFile must hold an http(s) URL", ErrInvalidParams)
+	}
+	dashboardURL, err := p.String("dashboardURL", "")
+	if err != nil {
+		return chatOptions{}, err
+	}
+	notifyResolved, err := p.Bool("notifyResolved", true)
+	if err != nil {
+		return chatOptions{}, err
+	}
+	return chatOptions{webhookURL: webhookURL, dashboardURL: dashboardURL, notifyResolved: notifyResolved}, nil
+}
+
+// posts reports whether a chat sink notifies of an event: violations that page, resolved
+// alerts unless notifyResolved is off, and internal errors.
+func (o chatOptions) posts(e Event) bool {
+	switch p := e.Payload.(type) {
+	case schema.Violation:
+		return pages(p)
+	case schema.AlertResolved:
+		return o.notifyResolved
+	case schema.InternalError:
+		return true
+	}
+	return false
+}
+
+// dashboardLink returns the dashboard URL for a feature, or "" if none is configured.
+func (o chatOptions) dashboardLink(featureName string) string {
+	return featureLink(o.dashboardURL, featureName)
+}
+
+// featureLink expands the feature placeholder of a link template.
+func featureLink(template, featureName string) string {
+	return strings.ReplaceAll(template, dashboardFeaturePlaceholder, url.QueryEscape(featureName))
+}
+
+// violationFacts lists what a chat notification shows of a violation.
+func violationFacts(v schema.Violation) []fact {
+	facts := []fact{
+		{"Feature", v.FeatureName},
+		{"Check", v.CheckType},
+	}
+	if v.Comparison == "expr" {
+		facts = append(facts, fact{"Condition", v.Expression})
+	} else {
+		facts = append(facts,
+			fact{"Actual", strconv.FormatFloat(v.Actual, 'g', 6, 64)},
+			fact{"Threshold", v.Comparison + " " + strconv.FormatFloat(v.Threshold, 'g', 6, 64)},
+		)
+	}
+	facts = append(facts,
+		fact{"Window", v.WindowStart.UTC().Format(time.RFC3339) + " to " + v.WindowEnd.UTC().Format(time.RFC3339)},
+		fact{"Severity", v.Severity},
+	)
+	if v.ModelVersion != "" {
+		facts = append(facts, fact{"Model version", v.ModelVersion})
+	}
+	if len(v.Samples) > 0 {
+		facts = append(facts, fact{"Sample values", strings.Join(v.Samples, ", ")})
+	}
+	if len(v.Exemplars) > 0 {
+		ids := make([]string, 0, maxChatTraceIDs)
+		for _, e := range v.Exemplars[:min(len(v.Exemplars), maxChatTraceIDs)] {
+			ids = append(ids, e.TraceID)
+		}
+		facts = append(facts, fact{"Trace IDs", strings.Join(ids, ", ")})
+	}
+	facts = append(facts, schemaChangeFacts(v.SchemaChange)...)
+	return append(facts, metadataFacts(v.Metadata)...)
+}
+
+// schemaChangeFacts lists the message fields a schema change added, removed and retyped.
+func schemaChangeFacts(c *schema.SchemaChange) []fact {
+	if c == nil {
+		return nil
+	}
+	var facts []fact
+	for _, list := range []struct {
+		name   string
+		fields []schema.SchemaField
+	}{{"Fields added", c.Added}, {"Fields removed", c.Removed}} {
+		if len(list.fields) == 0 {
+			continue
+		}
+		names := make([]string, len(list.fields))
+		for i, f := range list.fields {
+			names[i] = f.Field + " (" + strings.Join(f.Types, "|") + ")"
+		}
+		facts = append(facts, fact{list.name, strings.Join(names, ", ")})
+	}
+	if len(c.TypeChanged) > 0 {
+		changes := make([]string, len(c.TypeChanged))
+		for i, f := range c.TypeChanged {
+			changes[i] = f.Field + ": " + strings.Join(f.From, "|") + " -> " + strings.Join(f.To, "|")
+		}
+		facts = append(facts, fact{"Types changed", strings.Join(changes, ", ")})
+	}
+	return facts
+}
+
+// metadataFacts lists the ownership of a feature, so the people responsible are named in
+// its notifications.
+func metadataFacts(m *schema.FeatureMetadata) []fact {
+	if m == nil {
+		return nil
+	}
+	var facts []fact
+	for _, f := range []fact{{"Owner", m.Owner}, {"Team", m.Team}, {"Runbook", m.RunbookURL}, {"Description", m.Description}} {
+		if f.Value != "" {
+			facts = append(facts, f)
+		}
+	}
+	return facts
+}
+
+// resolvedFacts lists what a chat notification shows of a resolved alert.
+func resolvedFacts(r schema.AlertResolved) []fact {
+	facts := []fact{
+		{"Feature", r.FeatureName},
+		{"Check", r.CheckType},
+		{"Firing since", r.FiringSince.UTC().Format(time.RFC3339)},
+		{"Healthy window end", r.WindowEnd.UTC().Format(time.RFC3339)},
+		{"Duration", incidentDuration(r).String()},
+	}
+	if r.ModelVersion != "" {
+		facts = append(facts, fact{"Model version", r.ModelVersion})
+	}
+	return append(facts, metadataFacts(r.Metadata)...)
+}
+
+// resolvedSummary is a one-line description of a resolved alert.
+func resolvedSummary(r schema.AlertResolved) string {
+	return fmt.Sprintf("%s: %s resolved after %s", r.FeatureName, r.CheckType, incidentDuration(r))
+}
+
+// incidentDuration returns how long a resolved alert fired, to the second.
+func incidentDuration(r schema.AlertResolved) time.Duration {
+	return time.Duration(r.Duration * float64(time.Second)).Round(time.Second)
+}
+
+// internalErrorFacts lists what a chat notification shows of an internal error.
+func internalErrorFacts(e schema.InternalError) []fact {
+	facts := []fact{
+		{"Component", e.Component},
+		{"Operation", e.Operation},
+		{"Error", e.Message},
+		{"Severity", e.Severity},
+		{"Retryable", strconv.FormatBool(e.Retryable)},
+		{"Detected at", e.DetectedAt.UTC().Format(time.RFC3339)},
+	}
+	if e.Suppressed > 0 {
+		facts = append(facts, fact{"Suppressed since last notification", strconv.FormatInt(e.Suppressed, 10)})
+	}
+	return facts
+}
+
+// internalErrorSummary is a one-line description of an internal error.
+func internalErrorSummary(e schema.InternalError) string {
+	return fmt.Sprintf("FeatureLens %s failure: %s", e.Component, e.Operation)
+}
+
+// internalErrorColor is the alert severity whose color an internal error is shown with.
+func internalErrorColor(e schema.InternalError) string {
+	if e.Severity == "warning" {
+		return "warning"
+	}
+	return "critical"
+}
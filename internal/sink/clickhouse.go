@@ -0,0 +1,379 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/sanspareilsmyn/featurelens/internal/params"
+	"github.com/sanspareilsmyn/featurelens/internal/schema"
+)
+
+const (
+	defaultClickHouseURL             = "http://localhost:8123"
+	defaultClickHouseDatabase        = "default"
+	defaultClickHouseUser            = "default"
+	defaultClickHouseResultsTable    = "featurelens_results"
+	defaultClickHouseViolationsTable = "featurelens_violations"
+	defaultClickHouseTimeout         = 30 * time.Second
+)
+
+// clickHouseIdentifier matches the database and table names the sink accepts, so they
+// can be spliced into queries.
+var clickHouseIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Table definitions, created when createTables is set. ReplacingMergeTree ordered by
+// event ID collapses the rows a retried insert wrote twice when parts merge; queries
+// needing exact counts before then can use FINAL.
+const (
+	clickHouseResultsDDL = `CREATE TABLE IF NOT EXISTS %s (
+	event_id String,
+	feature_name LowCardinality(String),
+	model_version LowCardinality(String),
+	tenant LowCardinality(String),
+	segment_group_by LowCardinality(String),
+	segment_group String,
+	window_start DateTime64(3, 'UTC'),
+	window_end DateTime64(3, 'UTC'),
+	count Int64,
+	null_count Int64,
+	null_rate Nullable(Float64),
+	missing_count Int64,
+	missing_rate Nullable(Float64),
+	type_mismatch_count Int64,
+	type_mismatch_rate Nullable(Float64),
+	zero_count Int64,
+	zero_rate Nullable(Float64),
+	mean Nullable(Float64),
+	variance Nullable(Float64),
+	std_dev Nullable(Float64),
+	sampled_out Int64,
+	avg_length Nullable(Float64),
+	max_length Nullable(Int64),
+	pattern_match_rate Nullable(Float64),
+	norm_mean Nullable(Float64),
+	non_finite_rate Nullable(Float64),
+	centroid_distance Nullable(Float64),
+	p50 Nullable(Float64),
+	p95 Nullable(Float64),
+	p99 Nullable(Float64),
+	categories Map(String, Int64),
+	inserted_at DateTime64(3, 'UTC') DEFAULT now64(3)
+) ENGINE = ReplacingMergeTree
+PARTITION BY toYYYYMM(window_end)
+ORDER BY (feature_name, window_end, event_id)`
+
+	clickHouseViolationsDDL = `CREATE TABLE IF NOT EXISTS %s (
+	event_id String,
+	feature_name LowCardinality(String),
+	model_version LowCardinality(String),
+	tenant LowCardinality(String),
+	segment_group_by LowCardinality(String),
+	segment_group String,
+	check_type LowCardinality(String),
+	comparison LowCardinality(String),
+	actual Float64,
+	threshold Float64,
+	expression String,
+	severity LowCardinality(String),
+	silenced Bool,
+	caused_by Array(String),
+	window_start DateTime64(3, 'UTC'),
+	window_end DateTime64(3, 'UTC'),
+	detected_at DateTime64(3, 'UTC'),
+	inserted_at DateTime64(3, 'UTC') DEFAULT now64(3)
+) ENGINE = ReplacingMergeTree
+PARTITION BY toYYYYMM(window_end)
+ORDER BY (feature_name, window_end, event_id)`
+)
+
+// clickHouseViolationRow is the JSONEachRow layout of a violation.
+type clickHouseViolationRow struct {
+	EventID        string    `json:"event_id"`
+	FeatureName    string    `json:"feature_name"`
+	ModelVersion   string    `json:"model_version"`
+	Tenant         string    `json:"tenant"`
+	SegmentGroupBy string    `json:"segment_group_by"`
+	SegmentGroup   string    `json:"segment_group"`
+	CheckType      string    `json:"check_type"`
+	Comparison     string    `json:"comparison"`
+	Actual         float64   `json:"actual"`
+	Threshold      float64   `json:"threshold"`
+	Expression     string    `json:"expression"`
+	Severity       string    `json:"severity"`
+	Silenced       bool      `json:"silenced"`
+	CausedBy       []string  `json:"caused_by"`
+	WindowStart    time.Time `json:"window_start"`
+	WindowEnd      time.Time `json:"window_end"`
+	DetectedAt     time.Time `json:"detected_at"`
+}
+
+// clickHouseSink inserts window results and violations into ClickHouse tables through
+// its HTTP interface, one INSERT per table and batch. With asyncInsert, the server
+// buffers small inserts into larger parts, so frequent batches from several replicas do
+// not create a part each.
+type clickHouseSink struct {
+	endpoint        *url.URL
+	database        string
+	username        string
+	password        string
+	resultsTable    string
+	violationsTable string
+	asyncInsert     bool
+	client          *http.Client
+	logger          *zap.Logger
+
+	created bool     // Tables were created, or need not be
+	sent    *sentSet // Rows inserted, skipped when a partly failed batch is retried
+}
+
+// newClickHouse creates a ClickHouse sink. It only writes aggregation_result and
+// violation events.
+//
+// Params: url (HTTP interface, default http://localhost:8123), database (default
+// "default"), username (default "default"), passwordFile (optional), resultsTable
+// (default featurelens_results), violationsTable (default featurelens_violations),
+// createTables (create missing tables before the first insert, default true),
+// asyncInsert (default true), timeout (per request, default 30s).
+func newClickHouse(params params.Params, logger *zap.Logger) (Sink, error) {
+	raw, err := params.String("url", defaultClickHouseURL)
+	if err != nil {
+		return nil, err
+	}
+	s := &clickHouseSink{logger: logger, sent: newSentSet()}
+	if s.endpoint, err = url.Parse(raw); err != nil || s.endpoint.Host == "" || (s.endpoint.Scheme != "http" && s.endpoint.Scheme != "https") {
+		return nil, fmt.Errorf("%w: url: %q is not an http(s) URL", ErrInvalidParams, raw)
+	}
+	if s.database, err = params.String("database", defaultClickHouseDatabase); err != nil {
+		return nil, err
+	}
+	if s.username, err = params.String("username", defaultClickHouseUser); err != nil {
+		return nil, err
+	}
+	if ok, err := hasSecret(params, "passwordFile"); err != nil {
+		return nil, err
+	} else if ok {
+		if s.password, err = readSecret(params, "passwordFile"); err != nil {
+			return nil, err
+		}
+	}
+	if s.resultsTable, err = params.String("resultsTable", defaultClickHouseResultsTable); err != nil {
+		return nil, err
+	}
+	if s.violationsTable, err = params.String("violationsTable", defaultClickHouseViolationsTable); err != nil {
+		return nil, err
+	}
+	for _, name := range []string{s.database, s.resultsTable, s.violationsTable} {
+		if !clickHouseIdentifier.MatchString(name) {
+			return nil, fmt.Errorf("%w: %q is not a valid database or table name", ErrInvalidParams, name)
+		}
+	}
+	createTables, err := params.Bool("createTables", true)
+	if err != nil {
+		return nil, err
+	}
+	s.created = !createTables
+	if s.asyncInsert, err = params.Bool("asyncInsert", true); err != nil {
+		return nil, err
+	}
+	timeout, err := params.Duration("timeout", defaultClickHouseTimeout)
+	if err != nil {
+		return nil, err
+	}
+	if timeout <= 0 {
+		return nil, fmt.Errorf("%w: timeout must be positive", ErrInvalidParams)
+	}
+	s.client = &http.Client{Timeout: timeout}
+
+	logger.Info("ClickHouse sink configured",
+		zap.String("url", s.endpoint.Redacted()),
+		zap.String("database", s.database),
+		zap.String("results_table", s.resultsTable),
+		zap.String("violations_table", s.violationsTable),
+		zap.Bool("async_insert", s.asyncInsert),
+	)
+	return s, nil
+}
+
+func (s *clickHouseSink) Send(ctx context.Context, events []Event) error {
+	var results, violations bytes.Buffer
+	var resultIDs, violationIDs []string
+	for _, e := range events {
+		if s.sent.has(e.ID) {
+			continue
+		}
+		var row interface{}
+		var buf *bytes.Buffer
+		switch p := e.Payload.(type) {
+		case schema.AggregationResult:
+			row, buf = newResultRow(p), &results
+			resultIDs = append(resultIDs, e.ID)
+		case schema.Violation:
+			row, buf = newClickHouseViolationRow(p), &violations
+			violationIDs = append(violationIDs, e.ID)
+		default:
+			continue
+		}
+		data, err := json.Marshal(row)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrSendFailed, err)
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+	if results.Len() == 0 && violations.Len() == 0 {
+		return nil
+	}
+
+	if !s.created {
+		if err := s.ensureTables(ctx); err != nil {
+			return err
+		}
+	}
+	if err := s.insert(ctx, s.resultsTable, results.Bytes(), resultIDs); err != nil {
+		return err
+	}
+	return s.insert(ctx, s.violationsTable, violations.Bytes(), violationIDs)
+}
+
+// insert writes JSONEachRow rows to a table and remembers their event IDs once inserted.
+func (s *clickHouseSink) insert(ctx context.Context, table string, rows []byte, ids []string) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	settings := url.Values{
+		"date_time_input_format":       {"best_effort"}, // RFC 3339 timestamps
+		"input_format_null_as_default": {"1"},
+	}
+	if s.asyncInsert {
+		// Wait for the buffer to be flushed, so failures surface and the batch is retried
+		settings.Set("async_insert", "1")
+		settings.Set("wait_for_async_insert", "1")
+	}
+	if err := s.exec(ctx, "INSERT INTO "+s.table(table)+" FORMAT JSONEachRow", rows, settings); err != nil {
+		return err
+	}
+	for _, id := range ids {
+		s.sent.add(id)
+	}
+	return nil
+}
+
+// ensureTables creates the results and violations tables if they do not exist.
+func (s *clickHouseSink) ensureTables(ctx context.Context) error {
+	for _, ddl := range []string{
+		fmt.Sprintf(clickHouseResultsDDL, s.table(s.resultsTable)),
+		fmt.Sprintf(clickHouseViolationsDDL, s.table(s.violationsTable)),
+	} {
+		if err := s.exec(ctx, ddl, nil, nil); err != nil {
+			return err
+		}
+	}
+	s.created = true
+	s.logger.Info("ClickHouse tables ready", zap.String("results_table", s.resultsTable), zap.String("violations_table", s.violationsTable))
+	return nil
+}
+
+// table returns the quoted, database-qualified name of a table.
+func (s *clickHouseSink) table(name string) string {
+	return "`" + s.database + "`.`" + name + "`"
+}
+
+// exec runs a query, with body as its input data if not nil, and fails on any non-2xx
+// response, whose body holds ClickHouse's error message.
+func (s *clickHouseSink) exec(ctx context.Context, query string, body []byte, settings url.Values) error {
+	u := *s.endpoint
+	values := url.Values{"database": {s.database}}
+	for name, v := range settings {
+		values[name] = v
+	}
+	var reader io.Reader = strings.NewReader(query)
+	if body != nil {
+		values.Set("query", query)
+		reader = bytes.NewReader(body)
+	}
+	u.RawQuery = values.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), reader)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrSendFailed, err)
+	}
+	req.Header.Set("User-Agent", alertSource)
+	req.Header.Set("X-ClickHouse-User", s.username)
+	if s.password != "" {
+		req.Header.Set("X-ClickHouse-Key", s.password)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrSendFailed, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("%w: status %d: %s", ErrSendFailed, resp.StatusCode, bytes.TrimSpace(msg))
+}
+
+// Probe checks the server answers its /ping endpoint; credentials are only checked on
+// insert.
+func (s *clickHouseSink) Probe(ctx context.Context) error {
+	u := *s.endpoint
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/ping"
+	u.RawQuery = ""
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrProbeFailed, err)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrProbeFailed, err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%w: status %d", ErrProbeFailed, resp.StatusCode)
+	}
+	return nil
+}
+
+func (s *clickHouseSink) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
+
+func newClickHouseViolationRow(v schema.Violation) clickHouseViolationRow {
+	row := clickHouseViolationRow{
+		EventID:      v.EventID,
+		FeatureName:  v.FeatureName,
+		ModelVersion: v.ModelVersion,
+		Tenant:       v.Tenant,
+		CheckType:    v.CheckType,
+		Comparison:   v.Comparison,
+		Actual:       v.Actual,
+		Threshold:    v.Threshold,
+		Expression:   v.Expression,
+		Severity:     v.Severity,
+		Silenced:     v.Silenced,
+		CausedBy:     v.CausedBy,
+		WindowStart:  v.WindowStart,
+		WindowEnd:    v.WindowEnd,
+		DetectedAt:   v.DetectedAt,
+	}
+	if v.Segment != nil {
+		row.SegmentGroupBy = v.Segment.GroupBy
+		row.SegmentGroup = v.Segment.Group
+	}
+	return row
+}
@@ -0,0 +1,138 @@
+package sink
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/sanspareilsmyn/featurelens/internal/params"
+	"github.com/sanspareilsmyn/featurelens/internal/schema"
+)
+
+// discordMaxEmbeds is the number of embeds Discord accepts in one webhook message.
+const discordMaxEmbeds = 10
+
+// Discord embed colors (RGB) by violation severity, and for resolved alerts.
+var discordColors = map[string]int{
+	"critical": 0xE01E5A,
+	"warning":  0xECB22E,
+	"info":     0x36C5F0,
+	"resolved": 0x2EB67D,
+}
+
+// discordSink posts violations, resolved alerts and internal errors to a Discord webhook
+// as embeds, batched up to discordMaxEmbeds per message. Events rendered with the sink's
+// template are posted as messages of their own.
+type discordSink struct {
+	opts     chatOptions
+	username string
+	sent     *sentSet
+	client   *http.Client
+}
+
+// newDiscord creates a Discord sink.
+//
+// Params: webhookURLFile, dashboardURL, notifyResolved (see chatParams), username
+// (default FeatureLens).
+func newDiscord(params params.Params, logger *zap.Logger) (Sink, error) {
+	opts, err := chatParams(params)
+	if err != nil {
+		return nil, err
+	}
+	username, err := params.String("username", "FeatureLens")
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("Discord sink configured", zap.Bool("notify_resolved", opts.notifyResolved))
+	return &discordSink{opts: opts, username: username, sent: newSentSet(), client: &http.Client{}}, nil
+}
+
+type discordMessage struct {
+	Username string         `json:"username,omitempty"`
+	Embeds   []discordEmbed `json:"embeds"`
+}
+
+type discordEmbed struct {
+	Title     string              `json:"title"`
+	URL       string              `json:"url,omitempty"`
+	Color     int                 `json:"color"`
+	Fields    []discordEmbedField `json:"fields"`
+	Timestamp time.Time           `json:"timestamp"`
+}
+
+type discordEmbedField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+func (s *discordSink) Send(ctx context.Context, events []Event) error {
+	var embeds []discordEmbed
+	var ids []string // Of the events posted as embeds
+	for _, e := range events {
+		if s.sent.has(e.ID) {
+			continue // Posted by an earlier attempt of a retried batch
+		}
+		if !s.opts.posts(e) {
+			continue
+		}
+		if e.Message != nil {
+			// Rendered with the sink's template, as a message of its own
+			if err := postBody(ctx, s.client, s.opts.webhookURL, nil, e.Message); err != nil {
+				return err
+			}
+			s.sent.add(e.ID)
+			continue
+		}
+		switch p := e.Payload.(type) {
+		case schema.Violation:
+			color, ok := discordColors[p.Severity]
+			if !ok {
+				color = discordColors["warning"]
+			}
+			embeds = append(embeds, s.embed(alertSummary(p), color, violationFacts(p), p.FeatureName, p.WindowEnd))
+		case schema.AlertResolved:
+			embeds = append(embeds, s.embed(resolvedSummary(p), discordColors["resolved"], resolvedFacts(p), p.FeatureName, p.WindowEnd))
+		case schema.InternalError:
+			embeds = append(embeds, s.embed(internalErrorSummary(p), discordColors[internalErrorColor(p)], internalErrorFacts(p), "", p.DetectedAt))
+		}
+		ids = append(ids, e.ID)
+	}
+	for start := 0; start < len(embeds); start += discordMaxEmbeds {
+		end := min(start+discordMaxEmbeds, len(embeds))
+		if err := postJSON(ctx, s.client, s.opts.webhookURL, nil, discordMessage{Username: s.username, Embeds: embeds[start:end]}); err != nil {
+			return err // Later messages would hit the same rate limit or outage
+		}
+		for _, id := range ids[start:end] {
+			s.sent.add(id)
+		}
+	}
+	return nil
+}
+
+func (s *discordSink) embed(title string, color int, facts []fact, featureName string, at time.Time) discordEmbed {
+	fields := make([]discordEmbedField, len(facts))
+	for i, f := range facts {
+		fields[i] = discordEmbedField{Name: f.Name, Value: f.Value, Inline: f.Name != "Window" && f.Name != "Condition" && f.Name != "Error"}
+	}
+	return discordEmbed{
+		Title:     title,
+		URL:       s.opts.dashboardLink(featureName),
+		Color:     color,
+		Fields:    fields,
+		Timestamp: at,
+	}
+}
+
+func (s *discordSink) Probe(ctx context.Context) error {
+	return dialURL(ctx, s.opts.webhookURL)
+}
+
+func (s *discordSink) Templated() {}
+
+func (s *discordSink) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,260 @@
+package sink
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/sanspareilsmyn/featurelens/internal/params"
+	"github.com/sanspareilsmyn/featurelens/internal/schema"
+)
+
+const (
+	defaultDogStatsDHost   = "localhost"
+	defaultDogStatsDPort   = "8125"
+	defaultDogStatsDPrefix = "featurelens."
+	// defaultDogStatsDPacketSize keeps UDP datagrams within a typical network MTU.
+	defaultDogStatsDPacketSize = 1432
+	dogStatsDUnixPrefix        = "unix://"
+)
+
+// dogStatsDTagReplacer strips the characters that delimit metrics and tags from tag values.
+var dogStatsDTagReplacer = strings.NewReplacer("|", "_", ",", "_", "#", "_", "\n", " ")
+
+// dogStatsDSink emits window statistics as gauges and violations as counters and events
+// to a Datadog agent over the DogStatsD protocol, for organizations whose metrics go
+// through Datadog rather than Prometheus scrapes. Metrics are tagged by feature, and
+// violations by check, so monitors can be scoped to either.
+type dogStatsDSink struct {
+	network    string // "udp" or "unixgram"
+	addr       string
+	prefix     string
+	tags       []string // Added to every metric and event
+	events     bool
+	packetSize int
+	logger     *zap.Logger
+
+	conn net.Conn // nil until the first Send and after write errors
+}
+
+// newDogStatsD creates a DogStatsD sink.
+//
+// Params: addr (host:port or unix:///path/to/dsd.socket; default DD_AGENT_HOST and
+// DD_DOGSTATSD_PORT, then localhost:8125), prefix (of metric names, default
+// "featurelens."), tags (added to every metric, e.g. ["env:prod"]; default the
+// DD_ENV, DD_SERVICE and DD_VERSION unified service tags), events (send violations and
+// resolutions as Datadog events, default true), maxPacketSize (default 1432 bytes).
+func newDogStatsD(params params.Params, logger *zap.Logger) (Sink, error) {
+	host := defaultDogStatsDHost
+	if env := os.Getenv("DD_AGENT_HOST"); env != "" {
+		host = env
+	}
+	port := defaultDogStatsDPort
+	if env := os.Getenv("DD_DOGSTATSD_PORT"); env != "" {
+		port = env
+	}
+	addr, err := params.String("addr", net.JoinHostPort(host, port))
+	if err != nil {
+		return nil, err
+	}
+	s := &dogStatsDSink{network: "udp", addr: addr, logger: logger}
+	if path, ok := strings.CutPrefix(addr, dogStatsDUnixPrefix); ok {
+		s.network, s.addr = "unixgram", path
+	} else if _, _, err := net.SplitHostPort(addr); err != nil {
+		return nil, fmt.Errorf("%w: addr must be host:port or unix:///path: %w", ErrInvalidParams, err)
+	}
+	if s.prefix, err = params.String("prefix", defaultDogStatsDPrefix); err != nil {
+		return nil, err
+	}
+	if s.tags, err = params.Strings("tags"); err != nil {
+		return nil, err
+	}
+	if s.tags == nil {
+		for _, t := range []struct{ name, env string }{{"env", "DD_ENV"}, {"service", "DD_SERVICE"}, {"version", "DD_VERSION"}} {
+			if value := os.Getenv(t.env); value != "" {
+				s.tags = append(s.tags, t.name+":"+value)
+			}
+		}
+	}
+	if s.events, err = params.Bool("events", true); err != nil {
+		return nil, err
+	}
+	if s.packetSize, err = params.Int("maxPacketSize", defaultDogStatsDPacketSize); err != nil {
+		return nil, err
+	}
+	if s.packetSize <= 0 {
+		return nil, fmt.Errorf("%w: maxPacketSize must be positive", ErrInvalidParams)
+	}
+
+	logger.Info("DogStatsD sink configured",
+		zap.String("addr", addr),
+		zap.String("prefix", s.prefix),
+		zap.Strings("tags", s.tags),
+		zap.Bool("events", s.events),
+	)
+	return s, nil
+}
+
+func (s *dogStatsDSink) Send(ctx context.Context, events []Event) error {
+	var lines []string
+	for _, e := range events {
+		switch p := e.Payload.(type) {
+		case schema.AggregationResult:
+			lines = append(lines, s.resultLines(p)...)
+		case schema.Violation:
+			tags := s.tagged(p.FeatureName, p.ModelVersion, p.Tenant, p.Segment,
+				"check:"+p.CheckType, "severity:"+p.Severity, "silenced:"+strconv.FormatBool(p.Silenced))
+			lines = append(lines, s.metric("violations", "1", "c", tags))
+			if s.events && pages(p) {
+				lines = append(lines, s.event(alertSummary(p), violationDescription(p), dogStatsDAlertType(p.Severity),
+					alertID(p.FeatureName, p.CheckType, p.Comparison), tags))
+			}
+		case schema.AlertResolved:
+			tags := s.tagged(p.FeatureName, p.ModelVersion, p.Tenant, nil, "check:"+p.CheckType, "severity:"+p.Severity)
+			lines = append(lines, s.metric("alert.duration_seconds", formatFloat(p.Duration), "d", tags))
+			if s.events {
+				title := fmt.Sprintf("%s: %s resolved", p.FeatureName, p.CheckType)
+				text := fmt.Sprintf("Firing since %s, resolved by the window ending %s.", p.FiringSince.UTC().Format(time.RFC3339), p.WindowEnd.UTC().Format(time.RFC3339))
+				lines = append(lines, s.event(title, text, "success", alertID(p.FeatureName, p.CheckType, p.Comparison), tags))
+			}
+		}
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+
+	if s.conn == nil {
+		conn, err := (&net.Dialer{}).DialContext(ctx, s.network, s.addr)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrSendFailed, err)
+		}
+		s.conn = conn
+	}
+	for _, packet := range s.packets(lines) {
+		if _, err := s.conn.Write(packet); err != nil {
+			_ = s.conn.Close()
+			s.conn = nil // Redial on the next batch, e.g. after the agent restarted
+			return fmt.Errorf("%w: %w", ErrSendFailed, err)
+		}
+	}
+	return nil
+}
+
+// resultLines returns a gauge per statistic the window defines.
+func (s *dogStatsDSink) resultLines(r schema.AggregationResult) []string {
+	tags := s.tagged(r.FeatureName, r.ModelVersion, r.Tenant, r.Segment)
+	lines := []string{s.metric("window.count", strconv.FormatInt(r.Count, 10), "g", tags)}
+	for _, stat := range []struct {
+		name  string
+		value *float64
+	}{
+		{"window.null_rate", r.NullRate},
+		{"window.missing_rate", r.MissingRate},
+		{"window.type_mismatch_rate", r.TypeMismatchRate},
+		{"window.zero_rate", r.ZeroRate},
+		{"window.mean", r.Mean},
+		{"window.std_dev", r.StdDev},
+	} {
+		if stat.value != nil {
+			lines = append(lines, s.metric(stat.name, formatFloat(*stat.value), "g", tags))
+		}
+	}
+	if r.Categories != nil {
+		lines = append(lines, s.metric("window.distinct_values", strconv.Itoa(len(r.Categories)), "g", tags))
+	}
+	if p := r.Percentiles; p != nil {
+		lines = append(lines,
+			s.metric("window.p50", formatFloat(p.P50), "g", tags),
+			s.metric("window.p95", formatFloat(p.P95), "g", tags),
+			s.metric("window.p99", formatFloat(p.P99), "g", tags),
+		)
+	}
+	return lines
+}
+
+// tagged returns the sink's tags with those identifying a feature's result and extra.
+// The feature tag is the configured feature, segments and model versions being tagged
+// apart.
+func (s *dogStatsDSink) tagged(featureName, modelVersion, tenant string, segment *schema.Segment, extra ...string) []string {
+	feature := strings.TrimSuffix(featureName, "@"+modelVersion)
+	tags := append(make([]string, 0, len(s.tags)+6+len(extra)), s.tags...)
+	if segment != nil {
+		feature = segment.Feature
+		tags = append(tags, "group_by:"+segment.GroupBy, "group:"+segment.Group)
+	}
+	tags = append(tags, "feature:"+feature)
+	if modelVersion != "" {
+		tags = append(tags, "model_version:"+modelVersion)
+	}
+	if tenant != "" {
+		tags = append(tags, "tenant:"+tenant)
+	}
+	tags = append(tags, extra...)
+	for i, tag := range tags {
+		tags[i] = dogStatsDTagReplacer.Replace(tag)
+	}
+	return tags
+}
+
+// metric formats a DogStatsD metric, e.g. "featurelens.window.mean:4.2|g|#feature:age".
+func (s *dogStatsDSink) metric(name, value, typ string, tags []string) string {
+	return s.prefix + name + ":" + value + "|" + typ + "|#" + strings.Join(tags, ",")
+}
+
+// event formats a DogStatsD event. Events with the same aggregation key, those of one
+// alert, are grouped by Datadog.
+func (s *dogStatsDSink) event(title, text, alertType, aggregationKey string, tags []string) string {
+	text = strings.ReplaceAll(strings.TrimSpace(text), "\n", `\n`)
+	return fmt.Sprintf("_e{%d,%d}:%s|%s|t:%s|k:%s|s:%s|#%s",
+		len(title), len(text), title, text, alertType, aggregationKey, alertSource, strings.Join(tags, ","))
+}
+
+// packets joins lines into newline-separated datagrams of at most packetSize bytes; a
+// longer line is sent alone.
+func (s *dogStatsDSink) packets(lines []string) [][]byte {
+	var packets [][]byte
+	var packet []byte
+	for _, line := range lines {
+		if len(packet) > 0 && len(packet)+1+len(line) > s.packetSize {
+			packets = append(packets, packet)
+			packet = nil
+		}
+		if len(packet) > 0 {
+			packet = append(packet, '\n')
+		}
+		packet = append(packet, line...)
+	}
+	if len(packet) > 0 {
+		packets = append(packets, packet)
+	}
+	return packets
+}
+
+func (s *dogStatsDSink) Close() error {
+	if s.conn == nil {
+		return nil
+	}
+	return s.conn.Close()
+}
+
+// dogStatsDAlertType maps a violation severity to a Datadog event alert type.
+func dogStatsDAlertType(severity string) string {
+	switch severity {
+	case "critical":
+		return "error"
+	case "info":
+		return "info"
+	default:
+		return "warning"
+	}
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
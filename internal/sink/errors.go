@@ -0,0 +1,10 @@
+package sink
+
+import "errors"
+
+var (
+	ErrUnknownType   = errors.New("unknown sink type")
+	ErrInvalidParams = errors.New("invalid sink parameters")
+	ErrSendFailed    = errors.New("failed to send events")
+	ErrProbeFailed   = errors.New("sink destination unreachable")
+)
@@ -0,0 +1,70 @@
+package sink
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"go.uber.org/zap"
+
+	"github.com/sanspareilsmyn/featurelens/internal/params"
+)
+
+// fileSink appends each payload as a JSON line to a local file, or the message rendered
+// with the sink's template followed by a newline.
+type fileSink struct {
+	file *os.File
+}
+
+// newFile creates a JSON lines file sink.
+//
+// Params: path (created with its parent directories if missing; appended to otherwise).
+func newFile(params params.Params, logger *zap.Logger) (Sink, error) {
+	path, err := params.String("path", "")
+	if err != nil {
+		return nil, err
+	}
+	if path == "" {
+		return nil, fmt.Errorf("%w: path cannot be empty", ErrInvalidParams)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidParams, err)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidParams, err)
+	}
+	logger.Info("File sink opened", zap.String("path", path))
+	return &fileSink{file: f}, nil
+}
+
+func (s *fileSink) Send(_ context.Context, events []Event) error {
+	w := bufio.NewWriter(s.file)
+	enc := json.NewEncoder(w)
+	for _, e := range events {
+		if e.Message != nil {
+			// Templates from YAML block scalars end with a newline already. Write errors
+			// are returned by Flush.
+			_, _ = w.Write(bytes.TrimSuffix(e.Message, []byte("\n")))
+			_ = w.WriteByte('\n')
+			continue
+		}
+		if err := enc.Encode(e.document()); err != nil {
+			return fmt.Errorf("%w: %w", ErrSendFailed, err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("%w: %w", ErrSendFailed, err)
+	}
+	return nil
+}
+
+func (s *fileSink) Templated() {}
+
+func (s *fileSink) Close() error {
+	return s.file.Close()
+}
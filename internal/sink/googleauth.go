@@ -0,0 +1,184 @@
+package sink
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sanspareilsmyn/featurelens/internal/params"
+)
+
+const (
+	googleTokenURL    = "https://oauth2.googleapis.com/token"
+	googleMetadataURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+	// googleTokenLeeway renews access tokens this long before they expire.
+	googleTokenLeeway = time.Minute
+)
+
+// googleServiceAccount is the part of a service account JSON key the sink uses.
+type googleServiceAccount struct {
+	Type        string `json:"type"`
+	ProjectID   string `json:"project_id"`
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenURI    string `json:"token_uri"`
+}
+
+// googleTokenSource fetches and caches OAuth 2.0 access tokens for Google APIs, from a
+// service account key (JWT bearer grant) or, without one, from the metadata server of
+// the GCE VM or GKE pod FeatureLens runs on.
+type googleTokenSource struct {
+	scope   string
+	account *googleServiceAccount // nil to use the metadata server
+	key     *rsa.PrivateKey
+	client  *http.Client
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// newGoogleTokenSource creates a token source for scope. The service account key is read
+// from credentialsFile (or credentials), defaulting to GOOGLE_APPLICATION_CREDENTIALS; the
+// metadata server is used if neither is set.
+func newGoogleTokenSource(p params.Params, scope string, client *http.Client) (*googleTokenSource, error) {
+	ts := &googleTokenSource{scope: scope, client: client}
+	var data string
+	if ok, err := hasSecret(p, "credentialsFile"); err != nil {
+		return nil, err
+	} else if ok {
+		if data, err = readSecret(p, "credentialsFile"); err != nil {
+			return nil, err
+		}
+	} else if path := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS"); path != "" {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("%w: GOOGLE_APPLICATION_CREDENTIALS: %w", ErrInvalidParams, err)
+		}
+		data = string(raw)
+	} else {
+		return ts, nil
+	}
+
+	var account googleServiceAccount
+	if err := json.Unmarshal([]byte(data), &account); err != nil {
+		return nil, fmt.Errorf("%w: credentials: %w", ErrInvalidParams, err)
+	}
+	if account.Type != "service_account" || account.ClientEmail == "" {
+		return nil, fmt.Errorf("%w: credentials must be a service account key", ErrInvalidParams)
+	}
+	block, _ := pem.Decode([]byte(account.PrivateKey))
+	if block == nil {
+		return nil, fmt.Errorf("%w: credentials: private_key is not PEM encoded", ErrInvalidParams)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: credentials: private_key: %w", ErrInvalidParams, err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%w: credentials: private_key is not an RSA key", ErrInvalidParams)
+	}
+	if account.TokenURI == "" {
+		account.TokenURI = googleTokenURL
+	}
+	ts.account, ts.key = &account, key
+	return ts, nil
+}
+
+// projectID returns the project of the service account key, empty with the metadata server.
+func (ts *googleTokenSource) projectID() string {
+	if ts.account == nil {
+		return ""
+	}
+	return ts.account.ProjectID
+}
+
+// Token returns a valid access token, fetching a new one when the cached one expires.
+func (ts *googleTokenSource) Token(ctx context.Context) (string, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if ts.token != "" && time.Now().Before(ts.expires) {
+		return ts.token, nil
+	}
+
+	var req *http.Request
+	var err error
+	if ts.account == nil {
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, googleMetadataURL+"?scopes="+url.QueryEscape(ts.scope), nil)
+		if err == nil {
+			req.Header.Set("Metadata-Flavor", "Google")
+		}
+	} else {
+		var assertion string
+		if assertion, err = ts.assertion(time.Now()); err != nil {
+			return "", err
+		}
+		form := url.Values{
+			"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+			"assertion":  {assertion},
+		}
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, ts.account.TokenURI, strings.NewReader(form.Encode()))
+		if err == nil {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+	}
+	if err != nil {
+		return "", fmt.Errorf("%w: access token: %w", ErrSendFailed, err)
+	}
+
+	resp, err := ts.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("%w: access token: %w", ErrSendFailed, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", fmt.Errorf("%w: access token: status %d: %s", ErrSendFailed, resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil || token.AccessToken == "" {
+		return "", fmt.Errorf("%w: access token: invalid response", ErrSendFailed)
+	}
+	ts.token = token.AccessToken
+	ts.expires = time.Now().Add(time.Duration(token.ExpiresIn)*time.Second - googleTokenLeeway)
+	return ts.token, nil
+}
+
+// assertion returns the RS256-signed JWT exchanged for an access token.
+// See https://developers.google.com/identity/protocols/oauth2/service-account#authorizingrequests.
+func (ts *googleTokenSource) assertion(now time.Time) (string, error) {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iss":   ts.account.ClientEmail,
+		"scope": ts.scope,
+		"aud":   ts.account.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	enc := base64.RawURLEncoding
+	unsigned := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, ts.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("%w: access token: %w", ErrSendFailed, err)
+	}
+	return unsigned + "." + enc.EncodeToString(signature), nil
+}
@@ -0,0 +1,170 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"go.uber.org/zap"
+
+	"github.com/sanspareilsmyn/featurelens/internal/params"
+	"github.com/sanspareilsmyn/featurelens/internal/schema"
+)
+
+// kafkaBatchTimeout bounds how long the writer waits to fill a partition batch. The
+// dispatcher already batches events, so each Send is flushed almost immediately.
+const kafkaBatchTimeout = 10 * time.Millisecond
+
+// kafkaSink publishes payloads as JSON messages to Kafka topics, keyed by feature name
+// so each feature's events stay ordered within one partition. Messages carry the
+// payload kind, event ID and schema version as headers, letting consumers route and
+// deduplicate without decoding.
+type kafkaSink struct {
+	writer  *kafka.Writer
+	brokers []string
+	topic   string            // Default topic, "" to drop kinds without a topic of their own
+	topics  map[string]string // Per payload kind
+}
+
+// newKafka creates a Kafka producer sink.
+//
+// Params: brokers (required), topic (default topic for every payload kind), topics
+// (payload kind to topic, overriding topic; at least one of the two is required),
+// compression (none, gzip, snappy, lz4 or zstd; default none), requiredAcks (none,
+// one or all; default all).
+func newKafka(params params.Params, logger *zap.Logger) (Sink, error) {
+	brokers, err := params.Strings("brokers")
+	if err != nil {
+		return nil, err
+	}
+	if len(brokers) == 0 {
+		return nil, fmt.Errorf("%w: brokers cannot be empty", ErrInvalidParams)
+	}
+	topic, err := params.String("topic", "")
+	if err != nil {
+		return nil, err
+	}
+	topics, err := params.StringMap("topics")
+	if err != nil {
+		return nil, err
+	}
+	if topic == "" && len(topics) == 0 {
+		return nil, fmt.Errorf("%w: topic or topics must be set", ErrInvalidParams)
+	}
+	for kind := range topics {
+		switch kind {
+		case schema.KindAggregationResult, schema.KindViolation, schema.KindFeatureArchived, schema.KindAlertFiring, schema.KindAlertResolved, schema.KindInternalError:
+		default:
+			return nil, fmt.Errorf("%w: topics: unknown payload kind %q", ErrInvalidParams, kind)
+		}
+	}
+	var compression kafka.Compression
+	if name, err := params.String("compression", "none"); err != nil {
+		return nil, err
+	} else if err := compression.UnmarshalText([]byte(name)); err != nil {
+		return nil, fmt.Errorf("%w: compression: %w", ErrInvalidParams, err)
+	}
+	var acks kafka.RequiredAcks
+	if name, err := params.String("requiredAcks", "all"); err != nil {
+		return nil, err
+	} else if err := acks.UnmarshalText([]byte(name)); err != nil {
+		return nil, fmt.Errorf("%w: requiredAcks: %w", ErrInvalidParams, err)
+	}
+
+	logger.Info("Kafka sink configured",
+		zap.Strings("brokers", brokers),
+		zap.String("topic", topic),
+		zap.Any("topics", topics),
+		zap.Stringer("compression", compression),
+		zap.Stringer("required_acks", acks),
+	)
+	return &kafkaSink{
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(brokers...),
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: acks,
+			Compression:  compression,
+			BatchTimeout: kafkaBatchTimeout,
+			ErrorLogger: kafka.LoggerFunc(func(msg string, args ...interface{}) {
+				logger.Error(fmt.Sprintf(msg, args...))
+			}),
+		},
+		brokers: brokers,
+		topic:   topic,
+		topics:  topics,
+	}, nil
+}
+
+func (s *kafkaSink) Send(ctx context.Context, events []Event) error {
+	msgs := make([]kafka.Message, 0, len(events))
+	for _, e := range events {
+		topic, ok := s.topics[e.Kind]
+		if !ok {
+			topic = s.topic
+		}
+		if topic == "" {
+			continue
+		}
+		value := e.Message // Rendered with the sink's template
+		if value == nil {
+			var err error
+			if value, err = json.Marshal(e.document()); err != nil {
+				return fmt.Errorf("%w: %w", ErrSendFailed, err)
+			}
+		}
+		msgs = append(msgs, kafka.Message{
+			Topic: topic,
+			Key:   []byte(e.FeatureName),
+			Value: value,
+			Headers: []kafka.Header{
+				{Key: "kind", Value: []byte(e.Kind)},
+				{Key: "eventId", Value: []byte(e.ID)},
+				{Key: "schemaVersion", Value: []byte(schema.Version)},
+			},
+		})
+	}
+	if len(msgs) == 0 {
+		return nil
+	}
+	if err := s.writer.WriteMessages(ctx, msgs...); err != nil {
+		return fmt.Errorf("%w: %w", ErrSendFailed, err)
+	}
+	return nil
+}
+
+// Probe connects to the first reachable broker and checks that every output topic exists.
+func (s *kafkaSink) Probe(ctx context.Context) error {
+	var topics []string
+	if s.topic != "" {
+		topics = append(topics, s.topic)
+	}
+	for _, topic := range s.topics {
+		topics = append(topics, topic)
+	}
+
+	var errs []error
+	for _, broker := range s.brokers {
+		conn, err := kafka.DialContext(ctx, "tcp", broker)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		defer conn.Close()
+		for _, topic := range topics {
+			if _, err := conn.ReadPartitions(topic); err != nil {
+				return fmt.Errorf("%w: topic %q: %w", ErrProbeFailed, topic, err)
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("%w: %w", ErrProbeFailed, errors.Join(errs...))
+}
+
+func (s *kafkaSink) Templated() {}
+
+func (s *kafkaSink) Close() error {
+	return s.writer.Close()
+}
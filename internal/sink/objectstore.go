@@ -0,0 +1,193 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sanspareilsmyn/featurelens/internal/params"
+	"github.com/sanspareilsmyn/featurelens/internal/sigv4"
+)
+
+// Default object storage endpoints. GCS is written through its S3-compatible XML API,
+// authenticated with HMAC keys.
+const (
+	defaultS3Region = "us-east-1"
+	gcsEndpoint     = "https://storage.googleapis.com"
+	gcsRegion       = "auto"
+)
+
+// objectStore writes whole objects under a key prefix.
+type objectStore interface {
+	put(ctx context.Context, key string, body []byte) error
+	probe(ctx context.Context) error // Checks the store is reachable without writing
+}
+
+// newObjectStore creates the object store named by the url parameter: s3://bucket/prefix,
+// gs://bucket/prefix or file:///directory.
+//
+// Params for s3 and gs: region (s3 only, default us-east-1), endpoint (for S3-compatible
+// stores such as MinIO), pathStyle (address the bucket in the path rather than the host),
+// accessKeyIDFile and secretAccessKeyFile (default: the AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment variables; GCS HMAC keys
+// for gs).
+func newObjectStore(p params.Params) (objectStore, string, error) {
+	raw, err := p.String("url", "")
+	if err != nil {
+		return nil, "", err
+	}
+	u, err := url.Parse(raw)
+	if err != nil || raw == "" {
+		return nil, "", fmt.Errorf("%w: url must be s3://bucket/prefix, gs://bucket/prefix or file:///directory", ErrInvalidParams)
+	}
+	prefix := strings.Trim(u.Path, "/")
+
+	switch u.Scheme {
+	case "file":
+		return &localStore{dir: u.Path}, raw, nil
+	case "s3", "gs":
+	default:
+		return nil, "", fmt.Errorf("%w: url: unsupported scheme %q", ErrInvalidParams, u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, "", fmt.Errorf("%w: url: bucket cannot be empty", ErrInvalidParams)
+	}
+
+	s := &s3Store{bucket: u.Host, prefix: prefix, client: &http.Client{}}
+	s.signer = sigv4.Signer{Region: gcsRegion, Service: "s3", PayloadHeader: true}
+	endpoint := gcsEndpoint
+	if u.Scheme == "s3" {
+		if s.signer.Region, err = p.String("region", defaultS3Region); err != nil {
+			return nil, "", err
+		}
+		endpoint = "https://s3." + s.signer.Region + ".amazonaws.com"
+	}
+	if endpoint, err = p.String("endpoint", endpoint); err != nil {
+		return nil, "", err
+	}
+	if s.endpoint, err = url.Parse(endpoint); err != nil || s.endpoint.Host == "" {
+		return nil, "", fmt.Errorf("%w: endpoint: %q is not an absolute URL", ErrInvalidParams, endpoint)
+	}
+	if s.pathStyle, err = p.Bool("pathStyle", false); err != nil {
+		return nil, "", err
+	}
+	if err := s.loadCredentials(p); err != nil {
+		return nil, "", err
+	}
+	return s, raw, nil
+}
+
+// localStore writes objects as files under a directory, e.g. a mounted volume.
+type localStore struct {
+	dir string
+}
+
+func (s *localStore) put(_ context.Context, key string, body []byte) error {
+	name := filepath.Join(s.dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return fmt.Errorf("%w: %w", ErrSendFailed, err)
+	}
+	// Write then rename, so readers never see a partial file
+	tmp := name + ".tmp"
+	if err := os.WriteFile(tmp, body, 0o644); err != nil {
+		return fmt.Errorf("%w: %w", ErrSendFailed, err)
+	}
+	if err := os.Rename(tmp, name); err != nil {
+		return fmt.Errorf("%w: %w", ErrSendFailed, err)
+	}
+	return nil
+}
+
+// probe checks the directory can be created and written to.
+func (s *localStore) probe(context.Context) error {
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return fmt.Errorf("%w: %w", ErrProbeFailed, err)
+	}
+	f, err := os.CreateTemp(s.dir, ".probe-*")
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrProbeFailed, err)
+	}
+	_ = f.Close()
+	return os.Remove(f.Name())
+}
+
+// s3Store uploads objects with S3 PUT Object requests signed with AWS Signature Version 4.
+type s3Store struct {
+	endpoint  *url.URL
+	bucket    string
+	prefix    string
+	pathStyle bool
+	signer    sigv4.Signer // Credentials loaded by loadCredentials
+	client    *http.Client
+}
+
+// probe checks the endpoint accepts connections; credentials are only checked on upload.
+func (s *s3Store) probe(ctx context.Context) error {
+	u := *s.endpoint
+	if !s.pathStyle {
+		u.Host = s.bucket + "." + u.Host
+	}
+	return dialURL(ctx, u.String())
+}
+
+func (s *s3Store) loadCredentials(p params.Params) error {
+	if ok, err := hasSecret(p, "accessKeyIDFile"); err != nil {
+		return err
+	} else if !ok {
+		s.signer.AccessKeyID = os.Getenv("AWS_ACCESS_KEY_ID")
+		s.signer.SecretAccessKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+		s.signer.SessionToken = os.Getenv("AWS_SESSION_TOKEN")
+		if s.signer.AccessKeyID == "" || s.signer.SecretAccessKey == "" {
+			return fmt.Errorf("%w: accessKeyIDFile and secretAccessKeyFile (or accessKeyID and secretAccessKey), or AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY, must be set", ErrInvalidParams)
+		}
+		return nil
+	}
+	var err error
+	if s.signer.AccessKeyID, err = readSecret(p, "accessKeyIDFile"); err != nil {
+		return err
+	}
+	s.signer.SecretAccessKey, err = readSecret(p, "secretAccessKeyFile")
+	return err
+}
+
+func (s *s3Store) put(ctx context.Context, key string, body []byte) error {
+	if s.prefix != "" {
+		key = s.prefix + "/" + key
+	}
+	u := *s.endpoint
+	if s.pathStyle {
+		u.Path = path.Join("/", u.Path, s.bucket, key)
+	} else {
+		u.Host = s.bucket + "." + u.Host
+		u.Path = path.Join("/", u.Path, key)
+	}
+	u.RawPath = sigv4.EscapePath(u.Path)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrSendFailed, err)
+	}
+	req.Header.Set("Content-Type", "application/vnd.apache.parquet")
+	req.Header.Set("User-Agent", alertSource)
+	s.signer.Sign(req, body, time.Now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrSendFailed, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("%w: status %d: %s", ErrSendFailed, resp.StatusCode, bytes.TrimSpace(msg))
+}
@@ -0,0 +1,164 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/sanspareilsmyn/featurelens/internal/params"
+	"github.com/sanspareilsmyn/featurelens/internal/schema"
+)
+
+const defaultOpsgenieURL = "https://api.opsgenie.com"
+
+// defaultOpsgeniePriorities maps violation severities to Opsgenie priorities (P1 highest).
+var defaultOpsgeniePriorities = map[string]string{
+	"critical": "P1",
+	"warning":  "P3",
+	"info":     "P5",
+}
+
+// opsgenieSink creates an Opsgenie alert per firing FeatureLens alert and closes it when
+// the alert resolves. Opsgenie deduplicates repeated violations by alias.
+type opsgenieSink struct {
+	apiURL     string
+	header     http.Header
+	priorities map[string]string
+	tags       []string
+	autoClose  bool
+	client     *http.Client
+}
+
+// newOpsgenie creates an Opsgenie sink.
+//
+// Params: apiKeyFile (file holding an API integration key), apiURL (default
+// https://api.opsgenie.com; https://api.eu.opsgenie.com for EU accounts), priorities
+// (severity to priority, default critical: P1, warning: P3, info: P5), tags (added to
+// every alert), autoClose (close alerts on recovery, default true).
+func newOpsgenie(params params.Params, logger *zap.Logger) (Sink, error) {
+	key, err := readSecret(params, "apiKeyFile")
+	if err != nil {
+		return nil, err
+	}
+	apiURL, err := params.String("apiURL", defaultOpsgenieURL)
+	if err != nil {
+		return nil, err
+	}
+	priorities, err := severityMap(params, "priorities", defaultOpsgeniePriorities)
+	if err != nil {
+		return nil, err
+	}
+	for severity, priority := range priorities {
+		switch priority {
+		case "P1", "P2", "P3", "P4", "P5":
+		default:
+			return nil, fmt.Errorf("%w: priorities: %q for %q is not one of P1-P5", ErrInvalidParams, priority, severity)
+		}
+	}
+	tags, err := params.Strings("tags")
+	if err != nil {
+		return nil, err
+	}
+	autoClose, err := params.Bool("autoClose", true)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("Opsgenie sink configured", zap.String("api_url", apiURL), zap.Bool("auto_close", autoClose))
+	return &opsgenieSink{
+		apiURL:     strings.TrimSuffix(apiURL, "/"),
+		header:     http.Header{"Authorization": []string{"GenieKey " + key}},
+		priorities: priorities,
+		tags:       append([]string{alertSource}, tags...),
+		autoClose:  autoClose,
+		client:     &http.Client{},
+	}, nil
+}
+
+// opsgenieAlert is the body of Opsgenie's create alert request.
+type opsgenieAlert struct {
+	Message     string            `json:"message"` // Truncated by Opsgenie beyond 130 characters
+	Alias       string            `json:"alias"`
+	Description string            `json:"description"`
+	Priority    string            `json:"priority"`
+	Source      string            `json:"source"`
+	Entity      string            `json:"entity"`
+	Tags        []string          `json:"tags"`
+	Details     map[string]string `json:"details"`
+}
+
+// opsgenieClose is the body of Opsgenie's close alert request.
+type opsgenieClose struct {
+	Source string `json:"source"`
+	Note   string `json:"note"`
+}
+
+func (s *opsgenieSink) Send(ctx context.Context, events []Event) error {
+	var errs []error
+	for _, e := range events {
+		switch p := e.Payload.(type) {
+		case schema.Violation:
+			if pages(p) {
+				errs = append(errs, s.create(ctx, e.Message, p))
+			}
+		case schema.AlertResolved:
+			if s.autoClose {
+				errs = append(errs, s.close(ctx, e.Message, p))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// create opens an alert for a violation, with the message rendered by the sink's
+// template as request body if any.
+func (s *opsgenieSink) create(ctx context.Context, message []byte, v schema.Violation) error {
+	if message != nil {
+		return postBody(ctx, s.client, s.apiURL+"/v2/alerts", s.header, message)
+	}
+	alert := opsgenieAlert{
+		Message:     alertSummary(v),
+		Alias:       alertID(v.FeatureName, v.CheckType, v.Comparison),
+		Description: violationDescription(v),
+		Priority:    s.priorities[v.Severity],
+		Source:      alertSource,
+		Entity:      v.FeatureName,
+		Tags:        append(append([]string(nil), s.tags...), v.CheckType),
+		Details:     violationDetails(v),
+	}
+	if alert.Priority == "" {
+		alert.Priority = defaultOpsgeniePriorities["warning"]
+	}
+	return postJSON(ctx, s.client, s.apiURL+"/v2/alerts", s.header, alert)
+}
+
+// close closes the alert of a resolved check, likewise.
+func (s *opsgenieSink) close(ctx context.Context, message []byte, r schema.AlertResolved) error {
+	alias := alertID(r.FeatureName, r.CheckType, r.Comparison)
+	u := s.apiURL + "/v2/alerts/" + url.PathEscape(alias) + "/close?identifierType=alias"
+	if message != nil {
+		return postBody(ctx, s.client, u, s.header, message)
+	}
+	body := opsgenieClose{
+		Source: alertSource,
+		Note:   fmt.Sprintf("Window ending %s passed every check", r.WindowEnd.Format(time.RFC3339)),
+	}
+	return postJSON(ctx, s.client, u, s.header, body)
+}
+
+func (s *opsgenieSink) Probe(ctx context.Context) error {
+	return dialURL(ctx, s.apiURL)
+}
+
+func (s *opsgenieSink) Templated() {}
+
+func (s *opsgenieSink) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,256 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+	"go.uber.org/zap"
+
+	"github.com/sanspareilsmyn/featurelens/internal/params"
+	"github.com/sanspareilsmyn/featurelens/internal/schema"
+)
+
+const (
+	defaultParquetFlushInterval = time.Hour
+	defaultParquetMaxRows       = 100000
+	// parquetCloseTimeout bounds the upload of the rows still buffered on shutdown.
+	parquetCloseTimeout = 30 * time.Second
+)
+
+// resultRow is the columnar layout of a window result, written as Parquet columns and
+// as ClickHouse JSONEachRow fields. Statistics a window does not define (e.g. the mean
+// without numeric values) are null.
+type resultRow struct {
+	EventID           string           `parquet:"event_id" json:"event_id"`
+	FeatureName       string           `parquet:"feature_name,dict" json:"feature_name"`
+	ModelVersion      string           `parquet:"model_version,optional,dict" json:"model_version"`
+	Tenant            string           `parquet:"tenant,optional,dict" json:"tenant"`
+	SegmentGroupBy    string           `parquet:"segment_group_by,optional,dict" json:"segment_group_by"`
+	SegmentGroup      string           `parquet:"segment_group,optional,dict" json:"segment_group"`
+	WindowStart       time.Time        `parquet:"window_start,timestamp(millisecond)" json:"window_start"`
+	WindowEnd         time.Time        `parquet:"window_end,timestamp(millisecond)" json:"window_end"`
+	Count             int64            `parquet:"count" json:"count"`
+	NullCount         int64            `parquet:"null_count" json:"null_count"`
+	NullRate          *float64         `parquet:"null_rate,optional" json:"null_rate"`
+	MissingCount      int64            `parquet:"missing_count" json:"missing_count"`
+	MissingRate       *float64         `parquet:"missing_rate,optional" json:"missing_rate"`
+	TypeMismatchCount int64            `parquet:"type_mismatch_count" json:"type_mismatch_count"`
+	TypeMismatchRate  *float64         `parquet:"type_mismatch_rate,optional" json:"type_mismatch_rate"`
+	ZeroCount         int64            `parquet:"zero_count" json:"zero_count"`
+	ZeroRate          *float64         `parquet:"zero_rate,optional" json:"zero_rate"`
+	Mean              *float64         `parquet:"mean,optional" json:"mean"`
+	Variance          *float64         `parquet:"variance,optional" json:"variance"`
+	StdDev            *float64         `parquet:"std_dev,optional" json:"std_dev"`
+	SampledOut        int64            `parquet:"sampled_out" json:"sampled_out"`
+	AvgLength         *float64         `parquet:"avg_length,optional" json:"avg_length"`
+	MaxLength         *int64           `parquet:"max_length,optional" json:"max_length"`
+	PatternMatchRate  *float64         `parquet:"pattern_match_rate,optional" json:"pattern_match_rate"`
+	NormMean          *float64         `parquet:"norm_mean,optional" json:"norm_mean"`
+	NonFiniteRate     *float64         `parquet:"non_finite_rate,optional" json:"non_finite_rate"`
+	CentroidDistance  *float64         `parquet:"centroid_distance,optional" json:"centroid_distance"`
+	P50               *float64         `parquet:"p50,optional" json:"p50"`
+	P95               *float64         `parquet:"p95,optional" json:"p95"`
+	P99               *float64         `parquet:"p99,optional" json:"p99"`
+	Categories        map[string]int64 `parquet:"categories" json:"categories"`
+}
+
+// parquetPartition is the object path a row is written under.
+type parquetPartition struct {
+	date    string // UTC date of the window end
+	feature string // Configured feature, shared by its segments and model versions
+}
+
+func (p parquetPartition) key(file string) string {
+	return "date=" + p.date + "/feature=" + url.PathEscape(p.feature) + "/" + file
+}
+
+// parquetSink buffers window results and periodically writes them as Parquet files to
+// object storage, one file per partition and flush, under Hive-style date=/feature=
+// paths that Athena, BigQuery and Spark read as partition columns.
+type parquetSink struct {
+	store         objectStore
+	flushInterval time.Duration
+	maxRows       int
+
+	pending     map[parquetPartition][]resultRow
+	pendingIDs  map[string]bool // Of pending rows, so retried batches are not buffered twice...
+	sent        *sentSet        // ...nor rows already uploaded
+	pendingRows int
+	since       time.Time // When the oldest pending row was buffered
+	logger      *zap.Logger
+}
+
+// newParquet creates a Parquet export sink. It only writes aggregation_result events.
+//
+// Params: url (s3://bucket/prefix, gs://bucket/prefix or file:///directory; see
+// newObjectStore for credentials), flushInterval (max time rows are buffered, default
+// 1h; checked as results arrive), maxRows (rows buffered before an early flush,
+// default 100000).
+func newParquet(params params.Params, logger *zap.Logger) (Sink, error) {
+	store, location, err := newObjectStore(params)
+	if err != nil {
+		return nil, err
+	}
+	flushInterval, err := params.Duration("flushInterval", defaultParquetFlushInterval)
+	if err != nil {
+		return nil, err
+	}
+	maxRows, err := params.Int("maxRows", defaultParquetMaxRows)
+	if err != nil {
+		return nil, err
+	}
+	if flushInterval <= 0 || maxRows <= 0 {
+		return nil, fmt.Errorf("%w: flushInterval and maxRows must be positive", ErrInvalidParams)
+	}
+
+	logger.Info("Parquet export sink configured",
+		zap.String("url", location),
+		zap.Duration("flush_interval", flushInterval),
+		zap.Int("max_rows", maxRows),
+	)
+	return &parquetSink{
+		store:         store,
+		flushInterval: flushInterval,
+		maxRows:       maxRows,
+		pending:       make(map[parquetPartition][]resultRow),
+		pendingIDs:    make(map[string]bool),
+		sent:          newSentSet(),
+		logger:        logger,
+	}, nil
+}
+
+func (s *parquetSink) Send(ctx context.Context, events []Event) error {
+	for _, e := range events {
+		result, ok := e.Payload.(schema.AggregationResult)
+		if !ok || s.pendingIDs[e.ID] || s.sent.has(e.ID) {
+			continue
+		}
+		if s.pendingRows == 0 {
+			s.since = time.Now()
+		}
+		partition := parquetPartition{date: result.WindowEnd.UTC().Format(time.DateOnly), feature: configuredFeature(result)}
+		s.pending[partition] = append(s.pending[partition], newResultRow(result))
+		s.pendingIDs[e.ID] = true
+		s.pendingRows++
+	}
+	if s.pendingRows == 0 || (s.pendingRows < s.maxRows && time.Since(s.since) < s.flushInterval) {
+		return nil
+	}
+
+	err := s.flush(ctx)
+	if err != nil && s.pendingRows >= s.maxRows {
+		s.logger.Error("Parquet export keeps failing, dropping buffered rows", zap.Int("rows", s.pendingRows), zap.Error(err))
+		s.pending = make(map[parquetPartition][]resultRow)
+		s.pendingIDs = make(map[string]bool)
+		s.pendingRows = 0
+	}
+	return err
+}
+
+// flush uploads every pending partition. Partitions that fail stay pending and are
+// retried with the next batch; the others are not written twice.
+func (s *parquetSink) flush(ctx context.Context) error {
+	file := "part-" + time.Now().UTC().Format("20060102T150405Z") + "-" + randomSuffix() + ".parquet"
+	var errs []error
+	for partition, rows := range s.pending {
+		var buf bytes.Buffer
+		if err := parquet.Write(&buf, rows, parquet.Compression(&parquet.Zstd)); err != nil {
+			errs = append(errs, fmt.Errorf("%w: %w", ErrSendFailed, err))
+			continue
+		}
+		if err := s.store.put(ctx, partition.key(file), buf.Bytes()); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		delete(s.pending, partition)
+		for _, row := range rows {
+			delete(s.pendingIDs, row.EventID)
+			s.sent.add(row.EventID)
+		}
+		s.pendingRows -= len(rows)
+	}
+	return errors.Join(errs...)
+}
+
+func (s *parquetSink) Probe(ctx context.Context) error {
+	return s.store.probe(ctx)
+}
+
+func (s *parquetSink) Close() error {
+	if s.pendingRows == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), parquetCloseTimeout)
+	defer cancel()
+	return s.flush(ctx)
+}
+
+func newResultRow(r schema.AggregationResult) resultRow {
+	row := resultRow{
+		EventID:           r.EventID,
+		FeatureName:       r.FeatureName,
+		ModelVersion:      r.ModelVersion,
+		Tenant:            r.Tenant,
+		WindowStart:       r.WindowStart,
+		WindowEnd:         r.WindowEnd,
+		Count:             r.Count,
+		NullCount:         r.NullCount,
+		NullRate:          r.NullRate,
+		MissingCount:      r.MissingCount,
+		MissingRate:       r.MissingRate,
+		TypeMismatchCount: r.TypeMismatchCount,
+		TypeMismatchRate:  r.TypeMismatchRate,
+		ZeroCount:         r.ZeroCount,
+		ZeroRate:          r.ZeroRate,
+		Mean:              r.Mean,
+		Variance:          r.Variance,
+		StdDev:            r.StdDev,
+		SampledOut:        r.SampledOut,
+		Categories:        r.Categories,
+	}
+	if r.Segment != nil {
+		row.SegmentGroupBy = r.Segment.GroupBy
+		row.SegmentGroup = r.Segment.Group
+	}
+	if r.Text != nil {
+		row.AvgLength = &r.Text.AvgLength
+		row.MaxLength = &r.Text.MaxLength
+		row.PatternMatchRate = r.Text.PatternMatchRate
+	}
+	if r.Vector != nil {
+		row.NormMean = r.Vector.NormMean
+		row.NonFiniteRate = r.Vector.NonFiniteRate
+		row.CentroidDistance = r.Vector.CentroidDistance
+	}
+	if p := r.Percentiles; p != nil {
+		row.P50, row.P95, row.P99 = &p.P50, &p.P95, &p.P99
+	}
+	return row
+}
+
+// configuredFeature returns the name of the configured feature a result belongs to,
+// without its segment or model version qualifier.
+func configuredFeature(r schema.AggregationResult) string {
+	if r.Segment != nil {
+		return r.Segment.Feature
+	}
+	if r.ModelVersion != "" {
+		return strings.TrimSuffix(r.FeatureName, "@"+r.ModelVersion)
+	}
+	return r.FeatureName
+}
+
+// randomSuffix distinguishes files written in the same second, e.g. by replicas.
+func randomSuffix() string {
+	b := make([]byte, 4)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,59 @@
+package sink
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+
+	"go.uber.org/zap"
+
+	"github.com/sanspareilsmyn/featurelens/internal/config"
+)
+
+// Prober is implemented by sinks that can check their destination is reachable
+// without delivering anything.
+type Prober interface {
+	Probe(ctx context.Context) error
+}
+
+// Probe builds each configured sink and checks that its destination is reachable. It
+// returns one error per output, nil for outputs that are reachable, or that were built
+// but whose type cannot be probed further.
+func Probe(ctx context.Context, cfgs []config.SinkConfig, logger *zap.Logger) []error {
+	errs := make([]error, len(cfgs))
+	for i, cfg := range cfgs {
+		outputs, err := Build([]config.SinkConfig{cfg}, logger)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		if prober, ok := outputs[0].Sink.(Prober); ok {
+			errs[i] = prober.Probe(ctx)
+		}
+		closeAll(outputs)
+	}
+	return errs
+}
+
+// dialURL checks that the host of an HTTP(S) URL accepts connections. Errors name the
+// host only, as webhook URLs embed credentials in their path.
+func dialURL(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("%w: not an absolute URL", ErrProbeFailed)
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		port := "443"
+		if u.Scheme == "http" {
+			port = "80"
+		}
+		addr = net.JoinHostPort(u.Hostname(), port)
+	}
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrProbeFailed, err)
+	}
+	return conn.Close()
+}
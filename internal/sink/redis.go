@@ -0,0 +1,300 @@
+package sink
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/sanspareilsmyn/featurelens/internal/params"
+	"github.com/sanspareilsmyn/featurelens/internal/schema"
+)
+
+const (
+	defaultRedisKeyPrefix = "featurelens:feature:"
+	defaultRedisTTL       = 15 * time.Minute
+	redisDialTimeout      = 5 * time.Second
+)
+
+// Values of the status field of a feature's hash.
+const (
+	redisStatusOK        = "ok"
+	redisStatusViolating = "violating"
+)
+
+// redisSink keeps the latest window statistics and alert status of each feature in a
+// Redis hash, so online serving systems can react to current feature health (e.g. fall
+// back to default values). Hashes expire after ttl without updates, so a feature
+// FeatureLens stopped seeing reads as unknown rather than healthy.
+type redisSink struct {
+	addr      string
+	useTLS    bool
+	username  string
+	password  string
+	db        int
+	keyPrefix string
+	ttl       time.Duration
+	logger    *zap.Logger
+
+	conn   net.Conn // nil until the first Send and after connection errors
+	reader *bufio.Reader
+}
+
+// newRedis creates a Redis sink.
+//
+// Params: addr (host:port, required), tls, username, passwordFile (optional), db
+// (default 0), keyPrefix (default "featurelens:feature:"; the feature name is appended),
+// ttl (default 15m; should exceed the window size).
+func newRedis(params params.Params, logger *zap.Logger) (Sink, error) {
+	addr, err := params.String("addr", "")
+	if err != nil {
+		return nil, err
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return nil, fmt.Errorf("%w: addr must be host:port: %w", ErrInvalidParams, err)
+	}
+	s := &redisSink{addr: addr, logger: logger}
+	if s.useTLS, err = params.Bool("tls", false); err != nil {
+		return nil, err
+	}
+	if s.username, err = params.String("username", ""); err != nil {
+		return nil, err
+	}
+	if ok, err := hasSecret(params, "passwordFile"); err != nil {
+		return nil, err
+	} else if ok {
+		if s.password, err = readSecret(params, "passwordFile"); err != nil {
+			return nil, err
+		}
+	}
+	if s.db, err = params.Int("db", 0); err != nil {
+		return nil, err
+	}
+	if s.keyPrefix, err = params.String("keyPrefix", defaultRedisKeyPrefix); err != nil {
+		return nil, err
+	}
+	if s.ttl, err = params.Duration("ttl", defaultRedisTTL); err != nil {
+		return nil, err
+	}
+	if s.db < 0 || s.ttl <= 0 {
+		return nil, fmt.Errorf("%w: db cannot be negative and ttl must be positive", ErrInvalidParams)
+	}
+
+	logger.Info("Redis sink configured",
+		zap.String("addr", addr),
+		zap.Int("db", s.db),
+		zap.String("key_prefix", s.keyPrefix),
+		zap.Duration("ttl", s.ttl),
+	)
+	return s, nil
+}
+
+func (s *redisSink) Send(ctx context.Context, events []Event) error {
+	var cmds [][]string
+	for _, e := range events {
+		key := s.keyPrefix + e.FeatureName
+		switch p := e.Payload.(type) {
+		case schema.AggregationResult:
+			set, unset := resultFields(p)
+			cmds = append(cmds, append([]string{"HSET", key}, set...))
+			if len(unset) > 0 {
+				cmds = append(cmds, append([]string{"HDEL", key}, unset...))
+			}
+			cmds = append(cmds, []string{"HSETNX", key, "status", redisStatusOK})
+		case schema.Violation:
+			cmds = append(cmds, []string{"HSET", key,
+				"status", redisStatusViolating,
+				"last_violation_check", p.CheckType,
+				"last_violation_window_end", p.WindowEnd.UTC().Format(time.RFC3339),
+			})
+		case schema.AlertResolved:
+			cmds = append(cmds, []string{"HSET", key, "status", redisStatusOK})
+		default:
+			continue
+		}
+		cmds = append(cmds, []string{"PEXPIRE", key, strconv.FormatInt(s.ttl.Milliseconds(), 10)})
+	}
+	if len(cmds) == 0 {
+		return nil
+	}
+
+	if err := s.pipeline(ctx, cmds); err != nil {
+		s.disconnect() // The connection state is unknown; reconnect on the next batch
+		return fmt.Errorf("%w: %w", ErrSendFailed, err)
+	}
+	return nil
+}
+
+// resultFields returns the hash fields a window result sets, and those it clears
+// because the window does not define them.
+func resultFields(r schema.AggregationResult) (set, unset []string) {
+	set = []string{
+		"window_start", r.WindowStart.UTC().Format(time.RFC3339),
+		"window_end", r.WindowEnd.UTC().Format(time.RFC3339),
+		"count", strconv.FormatInt(r.Count, 10),
+		"updated_at", time.Now().UTC().Format(time.RFC3339),
+	}
+	for _, f := range []struct {
+		name  string
+		value *float64
+	}{
+		{"null_rate", r.NullRate},
+		{"missing_rate", r.MissingRate},
+		{"zero_rate", r.ZeroRate},
+		{"mean", r.Mean},
+		{"std_dev", r.StdDev},
+	} {
+		if f.value == nil {
+			unset = append(unset, f.name)
+			continue
+		}
+		set = append(set, f.name, strconv.FormatFloat(*f.value, 'g', -1, 64))
+	}
+	return set, unset
+}
+
+// pipeline sends every command before reading their replies, failing on the first
+// error reply.
+func (s *redisSink) pipeline(ctx context.Context, cmds [][]string) error {
+	if s.conn == nil {
+		if err := s.connect(ctx); err != nil {
+			return err
+		}
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = s.conn.SetDeadline(deadline)
+	}
+	w := bufio.NewWriter(s.conn)
+	for _, cmd := range cmds {
+		writeRESP(w, cmd)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	var errs []error
+	for range cmds {
+		if err := readRESP(s.reader); err != nil {
+			var reply redisError
+			if !errors.As(err, &reply) {
+				return err // Connection failure: later replies are lost
+			}
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// connect dials the server, authenticates and selects the database.
+func (s *redisSink) connect(ctx context.Context) error {
+	dialer := &net.Dialer{Timeout: redisDialTimeout}
+	var conn net.Conn
+	var err error
+	if s.useTLS {
+		host, _, _ := net.SplitHostPort(s.addr)
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: host}}).DialContext(ctx, "tcp", s.addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", s.addr)
+	}
+	if err != nil {
+		return err
+	}
+	s.conn, s.reader = conn, bufio.NewReader(conn)
+
+	var setup [][]string
+	switch {
+	case s.password != "" && s.username != "":
+		setup = append(setup, []string{"AUTH", s.username, s.password})
+	case s.password != "":
+		setup = append(setup, []string{"AUTH", s.password})
+	}
+	if s.db != 0 {
+		setup = append(setup, []string{"SELECT", strconv.Itoa(s.db)})
+	}
+	if len(setup) > 0 {
+		if err := s.pipeline(ctx, setup); err != nil {
+			s.disconnect()
+			return err
+		}
+	}
+	s.logger.Debug("Connected to Redis", zap.String("addr", s.addr))
+	return nil
+}
+
+func (s *redisSink) disconnect() {
+	if s.conn != nil {
+		_ = s.conn.Close()
+		s.conn, s.reader = nil, nil
+	}
+}
+
+// Probe connects, authenticates and selects the database, then disconnects.
+func (s *redisSink) Probe(ctx context.Context) error {
+	if err := s.connect(ctx); err != nil {
+		return fmt.Errorf("%w: %w", ErrProbeFailed, err)
+	}
+	s.disconnect()
+	return nil
+}
+
+func (s *redisSink) Close() error {
+	s.disconnect()
+	return nil
+}
+
+// redisError is an error reply from the server.
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+// writeRESP encodes a command as a RESP array of bulk strings.
+func writeRESP(w *bufio.Writer, args []string) {
+	fmt.Fprintf(w, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+}
+
+// readRESP reads and discards one reply, returning a redisError for error replies.
+func readRESP(r *bufio.Reader) error {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if len(line) < 3 {
+		return fmt.Errorf("malformed reply %q", line)
+	}
+	body := line[1 : len(line)-2]
+	switch line[0] {
+	case '+', ':':
+		return nil
+	case '-':
+		return redisError(body)
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil || n < 0 {
+			return err // Null bulk string
+		}
+		_, err = io.CopyN(io.Discard, r, int64(n)+2)
+		return err
+	case '*':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < n; i++ {
+			if err := readRESP(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported reply type %q", line[0])
+	}
+}
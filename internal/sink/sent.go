@@ -0,0 +1,33 @@
+package sink
+
+// maxSentIDs bounds the event IDs a sink remembers having sent.
+const maxSentIDs = 10000
+
+// sentSet remembers the IDs of the events a sink most recently sent, so that sinks
+// whose destination cannot deduplicate (e.g. chat messages) do not repeat the events
+// that succeeded when a partly failed batch is retried.
+type sentSet struct {
+	ids   map[string]struct{}
+	order []string // Oldest first, for eviction
+}
+
+func newSentSet() *sentSet {
+	return &sentSet{ids: make(map[string]struct{})}
+}
+
+func (s *sentSet) has(id string) bool {
+	_, ok := s.ids[id]
+	return ok
+}
+
+func (s *sentSet) add(id string) {
+	if id == "" || s.has(id) {
+		return
+	}
+	if len(s.order) >= maxSentIDs {
+		delete(s.ids, s.order[0])
+		s.order = s.order[1:]
+	}
+	s.ids[id] = struct{}{}
+	s.order = append(s.order, id)
+}
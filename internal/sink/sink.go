@@ -0,0 +1,212 @@
+// Package sink delivers the payloads FeatureLens emits (window results, violations,
+// alert resolutions) to external systems. Sink types are pluggable: built-in types are
+// registered here and deployments register their own with Register.
+package sink
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"sync"
+	"text/template"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/sanspareilsmyn/featurelens/internal/config"
+	"github.com/sanspareilsmyn/featurelens/internal/params"
+	"github.com/sanspareilsmyn/featurelens/internal/signing"
+)
+
+// Event is a single payload emitted to sinks.
+type Event struct {
+	Kind        string // schema.KindAggregationResult, schema.KindViolation, schema.KindFeatureArchived, schema.KindAlertFiring, schema.KindAlertResolved or schema.KindInternalError
+	ID          string // Idempotency key, the payload's eventId
+	FeatureName string
+	Tenant      string   // Tenant of the feature, empty for features without one and pipeline-level events
+	Sinks       []string // Sinks a violation, alert transition or internal error was routed to, nil if no route matched
+	CheckType   string   // Check of a violation or alert transition, empty for other kinds
+	WindowEnd   time.Time
+	Payload     interface{} // Versioned schema payload, serializable as JSON
+
+	// Sealed is the signing.Envelope of a window result or violation when signing is
+	// enabled. Sinks writing payloads as JSON, like file and kafka, write it instead.
+	Sealed *signing.Envelope
+
+	// Context is what templates know of a violation or alert transition, set only while
+	// some sink has a template. Message is the payload rendered with the template of the
+	// sink receiving the event, nil if it has none.
+	Context *Context
+	Message []byte
+}
+
+// document returns what sinks writing payloads as JSON write: the sealed envelope if
+// there is one, the payload otherwise.
+func (e Event) document() interface{} {
+	if e.Sealed != nil {
+		return e.Sealed
+	}
+	return e.Payload
+}
+
+// Sink delivers batches of events. Send is never called concurrently for one sink.
+type Sink interface {
+	Send(ctx context.Context, events []Event) error
+	Close() error
+}
+
+// Factory builds a sink from its configuration parameters.
+type Factory func(params params.Params, logger *zap.Logger) (Sink, error)
+
+// Built-in sink types.
+const (
+	TypeFile         = "file"
+	TypeOpsgenie     = "opsgenie"
+	TypeVictorOps    = "victorops" // Splunk On-Call
+	TypeTeams        = "teams"     // Microsoft Teams
+	TypeDiscord      = "discord"
+	TypeAlertmanager = "alertmanager"
+	TypeKafka        = "kafka"
+	TypeParquet      = "parquet" // Parquet files on S3, GCS or a local directory
+	TypeRedis        = "redis"
+	TypeClickHouse   = "clickhouse"
+	TypeBigQuery     = "bigquery"
+	TypeDogStatsD    = "dogstatsd" // Datadog agent
+)
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Factory{
+		TypeFile:         newFile,
+		TypeOpsgenie:     newOpsgenie,
+		TypeVictorOps:    newVictorOps,
+		TypeTeams:        newTeams,
+		TypeDiscord:      newDiscord,
+		TypeAlertmanager: newAlertmanager,
+		TypeKafka:        newKafka,
+		TypeParquet:      newParquet,
+		TypeRedis:        newRedis,
+		TypeClickHouse:   newClickHouse,
+		TypeBigQuery:     newBigQuery,
+		TypeDogStatsD:    newDogStatsD,
+	}
+)
+
+// Register makes a sink type available to configuration. It is typically called from
+// an init function; registering an existing name replaces it.
+func Register(name string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[name] = factory
+}
+
+// Types returns the registered sink type names.
+func Types() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Output is a configured sink with the payload kinds, tenants, features and checks it
+// receives, and the template it renders them with.
+type Output struct {
+	Name     string
+	Sink     Sink
+	kinds    map[string]bool    // nil accepts every kind
+	tenants  map[string]bool    // nil accepts every tenant's events, and those of no tenant
+	features []string           // Globs, nil accepts every feature
+	checks   map[string]bool    // nil accepts every check
+	template *template.Template // nil if the sink renders every payload itself
+}
+
+// Accepts reports whether the output receives the event, by its kind, tenant, feature and
+// check.
+func (o Output) Accepts(e Event) bool {
+	return (o.kinds == nil || o.kinds[e.Kind]) &&
+		(o.tenants == nil || o.tenants[e.Tenant]) &&
+		(o.features == nil || matchesAny(o.features, e.FeatureName)) &&
+		(o.checks == nil || e.CheckType == "" || o.checks[e.CheckType])
+}
+
+// AcceptsAll reports whether the output receives every event.
+func (o Output) AcceptsAll() bool {
+	return o.kinds == nil && o.tenants == nil && o.features == nil && o.checks == nil
+}
+
+func matchesAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok { // Validated at config load
+			return true
+		}
+	}
+	return false
+}
+
+// Build instantiates the configured sinks. On error, sinks already built are closed.
+func Build(cfgs []config.SinkConfig, logger *zap.Logger) ([]Output, error) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	outputs := make([]Output, 0, len(cfgs))
+	for _, cfg := range cfgs {
+		name := cfg.Name
+		if name == "" {
+			name = cfg.Type
+		}
+		factory, ok := registry[cfg.Type]
+		if !ok {
+			closeAll(outputs)
+			return nil, fmt.Errorf("%w: %q", ErrUnknownType, cfg.Type)
+		}
+		s, err := factory(params.Params(cfg.Params), logger.Named(name))
+		if err != nil {
+			closeAll(outputs)
+			return nil, fmt.Errorf("%w: sink %q (%s): %w", ErrInvalidParams, name, cfg.Type, err)
+		}
+
+		out := Output{Name: name, Sink: s}
+		if out.template, err = parseTemplate(cfg, name); err != nil {
+			closeAll(append(outputs, out))
+			return nil, fmt.Errorf("%w: sink %q (%s): template: %w", ErrInvalidParams, name, cfg.Type, err)
+		}
+		if _, ok := s.(Templated); out.template != nil && !ok {
+			closeAll(append(outputs, out))
+			return nil, fmt.Errorf("%w: sink %q (%s) does not support templates", ErrInvalidParams, name, cfg.Type)
+		}
+		if len(cfg.Kinds) > 0 {
+			out.kinds = make(map[string]bool, len(cfg.Kinds))
+			for _, kind := range cfg.Kinds {
+				out.kinds[kind] = true
+			}
+		}
+		if len(cfg.Tenants) > 0 {
+			out.tenants = make(map[string]bool, len(cfg.Tenants))
+			for _, tenant := range cfg.Tenants {
+				out.tenants[tenant] = true
+			}
+		}
+		if len(cfg.Features) > 0 {
+			out.features = cfg.Features
+		}
+		if len(cfg.Checks) > 0 {
+			out.checks = make(map[string]bool, len(cfg.Checks))
+			for _, check := range cfg.Checks {
+				out.checks[check] = true
+			}
+		}
+		outputs = append(outputs, out)
+	}
+	return outputs, nil
+}
+
+func closeAll(outputs []Output) {
+	for _, out := range outputs {
+		_ = out.Sink.Close()
+	}
+}
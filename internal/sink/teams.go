@@ -0,0 +1,128 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"github.com/sanspareilsmyn/featurelens/internal/params"
+	"github.com/sanspareilsmyn/featurelens/internal/schema"
+)
+
+// Adaptive Card text colors by violation severity.
+var teamsColors = map[string]string{
+	"critical": "attention",
+	"warning":  "warning",
+	"info":     "accent",
+}
+
+// teamsSink posts violations, resolved alerts and internal errors to a Microsoft Teams
+// incoming webhook (or a Workflows webhook) as Adaptive Cards, one message per event.
+type teamsSink struct {
+	opts   chatOptions
+	sent   *sentSet
+	client *http.Client
+}
+
+// newTeams creates a Microsoft Teams sink.
+//
+// Params: webhookURLFile, dashboardURL, notifyResolved (see chatParams).
+func newTeams(params params.Params, logger *zap.Logger) (Sink, error) {
+	opts, err := chatParams(params)
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("Microsoft Teams sink configured", zap.Bool("notify_resolved", opts.notifyResolved))
+	return &teamsSink{opts: opts, sent: newSentSet(), client: &http.Client{}}, nil
+}
+
+// teamsMessage wraps an Adaptive Card as a webhook message.
+type teamsMessage struct {
+	Type        string            `json:"type"`
+	Attachments []teamsAttachment `json:"attachments"`
+}
+
+type teamsAttachment struct {
+	ContentType string    `json:"contentType"`
+	Content     teamsCard `json:"content"`
+}
+
+type teamsCard struct {
+	Schema  string                   `json:"$schema"`
+	Type    string                   `json:"type"`
+	Version string                   `json:"version"`
+	Body    []map[string]interface{} `json:"body"`
+	Actions []map[string]interface{} `json:"actions,omitempty"`
+}
+
+func (s *teamsSink) Send(ctx context.Context, events []Event) error {
+	var errs []error
+	for _, e := range events {
+		if s.sent.has(e.ID) {
+			continue // Posted by an earlier attempt of a retried batch
+		}
+		if !s.opts.posts(e) {
+			continue
+		}
+		var err error
+		switch p := e.Payload.(type) {
+		case schema.Violation:
+			color, ok := teamsColors[p.Severity]
+			if !ok {
+				color = teamsColors["warning"]
+			}
+			err = s.post(ctx, e.Message, alertSummary(p), color, violationFacts(p), p.FeatureName)
+		case schema.AlertResolved:
+			err = s.post(ctx, e.Message, resolvedSummary(p), "good", resolvedFacts(p), p.FeatureName)
+		case schema.InternalError:
+			err = s.post(ctx, nil, internalErrorSummary(p), teamsColors[internalErrorColor(p)], internalErrorFacts(p), "")
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		s.sent.add(e.ID)
+	}
+	return errors.Join(errs...)
+}
+
+// post sends an Adaptive Card, or the message rendered with the sink's template if any.
+func (s *teamsSink) post(ctx context.Context, message []byte, title, color string, facts []fact, featureName string) error {
+	if message != nil {
+		return postBody(ctx, s.client, s.opts.webhookURL, nil, message)
+	}
+	factSet := make([]map[string]string, len(facts))
+	for i, f := range facts {
+		factSet[i] = map[string]string{"title": f.Name, "value": f.Value}
+	}
+	card := teamsCard{
+		Schema:  "http://adaptivecards.io/schemas/adaptive-card.json",
+		Type:    "AdaptiveCard",
+		Version: "1.4",
+		Body: []map[string]interface{}{
+			{"type": "TextBlock", "text": title, "weight": "Bolder", "size": "Medium", "color": color, "wrap": true},
+			{"type": "FactSet", "facts": factSet},
+		},
+	}
+	if link := s.opts.dashboardLink(featureName); link != "" {
+		card.Actions = []map[string]interface{}{{"type": "Action.OpenUrl", "title": "Open dashboard", "url": link}}
+	}
+	msg := teamsMessage{
+		Type:        "message",
+		Attachments: []teamsAttachment{{ContentType: "application/vnd.microsoft.card.adaptive", Content: card}},
+	}
+	return postJSON(ctx, s.client, s.opts.webhookURL, nil, msg)
+}
+
+func (s *teamsSink) Probe(ctx context.Context) error {
+	return dialURL(ctx, s.opts.webhookURL)
+}
+
+func (s *teamsSink) Templated() {}
+
+func (s *teamsSink) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
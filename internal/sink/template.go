@@ -0,0 +1,115 @@
+package sink
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/sanspareilsmyn/featurelens/internal/config"
+	"github.com/sanspareilsmyn/featurelens/internal/schema"
+)
+
+// Templated is implemented by sinks that send an event's Message, when the event was
+// rendered with their template, in place of their own rendering of its payload. Other
+// sinks reject the template option.
+type Templated interface {
+	Templated()
+}
+
+// Context is what a template knows of a violation or alert transition besides its
+// payload.
+type Context struct {
+	Feature  config.FeatureConfig       // Configuration of the feature, or of the topic for pipeline-level checks
+	Window   *schema.AggregationResult  // Statistics of the window checked, nil for pipeline-level checks
+	Baseline *schema.AggregationResult  // The feature's last healthy window, nil if none was seen
+	History  []schema.AggregationResult // The feature's recent windows before this one, oldest first
+}
+
+// TemplateData is what sink templates are executed with, e.g.
+// "{{.Payload.FeatureName}} ({{.Feature.Team}}): null rate {{float .Window.NullRate}}".
+type TemplateData struct {
+	Kind    string      // schema.KindViolation, schema.KindAlertFiring or schema.KindAlertResolved
+	Payload interface{} // schema.Violation, schema.AlertFiring or schema.AlertResolved
+	*Context
+}
+
+// templateFuncs are the functions available to sink templates besides the built-in ones:
+// json (a value as JSON, e.g. to embed text in a JSON body), join, upper, lower, time (a
+// time as RFC 3339 in UTC) and float (a float64 or *float64 with 4 significant digits,
+// "n/a" for nil).
+var templateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	"join":  strings.Join,
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"time": func(t time.Time) string {
+		return t.UTC().Format(time.RFC3339)
+	},
+	"float": func(v interface{}) (string, error) {
+		switch f := v.(type) {
+		case float64:
+			return strconv.FormatFloat(f, 'g', 4, 64), nil
+		case *float64:
+			if f == nil {
+				return "n/a", nil
+			}
+			return strconv.FormatFloat(*f, 'g', 4, 64), nil
+		case nil:
+			return "n/a", nil
+		}
+		return "", fmt.Errorf("float: unsupported type %T", v)
+	},
+}
+
+// parseTemplate returns the template configured for a sink, nil if it has none.
+func parseTemplate(cfg config.SinkConfig, name string) (*template.Template, error) {
+	text := cfg.Template
+	if cfg.TemplateFile != "" {
+		data, err := os.ReadFile(cfg.TemplateFile)
+		if err != nil {
+			return nil, err
+		}
+		text = string(data)
+	}
+	if text == "" {
+		return nil, nil
+	}
+	return template.New(name).Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+}
+
+// Templated reports whether the output renders events with a template.
+func (o Output) Templated() bool {
+	return o.template != nil
+}
+
+// Render returns the events with the Message of each violation and alert transition
+// carrying a Context rendered with the output's template; events is not modified. Events
+// failing to render keep no Message, so the sink falls back to its own rendering, and
+// their errors are returned.
+func (o Output) Render(events []Event) ([]Event, error) {
+	rendered := make([]Event, len(events))
+	var errs []error
+	var buf bytes.Buffer
+	for i, e := range events {
+		rendered[i] = e
+		if e.Context == nil {
+			continue
+		}
+		buf.Reset()
+		if err := o.template.Execute(&buf, TemplateData{Kind: e.Kind, Payload: e.Payload, Context: e.Context}); err != nil {
+			errs = append(errs, fmt.Errorf("event %s: %w", e.ID, err))
+			continue
+		}
+		rendered[i].Message = bytes.Clone(buf.Bytes())
+	}
+	return rendered, errors.Join(errs...)
+}
@@ -0,0 +1,165 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/sanspareilsmyn/featurelens/internal/params"
+	"github.com/sanspareilsmyn/featurelens/internal/schema"
+)
+
+const defaultVictorOpsURL = "https://alert.victorops.com/integrations/generic/20131114/alert"
+
+// Splunk On-Call message types. RECOVERY resolves the incident of the same entity_id.
+const (
+	victorOpsCritical = "CRITICAL"
+	victorOpsWarning  = "WARNING"
+	victorOpsInfo     = "INFO"
+	victorOpsRecovery = "RECOVERY"
+)
+
+// defaultVictorOpsMessageTypes maps violation severities to Splunk On-Call message types.
+var defaultVictorOpsMessageTypes = map[string]string{
+	"critical": victorOpsCritical,
+	"warning":  victorOpsWarning,
+	"info":     victorOpsInfo,
+}
+
+// victorOpsSink sends violations to a Splunk On-Call (VictorOps) REST endpoint integration
+// and recovers the incident when the alert resolves. Incidents are keyed by entity_id.
+type victorOpsSink struct {
+	endpoint     string
+	messageTypes map[string]string
+	autoClose    bool
+	client       *http.Client
+}
+
+// newVictorOps creates a Splunk On-Call (VictorOps) sink.
+//
+// Params: apiKeyFile (file holding the REST endpoint integration key), routingKey
+// (required), apiURL (REST endpoint without the key, default
+// https://alert.victorops.com/integrations/generic/20131114/alert), messageTypes
+// (severity to CRITICAL, WARNING or INFO; default matches the severity), autoClose
+// (send RECOVERY on recovery, default true).
+func newVictorOps(params params.Params, logger *zap.Logger) (Sink, error) {
+	key, err := readSecret(params, "apiKeyFile")
+	if err != nil {
+		return nil, err
+	}
+	routingKey, err := params.String("routingKey", "")
+	if err != nil {
+		return nil, err
+	}
+	if routingKey == "" {
+		return nil, fmt.Errorf("%w: routingKey cannot be empty", ErrInvalidParams)
+	}
+	apiURL, err := params.String("apiURL", defaultVictorOpsURL)
+	if err != nil {
+		return nil, err
+	}
+	messageTypes, err := severityMap(params, "messageTypes", defaultVictorOpsMessageTypes)
+	if err != nil {
+		return nil, err
+	}
+	for severity, messageType := range messageTypes {
+		messageType = strings.ToUpper(messageType)
+		switch messageType {
+		case victorOpsCritical, victorOpsWarning, victorOpsInfo:
+			messageTypes[severity] = messageType
+		default:
+			return nil, fmt.Errorf("%w: messageTypes: %q for %q is not one of CRITICAL, WARNING, INFO", ErrInvalidParams, messageType, severity)
+		}
+	}
+	autoClose, err := params.Bool("autoClose", true)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("Splunk On-Call sink configured", zap.String("routing_key", routingKey), zap.Bool("auto_close", autoClose))
+	return &victorOpsSink{
+		endpoint:     strings.TrimSuffix(apiURL, "/") + "/" + url.PathEscape(key) + "/" + url.PathEscape(routingKey),
+		messageTypes: messageTypes,
+		autoClose:    autoClose,
+		client:       &http.Client{},
+	}, nil
+}
+
+// victorOpsAlert is the body of a REST endpoint integration request.
+type victorOpsAlert struct {
+	MessageType       string            `json:"message_type"`
+	EntityID          string            `json:"entity_id"`
+	EntityDisplayName string            `json:"entity_display_name,omitempty"`
+	StateMessage      string            `json:"state_message"`
+	StateStartTime    int64             `json:"state_start_time"` // Unix seconds
+	MonitoringTool    string            `json:"monitoring_tool"`
+	Details           map[string]string `json:"details,omitempty"`
+}
+
+func (s *victorOpsSink) Send(ctx context.Context, events []Event) error {
+	var errs []error
+	for _, e := range events {
+		switch p := e.Payload.(type) {
+		case schema.Violation:
+			if pages(p) {
+				errs = append(errs, s.post(ctx, e.Message, s.alert(p)))
+			}
+		case schema.AlertResolved:
+			if s.autoClose {
+				errs = append(errs, s.post(ctx, e.Message, recovery(p)))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// post sends an alert, or the message rendered with the sink's template if any.
+func (s *victorOpsSink) post(ctx context.Context, message []byte, alert victorOpsAlert) error {
+	if message != nil {
+		return postBody(ctx, s.client, s.endpoint, nil, message)
+	}
+	return postJSON(ctx, s.client, s.endpoint, nil, alert)
+}
+
+func (s *victorOpsSink) alert(v schema.Violation) victorOpsAlert {
+	messageType, ok := s.messageTypes[v.Severity]
+	if !ok {
+		messageType = victorOpsWarning
+	}
+	return victorOpsAlert{
+		MessageType:       messageType,
+		EntityID:          alertID(v.FeatureName, v.CheckType, v.Comparison),
+		EntityDisplayName: alertSummary(v),
+		StateMessage:      violationDescription(v),
+		StateStartTime:    v.DetectedAt.Unix(),
+		MonitoringTool:    alertSource,
+		Details:           violationDetails(v),
+	}
+}
+
+func recovery(r schema.AlertResolved) victorOpsAlert {
+	return victorOpsAlert{
+		MessageType:    victorOpsRecovery,
+		EntityID:       alertID(r.FeatureName, r.CheckType, r.Comparison),
+		StateMessage:   fmt.Sprintf("%s: %s recovered, window ending %s passed every check", r.FeatureName, r.CheckType, r.WindowEnd.Format(time.RFC3339)),
+		StateStartTime: r.ResolvedAt.Unix(),
+		MonitoringTool: alertSource,
+	}
+}
+
+func (s *victorOpsSink) Probe(ctx context.Context) error {
+	return dialURL(ctx, s.endpoint)
+}
+
+func (s *victorOpsSink) Templated() {}
+
+func (s *victorOpsSink) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
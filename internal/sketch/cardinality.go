@@ -0,0 +1,116 @@
+package sketch
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+	"slices"
+
+	"github.com/sanspareilsmyn/featurelens/internal/schema"
+)
+
+// Supported HyperLogLog precisions; the standard error is about 1.04 / sqrt(2^precision).
+const (
+	MinPrecision = 4
+	MaxPrecision = 18
+)
+
+// Cardinality is a HyperLogLog estimating the number of distinct values.
+type Cardinality struct {
+	precision int
+	registers []uint8
+}
+
+// NewCardinality creates an empty cardinality sketch with 2^precision registers.
+func NewCardinality(precision int) (*Cardinality, error) {
+	if precision < MinPrecision || precision > MaxPrecision {
+		return nil, fmt.Errorf("%w: precision %d", ErrInvalidParameters, precision)
+	}
+	return &Cardinality{precision: precision, registers: make([]uint8, 1<<precision)}, nil
+}
+
+// Add counts a value.
+func (c *Cardinality) Add(value string) {
+	h := hash(value)
+	register := h >> (64 - c.precision)
+	rank := uint8(bits.LeadingZeros64(h<<c.precision|1<<(c.precision-1)) + 1)
+	if rank > c.registers[register] {
+		c.registers[register] = rank
+	}
+}
+
+// Size returns the approximate memory held by the sketch, in bytes.
+func (c *Cardinality) Size() int {
+	return len(c.registers) + 32
+}
+
+// Estimate returns the approximate number of distinct values added.
+func (c *Cardinality) Estimate() uint64 {
+	m := float64(len(c.registers))
+	var sum float64
+	zeros := 0
+	for _, r := range c.registers {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+	estimate := alpha(len(c.registers)) * m * m / sum
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros)) // Linear counting for small cardinalities
+	}
+	return uint64(estimate + 0.5)
+}
+
+// alpha is the HyperLogLog bias correction constant for m registers.
+func alpha(m int) float64 {
+	switch m {
+	case 16:
+		return 0.673
+	case 32:
+		return 0.697
+	case 64:
+		return 0.709
+	}
+	return 0.7213 / (1 + 1.079/float64(m))
+}
+
+// Merge takes the register-wise maximum with another sketch of the same precision.
+func (c *Cardinality) Merge(other *Cardinality) error {
+	if other.precision != c.precision {
+		return fmt.Errorf("%w: precision %d and %d", ErrIncompatible, c.precision, other.precision)
+	}
+	for i, r := range other.registers {
+		if r > c.registers[i] {
+			c.registers[i] = r
+		}
+	}
+	return nil
+}
+
+// Clone returns an independent copy of the sketch.
+func (c *Cardinality) Clone() *Cardinality {
+	return &Cardinality{precision: c.precision, registers: slices.Clone(c.registers)}
+}
+
+// Payload converts the sketch into its versioned public representation.
+func (c *Cardinality) Payload() *schema.CardinalitySketch {
+	return &schema.CardinalitySketch{
+		Precision: c.precision,
+		Registers: append([]byte(nil), c.registers...),
+		Estimate:  c.Estimate(),
+	}
+}
+
+// CardinalityFromPayload restores a sketch from its public representation.
+func CardinalityFromPayload(p *schema.CardinalitySketch) (*Cardinality, error) {
+	c, err := NewCardinality(p.Precision)
+	if err != nil {
+		return nil, err
+	}
+	if len(p.Registers) != len(c.registers) {
+		return nil, fmt.Errorf("%w: %d registers for precision %d", ErrInvalidParameters, len(p.Registers), p.Precision)
+	}
+	copy(c.registers, p.Registers)
+	return c, nil
+}
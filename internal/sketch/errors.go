@@ -0,0 +1,8 @@
+package sketch
+
+import "errors"
+
+var (
+	ErrInvalidParameters = errors.New("invalid sketch parameters")
+	ErrIncompatible      = errors.New("sketches have different parameters and cannot be merged")
+)
@@ -0,0 +1,99 @@
+package sketch
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/sanspareilsmyn/featurelens/internal/schema"
+)
+
+// Frequency is a count-min sketch. Estimates never undercount; they overcount by at
+// most e/width of the total with probability 1 - e^-depth.
+type Frequency struct {
+	width, depth int
+	counters     []uint64 // depth rows of width counters
+	total        uint64
+}
+
+// NewFrequency creates an empty count-min sketch.
+func NewFrequency(width, depth int) (*Frequency, error) {
+	if width < 1 || depth < 1 {
+		return nil, fmt.Errorf("%w: width %d, depth %d", ErrInvalidParameters, width, depth)
+	}
+	return &Frequency{width: width, depth: depth, counters: make([]uint64, width*depth)}, nil
+}
+
+// Add counts n occurrences of a value.
+func (f *Frequency) Add(value string, n uint64) {
+	h := hash(value)
+	for row := 0; row < f.depth; row++ {
+		f.counters[row*f.width+f.column(h, row)] += n
+	}
+	f.total += n
+}
+
+// column derives a row's counter from two halves of the hash (Kirsch-Mitzenmacher).
+func (f *Frequency) column(h uint64, row int) int {
+	h1, h2 := h&0xffffffff, h>>32
+	return int((h1 + uint64(row)*h2) % uint64(f.width))
+}
+
+// Estimate returns the approximate number of occurrences of a value.
+func (f *Frequency) Estimate(value string) uint64 {
+	h := hash(value)
+	estimate := f.total
+	for row := 0; row < f.depth; row++ {
+		if n := f.counters[row*f.width+f.column(h, row)]; n < estimate {
+			estimate = n
+		}
+	}
+	return estimate
+}
+
+// Merge adds the counters of another sketch with the same dimensions.
+func (f *Frequency) Merge(other *Frequency) error {
+	if other.width != f.width || other.depth != f.depth {
+		return fmt.Errorf("%w: %dx%d and %dx%d", ErrIncompatible, f.depth, f.width, other.depth, other.width)
+	}
+	for i, n := range other.counters {
+		f.counters[i] += n
+	}
+	f.total += other.total
+	return nil
+}
+
+// Clone returns an independent copy of the sketch.
+func (f *Frequency) Clone() *Frequency {
+	c := *f
+	c.counters = slices.Clone(f.counters)
+	return &c
+}
+
+// Size returns the approximate memory held by the sketch, in bytes.
+func (f *Frequency) Size() int {
+	return 8*len(f.counters) + 48
+}
+
+// Payload converts the sketch into its versioned public representation.
+func (f *Frequency) Payload() *schema.FrequencySketch {
+	return &schema.FrequencySketch{
+		Width:    f.width,
+		Depth:    f.depth,
+		Counters: append([]uint64(nil), f.counters...),
+		Total:    f.total,
+	}
+}
+
+// FrequencyFromPayload restores a sketch from its public representation.
+func FrequencyFromPayload(p *schema.FrequencySketch) (*Frequency, error) {
+	f, err := NewFrequency(p.Width, p.Depth)
+	if err != nil {
+		return nil, err
+	}
+	if len(p.Counters) != len(f.counters) {
+		return nil, fmt.Errorf("%w: %d counters for %dx%d", ErrInvalidParameters, len(p.Counters), p.Depth, p.Width)
+	}
+	copy(f.counters, p.Counters)
+	f.total = p.Total
+	return f, nil
+}
@@ -0,0 +1,35 @@
+package sketch
+
+import (
+	"hash/fnv"
+	"sort"
+)
+
+// hash maps a value to 64 bits: FNV-1a followed by the murmur3 finalizer, which fixes
+// FNV's weak avalanche in the high bits HyperLogLog relies on. Jobs adding values to
+// exported sketches must use the same function.
+func hash(value string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(value))
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
+
+// sortedKeys returns the bin indexes of a store in ascending or descending order.
+func sortedKeys(bins map[int]uint64, descending bool) []int {
+	keys := make([]int, 0, len(bins))
+	for k := range bins {
+		keys = append(keys, k)
+	}
+	if descending {
+		sort.Sort(sort.Reverse(sort.IntSlice(keys)))
+	} else {
+		sort.Ints(keys)
+	}
+	return keys
+}
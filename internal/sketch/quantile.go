@@ -0,0 +1,216 @@
+// Package sketch implements the mergeable summaries exported with window results:
+// a DDSketch for quantiles, HyperLogLog for cardinality and count-min for frequencies.
+// Each sketch converts to and from its versioned schema representation so offline jobs
+// can merge windows into arbitrary time ranges.
+package sketch
+
+import (
+	"fmt"
+	"maps"
+	"math"
+
+	"github.com/sanspareilsmyn/featurelens/internal/schema"
+)
+
+// minIndexable is the smallest magnitude given its own bin; smaller values count as zero.
+const minIndexable = 1e-9
+
+// Quantile is a DDSketch with a fixed relative accuracy.
+type Quantile struct {
+	accuracy  float64
+	logGamma  float64
+	zeroCount uint64
+	positive  map[int]uint64
+	negative  map[int]uint64 // Keyed by the bin of the value's magnitude
+	count     uint64
+	min, max  float64
+}
+
+// NewQuantile creates an empty quantile sketch. relativeAccuracy must be in (0, 1).
+func NewQuantile(relativeAccuracy float64) (*Quantile, error) {
+	if relativeAccuracy <= 0 || relativeAccuracy >= 1 {
+		return nil, fmt.Errorf("%w: relative accuracy %v", ErrInvalidParameters, relativeAccuracy)
+	}
+	gamma := (1 + relativeAccuracy) / (1 - relativeAccuracy)
+	return &Quantile{
+		accuracy: relativeAccuracy,
+		logGamma: math.Log(gamma),
+		positive: make(map[int]uint64),
+		negative: make(map[int]uint64),
+		min:      math.Inf(1),
+		max:      math.Inf(-1),
+	}, nil
+}
+
+// Add counts a value. NaN and infinite values are ignored.
+func (q *Quantile) Add(v float64) {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return
+	}
+	switch {
+	case v > minIndexable:
+		q.positive[q.index(v)]++
+	case v < -minIndexable:
+		q.negative[q.index(-v)]++
+	default:
+		q.zeroCount++
+	}
+	q.count++
+	q.min = math.Min(q.min, v)
+	q.max = math.Max(q.max, v)
+}
+
+// index returns the bin of a positive magnitude.
+func (q *Quantile) index(magnitude float64) int {
+	return int(math.Ceil(math.Log(magnitude) / q.logGamma))
+}
+
+// value returns the representative magnitude of a bin, within the relative accuracy
+// of every magnitude it covers.
+func (q *Quantile) value(index int) float64 {
+	return 2 * math.Exp(float64(index)*q.logGamma) / (1 + math.Exp(q.logGamma))
+}
+
+// Count returns the number of values added.
+func (q *Quantile) Count() uint64 {
+	return q.count
+}
+
+// Size returns the approximate memory held by the sketch, in bytes: its bins dominate.
+func (q *Quantile) Size() int {
+	const binBytes = 32 // Key, count and map overhead
+	return binBytes*(len(q.positive)+len(q.negative)) + 80
+}
+
+// Quantile returns the approximate value at quantile p in [0, 1], or NaN when empty.
+func (q *Quantile) Quantile(p float64) float64 {
+	if q.count == 0 || p < 0 || p > 1 {
+		return math.NaN()
+	}
+	rank := uint64(p * float64(q.count-1))
+
+	var seen uint64
+	for _, i := range sortedKeys(q.negative, true) {
+		seen += q.negative[i]
+		if seen > rank {
+			return q.clamp(-q.value(i))
+		}
+	}
+	seen += q.zeroCount
+	if seen > rank {
+		return 0
+	}
+	for _, i := range sortedKeys(q.positive, false) {
+		seen += q.positive[i]
+		if seen > rank {
+			return q.clamp(q.value(i))
+		}
+	}
+	return q.max
+}
+
+// CountOutside returns the approximate number of values below lo or above hi: those
+// whose bin representative lies outside, within the relative accuracy.
+func (q *Quantile) CountOutside(lo, hi float64) uint64 {
+	var n uint64
+	outside := func(v float64) bool { return v < lo || v > hi }
+	for i, c := range q.negative {
+		if outside(q.clamp(-q.value(i))) {
+			n += c
+		}
+	}
+	if outside(0) {
+		n += q.zeroCount
+	}
+	for i, c := range q.positive {
+		if outside(q.clamp(q.value(i))) {
+			n += c
+		}
+	}
+	return n
+}
+
+// clamp keeps bin representatives within the observed range.
+func (q *Quantile) clamp(v float64) float64 {
+	return math.Max(q.min, math.Min(q.max, v))
+}
+
+// Merge adds the counts of another sketch with the same relative accuracy.
+func (q *Quantile) Merge(other *Quantile) error {
+	if other.accuracy != q.accuracy {
+		return fmt.Errorf("%w: relative accuracy %v and %v", ErrIncompatible, q.accuracy, other.accuracy)
+	}
+	for i, n := range other.positive {
+		q.positive[i] += n
+	}
+	for i, n := range other.negative {
+		q.negative[i] += n
+	}
+	q.zeroCount += other.zeroCount
+	q.count += other.count
+	q.min = math.Min(q.min, other.min)
+	q.max = math.Max(q.max, other.max)
+	return nil
+}
+
+// Clone returns an independent copy of the sketch.
+func (q *Quantile) Clone() *Quantile {
+	c := *q
+	c.positive = maps.Clone(q.positive)
+	c.negative = maps.Clone(q.negative)
+	return &c
+}
+
+// Payload converts the sketch into its versioned public representation.
+func (q *Quantile) Payload() *schema.QuantileSketch {
+	p := &schema.QuantileSketch{
+		RelativeAccuracy: q.accuracy,
+		ZeroCount:        q.zeroCount,
+		Positive:         denseBins(q.positive),
+		Negative:         denseBins(q.negative),
+	}
+	if q.count > 0 {
+		p.Min, p.Max = q.min, q.max
+	}
+	return p
+}
+
+// QuantileFromPayload restores a sketch from its public representation.
+func QuantileFromPayload(p *schema.QuantileSketch) (*Quantile, error) {
+	q, err := NewQuantile(p.RelativeAccuracy)
+	if err != nil {
+		return nil, err
+	}
+	q.zeroCount = p.ZeroCount
+	q.count = p.ZeroCount
+	for k, n := range p.Positive.Counts {
+		if n > 0 {
+			q.positive[p.Positive.Offset+k] = n
+			q.count += n
+		}
+	}
+	for k, n := range p.Negative.Counts {
+		if n > 0 {
+			q.negative[p.Negative.Offset+k] = n
+			q.count += n
+		}
+	}
+	if q.count > 0 {
+		q.min, q.max = p.Min, p.Max
+	}
+	return q, nil
+}
+
+// denseBins lays sparse bins out contiguously from the lowest index.
+func denseBins(bins map[int]uint64) schema.SketchBins {
+	if len(bins) == 0 {
+		return schema.SketchBins{Counts: []uint64{}}
+	}
+	keys := sortedKeys(bins, false)
+	lo, hi := keys[0], keys[len(keys)-1]
+	counts := make([]uint64, hi-lo+1)
+	for i, n := range bins {
+		counts[i-lo] = n
+	}
+	return schema.SketchBins{Offset: lo, Counts: counts}
+}
@@ -0,0 +1,9 @@
+package store
+
+import "errors"
+
+var (
+	ErrOpenFailed    = errors.New("failed to open results store")
+	ErrAppendFailed  = errors.New("failed to append to results store")
+	ErrCompactFailed = errors.New("failed to compact results store")
+)
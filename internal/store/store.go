@@ -0,0 +1,293 @@
+// Package store keeps the results FeatureLens computed for each window, with the
+// violations they raised, so that past states can be reconstructed after the fact.
+package store
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/sanspareilsmyn/featurelens/internal/schema"
+)
+
+// maxLineBytes bounds a single stored record, which is dominated by its categories.
+const maxLineBytes = 16 << 20
+
+// Record is everything FeatureLens saw for one feature in one window. An archive record
+// marks the end of a feature's monitoring: its result is empty and ends when the feature
+// was archived, so it is the feature's latest state from then on.
+type Record struct {
+	Result     schema.AggregationResult `json:"result"`
+	Violations []schema.Violation       `json:"violations,omitempty"`
+	Archived   *schema.FeatureArchived  `json:"archived,omitempty"`
+}
+
+// Store holds records for the configured retention, optionally appending them to a
+// JSON lines file that is reloaded on startup.
+type Store struct {
+	mu        sync.RWMutex
+	records   map[string][]Record // Per feature, ordered by window end
+	retention time.Duration
+	path      string
+	file      *os.File // nil for in-memory stores
+	expired   int      // Records dropped since the file was last compacted
+	stored    int
+	logger    *zap.Logger
+}
+
+// Open loads the records of path that are still within retention and keeps appending
+// to it. An empty path creates an in-memory store.
+func Open(path string, retention time.Duration, logger *zap.Logger) (*Store, error) {
+	s := &Store{
+		records:   make(map[string][]Record),
+		retention: retention,
+		path:      path,
+		logger:    logger,
+	}
+	if path == "" {
+		return s, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrOpenFailed, err)
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	if err := s.compact(); err != nil {
+		return nil, err
+	}
+	logger.Info("Results store opened",
+		zap.String("path", path),
+		zap.Int("records", s.stored),
+		zap.Duration("retention", retention),
+	)
+	return s, nil
+}
+
+// load reads the existing file, skipping expired and malformed records.
+func (s *Store) load() error {
+	f, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrOpenFailed, err)
+	}
+	defer f.Close()
+
+	cutoff := time.Now().Add(-s.retention)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineBytes)
+	for line := 1; scanner.Scan(); line++ {
+		var r Record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			s.logger.Warn("Skipping malformed stored record", zap.Int("line", line), zap.Error(err))
+			continue
+		}
+		if r.Result.WindowEnd.Before(cutoff) {
+			continue
+		}
+		s.insert(r)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("%w: %w", ErrOpenFailed, err)
+	}
+	return nil
+}
+
+// compact rewrites the file with the retained records and reopens it for appending.
+// Callers other than Open must hold the write lock.
+func (s *Store) compact() error {
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrCompactFailed, err)
+	}
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	for _, records := range s.records {
+		for _, r := range records {
+			if err := enc.Encode(r); err != nil {
+				tmp.Close()
+				os.Remove(tmp.Name())
+				return fmt.Errorf("%w: %w", ErrCompactFailed, err)
+			}
+		}
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("%w: %w", ErrCompactFailed, err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("%w: %w", ErrCompactFailed, err)
+	}
+
+	if s.file != nil {
+		s.file.Close()
+		s.file = nil
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("%w: %w", ErrCompactFailed, err)
+	}
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrCompactFailed, err)
+	}
+	s.file = f
+	s.expired = 0
+	return nil
+}
+
+// Append stores a record, dropping records that fell out of retention. The file is
+// compacted once it holds more expired records than retained ones.
+func (s *Store) Append(r Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.insert(r)
+	s.expire(time.Now().Add(-s.retention))
+	if s.file == nil {
+		return nil
+	}
+
+	line, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrAppendFailed, err)
+	}
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("%w: %w", ErrAppendFailed, err)
+	}
+	if s.expired > s.stored {
+		return s.compact()
+	}
+	return nil
+}
+
+// Archive appends an archive record for the feature. Its earlier records are kept
+// until they fall out of retention.
+func (s *Store) Archive(a schema.FeatureArchived) error {
+	return s.Append(Record{
+		Result: schema.AggregationResult{
+			SchemaVersion: a.SchemaVersion,
+			Kind:          schema.KindAggregationResult,
+			FeatureName:   a.FeatureName,
+			WindowStart:   a.ArchivedAt,
+			WindowEnd:     a.ArchivedAt,
+		},
+		Archived: &a,
+	})
+}
+
+// insert adds a record in window order; results usually arrive in order, so this is an append.
+func (s *Store) insert(r Record) {
+	records := s.records[r.Result.FeatureName]
+	i := sort.Search(len(records), func(i int) bool {
+		return records[i].Result.WindowEnd.After(r.Result.WindowEnd)
+	})
+	records = append(records, Record{})
+	copy(records[i+1:], records[i:])
+	records[i] = r
+	s.records[r.Result.FeatureName] = records
+	s.stored++
+}
+
+// expire drops records whose window ended before cutoff.
+func (s *Store) expire(cutoff time.Time) {
+	for name, records := range s.records {
+		n := sort.Search(len(records), func(i int) bool {
+			return !records[i].Result.WindowEnd.Before(cutoff)
+		})
+		if n == 0 {
+			continue
+		}
+		if n == len(records) {
+			delete(s.records, name)
+		} else {
+			s.records[name] = append([]Record(nil), records[n:]...)
+		}
+		s.stored -= n
+		s.expired += n
+	}
+}
+
+// Snapshot returns, for every feature, the latest record whose window ended at or
+// before t, ordered by feature name. This is the state FeatureLens showed at time t.
+func (s *Store) Snapshot(t time.Time) []Record {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var snapshot []Record
+	for _, records := range s.records {
+		i := sort.Search(len(records), func(i int) bool {
+			return records[i].Result.WindowEnd.After(t)
+		})
+		if i > 0 {
+			snapshot = append(snapshot, records[i-1])
+		}
+	}
+	sort.Slice(snapshot, func(i, j int) bool {
+		return snapshot[i].Result.FeatureName < snapshot[j].Result.FeatureName
+	})
+	return snapshot
+}
+
+// History returns a feature's records whose window ended within [from, to].
+func (s *Store) History(featureName string, from, to time.Time) []Record {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	records := s.records[featureName]
+	lo := sort.Search(len(records), func(i int) bool {
+		return !records[i].Result.WindowEnd.Before(from)
+	})
+	hi := sort.Search(len(records), func(i int) bool {
+		return records[i].Result.WindowEnd.After(to)
+	})
+	if lo >= hi {
+		return nil
+	}
+	return append([]Record(nil), records[lo:hi]...)
+}
+
+// Bounds returns the earliest and latest window ends held by the store.
+func (s *Store) Bounds() (first, last time.Time, ok bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, records := range s.records {
+		if len(records) == 0 {
+			continue
+		}
+		if start := records[0].Result.WindowEnd; !ok || start.Before(first) {
+			first = start
+		}
+		if end := records[len(records)-1].Result.WindowEnd; !ok || end.After(last) {
+			last = end
+		}
+		ok = true
+	}
+	return first, last, ok
+}
+
+// Close closes the backing file, if any.
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
@@ -0,0 +1,7 @@
+package telemetry
+
+import "errors"
+
+var (
+	ErrSetupFailed = errors.New("failed to set up OpenTelemetry")
+)
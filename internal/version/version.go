@@ -0,0 +1,84 @@
+// Package version reports the build metadata of the binary. Release builds set it with
+// linker flags:
+//
+//	go build -ldflags "-X github.com/sanspareilsmyn/featurelens/internal/version.version=v1.2.0 \
+//	  -X github.com/sanspareilsmyn/featurelens/internal/version.commit=$(git rev-parse HEAD) \
+//	  -X github.com/sanspareilsmyn/featurelens/internal/version.date=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// Other builds fall back to the module version and VCS metadata the Go toolchain embeds.
+package version
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// Set by the linker for release builds.
+var (
+	version string
+	commit  string
+	date    string
+)
+
+// Info is the build metadata of the binary.
+type Info struct {
+	Version   string `json:"version"`            // e.g. v1.2.0, or "devel"
+	Commit    string `json:"commit,omitempty"`   // VCS revision
+	Date      string `json:"date,omitempty"`     // Build or commit time, RFC 3339
+	Modified  bool   `json:"modified,omitempty"` // Built from a working tree with uncommitted changes
+	GoVersion string `json:"goVersion"`          // Toolchain, e.g. go1.22.5
+	Platform  string `json:"platform"`           // GOOS/GOARCH, e.g. linux/arm64
+	CGO       bool   `json:"cgo"`                // Built with cgo; release builds are static pure-Go binaries
+}
+
+// Get returns the build metadata of the running binary.
+func Get() Info {
+	info := Info{
+		Version:   version,
+		Commit:    commit,
+		Date:      date,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+	if build, ok := debug.ReadBuildInfo(); ok {
+		if info.Version == "" && build.Main.Version != "" && build.Main.Version != "(devel)" {
+			info.Version = build.Main.Version
+		}
+		for _, s := range build.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = s.Value
+				}
+			case "vcs.time":
+				if info.Date == "" {
+					info.Date = s.Value
+				}
+			case "vcs.modified":
+				info.Modified = s.Value == "true" && commit == ""
+			case "CGO_ENABLED":
+				info.CGO = s.Value == "1"
+			}
+		}
+	}
+	if info.Version == "" {
+		info.Version = "devel"
+	}
+	return info
+}
+
+// String formats the version for logs, e.g. "v1.2.0 (3f2c1a9, linux/arm64)".
+func (i Info) String() string {
+	s := i.Version + " ("
+	if i.Commit != "" {
+		c := i.Commit
+		if len(c) > 12 {
+			c = c[:12]
+		}
+		if i.Modified {
+			c += "-dirty"
+		}
+		s += c + ", "
+	}
+	return s + i.Platform + ")"
+}
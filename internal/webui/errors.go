@@ -0,0 +1,8 @@
+package webui
+
+import "errors"
+
+var (
+	ErrInvalidTime    = errors.New("time must be an RFC 3339 timestamp")
+	ErrMissingFeature = errors.New("feature parameter is required")
+)
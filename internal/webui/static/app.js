@@ -0,0 +1,220 @@
+// Time-travel view: the slider selects a window end, and the table shows every
+// feature's statistics and alert state as FeatureLens saw them at that moment.
+(function () {
+  "use strict";
+
+  const slider = document.getElementById("slider");
+  const atOutput = document.getElementById("at");
+  const tbody = document.querySelector("#features tbody");
+  const detail = document.getElementById("detail");
+
+  let first = 0; // Earliest stored window end, epoch milliseconds
+  let stepMs = 60000;
+  let live = true;
+  let selected = null;
+  let states = [];
+
+  async function getJSON(path) {
+    const resp = await fetch(path);
+    if (!resp.ok) {
+      throw new Error(path + ": " + resp.status);
+    }
+    return resp.json();
+  }
+
+  function currentTime() {
+    return new Date(first + Number(slider.value) * stepMs);
+  }
+
+  function fmt(v, digits) {
+    return v === null || v === undefined ? "–" : Number(v).toFixed(digits);
+  }
+
+  function severityOf(state) {
+    if (state.archived) {
+      return "archived";
+    }
+    if (!state.alerting) {
+      return "ok";
+    }
+    const order = ["info", "warning", "critical"];
+    return state.violations.reduce(function (worst, v) {
+      return order.indexOf(v.severity) > order.indexOf(worst) ? v.severity : worst;
+    }, "info");
+  }
+
+  async function refreshBounds() {
+    const bounds = await getJSON("api/bounds");
+    document.getElementById("empty").hidden = !bounds.empty;
+    if (bounds.empty) {
+      slider.disabled = true;
+      return;
+    }
+    stepMs = bounds.windowSeconds * 1000;
+    document.getElementById("window-size").textContent = "window " + bounds.windowSeconds + "s";
+    first = Date.parse(bounds.first);
+    const steps = Math.round((Date.parse(bounds.last) - first) / stepMs);
+    slider.max = steps;
+    slider.disabled = false;
+    if (live) {
+      slider.value = steps;
+    }
+  }
+
+  async function render() {
+    const at = currentTime();
+    atOutput.textContent = at.toISOString() + (live ? " (live)" : "");
+    const snapshot = await getJSON("api/snapshot?at=" + encodeURIComponent(at.toISOString()));
+    states = snapshot.features;
+
+    tbody.replaceChildren();
+    for (const state of states) {
+      const r = state.result;
+      const row = tbody.insertRow();
+      row.className = (state.stale ? "stale " : "") + (r.featureName === selected ? "selected" : "");
+      row.insertCell().textContent = r.featureName;
+      const cell = row.insertCell();
+      cell.className = "state";
+      const badge = document.createElement("span");
+      const severity = severityOf(state);
+      badge.className = "badge " + severity;
+      badge.textContent = severity === "ok" || severity === "archived" ? severity : severity + " (" + state.violations.length + ")";
+      if (state.archived) {
+        badge.title = "Monitoring stopped: " + state.archived.reason + " (last window " + state.archived.lastWindowEnd + ")";
+      }
+      cell.appendChild(badge);
+      row.insertCell().textContent = new Date(r.windowEnd).toISOString().substring(11, 19);
+      row.insertCell().textContent = r.count;
+      row.insertCell().textContent = fmt(r.nullRate, 3);
+      row.insertCell().textContent = fmt(r.missingRate, 3);
+      row.insertCell().textContent = fmt(r.mean, 3);
+      row.insertCell().textContent = fmt(r.stdDev, 3);
+      row.insertCell().textContent = r.categories ? Object.keys(r.categories).length : "–";
+      row.addEventListener("click", function () {
+        selected = r.featureName;
+        render();
+      });
+    }
+    await renderDetail(at);
+  }
+
+  async function renderDetail(at) {
+    const state = states.find(function (s) { return s.result.featureName === selected; });
+    detail.hidden = !state;
+    if (!state) {
+      return;
+    }
+    document.getElementById("detail-name").textContent = selected;
+
+    const history = await getJSON("api/history?feature=" + encodeURIComponent(selected) +
+      "&to=" + encodeURIComponent(at.toISOString()));
+    renderHistory(history.records);
+    renderDistribution(state.result.categories);
+
+    const list = document.getElementById("violations");
+    list.replaceChildren();
+    for (const v of state.violations || []) {
+      const item = document.createElement("li");
+      item.textContent = v.severity + ": " + v.checkType + " " + v.comparison + " " +
+        (v.expression || fmt(v.threshold, 3)) + " (actual " + fmt(v.actual, 3) + ")";
+      list.appendChild(item);
+    }
+    if (!list.children.length) {
+      list.innerHTML = "<li>none</li>";
+    }
+  }
+
+  function renderHistory(records) {
+    const svg = document.getElementById("history-chart");
+    svg.replaceChildren();
+    const points = records.filter(function (r) { return r.result.mean !== null; });
+    if (points.length < 2) {
+      return;
+    }
+    const means = points.map(function (r) { return r.result.mean; });
+    const lo = Math.min.apply(null, means);
+    const hi = Math.max.apply(null, means);
+    const x = function (i) { return (i / (points.length - 1)) * 600; };
+    const y = function (v) { return hi === lo ? 80 : 150 - ((v - lo) / (hi - lo)) * 140; };
+
+    const ns = "http://www.w3.org/2000/svg";
+    const line = document.createElementNS(ns, "polyline");
+    line.setAttribute("fill", "none");
+    line.setAttribute("stroke", "#0969da");
+    line.setAttribute("stroke-width", "2");
+    line.setAttribute("points", points.map(function (r, i) { return x(i) + "," + y(r.result.mean); }).join(" "));
+    svg.appendChild(line);
+
+    points.forEach(function (r, i) {
+      if (r.violations && r.violations.length) {
+        const dot = document.createElementNS(ns, "circle");
+        dot.setAttribute("cx", x(i));
+        dot.setAttribute("cy", y(r.result.mean));
+        dot.setAttribute("r", "4");
+        dot.setAttribute("fill", "#cf222e");
+        svg.appendChild(dot);
+      }
+    });
+  }
+
+  function renderDistribution(categories) {
+    const container = document.getElementById("distribution");
+    container.replaceChildren();
+    if (!categories) {
+      container.textContent = "Numerical feature: see mean and standard deviation above.";
+      return;
+    }
+    const entries = Object.entries(categories).sort(function (a, b) { return b[1] - a[1]; }).slice(0, 15);
+    const max = entries.length ? entries[0][1] : 1;
+    for (const [value, count] of entries) {
+      const bar = document.createElement("div");
+      bar.className = "bar";
+      const label = document.createElement("span");
+      label.textContent = value;
+      label.title = value;
+      const fill = document.createElement("span");
+      fill.className = "fill";
+      fill.style.width = (count / max) * 12 + "rem";
+      const n = document.createElement("span");
+      n.textContent = count;
+      bar.append(label, fill, n);
+      container.appendChild(bar);
+    }
+  }
+
+  function step(delta) {
+    slider.value = Math.min(Math.max(Number(slider.value) + delta, 0), Number(slider.max));
+    live = slider.value === slider.max;
+    render();
+  }
+
+  slider.addEventListener("input", function () {
+    live = slider.value === slider.max;
+    render();
+  });
+  document.getElementById("step-back").addEventListener("click", function () { step(-1); });
+  document.getElementById("step-forward").addEventListener("click", function () { step(1); });
+  document.getElementById("live").addEventListener("click", function () {
+    live = true;
+    slider.value = slider.max;
+    render();
+  });
+
+  async function tick() {
+    try {
+      await refreshBounds();
+      if (!slider.disabled) {
+        await render();
+      }
+    } catch (err) {
+      atOutput.textContent = String(err);
+    }
+  }
+
+  tick();
+  setInterval(function () {
+    if (live) {
+      tick();
+    }
+  }, 15000);
+})();
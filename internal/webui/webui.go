@@ -0,0 +1,137 @@
+// Package webui serves the FeatureLens web UI and the JSON endpoints behind it.
+package webui
+
+import (
+	"embed"
+	"encoding/json"
+	"io/fs"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/sanspareilsmyn/featurelens/internal/store"
+)
+
+// Prefix is the path under which the web UI is mounted.
+const Prefix = "/ui/"
+
+// defaultHistoryWindows is how many windows of history are returned around a point in
+// time when the request does not give an explicit range.
+const defaultHistoryWindows = 60
+
+//go:embed static
+var staticFS embed.FS
+
+// UI reconstructs what FeatureLens saw at any past point from the results store.
+type UI struct {
+	results    *store.Store
+	windowSize time.Duration
+	logger     *zap.Logger
+}
+
+// NewUI creates the web UI over the results store.
+func NewUI(results *store.Store, windowSize time.Duration, logger *zap.Logger) *UI {
+	return &UI{results: results, windowSize: windowSize, logger: logger}
+}
+
+// Handler returns the routes of the web UI:
+//
+//	GET /ui/                                          time-travel view
+//	GET /ui/api/bounds                                earliest and latest stored windows
+//	GET /ui/api/snapshot?at=2024-05-01T12:00:00Z      every feature's state at a point in time
+//	GET /ui/api/history?feature=price&from=...&to=... a feature's windows over a range
+func (u *UI) Handler() http.Handler {
+	static, _ := fs.Sub(staticFS, "static")
+	mux := http.NewServeMux()
+	mux.Handle("GET "+Prefix, http.StripPrefix(Prefix, http.FileServer(http.FS(static))))
+	mux.HandleFunc("GET "+Prefix+"api/bounds", u.bounds)
+	mux.HandleFunc("GET "+Prefix+"api/snapshot", u.snapshot)
+	mux.HandleFunc("GET "+Prefix+"api/history", u.history)
+	return mux
+}
+
+func (u *UI) bounds(w http.ResponseWriter, _ *http.Request) {
+	first, last, ok := u.results.Bounds()
+	body := map[string]interface{}{"windowSeconds": u.windowSize.Seconds(), "empty": !ok}
+	if ok {
+		body["first"] = first
+		body["last"] = last
+	}
+	u.writeJSON(w, http.StatusOK, body)
+}
+
+// featureState is a feature's stored window as of a point in time.
+type featureState struct {
+	store.Record
+	Alerting bool `json:"alerting"` // The window raised at least one violation
+	Stale    bool `json:"stale"`    // No window ended within one window size of the point in time
+}
+
+func (u *UI) snapshot(w http.ResponseWriter, r *http.Request) {
+	at, err := parseTime(r.URL.Query().Get("at"), time.Now())
+	if err != nil {
+		u.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	records := u.results.Snapshot(at)
+	states := make([]featureState, len(records))
+	for i, record := range records {
+		states[i] = featureState{
+			Record:   record,
+			Alerting: len(record.Violations) > 0,
+			Stale:    record.Archived == nil && at.Sub(record.Result.WindowEnd) > u.windowSize,
+		}
+	}
+	u.writeJSON(w, http.StatusOK, map[string]interface{}{"at": at, "features": states})
+}
+
+func (u *UI) history(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	feature := query.Get("feature")
+	if feature == "" {
+		u.writeError(w, http.StatusBadRequest, ErrMissingFeature)
+		return
+	}
+	to, err := parseTime(query.Get("to"), time.Now())
+	if err != nil {
+		u.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	from, err := parseTime(query.Get("from"), to.Add(-defaultHistoryWindows*u.windowSize))
+	if err != nil {
+		u.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	records := u.results.History(feature, from, to)
+	if records == nil {
+		records = []store.Record{}
+	}
+	u.writeJSON(w, http.StatusOK, map[string]interface{}{"feature": feature, "from": from, "to": to, "records": records})
+}
+
+// parseTime parses an RFC 3339 timestamp, returning fallback when raw is empty.
+func parseTime(raw string, fallback time.Time) (time.Time, error) {
+	if raw == "" {
+		return fallback, nil
+	}
+	t, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		return time.Time{}, ErrInvalidTime
+	}
+	return t, nil
+}
+
+func (u *UI) writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		u.logger.Warn("Failed to write web UI response", zap.Error(err))
+	}
+}
+
+func (u *UI) writeError(w http.ResponseWriter, status int, err error) {
+	u.writeJSON(w, status, map[string]string{"error": err.Error()})
+}